@@ -0,0 +1,382 @@
+// Command rtmp-bench is a load generator for the RTMP server. It runs N
+// synthetic publishers at a given bitrate and M subscribers against a local
+// in-process server (or an existing one with -addr) and reports delivered
+// messages/sec, CPU time, allocations, dropped frames and end-to-end
+// latency, so regressions in the chunk and broadcast path are measurable.
+//
+// Usage:
+//
+//	go run ./cmd/rtmp-bench -publishers 4 -subscribers 40 -bitrate 2500 -duration 10s
+//	go run ./cmd/rtmp-bench -json > bench.json
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"runtime"
+	"runtime/metrics"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/logger"
+	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
+	"github.com/alxayo/go-rtmp/internal/rtmp/client"
+	rtmpmetrics "github.com/alxayo/go-rtmp/internal/rtmp/metrics"
+	srv "github.com/alxayo/go-rtmp/internal/rtmp/server"
+)
+
+// benchConfig holds the parsed command-line flag values.
+type benchConfig struct {
+	addr        string        // existing server to target; empty starts one in-process
+	publishers  int           // synthetic publishers, one stream each
+	subscribers int           // players, spread round-robin over the streams
+	bitrate     int           // video bitrate per publisher in kbit/s
+	fps         int           // video frames per second
+	duration    time.Duration // measured run time
+	asJSON      bool          // print the report as JSON
+}
+
+// report is the benchmark result printed at the end of a run.
+type report struct {
+	Publishers       int                      `json:"publishers"`
+	Subscribers      int                      `json:"subscribers"`
+	BitrateKbps      int                      `json:"bitrate_kbps"`
+	DurationSec      float64                  `json:"duration_s"`
+	MessagesSent     int64                    `json:"messages_sent"`
+	MessagesReceived int64                    `json:"messages_received"`
+	MessagesPerSec   float64                  `json:"messages_per_sec"`
+	BytesReceived    int64                    `json:"bytes_received"`
+	Dropped          int64                    `json:"dropped"`
+	ServerDrops      int64                    `json:"server_drops"`
+	CPUSeconds       float64                  `json:"cpu_seconds"`
+	CPUPercent       float64                  `json:"cpu_percent"`
+	Allocs           uint64                   `json:"allocs"`
+	AllocBytes       uint64                   `json:"alloc_bytes"`
+	AllocsPerMessage float64                  `json:"allocs_per_message"`
+	Latency          rtmpmetrics.LatencyStats `json:"latency"`
+	Errors           []string                 `json:"errors,omitempty"`
+}
+
+func main() {
+	cfg := benchConfig{}
+	flag.StringVar(&cfg.addr, "addr", "", "Server address to benchmark (host:port). Empty = start a server in-process")
+	flag.IntVar(&cfg.publishers, "publishers", 1, "Number of synthetic publishers (one stream each)")
+	flag.IntVar(&cfg.subscribers, "subscribers", 10, "Number of subscribers, spread round-robin over the streams")
+	flag.IntVar(&cfg.bitrate, "bitrate", 2500, "Video bitrate per publisher in kbit/s")
+	flag.IntVar(&cfg.fps, "fps", 30, "Video frames per second")
+	flag.DurationVar(&cfg.duration, "duration", 10*time.Second, "How long to send media")
+	flag.BoolVar(&cfg.asJSON, "json", false, "Print the report as JSON")
+	flag.Parse()
+	if cfg.publishers < 1 || cfg.subscribers < 0 || cfg.bitrate < 1 || cfg.fps < 1 || cfg.duration <= 0 {
+		fmt.Fprintln(os.Stderr, "rtmp-bench: -publishers, -bitrate, -fps and -duration must be positive")
+		os.Exit(2)
+	}
+
+	logger.UseWriter(io.Discard)
+
+	addr := cfg.addr
+	if addr == "" {
+		s := srv.New(srv.Config{ListenAddr: "127.0.0.1:0", ChunkSize: 4096})
+		if err := s.Start(); err != nil {
+			fmt.Fprintln(os.Stderr, "rtmp-bench: start server:", err)
+			os.Exit(1)
+		}
+		defer s.Stop()
+		addr = s.Addr().String()
+	}
+
+	rep, err := run(cfg, addr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "rtmp-bench:", err)
+		os.Exit(1)
+	}
+	if cfg.asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(rep)
+	} else {
+		printReport(rep)
+	}
+	if len(rep.Errors) > 0 {
+		os.Exit(1)
+	}
+}
+
+// run connects the publishers, then the subscribers, sends media for
+// cfg.duration and collects the report.
+func run(cfg benchConfig, addr string) (*report, error) {
+	rep := &report{Publishers: cfg.publishers, Subscribers: cfg.subscribers, BitrateKbps: cfg.bitrate}
+	var errMu sync.Mutex
+	fail := func(err error) {
+		errMu.Lock()
+		rep.Errors = append(rep.Errors, err.Error())
+		errMu.Unlock()
+	}
+
+	pubs := make([]*publisher, cfg.publishers)
+	for i := range pubs {
+		p, err := newPublisher(fmt.Sprintf("rtmp://%s/bench/s%d", addr, i), cfg)
+		if err != nil {
+			return nil, fmt.Errorf("publisher %d: %w", i, err)
+		}
+		defer p.c.Close()
+		pubs[i] = p
+	}
+
+	subs := make([]*subscriber, cfg.subscribers)
+	for i := range subs {
+		s, err := newSubscriber(fmt.Sprintf("rtmp://%s/bench/s%d", addr, i%cfg.publishers))
+		if err != nil {
+			return nil, fmt.Errorf("subscriber %d: %w", i, err)
+		}
+		subs[i] = s
+	}
+
+	serverDrops := rtmpmetrics.SubscriberDropsTotal.Value()
+	cpuBefore := cpuSeconds()
+	var memBefore runtime.MemStats
+	runtime.ReadMemStats(&memBefore)
+
+	start := time.Now()
+	var readers sync.WaitGroup
+	for _, s := range subs {
+		readers.Add(1)
+		go func() { defer readers.Done(); s.read(start) }()
+	}
+	var senders sync.WaitGroup
+	for _, p := range pubs {
+		senders.Add(1)
+		go func() {
+			defer senders.Done()
+			if err := p.send(start, cfg); err != nil {
+				fail(err)
+			}
+		}()
+	}
+	senders.Wait()
+	elapsed := time.Since(start)
+
+	// Let queued media drain, then stop the readers.
+	time.Sleep(500 * time.Millisecond)
+	for _, s := range subs {
+		s.stop()
+	}
+	readers.Wait()
+
+	var memAfter runtime.MemStats
+	runtime.ReadMemStats(&memAfter)
+	rep.CPUSeconds = cpuSeconds() - cpuBefore
+	rep.Allocs = memAfter.Mallocs - memBefore.Mallocs
+	rep.AllocBytes = memAfter.TotalAlloc - memBefore.TotalAlloc
+	rep.ServerDrops = rtmpmetrics.SubscriberDropsTotal.Value() - serverDrops
+	if cfg.addr != "" {
+		rep.ServerDrops = 0 // counters of a remote server are not visible here
+	}
+
+	rep.DurationSec = elapsed.Seconds()
+	rep.CPUPercent = 100 * rep.CPUSeconds / rep.DurationSec
+	sentPerStream := make([]int64, len(pubs))
+	for i, p := range pubs {
+		sentPerStream[i] = p.sent
+		rep.MessagesSent += p.sent
+	}
+	windows := make([]*rtmpmetrics.LatencyWindow, len(subs))
+	for i, s := range subs {
+		rep.MessagesReceived += s.received.Load()
+		rep.BytesReceived += s.bytes.Load()
+		rep.Dropped += max(0, sentPerStream[i%len(pubs)]-s.received.Load())
+		windows[i] = &s.latency
+	}
+	rep.MessagesPerSec = float64(rep.MessagesReceived) / rep.DurationSec
+	if rep.MessagesReceived > 0 {
+		rep.AllocsPerMessage = float64(rep.Allocs) / float64(rep.MessagesReceived)
+	}
+	rep.Latency = rtmpmetrics.MergeLatency(windows...)
+	return rep, nil
+}
+
+// publisher is a synthetic publisher sending H.264 video at the
+// configured bitrate and frame rate with ~128 kbit/s AAC audio.
+type publisher struct {
+	c    *client.Client
+	src  *client.SyntheticStream
+	sent int64 // media messages sent, including sequence headers
+}
+
+// newPublisher connects, publishes and sends sequence headers. It returns
+// once the server has answered NetStream.Publish.Start.
+func newPublisher(url string, cfg benchConfig) (*publisher, error) {
+	c, conn, err := dial(url)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Publish(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if err := awaitStatus(c, conn, "NetStream.Publish.Start"); err != nil {
+		c.Close()
+		return nil, err
+	}
+	p := &publisher{c: c, src: &client.SyntheticStream{FPS: cfg.fps, VideoBitrate: cfg.bitrate * 1000}}
+	for _, h := range p.src.Headers() {
+		if err := c.SendFrame(h); err != nil {
+			c.Close()
+			return nil, err
+		}
+		p.sent++
+	}
+	return p, nil
+}
+
+// send sends frames in real time until cfg.duration has passed.
+// Timestamps are milliseconds since start, which subscribers use to
+// measure latency.
+func (p *publisher) send(start time.Time, cfg benchConfig) error {
+	pacer := &client.Pacer{Start: start}
+	end := uint32(cfg.duration / time.Millisecond)
+	for {
+		f := p.src.Next()
+		if f.Timestamp >= end {
+			return nil
+		}
+		if err := pacer.Wait(context.Background(), f.Timestamp); err != nil {
+			return err
+		}
+		if err := p.c.SendFrame(f); err != nil {
+			return fmt.Errorf("send: %w", err)
+		}
+		p.sent++
+	}
+}
+
+// subscriber plays one stream and counts the media it receives.
+type subscriber struct {
+	c        *client.Client
+	conn     net.Conn // closed by stop to unblock read
+	received atomic.Int64
+	bytes    atomic.Int64
+	latency  rtmpmetrics.LatencyWindow
+}
+
+// newSubscriber connects and plays url, returning once the server has
+// answered NetStream.Play.Start.
+func newSubscriber(url string) (*subscriber, error) {
+	c, conn, err := dial(url)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Play(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if err := awaitStatus(c, conn, "NetStream.Play.Start"); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return &subscriber{c: c, conn: conn}, nil
+}
+
+// read counts audio/video messages until the connection is closed. Frames
+// other than sequence headers are timed against their timestamp.
+func (s *subscriber) read(start time.Time) {
+	defer s.c.Close()
+	for {
+		m, err := s.c.ReadMessage()
+		if err != nil {
+			return
+		}
+		if m.TypeID != 8 && m.TypeID != 9 {
+			continue
+		}
+		s.received.Add(1)
+		s.bytes.Add(int64(len(m.Payload)))
+		if len(m.Payload) > 1 && m.Payload[1] != 0x00 {
+			s.latency.Observe(time.Since(start) - time.Duration(m.Timestamp)*time.Millisecond)
+		}
+	}
+}
+
+// stop closes the connection, ending read.
+func (s *subscriber) stop() { _ = s.conn.Close() }
+
+// dial connects a silent client to url and returns it with its underlying
+// connection, which the caller may close or set deadlines on.
+func dial(url string) (*client.Client, net.Conn, error) {
+	c, err := client.New(url)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	c.ConnectTimeout = 5 * time.Second
+	var conn net.Conn
+	c.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		var err error
+		conn, err = (&net.Dialer{}).DialContext(ctx, network, addr)
+		return conn, err
+	}
+	if err := c.Connect(); err != nil {
+		return nil, nil, err
+	}
+	return c, conn, nil
+}
+
+// awaitStatus reads messages until an onStatus with code arrives, failing
+// on any other error-level status or after 5 seconds.
+func awaitStatus(c *client.Client, conn net.Conn, code string) error {
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	defer conn.SetReadDeadline(time.Time{})
+	for {
+		m, err := c.ReadMessage()
+		if err != nil {
+			return fmt.Errorf("waiting for %s: %w", code, err)
+		}
+		if m.TypeID != 20 {
+			continue
+		}
+		vals, err := amf.DecodeAll(m.Payload)
+		if err != nil || len(vals) < 4 || vals[0] != "onStatus" {
+			continue
+		}
+		info, _ := vals[3].(map[string]interface{})
+		if info["code"] == code {
+			return nil
+		}
+		if info["level"] == "error" {
+			return fmt.Errorf("%v", info["code"])
+		}
+	}
+}
+
+// cpuSeconds returns the CPU time used by the process so far, as estimated
+// by the Go runtime (total minus idle).
+func cpuSeconds() float64 {
+	samples := []metrics.Sample{
+		{Name: "/cpu/classes/total:cpu-seconds"},
+		{Name: "/cpu/classes/idle:cpu-seconds"},
+	}
+	metrics.Read(samples)
+	return samples[0].Value.Float64() - samples[1].Value.Float64()
+}
+
+func printReport(r *report) {
+	fmt.Printf("publishers:        %d @ %d kbit/s\n", r.Publishers, r.BitrateKbps)
+	fmt.Printf("subscribers:       %d\n", r.Subscribers)
+	fmt.Printf("duration:          %.1fs\n", r.DurationSec)
+	fmt.Printf("messages sent:     %d\n", r.MessagesSent)
+	fmt.Printf("messages received: %d (%.0f msg/s, %.1f Mbit/s)\n", r.MessagesReceived, r.MessagesPerSec, float64(r.BytesReceived)*8/1e6/r.DurationSec)
+	fmt.Printf("dropped:           %d (server drops %d)\n", r.Dropped, r.ServerDrops)
+	fmt.Printf("cpu:               %.2fs (%.0f%% of one core)\n", r.CPUSeconds, r.CPUPercent)
+	fmt.Printf("allocations:       %d (%d bytes, %.1f per message)\n", r.Allocs, r.AllocBytes, r.AllocsPerMessage)
+	fmt.Printf("latency:           p50 %.1fms  p95 %.1fms  p99 %.1fms\n", r.Latency.P50Ms, r.Latency.P95Ms, r.Latency.P99Ms)
+	for _, e := range r.Errors {
+		fmt.Println("error:", e)
+	}
+}
@@ -0,0 +1,130 @@
+// Command rtmp-probe plays a stream for a while and prints what it
+// received as JSON: video and audio codecs, resolution (from the H.264 SPS
+// or onMetaData), bitrate, frame rate, keyframe interval, timestamp
+// continuity and an estimate of frames lost in timestamp gaps. It exits
+// non-zero when the stream cannot be played or delivers no media, so it
+// doubles as a health check for monitoring systems.
+//
+// Usage:
+//
+//	go run ./cmd/rtmp-probe rtmp://localhost:1935/live/show
+//	go run ./cmd/rtmp-probe -duration 30s -compact rtmps://ingest.example.com/live/show
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/logger"
+	"github.com/alxayo/go-rtmp/internal/rtmp/client"
+	"github.com/alxayo/go-rtmp/internal/rtmp/probe"
+)
+
+// probeConfig holds the parsed command-line flag values.
+type probeConfig struct {
+	url         string        // stream to play
+	duration    time.Duration // how long to play it
+	timeout     time.Duration // connect timeout
+	tlsInsecure bool          // skip certificate verification for rtmps://
+	compact     bool          // print the report on one line
+}
+
+// output is the printed report, with the reason the probe failed.
+type output struct {
+	probe.Report
+	Error string `json:"error,omitempty"`
+}
+
+func main() {
+	cfg := probeConfig{}
+	flag.DurationVar(&cfg.duration, "duration", 10*time.Second, "How long to play the stream")
+	flag.DurationVar(&cfg.timeout, "timeout", 5*time.Second, "Connect timeout")
+	flag.BoolVar(&cfg.tlsInsecure, "tls-insecure", false, "Skip certificate verification for rtmps:// URLs")
+	flag.BoolVar(&cfg.compact, "compact", false, "Print the report on one line")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: rtmp-probe [flags] rtmp[s]://host[:port]/app/stream")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 || cfg.duration <= 0 || cfg.timeout <= 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	cfg.url = flag.Arg(0)
+	logger.UseWriter(io.Discard)
+
+	out := run(cfg)
+	enc := json.NewEncoder(os.Stdout)
+	if !cfg.compact {
+		enc.SetIndent("", "  ")
+	}
+	_ = enc.Encode(out)
+	if out.Error != "" {
+		os.Exit(1)
+	}
+}
+
+// run plays cfg.url for cfg.duration and reports on it. A stream that
+// cannot be played, ends early or sends no audio or video sets Error.
+func run(cfg probeConfig) output {
+	a := probe.NewAnalyzer(cfg.url)
+	start := time.Now()
+	report := func(err error) output {
+		out := output{Report: a.Report(time.Since(start).Seconds())}
+		if err != nil {
+			out.Error = err.Error()
+		} else if out.Video == nil && out.Audio == nil {
+			out.Error = "no audio or video received"
+		}
+		return out
+	}
+
+	c, err := client.New(cfg.url)
+	if err != nil {
+		return report(err)
+	}
+	c.SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	c.ConnectTimeout = cfg.timeout
+	opts := client.TLSOptions{InsecureSkipVerify: cfg.tlsInsecure}
+	if c.TLSConfig, err = opts.Config(); err != nil {
+		return report(err)
+	}
+	var conn net.Conn // the TCP connection, for the read deadline
+	c.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		var err error
+		conn, err = (&net.Dialer{}).DialContext(ctx, network, addr)
+		return conn, err
+	}
+	if err := c.Connect(); err != nil {
+		return report(fmt.Errorf("connect: %w", err))
+	}
+	defer c.Close()
+	if err := c.Play(); err != nil {
+		return report(fmt.Errorf("play: %w", err))
+	}
+
+	start = time.Now()
+	_ = conn.SetReadDeadline(start.Add(cfg.duration))
+	for {
+		m, err := c.ReadMessage()
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				return report(nil) // played for cfg.duration
+			}
+			return report(fmt.Errorf("stream ended after %s: %w", time.Since(start).Round(time.Millisecond), err))
+		}
+		a.Add(m)
+		if code := a.Failure(); code != "" {
+			return report(fmt.Errorf("play refused: %s", code))
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Command rtmp-push publishes an FLV file, or FLV piped on standard input,
+// to an RTMP server in real time: a pure-Go stand-in for
+// `ffmpeg -re -i in.flv -c copy -f flv rtmp://...`. It can loop a file
+// forever with continuous timestamps and reconnects when the connection
+// drops, resending metadata and sequence headers and resuming on a
+// keyframe.
+//
+// Usage:
+//
+//	go run ./cmd/rtmp-push -loop recording.flv rtmp://localhost:1935/live/show
+//	ffmpeg -re -i in.mp4 -c copy -f flv - | go run ./cmd/rtmp-push -no-pace - rtmp://localhost:1935/live/show
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/logger"
+	"github.com/alxayo/go-rtmp/internal/rtmp/client"
+)
+
+// pushConfig holds the parsed command-line flag values.
+type pushConfig struct {
+	input          string        // FLV file, or "-" for standard input
+	url            string        // stream to publish
+	loop           bool          // start the file again when it ends
+	speed          float64       // pace relative to real time
+	noPace         bool          // send as fast as possible (input already paced)
+	reconnects     int           // reconnect attempts in a row; negative = forever
+	reconnectDelay time.Duration // wait before each reconnect
+	timeout        time.Duration // connect timeout
+	tlsInsecure    bool          // skip certificate verification for rtmps://
+}
+
+func main() {
+	cfg := pushConfig{}
+	flag.BoolVar(&cfg.loop, "loop", false, "Start the file again when it ends, with timestamps continuing")
+	flag.Float64Var(&cfg.speed, "speed", 1, "Pace relative to real time (2 = twice as fast)")
+	flag.BoolVar(&cfg.noPace, "no-pace", false, "Send as fast as the connection allows (for input that is already paced, e.g. ffmpeg -re)")
+	flag.IntVar(&cfg.reconnects, "reconnect", 5, "Reconnect attempts in a row after the connection fails (-1 = forever, 0 = never)")
+	flag.DurationVar(&cfg.reconnectDelay, "reconnect-delay", client.DefaultReconnectDelay, "Wait before each reconnect")
+	flag.DurationVar(&cfg.timeout, "timeout", 5*time.Second, "Connect timeout")
+	flag.BoolVar(&cfg.tlsInsecure, "tls-insecure", false, "Skip certificate verification for rtmps:// URLs")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: rtmp-push [flags] file.flv|- rtmp[s]://host[:port]/app/stream")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 || cfg.speed <= 0 || cfg.timeout <= 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	cfg.input, cfg.url = flag.Arg(0), flag.Arg(1)
+	if cfg.input == "-" && cfg.loop {
+		fmt.Fprintln(os.Stderr, "rtmp-push: -loop needs a file; standard input cannot be read twice")
+		os.Exit(2)
+	}
+	logger.UseWriter(io.Discard)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	start := time.Now()
+	stats, err := push(ctx, cfg)
+	fmt.Fprintf(os.Stderr, "rtmp-push: sent %d messages (%d bytes, up to %s of media) in %s, %d loops, %d reconnects\n",
+		stats.Messages, stats.Bytes, time.Duration(stats.LastTimestamp)*time.Millisecond,
+		time.Since(start).Round(time.Millisecond), stats.Loops, stats.Reconnects)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Fprintln(os.Stderr, "rtmp-push:", err)
+		os.Exit(1)
+	}
+}
+
+// push publishes cfg.input to cfg.url until the input ends (or, with
+// -loop, until interrupted).
+func push(ctx context.Context, cfg pushConfig) (client.PushStats, error) {
+	tlsConfig, err := client.TLSOptions{InsecureSkipVerify: cfg.tlsInsecure}.Config()
+	if err != nil {
+		return client.PushStats{}, err
+	}
+	open := func() (io.ReadCloser, error) {
+		if cfg.input == "-" {
+			return io.NopCloser(os.Stdin), nil
+		}
+		return os.Open(cfg.input)
+	}
+	opts := client.PushOptions{
+		Loop:           cfg.loop,
+		Speed:          cfg.speed,
+		NoPacing:       cfg.noPace,
+		Reconnects:     cfg.reconnects,
+		ReconnectDelay: cfg.reconnectDelay,
+		Configure: func(c *client.Client) {
+			c.SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+			c.TLSConfig = tlsConfig
+			c.ConnectTimeout = cfg.timeout
+		},
+		OnReconnect: func(attempt int, err error) {
+			fmt.Fprintf(os.Stderr, "rtmp-push: %v; reconnecting (attempt %d)\n", err, attempt)
+		},
+	}
+	return client.PushFLV(ctx, cfg.url, open, opts)
+}
@@ -0,0 +1,202 @@
+// Command rtmp-replay replays connection traces written by the server's
+// -trace-dir option against a server and checks that it answers the way it
+// did when the trace was taken: every command the server sent (_result,
+// onStatus with its code, ...) must arrive again. It exits non-zero on the
+// first missing response, so a trace attached to a bug report doubles as a
+// regression test.
+//
+// The client's side is replayed from the trace's raw capture (the .in.bin
+// file next to it), byte for byte as the client sent it. With -rechunk, or
+// when the capture is missing, the traced messages are re-chunked instead.
+//
+// Without -addr an in-process server is started for the replay. Several
+// traces are replayed concurrently, one connection each, keeping their
+// relative timing with -speed (e.g. a publisher and its players).
+//
+// A file that is not a trace, such as a chunk vector from tests/golden, is
+// sent as raw bytes after the handshake; whatever the server sends back is
+// printed.
+//
+// Usage:
+//
+//	go run ./cmd/rtmp-replay traces/c000001-20260501T100000.jsonl
+//	go run ./cmd/rtmp-replay -addr localhost:1935 -speed 1 -v traces/*.jsonl
+//	go run ./cmd/rtmp-replay -rechunk traces/c000001-20260501T100000.jsonl
+//	go run ./cmd/rtmp-replay tests/golden/chunk_fmt0_audio.bin
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/logger"
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/handshake"
+	srv "github.com/alxayo/go-rtmp/internal/rtmp/server"
+	"github.com/alxayo/go-rtmp/internal/rtmp/trace"
+)
+
+// replayConfig holds the parsed command-line flag values.
+type replayConfig struct {
+	addr    string        // server to replay against; empty starts one in-process
+	speed   float64       // pacing relative to the trace; 0 = as fast as responses allow
+	timeout time.Duration // wait for each expected response
+	verbose bool          // print every message sent and received
+	rechunk bool          // re-chunk traced messages instead of sending the raw capture
+}
+
+// outcome is the result of replaying one file.
+type outcome struct {
+	path string
+	res  trace.ReplayResult
+	err  error
+}
+
+func main() {
+	cfg := replayConfig{}
+	flag.StringVar(&cfg.addr, "addr", "", "Server to replay against (default: start one in-process)")
+	flag.Float64Var(&cfg.speed, "speed", 0, "Replay pace relative to the trace, e.g. 1 or 2 (0 = no pacing)")
+	flag.DurationVar(&cfg.timeout, "timeout", trace.DefaultResponseTimeout, "How long to wait for each expected response")
+	flag.BoolVar(&cfg.verbose, "v", false, "Print every message sent and received")
+	flag.BoolVar(&cfg.rechunk, "rechunk", false, "Re-chunk the traced messages instead of sending the client's captured bytes")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: rtmp-replay [flags] trace.jsonl...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if cfg.speed < 0 || cfg.timeout <= 0 {
+		fmt.Fprintln(os.Stderr, "rtmp-replay: -speed must be >= 0 and -timeout > 0")
+		os.Exit(2)
+	}
+
+	logger.UseWriter(io.Discard)
+	if cfg.addr == "" {
+		s := srv.New(srv.Config{ListenAddr: "127.0.0.1:0"})
+		if err := s.Start(); err != nil {
+			fmt.Fprintln(os.Stderr, "rtmp-replay: start server:", err)
+			os.Exit(1)
+		}
+		defer s.Stop()
+		cfg.addr = s.Addr().String()
+	}
+
+	failed := false
+	for _, o := range replayAll(context.Background(), cfg, flag.Args()) {
+		if o.err != nil {
+			fmt.Fprintf(os.Stderr, "rtmp-replay: %s: %v\n", o.path, o.err)
+			failed = true
+			continue
+		}
+		fmt.Printf("%s: ok  sent=%d checked=%d received=%d\n", o.path, o.res.Sent, o.res.Checked, o.res.Received)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// replayAll replays each file on its own connection, concurrently, and
+// returns the outcomes in argument order.
+func replayAll(ctx context.Context, cfg replayConfig, paths []string) []outcome {
+	outcomes := make([]outcome, len(paths))
+	traces := make([][]trace.Record, len(paths))
+	raws := make([][]byte, len(paths))
+	var origin time.Time // earliest trace start, shared so relative timing holds
+	for i, path := range paths {
+		outcomes[i].path = path
+		h, recs, err := trace.ReadFile(path)
+		if err != nil {
+			continue // not a trace: replayed as raw bytes below
+		}
+		traces[i] = recs
+		if !cfg.rechunk {
+			if raws[i], err = trace.ReadRaw(path, h); err != nil {
+				fmt.Fprintf(os.Stderr, "rtmp-replay: %s: no raw capture, re-chunking messages: %v\n", path, err)
+			}
+		}
+		if origin.IsZero() || h.Start.Before(origin) {
+			origin = h.Start
+		}
+	}
+
+	var printMu sync.Mutex
+	var wg sync.WaitGroup
+	for i, path := range paths {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			o := &outcomes[i]
+			conn, err := net.Dial("tcp", cfg.addr)
+			if err != nil {
+				o.err = err
+				return
+			}
+			if traces[i] == nil {
+				o.res, o.err = replayRaw(conn, path, cfg)
+				return
+			}
+			opts := trace.ReplayOptions{Speed: cfg.speed, Origin: origin, ResponseTimeout: cfg.timeout, Raw: raws[i]}
+			if cfg.verbose {
+				opts.OnMessage = func(dir trace.Direction, msg *chunk.Message) {
+					printMu.Lock()
+					defer printMu.Unlock()
+					printMessage(path, dir, msg)
+				}
+			}
+			o.res, o.err = trace.Replay(ctx, conn, traces[i], opts)
+		}()
+	}
+	wg.Wait()
+	return outcomes
+}
+
+// replayRaw sends the file at path as raw bytes after the handshake and
+// prints the messages the server sends back until it goes quiet for
+// cfg.timeout or closes the connection.
+func replayRaw(conn net.Conn, path string, cfg replayConfig) (trace.ReplayResult, error) {
+	var res trace.ReplayResult
+	defer conn.Close()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return res, err
+	}
+	if err := handshake.ClientHandshake(conn); err != nil {
+		return res, fmt.Errorf("handshake: %w", err)
+	}
+	if _, err := conn.Write(data); err != nil {
+		return res, fmt.Errorf("send: %w", err)
+	}
+	res.Sent = 1
+	r := chunk.NewReader(conn, 128)
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(cfg.timeout))
+		msg, err := r.ReadMessage()
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() || errors.Is(err, io.EOF) {
+				return res, nil
+			}
+			return res, fmt.Errorf("read: %w", err)
+		}
+		res.Received++
+		printMessage(path, trace.Out, msg)
+	}
+}
+
+// printMessage prints one replayed message: "in" was sent to the server,
+// "out" came from it, matching the trace's point of view.
+func printMessage(path string, dir trace.Direction, msg *chunk.Message) {
+	summary := trace.ResponseKey(msg.TypeID, msg.Payload)
+	fmt.Printf("%s  %-3s  csid=%-2d type=%-2d stream=%d ts=%d len=%d  %s\n",
+		path, dir, msg.CSID, msg.TypeID, msg.MessageStreamID, msg.Timestamp, len(msg.Payload), summary)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/logger"
+	"github.com/alxayo/go-rtmp/internal/rtmp/client"
+	srv "github.com/alxayo/go-rtmp/internal/rtmp/server"
+	"github.com/alxayo/go-rtmp/internal/telemetry"
+)
+
+// checkConfig is the -check-config dry run. The flags were already validated
+// by parseFlags; it loads the files and settings main builds at startup
+// (auth token files, the client certificate ACL, SRT passphrases, relay TLS
+// and tracing settings), runs srv.Check for hooks, relay URLs, output
+// directories and the RTMPS certificate, and writes one line per check to
+// w. Nothing is listened on or connected to. It returns the exit code: 0
+// when every check passed, 1 otherwise.
+func checkConfig(cfg *cliConfig, w io.Writer) int {
+	results := []srv.CheckResult{{Name: "flags"}}
+	add := func(name, detail string, err error) {
+		results = append(results, srv.CheckResult{Name: name, Detail: detail, Err: err})
+	}
+
+	_, err := buildAuthValidator(cfg, logger.Logger())
+	add("auth", "mode "+cfg.authMode, err)
+	if cfg.playAuthMode != "" {
+		_, err := buildPlayAuthValidator(cfg)
+		add("play auth", "mode "+cfg.playAuthMode, err)
+	}
+	if cfg.tlsClientACL != "" {
+		_, err := srv.LoadClientCertACL(cfg.tlsClientACL)
+		add("tls client acl", cfg.tlsClientACL, err)
+	}
+	if cfg.srtPassphraseFile != "" {
+		_, _, err := buildSRTResolver(cfg)
+		add("srt passphrase file", cfg.srtPassphraseFile, err)
+	}
+	if cfg.relayTLSCA != "" {
+		_, err := client.TLSOptions{RootCAFile: cfg.relayTLSCA}.Config()
+		add("relay tls ca", cfg.relayTLSCA, err)
+	}
+	tracer, err := telemetry.FromEnv(logger.Logger())
+	if err != nil || tracer != nil {
+		add("tracing", "OTEL_* environment", err)
+	}
+	if tracer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		_ = tracer.Shutdown(ctx)
+		cancel()
+	}
+	results = append(results, srv.Check(serverConfig(cfg))...)
+
+	failed := 0
+	for _, r := range results {
+		status := "ok"
+		if r.Err != nil {
+			status = "FAIL"
+			failed++
+		}
+		line := fmt.Sprintf("%-4s  %s", status, r.Name)
+		if r.Detail != "" {
+			line += " (" + r.Detail + ")"
+		}
+		if r.Err != nil {
+			line += ": " + r.Err.Error()
+		}
+		fmt.Fprintln(w, line)
+	}
+	if failed > 0 {
+		fmt.Fprintf(w, "configuration invalid: %d of %d checks failed\n", failed, len(results))
+		return 1
+	}
+	fmt.Fprintf(w, "configuration OK: %d checks passed\n", len(results))
+	return 0
+}
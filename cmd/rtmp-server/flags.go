@@ -4,10 +4,22 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"net"
 	"net/url"
 	"os"
 	"strings"
 	"time"
+
+	"github.com/alxayo/go-rtmp/internal/cluster"
+	"github.com/alxayo/go-rtmp/internal/logger"
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/client"
+	"github.com/alxayo/go-rtmp/internal/rtmp/control"
+	"github.com/alxayo/go-rtmp/internal/rtmp/link"
+	"github.com/alxayo/go-rtmp/internal/rtmp/relay"
+	srv "github.com/alxayo/go-rtmp/internal/rtmp/server"
+	"github.com/alxayo/go-rtmp/internal/rtmp/server/hooks"
+	"github.com/alxayo/go-rtmp/internal/storage"
 )
 
 // version is set at build time using: go build -ldflags "-X main.version=v0.4.0"
@@ -19,35 +31,128 @@ var version = "v0.4.0"
 type cliConfig struct {
 	listenAddr        string   // TCP address to listen on (e.g. ":1935")
 	logLevel          string   // log verbosity level (debug/info/warn/error)
+	logFormat         string   // log output format: json or text
+	logComponents     string   // per-component level overrides, e.g. "rtmp_server=warn,dispatcher=debug"
+	logDebugSample    int      // per-packet debug logs: log one in this many
 	recordAll         bool     // whether to record all published streams
+	recordStreams     []string // record only streams matching these patterns
 	recordDir         string   // directory for FLV recording files
+	recordFormat      string   // recording container: "auto", "flv" or "mp4"
+	recordTimecode    bool     // keep onFI timecodes in FLV recordings
 	segmentDuration   string   // segment duration string (e.g., "30s", "5m")
 	segmentPattern    string   // filename pattern for segments
+	recordQueueSize   int      // media messages buffered per recorder
+	recordStorage     string   // where finished recordings are copied (file:// or s3://)
 	chunkSize         uint     // outbound chunk size (1-65536 bytes)
+	windowAckSize     uint     // Window Acknowledgement Size sent in the control burst
+	peerBandwidth     uint     // Set Peer Bandwidth value sent in the control burst
+	peerLimit         string   // Set Peer Bandwidth limit type: hard, soft or dynamic
+	maxMessageSize    uint     // largest inbound message in bytes
+	maxChunkStreams   int      // most chunk stream IDs per connection
+	maxAMFSize        uint     // largest inbound AMF command/data message in bytes
+	maxChunkSize      uint     // largest chunk size a client may set
 	showVersion       bool     // print version and exit
+	checkConfig       bool     // validate the configuration, print a report and exit
 	relayDestinations []string // RTMP URLs to relay published streams to
+	relayProxy        string   // egress proxy for relay connections (socks5:// or http://)
+	relayTLSInsecure  bool     // skip certificate verification for rtmps:// relay destinations
+	relayTLSCA        string   // PEM CA bundle for verifying rtmps:// relay destinations
+	relayTLSName      string   // SNI / verification name override for rtmps:// relay destinations
+	relayQueueSize    int      // media messages buffered per relay destination
+	vodEnabled        bool     // serve recordings as VOD when no live publisher exists
+	dvrWindow         string   // media kept per stream for time-shifted play; "0" disables
+	originURL         string   // edge mode: pull streams with no local publisher from this origin
+	clusterRedis      string   // Redis URL of the shared stream directory; empty disables
+	clusterNodeURL    string   // rtmp://host:port announced for streams published here
+	linkListen        string   // TCP address of the origin link for edges; empty disables
+	linkSecret        string   // shared secret of link requests, served and sent
+	variantSeparator  string   // separator for multi-bitrate variant keys (e.g. "_"); empty disables
+	transcodeCommand  string   // per-stream transcoder command template; empty disables
+	thumbnailInterval string   // keep H.264 keyframes and make JPEG previews this often; "0" disables
+	thumbnailCommand  string   // command turning an Annex B keyframe on stdin into {output}; empty = keyframes only
+	thumbnailDir      string   // where JPEG previews are written
+	publisherPolicy   string   // duplicate publisher policy: replace, reject or rename
+	statusTxn         string   // onStatus transaction ID mode: zero or echo
+	endedStreamTTL    string   // how long an unpublished stream is kept (e.g. "30s")
+	latencyStats      bool     // measure ingest-to-delivery latency per stream and relay
+	mediaDiagnostics  bool     // debug-log parsed media tag headers (sampled)
+	traceDir          string   // per-connection RTMP message traces; empty disables
+	chunkDiagnostics  int      // inbound chunk headers kept to dump on read errors; 0 disables
+	inspect           bool     // protocol analyzer mode: accept any publish, discard media, report
+	inspectDir        string   // where inspect reports are written; empty logs them
+	rejectReply       bool     // answer RTMPE/RTMPT handshakes before closing
+	redundantIngest   bool     // play <key>_primary / <key>_backup publishers as <key>
+	failoverTimeout   string   // media gap after which an alias source counts as stalled
+	slowDropRate      float64  // disconnect subscribers dropping more than this share of media; 0 disables
+	slowWindow        string   // how long the drop rate must stay above slowDropRate
+	pingInterval      string   // heartbeat Ping Request interval for players; "0" disables
+	pingMisses        int      // unanswered pings in a row before a player is disconnected
+	maxSubscribers    int      // most players per stream; 0 = no limit
+	avDriftThreshold  string   // audio/video timestamp drift that flags a stream; "0" disables
+	sendTimeout       string   // how long a message waits for room in a full connection queue
+	idleTimeout       string   // how long a client may send nothing before it is disconnected
+	streamKeyMaxLen   int      // longest accepted app/name stream key in bytes
+	streamKeyCharset  string   // regexp character class stream key segments are made of
+
+	// Per-app settings, parsed from -app
+	apps map[string]srv.AppConfig
+
+	// Virtual hosts, parsed from -vhost
+	vhosts map[string]srv.VHostConfig
+
+	// Per-destination push profiles, parsed from -relay-profile
+	relayProfiles []relay.Profile
+
+	// Stream aliases (primary/backup failover), parsed from -stream-alias
+	streamAliases []srv.StreamAlias
 
 	// TLS (RTMPS) configuration
 	tlsListenAddr string // optional RTMPS listen address (e.g. ":443")
 	tlsCertFile   string // path to PEM-encoded TLS certificate
 	tlsKeyFile    string // path to PEM-encoded TLS private key
+	tlsSelfSigned bool   // generate an in-memory self-signed certificate (development)
+	tlsClientCA   string // PEM CA bundle RTMPS client certificates must be signed by (mutual TLS)
+	tlsClientACL  string // JSON file mapping client certificate names to allowed stream keys
 
 	// Event hooks
-	hookScripts     []string // shell hooks: "event_type=/path/to/script"
-	hookWebhooks    []string // webhook hooks: "event_type=https://url"
+	hookScripts     []string // shell hooks: "event_type[@pattern]=/path/to/script"
+	hookWebhooks    []string // webhook hooks: "event_type[@pattern]=https://url"
 	hookStdioFormat string   // stdio output: "json", "env", or ""
 	hookTimeout     string   // hook execution timeout (e.g. "30s")
 	hookConcurrency int      // max concurrent hook executions
 
+	hookWebhookSecret  string   // HMAC-SHA256 signing secret for webhooks
+	hookWebhookHeaders []string // extra webhook headers: "Name: value"
+	hookWebhookRetries int      // webhook retries after a failed delivery
+	hookQueueSize      int      // max queued events per webhook (0 = no queue)
+	hookQueueMaxAge    string   // max age of queued webhook events (e.g. "1h")
+	hookQueueDir       string   // directory persisting webhook queues
+
 	// Metrics
 	metricsAddr string // HTTP address for expvar metrics (e.g. ":8080"); empty = disabled
+	pprofAddr   string // HTTP address for net/http/pprof (may equal metricsAddr); empty = disabled
 
 	// Authentication
-	authMode            string   // "none", "token", "file", "callback"
+	authMode            string   // "none", "token", "file", "callback", "signed", "store"
 	authTokens          []string // "streamKey=token" pairs (for mode=token)
 	authFile            string   // path to JSON token file (for mode=file)
 	authCallbackURL     string   // webhook URL (for mode=callback)
 	authCallbackTimeout string   // callback HTTP timeout (default "5s")
+	authSecret          string   // HMAC secret for signed URL tokens (for mode=signed)
+	authAppSecrets      []string // per-app secrets: "app=secret" (for mode=signed)
+	authClockSkew       string   // expiry tolerance for signed tokens (default "30s")
+	authStore           string   // token store: "memory", "file:PATH" or a redis:// URL (for mode=store)
+
+	// Play authentication (empty mode: plays use the -auth-mode validator)
+	playAuthMode        string   // "", "token", "file", "callback", "signed", "viewers"
+	playAuthTokens      []string // "streamKey=token" pairs (for mode=token)
+	playAuthFile        string   // JSON token file (for mode=file) or viewer token file (for mode=viewers)
+	playAuthCallbackURL string   // webhook URL (for mode=callback)
+	playAuthSecret      string   // HMAC secret for signed play tokens (for mode=signed)
+
+	// Admin API
+	adminAddr  string // HTTP address for the admin API; empty = disabled
+	adminToken string // bearer token required by the admin API
 
 	// SRT configuration
 	srtListenAddr     string // SRT UDP listen address (e.g. ":10080"). Empty = disabled
@@ -58,6 +163,9 @@ type cliConfig struct {
 
 	// Reconnect
 	reconnectURL string // URL to redirect clients to when SIGUSR1 triggers a reconnect-all request
+
+	// Binary upgrade
+	drainTimeout string // how long a process replaced on SIGUSR2 keeps serving its connections; 0 = until they end
 }
 
 func parseFlags(args []string) (*cliConfig, error) {
@@ -68,12 +176,27 @@ func parseFlags(args []string) (*cliConfig, error) {
 	var relayDests stringSliceFlag
 	var hookScripts stringSliceFlag
 	var hookWebhooks stringSliceFlag
+	var hookWebhookHeaders stringSliceFlag
 	var authTokens stringSliceFlag
+	var authAppSecrets stringSliceFlag
+	var playAuthTokens stringSliceFlag
+	var streamAliases stringSliceFlag
+	var recordStreams stringSliceFlag
+	var apps stringSliceFlag
+	var vhosts stringSliceFlag
+	var relayProfiles stringSliceFlag
 
 	fs.StringVar(&cfg.listenAddr, "listen", ":1935", "TCP listen address (e.g. :1935 or 0.0.0.0:1935)")
 	fs.StringVar(&cfg.logLevel, "log-level", "info", "Log level: debug|info|warn|error")
+	fs.StringVar(&cfg.logFormat, "log-format", logger.FormatJSON, "Log output format: json (one object per line, for log shippers) or text")
+	fs.StringVar(&cfg.logComponents, "log-component-levels", "", "Per-component log levels overriding -log-level, e.g. 'rtmp_server=warn,dispatcher=debug'")
+	fs.IntVar(&cfg.logDebugSample, "log-debug-sample", logger.DefaultDebugSampling, "Log one in this many per-packet debug messages (1 = all)")
 	fs.Var(&explicitBool{&cfg.recordAll}, "record-all", "Enable recording of all streams to -record-dir (true/false)")
+	fs.Var(&recordStreams, "record-streams", "Record only streams whose key matches: a glob such as 'vod/*' or a regexp '~^vod/.+' (repeatable)")
 	fs.StringVar(&cfg.recordDir, "record-dir", "recordings", "Directory to write FLV recordings")
+	fs.StringVar(&cfg.recordFormat, "record-format", "auto",
+		"Recording container: auto (FLV for H.264, MP4 for H.265/AV1/VP9/VVC), flv (Enhanced FLV for every codec, playable as VOD) or mp4")
+	fs.BoolVar(&cfg.recordTimecode, "record-timecode", false, "Keep onFI timecode messages from encoders in FLV recordings")
 	fs.StringVar(&cfg.segmentDuration, "segment-duration", "",
 		"Split recordings into segments of this duration (e.g. '2s', '30s', '5m', '15m'). "+
 			"Segments align to video keyframes. Empty = single file (default)")
@@ -81,30 +204,140 @@ func parseFlags(args []string) (*cliConfig, error) {
 		"Filename pattern for segments. Placeholders: %s=stream key, %d=segment number "+
 			"(supports padding like %03d), %T=timestamp (YYYYMMDD_HHMMSS), "+
 			"%Y=year, %m=month, %D=day, %H=hour, %M=minute, %S=second, %%=literal %")
+	fs.StringVar(&cfg.recordStorage, "record-storage", "", "Copy finished recordings and segments to file:///dir or s3://bucket/prefix (S3 credentials from AWS_* env vars); fires recording_uploaded")
+	fs.IntVar(&cfg.recordQueueSize, "record-queue-size", 1024, "Media messages buffered per recording before frames are dropped up to the next keyframe")
 	fs.UintVar(&cfg.chunkSize, "chunk-size", 4096, "Initial outbound chunk size")
+	fs.UintVar(&cfg.windowAckSize, "window-ack-size", 2_500_000, "Window Acknowledgement Size sent after the handshake: clients acknowledge every N bytes received")
+	fs.UintVar(&cfg.peerBandwidth, "peer-bandwidth", 2_500_000, "Set Peer Bandwidth sent after the handshake: the output limit suggested to clients, in bytes")
+	fs.StringVar(&cfg.peerLimit, "peer-bandwidth-limit", "dynamic", "Set Peer Bandwidth limit type: hard, soft or dynamic")
+	fs.Var(&apps, "app",
+		`Per-app settings: "app=record=on|off,auth=all|publish|play|none,relay=URL,max-publishers=N,max-subscribers=N,video-codec=H264,audio-codec=AAC,chunk-size=N,window-ack-size=N,peer-bandwidth=N,peer-bandwidth-limit=hard|soft|dynamic", any subset; relay and codecs repeatable (repeatable)`)
+	fs.Var(&vhosts, "vhost",
+		`Virtual host selected by the tcUrl host, with its own streams: "host=record=on|off,record-dir=PATH,relay=URL,auth-file=PATH|auth-secret=SECRET|auth-callback=URL", any subset; relay repeatable (repeatable)`)
+	fs.UintVar(&cfg.maxMessageSize, "max-message-size", 8<<20, "Largest inbound RTMP message in bytes; larger messages disconnect the client (1-16777215)")
+	fs.IntVar(&cfg.maxChunkStreams, "max-chunk-streams", 64, "Most chunk stream IDs a client may use per connection")
+	fs.UintVar(&cfg.maxAMFSize, "max-amf-size", 256<<10, "Largest inbound AMF command/data message in bytes; also the most a client may buffer before connect")
+	fs.UintVar(&cfg.maxChunkSize, "max-chunk-size", chunk.MaxChunkSize, "Largest chunk size a client may set with Set Chunk Size; larger sizes disconnect the client (1-2147483647)")
 	fs.BoolVar(&cfg.showVersion, "version", false, "Print version and exit")
-	fs.Var(&relayDests, "relay-to", "RTMP destination URL (can be specified multiple times)")
+	fs.BoolVar(&cfg.checkConfig, "check-config", false,
+		"Validate the configuration without starting: load auth, ACL and passphrase files, check hooks, relay URLs, output directories and TLS certificates, print a report and exit (1 if a check failed)")
+	fs.Var(&relayDests, "relay-to", "RTMP destination URL (can be specified multiple times). {app} and {stream} are replaced with the publisher's app and stream name")
+	fs.Var(&explicitBool{&cfg.relayTLSInsecure}, "relay-tls-insecure", "Skip certificate verification for rtmps:// relay destinations (true/false). Testing only")
+	fs.StringVar(&cfg.relayTLSCA, "relay-tls-ca", "", "PEM file of CA certificates trusted for rtmps:// relay destinations (default system roots)")
+	fs.StringVar(&cfg.relayTLSName, "relay-tls-server-name", "", "TLS server name (SNI) for rtmps:// relay destinations (default the URL host)")
+	fs.Var(&relayProfiles, "relay-profile",
+		`Push profile for relay destinations whose URL starts with PREFIX: "PREFIX=set.KEY=VALUE,remove=KEY,video-codec=H264,audio-codec=AAC", any subset, each repeatable. Rewrites onMetaData and limits the codecs sent (repeatable; first match wins)`)
+	fs.IntVar(&cfg.relayQueueSize, "relay-queue-size", 512, "Media messages buffered per relay destination before frames are dropped up to the next keyframe")
+	fs.StringVar(&cfg.relayProxy, "relay-proxy", "", "Proxy for -relay-to connections: socks5://[user:pass@]host:port or http://[user:pass@]host:port. Empty = direct")
+	fs.StringVar(&cfg.originURL, "origin", "",
+		"Run as an edge of this origin server (rtmp[s]://host[:port], or link://host[:port] for its -link-listen address): plays of streams with no local publisher are pulled from it. Empty = disabled")
+	fs.StringVar(&cfg.clusterRedis, "cluster-redis", "",
+		"Share a stream directory with other servers through Redis (redis[s]://[user:pass@]host[:port][/db]): plays of streams published on another node are pulled from it. Empty = disabled")
+	fs.StringVar(&cfg.clusterNodeURL, "cluster-node-url", "",
+		"Address other servers reach this one at (rtmp[s]://host[:port] or link://host[:port]), announced for the streams published here. Empty = look up only")
+	fs.StringVar(&cfg.linkListen, "link-listen", "",
+		"Serve the origin link on this TCP address (e.g. 10.0.0.5:1940) so edges pull streams with link://host:port, without the RTMP handshake and chunking. Empty = disabled")
+	fs.StringVar(&cfg.linkSecret, "link-secret", "",
+		"Shared secret of the origin link: required from edges by -link-listen and sent to link:// origins. Empty = none")
+	fs.Var(&explicitBool{&cfg.vodEnabled}, "vod", "Serve FLV recordings from -record-dir to play requests with no live publisher (true/false)")
+	fs.StringVar(&cfg.dvrWindow, "dvr-window", "0",
+		"Keep this much of every stream's media in memory (e.g. 60s) so players can start behind live with a negative play start, e.g. -30000 for 30s. 0 = off")
+	fs.StringVar(&cfg.variantSeparator, "variant-separator", "",
+		"Group stream keys like live/show_720p as variants of live/show using this separator (e.g. _). Empty = disabled")
+	fs.Var(&streamAliases, "stream-alias",
+		`Play alias for live sources with failover: "app/alias=app/primary,app/backup" (repeatable). Players on the alias get the first live source`)
+	fs.Var(&explicitBool{&cfg.redundantIngest}, "redundant-ingest",
+		"Play publishers of <key>_primary and <key>_backup as <key>, failing over to the backup when the primary drops or stalls (true/false)")
+	fs.StringVar(&cfg.failoverTimeout, "failover-timeout", "5s",
+		"How long an alias or redundant-ingest source may send no media before failing over from it")
+	fs.IntVar(&cfg.maxSubscribers, "max-subscribers-per-stream", 0,
+		"Most players one stream may have at once; further plays get NetStream.Play.Failed and fire subscriber_limit. 0 = no limit")
+	fs.Float64Var(&cfg.slowDropRate, "slow-subscriber-drop-rate", 0,
+		"Disconnect a player whose share of dropped media messages (0-1, e.g. 0.5) stays above this for -slow-subscriber-window. 0 = never")
+	fs.StringVar(&cfg.slowWindow, "slow-subscriber-window", "10s",
+		"How long a player's drop rate must exceed -slow-subscriber-drop-rate before it is disconnected")
+	fs.StringVar(&cfg.pingInterval, "ping-interval", "0",
+		"Send players a Ping Request this often (e.g. 15s) to keep NATs and firewalls from dropping idle connections; players that miss -ping-misses in a row are disconnected. 0 = off")
+	fs.IntVar(&cfg.pingMisses, "ping-misses", srv.DefaultPingMisses,
+		"Unanswered -ping-interval pings in a row before a player is disconnected")
+	fs.StringVar(&cfg.avDriftThreshold, "av-drift-threshold", "0",
+		"Flag a stream whose audio and video timestamps drift further apart than this (e.g. 1s) in the stats and with an av_drift hook event. 0 = off")
+	fs.IntVar(&cfg.streamKeyMaxLen, "stream-key-max-length", srv.DefaultStreamKeyMaxLength,
+		"Longest stream key (app/name) in bytes; longer keys are rejected")
+	fs.StringVar(&cfg.streamKeyCharset, "stream-key-charset", srv.DefaultStreamKeyCharset,
+		"Characters allowed in app names and stream key segments, as a regexp character class without brackets")
+	fs.StringVar(&cfg.sendTimeout, "send-timeout", "200ms",
+		"How long a message to a connection waits for room in its full send queue before it is dropped")
+	fs.StringVar(&cfg.idleTimeout, "idle-timeout", "90s",
+		"Disconnect a client that sends nothing for this long")
+	fs.StringVar(&cfg.publisherPolicy, "duplicate-publisher", "replace",
+		"What to do when a second publisher uses a live stream key: replace (kick the current one), reject, or rename (publish as <key>_dup<N>)")
+	fs.StringVar(&cfg.statusTxn, "status-txn", "zero",
+		"Transaction ID of the onStatus answering publish, play and pause: zero (as Adobe Media Server sends it) or echo (the command's own ID)")
+	fs.StringVar(&cfg.endedStreamTTL, "ended-stream-ttl", "30s",
+		"How long a stream with no publisher and no subscribers is kept, e.g. for a returning publisher, before it is removed (stream_delete hook)")
+	fs.Var(&explicitBool{&cfg.mediaDiagnostics}, "media-diagnostics", "Log each sampled media packet's codec, frame and packet type at debug level (true/false)")
+	fs.Var(&explicitBool{&cfg.latencyStats}, "latency-stats", "Report ingest-to-delivery latency percentiles per stream and relay destination in /debug/vars (true/false)")
+	fs.Var(&explicitBool{&cfg.rejectReply}, "handshake-reject-reply",
+		"Answer RTMPE clients with S0=0x03 and RTMPT clients with HTTP 501 before closing, instead of just closing (true/false)")
+	fs.StringVar(&cfg.traceDir, "trace-dir", "", "Write every RTMP message of each connection to a trace file in this directory (read with rtmp-trace). Empty = disabled")
+	fs.IntVar(&cfg.chunkDiagnostics, "chunk-diagnostics", 0,
+		"Keep the last N chunk headers and 1 KB of raw bytes read per connection, and log them when a read fails mid-stream. 0 = disabled")
+	fs.Var(&explicitBool{&cfg.inspect}, "inspect",
+		"Protocol analyzer mode: accept any publish, parse and discard its media, and report each connection's commands, chunk headers, codecs and timing on disconnect (true/false)")
+	fs.StringVar(&cfg.inspectDir, "inspect-dir", "", "Write -inspect reports as JSON files to this directory instead of logging them")
+	fs.StringVar(&cfg.transcodeCommand, "transcode-cmd", "",
+		"Command run per published stream, e.g. \"ffmpeg -i {input} ... -f flv {rtmp}/{key}_720p?transcoded=1\". "+
+			"Placeholders: {input}, {rtmp}, {key}, {app}, {name}. Empty = disabled")
+	fs.StringVar(&cfg.thumbnailInterval, "thumbnail-interval", "0",
+		"Keep each stream's latest H.264 keyframe for live previews (admin API /api/thumbnails) and, with -thumbnail-cmd, make a JPEG of it this often (e.g. 10s). 0 = off")
+	fs.StringVar(&cfg.thumbnailCommand, "thumbnail-cmd", "",
+		"Command given each new keyframe as Annex B H.264 on stdin, writing a JPEG to {output}, e.g. \"ffmpeg -loglevel error -f h264 -i - -frames:v 1 -y {output}\". "+
+			"Placeholders: {output}, {key}, {app}, {name}. Empty = keyframes only")
+	fs.StringVar(&cfg.thumbnailDir, "thumbnail-dir", "thumbnails", "Directory -thumbnail-cmd previews are written to, as <app>_<name>.jpg")
 
 	// TLS (RTMPS) flags
-	fs.StringVar(&cfg.tlsListenAddr, "tls-listen", "", "RTMPS listen address (e.g. :443). Requires -tls-cert and -tls-key")
+	fs.StringVar(&cfg.tlsListenAddr, "tls-listen", "", "RTMPS listen address (e.g. :443). Requires -tls-cert and -tls-key, or -tls-self-signed")
 	fs.StringVar(&cfg.tlsCertFile, "tls-cert", "", "Path to PEM-encoded TLS certificate file")
 	fs.StringVar(&cfg.tlsKeyFile, "tls-key", "", "Path to PEM-encoded TLS private key file")
+	fs.Var(&explicitBool{&cfg.tlsSelfSigned}, "tls-self-signed",
+		"Serve RTMPS with a self-signed certificate generated at startup instead of -tls-cert/-tls-key (true/false). Development only")
+	fs.StringVar(&cfg.tlsClientCA, "tls-client-ca", "", "PEM file of CA certificates RTMPS clients must present a certificate from (mutual TLS). Requires -tls-listen")
+	fs.StringVar(&cfg.tlsClientACL, "tls-client-acl", "", "JSON file mapping client certificate names (CN or SAN) to the stream keys they may publish and play, e.g. {\"encoder-1\": [\"live/*\"]}. Reloaded on SIGHUP. Requires -tls-client-ca")
 
-	fs.Var(&hookScripts, "hook-script", "Shell hook: event_type=/path/to/script (repeatable)")
-	fs.Var(&hookWebhooks, "hook-webhook", "Webhook hook: event_type=https://url (repeatable)")
+	fs.Var(&hookScripts, "hook-script", "Shell hook: event_type=/path/to/script, or event_type@pattern=... for matching streams only (repeatable)")
+	fs.Var(&hookWebhooks, "hook-webhook", "Webhook hook: event_type=https://url, or event_type@pattern=... for matching streams only (repeatable)")
 	fs.StringVar(&cfg.hookStdioFormat, "hook-stdio-format", "", "Stdio hook output format: json|env (empty=disabled)")
 	fs.StringVar(&cfg.hookTimeout, "hook-timeout", "30s", "Hook execution timeout")
 	fs.IntVar(&cfg.hookConcurrency, "hook-concurrency", 10, "Max concurrent hook executions")
+	fs.StringVar(&cfg.hookWebhookSecret, "hook-webhook-secret", "", "Shared secret for signing webhook bodies (HMAC-SHA256 in X-RTMP-Signature-256). Empty = unsigned")
+	fs.Var(&hookWebhookHeaders, "hook-webhook-header", "Extra webhook request header: \"Name: value\" (repeatable)")
+	fs.IntVar(&cfg.hookWebhookRetries, "hook-webhook-retries", 3, "Webhook retries after a failed delivery (exponential backoff from 1s)")
+	fs.IntVar(&cfg.hookQueueSize, "hook-queue-size", 0, "Queue up to N events per webhook during outages, delivered at least once (0 = no queue)")
+	fs.StringVar(&cfg.hookQueueMaxAge, "hook-queue-max-age", "1h", "Drop queued webhook events older than this (0 = no limit)")
+	fs.StringVar(&cfg.hookQueueDir, "hook-queue-dir", "", "Directory to persist webhook queues across restarts (empty = memory only)")
 
 	// Metrics
 	fs.StringVar(&cfg.metricsAddr, "metrics-addr", "", "HTTP address for metrics endpoint (e.g. :8080 or 127.0.0.1:8080). Empty = disabled")
+	fs.StringVar(&cfg.pprofAddr, "pprof-addr", "", "HTTP address for /debug/pprof profiling endpoints (e.g. 127.0.0.1:6060). Same as -metrics-addr serves both on one listener. Empty = disabled")
 
 	// Authentication flags
-	fs.StringVar(&cfg.authMode, "auth-mode", "none", "Authentication mode: none|token|file|callback")
+	fs.StringVar(&cfg.authMode, "auth-mode", "none", "Authentication mode: none|token|file|callback|signed|store")
 	fs.Var(&authTokens, "auth-token", `Stream token: "streamKey=token" (repeatable, for -auth-mode=token)`)
 	fs.StringVar(&cfg.authFile, "auth-file", "", "Path to JSON token file (for -auth-mode=file)")
 	fs.StringVar(&cfg.authCallbackURL, "auth-callback", "", "Webhook URL for auth validation (for -auth-mode=callback)")
 	fs.StringVar(&cfg.authCallbackTimeout, "auth-callback-timeout", "5s", "Auth callback HTTP timeout")
+	fs.StringVar(&cfg.authSecret, "auth-secret", "", "HMAC secret for signed URL tokens ?token=exp.sig (for -auth-mode=signed)")
+	fs.Var(&authAppSecrets, "auth-app-secret", `Per-app signing secret: "app=secret" (repeatable, for -auth-mode=signed)`)
+	fs.StringVar(&cfg.authClockSkew, "auth-clock-skew", "30s", "Clock skew tolerated when checking signed token expiry")
+	fs.StringVar(&cfg.authStore, "auth-store", "memory", `Token store for -auth-mode=store: "memory", "file:PATH" or "redis://[[user]:password@]host[:port][/db]"`)
+	fs.StringVar(&cfg.playAuthMode, "play-auth-mode", "", "Authentication mode for players, separate from -auth-mode: token|file|callback|signed|viewers. Empty = plays use -auth-mode")
+	fs.Var(&playAuthTokens, "play-auth-token", `Play token: "streamKey=token" (repeatable, for -play-auth-mode=token)`)
+	fs.StringVar(&cfg.playAuthFile, "play-auth-file", "", "Path to JSON token file (for -play-auth-mode=file) or viewer token file with per-token session limits (for -play-auth-mode=viewers)")
+	fs.StringVar(&cfg.playAuthCallbackURL, "play-auth-callback", "", "Webhook URL for play auth validation (for -play-auth-mode=callback)")
+	fs.StringVar(&cfg.playAuthSecret, "play-auth-secret", "", "HMAC secret for signed play tokens (for -play-auth-mode=signed)")
+	fs.StringVar(&cfg.adminAddr, "admin-addr", "", "HTTP address for the admin API: /api/recordings, /api/thumbnails, and /api/tokens with -auth-mode=store (e.g. 127.0.0.1:8081). Empty = disabled")
+	fs.StringVar(&cfg.adminToken, "admin-token", "", "Bearer token required by the admin API (required with -admin-addr)")
 
 	// SRT flags
 	fs.StringVar(&cfg.srtListenAddr, "srt-listen", "", "SRT UDP listen address (e.g. :10080). Empty = disabled")
@@ -116,18 +349,158 @@ func parseFlags(args []string) (*cliConfig, error) {
 	// Reconnect (E-RTMP v2)
 	fs.StringVar(&cfg.reconnectURL, "reconnect-url", "", "URL to redirect clients to on SIGUSR1 reconnect request")
 
+	// Binary upgrade (SIGUSR2)
+	fs.StringVar(&cfg.drainTimeout, "drain-timeout", "0",
+		"After a SIGUSR2 upgrade, how long the old process keeps serving its connections before closing them. 0 = until they all end")
+
 	if err := fs.Parse(args); err != nil {
-		return nil, err
+		return nil, usageError{err}
 	}
 
 	cfg.relayDestinations = relayDests
+	cfg.recordStreams = recordStreams
 	cfg.hookScripts = hookScripts
 	cfg.hookWebhooks = hookWebhooks
+	cfg.hookWebhookHeaders = hookWebhookHeaders
 	cfg.authTokens = authTokens
+	cfg.authAppSecrets = authAppSecrets
+	cfg.playAuthTokens = playAuthTokens
 
 	if cfg.chunkSize == 0 || cfg.chunkSize > 65536 {
 		return nil, errors.New("chunk-size must be between 1 and 65536")
 	}
+	if cfg.windowAckSize == 0 || cfg.windowAckSize > 0xFFFFFFFF {
+		return nil, errors.New("window-ack-size must be between 1 and 4294967295")
+	}
+	if cfg.peerBandwidth == 0 || cfg.peerBandwidth > 0xFFFFFFFF {
+		return nil, errors.New("peer-bandwidth must be between 1 and 4294967295")
+	}
+	switch cfg.recordFormat {
+	case "auto", "flv", "mp4":
+	default:
+		return nil, fmt.Errorf("invalid -record-format %q (expected auto, flv or mp4)", cfg.recordFormat)
+	}
+	if _, err := control.ParseLimitType(cfg.peerLimit); err != nil || cfg.peerLimit == "" {
+		return nil, fmt.Errorf("invalid -peer-bandwidth-limit %q (expected hard, soft or dynamic)", cfg.peerLimit)
+	}
+	for _, s := range apps {
+		app, ac, err := srv.ParseAppConfig(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -app: %w", err)
+		}
+		if cfg.apps == nil {
+			cfg.apps = make(map[string]srv.AppConfig)
+		}
+		cfg.apps[app] = cfg.apps[app].Merge(ac)
+	}
+	for _, s := range vhosts {
+		host, vc, err := srv.ParseVHostConfig(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -vhost: %w", err)
+		}
+		if _, dup := cfg.vhosts[host]; dup {
+			return nil, fmt.Errorf("invalid -vhost: %q given twice", host)
+		}
+		if cfg.vhosts == nil {
+			cfg.vhosts = make(map[string]srv.VHostConfig)
+		}
+		cfg.vhosts[host] = vc
+	}
+	for _, s := range relayProfiles {
+		p, err := relay.ParseProfile(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -relay-profile: %w", err)
+		}
+		cfg.relayProfiles = append(cfg.relayProfiles, p)
+	}
+	if cfg.maxMessageSize == 0 || cfg.maxMessageSize > 0xFFFFFF {
+		return nil, errors.New("max-message-size must be between 1 and 16777215")
+	}
+	if cfg.maxChunkStreams < 1 {
+		return nil, errors.New("max-chunk-streams must be at least 1")
+	}
+	if cfg.maxAMFSize == 0 || cfg.maxAMFSize > 0xFFFFFF {
+		return nil, errors.New("max-amf-size must be between 1 and 16777215")
+	}
+	if cfg.maxChunkSize == 0 || cfg.maxChunkSize > chunk.MaxChunkSize {
+		return nil, errors.New("max-chunk-size must be between 1 and 2147483647")
+	}
+	if cfg.recordQueueSize < 1 {
+		return nil, errors.New("record-queue-size must be at least 1")
+	}
+	if cfg.recordStorage != "" {
+		if _, err := storage.Open(cfg.recordStorage); err != nil {
+			return nil, fmt.Errorf("invalid -record-storage: %w", err)
+		}
+	}
+	for _, s := range streamAliases {
+		a, err := srv.ParseStreamAlias(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -stream-alias: %w", err)
+		}
+		cfg.streamAliases = append(cfg.streamAliases, a)
+	}
+
+	switch cfg.publisherPolicy {
+	case "replace", "reject", "rename":
+	default:
+		return nil, fmt.Errorf("invalid -duplicate-publisher %q (expected replace, reject or rename)", cfg.publisherPolicy)
+	}
+
+	switch cfg.statusTxn {
+	case "zero", "echo":
+	default:
+		return nil, fmt.Errorf("invalid -status-txn %q (expected zero or echo)", cfg.statusTxn)
+	}
+
+	if d, err := time.ParseDuration(cfg.endedStreamTTL); err != nil || d <= 0 {
+		return nil, fmt.Errorf("invalid -ended-stream-ttl %q (expected a positive duration)", cfg.endedStreamTTL)
+	}
+	if d, err := time.ParseDuration(cfg.failoverTimeout); err != nil || d <= 0 {
+		return nil, fmt.Errorf("invalid -failover-timeout %q (expected a positive duration)", cfg.failoverTimeout)
+	}
+	if cfg.maxSubscribers < 0 {
+		return nil, fmt.Errorf("invalid -max-subscribers-per-stream %d (expected 0 for no limit, or a positive number)", cfg.maxSubscribers)
+	}
+	if cfg.slowDropRate < 0 || cfg.slowDropRate >= 1 {
+		return nil, fmt.Errorf("invalid -slow-subscriber-drop-rate %v (expected 0 to disable, or a fraction below 1)", cfg.slowDropRate)
+	}
+	if d, err := time.ParseDuration(cfg.slowWindow); err != nil || d <= 0 {
+		return nil, fmt.Errorf("invalid -slow-subscriber-window %q (expected a positive duration)", cfg.slowWindow)
+	}
+	if d, err := time.ParseDuration(cfg.pingInterval); err != nil || d < 0 {
+		return nil, fmt.Errorf("invalid -ping-interval %q (expected 0 to disable, or a positive duration)", cfg.pingInterval)
+	}
+	if cfg.pingMisses < 1 {
+		return nil, fmt.Errorf("invalid -ping-misses %d (expected a positive number)", cfg.pingMisses)
+	}
+	if d, err := time.ParseDuration(cfg.dvrWindow); err != nil || d < 0 {
+		return nil, fmt.Errorf("invalid -dvr-window %q (expected 0 to disable, or a positive duration)", cfg.dvrWindow)
+	}
+	if d, err := time.ParseDuration(cfg.thumbnailInterval); err != nil || d < 0 {
+		return nil, fmt.Errorf("invalid -thumbnail-interval %q (expected 0 to disable, or a positive duration)", cfg.thumbnailInterval)
+	} else if d == 0 && cfg.thumbnailCommand != "" {
+		return nil, errors.New("-thumbnail-cmd requires -thumbnail-interval")
+	}
+	if d, err := time.ParseDuration(cfg.avDriftThreshold); err != nil || d < 0 {
+		return nil, fmt.Errorf("invalid -av-drift-threshold %q (expected 0 to disable, or a positive duration)", cfg.avDriftThreshold)
+	}
+	if cfg.streamKeyMaxLen <= 0 {
+		return nil, fmt.Errorf("invalid -stream-key-max-length %d (expected a positive number of bytes)", cfg.streamKeyMaxLen)
+	}
+	if _, err := srv.NewStreamKeyPolicy(cfg.streamKeyMaxLen, cfg.streamKeyCharset); err != nil {
+		return nil, fmt.Errorf("invalid -stream-key-charset: %w", err)
+	}
+	if d, err := time.ParseDuration(cfg.sendTimeout); err != nil || d <= 0 {
+		return nil, fmt.Errorf("invalid -send-timeout %q (expected a positive duration)", cfg.sendTimeout)
+	}
+	if d, err := time.ParseDuration(cfg.idleTimeout); err != nil || d <= 0 {
+		return nil, fmt.Errorf("invalid -idle-timeout %q (expected a positive duration)", cfg.idleTimeout)
+	}
+
+	if d, err := time.ParseDuration(cfg.drainTimeout); err != nil || d < 0 {
+		return nil, fmt.Errorf("invalid -drain-timeout %q (expected a duration, 0 for no limit)", cfg.drainTimeout)
+	}
 
 	// Validate segment duration if provided
 	if cfg.segmentDuration != "" {
@@ -141,6 +514,54 @@ func parseFlags(args []string) (*cliConfig, error) {
 	default:
 		return nil, fmt.Errorf("invalid log-level %q", cfg.logLevel)
 	}
+	switch cfg.logFormat {
+	case logger.FormatJSON, logger.FormatText:
+	default:
+		return nil, fmt.Errorf("invalid -log-format %q (expected json or text)", cfg.logFormat)
+	}
+	if _, err := logger.ParseComponentLevels(cfg.logComponents); err != nil {
+		return nil, fmt.Errorf("invalid -log-component-levels: %w", err)
+	}
+	if cfg.logDebugSample < 1 {
+		return nil, errors.New("log-debug-sample must be at least 1")
+	}
+
+	if cfg.recordAll && len(cfg.recordStreams) > 0 {
+		return nil, errors.New("-record-all and -record-streams are mutually exclusive")
+	}
+	for _, p := range cfg.recordStreams {
+		if _, err := hooks.NewStreamMatcher(p); err != nil {
+			return nil, fmt.Errorf("invalid -record-streams: %w", err)
+		}
+	}
+	for _, h := range append(append([]string{}, cfg.hookScripts...), cfg.hookWebhooks...) {
+		head, _, ok := strings.Cut(h, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid hook %q (expected event_type[@pattern]=target)", h)
+		}
+		if _, p, scoped := strings.Cut(head, "@"); scoped {
+			if _, err := hooks.NewStreamMatcher(p); err != nil {
+				return nil, fmt.Errorf("invalid hook %q: %w", h, err)
+			}
+		}
+	}
+	if cfg.chunkDiagnostics < 0 {
+		return nil, errors.New("chunk-diagnostics must not be negative")
+	}
+	if cfg.hookWebhookRetries < 0 {
+		return nil, errors.New("hook-webhook-retries must not be negative")
+	}
+	if cfg.hookQueueSize < 0 {
+		return nil, errors.New("hook-queue-size must not be negative")
+	}
+	if _, err := time.ParseDuration(cfg.hookQueueMaxAge); err != nil {
+		return nil, fmt.Errorf("invalid -hook-queue-max-age %q: %w", cfg.hookQueueMaxAge, err)
+	}
+	for _, h := range cfg.hookWebhookHeaders {
+		if name, _, ok := strings.Cut(h, ":"); !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid -hook-webhook-header %q (expected \"Name: value\")", h)
+		}
+	}
 
 	// Validate relay destinations
 	for _, dest := range cfg.relayDestinations {
@@ -149,15 +570,73 @@ func parseFlags(args []string) (*cliConfig, error) {
 		}
 	}
 
+	if cfg.originURL != "" {
+		if err := validateOriginURL(cfg.originURL); err != nil {
+			return nil, fmt.Errorf("invalid -origin %q: %w", cfg.originURL, err)
+		}
+		if u, _ := url.Parse(cfg.originURL); strings.Trim(u.Path, "/") != "" {
+			return nil, fmt.Errorf("invalid -origin %q: give the server only; the stream key is appended", cfg.originURL)
+		}
+	}
+
+	if cfg.clusterRedis != "" {
+		if _, err := cluster.ParseRedisURL(cfg.clusterRedis); err != nil {
+			return nil, fmt.Errorf("invalid -cluster-redis: %w", err)
+		}
+	}
+	if cfg.clusterNodeURL != "" {
+		if cfg.clusterRedis == "" {
+			return nil, fmt.Errorf("-cluster-node-url requires -cluster-redis")
+		}
+		if err := validateOriginURL(cfg.clusterNodeURL); err != nil {
+			return nil, fmt.Errorf("invalid -cluster-node-url %q: %w", cfg.clusterNodeURL, err)
+		}
+		if u, _ := url.Parse(cfg.clusterNodeURL); strings.Trim(u.Path, "/") != "" {
+			return nil, fmt.Errorf("invalid -cluster-node-url %q: give the server only; the stream key is appended", cfg.clusterNodeURL)
+		}
+	}
+
+	if cfg.linkListen != "" {
+		if _, _, err := net.SplitHostPort(cfg.linkListen); err != nil {
+			return nil, fmt.Errorf("invalid -link-listen %q: %w", cfg.linkListen, err)
+		}
+	}
+
+	if cfg.relayQueueSize < 1 {
+		return nil, errors.New("relay-queue-size must be at least 1")
+	}
+	if cfg.relayProxy != "" {
+		if _, err := client.ParseProxyURL(cfg.relayProxy); err != nil {
+			return nil, fmt.Errorf("invalid -relay-proxy: %w", err)
+		}
+	}
+
 	// Validate TLS configuration
-	if cfg.tlsListenAddr != "" {
+	if cfg.tlsSelfSigned {
+		if cfg.tlsListenAddr == "" {
+			return nil, errors.New("-tls-self-signed requires -tls-listen")
+		}
+		if cfg.tlsCertFile != "" || cfg.tlsKeyFile != "" {
+			return nil, errors.New("-tls-self-signed cannot be combined with -tls-cert or -tls-key")
+		}
+	} else if cfg.tlsListenAddr != "" {
 		if cfg.tlsCertFile == "" || cfg.tlsKeyFile == "" {
-			return nil, errors.New("-tls-listen requires both -tls-cert and -tls-key")
+			return nil, errors.New("-tls-listen requires both -tls-cert and -tls-key, or -tls-self-signed")
 		}
 	}
 	if (cfg.tlsCertFile != "" || cfg.tlsKeyFile != "") && cfg.tlsListenAddr == "" {
 		return nil, errors.New("-tls-cert and -tls-key require -tls-listen")
 	}
+	if cfg.tlsClientCA != "" && cfg.tlsListenAddr == "" {
+		return nil, errors.New("-tls-client-ca requires -tls-listen")
+	}
+	if cfg.tlsClientACL != "" && cfg.tlsClientCA == "" {
+		return nil, errors.New("-tls-client-acl requires -tls-client-ca")
+	}
+
+	if cfg.inspectDir != "" && !cfg.inspect {
+		return nil, errors.New("-inspect-dir requires -inspect")
+	}
 
 	// Validate authentication configuration
 	switch cfg.authMode {
@@ -180,8 +659,64 @@ func parseFlags(args []string) (*cliConfig, error) {
 		if cfg.authCallbackURL == "" {
 			return nil, errors.New("-auth-mode=callback requires -auth-callback flag")
 		}
+	case "signed":
+		if cfg.authSecret == "" && len(cfg.authAppSecrets) == 0 {
+			return nil, errors.New("-auth-mode=signed requires -auth-secret or at least one -auth-app-secret flag")
+		}
+		for _, s := range cfg.authAppSecrets {
+			if app, secret, ok := strings.Cut(s, "="); !ok || app == "" || secret == "" {
+				return nil, fmt.Errorf("invalid -auth-app-secret format %q (expected app=secret)", s)
+			}
+		}
+		if _, err := time.ParseDuration(cfg.authClockSkew); err != nil {
+			return nil, fmt.Errorf("invalid -auth-clock-skew %q: %w", cfg.authClockSkew, err)
+		}
+	case "store":
+		switch {
+		case cfg.authStore == "memory":
+		case strings.HasPrefix(cfg.authStore, "file:"):
+			if strings.TrimPrefix(cfg.authStore, "file:") == "" {
+				return nil, errors.New("-auth-store file: requires a path (file:PATH)")
+			}
+		case strings.HasPrefix(cfg.authStore, "redis://"), strings.HasPrefix(cfg.authStore, "rediss://"):
+		default:
+			return nil, fmt.Errorf("invalid -auth-store %q (expected memory, file:PATH or redis://...)", cfg.authStore)
+		}
 	default:
-		return nil, fmt.Errorf("invalid -auth-mode %q (expected none|token|file|callback)", cfg.authMode)
+		return nil, fmt.Errorf("invalid -auth-mode %q (expected none|token|file|callback|signed|store)", cfg.authMode)
+	}
+	switch cfg.playAuthMode {
+	case "":
+		// Plays use -auth-mode
+	case "token":
+		if len(cfg.playAuthTokens) == 0 {
+			return nil, errors.New("-play-auth-mode=token requires at least one -play-auth-token flag")
+		}
+		for _, t := range cfg.playAuthTokens {
+			if !strings.Contains(t, "=") {
+				return nil, fmt.Errorf("invalid -play-auth-token format %q (expected streamKey=token)", t)
+			}
+		}
+	case "file", "viewers":
+		if cfg.playAuthFile == "" {
+			return nil, fmt.Errorf("-play-auth-mode=%s requires -play-auth-file flag", cfg.playAuthMode)
+		}
+	case "callback":
+		if cfg.playAuthCallbackURL == "" {
+			return nil, errors.New("-play-auth-mode=callback requires -play-auth-callback flag")
+		}
+	case "signed":
+		if cfg.playAuthSecret == "" {
+			return nil, errors.New("-play-auth-mode=signed requires -play-auth-secret flag")
+		}
+		if _, err := time.ParseDuration(cfg.authClockSkew); err != nil {
+			return nil, fmt.Errorf("invalid -auth-clock-skew %q: %w", cfg.authClockSkew, err)
+		}
+	default:
+		return nil, fmt.Errorf("invalid -play-auth-mode %q (expected token|file|callback|signed|viewers)", cfg.playAuthMode)
+	}
+	if cfg.adminAddr != "" && cfg.adminToken == "" {
+		return nil, errors.New("-admin-addr requires -admin-token")
 	}
 
 	// Validate SRT configuration
@@ -217,6 +752,11 @@ func parseFlags(args []string) (*cliConfig, error) {
 	return cfg, nil
 }
 
+// usageError is a command-line syntax error, which the flag package has
+// already printed with the usage text. parseFlags returns other errors for
+// flag values that fail validation.
+type usageError struct{ error }
+
 // explicitBool implements flag.Value for boolean flags that require an explicit
 // value argument (e.g. "-record-all true" or "-record-all=false").
 //
@@ -281,3 +821,15 @@ func validateRelayDestination(rawURL string) error {
 
 	return nil
 }
+
+// validateOriginURL validates the address of an origin or cluster node: an
+// RTMP or RTMPS URL, or a link URL of its origin link
+func validateOriginURL(rawURL string) error {
+	if u, err := url.Parse(rawURL); err == nil && u.Scheme == link.Scheme {
+		if u.Host == "" {
+			return fmt.Errorf("URL must have a host")
+		}
+		return nil
+	}
+	return validateRelayDestination(rawURL)
+}
@@ -0,0 +1,144 @@
+package main
+
+// Inherited sockets. The listening sockets can come from two places instead
+// of -listen and -tls-listen:
+//
+//   - systemd socket activation: when started by a .socket unit, systemd
+//     opens the socket itself and passes it as file descriptor 3, setting
+//     LISTEN_PID and LISTEN_FDS (see sd_listen_fds(3)). Because systemd keeps
+//     the socket open, connections made while the service restarts wait in
+//     its backlog rather than being refused.
+//   - a binary upgrade (see upgrade.go): the process being replaced passes
+//     its RTMP socket and, when enabled, its RTMPS socket and the sockets
+//     of the metrics, pprof and admin HTTP servers from file descriptor 3
+//     on, naming them in RTMP_SERVER_LISTEN_FDS.
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd or by an
+// upgrading process.
+const listenFDsStart = 3
+
+// upgradeFDsEnv lists the sockets passed by an upgrading process, in file
+// descriptor order, e.g. "rtmp,rtmps,metrics": "rtmp" first, then any of
+// "rtmps" and the HTTP servers' httpSockets.
+const upgradeFDsEnv = "RTMP_SERVER_LISTEN_FDS"
+
+// httpSockets name the HTTP servers whose sockets an upgrade hands on.
+var httpSockets = []string{"metrics", "pprof", "admin"}
+
+// inheritedSockets are the listening sockets a process starts with instead
+// of opening its own.
+type inheritedSockets struct {
+	rtmp, rtmps net.Listener
+	// http holds the HTTP servers' sockets by name (httpSockets); only an
+	// upgrade passes them.
+	http map[string]net.Listener
+}
+
+// inheritedListeners returns the sockets passed in by systemd or by the
+// process being upgraded. rtmp is nil when the process inherited none.
+func inheritedListeners() (inheritedSockets, error) {
+	if names, ok := os.LookupEnv(upgradeFDsEnv); ok {
+		os.Unsetenv(upgradeFDsEnv)
+		return upgradeListeners(names)
+	}
+	rtmp, err := activationListener()
+	return inheritedSockets{rtmp: rtmp}, err
+}
+
+// upgradeListeners opens the sockets named in RTMP_SERVER_LISTEN_FDS.
+func upgradeListeners(names string) (inheritedSockets, error) {
+	in := inheritedSockets{http: make(map[string]net.Listener)}
+	fail := func(err error) (inheritedSockets, error) {
+		for _, ln := range []net.Listener{in.rtmp, in.rtmps} {
+			if ln != nil {
+				_ = ln.Close()
+			}
+		}
+		in.closeHTTP()
+		return inheritedSockets{}, err
+	}
+	for i, name := range strings.Split(names, ",") {
+		ln, err := fileListener(listenFDsStart+i, "upgrade")
+		if err != nil {
+			return fail(err)
+		}
+		switch {
+		case name == "rtmp" && in.rtmp == nil:
+			in.rtmp = ln
+		case name == "rtmps" && in.rtmps == nil:
+			in.rtmps = ln
+		case slices.Contains(httpSockets, name) && in.http[name] == nil:
+			in.http[name] = ln
+		default:
+			_ = ln.Close()
+			return fail(fmt.Errorf("upgrade: unexpected socket %q in %s=%q", name, upgradeFDsEnv, names))
+		}
+	}
+	if in.rtmp == nil {
+		return fail(fmt.Errorf("upgrade: no rtmp socket in %s=%q", upgradeFDsEnv, names))
+	}
+	return in, nil
+}
+
+// listenHTTP returns the socket for HTTP server name: the inherited one,
+// taken out of in.http, or a new one on addr.
+func (in *inheritedSockets) listenHTTP(name, addr string) (net.Listener, error) {
+	if ln := in.http[name]; ln != nil {
+		delete(in.http, name)
+		return ln, nil
+	}
+	return net.Listen("tcp", addr)
+}
+
+// closeHTTP closes the HTTP servers' sockets that are left, those of
+// servers the new binary's flags turned off.
+func (in *inheritedSockets) closeHTTP() {
+	for name, ln := range in.http {
+		_ = ln.Close()
+		delete(in.http, name)
+	}
+}
+
+// activationListener returns the listener passed in by systemd, or nil if
+// the process was not socket activated.
+func activationListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	fds := os.Getenv("LISTEN_FDS")
+	// Hook scripts and transcoders inherit the environment; the sockets
+	// are not theirs.
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	n, err := strconv.Atoi(fds)
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("socket activation: invalid LISTEN_FDS %q", fds)
+	}
+	if n > 1 {
+		return nil, fmt.Errorf("socket activation: got %d sockets, want 1 (RTMPS and SRT listen on -tls-listen and -srt-listen)", n)
+	}
+	return fileListener(listenFDsStart, "socket activation")
+}
+
+// fileListener turns inherited file descriptor fd into a listener.
+func fileListener(fd int, source string) (net.Listener, error) {
+	f := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+	defer f.Close() // net.FileListener works on a duplicate
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: fd %d: %w", source, fd, err)
+	}
+	return ln, nil
+}
@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
-	_ "expvar" // Register /debug/vars handler on DefaultServeMux
+	"errors"
+	"expvar"
 	"fmt"
 	"net/http"
+	"net/http/pprof"
 	"os"
 	"os/signal"
 	"strings"
@@ -12,17 +14,23 @@ import (
 	"time"
 
 	"github.com/alxayo/go-rtmp/internal/logger"
+	"github.com/alxayo/go-rtmp/internal/rtmp/client"
 	_ "github.com/alxayo/go-rtmp/internal/rtmp/metrics" // Register expvar RTMP counters
 	srv "github.com/alxayo/go-rtmp/internal/rtmp/server"
 	"github.com/alxayo/go-rtmp/internal/rtmp/server/auth"
 	"github.com/alxayo/go-rtmp/internal/srt"
 	srtauth "github.com/alxayo/go-rtmp/internal/srt/auth" // Per-stream SRT passphrase resolution
+	"github.com/alxayo/go-rtmp/internal/telemetry"
 )
 
 func main() {
 	cfg, err := parseFlags(os.Args[1:])
 	if err != nil {
-		// flag package already printed usage/error
+		// The flag package prints syntax errors with the usage; print the
+		// validation errors it does not know about.
+		if !errors.As(err, new(usageError)) {
+			fmt.Fprintln(os.Stderr, "rtmp-server:", err)
+		}
 		os.Exit(2)
 	}
 	if cfg.showVersion {
@@ -35,15 +43,36 @@ func main() {
 	if err := logger.SetLevel(cfg.logLevel); err != nil {
 		fmt.Printf("Warning: invalid log level %q, using default\n", cfg.logLevel)
 	}
+	// Flags are validated in parseFlags; these cannot fail here.
+	_ = logger.SetFormat(cfg.logFormat)
+	_ = logger.SetComponentLevels(cfg.logComponents)
+	logger.SetDebugSampling(cfg.logDebugSample)
 	log := logger.Logger().With("component", "cli")
 	log.Debug("logger initialized", "level", cfg.logLevel)
 
+	if cfg.checkConfig {
+		os.Exit(checkConfig(cfg, os.Stdout))
+	}
+
 	// Build authentication validator from CLI flags
 	authValidator, err := buildAuthValidator(cfg, log)
 	if err != nil {
 		log.Error("failed to initialize authentication", "error", err)
 		os.Exit(2)
 	}
+	playAuthValidator, err := buildPlayAuthValidator(cfg)
+	if err != nil {
+		log.Error("failed to initialize play authentication", "error", err)
+		os.Exit(2)
+	}
+
+	var clientCertACL *srv.ClientCertACL
+	if cfg.tlsClientACL != "" {
+		if clientCertACL, err = srv.LoadClientCertACL(cfg.tlsClientACL); err != nil {
+			log.Error("failed to load client certificate ACL", "error", err)
+			os.Exit(2)
+		}
+	}
 
 	// Build SRT passphrase resolver from CLI flags.
 	// srtResolver is the function the server calls during each SRT handshake.
@@ -55,46 +84,71 @@ func main() {
 		os.Exit(2)
 	}
 
-	// Parse the segment duration string into a time.Duration.
-	// The string was already validated in parseFlags(), so we can safely ignore the error.
-	var segmentDur time.Duration
-	if cfg.segmentDuration != "" {
-		segmentDur, _ = time.ParseDuration(cfg.segmentDuration) // already validated in parseFlags
+	relayTLS, err := client.TLSOptions{
+		InsecureSkipVerify: cfg.relayTLSInsecure,
+		RootCAFile:         cfg.relayTLSCA,
+		ServerName:         cfg.relayTLSName,
+	}.Config()
+	if err != nil {
+		log.Error("failed to load relay TLS settings", "error", err)
+		os.Exit(2)
+	}
+
+	// OpenTelemetry tracing is configured by the standard OTEL_* environment
+	// variables and off when none are set.
+	tracer, err := telemetry.FromEnv(logger.Logger())
+	if err != nil {
+		log.Error("failed to initialize tracing", "error", err)
+		os.Exit(2)
+	}
+	if tracer != nil {
+		log.Info("OpenTelemetry tracing enabled")
+		defer func() {
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := tracer.Shutdown(flushCtx); err != nil {
+				log.Warn("trace export not flushed", "error", err)
+			}
+		}()
 	}
 
-	server := srv.New(srv.Config{
-		ListenAddr:            cfg.listenAddr,
-		ChunkSize:             uint32(cfg.chunkSize),
-		WindowAckSize:         2_500_000,
-		RecordAll:             cfg.recordAll,
-		RecordDir:             cfg.recordDir,
-		SegmentDuration:       segmentDur,
-		SegmentPattern:        cfg.segmentPattern,
-		LogLevel:              cfg.logLevel,
-		RelayDestinations:     cfg.relayDestinations,
-		HookScripts:           cfg.hookScripts,
-		HookWebhooks:          cfg.hookWebhooks,
-		HookStdioFormat:       cfg.hookStdioFormat,
-		HookTimeout:           cfg.hookTimeout,
-		HookConcurrency:       cfg.hookConcurrency,
-		AuthValidator:         authValidator,
-		TLSListenAddr:         cfg.tlsListenAddr,
-		TLSCertFile:           cfg.tlsCertFile,
-		TLSKeyFile:            cfg.tlsKeyFile,
-		SRTListenAddr:         cfg.srtListenAddr,
-		SRTLatency:            cfg.srtLatency,
-		SRTPassphrase:         cfg.srtPassphrase,
-		SRTPbKeyLen:            cfg.srtPbKeyLen,
-		SRTPassphraseFile:     cfg.srtPassphraseFile,
-		SRTPassphraseResolver: srtResolver,
-	})
-
-	if err := server.Start(); err != nil {
+	// Under systemd socket activation or after a binary upgrade the
+	// inherited sockets replace -listen (and -tls-listen).
+	inherited, err := inheritedListeners()
+	if err != nil {
 		log.Error("failed to start server", "error", err)
 		os.Exit(1)
 	}
+	ln, tlsLn := inherited.rtmp, inherited.rtmps
+	if tlsLn != nil && cfg.tlsListenAddr == "" {
+		_ = tlsLn.Close() // RTMPS was turned off for the new binary
+		tlsLn = nil
+	}
+
+	drainTimeout, _ := time.ParseDuration(cfg.drainTimeout) // already validated in parseFlags
 
-	log.Info("server started", "addr", server.Addr().String(), "version", version, "auth_mode", cfg.authMode, "log_level", cfg.logLevel)
+	scfg := serverConfig(cfg)
+	scfg.RelayTLSConfig = relayTLS
+	scfg.Tracer = tracer
+	scfg.AuthValidator = authValidator
+	scfg.PlayAuthValidator = playAuthValidator
+	scfg.TLSClientACL = clientCertACL
+	scfg.TLSListener = tlsLn
+	scfg.SRTPassphraseResolver = srtResolver
+	server := srv.New(scfg)
+
+	if ln != nil {
+		log.Info("using inherited socket, ignoring -listen", "addr", ln.Addr().String())
+		err = server.Serve(ln)
+	} else {
+		err = server.Start()
+	}
+	if err != nil {
+		log.Error("failed to start server", "error", err)
+		os.Exit(1)
+	}
+
+	log.Info("server started", "addr", server.Addr().String(), "version", version, "auth_mode", cfg.authMode, "play_auth_mode", cfg.playAuthMode, "log_level", cfg.logLevel)
 	if server.TLSAddr() != nil {
 		log.Info("RTMPS enabled", "tls_addr", server.TLSAddr().String())
 	}
@@ -102,22 +156,72 @@ func main() {
 		log.Info("SRT ingest enabled", "srt_addr", server.SRTAddr().String())
 	}
 
-	// Start HTTP metrics server if configured
-	if cfg.metricsAddr != "" {
+	// The HTTP servers listen on the sockets inherited from an upgrade, if
+	// any, and hand theirs on to the next one (httpLns).
+	var httpLns []httpListener
+	serveHTTP := func(name, addr string, h http.Handler) {
+		hln, err := inherited.listenHTTP(name, addr)
+		if err != nil {
+			log.Error(name+" HTTP server error", "error", err)
+			return
+		}
+		hs := &http.Server{Handler: h}
+		httpLns = append(httpLns, httpListener{name: name, srv: hs, ln: hln})
+		log.Info(name+" HTTP server listening", "addr", hln.Addr().String())
 		go func() {
-			log.Info("metrics HTTP server listening", "addr", cfg.metricsAddr)
-			if err := http.ListenAndServe(cfg.metricsAddr, nil); err != nil && err != http.ErrServerClosed {
-				log.Error("metrics HTTP server error", "error", err)
+			if err := hs.Serve(hln); err != nil && err != http.ErrServerClosed {
+				log.Error(name+" HTTP server error", "error", err)
 			}
 		}()
 	}
 
+	// The metrics listener serves only /debug/vars, plus the profiling
+	// endpoints when -pprof-addr names the same address; otherwise those get
+	// their own listener.
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("/debug/vars", expvar.Handler())
+	if cfg.pprofAddr != "" {
+		if cfg.pprofAddr == cfg.metricsAddr {
+			registerPprof(metricsMux)
+		} else {
+			mux := http.NewServeMux()
+			registerPprof(mux)
+			serveHTTP("pprof", cfg.pprofAddr, mux)
+		}
+	}
+
+	// Start HTTP metrics server if configured
+	if cfg.metricsAddr != "" {
+		serveHTTP("metrics", cfg.metricsAddr, metricsMux)
+	}
+
+	// The admin API starts and stops recordings of live streams, serves
+	// their latest keyframes and JPEG previews (-thumbnail-interval) and,
+	// with -auth-mode=store, creates, lists and revokes tokens at runtime
+	// (parseFlags ensures a bearer token).
+	if cfg.adminAddr != "" {
+		adminMux := http.NewServeMux()
+		recordings := auth.RequireBearer(cfg.adminToken, server.RecordingHandler())
+		adminMux.Handle("/api/recordings", recordings)
+		adminMux.Handle("/api/recordings/", recordings)
+		thumbnails := auth.RequireBearer(cfg.adminToken, server.ThumbnailHandler())
+		adminMux.Handle("/api/thumbnails", thumbnails)
+		adminMux.Handle("/api/thumbnails/", thumbnails)
+		if sv, ok := authValidator.(*auth.StoreValidator); ok {
+			tokens := auth.NewTokenHandler(sv.Store, cfg.adminToken)
+			adminMux.Handle("/api/tokens", tokens)
+			adminMux.Handle("/api/tokens/", tokens)
+		}
+		serveHTTP("admin", cfg.adminAddr, adminMux)
+	}
+	inherited.closeHTTP()
+
 	// Register a SIGHUP handler for live configuration reload without restart.
 	// A single handler covers both features because they share the same reload
 	// pattern: re-read a JSON file from disk and atomically swap the in-memory
 	// map. Each reload is independent — if the auth file reload fails, the SRT
 	// passphrase file reload still runs (and vice versa).
-	needSighup := cfg.authMode == "file" || srtFileResolver != nil
+	needSighup := cfg.authMode == "file" || cfg.playAuthMode == "file" || cfg.playAuthMode == "viewers" || srtFileResolver != nil || clientCertACL != nil
 	if needSighup {
 		sighup := make(chan os.Signal, 1)
 		signal.Notify(sighup, syscall.SIGHUP)
@@ -133,6 +237,22 @@ func main() {
 						}
 					}
 				}
+				// Reload play tokens (file or viewer token file)
+				if r, ok := playAuthValidator.(interface{ Reload() error }); ok {
+					if err := r.Reload(); err != nil {
+						log.Error("play auth file reload failed", "error", err)
+					} else {
+						log.Info("play auth file reloaded")
+					}
+				}
+				// Reload the client certificate ACL
+				if clientCertACL != nil {
+					if err := clientCertACL.Reload(); err != nil {
+						log.Error("client certificate ACL reload failed", "error", err)
+					} else {
+						log.Info("client certificate ACL reloaded")
+					}
+				}
 				// Reload SRT per-stream passphrases (if using file-based resolver).
 				// The resolver's Reload() re-reads the JSON file and validates all
 				// passphrases; on failure, the previous valid map is preserved.
@@ -169,7 +289,33 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	<-ctx.Done()
+	// SIGUSR2 starts the new binary on our sockets and drains this process
+	// (see upgrade.go). Usage: kill -USR2 <pid>
+	upgradeCh := make(chan os.Signal, 1)
+	signal.Notify(upgradeCh, syscall.SIGUSR2)
+	for ctx.Err() == nil {
+		select {
+		case <-upgradeCh:
+			pid, err := startUpgrade(server, httpLns)
+			if err != nil {
+				log.Error("SIGUSR2: upgrade failed, still serving", "error", err)
+				continue
+			}
+			log.Info("SIGUSR2: new process started, draining connections", "pid", pid, "connections", server.ConnectionCount(), "drain_timeout", drainTimeout.String())
+			drainCtx := ctx
+			if drainTimeout > 0 {
+				var cancel context.CancelFunc
+				drainCtx, cancel = context.WithTimeout(ctx, drainTimeout)
+				defer cancel()
+			}
+			if err := server.Drain(drainCtx); err != nil {
+				log.Warn("drain ended early, remaining connections closed", "error", err)
+			}
+			log.Info("server drained")
+			return
+		case <-ctx.Done():
+		}
+	}
 	log.Info("shutdown signal received")
 
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -193,6 +339,124 @@ func main() {
 	}
 }
 
+// serverConfig maps the flags to the server configuration. The validators,
+// relay TLS settings, tracer and inherited listener built at startup are
+// left for the caller to set.
+func serverConfig(cfg *cliConfig) srv.Config {
+	// Parse the segment duration string into a time.Duration.
+	// The string was already validated in parseFlags(), so we can safely ignore the error.
+	var segmentDur time.Duration
+	if cfg.segmentDuration != "" {
+		segmentDur, _ = time.ParseDuration(cfg.segmentDuration) // already validated in parseFlags
+	}
+
+	hookQueueMaxAge, _ := time.ParseDuration(cfg.hookQueueMaxAge)     // already validated in parseFlags
+	endedStreamTTL, _ := time.ParseDuration(cfg.endedStreamTTL)       // already validated in parseFlags
+	failoverTimeout, _ := time.ParseDuration(cfg.failoverTimeout)     // already validated in parseFlags
+	slowWindow, _ := time.ParseDuration(cfg.slowWindow)               // already validated in parseFlags
+	avDriftThreshold, _ := time.ParseDuration(cfg.avDriftThreshold)   // already validated in parseFlags
+	thumbnailInterval, _ := time.ParseDuration(cfg.thumbnailInterval) // already validated in parseFlags
+	pingInterval, _ := time.ParseDuration(cfg.pingInterval)           // already validated in parseFlags
+	dvrWindow, _ := time.ParseDuration(cfg.dvrWindow)                 // already validated in parseFlags
+	sendTimeout, _ := time.ParseDuration(cfg.sendTimeout)             // already validated in parseFlags
+	idleTimeout, _ := time.ParseDuration(cfg.idleTimeout)             // already validated in parseFlags
+
+	return srv.Config{
+		ListenAddr:               cfg.listenAddr,
+		ChunkSize:                uint32(cfg.chunkSize),
+		MaxMessageSize:           uint32(cfg.maxMessageSize),
+		MaxChunkStreams:          cfg.maxChunkStreams,
+		MaxAMFMessageSize:        uint32(cfg.maxAMFSize),
+		MaxChunkSize:             uint32(cfg.maxChunkSize),
+		WindowAckSize:            uint32(cfg.windowAckSize),
+		PeerBandwidth:            uint32(cfg.peerBandwidth),
+		PeerBandwidthLimit:       cfg.peerLimit,
+		Apps:                     cfg.apps,
+		VHosts:                   cfg.vhosts,
+		RecordAll:                cfg.recordAll,
+		RecordStreams:            cfg.recordStreams,
+		RecordDir:                cfg.recordDir,
+		RecordFormat:             cfg.recordFormat,
+		RecordTimecode:           cfg.recordTimecode,
+		SegmentDuration:          segmentDur,
+		SegmentPattern:           cfg.segmentPattern,
+		RecordQueueSize:          cfg.recordQueueSize,
+		RecordStorage:            cfg.recordStorage,
+		LogLevel:                 cfg.logLevel,
+		RelayDestinations:        cfg.relayDestinations,
+		RelayProxyURL:            cfg.relayProxy,
+		RelayQueueSize:           cfg.relayQueueSize,
+		RelayProfiles:            cfg.relayProfiles,
+		VODEnabled:               cfg.vodEnabled,
+		DVRWindow:                dvrWindow,
+		OriginURL:                cfg.originURL,
+		ClusterRedisURL:          cfg.clusterRedis,
+		ClusterNodeURL:           cfg.clusterNodeURL,
+		LinkListenAddr:           cfg.linkListen,
+		LinkSecret:               cfg.linkSecret,
+		VariantSeparator:         cfg.variantSeparator,
+		StreamAliases:            cfg.streamAliases,
+		RedundantIngest:          cfg.redundantIngest,
+		FailoverTimeout:          failoverTimeout,
+		MaxSubscribersPerStream:  cfg.maxSubscribers,
+		SlowSubscriberDropRate:   cfg.slowDropRate,
+		SlowSubscriberWindow:     slowWindow,
+		PingInterval:             pingInterval,
+		PingMisses:               cfg.pingMisses,
+		AVDriftThreshold:         avDriftThreshold,
+		SendTimeout:              sendTimeout,
+		IdleTimeout:              idleTimeout,
+		StreamKeyMaxLength:       cfg.streamKeyMaxLen,
+		StreamKeyCharset:         cfg.streamKeyCharset,
+		TranscodeCommand:         cfg.transcodeCommand,
+		ThumbnailInterval:        thumbnailInterval,
+		ThumbnailCommand:         cfg.thumbnailCommand,
+		ThumbnailDir:             cfg.thumbnailDir,
+		DuplicatePublisherPolicy: cfg.publisherPolicy,
+		StatusTxnMode:            cfg.statusTxn,
+		EndedStreamTTL:           endedStreamTTL,
+		LatencyStats:             cfg.latencyStats,
+		MediaDiagnostics:         cfg.mediaDiagnostics,
+		TraceDir:                 cfg.traceDir,
+		ChunkDiagnostics:         cfg.chunkDiagnostics,
+		Inspect:                  cfg.inspect,
+		InspectDir:               cfg.inspectDir,
+		HandshakeRejectReply:     cfg.rejectReply,
+		HookScripts:              cfg.hookScripts,
+		HookWebhooks:             cfg.hookWebhooks,
+		HookStdioFormat:          cfg.hookStdioFormat,
+		HookTimeout:              cfg.hookTimeout,
+		HookConcurrency:          cfg.hookConcurrency,
+		HookWebhookSecret:        cfg.hookWebhookSecret,
+		HookWebhookHeaders:       cfg.hookWebhookHeaders,
+		HookWebhookRetries:       cfg.hookWebhookRetries,
+		HookQueueSize:            cfg.hookQueueSize,
+		HookQueueMaxAge:          hookQueueMaxAge,
+		HookQueueDir:             cfg.hookQueueDir,
+		TLSListenAddr:            cfg.tlsListenAddr,
+		TLSCertFile:              cfg.tlsCertFile,
+		TLSKeyFile:               cfg.tlsKeyFile,
+		TLSSelfSigned:            cfg.tlsSelfSigned,
+		TLSClientCAFile:          cfg.tlsClientCA,
+		SRTListenAddr:            cfg.srtListenAddr,
+		SRTLatency:               cfg.srtLatency,
+		SRTPassphrase:            cfg.srtPassphrase,
+		SRTPbKeyLen:              cfg.srtPbKeyLen,
+		SRTPassphraseFile:        cfg.srtPassphraseFile,
+	}
+}
+
+// registerPprof mounts the net/http/pprof handlers under /debug/pprof/ on
+// mux. Importing net/http/pprof also registers them on DefaultServeMux,
+// which is why no listener serves DefaultServeMux.
+func registerPprof(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+}
+
 // buildAuthValidator creates the appropriate auth.Validator based on CLI flags.
 func buildAuthValidator(cfg *cliConfig, log interface{ Info(string, ...any) }) (auth.Validator, error) {
 	switch cfg.authMode {
@@ -214,11 +478,67 @@ func buildAuthValidator(cfg *cliConfig, log interface{ Info(string, ...any) }) (
 			timeout = 5 * time.Second
 		}
 		return auth.NewCallbackValidator(cfg.authCallbackURL, timeout), nil
+	case "signed":
+		skew, _ := time.ParseDuration(cfg.authClockSkew) // already validated in parseFlags
+		appSecrets := make(map[string]string, len(cfg.authAppSecrets))
+		for _, s := range cfg.authAppSecrets {
+			app, secret, _ := strings.Cut(s, "=")
+			appSecrets[app] = secret
+		}
+		return &auth.SignedURLValidator{Secret: cfg.authSecret, AppSecrets: appSecrets, ClockSkew: skew}, nil
+	case "store":
+		store, err := buildTokenStore(cfg.authStore)
+		if err != nil {
+			return nil, err
+		}
+		return &auth.StoreValidator{Store: store}, nil
 	default: // "none"
 		return &auth.AllowAllValidator{}, nil
 	}
 }
 
+// buildPlayAuthValidator creates the validator for play requests from the
+// -play-auth-* flags, or returns nil when plays use -auth-mode.
+func buildPlayAuthValidator(cfg *cliConfig) (auth.Validator, error) {
+	switch cfg.playAuthMode {
+	case "token":
+		tokens := make(map[string]string, len(cfg.playAuthTokens))
+		for _, t := range cfg.playAuthTokens {
+			key, token, _ := strings.Cut(t, "=") // already validated in parseFlags
+			tokens[key] = token
+		}
+		return &auth.TokenValidator{Tokens: tokens}, nil
+	case "file":
+		return auth.NewFileValidator(cfg.playAuthFile)
+	case "viewers":
+		return auth.LoadViewerTokens(cfg.playAuthFile)
+	case "callback":
+		timeout, _ := time.ParseDuration(cfg.authCallbackTimeout)
+		if timeout == 0 {
+			timeout = 5 * time.Second
+		}
+		return auth.NewCallbackValidator(cfg.playAuthCallbackURL, timeout), nil
+	case "signed":
+		skew, _ := time.ParseDuration(cfg.authClockSkew) // already validated in parseFlags
+		return &auth.SignedURLValidator{Secret: cfg.playAuthSecret, ClockSkew: skew}, nil
+	default: // "": plays use -auth-mode
+		return nil, nil
+	}
+}
+
+// buildTokenStore opens the -auth-store token store: "memory", "file:PATH"
+// or a redis:// URL (already validated in parseFlags).
+func buildTokenStore(spec string) (auth.TokenStore, error) {
+	switch {
+	case strings.HasPrefix(spec, "file:"):
+		return auth.NewFileTokenStore(strings.TrimPrefix(spec, "file:"))
+	case strings.HasPrefix(spec, "redis://"), strings.HasPrefix(spec, "rediss://"):
+		return auth.NewRedisTokenStore(spec)
+	default: // "memory"
+		return auth.NewMemoryTokenStore(), nil
+	}
+}
+
 // buildSRTResolver creates the SRT passphrase resolver from CLI flags.
 //
 // The resolver is the bridge between the CLI configuration layer and the SRT
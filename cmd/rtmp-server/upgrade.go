@@ -0,0 +1,124 @@
+package main
+
+// Binary upgrade. On SIGUSR2 the server starts a new copy of its binary
+// (typically just replaced on disk) with the same arguments and hands it the
+// listening sockets, those of the metrics, pprof and admin HTTP servers
+// included (see listen.go). The old process then stops accepting,
+// keeps serving the connections it has until they end or -drain-timeout
+// passes, and exits. Publishers and players stay connected through a deploy;
+// new clients are served by the new binary. SRT sessions end, as the SRT
+// port is released for the new process. If the new binary cannot be
+// started, the old process takes the SRT port back and serves on.
+//
+// Under systemd, use socket activation and systemctl restart instead: the
+// service's main process would change, which systemd does not follow.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	srv "github.com/alxayo/go-rtmp/internal/rtmp/server"
+)
+
+// httpShutdownTimeout bounds how long the old process waits for the HTTP
+// requests it is serving once the new process has taken over.
+const httpShutdownTimeout = 5 * time.Second
+
+// httpListener is HTTP server name (httpSockets) and its socket.
+type httpListener struct {
+	name string
+	srv  *http.Server
+	ln   net.Listener
+}
+
+// startUpgrade starts the new server process with server's listening
+// sockets and the HTTP servers' httpLns, stops server accepting connections
+// and shuts the HTTP servers down. It returns the new process ID. On error
+// server and the HTTP servers are still accepting.
+func startUpgrade(server *srv.Server, httpLns []httpListener) (int, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, fmt.Errorf("locate binary: %w", err)
+	}
+	if _, err := os.Stat(exe); err != nil {
+		return 0, fmt.Errorf("locate binary: %w", err)
+	}
+	files, err := server.ListenerFiles()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+	names := []string{"rtmp"}
+	if len(files) > 1 {
+		names = append(names, "rtmps")
+	}
+	for _, h := range httpLns {
+		fl, ok := h.ln.(interface{ File() (*os.File, error) })
+		if !ok {
+			return 0, fmt.Errorf("%s HTTP listener %s cannot be passed on", h.name, h.ln.Addr())
+		}
+		f, err := fl.File()
+		if err != nil {
+			return 0, fmt.Errorf("%s HTTP listener %s: %w", h.name, h.ln.Addr(), err)
+		}
+		files = append(files, f)
+		names = append(names, h.name)
+	}
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), upgradeFDsEnv+"="+strings.Join(names, ","))
+	cmd.ExtraFiles = files
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	// Release the SRT and link ports before the new process binds them.
+	// RTMP and RTMPS keep accepting until it runs; from then on both
+	// processes share the sockets until this one stops accepting.
+	server.ReleasePorts()
+	err = cmd.Start()
+	// exec put the shared sockets in blocking mode (os.File.Fd); an accept
+	// on one would then block until a client connects, and so would closing
+	// it.
+	setNonblock(files)
+	if err != nil {
+		err = fmt.Errorf("start %s: %w", exe, err)
+		if rerr := server.ReclaimPorts(); rerr != nil {
+			err = errors.Join(err, fmt.Errorf("reopen released listeners: %w", rerr))
+		}
+		return 0, err
+	}
+	server.StopAccepting()
+	ctx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+	defer cancel()
+	for _, h := range httpLns {
+		_ = h.srv.Shutdown(ctx)
+	}
+	pid := cmd.Process.Pid
+	_ = cmd.Process.Release()
+	return pid, nil
+}
+
+// setNonblock puts the sockets of files back in non-blocking mode, the mode
+// the listeners sharing them expect.
+func setNonblock(files []*os.File) {
+	for _, f := range files {
+		rc, err := f.SyscallConn()
+		if err != nil {
+			continue
+		}
+		_ = rc.Control(func(fd uintptr) {
+			_ = syscall.SetNonblock(int(fd), true)
+		})
+	}
+}
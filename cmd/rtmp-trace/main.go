@@ -0,0 +1,204 @@
+// Command rtmp-trace prints connection traces written by the server's
+// -trace-dir option: one line per RTMP message with its direction, time
+// since the connection started, chunk stream, type, message stream,
+// timestamp and length, followed by a decoded summary (control values,
+// AMF0 command arguments, codec and frame type of audio and video).
+//
+// Usage:
+//
+//	go run ./cmd/rtmp-trace traces/c000001-20260501T100000.jsonl
+//	go run ./cmd/rtmp-trace -type 20,18 -hex traces/*.jsonl
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
+	"github.com/alxayo/go-rtmp/internal/rtmp/control"
+	"github.com/alxayo/go-rtmp/internal/rtmp/media"
+	"github.com/alxayo/go-rtmp/internal/rtmp/trace"
+)
+
+// printConfig holds the parsed command-line flag values.
+type printConfig struct {
+	types    map[uint8]bool // message type IDs to print; empty prints all
+	dir      trace.Direction
+	hexDump  bool // dump payloads in hex
+	maxBytes int  // payload bytes dumped per message
+}
+
+func main() {
+	var types, dir string
+	cfg := printConfig{}
+	flag.StringVar(&types, "type", "", "Only print these message type IDs, comma-separated (e.g. 20,18)")
+	flag.StringVar(&dir, "dir", "", "Only print messages in this direction: in or out")
+	flag.BoolVar(&cfg.hexDump, "hex", false, "Dump each message payload in hex")
+	flag.IntVar(&cfg.maxBytes, "max-bytes", 256, "Payload bytes dumped per message with -hex (0 = all)")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: rtmp-trace [flags] trace.jsonl...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if types != "" {
+		cfg.types = make(map[uint8]bool)
+		for _, s := range strings.Split(types, ",") {
+			id, err := strconv.ParseUint(strings.TrimSpace(s), 10, 8)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "rtmp-trace: invalid -type %q\n", s)
+				os.Exit(2)
+			}
+			cfg.types[uint8(id)] = true
+		}
+	}
+	switch trace.Direction(dir) {
+	case "", trace.In, trace.Out:
+		cfg.dir = trace.Direction(dir)
+	default:
+		fmt.Fprintf(os.Stderr, "rtmp-trace: invalid -dir %q (expected in or out)\n", dir)
+		os.Exit(2)
+	}
+
+	failed := false
+	for _, path := range flag.Args() {
+		if err := printFile(os.Stdout, path, cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "rtmp-trace: %s: %v\n", path, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// printFile prints the trace at path to w.
+func printFile(w io.Writer, path string, cfg printConfig) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := trace.NewReader(f)
+	if err != nil {
+		return err
+	}
+	h := r.Header()
+	fmt.Fprintf(w, "# %s  conn=%s  remote=%s  start=%s", path, h.ConnID, h.Remote, h.Start.Format("2006-01-02 15:04:05.000"))
+	if h.RawIn != "" {
+		fmt.Fprintf(w, "  raw=%s", h.RawIn)
+	}
+	fmt.Fprintln(w)
+	for {
+		rec, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if (cfg.types != nil && !cfg.types[rec.TypeID]) || (cfg.dir != "" && rec.Dir != cfg.dir) {
+			continue
+		}
+		fmt.Fprintf(w, "%10.3f  %-3s  csid=%-2d %-20s stream=%d ts=%d len=%d  %s\n",
+			rec.Time.Sub(h.Start).Seconds(), rec.Dir, rec.CSID, typeName(rec.TypeID),
+			rec.MessageStreamID, rec.Timestamp, rec.Length, summarize(rec.TypeID, rec.Payload))
+		if cfg.hexDump && len(rec.Payload) > 0 {
+			p := rec.Payload
+			if cfg.maxBytes > 0 && len(p) > cfg.maxBytes {
+				p = p[:cfg.maxBytes]
+			}
+			fmt.Fprint(w, hex.Dump(p))
+		}
+	}
+}
+
+// typeNames names the RTMP message types.
+var typeNames = map[uint8]string{
+	control.TypeSetChunkSize:          "SetChunkSize",
+	control.TypeAbortMessage:          "Abort",
+	control.TypeAcknowledgement:       "Ack",
+	control.TypeUserControl:           "UserControl",
+	control.TypeWindowAcknowledgement: "WindowAckSize",
+	control.TypeSetPeerBandwidth:      "SetPeerBandwidth",
+	8:                                 "Audio",
+	9:                                 "Video",
+	15:                                "DataAMF3",
+	16:                                "SharedObjectAMF3",
+	17:                                "CommandAMF3",
+	18:                                "DataAMF0",
+	19:                                "SharedObjectAMF0",
+	20:                                "CommandAMF0",
+	22:                                "Aggregate",
+}
+
+// typeName returns "Name(id)" for a message type ID.
+func typeName(id uint8) string {
+	if name, ok := typeNames[id]; ok {
+		return fmt.Sprintf("%s(%d)", name, id)
+	}
+	return fmt.Sprintf("type(%d)", id)
+}
+
+// summarize decodes what it can of a payload into one line.
+func summarize(typeID uint8, payload []byte) string {
+	switch typeID {
+	case control.TypeSetChunkSize, control.TypeAbortMessage, control.TypeAcknowledgement,
+		control.TypeUserControl, control.TypeWindowAcknowledgement, control.TypeSetPeerBandwidth:
+		v, err := control.Decode(typeID, payload)
+		if err != nil {
+			return "decode error: " + err.Error()
+		}
+		return strings.TrimPrefix(fmt.Sprintf("%+v", v), "&")
+	case 8:
+		a, err := media.ParseAudioMessage(payload)
+		if err != nil {
+			return "decode error: " + err.Error()
+		}
+		return a.Codec + " " + a.PacketType
+	case 9:
+		v, err := media.ParseVideoMessage(payload)
+		if err != nil {
+			return "decode error: " + err.Error()
+		}
+		return v.Codec + " " + v.FrameType + " " + v.PacketType
+	case 15, 17:
+		// AMF3 messages start with a format byte; servers and clients in
+		// practice send AMF0 values after it.
+		if len(payload) == 0 {
+			return ""
+		}
+		return summarizeAMF0(payload[1:])
+	case 18, 20:
+		return summarizeAMF0(payload)
+	default:
+		return ""
+	}
+}
+
+// summarizeAMF0 prints the AMF0 values in payload, e.g. a command name,
+// transaction ID and arguments.
+func summarizeAMF0(payload []byte) string {
+	vals, err := amf.DecodeAll(payload)
+	if err != nil {
+		return "decode error: " + err.Error()
+	}
+	parts := make([]string, len(vals))
+	for i, v := range vals {
+		if s, ok := v.(string); ok {
+			parts[i] = strconv.Quote(s)
+		} else {
+			parts[i] = fmt.Sprintf("%v", v)
+		}
+	}
+	return strings.Join(parts, " ")
+}
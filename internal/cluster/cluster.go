@@ -0,0 +1,132 @@
+// File: cluster.go
+// Purpose: A stream directory shared by a fleet of servers. Each server
+// announces the streams published on it to Redis, under a key that expires
+// unless refreshed, so any server behind the same load balancer can look up
+// which node has a stream and pull it from there.
+//
+// Key Types:
+//   - Presence: Where a stream is published (node URL, codecs, start time)
+//   - Directory: Announce, withdraw and look up presences in Redis
+//   - Redis: Minimal RESP client used by Directory (redis:// and rediss://)
+//
+// Key Functions:
+//   - Open(rawURL, prefix, ttl): Build a Directory for a Redis URL
+//
+// Data layout: one Redis string per stream, "<prefix><stream key>", holding
+// the Presence as JSON with a TTL. A node that dies stops refreshing its
+// entries and they expire after the TTL.
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Defaults for Open.
+const (
+	DefaultPrefix = "rtmp:stream:"
+	DefaultTTL    = 15 * time.Second
+)
+
+// ErrNotFound is returned by Lookup when no node announces the stream.
+var ErrNotFound = errors.New("cluster: stream not announced")
+
+// withdrawScript deletes an entry only if it still holds the value this
+// node wrote, so a node never removes another node's newer announcement.
+const withdrawScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`
+
+// Presence describes a stream published on one node.
+type Presence struct {
+	Key        string    `json:"key"`
+	Node       string    `json:"node"` // rtmp://host:port the stream can be played from
+	AudioCodec string    `json:"audio_codec,omitempty"`
+	VideoCodec string    `json:"video_codec,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+}
+
+// Directory stores presences in Redis. Safe for concurrent use.
+type Directory struct {
+	Redis  *Redis
+	Prefix string        // prepended to stream keys (default DefaultPrefix)
+	TTL    time.Duration // lifetime of an entry unless refreshed (default DefaultTTL)
+
+	mu      sync.Mutex
+	written map[string]string // stream key -> value last announced by this node
+}
+
+// Open returns a Directory on the Redis server at rawURL. An empty prefix
+// or a zero ttl selects the default.
+func Open(rawURL, prefix string, ttl time.Duration) (*Directory, error) {
+	r, err := ParseRedisURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &Directory{Redis: r, Prefix: prefix, TTL: ttl}, nil
+}
+
+// Announce records p, replacing any earlier entry for p.Key, and resets its
+// TTL. Call it again before the TTL runs out to keep the entry alive.
+func (d *Directory) Announce(ctx context.Context, p Presence) error {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	ms := strconv.FormatInt(d.TTL.Milliseconds(), 10)
+	if _, err := d.Redis.Do(ctx, "SET", d.Prefix+p.Key, string(b), "PX", ms); err != nil {
+		return fmt.Errorf("cluster: announce %s: %w", p.Key, err)
+	}
+	d.mu.Lock()
+	if d.written == nil {
+		d.written = make(map[string]string)
+	}
+	d.written[p.Key] = string(b)
+	d.mu.Unlock()
+	return nil
+}
+
+// Withdraw removes the entry for key if this node's announcement is still
+// the current one.
+func (d *Directory) Withdraw(ctx context.Context, key string) error {
+	d.mu.Lock()
+	val, ok := d.written[key]
+	delete(d.written, key)
+	d.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	if _, err := d.Redis.Do(ctx, "EVAL", withdrawScript, "1", d.Prefix+key, val); err != nil {
+		return fmt.Errorf("cluster: withdraw %s: %w", key, err)
+	}
+	return nil
+}
+
+// Lookup returns the presence announced for key, or ErrNotFound.
+func (d *Directory) Lookup(ctx context.Context, key string) (Presence, error) {
+	reply, err := d.Redis.Do(ctx, "GET", d.Prefix+key)
+	if err != nil {
+		return Presence{}, fmt.Errorf("cluster: lookup %s: %w", key, err)
+	}
+	s, ok := reply.(string)
+	if !ok {
+		return Presence{}, ErrNotFound
+	}
+	var p Presence
+	if err := json.Unmarshal([]byte(s), &p); err != nil {
+		return Presence{}, fmt.Errorf("cluster: lookup %s: %w", key, err)
+	}
+	return p, nil
+}
+
+// Close closes the Redis connection.
+func (d *Directory) Close() error { return d.Redis.Close() }
@@ -0,0 +1,217 @@
+package cluster
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRedisTimeout bounds each Redis command, including connecting,
+// when the context has no earlier deadline.
+const DefaultRedisTimeout = 5 * time.Second
+
+// RedisError is an error reply from the Redis server ("-ERR ...").
+type RedisError string
+
+func (e RedisError) Error() string { return "redis: " + string(e) }
+
+// Redis is a minimal Redis client speaking RESP2 over one connection.
+// Commands are sent one at a time; the connection is opened on first use
+// and reopened after an I/O error. Safe for concurrent use.
+type Redis struct {
+	Addr     string      // host:port
+	Username string      // ACL user (Redis 6+); empty for the default user
+	Password string      // sent with AUTH when set
+	DB       int         // selected with SELECT when not 0
+	TLS      *tls.Config // non-nil for rediss://
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// ParseRedisURL returns a client for redis://[[user]:password@]host[:port][/db]
+// or rediss://... (TLS). The port defaults to 6379.
+func ParseRedisURL(rawURL string) (*Redis, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("cluster: parse %q: %w", rawURL, err)
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("cluster: %q: scheme must be redis:// or rediss://", rawURL)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("cluster: %q has no host", rawURL)
+	}
+	r := &Redis{Addr: u.Host}
+	if u.Port() == "" {
+		r.Addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		r.Username = u.User.Username()
+		r.Password, _ = u.User.Password()
+		if _, set := u.User.Password(); !set {
+			// redis://secret@host: a lone user info is the password.
+			r.Username, r.Password = "", u.User.Username()
+		}
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if r.DB, err = strconv.Atoi(db); err != nil || r.DB < 0 {
+			return nil, fmt.Errorf("cluster: %q: database must be a number", rawURL)
+		}
+	}
+	if u.Scheme == "rediss" {
+		r.TLS = &tls.Config{ServerName: u.Hostname()}
+	}
+	return r, nil
+}
+
+// Do sends a command and returns its reply: a string (simple or bulk), an
+// int64, nil for a null bulk string, a []interface{} for an array, or a
+// RedisError.
+func (r *Redis) Do(ctx context.Context, args ...string) (interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	deadline := time.Now().Add(DefaultRedisTimeout)
+	if dl, ok := ctx.Deadline(); ok && dl.Before(deadline) {
+		deadline = dl
+	}
+	if r.conn == nil {
+		if err := r.connect(ctx, deadline); err != nil {
+			return nil, err
+		}
+	}
+	_ = r.conn.SetDeadline(deadline)
+	reply, err := r.roundTrip(args)
+	var rerr RedisError
+	if err != nil && !errors.As(err, &rerr) {
+		r.closeLocked()
+	}
+	return reply, err
+}
+
+// Close closes the connection. The next command reopens it.
+func (r *Redis) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closeLocked()
+}
+
+func (r *Redis) closeLocked() error {
+	if r.conn == nil {
+		return nil
+	}
+	err := r.conn.Close()
+	r.conn, r.r = nil, nil
+	return err
+}
+
+// connect dials the server, authenticates and selects the database.
+func (r *Redis) connect(ctx context.Context, deadline time.Time) error {
+	d := &net.Dialer{Deadline: deadline}
+	var conn net.Conn
+	var err error
+	if r.TLS != nil {
+		conn, err = (&tls.Dialer{NetDialer: d, Config: r.TLS}).DialContext(ctx, "tcp", r.Addr)
+	} else {
+		conn, err = d.DialContext(ctx, "tcp", r.Addr)
+	}
+	if err != nil {
+		return fmt.Errorf("redis: dial %s: %w", r.Addr, err)
+	}
+	r.conn, r.r = conn, bufio.NewReader(conn)
+	_ = conn.SetDeadline(deadline)
+	var setup [][]string
+	switch {
+	case r.Username != "":
+		setup = append(setup, []string{"AUTH", r.Username, r.Password})
+	case r.Password != "":
+		setup = append(setup, []string{"AUTH", r.Password})
+	}
+	if r.DB != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(r.DB)})
+	}
+	for _, cmd := range setup {
+		if _, err := r.roundTrip(cmd); err != nil {
+			r.closeLocked()
+			return fmt.Errorf("redis: %s: %w", cmd[0], err)
+		}
+	}
+	return nil
+}
+
+// roundTrip writes one command and reads its reply.
+func (r *Redis) roundTrip(args []string) (interface{}, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := io.WriteString(r.conn, b.String()); err != nil {
+		return nil, err
+	}
+	return readReply(r.r)
+}
+
+// readReply reads one RESP2 reply.
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply line")
+	}
+	body := line[1:]
+	switch line[0] {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, RedisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis: bad bulk length %q", body)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis: bad array length %q", body)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = readReply(r); err != nil {
+				var rerr RedisError
+				if !errors.As(err, &rerr) {
+					return nil, err
+				}
+				items[i] = rerr
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
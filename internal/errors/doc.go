@@ -19,6 +19,14 @@
 //   - SRTError: SRT protocol layer failures (packet parsing, congestion control)
 //   - TSError: MPEG-TS demux failures (container format issues)
 //
+// CommandError sits outside the hierarchy: it is an RTMP command the server
+// refused (bad stream name, stream not found, authentication failed, ...)
+// and carries the status code and description reported to the client. The
+// rpc package maps every command failure to a reply with it (see
+// rpc.FailureFor): a CommandError is answered and the connection kept,
+// unless its Close field is set; a protocol-layer error is answered where
+// possible and the connection closed.
+//
 // Each error type wraps an underlying cause (the original error from
 // io.Read, JSON parsing, etc.) via the Unwrap() method, enabling
 // error chain inspection in Go 1.13+.
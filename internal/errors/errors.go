@@ -7,6 +7,7 @@ package errors
 //   - ChunkError: problems parsing or serializing chunk-level framing
 //   - AMFError: failures encoding/decoding AMF0 data format
 //   - TimeoutError: operations that exceeded their deadline
+//   - CommandError: a command refused with a status for the client
 //
 // All protocol errors implement the protocolMarker interface, enabling
 // callers to check if any error in a chain is protocol-related via
@@ -101,6 +102,26 @@ func (e *TimeoutError) Error() string {
 }
 func (e *TimeoutError) Unwrap() error { return e.Err }
 
+// CommandError is an RTMP command the server refused or failed to carry
+// out. Code and Description are what the client is told in the command's
+// failure reply (_error or onStatus). It is not a protocol-layer error: it
+// ends the connection only when Close is set.
+type CommandError struct {
+	Op          string // command name (e.g. "publish")
+	Code        string // status code reported to the client (e.g. "NetStream.Publish.BadName")
+	Description string // human-readable description reported to the client
+	Close       bool   // close the connection after the reply
+	Err         error  // underlying cause (may be nil)
+}
+
+func (e *CommandError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("command error: %s: %s", e.Op, e.Code)
+	}
+	return fmt.Sprintf("command error: %s: %s: %v", e.Op, e.Code, e.Err)
+}
+func (e *CommandError) Unwrap() error { return e.Err }
+
 // IsTimeout returns true if err is (or wraps) a TimeoutError, a context deadline exceeded,
 // or any error type that exposes Timeout() bool and returns true.
 func IsTimeout(err error) bool {
@@ -176,6 +197,9 @@ func NewTSError(op string, cause error) error        { return &TSError{Op: op, E
 func NewTimeoutError(op string, d time.Duration, cause error) error {
 	return &TimeoutError{Op: op, Duration: d, Err: cause}
 }
+func NewCommandError(op, code, description string, cause error) error {
+	return &CommandError{Op: op, Code: code, Description: description, Err: cause}
+}
 
 // Usage pattern example:
 //  if _, err := io.ReadFull(r, buf); err != nil {
@@ -203,3 +203,27 @@ func TestNegativePredicates(t *testing.T) {
 		t.Fatalf("plain error shouldn't be timeout")
 	}
 }
+
+// TestCommandError checks that a CommandError carries the client-facing
+// status, unwraps to its cause and is not itself a protocol error.
+func TestCommandError(t *testing.T) {
+	cause := stdErrors.New("publisher already registered")
+	err := NewCommandError("publish", "NetStream.Publish.BadName", "Stream live/x is already being published.", cause)
+	var ce *CommandError
+	if !stdErrors.As(err, &ce) || ce.Code != "NetStream.Publish.BadName" || ce.Close {
+		t.Fatalf("unexpected command error: %#v", err)
+	}
+	if !stdErrors.Is(err, cause) {
+		t.Fatalf("expected errors.Is to find the cause")
+	}
+	if IsProtocolError(err) {
+		t.Fatalf("command error shouldn't be protocol")
+	}
+	if got := err.Error(); got != "command error: publish: NetStream.Publish.BadName: publisher already registered" {
+		t.Fatalf("unexpected message %q", got)
+	}
+	// A refusal caused by a malformed command still reports the protocol error.
+	if !IsProtocolError(NewCommandError("play", "NetStream.Play.Failed", "Invalid play command.", NewProtocolError("play.parse", nil))) {
+		t.Fatalf("expected wrapped protocol error to be found")
+	}
+}
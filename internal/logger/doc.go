@@ -28,6 +28,16 @@
 //
 // This is useful for temporary debugging or responding to admin commands.
 //
+// # Per-Component Levels
+//
+// Loggers tagged with a "component" attribute can be given their own level,
+// overriding the global one:
+//
+//	logger.SetComponentLevels("rtmp_server=warn,dispatcher=debug")
+//
+// Per-packet debug logs (one per media message) go through a Sampler, so only
+// one in DebugSampling() of them is written (SetDebugSampling, default 100).
+//
 // # Integration with Global slog
 //
 // The logger is installed as the global slog.Logger via slog.SetDefault(),
@@ -37,7 +47,8 @@
 //
 // # Output Format
 //
-// All messages are JSON objects with these standard fields:
+// Output is JSON by default; SetFormat(FormatText) switches to slog's
+// key=value text format. JSON messages are objects with these standard fields:
 //   - time: RFC3339 timestamp with nanoseconds
 //   - level: log level (debug, info, warn, error)
 //   - msg: message text
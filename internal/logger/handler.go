@@ -0,0 +1,161 @@
+// File: handler.go
+// Purpose: Per-component log levels and sampling of high-volume debug logs.
+//
+// Every logger built from the global one goes through componentHandler. It
+// remembers the "component" attribute attached with With (e.g.
+// logger.Logger().With("component", "rtmp_server")) and filters records by
+// that component's level override, falling back to the global level.
+//
+// Key Types:
+//   - componentHandler: slog.Handler wrapper applying component levels
+//   - Sampler: Lets one in every N per-packet debug logs through
+package logger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// DefaultDebugSampling is how many per-packet debug events are represented
+// by each one logged, unless SetDebugSampling says otherwise.
+const DefaultDebugSampling = 100
+
+var (
+	// componentLevels maps a component name to its level override. Replaced
+	// wholesale by SetComponentLevels; nil means no overrides.
+	componentLevels atomic.Pointer[map[string]slog.Level]
+
+	debugSampling atomic.Int64
+)
+
+func init() { debugSampling.Store(DefaultDebugSampling) }
+
+// componentHandler filters records by the level of the component the
+// logger belongs to. Level filtering happens only here; the wrapped handler
+// is built to accept everything.
+type componentHandler struct {
+	inner     slog.Handler
+	component string // last "component" attribute attached; "" if none
+}
+
+func (h *componentHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= levelFor(h.component)
+}
+
+func (h *componentHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.inner.Handle(ctx, r)
+}
+
+func (h *componentHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	component := h.component
+	for _, a := range attrs {
+		if a.Key == "component" {
+			component = a.Value.String()
+		}
+	}
+	return &componentHandler{inner: h.inner.WithAttrs(attrs), component: component}
+}
+
+func (h *componentHandler) WithGroup(name string) slog.Handler {
+	return &componentHandler{inner: h.inner.WithGroup(name), component: h.component}
+}
+
+// levelFor returns the minimum level logged for component.
+func levelFor(component string) slog.Level {
+	if component != "" {
+		if m := componentLevels.Load(); m != nil {
+			if lvl, ok := (*m)[component]; ok {
+				return lvl
+			}
+		}
+	}
+	return atomicLevel.Level()
+}
+
+// SetComponentLevels sets per-component level overrides from a spec such
+// as "rtmp_server=warn,dispatcher=debug", replacing any previous ones.
+// Components are matched against the "component" attribute of a logger;
+// components without an override follow the global level. An empty spec
+// clears all overrides.
+func SetComponentLevels(spec string) error {
+	levels, err := ParseComponentLevels(spec)
+	if err != nil {
+		return err
+	}
+	if len(levels) == 0 {
+		componentLevels.Store(nil)
+		return nil
+	}
+	componentLevels.Store(&levels)
+	return nil
+}
+
+// ParseComponentLevels parses a SetComponentLevels spec.
+func ParseComponentLevels(spec string) (map[string]slog.Level, error) {
+	levels := make(map[string]slog.Level)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, level, ok := strings.Cut(part, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid component level %q (expected component=level)", part)
+		}
+		lvl, ok := parseLevel(level)
+		if !ok || strings.TrimSpace(level) == "" {
+			return nil, errors.New("invalid log level for " + name + ": " + level)
+		}
+		levels[name] = lvl
+	}
+	return levels, nil
+}
+
+// ComponentLevels returns the current overrides as a spec, sorted by
+// component ("" when there are none).
+func ComponentLevels() string {
+	m := componentLevels.Load()
+	if m == nil {
+		return ""
+	}
+	parts := make([]string, 0, len(*m))
+	for name, lvl := range *m {
+		parts = append(parts, name+"="+strings.ToLower(lvl.String()))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+// SetDebugSampling sets how many per-packet debug events each logged one
+// stands for: 1 logs every event, 100 one in a hundred. Values below 1 are
+// treated as 1.
+func SetDebugSampling(every int) {
+	if every < 1 {
+		every = 1
+	}
+	debugSampling.Store(int64(every))
+}
+
+// DebugSampling returns the current sampling rate (see SetDebugSampling).
+func DebugSampling() int { return int(debugSampling.Load()) }
+
+// Sampler thins out a stream of high-volume debug events, such as one per
+// media packet, to one in every DebugSampling. The first event is always
+// let through. The zero value is ready to use and safe for concurrent use.
+//
+//	if log.Enabled(ctx, slog.LevelDebug) && s.packetLogs.Allow() {
+//	    log.Debug("Video packet", ..., "sampled", logger.DebugSampling())
+//	}
+type Sampler struct{ n atomic.Uint64 }
+
+// Allow reports whether this event should be logged.
+func (s *Sampler) Allow() bool {
+	every := uint64(debugSampling.Load())
+	return (s.n.Add(1)-1)%every == 0
+}
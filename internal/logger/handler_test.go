@@ -0,0 +1,88 @@
+// handler_test.go – tests for per-component levels, the text format and
+// debug sampling.
+package logger
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestComponentLevels checks that an override applies to loggers carrying
+// that component, including ones derived from them, and that others keep
+// following the global level.
+func TestComponentLevels(t *testing.T) {
+	var buf bytes.Buffer
+	UseWriter(&buf)
+	if err := SetLevel("info"); err != nil {
+		t.Fatalf("SetLevel: %v", err)
+	}
+	if err := SetComponentLevels("chatty=warn, dispatcher=debug"); err != nil {
+		t.Fatalf("SetComponentLevels: %v", err)
+	}
+	t.Cleanup(func() { _ = SetComponentLevels("") })
+	if got := ComponentLevels(); got != "chatty=warn,dispatcher=debug" {
+		t.Fatalf("ComponentLevels() = %q", got)
+	}
+
+	chatty := Logger().With("component", "chatty").With("conn_id", "c1")
+	dispatcher := Logger().With("component", "dispatcher")
+	other := Logger().With("component", "other")
+	chatty.Info("chatty info")    // below warn → dropped
+	chatty.Warn("chatty warn")    // kept
+	dispatcher.Debug("rpc debug") // override lowers to debug → kept
+	other.Debug("other debug")    // global info → dropped
+	other.Info("other info")      // kept
+
+	var msgs []string
+	for _, r := range decodeLines(t, &buf) {
+		msgs = append(msgs, r["msg"].(string))
+	}
+	if got, want := strings.Join(msgs, ","), "chatty warn,rpc debug,other info"; got != want {
+		t.Fatalf("logged %q, want %q", got, want)
+	}
+
+	for _, bad := range []string{"chatty", "=warn", "chatty=loud", "chatty="} {
+		if err := SetComponentLevels(bad); err == nil {
+			t.Errorf("SetComponentLevels(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestSetFormatText(t *testing.T) {
+	var buf bytes.Buffer
+	UseWriter(&buf)
+	if err := SetFormat(FormatText); err != nil {
+		t.Fatalf("SetFormat: %v", err)
+	}
+	t.Cleanup(func() { _ = SetFormat(FormatJSON) })
+	Info("text message", "stream_key", "live/test")
+	if out := buf.String(); !strings.Contains(out, `msg="text message"`) || !strings.Contains(out, "stream_key=live/test") {
+		t.Fatalf("text output = %q", out)
+	}
+	if err := SetFormat("xml"); err == nil {
+		t.Fatal("SetFormat(xml) succeeded, want error")
+	}
+}
+
+func TestSampler(t *testing.T) {
+	SetDebugSampling(10)
+	t.Cleanup(func() { SetDebugSampling(DefaultDebugSampling) })
+	var s Sampler
+	allowed := 0
+	for i := 0; i < 100; i++ {
+		if s.Allow() {
+			if i%10 != 0 {
+				t.Fatalf("event %d allowed, want every 10th from the first", i)
+			}
+			allowed++
+		}
+	}
+	if allowed != 10 {
+		t.Fatalf("allowed %d of 100 events, want 10", allowed)
+	}
+	SetDebugSampling(0)
+	if !s.Allow() || !s.Allow() {
+		t.Fatal("sampling 0 should let every event through")
+	}
+}
@@ -1,8 +1,8 @@
 // File: logger.go
 // Purpose: Implements the global logger initialization and lifecycle.
-// This file sets up the slog.Logger with JSON output, detects the initial log level
-// from command-line flags or environment variables, and provides helper functions
-// to change the log level at runtime.
+// This file sets up the slog.Logger with JSON (or text) output, detects the initial
+// log level from command-line flags or environment variables, and provides helper
+// functions to change the log level and output format at runtime.
 //
 // Key Types:
 //   - dynamicLevel: Implements slog.Leveler with atomic read/write for runtime changes
@@ -13,6 +13,8 @@
 //   - parseLevel(): Convert string "debug"/"info"/etc to slog.Level
 //   - Default(): Get the global logger instance
 //   - SetLevel(level): Change log level at runtime
+//   - SetFormat(format): Switch between JSON and text output
+//   - SetComponentLevels(spec): Per-component level overrides (handler.go)
 //
 // Dependencies:
 //   - log/slog: Go's standard structured logging package
@@ -26,6 +28,7 @@ import (
 	"flag"
 	"io"
 	"log/slog"
+	"math"
 	"os"
 	"strings"
 	"sync"
@@ -44,11 +47,23 @@ var (
 	initOnce   sync.Once
 	writerOnce sync.Once
 
+	// Output destination and format, guarded by outMu. Changing either
+	// rebuilds the global logger.
+	outMu     sync.Mutex
+	output    io.Writer = os.Stdout
+	outFormat           = FormatJSON
+
 	// Optional flag (users may pass -log.level=debug). If flags.Parse() hasn't
 	// yet been called when Init is invoked, we still read the raw os.Args.
 	flagLevel = flag.String("log.level", "", "log level (debug, info, warn, error)")
 )
 
+// Output formats accepted by SetFormat.
+const (
+	FormatJSON = "json" // one JSON object per line (default), for log shippers
+	FormatText = "text" // slog's key=value text format, for reading in a terminal
+)
+
 // dynamicLevel is an atomic Leveler.
 type dynamicLevel struct{ v int64 }
 
@@ -61,7 +76,9 @@ func Init() {
 	initOnce.Do(func() {
 		lvl := detectLevel()
 		atomicLevel.set(lvl)
-		global = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: atomicLevel}))
+		outMu.Lock()
+		global = slog.New(newHandler(output, outFormat))
+		outMu.Unlock()
 		// Set as slog default so any code using slog.Default() (e.g., the
 		// SRT listener) gets the same configured logger with the right level.
 		slog.SetDefault(global)
@@ -129,10 +146,49 @@ func Level() string {
 	return atomicLevel.Level().String()
 }
 
-// UseWriter swaps the output writer (intended for tests). Retains current level.
+// UseWriter swaps the output writer (intended for tests). Retains current
+// level and format.
 func UseWriter(w io.Writer) {
 	Init()
-	global = slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: atomicLevel}))
+	outMu.Lock()
+	defer outMu.Unlock()
+	output = w
+	global = slog.New(newHandler(output, outFormat))
+}
+
+// SetFormat switches the output format to FormatJSON or FormatText. Like
+// UseWriter it replaces the global logger, so call it at startup, before
+// components derive their loggers from it.
+func SetFormat(format string) error {
+	Init()
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format != FormatJSON && format != FormatText {
+		return errors.New("invalid log format: " + format)
+	}
+	outMu.Lock()
+	outFormat = format
+	global = slog.New(newHandler(output, outFormat))
+	outMu.Unlock()
+	slog.SetDefault(global)
+	return nil
+}
+
+// Format returns the current output format.
+func Format() string {
+	outMu.Lock()
+	defer outMu.Unlock()
+	return outFormat
+}
+
+// newHandler builds the handler for w in format. Levels are applied by
+// componentHandler, so the inner handler accepts everything.
+func newHandler(w io.Writer, format string) slog.Handler {
+	opts := &slog.HandlerOptions{Level: slog.Level(math.MinInt32)}
+	var inner slog.Handler = slog.NewJSONHandler(w, opts)
+	if format == FormatText {
+		inner = slog.NewTextHandler(w, opts)
+	}
+	return &componentHandler{inner: inner}
 }
 
 // Logger returns the global logger (ensures Init was called).
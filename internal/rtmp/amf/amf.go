@@ -7,11 +7,11 @@ package amf
 // string, null, object, strict array) in their respective files.
 // The generic encoder dispatches on Go value types. The generic decoder reads
 // the leading marker byte and dispatches to the appropriate type‑specific
-// decoder. Unsupported markers (0x06 Undefined, 0x07 Reference, 0x0B+ future /
-// AMF3 types) are rejected with an *errors.AMFError.
+// decoder. Unsupported markers (0x06 Undefined, 0x07 Reference, 0x0D+ AMF3
+// and reserved types) are rejected with an *errors.AMFError.
 //
 // Supported markers here: 0x00 Number, 0x01 Boolean, 0x02 String, 0x03 Object,
-// 0x05 Null, 0x08 ECMA Array, 0x0A Strict Array.
+// 0x05 Null, 0x08 ECMA Array, 0x0A Strict Array, 0x0B Date, 0x0C Long String.
 
 import (
 	"bytes"
@@ -27,10 +27,11 @@ import (
 //	nil -> Null (0x05)
 //	float64 -> Number (0x00)
 //	bool -> Boolean (0x01)
-//	string -> String (0x02)
+//	string -> String (0x02), or Long String (0x0C) above 65535 bytes
 //	map[string]interface{} -> Object (0x03)
 //	ECMAArray -> ECMA Array (0x08)
 //	[]interface{} -> Strict Array (0x0A)
+//	time.Time -> Date (0x0B)
 //
 // Any other type results in *errors.AMFError.
 func EncodeValue(w io.Writer, v interface{}) error {
@@ -57,6 +58,16 @@ func EncodeAll(values ...interface{}) ([]byte, error) {
 // byte and dispatches to the concrete decoder. Returned interface{} will be one
 // of the supported Go types listed in EncodeValue docs.
 func DecodeValue(r io.Reader) (interface{}, error) {
+	return decodeValue(r, 0)
+}
+
+// maxNestingDepth bounds how deeply objects and arrays may nest. Real RTMP
+// payloads rarely exceed 3-4 levels; the limit stops a hostile peer from
+// exhausting the goroutine stack with a payload of nested 0x03/0x0A markers.
+const maxNestingDepth = 64
+
+// decodeValue is DecodeValue with the current container nesting depth.
+func decodeValue(r io.Reader, depth int) (interface{}, error) {
 	var marker [1]byte
 	if _, err := io.ReadFull(r, marker[:]); err != nil {
 		return nil, amferrors.NewAMFError("decode.value.marker.read", err)
@@ -64,8 +75,8 @@ func DecodeValue(r io.Reader) (interface{}, error) {
 	// Dispatch to helper which decodes the payload directly after the
 	// marker has been consumed (no intermediate reader allocation).
 	switch marker[0] {
-	case markerNumber, markerBoolean, markerString, markerNull, markerObject, markerECMAArray, markerStrictArray:
-		v, err := decodeValueWithMarker(marker[0], r)
+	case markerNumber, markerBoolean, markerString, markerNull, markerObject, markerECMAArray, markerStrictArray, markerDate, markerLongString:
+		v, err := decodeValueWithMarker(marker[0], r, depth)
 		if err != nil {
 			return nil, amferrors.NewAMFError("decode.value.dispatch", err)
 		}
@@ -100,7 +111,7 @@ func unsupportedMarker(m byte) bool {
 	if m == 0x06 || m == 0x07 { // Undefined, Reference
 		return true
 	}
-	if m >= 0x0B { // Date (0x0B) and anything above (AMF3 etc) out of scope / rejected
+	if m >= 0x0D { // Unsupported (0x0D), RecordSet, XML, Typed Object, AMF3 switch
 		return true
 	}
 	return false
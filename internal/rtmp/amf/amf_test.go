@@ -16,7 +16,9 @@ package amf
 import (
 	"bytes"
 	"fmt"
+	"strings"
 	"testing"
+	"time"
 )
 
 // TestEncodeDecodeRoundTrip_Primitives encodes each AMF0 value, then decodes
@@ -30,6 +32,8 @@ import (
 //   - nil (AMF0 Null)
 //   - map[string]interface{} (AMF0 Object)
 //   - []interface{} (AMF0 Strict Array)
+//   - time.Time (AMF0 Date)
+//   - string longer than 65535 bytes (AMF0 Long String)
 //   - Nested combinations of the above
 func TestEncodeDecodeRoundTrip_Primitives(t *testing.T) {
 	cases := []interface{}{
@@ -44,6 +48,9 @@ func TestEncodeDecodeRoundTrip_Primitives(t *testing.T) {
 		[]interface{}{float64(1), "x", false, nil},
 		map[string]interface{}{"nested": map[string]interface{}{"n": float64(42)}},
 		[]interface{}{[]interface{}{float64(1), float64(2)}, map[string]interface{}{"k": "v"}},
+		time.UnixMilli(1700000000123).UTC(),
+		strings.Repeat("L", 70000),
+		map[string]interface{}{"created": time.UnixMilli(0).UTC(), "blob": strings.Repeat("x", 0x10000)},
 	}
 	for i, v := range cases {
 		t.Run(fmt.Sprintf("case_%d", i), func(t *testing.T) {
@@ -96,13 +103,13 @@ func TestEncodeAllDecodeAll_Sequence(t *testing.T) {
 
 // TestDecodeValue_UnsupportedMarkers ensures that AMF0 marker bytes this
 // implementation intentionally does not support (Undefined 0x06, Reference
-// 0x07, Date 0x0B, AMF3-switch 0x11) return a clear error.
+// 0x07, Unsupported 0x0D, AMF3-switch 0x11) return a clear error.
 //
 // Production RTMP clients (FFmpeg, OBS) never send these markers, so
 // rejecting them is the safest path.
 func TestDecodeValue_UnsupportedMarkers(t *testing.T) {
-	// Markers explicitly rejected: 0x06 (Undefined), 0x07 (Reference), 0x0B (Date), 0x11 (AMF3 switch)
-	markers := []byte{0x06, 0x07, 0x0B, 0x11}
+	// Markers explicitly rejected: 0x06 (Undefined), 0x07 (Reference), 0x0D (Unsupported), 0x11 (AMF3 switch)
+	markers := []byte{0x06, 0x07, 0x0D, 0x11}
 	for _, m := range markers {
 		t.Run(fmt.Sprintf("marker_0x%02x", m), func(t *testing.T) {
 			_, err := DecodeValue(bytes.NewReader([]byte{m}))
@@ -130,6 +137,9 @@ func deepEqual(a, b interface{}) bool {
 	case string:
 		bv, ok := b.(string)
 		return ok && av == bv
+	case time.Time:
+		bv, ok := b.(time.Time)
+		return ok && av.Equal(bv)
 	case map[string]interface{}:
 		bv, ok := b.(map[string]interface{})
 		if !ok {
@@ -48,7 +48,7 @@ func DecodeStrictArray(r io.Reader) ([]interface{}, error) {
 	if marker[0] != markerStrictArray {
 		return nil, amferrors.NewAMFError("decode.array.marker", fmt.Errorf("expected 0x%02x got 0x%02x", markerStrictArray, marker[0]))
 	}
-	return decodeStrictArrayPayload(r)
+	return decodeStrictArrayPayload(r, 1)
 }
 
 // roundTripStrictArray is a helper for tests: encode then decode an array for round-trip verification.
@@ -135,6 +135,34 @@ func TestStrictArray_RoundTrip_VariedTypes(t *testing.T) {
 	}
 }
 
+// TestDecodeStrictArray_HostileInput verifies that a bogus element count does
+// not trigger a large preallocation and that nesting beyond maxNestingDepth is
+// rejected instead of recursing without bound.
+func TestDecodeStrictArray_HostileInput(t *testing.T) {
+	t.Run("huge_count", func(t *testing.T) {
+		data := []byte{markerStrictArray, 0xFF, 0xFF, 0xFF, 0xFF, 0x05}
+		if _, err := DecodeStrictArray(bytes.NewReader(data)); err == nil {
+			t.Fatalf("expected error for truncated array with huge count")
+		}
+	})
+	t.Run("nesting_limit", func(t *testing.T) {
+		nest := func(n int) []byte {
+			var buf bytes.Buffer
+			for i := 0; i < n; i++ {
+				buf.Write([]byte{markerStrictArray, 0x00, 0x00, 0x00, 0x01})
+			}
+			buf.WriteByte(markerNull)
+			return buf.Bytes()
+		}
+		if _, err := DecodeAll(nest(maxNestingDepth)); err != nil {
+			t.Fatalf("depth %d should decode: %v", maxNestingDepth, err)
+		}
+		if _, err := DecodeAll(nest(maxNestingDepth + 1)); err == nil {
+			t.Fatalf("depth %d should be rejected", maxNestingDepth+1)
+		}
+	})
+}
+
 // --- Benchmarks ---
 
 // BenchmarkEncodeStrictArray benchmarks encoding a mixed-type array.
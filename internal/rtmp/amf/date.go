@@ -0,0 +1,62 @@
+package amf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	amferrors "github.com/alxayo/go-rtmp/internal/errors"
+)
+
+// markerDate is the AMF0 type marker for Date (0x0B).
+// Wire format: 0x0B | 8-byte IEEE754 double (milliseconds since Unix epoch) |
+// 2-byte signed time zone offset (reserved; written as 0, ignored on decode).
+const markerDate = 0x0B
+
+// EncodeDate writes an AMF0 Date to w. The time is encoded with millisecond
+// precision in UTC; the reserved time zone field is always 0.
+func EncodeDate(w io.Writer, t time.Time) error {
+	var buf [1 + 8 + 2]byte
+	buf[0] = markerDate
+	binary.BigEndian.PutUint64(buf[1:9], math.Float64bits(float64(t.UnixMilli())))
+	if _, err := w.Write(buf[:]); err != nil {
+		return amferrors.NewAMFError("encode.date.write", err)
+	}
+	return nil
+}
+
+// DecodeDate reads an AMF0 Date (marker 0x0B) from r and returns it as a UTC
+// time.Time.
+//
+// Error cases:
+//   - Unexpected marker -> decode.date.marker
+//   - Short reads -> decode.date.marker.read / decode.date.read
+//   - NaN, infinite or out-of-range timestamps -> decode.date.range
+func DecodeDate(r io.Reader) (time.Time, error) {
+	var m [1]byte
+	if _, err := io.ReadFull(r, m[:]); err != nil {
+		return time.Time{}, amferrors.NewAMFError("decode.date.marker.read", err)
+	}
+	if m[0] != markerDate {
+		return time.Time{}, amferrors.NewAMFError("decode.date.marker", fmt.Errorf("expected 0x%02x got 0x%02x", markerDate, m[0]))
+	}
+	return decodeDatePayload(r)
+}
+
+// decodeDatePayload reads the 10-byte Date payload after the marker has
+// already been consumed.
+func decodeDatePayload(r io.Reader) (time.Time, error) {
+	var buf [8 + 2]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return time.Time{}, amferrors.NewAMFError("decode.date.read", err)
+	}
+	ms := math.Float64frombits(binary.BigEndian.Uint64(buf[:8]))
+	// ±2^53 ms keeps the value exactly representable and well inside
+	// time.Time's range; anything beyond is not a real date.
+	if math.IsNaN(ms) || math.Abs(ms) > 1<<53 {
+		return time.Time{}, amferrors.NewAMFError("decode.date.range", fmt.Errorf("invalid date value %v", ms))
+	}
+	return time.UnixMilli(int64(ms)).UTC(), nil
+}
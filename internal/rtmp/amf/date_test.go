@@ -0,0 +1,84 @@
+// date_test.go – tests for the AMF0 Date type.
+//
+// AMF0 dates are encoded as: 1 marker byte (0x0B) + 8-byte big-endian double
+// holding milliseconds since the Unix epoch + 2-byte reserved time zone.
+// These tests verify the wire layout, round-trip precision and error paths.
+package amf
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+)
+
+// TestEncodeDate_WireFormat checks marker, payload and zero time zone for a
+// known timestamp (2009-02-13T23:31:30.123Z = 1234567890123 ms).
+func TestEncodeDate_WireFormat(t *testing.T) {
+	in := time.UnixMilli(1234567890123)
+	var buf bytes.Buffer
+	if err := EncodeDate(&buf, in); err != nil {
+		t.Fatalf("EncodeDate error: %v", err)
+	}
+	want := []byte{0x0B, 0x42, 0x71, 0xF7, 0x1F, 0xB0, 0x4C, 0xB0, 0x00, 0x00, 0x00}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("encoded mismatch\n got: %x\nwant: %x", buf.Bytes(), want)
+	}
+}
+
+// TestDate_RoundTrip verifies millisecond precision survives encode/decode and
+// that sub-millisecond precision is truncated.
+func TestDate_RoundTrip(t *testing.T) {
+	in := time.Date(2024, 5, 1, 12, 30, 45, 678_900_000, time.FixedZone("X", 3600))
+	var buf bytes.Buffer
+	if err := EncodeDate(&buf, in); err != nil {
+		t.Fatalf("EncodeDate error: %v", err)
+	}
+	out, err := DecodeDate(&buf)
+	if err != nil {
+		t.Fatalf("DecodeDate error: %v", err)
+	}
+	if want := in.Truncate(time.Millisecond); !out.Equal(want) {
+		t.Fatalf("round trip mismatch: got %v want %v", out, want)
+	}
+	if out.Location() != time.UTC {
+		t.Fatalf("expected UTC location, got %v", out.Location())
+	}
+}
+
+// TestDecodeValue_Date checks generic dispatch returns a time.Time.
+func TestDecodeValue_Date(t *testing.T) {
+	data, err := EncodeAll(time.UnixMilli(0))
+	if err != nil {
+		t.Fatalf("EncodeAll error: %v", err)
+	}
+	v, err := DecodeValue(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("DecodeValue error: %v", err)
+	}
+	if tv, ok := v.(time.Time); !ok || tv.UnixMilli() != 0 {
+		t.Fatalf("expected epoch time.Time, got %#v", v)
+	}
+}
+
+// TestDecodeDate_Errors covers marker mismatch, truncation and NaN payloads.
+func TestDecodeDate_Errors(t *testing.T) {
+	nan := make([]byte, 11)
+	nan[0] = markerDate
+	bits := math.Float64bits(math.NaN())
+	for i := 0; i < 8; i++ {
+		nan[1+i] = byte(bits >> (56 - 8*i))
+	}
+	cases := map[string][]byte{
+		"invalid_marker": {0x00, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+		"truncated":      {0x0B, 0x42, 0x71},
+		"nan":            nan,
+	}
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := DecodeDate(bytes.NewReader(data)); err == nil {
+				t.Fatalf("expected error")
+			}
+		})
+	}
+}
@@ -12,7 +12,12 @@
 //   - String (marker 0x02): UTF-8 string with 2-byte length prefix (max 65535 bytes).
 //   - Object (marker 0x03): Key-value pairs terminated by 0x00 0x00 0x09.
 //   - Null (marker 0x05): No payload.
+//   - ECMA Array (marker 0x08): Advisory 4-byte count, then key-value pairs like Object.
 //   - Strict Array (marker 0x0A): 4-byte element count followed by values.
+//   - Date (marker 0x0B): Milliseconds since the Unix epoch as a double, plus a
+//     reserved 2-byte time zone. Decoded as a UTC time.Time.
+//   - Long String (marker 0x0C): UTF-8 string with 4-byte length prefix. Used
+//     automatically when encoding strings longer than 65535 bytes.
 //
 // # Usage
 //
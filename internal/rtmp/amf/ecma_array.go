@@ -84,19 +84,19 @@ func DecodeECMAArray(r io.Reader) (map[string]interface{}, error) {
 	if mMarker[0] != markerECMAArray {
 		return nil, amferrors.NewAMFError("decode.ecma_array.marker", fmt.Errorf("expected 0x%02x got 0x%02x", markerECMAArray, mMarker[0]))
 	}
-	return decodeECMAArrayPayload(r)
+	return decodeECMAArrayPayload(r, 1)
 }
 
 // decodeECMAArrayPayload reads an AMF0 ECMA Array payload after the marker
 // has already been consumed. It reads the advisory count, then delegates to
 // decodeObjectPayload for the key-value pairs and end marker.
-func decodeECMAArrayPayload(r io.Reader) (map[string]interface{}, error) {
+func decodeECMAArrayPayload(r io.Reader, depth int) (map[string]interface{}, error) {
 	// Read and discard the advisory count — we rely on the end marker.
 	var countBuf [4]byte
 	if _, err := io.ReadFull(r, countBuf[:]); err != nil {
 		return nil, amferrors.NewAMFError("decode.ecma_array.count.read", err)
 	}
-	return decodeObjectPayload(r)
+	return decodeObjectPayload(r, depth)
 }
 
 // roundTripECMAArray is a helper for tests: encode then decode for round-trip verification.
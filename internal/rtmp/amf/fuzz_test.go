@@ -0,0 +1,51 @@
+// fuzz_test.go – native Go fuzz harness for the AMF0 decoder.
+//
+// Command and data message payloads are AMF0 encoded by the peer, so DecodeAll
+// must reject malformed input with an error rather than panic, recurse
+// without bound, or allocate based on untrusted length fields. Run with:
+//
+//	go test ./internal/rtmp/amf -fuzz=FuzzDecodeAll
+package amf
+
+import (
+	"bytes"
+	"testing"
+)
+
+func FuzzDecodeAll(f *testing.F) {
+	connect, _ := EncodeAll("connect", 1.0, map[string]interface{}{
+		"app":         "live",
+		"tcUrl":       "rtmp://localhost/live",
+		"audioCodecs": 3575.0,
+	})
+	f.Add(connect)
+	meta, _ := EncodeAll("@setDataFrame", "onMetaData", ECMAArray{"width": 1280.0, "height": 720.0})
+	f.Add(meta)
+	arr, _ := EncodeAll([]interface{}{1.0, "two", nil, true, []interface{}{}})
+	f.Add(arr)
+	f.Add([]byte{0x0A, 0xFF, 0xFF, 0xFF, 0xFF})                    // strict array with huge count
+	f.Add(bytes.Repeat([]byte{0x0A, 0x00, 0x00, 0x00, 0x01}, 200)) // deeply nested arrays
+	f.Add(bytes.Repeat([]byte{0x03, 0x00, 0x01, 'k'}, 200))        // deeply nested objects
+	f.Add([]byte{0x02, 0xFF, 0xFF, 'x'})
+	f.Add([]byte{0x0B, 0x42, 0x71, 0xF7, 0x1F, 0xB0, 0x4C, 0xB0, 0x00, 0x00, 0x00}) // date
+	f.Add([]byte{0x0C, 0xFF, 0xFF, 0xFF, 0xFF, 'y'})                                // long string with huge length
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		vals, err := DecodeAll(data)
+		if err != nil {
+			return
+		}
+		// Whatever decodes must encode again and decode to the same shape.
+		enc, err := EncodeAll(vals...)
+		if err != nil {
+			t.Fatalf("re-encode failed: %v", err)
+		}
+		again, err := DecodeAll(enc)
+		if err != nil {
+			t.Fatalf("re-decode failed: %v", err)
+		}
+		if len(again) != len(vals) {
+			t.Fatalf("round trip changed value count: %d != %d", len(again), len(vals))
+		}
+	})
+}
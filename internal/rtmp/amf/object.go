@@ -6,6 +6,7 @@ import (
 	"io"
 	"math"
 	"sort"
+	"time"
 
 	amferrors "github.com/alxayo/go-rtmp/internal/errors"
 )
@@ -26,8 +27,11 @@ const (
 //   - nil -> Null
 //   - float64 -> Number
 //   - bool -> Boolean
-//   - string -> String
+//   - string -> String (Long String when longer than 65535 bytes)
+//   - time.Time -> Date
 //   - map[string]interface{} -> Object
+//   - ECMAArray -> ECMA Array
+//   - []interface{} -> Strict Array
 //
 // Unsupported types result in an *errors.AMFError.
 func EncodeObject(w io.Writer, m map[string]interface{}) error {
@@ -78,7 +82,8 @@ func EncodeObject(w io.Writer, m map[string]interface{}) error {
 }
 
 // encodeAny is an internal dispatcher for the AMF0 types supported by this package:
-// Number, Boolean, String, Null, Object, ECMA Array, and Strict Array.
+// Number, Boolean, String, Long String, Null, Object, ECMA Array, Strict Array
+// and Date.
 func encodeAny(w io.Writer, v interface{}) error {
 	switch vv := v.(type) {
 	case nil:
@@ -88,7 +93,12 @@ func encodeAny(w io.Writer, v interface{}) error {
 	case bool:
 		return EncodeBoolean(w, vv)
 	case string:
+		if len(vv) > 0xFFFF {
+			return EncodeLongString(w, vv)
+		}
 		return EncodeString(w, vv)
+	case time.Time:
+		return EncodeDate(w, vv)
 	case map[string]interface{}:
 		return EncodeObject(w, vv)
 	case ECMAArray:
@@ -110,13 +120,19 @@ func DecodeObject(r io.Reader) (map[string]interface{}, error) {
 	if mMarker[0] != markerObject {
 		return nil, amferrors.NewAMFError("decode.object.marker", fmt.Errorf("expected 0x%02x got 0x%02x", markerObject, mMarker[0]))
 	}
-	return decodeObjectPayload(r)
+	return decodeObjectPayload(r, 1)
 }
 
 // decodeValueWithMarker dispatches based on an already-consumed marker byte.
 // It reads the remaining payload from r without re-reading the marker, avoiding
 // the allocation overhead of io.MultiReader.
-func decodeValueWithMarker(marker byte, r io.Reader) (interface{}, error) {
+func decodeValueWithMarker(marker byte, r io.Reader, depth int) (interface{}, error) {
+	switch marker {
+	case markerObject, markerECMAArray, markerStrictArray:
+		if depth >= maxNestingDepth {
+			return nil, amferrors.NewAMFError("decode.nesting", fmt.Errorf("nesting depth exceeds %d", maxNestingDepth))
+		}
+	}
 	switch marker {
 	case markerNumber:
 		var num [8]byte
@@ -136,11 +152,15 @@ func decodeValueWithMarker(marker byte, r io.Reader) (interface{}, error) {
 	case markerNull:
 		return nil, nil // null has no payload beyond the marker
 	case markerObject:
-		return decodeObjectPayload(r)
+		return decodeObjectPayload(r, depth+1)
 	case markerECMAArray:
-		return decodeECMAArrayPayload(r)
+		return decodeECMAArrayPayload(r, depth+1)
 	case markerStrictArray:
-		return decodeStrictArrayPayload(r)
+		return decodeStrictArrayPayload(r, depth+1)
+	case markerDate:
+		return decodeDatePayload(r)
+	case markerLongString:
+		return decodeLongStringPayload(r)
 	default:
 		return nil, fmt.Errorf("unsupported marker 0x%02x", marker)
 	}
@@ -166,7 +186,7 @@ func decodeStringPayload(r io.Reader) (string, error) {
 
 // decodeObjectPayload reads an AMF0 object payload (key-value pairs + end marker)
 // after the object marker has already been consumed.
-func decodeObjectPayload(r io.Reader) (map[string]interface{}, error) {
+func decodeObjectPayload(r io.Reader, depth int) (map[string]interface{}, error) {
 	out := make(map[string]interface{})
 	for {
 		var klenBuf [2]byte
@@ -191,7 +211,7 @@ func decodeObjectPayload(r io.Reader) (map[string]interface{}, error) {
 		key := string(keyBytes)
 
 		// Decode the value (reads marker internally).
-		val, err := DecodeValue(r)
+		val, err := decodeValue(r, depth)
 		if err != nil {
 			return nil, amferrors.NewAMFError("decode.object.value", fmt.Errorf("key '%s': %w", key, err))
 		}
@@ -200,17 +220,22 @@ func decodeObjectPayload(r io.Reader) (map[string]interface{}, error) {
 	return out, nil
 }
 
+// maxArrayPrealloc caps the initial capacity of decoded strict arrays.
+const maxArrayPrealloc = 64
+
 // decodeStrictArrayPayload reads an AMF0 strict array payload (count + elements)
 // after the array marker has already been consumed.
-func decodeStrictArrayPayload(r io.Reader) ([]interface{}, error) {
+func decodeStrictArrayPayload(r io.Reader, depth int) ([]interface{}, error) {
 	var countBuf [4]byte
 	if _, err := io.ReadFull(r, countBuf[:]); err != nil {
 		return nil, amferrors.NewAMFError("decode.array.count.read", err)
 	}
 	count := binary.BigEndian.Uint32(countBuf[:])
-	out := make([]interface{}, 0, count)
+	// count is peer-supplied; cap the preallocation so a bogus count cannot
+	// force a huge allocation before any element has been read.
+	out := make([]interface{}, 0, min(count, maxArrayPrealloc))
 	for i := uint32(0); i < count; i++ {
-		val, err := DecodeValue(r)
+		val, err := decodeValue(r, depth)
 		if err != nil {
 			return nil, amferrors.NewAMFError("decode.array.element", fmt.Errorf("index %d: %w", i, err))
 		}
@@ -4,6 +4,8 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"math"
+	"strings"
 
 	amferrors "github.com/alxayo/go-rtmp/internal/errors"
 )
@@ -11,6 +13,10 @@ import (
 // markerString is the AMF0 type marker for String (0x02).
 const markerString = 0x02
 
+// markerLongString is the AMF0 type marker for Long String (0x0C).
+// Wire format: 0x0C | 4-byte big-endian length | UTF-8 bytes.
+const markerLongString = 0x0C
+
 // EncodeString writes an AMF0 String to w.
 // Wire format: 0x02 | 2-byte big-endian length | UTF-8 bytes.
 // Contracts:
@@ -62,3 +68,65 @@ func DecodeString(r io.Reader) (string, error) {
 	}
 	return string(buf), nil
 }
+
+// EncodeLongString writes an AMF0 Long String to w.
+// Wire format: 0x0C | 4-byte big-endian length | UTF-8 bytes.
+// The generic encoder uses this automatically for strings longer than 65535
+// bytes; shorter strings are always written as a regular String.
+func EncodeLongString(w io.Writer, s string) error {
+	if uint64(len(s)) > math.MaxUint32 {
+		return amferrors.NewAMFError("encode.long_string.length", fmt.Errorf("string length %d exceeds 4294967295", len(s)))
+	}
+	var hdr [1 + 4]byte
+	hdr[0] = markerLongString
+	binary.BigEndian.PutUint32(hdr[1:], uint32(len(s)))
+	if _, err := w.Write(hdr[:]); err != nil {
+		return amferrors.NewAMFError("encode.long_string.write.header", err)
+	}
+	if len(s) == 0 {
+		return nil
+	}
+	if _, err := io.WriteString(w, s); err != nil {
+		return amferrors.NewAMFError("encode.long_string.write.body", err)
+	}
+	return nil
+}
+
+// DecodeLongString reads an AMF0 Long String (marker 0x0C) from r.
+// Error cases:
+//   - Marker mismatch -> decode.long_string.marker
+//   - Short reads -> decode.long_string.marker.read / decode.long_string.length.read / decode.long_string.read
+func DecodeLongString(r io.Reader) (string, error) {
+	var m [1]byte
+	if _, err := io.ReadFull(r, m[:]); err != nil {
+		return "", amferrors.NewAMFError("decode.long_string.marker.read", err)
+	}
+	if m[0] != markerLongString {
+		return "", amferrors.NewAMFError("decode.long_string.marker", fmt.Errorf("expected 0x%02x got 0x%02x", markerLongString, m[0]))
+	}
+	return decodeLongStringPayload(r)
+}
+
+// decodeLongStringPayload reads a Long String payload (4-byte length + bytes)
+// after the marker has already been consumed. The length is peer-supplied, so
+// the body is read incrementally rather than allocated up front; a truncated
+// payload fails with io.ErrUnexpectedEOF after reading only what is present.
+func decodeLongStringPayload(r io.Reader) (string, error) {
+	var ln [4]byte
+	if _, err := io.ReadFull(r, ln[:]); err != nil {
+		return "", amferrors.NewAMFError("decode.long_string.length.read", err)
+	}
+	l := int64(binary.BigEndian.Uint32(ln[:]))
+	if l == 0 {
+		return "", nil
+	}
+	var sb strings.Builder
+	n, err := io.Copy(&sb, io.LimitReader(r, l))
+	if err != nil {
+		return "", amferrors.NewAMFError("decode.long_string.read", err)
+	}
+	if n != l {
+		return "", amferrors.NewAMFError("decode.long_string.read", io.ErrUnexpectedEOF)
+	}
+	return sb.String(), nil
+}
@@ -159,3 +159,49 @@ func BenchmarkDecodeString(b *testing.B) {
 		_, _ = DecodeString(bytes.NewReader(golden))
 	}
 }
+
+// TestLongString_RoundTrip verifies the 0x0C wire layout and that a string
+// just past the short-string limit survives encode/decode.
+func TestLongString_RoundTrip(t *testing.T) {
+	in := strings.Repeat("c", 65536)
+	var buf bytes.Buffer
+	if err := EncodeLongString(&buf, in); err != nil {
+		t.Fatalf("EncodeLongString error: %v", err)
+	}
+	if got := buf.Bytes()[:5]; !bytes.Equal(got, []byte{0x0C, 0x00, 0x01, 0x00, 0x00}) {
+		t.Fatalf("unexpected header % x", got)
+	}
+	out, err := DecodeLongString(&buf)
+	if err != nil {
+		t.Fatalf("DecodeLongString error: %v", err)
+	}
+	if out != in {
+		t.Fatalf("expected same string after round trip")
+	}
+}
+
+// TestEncodeValue_LongStringSelection checks the generic encoder picks String
+// up to 65535 bytes and Long String beyond.
+func TestEncodeValue_LongStringSelection(t *testing.T) {
+	for _, tc := range []struct {
+		n      int
+		marker byte
+	}{{0xFFFF, markerString}, {0x10000, markerLongString}} {
+		var buf bytes.Buffer
+		if err := EncodeValue(&buf, strings.Repeat("d", tc.n)); err != nil {
+			t.Fatalf("EncodeValue(%d) error: %v", tc.n, err)
+		}
+		if buf.Bytes()[0] != tc.marker {
+			t.Fatalf("len %d: marker 0x%02x want 0x%02x", tc.n, buf.Bytes()[0], tc.marker)
+		}
+	}
+}
+
+// TestDecodeLongString_Truncated declares a 4 GiB body but supplies three
+// bytes; decoding must fail without allocating the declared length.
+func TestDecodeLongString_Truncated(t *testing.T) {
+	data := []byte{0x0C, 0xFF, 0xFF, 0xFF, 0xFF, 'a', 'b', 'c'}
+	if _, err := DecodeLongString(bytes.NewReader(data)); err == nil {
+		t.Fatalf("expected error for truncated long string")
+	}
+}
@@ -0,0 +1,175 @@
+package chunk
+
+// Protocol Violation Diagnostics
+// ==============================
+// When ReadMessage fails part-way through a stream, the error alone
+// ("reader.read_chunk: unexpected EOF") says nothing about the chunks that
+// led up to it. With diagnostics on (Reader.SetDiagnostics), the Reader
+// keeps the last N chunk headers it parsed and the last DiagnosticRawBytes
+// bytes it read, and wraps any error other than a clean end of stream or a
+// read timeout in a *DiagnosticError carrying them, together with the
+// messages that were part-way assembled. Dump formats it all for a log or
+// a bug report.
+//
+// Recording copies every header and every byte read, so diagnostics are
+// off by default and meant for interop debugging.
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DiagnosticRawBytes is how many of the most recently read bytes a Reader in
+// diagnostics mode keeps.
+const DiagnosticRawBytes = 1024
+
+// HeaderRecord is a chunk header parsed by a Reader in diagnostics mode.
+type HeaderRecord struct {
+	Offset    uint64      // offset of the chunk's first byte, counted from when diagnostics were turned on
+	ChunkSize uint32      // inbound chunk size the chunk was read with
+	Header    ChunkHeader // the header, with inherited fields filled in
+}
+
+// PendingMessage is a message that was part-way assembled when a read
+// failed.
+type PendingMessage struct {
+	CSID     uint32
+	TypeID   uint8
+	Length   uint32 // declared message length
+	Received uint32 // payload bytes received so far
+}
+
+// DiagnosticError is a ReadMessage error with the Reader's recent history.
+// It unwraps to the original error.
+type DiagnosticError struct {
+	Err     error
+	Offset  uint64           // bytes read since diagnostics were turned on, when the read failed
+	Headers []HeaderRecord   // the last chunk headers parsed, oldest first
+	Raw     []byte           // the last bytes read, ending at Offset
+	Pending []PendingMessage // incomplete messages by CSID
+}
+
+// Error returns the original error with the stream offset and the last
+// chunk header parsed.
+func (e *DiagnosticError) Error() string {
+	if len(e.Headers) == 0 {
+		return fmt.Sprintf("%v (at byte %d, no chunk header parsed)", e.Err, e.Offset)
+	}
+	last := e.Headers[len(e.Headers)-1]
+	return fmt.Sprintf("%v (at byte %d; last chunk at byte %d: %s)", e.Err, e.Offset, last.Offset, formatHeader(&last.Header))
+}
+
+// Unwrap returns the original error.
+func (e *DiagnosticError) Unwrap() error { return e.Err }
+
+// Dump formats the recorded headers, incomplete messages and raw bytes as
+// multi-line text.
+func (e *DiagnosticError) Dump() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "chunk read failed at byte %d: %v\n", e.Offset, e.Err)
+	fmt.Fprintf(&b, "last %d chunk headers (oldest first):\n", len(e.Headers))
+	for _, h := range e.Headers {
+		fmt.Fprintf(&b, "  byte %-10d chunk size %-6d %s\n", h.Offset, h.ChunkSize, formatHeader(&h.Header))
+	}
+	if len(e.Pending) > 0 {
+		b.WriteString("incomplete messages:\n")
+		for _, p := range e.Pending {
+			fmt.Fprintf(&b, "  csid %d: type %d, %d of %d bytes received\n", p.CSID, p.TypeID, p.Received, p.Length)
+		}
+	}
+	start := e.Offset - uint64(len(e.Raw))
+	fmt.Fprintf(&b, "last %d bytes read:\n", len(e.Raw))
+	for i := 0; i < len(e.Raw); i += 16 {
+		fmt.Fprintf(&b, "  %08x  % x\n", start+uint64(i), e.Raw[i:min(i+16, len(e.Raw))])
+	}
+	return b.String()
+}
+
+// formatHeader describes a chunk header on one line.
+func formatHeader(h *ChunkHeader) string {
+	ts := "ts"
+	if h.IsDelta {
+		ts = "ts delta"
+	}
+	return fmt.Sprintf("fmt %d csid %d type %d len %d msid %d %s %d", h.FMT, h.CSID, h.MessageTypeID, h.MessageLength, h.MessageStreamID, ts, h.Timestamp)
+}
+
+// diagnostics records what a Reader reads. It sits between the Reader and
+// its underlying stream.
+type diagnostics struct {
+	r       io.Reader
+	offset  uint64
+	raw     [DiagnosticRawBytes]byte // ring of the last bytes read; raw[offset%len] is the oldest once full
+	headers []HeaderRecord           // ring of the last headers parsed
+	next    int                      // index in headers of the next record once full
+}
+
+// Read reads from the underlying stream, keeping the bytes read.
+func (d *diagnostics) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	for _, c := range p[:n] {
+		d.raw[d.offset%DiagnosticRawBytes] = c
+		d.offset++
+	}
+	return n, err
+}
+
+// SetReadDeadline passes the deadline through to the underlying stream.
+func (d *diagnostics) SetReadDeadline(t time.Time) error {
+	if rd, ok := d.r.(readDeadliner); ok {
+		return rd.SetReadDeadline(t)
+	}
+	return ErrNoDeadline
+}
+
+// record keeps h, parsed from the chunk starting at offset.
+func (d *diagnostics) record(h *ChunkHeader, offset uint64, chunkSize uint32) {
+	rec := HeaderRecord{Offset: offset, ChunkSize: chunkSize, Header: *h}
+	if len(d.headers) < cap(d.headers) {
+		d.headers = append(d.headers, rec)
+		return
+	}
+	d.headers[d.next] = rec
+	d.next = (d.next + 1) % len(d.headers)
+}
+
+// wrap returns err with the recorded history, or err itself for the end of
+// the stream and read timeouts.
+func (d *diagnostics) wrap(err error, states map[uint32]*ChunkStreamState) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, os.ErrDeadlineExceeded) {
+		return err
+	}
+	e := &DiagnosticError{Err: err, Offset: d.offset}
+	e.Headers = append(e.Headers, d.headers[d.next:]...)
+	e.Headers = append(e.Headers, d.headers[:d.next]...)
+	n := min(d.offset, DiagnosticRawBytes)
+	for i := d.offset - n; i < d.offset; i++ {
+		e.Raw = append(e.Raw, d.raw[i%DiagnosticRawBytes])
+	}
+	for _, st := range states {
+		if st.inProgress {
+			e.Pending = append(e.Pending, PendingMessage{CSID: st.CSID, TypeID: st.LastMsgTypeID, Length: st.LastMsgLength, Received: st.bytesReceived})
+		}
+	}
+	sort.Slice(e.Pending, func(i, j int) bool { return e.Pending[i].CSID < e.Pending[j].CSID })
+	return e
+}
+
+// SetDiagnostics turns diagnostics mode on, keeping the last n chunk
+// headers, or off when n is 0. Safe to call between ReadMessage
+// invocations; turning it on again starts a fresh history.
+func (r *Reader) SetDiagnostics(n int) {
+	if r.diag != nil {
+		r.br = r.diag.r
+		r.diag = nil
+	}
+	if n > 0 {
+		r.diag = &diagnostics{r: r.br, headers: make([]HeaderRecord, 0, n)}
+		r.br = r.diag
+	}
+}
@@ -0,0 +1,108 @@
+package chunk
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// diagnosticsStream writes n audio messages and a 1000-byte video message
+// at chunk size 128, and returns the bytes cut off part-way through the
+// video message's fourth chunk.
+func diagnosticsStream(t *testing.T, n int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := NewWriter(&buf, 128)
+	for i := range n {
+		if err := w.WriteMessage(&Message{CSID: 4, TypeID: 8, MessageStreamID: 1, Timestamp: uint32(i * 20), Payload: []byte{0xAF, 0x01, byte(i)}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	whole := buf.Len()
+	if err := w.WriteMessage(&Message{CSID: 6, TypeID: 9, MessageStreamID: 1, Timestamp: 40, Payload: make([]byte, 1000)}); err != nil {
+		t.Fatal(err)
+	}
+	// FMT0 chunk (12 + 128) and two FMT3 chunks (1 + 128), then 50 bytes.
+	return buf.Bytes()[:whole+140+2*129+51]
+}
+
+// TestReaderDiagnostics checks that in diagnostics mode a read failing
+// mid-message reports the last headers, the incomplete message and the
+// last bytes read, and still unwraps to the original error.
+func TestReaderDiagnostics(t *testing.T) {
+	stream := diagnosticsStream(t, 5)
+	r := NewReader(bytes.NewReader(stream), 128)
+	r.SetDiagnostics(3)
+	var err error
+	for err == nil {
+		_, err = r.ReadMessage()
+	}
+
+	var de *DiagnosticError
+	if !errors.As(err, &de) {
+		t.Fatalf("error %v (%T) is not a *DiagnosticError", err, err)
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("error %v does not unwrap to io.ErrUnexpectedEOF", err)
+	}
+	if de.Offset != uint64(len(stream)) {
+		t.Errorf("Offset = %d, want %d", de.Offset, len(stream))
+	}
+	if len(de.Headers) != 3 {
+		t.Fatalf("%d headers kept, want 3", len(de.Headers))
+	}
+	for i, h := range de.Headers {
+		if h.Header.FMT != 3 || h.Header.CSID != 6 || h.Header.MessageLength != 1000 || h.ChunkSize != 128 {
+			t.Errorf("header %d = %+v, want a continuation chunk of the video message", i, h)
+		}
+	}
+	if last := de.Headers[2]; last.Offset != uint64(len(stream)-51) {
+		t.Errorf("last header at byte %d, want %d", last.Offset, len(stream)-51)
+	}
+	if len(de.Pending) != 1 || de.Pending[0] != (PendingMessage{CSID: 6, TypeID: 9, Length: 1000, Received: 384}) {
+		t.Errorf("Pending = %+v", de.Pending)
+	}
+	if !bytes.Equal(de.Raw, stream[len(stream)-len(de.Raw):]) || len(de.Raw) != min(len(stream), DiagnosticRawBytes) {
+		t.Errorf("Raw holds %d bytes, not the end of the stream", len(de.Raw))
+	}
+	if msg := err.Error(); !strings.Contains(msg, "reader.read_chunk: unexpected EOF (at byte 492;") || !strings.Contains(msg, "fmt 3 csid 6 type 9 len 1000") {
+		t.Errorf("Error() = %q", msg)
+	}
+	dump := de.Dump()
+	for _, s := range []string{"last 3 chunk headers", "csid 6: type 9, 384 of 1000 bytes received", "last 492 bytes read"} {
+		if !strings.Contains(dump, s) {
+			t.Errorf("Dump lacks %q:\n%s", s, dump)
+		}
+	}
+}
+
+// TestReaderDiagnostics_Off checks that errors are not wrapped without
+// diagnostics or at a clean end of stream, and that turning diagnostics
+// off restores the plain reader.
+func TestReaderDiagnostics_Off(t *testing.T) {
+	stream := diagnosticsStream(t, 1)
+	r := NewReader(bytes.NewReader(stream), 128)
+	r.SetDiagnostics(4)
+	r.SetDiagnostics(0)
+	var err error
+	for err == nil {
+		_, err = r.ReadMessage()
+	}
+	var de *DiagnosticError
+	if errors.As(err, &de) {
+		t.Fatalf("error wrapped with diagnostics off: %v", err)
+	}
+
+	var buf bytes.Buffer
+	_ = NewWriter(&buf, 128).WriteMessage(&Message{CSID: 4, TypeID: 8, MessageStreamID: 1, Payload: []byte{0xAF}})
+	r = NewReader(&buf, 128)
+	r.SetDiagnostics(4)
+	if _, err := r.ReadMessage(); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if _, err := r.ReadMessage(); err != io.EOF {
+		t.Fatalf("end of stream = %v, want io.EOF", err)
+	}
+}
@@ -7,6 +7,8 @@
 //
 //   - [Writer] fragments outbound messages into chunks with FMT-based header
 //     compression (FMT 0-3) for wire efficiency.
+//   - [Scheduler] drives a Writer one chunk at a time, interleaving chunk
+//     streams round-robin so large messages do not starve small ones.
 //   - [Reader] reassembles inbound chunks back into complete messages,
 //     maintaining per-CSID state for header decompression.
 //
@@ -27,6 +29,14 @@
 //	│  (1-3 bytes) │ (0/3/7/11 bytes) │    (0 or 4 bytes)   │ (N bytes)│
 //	└──────────────┴──────────────────┴─────────────────────┴──────────┘
 //
+// # Payload Ownership
+//
+// A message payload is read-only once handed on, so subscribers, recorders
+// and relays share it: [Message.Share] gives each a header of its own and a
+// reference that is given back with [Message.Release]. Pooled messages
+// ([NewPooledMessage]) return their payload to a pool after the last
+// release; see pool.go for the full contract.
+//
 // # Thread Safety
 //
 // Neither Reader nor Writer is safe for concurrent use. The expected pattern
@@ -0,0 +1,42 @@
+package chunk
+
+// Reader Limits
+// =============
+// The RTMP header lets a peer declare up to 16 MiB per message and open
+// thousands of chunk streams (CSIDs), each holding its own reassembly
+// buffer. Without bounds a single malicious connection can make the server
+// allocate gigabytes. Limits are checked as soon as a chunk header is parsed,
+// before any payload is buffered, so violations cost the server nothing.
+//
+// Message size limits bound each message on its own; MaxPendingBytes bounds
+// their sum: a peer may start a message on every chunk stream and never
+// finish any of them. It is checked before each chunk that leaves its message
+// incomplete, so a large command split into many chunks and interleaved with
+// control messages is still accepted as long as it fits.
+//
+// MaxChunkSize bounds the chunk size a peer may announce with Set Chunk
+// Size. The spec allows any 31-bit size, and encoders do send sizes above
+// 65536; a size beyond the limit is a protocol error that ends the read
+// rather than a value to skip, since the peer goes on chunking at it.
+
+import "errors"
+
+// ErrLimitExceeded is wrapped by the ChunkError returned when a peer exceeds
+// one of the configured Limits. Use errors.Is to detect it.
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+// Limits bounds the resources a single peer may consume in a Reader.
+// Zero values disable the corresponding check.
+type Limits struct {
+	MaxMessageSize    uint32 // largest MessageLength accepted for any message
+	MaxChunkStreams   int    // most distinct CSIDs tracked per connection
+	MaxAMFMessageSize uint32 // largest MessageLength for AMF data/command messages (types 15-20)
+	MaxPendingBytes   uint32 // most payload bytes buffered in incomplete messages across all CSIDs
+	MaxChunkSize      uint32 // largest inbound chunk size a peer may set with Set Chunk Size
+}
+
+// isAMFMessageType reports whether typeID carries AMF-encoded data
+// (AMF3/AMF0 data, shared object and command messages).
+func isAMFMessageType(typeID uint8) bool {
+	return typeID >= 15 && typeID <= 20
+}
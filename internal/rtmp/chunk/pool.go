@@ -0,0 +1,118 @@
+package chunk
+
+// Message Payload Sharing
+// -----------------------
+// A published frame is handed to every subscriber, the recorder and each
+// relay destination. Copying the payload for each of them costs one
+// allocation and copy per consumer per frame; instead they share it.
+//
+// The contract:
+//
+//   - A payload is read-only once the message has been handed on. Nothing
+//     may write to Payload after passing the message to another component.
+//   - Share returns a new Message header (CSID, stream ID and timestamp may
+//     be changed freely) that shares the payload. Each Share, like each
+//     Retain, is one reference, and its holder calls Release exactly once
+//     when done with it. Copying the Message struct does not take a
+//     reference; use Share when keeping a message beyond the call that
+//     received it.
+//   - Messages from NewPooledMessage start with one reference owned by the
+//     caller. When the last reference is released the payload returns to a
+//     pool and may be reused, so a message must not be touched after its
+//     holder released it.
+//   - Other messages (plain struct literals, everything a Reader returns)
+//     are not pooled: Retain and Release are no-ops, Share still shares the
+//     payload, and the garbage collector reclaims it. Forgetting a Release
+//     is therefore never unsafe, it only forgoes the reuse; releasing a
+//     pooled message more often than it was referenced panics.
+//
+// The Reader does not pool: the server keeps inbound messages in sequence
+// header caches, GOP and DVR buffers that do not take references.
+
+import (
+	"math/bits"
+	"sync"
+	"sync/atomic"
+)
+
+// Pooled payloads come in power-of-two size classes from 1<<minPoolShift to
+// 1<<maxPoolShift bytes. Larger payloads are allocated normally.
+const (
+	minPoolShift = 8
+	maxPoolShift = 20
+)
+
+var payloadPools [maxPoolShift - minPoolShift + 1]sync.Pool
+
+// payloadRef is the reference count of a pooled payload.
+type payloadRef struct {
+	refs atomic.Int32
+	buf  []byte // the pooled buffer at full capacity
+}
+
+// poolClass returns the size class for a payload of size bytes, or -1 if
+// it is too large to pool.
+func poolClass(size int) int {
+	shift := bits.Len(uint(size - 1))
+	if size <= 1 || shift < minPoolShift {
+		shift = minPoolShift
+	}
+	if shift > maxPoolShift {
+		return -1
+	}
+	return shift - minPoolShift
+}
+
+// NewPooledMessage returns a message whose Payload has length size and
+// comes from the payload pool. The caller owns its single reference and
+// calls Release when done; the payload's previous contents are undefined.
+func NewPooledMessage(size int) *Message {
+	class := poolClass(size)
+	if class < 0 {
+		return &Message{Payload: make([]byte, size)}
+	}
+	ref, _ := payloadPools[class].Get().(*payloadRef)
+	if ref == nil {
+		ref = &payloadRef{buf: make([]byte, 1<<(class+minPoolShift))}
+	}
+	ref.refs.Store(1)
+	return &Message{Payload: ref.buf[:size], ref: ref}
+}
+
+// Pooled reports whether m's payload is reference counted and returns to
+// the pool after its last Release.
+func (m *Message) Pooled() bool { return m != nil && m.ref != nil }
+
+// Retain adds a reference to m's payload and returns m.
+func (m *Message) Retain() *Message {
+	if m != nil && m.ref != nil {
+		m.ref.refs.Add(1)
+	}
+	return m
+}
+
+// Share returns a copy of m's header sharing its payload, holding a new
+// reference to it.
+func (m *Message) Share() *Message {
+	if m == nil {
+		return nil
+	}
+	cp := *m
+	return cp.Retain()
+}
+
+// Release drops a reference to m's payload. The payload returns to the pool
+// when the last reference is released. It panics if the payload was
+// already fully released.
+func (m *Message) Release() {
+	if m == nil || m.ref == nil {
+		return
+	}
+	switch n := m.ref.refs.Add(-1); {
+	case n == 0:
+		ref := m.ref
+		payloadPools[poolClass(cap(ref.buf))].Put(ref)
+	case n < 0:
+		panic("chunk: Message released more often than referenced")
+	}
+}
@@ -0,0 +1,111 @@
+package chunk
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPooledMessage_References(t *testing.T) {
+	m := NewPooledMessage(300)
+	if !m.Pooled() || len(m.Payload) != 300 || m.ref.refs.Load() != 1 {
+		t.Fatalf("NewPooledMessage(300): pooled=%v len=%d", m.Pooled(), len(m.Payload))
+	}
+	copy(m.Payload, "frame")
+
+	s := m.Share()
+	s.MessageStreamID = 7
+	if s == m || &s.Payload[0] != &m.Payload[0] || m.MessageStreamID == 7 {
+		t.Fatal("Share must copy the header and share the payload")
+	}
+	m.Retain()
+	if n := m.ref.refs.Load(); n != 3 {
+		t.Fatalf("references = %d after Share and Retain, want 3", n)
+	}
+	m.Release()
+	s.Release()
+	if n := m.ref.refs.Load(); n != 1 {
+		t.Fatalf("references = %d, want 1", n)
+	}
+	if !bytes.HasPrefix(m.Payload, []byte("frame")) {
+		t.Fatal("payload changed while still referenced")
+	}
+	m.Release()
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("releasing a fully released message did not panic")
+		}
+	}()
+	m.Release()
+}
+
+func TestUnpooledMessage_ReleaseIsNoop(t *testing.T) {
+	m := &Message{TypeID: 9, Payload: []byte{0x17, 0x01}}
+	s := m.Share()
+	if m.Pooled() || s.Pooled() || &s.Payload[0] != &m.Payload[0] {
+		t.Fatal("Share of an unpooled message must share the payload without pooling it")
+	}
+	m.Retain()
+	m.Release()
+	m.Release()
+	s.Release()
+	if m.Payload[0] != 0x17 {
+		t.Fatal("payload changed")
+	}
+	var nilMsg *Message
+	nilMsg.Release()
+	if nilMsg.Share() != nil || nilMsg.Pooled() {
+		t.Fatal("nil message handling")
+	}
+}
+
+func TestPoolClass(t *testing.T) {
+	tests := []struct {
+		size, class int
+	}{
+		{0, 0}, {1, 0}, {256, 0}, {257, 1}, {4096, 4}, {1 << maxPoolShift, maxPoolShift - minPoolShift}, {1<<maxPoolShift + 1, -1},
+	}
+	for _, tt := range tests {
+		if got := poolClass(tt.size); got != tt.class {
+			t.Errorf("poolClass(%d) = %d, want %d", tt.size, got, tt.class)
+		}
+	}
+	if m := NewPooledMessage(2 << maxPoolShift); m.Pooled() || len(m.Payload) != 2<<maxPoolShift {
+		t.Fatal("oversized payloads must be allocated unpooled")
+	}
+}
+
+func TestPooledMessage_ReleaseAfterLastSubscriber(t *testing.T) {
+	m := NewPooledMessage(300)
+	subs := []*Message{m.Share(), m.Share(), m.Share()} // players, recorder, relay
+	m.Release()                                         // the publisher is done first
+	for i, s := range subs {
+		if n := m.ref.refs.Load(); n != int32(len(subs)-i) {
+			t.Fatalf("references = %d with %d holders left", n, len(subs)-i)
+		}
+		s.Release()
+	}
+	if n := m.ref.refs.Load(); n != 0 {
+		t.Fatalf("references = %d after the last release, want 0", n)
+	}
+}
+
+func TestPooledMessage_NoReuseWhileHeld(t *testing.T) {
+	m := NewPooledMessage(300)
+	copy(m.Payload, "keyframe")
+	kept := m.Share() // a consumer keeping the frame
+	m.Release()
+
+	for i := 0; i < 16; i++ {
+		n := NewPooledMessage(300)
+		if &n.Payload[0] == &kept.Payload[0] {
+			t.Fatal("a held payload was handed out again")
+		}
+		copy(n.Payload, "overwrite")
+		defer n.Release()
+	}
+	if !bytes.HasPrefix(kept.Payload, []byte("keyframe")) {
+		t.Fatal("held payload changed")
+	}
+	kept.Release()
+}
@@ -0,0 +1,80 @@
+package chunk
+
+// Pre-chunked Payloads
+// ====================
+// A published frame is fanned out to every subscriber, and each
+// subscriber's Writer used to split it into chunks on its own: encode a
+// continuation header per chunk and copy header and payload slice into its
+// scratch buffer before writing. With hundreds of viewers the same frame
+// was chunked hundreds of times.
+//
+// Only the first chunk of a message depends on the connection: its header
+// format is chosen from the Writer's per-CSID compression state, and it
+// carries the subscriber's message stream ID. Every following chunk is a
+// FMT3 basic header (1-3 bytes, fixed by CSID) and the next chunk-size
+// slice of the payload, so the same bytes serve every connection using that
+// chunk size and chunk stream. Prechunk lays them out once, on the
+// broadcasting goroutine; Writers that find a matching framing write the
+// continuation chunks straight from it, without encoding or copying.
+//
+// The framing is only used when the first chunk has no extended timestamp
+// (the continuation chunks would have to repeat it) and while the Writer's
+// chunk size still matches. Otherwise the Writer falls back to chunking the
+// payload itself, from where it had got to, so the output is always what
+// WriteMessage would have produced.
+
+// prechunked is a message payload laid out as chunks for one chunk size and
+// chunk stream: the first chunk's payload, then for each further chunk its
+// FMT3 basic header and payload.
+type prechunked struct {
+	chunkSize uint32
+	csid      uint32
+	hdrLen    int // length of each FMT3 basic header in body
+	body      []byte
+}
+
+// Prechunk lays out m's payload as chunks of chunkSize on chunk stream
+// csid, for Writers to share. It does nothing for a payload that fits in
+// one chunk, an invalid CSID, or a framing m already has.
+//
+// Like the payload, the framing is read-only once the message has been
+// handed on: call Prechunk before sharing m. Copies made with Share carry
+// the framing along.
+func (m *Message) Prechunk(csid, chunkSize uint32) {
+	if m == nil || chunkSize == 0 || uint32(len(m.Payload)) <= chunkSize || m.Prechunked(csid, chunkSize) {
+		return
+	}
+	hdr, err := encodeBasicHeader(nil, fmt3, csid)
+	if err != nil {
+		return
+	}
+	n := len(m.Payload)
+	chunks := (n + int(chunkSize) - 1) / int(chunkSize)
+	body := make([]byte, 0, n+(chunks-1)*len(hdr))
+	for off := 0; off < n; off += int(chunkSize) {
+		if off > 0 {
+			body = append(body, hdr...)
+		}
+		body = append(body, m.Payload[off:min(off+int(chunkSize), n)]...)
+	}
+	// Copies made with Share hold the same slice; never append into it.
+	m.prechunked = append(m.prechunked[:len(m.prechunked):len(m.prechunked)], &prechunked{chunkSize: chunkSize, csid: csid, hdrLen: len(hdr), body: body})
+}
+
+// Prechunked reports whether m carries a framing for chunkSize and csid.
+func (m *Message) Prechunked(csid, chunkSize uint32) bool {
+	return m.framing(csid, chunkSize) != nil
+}
+
+// framing returns m's framing for chunkSize and csid, or nil.
+func (m *Message) framing(csid, chunkSize uint32) *prechunked {
+	if m == nil {
+		return nil
+	}
+	for _, p := range m.prechunked {
+		if p.chunkSize == chunkSize && p.csid == csid {
+			return p
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package chunk
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// prechunkPayload returns a payload of n bytes with varying contents.
+func prechunkPayload(n int) []byte {
+	p := make([]byte, n)
+	for i := range p {
+		p[i] = byte(i * 7)
+	}
+	return p
+}
+
+// TestPrechunk_SameBytes checks that a Writer writing pre-chunked messages
+// produces exactly the bytes it writes for the plain messages, across CSID
+// encodings, header compression, partial last chunks and extended
+// timestamps (which bypass the framing).
+func TestPrechunk_SameBytes(t *testing.T) {
+	for _, csid := range []uint32{6, 100, 400} {
+		var plain, pre bytes.Buffer
+		pw, qw := NewWriter(&plain, 128), NewWriter(&pre, 128)
+		for i, tc := range []struct {
+			ts   uint32
+			size int
+		}{{0, 300}, {33, 300}, {66, 1000}, {99, 128}, {132, 129}, {0x1000000, 500}, {0x1000021, 500}} {
+			msg := &Message{CSID: csid, Timestamp: tc.ts, TypeID: 9, MessageStreamID: 1, Payload: prechunkPayload(tc.size)}
+			shared := msg.Share()
+			shared.Prechunk(csid, 128)
+			if err := pw.WriteMessage(msg); err != nil {
+				t.Fatalf("csid %d message %d: plain write: %v", csid, i, err)
+			}
+			if err := qw.WriteMessage(shared); err != nil {
+				t.Fatalf("csid %d message %d: pre-chunked write: %v", csid, i, err)
+			}
+			if !bytes.Equal(plain.Bytes(), pre.Bytes()) {
+				t.Fatalf("csid %d message %d: pre-chunked output differs", csid, i)
+			}
+		}
+
+		r := NewReader(&pre, 128)
+		for i := 0; i < 7; i++ {
+			if _, err := r.ReadMessage(); err != nil {
+				t.Fatalf("csid %d: read back message %d: %v", csid, i, err)
+			}
+		}
+	}
+}
+
+// TestPrechunk_ChunkSizeChange checks that a Writer whose chunk size does
+// not match the framing, or changes part-way through a message, chunks the
+// payload itself.
+func TestPrechunk_ChunkSizeChange(t *testing.T) {
+	write := func(prechunk bool) []byte {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 128)
+		s := NewScheduler(w)
+		for _, size := range []uint32{128, 256} {
+			msg := &Message{CSID: 6, TypeID: 9, MessageStreamID: 1, Payload: prechunkPayload(1000)}
+			if prechunk {
+				msg.Prechunk(6, size)
+			}
+			if err := s.Enqueue(msg); err != nil {
+				t.Fatalf("enqueue: %v", err)
+			}
+		}
+		for i := 0; s.Pending() > 0; i++ {
+			if i == 3 {
+				w.SetChunkSize(256)
+			}
+			if _, err := s.WriteNext(); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+		}
+		return buf.Bytes()
+	}
+	if !bytes.Equal(write(false), write(true)) {
+		t.Fatal("pre-chunked output differs across a chunk size change")
+	}
+}
+
+// TestPrechunk_Framings checks when Prechunk lays out a framing and that
+// shared copies carry it.
+func TestPrechunk_Framings(t *testing.T) {
+	msg := &Message{CSID: 6, TypeID: 9, Payload: prechunkPayload(4096)}
+	msg.Prechunk(6, 4096) // fits in one chunk
+	msg.Prechunk(1, 128)  // reserved CSID
+	if len(msg.prechunked) != 0 {
+		t.Fatalf("framings = %d, want none", len(msg.prechunked))
+	}
+	msg.Prechunk(6, 128)
+	msg.Prechunk(6, 128)
+	msg.Prechunk(6, 1024)
+	if len(msg.prechunked) != 2 || !msg.Prechunked(6, 128) || !msg.Prechunked(6, 1024) || msg.Prechunked(4, 128) {
+		t.Fatalf("framings = %d, want 128 and 1024 on CSID 6", len(msg.prechunked))
+	}
+	if p := msg.framing(6, 1024); len(p.body) != 4096+3 {
+		t.Fatalf("1024-byte framing is %d bytes, want %d", len(p.body), 4096+3)
+	}
+	if !msg.Share().Prechunked(6, 128) {
+		t.Fatal("shared copy lost the framing")
+	}
+}
+
+// BenchmarkWriterWriteMessage_Prechunked benchmarks writing a multi-chunk
+// message from its shared framing, as each subscriber of a broadcast does.
+func BenchmarkWriterWriteMessage_Prechunked(b *testing.B) {
+	b.ReportAllocs()
+	payload := make([]byte, 4096)
+	msg := &Message{CSID: 6, Timestamp: 0, MessageLength: 4096, TypeID: 9, MessageStreamID: 1, Payload: payload}
+	msg.Prechunk(6, 128)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w := NewWriter(io.Discard, 128)
+		_ = w.WriteMessage(msg)
+	}
+}
@@ -18,10 +18,12 @@ package chunk
 // size so subsequent chunks are read with the new size.
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"time"
 
 	protoerr "github.com/alxayo/go-rtmp/internal/errors"
 )
@@ -35,6 +37,9 @@ type Reader struct {
 	states     map[uint32]*ChunkStreamState // per-CSID assembly state (tracks partial messages)
 	prevHeader map[uint32]*ChunkHeader      // last header per CSID (for FMT 1/2/3 field inheritance)
 	scratch    []byte                       // reusable buffer for reading chunk payloads
+	limits     Limits                       // resource bounds (zero = unlimited)
+	onHeader   func(*ChunkHeader)           // observes every parsed chunk header (nil = none)
+	diag       *diagnostics                 // history kept in diagnostics mode (nil = off); see diagnostics.go
 }
 
 // NewReader creates a new dechunker with the provided initial inbound chunk size (spec default 128).
@@ -50,15 +55,36 @@ func NewReader(r io.Reader, chunkSize uint32) *Reader {
 	}
 }
 
-// SetChunkSize overrides the inbound chunk size; safe to call between ReadMessage invocations.
-func (r *Reader) SetChunkSize(size uint32) {
-	if size >= 1 && size <= 65536 { // basic sanity; spec permits up to at least 65536 in typical impls
-		r.chunkSize = size
-		// Reset scratch so it can be reallocated lazily to new size when needed.
-		r.scratch = nil
+// MaxChunkSize is the largest chunk size the spec allows (31 bits).
+const MaxChunkSize = 0x7FFFFFFF
+
+// maxMessageLength is the largest message the 3-byte length field can
+// carry, and so the largest chunk that can occur.
+const maxMessageLength = 0xFFFFFF
+
+// SetChunkSize overrides the inbound chunk size; safe to call between
+// ReadMessage invocations. size must be 1-MaxChunkSize; sizes above the
+// largest message length behave as that length. It does not check
+// Limits.MaxChunkSize, which applies to sizes the peer sets.
+func (r *Reader) SetChunkSize(size uint32) error {
+	if size < 1 || size > MaxChunkSize {
+		return fmt.Errorf("chunk size %d out of range 1-%d", size, MaxChunkSize)
 	}
+	r.chunkSize = min(size, maxMessageLength)
+	// Reset scratch so it can be reallocated lazily to new size when needed.
+	r.scratch = nil
+	return nil
 }
 
+// SetLimits installs resource bounds checked on every chunk header. Safe to
+// call between ReadMessage invocations.
+func (r *Reader) SetLimits(l Limits) { r.limits = l }
+
+// SetHeaderHandler installs fn to observe every chunk header as it is
+// parsed, with the fields FMT 1-3 headers inherit already filled in, e.g.
+// to analyze which header formats a peer uses. fn must not retain h.
+func (r *Reader) SetHeaderHandler(fn func(h *ChunkHeader)) { r.onHeader = fn }
+
 // nextHeader parses the next chunk header, using prior header for CSID when needed (FMT2/3).
 func (r *Reader) nextHeader() (*ChunkHeader, error) {
 	// Parse basic header to learn CSID, then supply the stored previous header
@@ -108,8 +134,24 @@ func (r *Reader) nextHeader() (*ChunkHeader, error) {
 // The reassembly loop handles chunk interleaving: chunks from different CSIDs can arrive
 // interleaved, so we maintain per-CSID state and keep looping until one CSID's message
 // is fully assembled (bytesReceived == messageLength).
+//
+// In diagnostics mode (SetDiagnostics) errors other than the end of the
+// stream and read timeouts are returned as a *DiagnosticError.
 func (r *Reader) ReadMessage() (*Message, error) {
+	msg, err := r.readMessage()
+	if err != nil && r.diag != nil {
+		err = r.diag.wrap(err, r.states)
+	}
+	return msg, err
+}
+
+// readMessage implements ReadMessage.
+func (r *Reader) readMessage() (*Message, error) {
 	for {
+		var start uint64
+		if r.diag != nil {
+			start = r.diag.offset
+		}
 		// Parse next chunk header
 		h, err := r.nextHeader()
 		if err != nil {
@@ -118,18 +160,30 @@ func (r *Reader) ReadMessage() (*Message, error) {
 			}
 			return nil, err
 		}
+		if r.diag != nil {
+			r.diag.record(h, start, r.chunkSize)
+		}
 		csid := h.CSID
 		// Fetch / init state
 		st := r.states[csid]
 		if st == nil {
+			if limit := r.limits.MaxChunkStreams; limit > 0 && len(r.states) >= limit {
+				return nil, protoerr.NewChunkError("reader.limit", fmt.Errorf("%w: more than %d chunk streams (csid %d)", ErrLimitExceeded, limit, csid))
+			}
 			st = &ChunkStreamState{CSID: csid}
 			r.states[csid] = st
 		}
 		if err = st.ApplyHeader(h); err != nil {
 			return nil, err
 		}
+		if err = r.checkMessageLength(st); err != nil {
+			return nil, err
+		}
 		// Store header as previous for this CSID (for FMT2 inheritance / FMT3 continuation)
 		r.prevHeader[csid] = h
+		if r.onHeader != nil {
+			r.onHeader(h)
+		}
 
 		// Determine bytes to read for this chunk
 		remaining := st.BytesRemaining()
@@ -139,7 +193,10 @@ func (r *Reader) ReadMessage() (*Message, error) {
 				return nil, err
 			}
 			if complete {
-				r.maybeHandleControl(msg)
+				if err := r.maybeHandleControl(msg); err != nil {
+					msg.Release()
+					return nil, err
+				}
 				return msg, nil
 			}
 			continue // need next header
@@ -148,14 +205,18 @@ func (r *Reader) ReadMessage() (*Message, error) {
 		if readLen > r.chunkSize {
 			readLen = r.chunkSize
 		}
-		// Ensure scratch buffer capacity (exponential growth to reduce allocations)
+		// Ensure scratch buffer capacity (exponential growth to reduce
+		// allocations). readLen is bounded by the message length, so a peer
+		// announcing a huge chunk size costs only the chunks it sends.
 		if uint32(cap(r.scratch)) < readLen {
-			newCap := readLen
-			if newCap < r.chunkSize*2 {
-				newCap = r.chunkSize * 2
-			}
+			newCap := max(readLen, min(uint32(cap(r.scratch))*2, r.chunkSize))
 			r.scratch = make([]byte, newCap)
 		}
+		if readLen < remaining {
+			if err := r.checkPending(readLen); err != nil {
+				return nil, err
+			}
+		}
 		buf := r.scratch[:readLen]
 		if _, err := io.ReadFull(r.br, buf); err != nil {
 			return nil, protoerr.NewChunkError("reader.read_chunk", err)
@@ -165,26 +226,138 @@ func (r *Reader) ReadMessage() (*Message, error) {
 			return nil, err
 		}
 		if complete {
-			r.maybeHandleControl(msg)
+			if err := r.maybeHandleControl(msg); err != nil {
+				msg.Release()
+				return nil, err
+			}
 			return msg, nil
 		}
 		// Otherwise loop for next chunk (interleaving naturally supported because we restart header parse)
 	}
 }
 
+// ErrNoDeadline is returned by SetReadDeadline and ReadMessageContext when
+// the underlying stream cannot interrupt a blocked read (it has no
+// SetReadDeadline method, as net.Conn does).
+var ErrNoDeadline = errors.New("chunk: underlying reader does not support read deadlines")
+
+// readDeadliner is implemented by net.Conn and by wrappers that pass the
+// deadline through to one.
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// SetReadDeadline sets the read deadline of the underlying stream, after
+// which a blocked ReadMessage fails with a timeout error (net.Error with
+// Timeout() true). The zero time means no deadline.
+func (r *Reader) SetReadDeadline(t time.Time) error {
+	d, ok := r.br.(readDeadliner)
+	if !ok {
+		return ErrNoDeadline
+	}
+	return d.SetReadDeadline(t)
+}
+
+// ReadMessageContext is ReadMessage bounded by ctx: when ctx is done the
+// blocked read is interrupted through the read deadline and ctx.Err() is
+// returned, without closing the underlying stream. A deadline on ctx
+// replaces one set with SetReadDeadline. A message that was interrupted
+// part way leaves the Reader unusable; discard it after such an error.
+func (r *Reader) ReadMessageContext(ctx context.Context) (*Message, error) {
+	if ctx.Done() == nil {
+		return r.ReadMessage()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	d, ok := r.br.(readDeadliner)
+	if !ok {
+		return nil, ErrNoDeadline
+	}
+	deadline, hasDeadline := ctx.Deadline()
+	if hasDeadline {
+		if err := d.SetReadDeadline(deadline); err != nil {
+			return nil, err
+		}
+	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = d.SetReadDeadline(time.Unix(1, 0)) // in the past: fail the read now
+	})
+	msg, err := r.ReadMessage()
+	stop()
+	if err != nil {
+		// The read failed because ctx ended it. The socket deadline may
+		// fire just before the context notices its own.
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		if hasDeadline && !time.Now().Before(deadline) {
+			return nil, context.DeadlineExceeded
+		}
+	}
+	return msg, err
+}
+
+// checkMessageLength enforces the message size limits for the message being
+// assembled on st. Runs before any payload is buffered.
+func (r *Reader) checkMessageLength(st *ChunkStreamState) error {
+	if limit := r.limits.MaxMessageSize; limit > 0 && st.LastMsgLength > limit {
+		return protoerr.NewChunkError("reader.limit", fmt.Errorf("%w: message length %d > %d (type %d)", ErrLimitExceeded, st.LastMsgLength, limit, st.LastMsgTypeID))
+	}
+	if limit := r.limits.MaxAMFMessageSize; limit > 0 && isAMFMessageType(st.LastMsgTypeID) && st.LastMsgLength > limit {
+		return protoerr.NewChunkError("reader.limit", fmt.Errorf("%w: AMF message length %d > %d (type %d)", ErrLimitExceeded, st.LastMsgLength, limit, st.LastMsgTypeID))
+	}
+	return nil
+}
+
+// checkPending enforces MaxPendingBytes before n more bytes are buffered for
+// a message that stays incomplete. A chunk completing its message is not
+// checked: its size is already bounded by the message size limits.
+func (r *Reader) checkPending(n uint32) error {
+	limit := r.limits.MaxPendingBytes
+	if limit == 0 {
+		return nil
+	}
+	pending := uint64(n)
+	for _, st := range r.states {
+		if st.inProgress {
+			pending += uint64(st.bytesReceived)
+		}
+	}
+	if pending > uint64(limit) {
+		return protoerr.NewChunkError("reader.limit", fmt.Errorf("%w: %d bytes pending in incomplete messages > %d", ErrLimitExceeded, pending, limit))
+	}
+	return nil
+}
+
 // maybeHandleControl checks if a completed message is a Set Chunk Size control
 // message (TypeID 1, MSID 0) and automatically updates the reader's chunk size.
 // This allows the reader to adapt when the sender changes its chunk size mid-stream,
 // which is normal during RTMP session setup (servers typically increase from 128 to 4096).
-func (r *Reader) maybeHandleControl(msg *Message) {
+// A size the reader cannot follow (0, the high bit set, or above
+// Limits.MaxChunkSize) is returned as an error: the peer keeps chunking at
+// it, so every later header would be parsed at the wrong offset.
+// An Abort Message (TypeID 2) discards the partial message on the CSID it names,
+// so the next chunk on that CSID starts a new message and its buffered bytes no
+// longer count against MaxPendingBytes.
+func (r *Reader) maybeHandleControl(msg *Message) error {
 	if msg == nil {
-		return
+		return nil
 	}
 	// RTMP control messages (chunk type ID 1-6) travel typically on CSID 2, msid 0.
 	if msg.TypeID == 1 && msg.MessageStreamID == 0 && len(msg.Payload) >= 4 {
 		v := binary.BigEndian.Uint32(msg.Payload[:4])
-		if v > 0 && v <= 65536 { // guard
-			r.SetChunkSize(v)
+		if limit := r.limits.MaxChunkSize; limit > 0 && v > limit && v <= MaxChunkSize {
+			return protoerr.NewChunkError("reader.limit", fmt.Errorf("%w: chunk size %d > %d", ErrLimitExceeded, v, limit))
+		}
+		if err := r.SetChunkSize(v); err != nil {
+			return protoerr.NewChunkError("reader.set_chunk_size", err)
+		}
+	}
+	if msg.TypeID == 2 && msg.MessageStreamID == 0 && len(msg.Payload) >= 4 {
+		if st := r.states[binary.BigEndian.Uint32(msg.Payload[:4])]; st != nil {
+			st.ResetBuffer()
 		}
 	}
+	return nil
 }
@@ -15,11 +15,16 @@ package chunk
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
+	"encoding/binary"
+	"errors"
 	"io"
+	"net"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 // Test utilities
@@ -226,3 +231,250 @@ func BenchmarkReaderReadMessage_MultiChunk(b *testing.B) {
 		_, _ = r.ReadMessage()
 	}
 }
+
+// TestReader_Limits verifies each limit rejects the offending header with an
+// error wrapping ErrLimitExceeded, before the payload is read.
+func TestReader_Limits(t *testing.T) {
+	big := buildMessageBytes(t, 4, 0, 9, 1, make([]byte, 300))
+	r := NewReader(bytes.NewReader(big[:12]), 128) // header only: payload never needed
+	r.SetLimits(Limits{MaxMessageSize: 256})
+	if _, err := r.ReadMessage(); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("max message size: expected ErrLimitExceeded, got %v", err)
+	}
+
+	amfMsg := buildMessageBytes(t, 3, 0, 20, 0, make([]byte, 100))
+	r = NewReader(bytes.NewReader(amfMsg), 128)
+	r.SetLimits(Limits{MaxMessageSize: 1 << 20, MaxAMFMessageSize: 64})
+	if _, err := r.ReadMessage(); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("max AMF size: expected ErrLimitExceeded, got %v", err)
+	}
+
+	var stream []byte
+	for csid := uint32(3); csid < 6; csid++ {
+		stream = append(stream, buildMessageBytes(t, csid, 0, 8, 1, []byte{0xAF, 0x01})...)
+	}
+	r = NewReader(bytes.NewReader(stream), 128)
+	r.SetLimits(Limits{MaxChunkStreams: 2})
+	for i := 0; i < 2; i++ {
+		if _, err := r.ReadMessage(); err != nil {
+			t.Fatalf("message %d within limit: %v", i, err)
+		}
+	}
+	if _, err := r.ReadMessage(); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("max chunk streams: expected ErrLimitExceeded, got %v", err)
+	}
+}
+
+// TestReader_LargeChunkSize verifies chunk sizes above 65536 are followed,
+// and that sizes the reader cannot follow end the read with an error
+// instead of being skipped.
+func TestReader_LargeChunkSize(t *testing.T) {
+	setChunkSize := func(size uint32) []byte {
+		return buildMessageBytes(t, 2, 0, 1, 0, binary.BigEndian.AppendUint32(nil, size))
+	}
+	payload := make([]byte, 100000)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	for _, size := range []uint32{1 << 20, 0x7FFFFFFF} {
+		stream := append(setChunkSize(size), buildMessageBytes(t, 6, 0, 9, 1, payload)...)
+		r := NewReader(bytes.NewReader(stream), 128)
+		if _, err := r.ReadMessage(); err != nil {
+			t.Fatalf("set chunk size %d: %v", size, err)
+		}
+		m, err := r.ReadMessage()
+		if err != nil {
+			t.Fatalf("chunk size %d: read: %v", size, err)
+		}
+		if !bytes.Equal(m.Payload, payload) {
+			t.Fatalf("chunk size %d: payload corrupted", size)
+		}
+	}
+
+	r := NewReader(bytes.NewReader(setChunkSize(1<<20)), 128)
+	r.SetLimits(Limits{MaxChunkSize: 65536})
+	if _, err := r.ReadMessage(); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("max chunk size: expected ErrLimitExceeded, got %v", err)
+	}
+	for _, size := range []uint32{0, 0x80000000} {
+		r := NewReader(bytes.NewReader(setChunkSize(size)), 128)
+		if _, err := r.ReadMessage(); err == nil {
+			t.Fatalf("chunk size %#x accepted", size)
+		}
+	}
+}
+
+// TestReader_PendingLimit verifies MaxPendingBytes counts partial messages
+// across chunk streams and that an Abort Message frees the aborted one.
+func TestReader_PendingLimit(t *testing.T) {
+	partial := func(csid uint32) []byte { // first 128 of 200 bytes
+		return buildMessageBytes(t, csid, 0, 8, 1, make([]byte, 200))[:12+128]
+	}
+	stream := append(partial(4), partial(5)...)
+	r := NewReader(bytes.NewReader(stream), 128)
+	r.SetLimits(Limits{MaxPendingBytes: 200})
+	if _, err := r.ReadMessage(); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("two partial messages: expected ErrLimitExceeded, got %v", err)
+	}
+
+	stream = append(partial(4), buildMessageBytes(t, 2, 0, 2, 0, []byte{0, 0, 0, 4})...) // Abort csid 4
+	stream = append(stream, partial(5)...)
+	stream = append(stream, 0xC5)
+	stream = append(stream, make([]byte, 72)...)
+	r = NewReader(bytes.NewReader(stream), 128)
+	r.SetLimits(Limits{MaxPendingBytes: 200})
+	for _, want := range []uint32{2, 5} {
+		msg, err := r.ReadMessage()
+		if err != nil {
+			t.Fatalf("read csid %d: %v", want, err)
+		}
+		if msg.CSID != want {
+			t.Fatalf("got csid %d, want %d", msg.CSID, want)
+		}
+	}
+	if st := r.states[4]; st.inProgress || st.bytesReceived != 0 {
+		t.Fatal("aborted message still buffered")
+	}
+}
+
+// TestReader_LargeCommandInterleaved reassembles a connect-sized command
+// split into FMT0+FMT3 chunks with control messages between its chunks,
+// including a Set Chunk Size that changes the size of the chunks after it,
+// under limits that admit exactly that command.
+func TestReader_LargeCommandInterleaved(t *testing.T) {
+	cmd := make([]byte, 20000) // e.g. connect with a long swfUrl and pageUrl
+	for i := range cmd {
+		cmd[i] = byte(i * 7)
+	}
+	hdr, err := EncodeChunkHeader(&ChunkHeader{FMT: 0, CSID: 3, MessageLength: uint32(len(cmd)), MessageTypeID: 20}, nil)
+	if err != nil {
+		t.Fatalf("encode header: %v", err)
+	}
+	stream := append(hdr, cmd[:128]...)
+	stream = append(stream, buildMessageBytes(t, 2, 0, 5, 0, []byte{0, 0x26, 0x25, 0xA0})...) // Window Ack Size
+	stream = append(stream, 0xC3)
+	stream = append(stream, cmd[128:256]...)
+	stream = append(stream, buildMessageBytes(t, 2, 0, 1, 0, []byte{0, 0, 0x10, 0})...) // Set Chunk Size 4096
+	for off := 256; off < len(cmd); off += 4096 {
+		stream = append(stream, buildMessageBytes(t, 2, 0, 4, 0, []byte{0, 6, 0, 0, 0, 1})...) // Ping Request
+		stream = append(stream, 0xC3)
+		stream = append(stream, cmd[off:min(off+4096, len(cmd))]...)
+	}
+
+	r := NewReader(bytes.NewReader(stream), 128)
+	r.SetLimits(Limits{MaxMessageSize: 20000, MaxAMFMessageSize: 20000, MaxPendingBytes: 20000})
+	var types []uint8
+	for {
+		msg, err := r.ReadMessage()
+		if err != nil {
+			t.Fatalf("read after types %v: %v", types, err)
+		}
+		types = append(types, msg.TypeID)
+		if msg.TypeID == 20 {
+			if msg.CSID != 3 || !bytes.Equal(msg.Payload, cmd) {
+				t.Fatalf("command reassembled wrongly: csid %d, %d bytes", msg.CSID, len(msg.Payload))
+			}
+			break
+		}
+	}
+	if want := []uint8{5, 1, 4, 4, 4, 4, 4, 20}; !bytes.Equal(types, want) {
+		t.Fatalf("message order %v, want %v", types, want)
+	}
+	if r.chunkSize != 4096 {
+		t.Fatalf("chunk size %d, want 4096", r.chunkSize)
+	}
+
+	r = NewReader(bytes.NewReader(stream), 128)
+	r.SetLimits(Limits{MaxPendingBytes: 10000})
+	for {
+		if _, err := r.ReadMessage(); err != nil {
+			if !errors.Is(err, ErrLimitExceeded) {
+				t.Fatalf("pending limit: expected ErrLimitExceeded, got %v", err)
+			}
+			break
+		}
+	}
+}
+
+// TestReader_HeaderHandler verifies the handler sees every chunk header,
+// continuation chunks included, with inherited fields filled in.
+func TestReader_HeaderHandler(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, 128)
+	for _, ts := range []uint32{0, 40} {
+		msg := &Message{CSID: 6, Timestamp: ts, MessageLength: 300, TypeID: 9, MessageStreamID: 1, Payload: make([]byte, 300)}
+		if err := w.WriteMessage(msg); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	r := NewReader(&buf, 128)
+	var formats [4]int
+	r.SetHeaderHandler(func(h *ChunkHeader) {
+		formats[h.FMT]++
+		if h.CSID != 6 || h.MessageTypeID != 9 || h.MessageLength != 300 {
+			t.Errorf("header %+v lacks the inherited fields", *h)
+		}
+	})
+	for i := 0; i < 2; i++ {
+		if _, err := r.ReadMessage(); err != nil {
+			t.Fatalf("read %d: %v", i, err)
+		}
+	}
+	if formats[0] != 1 || formats[3] != 4 || formats[0]+formats[1]+formats[2]+formats[3] != 6 {
+		t.Fatalf("header formats %v, want one FMT0, four continuations and six chunks", formats)
+	}
+}
+
+func TestReader_ReadMessageContext(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	r := NewReader(server, 128)
+
+	// A message that arrives is returned as with ReadMessage.
+	go func() {
+		w := NewWriter(client, 128)
+		_ = w.WriteMessage(&Message{CSID: 3, TypeID: 20, MessageLength: 2, Payload: []byte("hi")})
+	}()
+	ctx, cancel := context.WithCancel(context.Background())
+	msg, err := r.ReadMessageContext(ctx)
+	if err != nil || string(msg.Payload) != "hi" {
+		t.Fatalf("ReadMessageContext = %v, %v", msg, err)
+	}
+
+	// Cancelling interrupts a read on a silent peer.
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	if _, err := r.ReadMessageContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled read = %v, want context.Canceled", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("cancelled read returned after %v", d)
+	}
+
+	// So does a deadline on the context, or one set on the Reader.
+	r = NewReader(server, 128)
+	short, stop := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer stop()
+	if _, err := r.ReadMessageContext(short); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("read past the context deadline = %v, want DeadlineExceeded", err)
+	}
+	if err := r.SetReadDeadline(time.Now().Add(20 * time.Millisecond)); err != nil {
+		t.Fatalf("SetReadDeadline: %v", err)
+	}
+	var netErr net.Error
+	if _, err := r.ReadMessage(); !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("read past the deadline = %v, want a timeout", err)
+	}
+
+	// Readers without deadline support can only be used without cancellation.
+	r = NewReader(bytes.NewReader(nil), 128)
+	live, stopLive := context.WithCancel(context.Background())
+	defer stopLive()
+	if _, err := r.ReadMessageContext(live); !errors.Is(err, ErrNoDeadline) {
+		t.Fatalf("ReadMessageContext without deadline support = %v", err)
+	}
+	if err := r.SetReadDeadline(time.Now()); !errors.Is(err, ErrNoDeadline) {
+		t.Fatalf("SetReadDeadline without deadline support = %v, want ErrNoDeadline", err)
+	}
+}
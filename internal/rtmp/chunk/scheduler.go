@@ -0,0 +1,88 @@
+package chunk
+
+// Interleaved chunk scheduling
+// ============================
+// Writer.WriteMessage sends every chunk of a message back-to-back, so a
+// 200 KB keyframe holds the socket for ~50 chunks while audio and control
+// messages wait behind it. RTMP allows chunks of different chunk streams to
+// be interleaved on the wire (the Reader already reassembles them), so the
+// Scheduler writes one chunk at a time, rotating round-robin across CSIDs.
+//
+// A chunk stream can only carry one message at a time: messages queued on the
+// same CSID are written in order, each one finishing before the next starts.
+
+import "errors"
+
+// Scheduler interleaves the chunks of queued messages across chunk streams.
+// Like Writer it is not concurrency-safe; it is driven by the write loop.
+type Scheduler struct {
+	w       *Writer
+	queues  map[uint32][]*outbound // per-CSID FIFO; head is the message in progress
+	ring    []uint32               // CSIDs with queued messages, in round-robin order
+	next    int                    // index into ring of the CSID to write next
+	pending int                    // total queued messages across all CSIDs
+}
+
+// NewScheduler creates a Scheduler that writes through w. The Writer's chunk
+// size and header compression state are shared with direct WriteMessage calls.
+func NewScheduler(w *Writer) *Scheduler {
+	return &Scheduler{w: w, queues: make(map[uint32][]*outbound)}
+}
+
+// Enqueue adds msg to its chunk stream's queue. No bytes are written until
+// WriteNext is called.
+func (s *Scheduler) Enqueue(msg *Message) error {
+	if s == nil {
+		return errors.New("scheduler: nil scheduler")
+	}
+	if err := s.w.validate(msg); err != nil {
+		return err
+	}
+	q, ok := s.queues[msg.CSID]
+	if !ok || len(q) == 0 {
+		s.ring = append(s.ring, msg.CSID)
+	}
+	s.queues[msg.CSID] = append(q, &outbound{msg: msg})
+	s.pending++
+	return nil
+}
+
+// Pending returns the number of messages not yet completely written.
+func (s *Scheduler) Pending() int { return s.pending }
+
+// WriteNext writes a single chunk from the next chunk stream in rotation. If
+// that chunk completes its message, the message is returned; otherwise the
+// result is nil. Calling WriteNext with nothing pending returns (nil, nil).
+func (s *Scheduler) WriteNext() (*Message, error) {
+	if len(s.ring) == 0 {
+		return nil, nil
+	}
+	if s.next >= len(s.ring) {
+		s.next = 0
+	}
+	csid := s.ring[s.next]
+	q := s.queues[csid]
+	out := q[0]
+	done, err := s.w.writeNextChunk(out)
+	if err != nil {
+		return nil, err
+	}
+	if !done {
+		s.next++
+		return nil, nil
+	}
+
+	s.pending--
+	q[0] = nil
+	q = q[1:]
+	if len(q) > 0 {
+		s.queues[csid] = q
+		s.next++
+		return out.msg, nil
+	}
+	// Chunk stream drained: drop it from the rotation. next now points at
+	// the CSID that followed it, so the rotation order is preserved.
+	delete(s.queues, csid)
+	s.ring = append(s.ring[:s.next], s.ring[s.next+1:]...)
+	return out.msg, nil
+}
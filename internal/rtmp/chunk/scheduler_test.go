@@ -0,0 +1,130 @@
+// scheduler_test.go – tests for the interleaving chunk Scheduler.
+//
+// The Scheduler writes one chunk per WriteNext call, rotating across chunk
+// streams so a large message cannot starve smaller ones. These tests feed
+// its output through a Reader to prove the interleaved byte stream is
+// still valid RTMP and that messages complete in the expected order.
+package chunk
+
+import (
+	"bytes"
+	"testing"
+)
+
+// drainScheduler calls WriteNext until nothing is pending and returns the
+// messages in the order they completed.
+func drainScheduler(t *testing.T, s *Scheduler) []*Message {
+	t.Helper()
+	var done []*Message
+	for i := 0; s.Pending() > 0; i++ {
+		if i > 10000 {
+			t.Fatalf("scheduler did not drain")
+		}
+		m, err := s.WriteNext()
+		if err != nil {
+			t.Fatalf("WriteNext: %v", err)
+		}
+		if m != nil {
+			done = append(done, m)
+		}
+	}
+	return done
+}
+
+// TestScheduler_SmallMessageNotStarved queues a large video message followed
+// by an audio message on another CSID. The audio message must complete after
+// only a couple of video chunks have gone out.
+func TestScheduler_SmallMessageNotStarved(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewScheduler(NewWriter(&buf, 128))
+
+	video := bytes.Repeat([]byte{0xAB}, 128*20)
+	audio := []byte{0xAF, 0x01, 0x02, 0x03}
+	if err := s.Enqueue(&Message{CSID: 6, TypeID: 9, MessageStreamID: 1, Timestamp: 40, Payload: video}); err != nil {
+		t.Fatalf("enqueue video: %v", err)
+	}
+	if err := s.Enqueue(&Message{CSID: 4, TypeID: 8, MessageStreamID: 1, Timestamp: 40, Payload: audio}); err != nil {
+		t.Fatalf("enqueue audio: %v", err)
+	}
+	done := drainScheduler(t, s)
+	if len(done) != 2 || done[0].TypeID != 8 || done[1].TypeID != 9 {
+		t.Fatalf("unexpected completion order: %+v", done)
+	}
+
+	r := NewReader(&buf, 128)
+	first, err := r.ReadMessage()
+	if err != nil {
+		t.Fatalf("read first: %v", err)
+	}
+	if first.TypeID != 8 || !bytes.Equal(first.Payload, audio) {
+		t.Fatalf("expected audio first, got type=%d len=%d", first.TypeID, len(first.Payload))
+	}
+	second, err := r.ReadMessage()
+	if err != nil {
+		t.Fatalf("read second: %v", err)
+	}
+	if second.TypeID != 9 || !bytes.Equal(second.Payload, video) {
+		t.Fatalf("video payload mismatch (type=%d len=%d)", second.TypeID, len(second.Payload))
+	}
+}
+
+// TestScheduler_SameCSIDInOrder verifies messages on one chunk stream are
+// written sequentially (never interleaved with each other) and round-trip
+// with correct header compression.
+func TestScheduler_SameCSIDInOrder(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewScheduler(NewWriter(&buf, 64))
+
+	var want [][]byte
+	for i := 0; i < 3; i++ {
+		p := bytes.Repeat([]byte{byte(i + 1)}, 150)
+		want = append(want, p)
+		if err := s.Enqueue(&Message{CSID: 6, TypeID: 9, MessageStreamID: 1, Timestamp: uint32(i * 33), Payload: p}); err != nil {
+			t.Fatalf("enqueue %d: %v", i, err)
+		}
+	}
+	if err := s.Enqueue(&Message{CSID: 2, TypeID: 5, Payload: []byte{0, 0, 0, 1}}); err != nil {
+		t.Fatalf("enqueue control: %v", err)
+	}
+	drainScheduler(t, s)
+
+	r := NewReader(&buf, 64)
+	var got [][]byte
+	for i := 0; i < 4; i++ {
+		m, err := r.ReadMessage()
+		if err != nil {
+			t.Fatalf("read %d: %v", i, err)
+		}
+		if m.CSID == 6 {
+			if m.Timestamp != uint32(len(got)*33) {
+				t.Fatalf("message %d timestamp=%d", len(got), m.Timestamp)
+			}
+			got = append(got, m.Payload)
+		}
+	}
+	if len(got) != 3 {
+		t.Fatalf("got %d video messages, want 3", len(got))
+	}
+	for i := range want {
+		if !bytes.Equal(got[i], want[i]) {
+			t.Fatalf("message %d payload mismatch", i)
+		}
+	}
+}
+
+// TestScheduler_Empty verifies WriteNext is a no-op with nothing queued and
+// Enqueue rejects an inconsistent message.
+func TestScheduler_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewScheduler(NewWriter(&buf, 128))
+	m, err := s.WriteNext()
+	if m != nil || err != nil || buf.Len() != 0 {
+		t.Fatalf("expected no-op, got msg=%v err=%v len=%d", m, err, buf.Len())
+	}
+	if err := s.Enqueue(&Message{CSID: 3, MessageLength: 10, Payload: []byte{1}}); err == nil {
+		t.Fatalf("expected length mismatch error")
+	}
+	if s.Pending() != 0 {
+		t.Fatalf("pending=%d after rejected enqueue", s.Pending())
+	}
+}
@@ -8,7 +8,8 @@ package chunk
 //  FMT0: absolute timestamp; new message (all header fields present)
 //  FMT1: timestamp delta; new message (length + type present, stream id reused)
 //  FMT2: timestamp delta only; new message (length, type, stream id reused)
-//  FMT3: continuation chunk for the *current* (in‑flight) message – no header field changes
+//  FMT3: continuation chunk for the *current* (in‑flight) message – no header field changes,
+//        or a new message repeating the previous header (the previous delta is applied again)
 //
 // Message completion is signalled when bytesReceived == lastMsgLength. At that point
 // a *Message is returned (payload copied). Header field values remain so they can be
@@ -20,6 +21,9 @@ import (
 	protoerr "github.com/alxayo/go-rtmp/internal/errors"
 )
 
+// maxInitialBuffer caps the up-front allocation for a message's assembly buffer.
+const maxInitialBuffer = 64 * 1024
+
 // ChunkStreamState holds rolling state for a single chunk stream (CSID).
 // Fields exported to aid white-box testing & potential observability.
 type ChunkStreamState struct {
@@ -31,7 +35,8 @@ type ChunkStreamState struct {
 
 	buffer        []byte
 	bytesReceived uint32
-	inProgress    bool // true while assembling a multi-chunk message
+	inProgress    bool   // true while assembling a multi-chunk message
+	lastDelta     uint32 // timestamp delta of the last FMT1/2 message (0 after FMT0)
 }
 
 // ResetBuffer clears the assembly buffer but keeps header context (used after message extraction).
@@ -59,6 +64,7 @@ func (s *ChunkStreamState) ApplyHeader(h *ChunkHeader) error {
 	switch h.FMT {
 	case 0: // full header – absolute timestamp
 		s.LastTimestamp = h.Timestamp
+		s.lastDelta = 0
 		s.LastMsgLength = h.MessageLength
 		s.LastMsgTypeID = h.MessageTypeID
 		s.LastMsgStreamID = h.MessageStreamID
@@ -72,8 +78,9 @@ func (s *ChunkStreamState) ApplyHeader(h *ChunkHeader) error {
 			// First message on this CSID: treat timestamp as absolute
 			s.LastTimestamp = h.Timestamp
 		} else {
-			// Subsequent message: timestamp is delta
+			// Subsequent message: timestamp is delta (wraps at 2^32)
 			s.LastTimestamp += h.Timestamp
+			s.lastDelta = h.Timestamp
 		}
 		s.LastMsgLength = h.MessageLength
 		s.LastMsgTypeID = h.MessageTypeID
@@ -85,6 +92,7 @@ func (s *ChunkStreamState) ApplyHeader(h *ChunkHeader) error {
 			return protoerr.NewChunkError("state.apply_header", fmt.Errorf("FMT2 without prior state"))
 		}
 		s.LastTimestamp += h.Timestamp
+		s.lastDelta = h.Timestamp
 		s.ResetBuffer()
 		s.inProgress = true
 	case 3: // continuation OR new message with same header
@@ -95,7 +103,9 @@ func (s *ChunkStreamState) ApplyHeader(h *ChunkHeader) error {
 			return protoerr.NewChunkError("state.apply_header", fmt.Errorf("FMT3 without prior header state"))
 		}
 		if !s.inProgress {
-			// Starting a new message (case 2) - reuse all cached header fields
+			// Starting a new message (case 2) - reuse all cached header fields;
+			// its timestamp advances by the previous delta, as for FMT2
+			s.LastTimestamp += s.lastDelta
 			s.ResetBuffer()
 			s.inProgress = true
 		}
@@ -116,12 +126,17 @@ func (s *ChunkStreamState) AppendChunkData(data []byte) (bool, *Message, error)
 	if !s.inProgress {
 		return false, nil, protoerr.NewChunkError("state.append", fmt.Errorf("no active message"))
 	}
-	// Lazy allocate capacity for entire message to avoid repeated growth.
+	// Lazy allocate capacity for the message to avoid repeated growth. The
+	// hint is capped so a peer declaring a huge length must actually send the
+	// bytes before memory is committed; larger messages grow via append.
 	if s.buffer == nil {
 		capHint := s.LastMsgLength
 		if capHint == 0 {
 			capHint = uint32(len(data))
 		}
+		if capHint > maxInitialBuffer {
+			capHint = maxInitialBuffer
+		}
 		s.buffer = make([]byte, 0, capHint)
 	}
 	if s.bytesReceived+uint32(len(data)) > s.LastMsgLength {
@@ -130,14 +145,12 @@ func (s *ChunkStreamState) AppendChunkData(data []byte) (bool, *Message, error)
 	s.buffer = append(s.buffer, data...)
 	s.bytesReceived += uint32(len(data))
 	if s.bytesReceived == s.LastMsgLength { // complete
-		msg := &Message{
-			CSID:            s.CSID,
-			Timestamp:       s.LastTimestamp,
-			MessageLength:   s.LastMsgLength,
-			TypeID:          s.LastMsgTypeID,
-			MessageStreamID: s.LastMsgStreamID,
-			Payload:         append([]byte(nil), s.buffer...), // copy
-		}
+		msg := &Message{Payload: append([]byte(nil), s.buffer...)} // copy
+		msg.CSID = s.CSID
+		msg.Timestamp = s.LastTimestamp
+		msg.MessageLength = s.LastMsgLength
+		msg.TypeID = s.LastMsgTypeID
+		msg.MessageStreamID = s.LastMsgStreamID
 		// Keep header fields, clear assembly state.
 		s.ResetBuffer()
 		return true, msg, nil
@@ -7,7 +7,8 @@
 //	FMT 0: Sets all fields (absolute timestamp).
 //	FMT 1: Adds delta timestamp, updates length/type, inherits stream ID.
 //	FMT 2: Adds delta timestamp only, inherits all other fields.
-//	FMT 3: Inherits everything (continuation chunk).
+//	FMT 3: Inherits everything (continuation chunk); a new message repeats
+//	       the previous delta.
 //
 // Key concepts demonstrated:
 //   - t.Run subtests for organized test output and selective execution.
@@ -186,3 +187,45 @@ func TestChunkStreamState_Flow(t *testing.T) {
 		}
 	})
 }
+
+// TestChunkStreamState_FMT3NewMessageRepeatsDelta verifies a new message
+// sent with an FMT3 header advances by the previous FMT2 delta, and that
+// deltas wrap at 2^32 instead of overflowing.
+func TestChunkStreamState_FMT3NewMessageRepeatsDelta(t *testing.T) {
+	var s ChunkStreamState
+	steps := []struct {
+		hdr  *ChunkHeader
+		want uint32
+	}{
+		{h(0, 4, 0xFFFFFFE0, 1, 8, 1), 0xFFFFFFE0},
+		{h(2, 4, 0x15, 0, 0, 0), 0xFFFFFFF5},
+		{h(3, 4, 0, 0, 0, 0), 0x0A}, // +0x15 again, rolled over
+	}
+	for i, st := range steps {
+		if err := s.ApplyHeader(st.hdr); err != nil {
+			t.Fatalf("step %d apply: %v", i, err)
+		}
+		_, msg, err := s.AppendChunkData([]byte{0xAF})
+		if err != nil || msg == nil {
+			t.Fatalf("step %d: expected complete message (err %v)", i, err)
+		}
+		if msg.Timestamp != st.want {
+			t.Fatalf("step %d timestamp = %#x, want %#x", i, msg.Timestamp, st.want)
+		}
+	}
+}
+
+// TestChunkStreamState_CapsInitialBuffer ensures a huge declared message
+// length does not commit the full allocation before bytes arrive.
+func TestChunkStreamState_CapsInitialBuffer(t *testing.T) {
+	s := &ChunkStreamState{}
+	if err := s.ApplyHeader(&ChunkHeader{FMT: 0, CSID: 4, MessageLength: 16 << 20, MessageTypeID: 9}); err != nil {
+		t.Fatalf("apply header: %v", err)
+	}
+	if _, _, err := s.AppendChunkData(make([]byte, 128)); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	if c := cap(s.buffer); c > maxInitialBuffer {
+		t.Fatalf("initial buffer cap %d exceeds %d", c, maxInitialBuffer)
+	}
+}
@@ -1,5 +1,7 @@
 package chunk
 
+import "time"
+
 // Message represents a fully reassembled RTMP message after chunk-level
 // reassembly. RTMP splits large messages into smaller "chunks" for
 // transmission; the Reader reassembles them back into complete Messages.
@@ -13,4 +15,13 @@ type Message struct {
 	TypeID          uint8  // Message type: 1-6=control, 8=audio, 9=video, 20=AMF0 command
 	MessageStreamID uint32 // Identifies the application-level stream (0=control, 1+=media)
 	Payload         []byte // The actual message data (audio frame, video frame, command, etc.)
+
+	// Ingest is when the server received this media message from its
+	// publisher, carried along to subscriber and relay copies so delivery
+	// latency can be measured. Zero unless latency tracking is enabled; it
+	// is never sent on the wire.
+	Ingest time.Time
+
+	ref        *payloadRef   // reference count of a pooled Payload (nil = not pooled); see pool.go
+	prechunked []*prechunked // shared chunk layouts of Payload; see prechunk.go
 }
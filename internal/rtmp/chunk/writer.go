@@ -160,10 +160,12 @@ func NewWriter(w io.Writer, chunkSize uint32) *Writer {
 	}
 }
 
-// SetChunkSize updates the outbound chunk size (validated to sane bounds).
+// SetChunkSize updates the outbound chunk size. Sizes outside
+// 1-MaxChunkSize are ignored; sizes above the largest message length
+// behave as that length, as on the Reader.
 func (w *Writer) SetChunkSize(size uint32) {
-	if size >= 1 && size <= 65536 {
-		w.chunkSize = size
+	if size >= 1 && size <= MaxChunkSize {
+		w.chunkSize = min(size, maxMessageLength)
 	}
 }
 
@@ -174,6 +176,21 @@ func (w *Writer) SetChunkSize(size uint32) {
 //   - FMT2: When only timestamp changes (delta timestamp)
 //   - FMT3: Continuation chunks within same message OR identical header reuse
 func (w *Writer) WriteMessage(msg *Message) error {
+	if err := w.validate(msg); err != nil {
+		return err
+	}
+	out := &outbound{msg: msg}
+	for {
+		done, err := w.writeNextChunk(out)
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// validate checks that the writer and message are usable, filling in
+// MessageLength from the payload when it is zero.
+func (w *Writer) validate(msg *Message) error {
 	if w == nil || w.w == nil {
 		return errors.New("writer: nil underlying writer")
 	}
@@ -186,10 +203,78 @@ func (w *Writer) WriteMessage(msg *Message) error {
 	if int(msg.MessageLength) != len(msg.Payload) {
 		return fmt.Errorf("writer: payload length %d != declared %d", len(msg.Payload), msg.MessageLength)
 	}
+	return nil
+}
+
+// outbound tracks a message part-way through being written. first is nil
+// until the first chunk (which carries the full header) has been sent.
+// pre is the message's shared framing the continuation chunks are written
+// from, if it has one for this Writer (see prechunk.go); off is the offset
+// of the next continuation chunk in it.
+type outbound struct {
+	msg     *Message
+	first   *ChunkHeader
+	written uint32
+	pre     *prechunked
+	off     int
+}
+
+// writeNextChunk writes the next chunk of out and reports whether the
+// message is now complete. The chunk size is read per chunk, so a size
+// change takes effect mid-message exactly as it does on the reading side.
+func (w *Writer) writeNextChunk(out *outbound) (bool, error) {
 	cs := w.chunkSize
 	if cs == 0 {
 		cs = 128
 	}
+	msg := out.msg
+	if out.first == nil {
+		if err := w.writeFirstChunk(out, cs); err != nil {
+			return false, err
+		}
+		return out.written >= msg.MessageLength, nil
+	}
+
+	// Continuation chunks (FMT3)
+	remain := msg.MessageLength - out.written
+	sz := remain
+	if sz > cs {
+		sz = cs
+	}
+	if p := out.pre; p != nil {
+		if p.chunkSize == cs {
+			end := out.off + p.hdrLen + int(sz)
+			if _, err := w.w.Write(p.body[out.off:end]); err != nil {
+				return false, err
+			}
+			out.off = end
+			out.written += sz
+			return out.written >= msg.MessageLength, nil
+		}
+		// The chunk size changed mid-message: chunk the rest here.
+		out.pre = nil
+	}
+	cont := &ChunkHeader{FMT: fmt3, CSID: msg.CSID}
+	hdr3, err := EncodeChunkHeader(cont, out.first)
+	if err != nil {
+		return false, fmt.Errorf("writer: encode continuation header: %w", err)
+	}
+	start := out.written
+	end := out.written + sz
+	if end > uint32(len(msg.Payload)) {
+		return false, fmt.Errorf("writer: bounds (end=%d > len=%d)", end, len(msg.Payload))
+	}
+	if err := w.writeChunk(hdr3, msg.Payload[start:end]); err != nil {
+		return false, err
+	}
+	out.written = end
+	return out.written >= msg.MessageLength, nil
+}
+
+// writeFirstChunk selects the header format, writes the first chunk of
+// out.msg and records the header as the CSID's compression state.
+func (w *Writer) writeFirstChunk(out *outbound, cs uint32) error {
+	msg := out.msg
 
 	// Select FMT based on previous state for this CSID.
 	//
@@ -208,11 +293,15 @@ func (w *Writer) WriteMessage(msg *Message) error {
 	var timestampDelta uint32 = msg.Timestamp
 	prev := w.lastHeaders[msg.CSID]
 
-	if prev != nil {
+	// FMT1/2 inherit the previous message stream ID, so a message for a
+	// different stream on the same CSID (e.g. publish after createStream on
+	// the command CSID) needs a full FMT0 header. Deltas are unsigned, so a
+	// timestamp that went backwards (encoder reset, 32-bit rollover) is also
+	// sent absolute rather than as a huge wrapped delta.
+	if prev != nil && msg.MessageStreamID == prev.MessageStreamID && msg.Timestamp >= prev.Timestamp {
 		// We have previous state for this CSID - determine optimal FMT
 		if msg.MessageLength == prev.MessageLength &&
-			msg.TypeID == prev.MessageTypeID &&
-			msg.MessageStreamID == prev.MessageStreamID {
+			msg.TypeID == prev.MessageTypeID {
 			// Only timestamp changed - use FMT2 (delta timestamp only)
 			selectedFmt = fmt2
 			timestampDelta = msg.Timestamp - prev.Timestamp
@@ -232,13 +321,10 @@ func (w *Writer) WriteMessage(msg *Message) error {
 		MessageTypeID:   msg.TypeID,
 		MessageStreamID: msg.MessageStreamID,
 	}
-	if msg.Timestamp >= extendedTimestampMarker {
-		first.HasExtendedTimestamp = true
-		// For FMT1/2 with extended timestamp, use actual timestamp value
-		if selectedFmt == fmt1 || selectedFmt == fmt2 {
-			first.Timestamp = msg.Timestamp
-		}
-	}
+	// The extended field carries whatever the 24-bit field would have: the
+	// absolute timestamp for FMT0, the delta for FMT1/2. Continuation chunks
+	// repeat it.
+	first.HasExtendedTimestamp = first.Timestamp >= extendedTimestampMarker
 
 	hdr, err := EncodeChunkHeader(first, prev)
 	if err != nil {
@@ -251,7 +337,15 @@ func (w *Writer) WriteMessage(msg *Message) error {
 	if err := w.writeChunk(hdr, toSend); err != nil {
 		return err
 	}
-	written := uint32(len(toSend))
+	out.first = first
+	out.written = uint32(len(toSend))
+	// Continuation chunks repeat an extended timestamp, which the shared
+	// framing leaves out.
+	if !first.HasExtendedTimestamp {
+		if out.pre = msg.framing(msg.CSID, cs); out.pre != nil {
+			out.off = len(toSend)
+		}
+	}
 
 	// Store this header as the new "last" header for this CSID
 	// Use absolute timestamp for state tracking
@@ -265,29 +359,6 @@ func (w *Writer) WriteMessage(msg *Message) error {
 		HasExtendedTimestamp: first.HasExtendedTimestamp,
 	}
 	w.lastHeaders[msg.CSID] = lastHeader
-
-	// Continuation chunks (FMT3)
-	for written < msg.MessageLength {
-		remain := msg.MessageLength - written
-		sz := remain
-		if sz > cs {
-			sz = cs
-		}
-		cont := &ChunkHeader{FMT: fmt3, CSID: msg.CSID}
-		hdr3, err := EncodeChunkHeader(cont, first)
-		if err != nil {
-			return fmt.Errorf("writer: encode continuation header: %w", err)
-		}
-		start := written
-		end := written + sz
-		if end > uint32(len(msg.Payload)) {
-			return fmt.Errorf("writer: bounds (end=%d > len=%d)", end, len(msg.Payload))
-		}
-		if err := w.writeChunk(hdr3, msg.Payload[start:end]); err != nil {
-			return err
-		}
-		written = end
-	}
 	return nil
 }
 
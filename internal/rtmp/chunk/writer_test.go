@@ -327,6 +327,60 @@ func TestWriter_StatefulFMTSelection(t *testing.T) {
 	}
 }
 
+// TestWriter_StreamIDChangeUsesFMT0 verifies that a message for a different
+// message stream on the same CSID is sent with a full header, since FMT1/2
+// would make the reader reuse the previous stream ID.
+func TestWriter_StreamIDChangeUsesFMT0(t *testing.T) {
+	var sw simpleWriter
+	w := NewWriter(&sw, 128)
+	createStream := &Message{CSID: 3, TypeID: 20, MessageStreamID: 0, MessageLength: 10, Payload: make([]byte, 10)}
+	publish := &Message{CSID: 3, TypeID: 20, MessageStreamID: 1, MessageLength: 20, Payload: make([]byte, 20)}
+	for _, m := range []*Message{createStream, publish} {
+		if err := w.WriteMessage(m); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	raw := sw.Bytes()
+	if fmtBits := raw[1+11+10] >> 6; fmtBits != 0 {
+		t.Fatalf("second message: expected FMT0, got FMT%d", fmtBits)
+	}
+	r := NewReader(bytes.NewReader(raw), 128)
+	_, _ = r.ReadMessage()
+	got, err := r.ReadMessage()
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if got.MessageStreamID != 1 {
+		t.Fatalf("MessageStreamID = %d, want 1", got.MessageStreamID)
+	}
+}
+
+// TestWriter_TimestampEdgesRoundTrip verifies timestamps past the 24-bit
+// field (extended deltas), backward steps and 32-bit rollover survive a
+// Writer→Reader round trip, including multi-chunk messages.
+func TestWriter_TimestampEdgesRoundTrip(t *testing.T) {
+	var sw simpleWriter
+	w := NewWriter(&sw, 128)
+	stamps := []uint32{0xFFFFF0, 0x1000000, 0x1000021, 500, 530, 0xFFFFFFF0, 0x10}
+	for _, ts := range stamps {
+		msg := &Message{CSID: 6, TypeID: 9, MessageStreamID: 1, Timestamp: ts, MessageLength: 300, Payload: make([]byte, 300)}
+		if err := w.WriteMessage(msg); err != nil {
+			t.Fatalf("write ts %#x: %v", ts, err)
+		}
+	}
+	r := NewReader(bytes.NewReader(sw.Bytes()), 128)
+	for _, ts := range stamps {
+		msg, err := r.ReadMessage()
+		if err != nil {
+			t.Fatalf("read ts %#x: %v", ts, err)
+		}
+		if msg.Timestamp != ts {
+			t.Fatalf("timestamp = %#x, want %#x", msg.Timestamp, ts)
+		}
+	}
+}
+
 // TestWriter_ChunkReaderRoundTrip is an end-to-end test: write multiple
 // messages through the Writer, then read them back through the Reader and
 // compare every field. This proves the Writer output is fully compliant
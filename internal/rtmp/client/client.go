@@ -41,6 +41,7 @@ import (
 	"sync"
 	"time"
 
+	rerrors "github.com/alxayo/go-rtmp/internal/errors"
 	"github.com/alxayo/go-rtmp/internal/logger"
 	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
 	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
@@ -48,15 +49,21 @@ import (
 	"github.com/alxayo/go-rtmp/internal/rtmp/rpc"
 )
 
-// DialTimeout used for TCP connections.
+// DialTimeout used for TCP connections (including any proxy and TLS
+// negotiation).
 const DialTimeout = 5 * time.Second
 
+// CommandTimeout bounds the wait for each _result/_error reply during
+// Connect (connect and createStream).
+const CommandTimeout = 10 * time.Second
+
 // Default outbound chunk size – starts with 128 until the server potentially issues Set Chunk Size.
 const defaultChunkSize = 128
 
 // Chunk stream IDs per RTMP convention.
 const (
 	commandCSID = 3 // commands (connect, createStream, publish, play)
+	dataCSID    = 5 // data messages (onMetaData, onCuePoint, ...)
 	audioCSID   = 6 // audio data
 	videoCSID   = 7 // video data
 )
@@ -81,6 +88,39 @@ type Client struct {
 	// for self-signed certs in tests). When nil, the default tls.Config is used.
 	TLSConfig *tls.Config
 
+	// ProxyURL tunnels the connection through an egress proxy:
+	// socks5://[user:pass@]host:port or http://[user:pass@]host:port (HTTP
+	// CONNECT). Empty dials the server directly. See ParseProxyURL.
+	ProxyURL string
+
+	// DialContext opens the TCP connection to the server, or to the proxy
+	// when ProxyURL is set. When nil, a net.Dialer is used.
+	DialContext DialFunc
+
+	// Network, when set, imposes simulated latency, bandwidth limits or
+	// disconnects on the connection to the server (or to the proxy). For
+	// tests; see NetworkConditions.
+	Network *NetworkConditions
+
+	// ConnectTimeout bounds the whole Connect sequence (dial, handshake,
+	// connect and createStream). Zero leaves only the per-phase limits.
+	ConnectTimeout time.Duration
+
+	// PublishingType is sent with publish: "live" (the default when
+	// empty), "record" or "append".
+	PublishingType string
+
+	// PlayStart is the start argument sent with play, in milliseconds.
+	// Zero sends -2 (live, or recorded if not live). A negative offset
+	// such as -30000 asks a server with a DVR window to start 30s behind
+	// live.
+	PlayStart float64
+
+	// Pacer, when set, makes SendAudio, SendVideo and SendData wait until
+	// their timestamp is due, as a live encoder sends, instead of writing
+	// at once. See pacing.go.
+	Pacer *Pacer
+
 	trxMu sync.Mutex // protects trxID from concurrent access
 	trxID float64    // incrementing transaction ID for request-response matching
 }
@@ -95,13 +135,16 @@ func New(rawurl string) (*Client, error) {
 	if err != nil {
 		return nil, err
 	}
-	// Path expected: /app/streamName
-	parts := strings.Split(strings.TrimPrefix(u.Path, "/"), "/")
-	if len(parts) < 2 {
+	// Path expected: /app/streamName. The first segment is the app; the rest
+	// is the stream name verbatim, so keys containing slashes or a query
+	// string (e.g. "FB-123?s_bl=1") reach the server unchanged.
+	app, stream, ok := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+	if !ok || app == "" || stream == "" {
 		return nil, fmt.Errorf("rtmp url must be rtmp[s]://host/app/stream")
 	}
-	app := parts[0]
-	stream := strings.Join(parts[1:], "/")
+	if u.RawQuery != "" {
+		stream += "?" + u.RawQuery
+	}
 	c := &Client{
 		url:       u,
 		app:       app,
@@ -113,14 +156,40 @@ func New(rawurl string) (*Client, error) {
 	return c, nil
 }
 
+// SetLogger replaces the logger the client writes to, e.g. to tag relay
+// logs with the destination or silence a client entirely. The
+// "component" attribute is added here as it is for the default logger.
+// A nil logger restores the shared default. Call before Connect.
+func (c *Client) SetLogger(l *slog.Logger) {
+	if l == nil {
+		l = logger.Logger()
+	}
+	c.log = l.With("component", "rtmp_client")
+}
+
 // nextTrx increments and returns the next transaction ID (AMF0 number semantics).
 func (c *Client) nextTrx() float64 { c.trxMu.Lock(); defer c.trxMu.Unlock(); c.trxID++; return c.trxID }
 
-// Connect performs TCP dial (plain or TLS), RTMP simple handshake, then sends connect + createStream.
-func (c *Client) Connect() error {
+// Connect is ConnectContext with a background context.
+func (c *Client) Connect() error { return c.ConnectContext(context.Background()) }
+
+// ConnectContext performs TCP dial (plain or TLS), RTMP simple handshake,
+// then sends connect + createStream.
+//
+// Cancelling ctx aborts the sequence at any point. Each phase also has its
+// own limit (DialTimeout, the handshake's I/O timeouts, CommandTimeout per
+// reply), and ConnectTimeout, when set, bounds the whole sequence. Failures
+// are returned as *ConnectError naming the phase that failed; the client is
+// left disconnected.
+func (c *Client) ConnectContext(ctx context.Context) error {
 	if c.conn != nil {
 		return nil
 	}
+	if c.ConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.ConnectTimeout)
+		defer cancel()
+	}
 	host := c.url.Host
 	if !strings.Contains(host, ":") {
 		if c.useTLS {
@@ -130,49 +199,76 @@ func (c *Client) Connect() error {
 		}
 	}
 
-	var conn net.Conn
-	var err error
-	if c.useTLS {
-		tlsCfg := c.TLSConfig
-		if tlsCfg == nil {
-			tlsCfg = &tls.Config{}
-		}
-		dialer := &tls.Dialer{
-			NetDialer: &net.Dialer{Timeout: DialTimeout},
-			Config:    tlsCfg,
-		}
-		conn, err = dialer.DialContext(context.Background(), "tcp", host)
-	} else {
-		d := net.Dialer{Timeout: DialTimeout}
-		conn, err = d.Dial("tcp", host)
-	}
+	conn, err := c.dial(ctx, host)
 	if err != nil {
-		return fmt.Errorf("dial: %w", err)
+		return c.connectFailed(ctx, PhaseDial, 0, err)
 	}
 	c.conn = conn
 	c.writer = chunk.NewWriter(conn, defaultChunkSize)
 	c.reader = chunk.NewReader(conn, defaultChunkSize)
 
+	// The handshake and reply reads block on the socket; closing it is what
+	// interrupts them when ctx is cancelled.
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
 	if err := handshake.ClientHandshake(conn); err != nil {
-		_ = conn.Close()
-		return err
+		return c.connectFailed(ctx, PhaseHandshake, 0, err)
 	}
 
+	c.setCommandDeadline(ctx)
 	if err := c.sendConnectAndWaitResponse(); err != nil {
-		return err
+		return c.connectFailed(ctx, PhaseRPC, CommandTimeout, err)
 	}
+	c.setCommandDeadline(ctx)
 	if err := c.sendCreateStreamAndWaitResponse(); err != nil {
-		return err
+		return c.connectFailed(ctx, PhaseRPC, CommandTimeout, err)
+	}
+	if !stop() {
+		// ctx was cancelled as the last reply arrived and the socket is
+		// already closed.
+		return c.connectFailed(ctx, PhaseRPC, 0, ctx.Err())
 	}
+	_ = conn.SetDeadline(time.Time{})
 	return nil
 }
 
+// setCommandDeadline gives the next command reply CommandTimeout to arrive,
+// or less if ctx expires sooner.
+func (c *Client) setCommandDeadline(ctx context.Context) {
+	dl := time.Now().Add(CommandTimeout)
+	if ctxDl, ok := ctx.Deadline(); ok && ctxDl.Before(dl) {
+		dl = ctxDl
+	}
+	_ = c.conn.SetDeadline(dl)
+}
+
+// connectFailed closes the connection and wraps err in a ConnectError for
+// phase. When ctx is done its error is reported as the cause, since the
+// socket error is only a side effect of the cancellation. A phase deadline
+// expiring is reported as a TimeoutError of limit.
+func (c *Client) connectFailed(ctx context.Context, phase ConnectPhase, limit time.Duration, err error) error {
+	_ = c.Close()
+	cerr := ctx.Err()
+	if dl, ok := ctx.Deadline(); ok && cerr == nil && rerrors.IsTimeout(err) && !time.Now().Before(dl) {
+		// The socket deadline was ctx's own and fired a moment before ctx
+		// noticed it expired.
+		cerr = context.DeadlineExceeded
+	}
+	if cerr != nil && !errors.Is(err, cerr) {
+		err = fmt.Errorf("%w (%v)", cerr, err)
+	} else if limit > 0 && rerrors.IsTimeout(err) {
+		err = rerrors.NewTimeoutError(string(phase), limit, err)
+	}
+	return &ConnectError{Phase: phase, Err: err}
+}
+
 func (c *Client) sendConnect() error {
 	trx := c.nextTrx()
 	cmdObj := map[string]interface{}{
 		"app":            c.app,
 		"type":           "nonprivate",
-		"tcUrl":          c.url.String(),
+		"tcUrl":          c.tcURL(),
 		"fpad":           false,
 		"capabilities":   15.0,
 		"audioCodecs":    0.0,
@@ -190,6 +286,12 @@ func (c *Client) sendConnect() error {
 	return c.writer.WriteMessage(msg)
 }
 
+// tcURL is the connect command's tcUrl: the server URL up to and including
+// the app, without the stream key.
+func (c *Client) tcURL() string {
+	return c.url.Scheme + "://" + c.url.Host + "/" + c.app
+}
+
 func (c *Client) sendCreateStream() error {
 	trx := c.nextTrx()
 	payload, err := amf.EncodeAll("createStream", trx, nil)
@@ -284,8 +386,12 @@ func (c *Client) Publish() error {
 		return errors.New("client not connected")
 	}
 	name := strings.TrimPrefix(c.streamKey, c.app+"/")
-	c.log.Debug("sending publish command", "stream", name)
-	payload, err := amf.EncodeAll("publish", float64(0), nil, name, "live")
+	pubType := c.PublishingType
+	if pubType == "" {
+		pubType = "live"
+	}
+	c.log.Debug("sending publish command", "stream", name, "type", pubType)
+	payload, err := amf.EncodeAll("publish", float64(0), nil, name, pubType)
 	if err != nil {
 		return err
 	}
@@ -304,7 +410,11 @@ func (c *Client) Play() error {
 	}
 	name := strings.TrimPrefix(c.streamKey, c.app+"/")
 	// Standard play argument pattern: name, start=-2 (live), duration=-1 (all), reset=false
-	payload, err := amf.EncodeAll("play", float64(0), nil, name, float64(-2), float64(-1), false)
+	start := c.PlayStart
+	if start == 0 {
+		start = -2
+	}
+	payload, err := amf.EncodeAll("play", float64(0), nil, name, start, float64(-1), false)
 	if err != nil {
 		return err
 	}
@@ -312,6 +422,21 @@ func (c *Client) Play() error {
 	return c.writer.WriteMessage(msg)
 }
 
+// DeleteStream releases the client's stream with deleteStream, ending its
+// publish or play while the connection stays open. Players of a stream
+// being published are told it was unpublished.
+func (c *Client) DeleteStream() error {
+	if c.conn == nil {
+		return errors.New("client not connected")
+	}
+	payload, err := amf.EncodeAll("deleteStream", float64(0), nil, float64(c.streamID))
+	if err != nil {
+		return err
+	}
+	msg := &chunk.Message{CSID: commandCSID, TypeID: rpc.CommandMessageAMF0TypeIDForTest(), MessageStreamID: 0, MessageLength: uint32(len(payload)), Payload: payload}
+	return c.writer.WriteMessage(msg)
+}
+
 // SendAudio sends a raw audio message (TypeID=8) with caller-provided payload.
 func (c *Client) SendAudio(ts uint32, data []byte) error {
 	if c.conn == nil {
@@ -323,6 +448,9 @@ func (c *Client) SendAudio(ts uint32, data []byte) error {
 	if len(data) == 0 {
 		return errors.New("empty audio payload")
 	}
+	if c.Pacer != nil {
+		_ = c.Pacer.Wait(context.Background(), ts)
+	}
 
 	msg := &chunk.Message{
 		CSID:            audioCSID,
@@ -351,6 +479,9 @@ func (c *Client) SendVideo(ts uint32, data []byte) error {
 	if len(data) == 0 {
 		return errors.New("empty video payload")
 	}
+	if c.Pacer != nil {
+		_ = c.Pacer.Wait(context.Background(), ts)
+	}
 
 	msg := &chunk.Message{
 		CSID:            videoCSID,
@@ -368,6 +499,49 @@ func (c *Client) SendVideo(ts uint32, data []byte) error {
 	return nil
 }
 
+// SendData sends an AMF0 data message (TypeID=18), such as
+// @setDataFrame/onMetaData or onCuePoint, with caller-provided payload.
+func (c *Client) SendData(ts uint32, data []byte) error {
+	if c.conn == nil {
+		return errors.New("client not connected")
+	}
+	if c.writer == nil {
+		return errors.New("writer not initialized")
+	}
+	if len(data) == 0 {
+		return errors.New("empty data payload")
+	}
+	if c.Pacer != nil {
+		_ = c.Pacer.Wait(context.Background(), ts)
+	}
+
+	msg := &chunk.Message{
+		CSID:            dataCSID,
+		TypeID:          18,
+		MessageStreamID: c.streamID,
+		Timestamp:       ts,
+		MessageLength:   uint32(len(data)),
+		Payload:         data,
+	}
+
+	if err := c.writer.WriteMessage(msg); err != nil {
+		return fmt.Errorf("write data message: %w", err)
+	}
+
+	return nil
+}
+
+// ReadMessage reads the next message from the server, such as onStatus
+// replies or, after Play, the stream's audio and video. Set Chunk Size is
+// applied by the reader itself. It must not be called concurrently with
+// Close.
+func (c *Client) ReadMessage() (*chunk.Message, error) {
+	if c.conn == nil {
+		return nil, errors.New("client not connected")
+	}
+	return c.reader.ReadMessage()
+}
+
 // Close terminates the underlying TCP connection.
 func (c *Client) Close() error {
 	if c.conn == nil {
@@ -0,0 +1,163 @@
+// connect_test.go – tests for Connect deadlines, cancellation and typed errors.
+//
+// Each test points the client at a deliberately broken fake server (one
+// that never completes the handshake, or completes it and then never
+// answers connect) and checks that ConnectContext returns promptly with a
+// *ConnectError naming the phase that failed.
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	rerrors "github.com/alxayo/go-rtmp/internal/errors"
+	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/handshake"
+)
+
+// fakeServer accepts connections on a loopback port and hands each to
+// handle. The connection is closed when handle returns.
+func fakeServer(t *testing.T, handle func(net.Conn)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() { defer c.Close(); handle(c) }()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// silent reads and discards everything until the peer goes away.
+func silent(c net.Conn) {
+	buf := make([]byte, 4096)
+	for {
+		if _, err := c.Read(buf); err != nil {
+			return
+		}
+	}
+}
+
+// connectPhaseError asserts err is a *ConnectError for phase.
+func connectPhaseError(t *testing.T, err error, phase ConnectPhase) *ConnectError {
+	t.Helper()
+	var ce *ConnectError
+	if !errors.As(err, &ce) {
+		t.Fatalf("expected *ConnectError, got %T: %v", err, err)
+	}
+	if ce.Phase != phase {
+		t.Fatalf("phase = %q, want %q (err: %v)", ce.Phase, phase, err)
+	}
+	return ce
+}
+
+func TestConnect_DialError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close() // nothing listening any more
+
+	c, _ := New("rtmp://" + addr + "/live/test")
+	connectPhaseError(t, c.Connect(), PhaseDial)
+}
+
+func TestConnect_CancelDuringHandshake(t *testing.T) {
+	addr := fakeServer(t, silent) // never sends S0/S1/S2
+	c, _ := New("rtmp://" + addr + "/live/test")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	err := c.ConnectContext(ctx)
+	if time.Since(start) > 2*time.Second {
+		t.Fatalf("cancellation took %v", time.Since(start))
+	}
+	connectPhaseError(t, err, PhaseHandshake)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled in chain, got %v", err)
+	}
+}
+
+func TestConnect_TimeoutWaitingForConnectReply(t *testing.T) {
+	addr := fakeServer(t, func(c net.Conn) {
+		if handshake.ServerHandshake(c) == nil {
+			silent(c) // never answers connect
+		}
+	})
+	c, _ := New("rtmp://" + addr + "/live/test")
+	c.ConnectTimeout = 300 * time.Millisecond
+
+	start := time.Now()
+	err := c.Connect()
+	if time.Since(start) > 2*time.Second {
+		t.Fatalf("timeout took %v", time.Since(start))
+	}
+	connectPhaseError(t, err, PhaseRPC)
+	if !errors.Is(err, context.DeadlineExceeded) || !rerrors.IsTimeout(err) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if c.conn != nil {
+		t.Fatalf("client left connected after failure")
+	}
+}
+
+func TestConnect_ErrorReplyIsRPCFailure(t *testing.T) {
+	addr := fakeServer(t, func(c net.Conn) {
+		if handshake.ServerHandshake(c) != nil {
+			return
+		}
+		r := chunk.NewReader(c, 128)
+		if _, err := r.ReadMessage(); err != nil {
+			return
+		}
+		payload, _ := amf.EncodeAll("_error", float64(1), nil, map[string]interface{}{
+			"level": "error",
+			"code":  "NetConnection.Connect.Rejected",
+		})
+		w := chunk.NewWriter(c, 128)
+		_ = w.WriteMessage(&chunk.Message{CSID: 3, TypeID: 20, MessageLength: uint32(len(payload)), Payload: payload})
+		silent(c)
+	})
+	c, _ := New("rtmp://" + addr + "/live/test")
+	err := c.Connect()
+	ce := connectPhaseError(t, err, PhaseRPC)
+	if rerrors.IsTimeout(ce.Err) || errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a plain RPC failure, got %v", err)
+	}
+}
+
+// TestSetLogger verifies client logs go to an injected logger.
+func TestSetLogger(t *testing.T) {
+	addr := fakeServer(t, func(c net.Conn) {
+		if handshake.ServerHandshake(c) == nil {
+			silent(c)
+		}
+	})
+	var buf bytes.Buffer
+	c, _ := New("rtmp://" + addr + "/live/test")
+	c.SetLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	c.ConnectTimeout = 200 * time.Millisecond
+	_ = c.Connect()
+
+	out := buf.String()
+	if !strings.Contains(out, "sending connect command") || !strings.Contains(out, `"component":"rtmp_client"`) {
+		t.Fatalf("expected client logs in injected logger, got %q", out)
+	}
+}
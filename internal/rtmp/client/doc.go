@@ -16,10 +16,52 @@
 //   - Bandwidth negotiation or flow control
 //   - Extended timestamps
 //   - AMF3 encoding
-//   - Reconnection or retry logic
+//   - Reconnection or retry logic (except in PushFLV)
 //
 // The primary consumer is the integration test suite in tests/integration/.
 //
+// # Timeouts and cancellation
+//
+// ConnectContext can be cancelled at any point. Each phase has its own
+// limit (DialTimeout, the handshake's I/O timeouts, CommandTimeout per
+// reply), and ConnectTimeout bounds the whole sequence. Failures are
+// returned as *ConnectError with Phase set to PhaseDial, PhaseHandshake or
+// PhaseRPC.
+//
+// # Proxies
+//
+// Set ProxyURL to tunnel through a SOCKS5 (socks5://) or HTTP CONNECT
+// (http://) proxy, and DialContext to replace the underlying TCP dialer.
+// For rtmps:// the TLS handshake runs through the tunnel to the server.
+//
+// # Simulated networks
+//
+// Set Network to run the client over a simulated link with latency,
+// jitter, batched delivery, a bandwidth cap or random disconnects, so tests
+// can drive the server's slow-subscriber, reconnection and timeout paths.
+// NetworkConditions.Conn and Dialer apply the same conditions to any
+// connection.
+//
+// # Pacing and synthetic streams
+//
+// Set Pacer to send media at the pace of its timestamps, as a live encoder
+// does, rather than as fast as the connection allows. SyntheticStream
+// generates sequence headers and audio/video frames with realistic
+// timestamps and sizes at a chosen frame rate and bitrate, and
+// PublishSynthetic sends one in real time, for load and relay tests.
+//
+// # Pushing FLV
+//
+// PushFLV publishes an FLV file or pipe in real time, optionally looped
+// with continuous timestamps, and reconnects after a dropped connection,
+// resending metadata and sequence headers and resuming on a keyframe.
+// cmd/rtmp-push is a thin wrapper around it.
+//
+// # Logging
+//
+// The client logs through the shared slog logger. SetLogger swaps in a
+// caller's *slog.Logger, e.g. one tagged with the relay destination.
+//
 // # Usage
 //
 //	c, err := client.New("rtmp://localhost:1935/live/stream")
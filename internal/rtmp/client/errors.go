@@ -0,0 +1,25 @@
+package client
+
+import "fmt"
+
+// ConnectPhase identifies the step of Connect that failed.
+type ConnectPhase string
+
+// Connect phases reported by ConnectError.
+const (
+	PhaseDial      ConnectPhase = "dial"      // TCP / proxy / TLS connection setup
+	PhaseHandshake ConnectPhase = "handshake" // RTMP simple handshake
+	PhaseRPC       ConnectPhase = "rpc"       // connect / createStream commands and replies
+)
+
+// ConnectError is returned by Connect and ConnectContext. Err is the
+// underlying cause: a context error when the caller cancelled, an
+// internal/errors TimeoutError when a phase deadline expired, or the
+// network / protocol error otherwise.
+type ConnectError struct {
+	Phase ConnectPhase
+	Err   error
+}
+
+func (e *ConnectError) Error() string { return fmt.Sprintf("rtmp %s: %v", e.Phase, e.Err) }
+func (e *ConnectError) Unwrap() error { return e.Err }
@@ -0,0 +1,346 @@
+package client
+
+// Simulated network conditions
+// ----------------------------
+// Over loopback every test link is fast, ordered and never drops, so the
+// server's slow-subscriber drops, relay reconnection and timeouts go
+// untested. NetworkConditions wraps the client's connection and imposes a
+// worse link on it:
+//   * latency and jitter on everything the client sends
+//   * batched delivery, as on links that release data in bursts
+//   * a bandwidth cap in each direction; a capped reader makes the server
+//     see a slow subscriber through ordinary TCP backpressure
+//   * random disconnects that drop the connection without a goodbye
+// Random choices come from Seed, so a test gets the same jitter and
+// disconnect times on every run.
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrSimulatedDisconnect is returned by reads and writes on a connection
+// that NetworkConditions dropped.
+var ErrSimulatedDisconnect = errors.New("simulated network disconnect")
+
+// simQueueLen bounds the writes held in the simulated link. A writer that
+// gets further ahead blocks, as it would on a full socket buffer.
+const simQueueLen = 64
+
+// simCloseFlush bounds how long Close waits for held writes to go out.
+const simCloseFlush = time.Second
+
+// NetworkConditions describes a simulated link. The zero value is a
+// perfect link that leaves connections untouched.
+type NetworkConditions struct {
+	// Latency delays every write before it reaches the network.
+	Latency time.Duration
+
+	// Jitter adds a random extra delay in [0, Jitter) to each write.
+	// Writes are never reordered; a write waits for the one before it.
+	Jitter time.Duration
+
+	// BatchInterval holds delayed writes and releases them together at
+	// multiples of this interval from the start of the connection.
+	BatchInterval time.Duration
+
+	// Bandwidth caps throughput in bytes per second, separately for
+	// reading and writing. Zero is unlimited.
+	Bandwidth int
+
+	// MeanTimeToDisconnect drops the connection after a random,
+	// exponentially distributed time with this mean, counted from the
+	// dial. Zero never drops it.
+	MeanTimeToDisconnect time.Duration
+
+	// Seed seeds the jitter and disconnect times.
+	Seed uint64
+}
+
+// Dialer returns base with the conditions imposed on every connection it
+// opens, e.g. for Client.DialContext or a relay client factory.
+func (nc NetworkConditions) Dialer(base DialFunc) DialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := base(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return nc.Conn(conn), nil
+	}
+}
+
+// Conn wraps conn so that its traffic sees the conditions. Closing the
+// returned connection delivers writes still in flight first.
+func (nc NetworkConditions) Conn(conn net.Conn) net.Conn {
+	if nc == (NetworkConditions{}) {
+		return conn
+	}
+	c := &simConn{
+		Conn:    conn,
+		nc:      nc,
+		rng:     rand.New(rand.NewPCG(nc.Seed, nc.Seed)),
+		start:   time.Now(),
+		queue:   make(chan simSegment, simQueueLen),
+		closing: make(chan struct{}),
+		abort:   make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if nc.MeanTimeToDisconnect > 0 {
+		d := time.Duration(c.rng.ExpFloat64() * float64(nc.MeanTimeToDisconnect))
+		c.timer = time.AfterFunc(d, c.disconnect)
+	}
+	go c.sendLoop()
+	return c
+}
+
+// simSegment is one write held in the link until due.
+type simSegment struct {
+	b   []byte
+	due time.Time
+}
+
+// simConn is a net.Conn behind a simulated link. Writes are queued with
+// their due time and sent by sendLoop; reads are paced in place.
+type simConn struct {
+	net.Conn
+	nc    NetworkConditions
+	start time.Time
+	timer *time.Timer // random disconnect, nil when disabled
+
+	mu      sync.Mutex
+	rng     *rand.Rand
+	lastDue time.Time // due time of the latest write, to keep order
+	err     error     // set once the link failed or was dropped
+
+	queue   chan simSegment
+	closing chan struct{} // Close called: flush the queue and stop
+	abort   chan struct{} // dropped or flush timed out: stop now
+	done    chan struct{} // sendLoop exited
+
+	closeOnce sync.Once
+	abortOnce sync.Once
+	readPace  simPacer
+	writePace simPacer
+}
+
+func (c *simConn) Write(p []byte) (int, error) {
+	if err := c.failure(); err != nil {
+		return 0, err
+	}
+	c.mu.Lock()
+	due := time.Now().Add(c.nc.Latency)
+	if c.nc.Jitter > 0 {
+		due = due.Add(time.Duration(c.rng.Int64N(int64(c.nc.Jitter))))
+	}
+	if iv := c.nc.BatchInterval; iv > 0 {
+		elapsed := due.Sub(c.start)
+		due = c.start.Add((elapsed + iv - 1) / iv * iv)
+	}
+	if due.Before(c.lastDue) {
+		due = c.lastDue
+	}
+	c.lastDue = due
+	c.mu.Unlock()
+
+	seg := simSegment{b: append([]byte(nil), p...), due: due}
+	select {
+	case c.queue <- seg:
+		return len(p), nil
+	case <-c.closing:
+		return 0, net.ErrClosed
+	case <-c.abort:
+		return 0, c.failureOr(net.ErrClosed)
+	}
+}
+
+func (c *simConn) Read(p []byte) (int, error) {
+	if err := c.failure(); err != nil {
+		return 0, err
+	}
+	if q := c.quantum(); q > 0 && len(p) > q {
+		p = p[:q]
+	}
+	n, err := c.Conn.Read(p)
+	if err != nil {
+		return n, c.failureOr(err)
+	}
+	if c.nc.Bandwidth > 0 && n > 0 {
+		c.sleepUntil(c.readPace.after(n, c.nc.Bandwidth))
+	}
+	return n, nil
+}
+
+// Close sends the writes still held in the link, for up to simCloseFlush,
+// then closes the connection.
+func (c *simConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closing) })
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	select {
+	case <-c.done:
+	case <-time.After(simCloseFlush):
+		c.stop()
+	}
+	return c.Conn.Close()
+}
+
+// sendLoop writes each queued segment once it is due. Segments that are
+// due together go out in one write.
+func (c *simConn) sendLoop() {
+	defer close(c.done)
+	var next *simSegment
+	for {
+		seg := next
+		next = nil
+		if seg == nil {
+			select {
+			case s := <-c.queue:
+				seg = &s
+			case <-c.closing:
+				// Flush what is left, then stop.
+				select {
+				case s := <-c.queue:
+					seg = &s
+				default:
+					return
+				}
+			case <-c.abort:
+				return
+			}
+		}
+		if !c.sleepUntil(seg.due) {
+			return
+		}
+		buf := seg.b
+	gather:
+		for {
+			select {
+			case s := <-c.queue:
+				if s.due.After(time.Now()) {
+					next = &s
+					break gather
+				}
+				buf = append(buf, s.b...)
+			default:
+				break gather
+			}
+		}
+		if !c.send(buf) {
+			return
+		}
+	}
+}
+
+// send writes buf to the network, paced to the bandwidth cap. It reports
+// false once the connection failed.
+func (c *simConn) send(buf []byte) bool {
+	for len(buf) > 0 {
+		n := len(buf)
+		if q := c.quantum(); q > 0 && n > q {
+			n = q
+		}
+		if _, err := c.Conn.Write(buf[:n]); err != nil {
+			c.fail(err)
+			return false
+		}
+		buf = buf[n:]
+		if c.nc.Bandwidth > 0 && !c.sleepUntil(c.writePace.after(n, c.nc.Bandwidth)) {
+			return false
+		}
+	}
+	return true
+}
+
+// quantum is the most bytes moved at once under the bandwidth cap, about
+// 20ms worth, so pacing stays smooth. Zero when uncapped.
+func (c *simConn) quantum() int {
+	if c.nc.Bandwidth <= 0 {
+		return 0
+	}
+	return max(c.nc.Bandwidth/50, 1)
+}
+
+// sleepUntil waits until t. It returns false if the link is aborted first.
+func (c *simConn) sleepUntil(t time.Time) bool {
+	d := time.Until(t)
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-c.abort:
+		return false
+	}
+}
+
+// disconnect drops the connection abruptly: held writes are lost and the
+// peer sees a reset rather than an orderly close.
+func (c *simConn) disconnect() {
+	c.fail(ErrSimulatedDisconnect)
+	if tc, ok := c.Conn.(*net.TCPConn); ok {
+		_ = tc.SetLinger(0)
+	}
+	_ = c.Conn.Close()
+}
+
+// fail records the first error of the link and stops it.
+func (c *simConn) fail(err error) {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.mu.Unlock()
+	c.stop()
+}
+
+func (c *simConn) stop() { c.abortOnce.Do(func() { close(c.abort) }) }
+
+func (c *simConn) failure() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// failureOr returns the link's failure if it has one, else err.
+func (c *simConn) failureOr(err error) error {
+	if f := c.failure(); f != nil {
+		return f
+	}
+	return err
+}
+
+// simPaceSlack is how far a transfer may run ahead of the bandwidth cap
+// before it waits. Waiting only in steps of this size keeps the average
+// rate exact without a timer per byte when a reader takes one at a time.
+const simPaceSlack = 20 * time.Millisecond
+
+// simPacer spaces transfers to a byte rate.
+type simPacer struct {
+	mu   sync.Mutex
+	next time.Time // when the link is free again
+}
+
+// after accounts n bytes at rate bytes/second and returns when the next
+// transfer may start: now, unless the link is more than simPaceSlack
+// ahead of the rate.
+func (p *simPacer) after(n, rate int) time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	if p.next.Before(now) {
+		p.next = now
+	}
+	p.next = p.next.Add(time.Duration(n) * time.Second / time.Duration(rate))
+	if p.next.Sub(now) < simPaceSlack {
+		return now
+	}
+	return p.next
+}
@@ -0,0 +1,140 @@
+// netsim_test.go – tests for the simulated network conditions.
+//
+// Each test wraps a loopback connection to the echo server from
+// proxy_test.go and checks that the imposed condition is observable from
+// the client side.
+package client
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// dialSim dials the echo server at addr with conditions nc.
+func dialSim(t *testing.T, addr string, nc NetworkConditions) net.Conn {
+	t.Helper()
+	raw, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	conn := nc.Conn(raw)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestNetworkConditionsZeroValue(t *testing.T) {
+	raw, _ := net.Pipe()
+	defer raw.Close()
+	if got := (NetworkConditions{}).Conn(raw); got != raw {
+		t.Fatal("zero conditions wrapped the connection")
+	}
+}
+
+func TestNetworkConditionsLatencyAndOrder(t *testing.T) {
+	conn := dialSim(t, startEcho(t), NetworkConditions{Latency: 60 * time.Millisecond, Jitter: 20 * time.Millisecond, Seed: 1})
+
+	start := time.Now()
+	want := make([]byte, 50)
+	for i := range want {
+		want[i] = byte(i)
+		if _, err := conn.Write(want[i : i+1]); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(conn, got); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Fatalf("echo after %v, want at least the 60ms latency", elapsed)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("byte %d = %d, want %d: writes were reordered", i, got[i], want[i])
+		}
+	}
+}
+
+func TestNetworkConditionsBandwidth(t *testing.T) {
+	conn := dialSim(t, startEcho(t), NetworkConditions{Bandwidth: 100_000})
+
+	start := time.Now()
+	data := make([]byte, 20_000)
+	go func() { _, _ = conn.Write(data) }()
+	if _, err := io.ReadFull(conn, make([]byte, len(data))); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	// 20 KB at 100 KB/s takes 200ms each way; the directions overlap.
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Fatalf("20KB took %v at 100KB/s, want about 200ms", elapsed)
+	}
+}
+
+func TestNetworkConditionsBatching(t *testing.T) {
+	conn := dialSim(t, startEcho(t), NetworkConditions{BatchInterval: 100 * time.Millisecond})
+
+	start := time.Now()
+	_, _ = conn.Write([]byte{1})
+	time.Sleep(20 * time.Millisecond)
+	_, _ = conn.Write([]byte{2})
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Fatalf("batched writes delivered after %v, want at the 100ms batch boundary", elapsed)
+	}
+}
+
+func TestNetworkConditionsDisconnect(t *testing.T) {
+	conn := dialSim(t, startEcho(t), NetworkConditions{MeanTimeToDisconnect: 20 * time.Millisecond, Seed: 7})
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, ErrSimulatedDisconnect) {
+		t.Fatalf("read error = %v, want ErrSimulatedDisconnect", err)
+	}
+	if _, err := conn.Write([]byte{1}); !errors.Is(err, ErrSimulatedDisconnect) {
+		t.Fatalf("write error = %v, want ErrSimulatedDisconnect", err)
+	}
+}
+
+// TestNetworkConditionsCloseFlushes checks that writes still held in the
+// link reach the peer when the connection is closed.
+func TestNetworkConditionsCloseFlushes(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	received := make(chan []byte, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		b, _ := io.ReadAll(c)
+		received <- b
+	}()
+
+	raw, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	conn := NetworkConditions{Latency: 50 * time.Millisecond}.Conn(raw)
+	_, _ = conn.Write([]byte("hello"))
+	if err := conn.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	select {
+	case b := <-received:
+		if string(b) != "hello" {
+			t.Fatalf("peer received %q, want %q", b, "hello")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("peer never saw the connection close")
+	}
+}
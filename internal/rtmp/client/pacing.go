@@ -0,0 +1,231 @@
+package client
+
+// Real-time pacing and synthetic streams
+// --------------------------------------
+// SendAudio and SendVideo write as fast as the connection takes them, so a
+// test that loops over frames bursts a minute of media in milliseconds:
+// nothing downstream (subscriber queues, relay senders, the recorder) sees
+// the timing a live encoder produces. Two helpers fix that:
+//   * Pacer holds each message until its timestamp is due on the wall
+//     clock; Client.Pacer applies one to every Send call.
+//   * SyntheticStream generates a stream's sequence headers and frames
+//     with realistic timestamps (video at FPS, AAC audio frames every
+//     1024 samples) and sizes (VideoBitrate, keyframes several times
+//     larger than inter frames), for load tests and relay tests.
+// Client.PublishSynthetic combines them.
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// pacerMaxAhead is how far a timestamp may run ahead of the wall clock
+// before the pacer treats it as a discontinuity and re-anchors instead of
+// waiting.
+const pacerMaxAhead = 10 * time.Second
+
+// Pacer releases messages at the pace of their timestamps. The zero value
+// is ready to use and anchors the clock at the first Wait; set Start to
+// anchor timestamp 0 at a known time instead. A Pacer is safe for
+// concurrent use.
+type Pacer struct {
+	// Start is the wall-clock time of timestamp 0. Zero anchors the first
+	// timestamp passed to Wait at the time of that call.
+	Start time.Time
+
+	// Speed scales the pace: 2 sends twice as fast as real time. Zero or
+	// negative means 1.
+	Speed float64
+
+	mu     sync.Mutex
+	anchor time.Time // wall-clock time of base
+	base   uint32    // timestamp anchored at anchor
+	set    bool
+}
+
+// Wait blocks until timestamp ts (milliseconds) is due, or ctx is done.
+// Timestamps already due return at once. A timestamp going backwards, or
+// more than 10s ahead of the clock, re-anchors the pacer at ts and now, as
+// for a publisher that restarts its timestamps.
+func (p *Pacer) Wait(ctx context.Context, ts uint32) error {
+	d := p.delay(ts, time.Now())
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// delay returns how long after now timestamp ts is due.
+func (p *Pacer) delay(ts uint32, now time.Time) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.set {
+		p.set = true
+		if p.Start.IsZero() {
+			p.anchor, p.base = now, ts
+		} else {
+			p.anchor = p.Start
+		}
+	}
+	speed := p.Speed
+	if speed <= 0 {
+		speed = 1
+	}
+	if ts < p.base {
+		p.anchor, p.base = now, ts
+		return 0
+	}
+	due := p.anchor.Add(time.Duration(float64(time.Duration(ts-p.base)*time.Millisecond) / speed))
+	d := due.Sub(now)
+	if d > pacerMaxAhead {
+		p.anchor, p.base = now, ts
+		return 0
+	}
+	return d
+}
+
+// Frame is one message of a SyntheticStream.
+type Frame struct {
+	TypeID    uint8  // 8 audio, 9 video
+	Timestamp uint32 // milliseconds
+	Payload   []byte
+}
+
+// SyntheticStream generates H.264 video and AAC audio with realistic
+// timing and sizes. Payloads are filler behind valid FLV tag headers:
+// enough for the server's codec detection, keyframe handling and
+// recording, not for a decoder. Zero fields take the defaults noted.
+type SyntheticStream struct {
+	FPS              int           // video frames per second (30)
+	VideoBitrate     int           // video bits per second (2_500_000)
+	AudioBitrate     int           // audio bits per second (128_000)
+	KeyframeInterval time.Duration // time between keyframes (2s)
+	NoAudio          bool          // generate video only
+	NoVideo          bool          // generate audio only
+
+	videoN, audioN uint64 // frames generated so far
+}
+
+// AAC frames carry 1024 samples; at 44.1kHz one lasts about 23.2ms.
+const (
+	syntheticSampleRate = 44100
+	syntheticAACSamples = 1024
+)
+
+// Headers returns the stream's sequence headers (AVC decoder
+// configuration and AAC AudioSpecificConfig) at timestamp 0. Send them
+// before the first frame.
+func (s *SyntheticStream) Headers() []Frame {
+	var h []Frame
+	if !s.NoVideo {
+		h = append(h, Frame{TypeID: 9, Payload: []byte{0x17, 0x00, 0, 0, 0, 0x01, 0x64, 0x00, 0x1F, 0xFF}})
+	}
+	if !s.NoAudio {
+		h = append(h, Frame{TypeID: 8, Payload: []byte{0xAF, 0x00, 0x12, 0x10}}) // AAC-LC 44.1kHz stereo
+	}
+	return h
+}
+
+// Next returns the next frame in timestamp order, audio and video
+// interleaved. The first video frame is a keyframe.
+func (s *SyntheticStream) Next() Frame {
+	fps := s.FPS
+	if fps <= 0 {
+		fps = 30
+	}
+	videoTS := s.videoN * 1000 / uint64(fps)
+	audioTS := s.audioN * syntheticAACSamples * 1000 / syntheticSampleRate
+	if !s.NoVideo && (s.NoAudio || videoTS <= audioTS) {
+		f := Frame{TypeID: 9, Timestamp: uint32(videoTS), Payload: s.videoPayload(fps)}
+		s.videoN++
+		return f
+	}
+	f := Frame{TypeID: 8, Timestamp: uint32(audioTS), Payload: s.audioPayload()}
+	s.audioN++
+	return f
+}
+
+// videoPayload builds video frame s.videoN. Over a GOP the frames average
+// out to VideoBitrate, with the keyframe weighing as much as four inter
+// frames.
+func (s *SyntheticStream) videoPayload(fps int) []byte {
+	bitrate := s.VideoBitrate
+	if bitrate <= 0 {
+		bitrate = 2_500_000
+	}
+	interval := s.KeyframeInterval
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	gop := max(1, int(interval.Seconds()*float64(fps)))
+	unit := int(float64(bitrate) / 8 * float64(gop) / float64(fps) / float64(gop+3))
+	p := []byte{0x27, 0x01, 0, 0, 0}
+	size := unit
+	if s.videoN%uint64(gop) == 0 {
+		p[0] = 0x17
+		size = 4 * unit
+	}
+	return append(p, make([]byte, max(1, size-len(p)))...)
+}
+
+// audioPayload builds one AAC raw frame at AudioBitrate.
+func (s *SyntheticStream) audioPayload() []byte {
+	bitrate := s.AudioBitrate
+	if bitrate <= 0 {
+		bitrate = 128_000
+	}
+	size := bitrate / 8 * syntheticAACSamples / syntheticSampleRate
+	return append([]byte{0xAF, 0x01}, make([]byte, max(1, size-2))...)
+}
+
+// SendFrame sends f with SendAudio or SendVideo according to its type.
+func (c *Client) SendFrame(f Frame) error {
+	switch f.TypeID {
+	case 8:
+		return c.SendAudio(f.Timestamp, f.Payload)
+	case 9:
+		return c.SendVideo(f.Timestamp, f.Payload)
+	}
+	return fmt.Errorf("send frame: unsupported message type %d", f.TypeID)
+}
+
+// PublishSynthetic sends src's sequence headers and then its frames in
+// real time, paced by c.Pacer or else a new Pacer, until d of media has
+// been sent or ctx is done. It returns the number of messages sent. Call
+// Publish first.
+func (c *Client) PublishSynthetic(ctx context.Context, src *SyntheticStream, d time.Duration) (int, error) {
+	pacer := c.Pacer
+	if pacer == nil {
+		pacer = &Pacer{}
+	}
+	sent := 0
+	for _, h := range src.Headers() {
+		if err := c.SendFrame(h); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	end := uint32(d / time.Millisecond)
+	for {
+		f := src.Next()
+		if f.Timestamp >= end {
+			return sent, nil
+		}
+		if err := pacer.Wait(ctx, f.Timestamp); err != nil {
+			return sent, err
+		}
+		if err := c.SendFrame(f); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+}
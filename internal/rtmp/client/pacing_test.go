@@ -0,0 +1,77 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPacerDelay(t *testing.T) {
+	t0 := time.Unix(1000, 0)
+	p := &Pacer{}
+	for _, tc := range []struct {
+		ts   uint32
+		now  time.Duration // since t0
+		want time.Duration
+	}{
+		{5000, 0, 0}, // anchors 5000 at t0
+		{5040, 0, 40 * time.Millisecond},
+		{5100, 50 * time.Millisecond, 50 * time.Millisecond},
+		{5100, 200 * time.Millisecond, -100 * time.Millisecond}, // late: send at once
+		{100, time.Second, 0}, // went backwards: re-anchored
+		{600, time.Second, 500 * time.Millisecond},
+		{60000, time.Second, 0}, // jumped ahead: re-anchored
+		{60010, time.Second, 10 * time.Millisecond},
+	} {
+		if got := p.delay(tc.ts, t0.Add(tc.now)); got != tc.want {
+			t.Fatalf("delay(%d) at +%v = %v, want %v", tc.ts, tc.now, got, tc.want)
+		}
+	}
+
+	fast := &Pacer{Start: t0, Speed: 2}
+	if got := fast.delay(1000, t0); got != 500*time.Millisecond {
+		t.Fatalf("delay at speed 2 = %v, want 500ms", got)
+	}
+}
+
+// TestSyntheticStream checks the frames come in timestamp order at the
+// configured rates, with a keyframe every KeyframeInterval.
+func TestSyntheticStream(t *testing.T) {
+	src := &SyntheticStream{FPS: 25, VideoBitrate: 1_000_000, AudioBitrate: 64_000, KeyframeInterval: time.Second}
+	if h := src.Headers(); len(h) != 2 || h[0].Payload[1] != 0x00 || h[1].Payload[1] != 0x00 {
+		t.Fatalf("headers = %+v, want video and audio sequence headers", h)
+	}
+	var last uint32
+	var video, audio, keyframes, videoBytes int
+	for {
+		f := src.Next()
+		if f.Timestamp >= 4000 {
+			break
+		}
+		if f.Timestamp < last {
+			t.Fatalf("timestamp %d after %d", f.Timestamp, last)
+		}
+		last = f.Timestamp
+		switch f.TypeID {
+		case 9:
+			if video == 0 && f.Payload[0] != 0x17 {
+				t.Fatal("first video frame is not a keyframe")
+			}
+			if f.Payload[0] == 0x17 {
+				keyframes++
+			}
+			video++
+			videoBytes += len(f.Payload)
+		case 8:
+			audio++
+		}
+	}
+	if video != 100 || keyframes != 4 {
+		t.Fatalf("got %d video frames, %d keyframes in 4s; want 100 and 4", video, keyframes)
+	}
+	if audio != 173 { // 4s of 1024-sample frames at 44.1kHz
+		t.Fatalf("got %d audio frames in 4s, want 173", audio)
+	}
+	if kbps := videoBytes * 8 / 4 / 1000; kbps < 950 || kbps > 1050 {
+		t.Fatalf("video bitrate %d kbit/s, want about 1000", kbps)
+	}
+}
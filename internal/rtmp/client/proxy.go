@@ -0,0 +1,300 @@
+package client
+
+// Proxy dialing
+// -------------
+// Relay destinations are often only reachable through an egress proxy. The
+// client can tunnel its TCP connection through either:
+//   * SOCKS5 (RFC 1928) with optional username/password auth (RFC 1929)
+//   * HTTP CONNECT with optional Basic proxy auth
+// The tunnel carries the raw RTMP byte stream; for rtmps:// the TLS
+// handshake runs end-to-end with the destination on top of the tunnel.
+//
+// Only the standard library is used, so both protocols are implemented here
+// rather than pulling in golang.org/x/net/proxy.
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// DialFunc opens a network connection, with the same signature as
+// net.Dialer.DialContext.
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// ParseProxyURL validates a proxy URL of the form socks5://[user:pass@]host:port
+// (or socks5h://) or http://[user:pass@]host:port. A missing port defaults to
+// 1080 for SOCKS5 and 8080 for HTTP.
+func ParseProxyURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	switch u.Scheme {
+	case "socks5", "socks5h", "http":
+	default:
+		return nil, fmt.Errorf("proxy URL must use socks5://, socks5h:// or http:// scheme, got %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, errors.New("proxy URL must have a host")
+	}
+	if u.Port() == "" {
+		port := "8080"
+		if u.Scheme != "http" {
+			port = "1080"
+		}
+		u.Host = net.JoinHostPort(u.Hostname(), port)
+	}
+	return u, nil
+}
+
+// dial opens the connection to addr (host:port) for Connect: directly or
+// through ProxyURL, using DialContext if set, and wrapped in TLS for rtmps.
+// It is bounded by DialTimeout as well as ctx.
+func (c *Client) dial(ctx context.Context, addr string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, DialTimeout)
+	defer cancel()
+
+	base := c.DialContext
+	if base == nil {
+		base = (&net.Dialer{}).DialContext
+	}
+	if c.Network != nil {
+		base = c.Network.Dialer(base)
+	}
+
+	var conn net.Conn
+	var err error
+	if c.ProxyURL != "" {
+		proxy, perr := ParseProxyURL(c.ProxyURL)
+		if perr != nil {
+			return nil, perr
+		}
+		conn, err = dialProxy(ctx, base, proxy, addr)
+	} else {
+		conn, err = base(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !c.useTLS {
+		return conn, nil
+	}
+
+	tlsCfg := c.TLSConfig
+	if tlsCfg == nil {
+		tlsCfg = &tls.Config{}
+	}
+	if tlsCfg.ServerName == "" {
+		tlsCfg = tlsCfg.Clone()
+		tlsCfg.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+	tc := tls.Client(conn, tlsCfg)
+	if err := tc.HandshakeContext(ctx); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("tls handshake: %w", err)
+	}
+	return tc, nil
+}
+
+// dialProxy connects to the proxy with base and asks it to open a tunnel
+// to addr. The proxy negotiation is bounded by ctx's deadline.
+func dialProxy(ctx context.Context, base DialFunc, proxy *url.URL, addr string) (net.Conn, error) {
+	conn, err := base(ctx, "tcp", proxy.Host)
+	if err != nil {
+		return nil, fmt.Errorf("dial proxy %s: %w", proxy.Host, err)
+	}
+	if dl, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(dl)
+	}
+	tunnel := conn
+	if proxy.Scheme == "http" {
+		tunnel, err = httpConnect(conn, proxy, addr)
+	} else {
+		err = socks5Connect(conn, proxy, addr)
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("proxy %s: %w", proxy.Host, err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return tunnel, nil
+}
+
+// httpConnect issues an HTTP CONNECT for addr on conn. The returned
+// connection replays any bytes the proxy sent after its response headers.
+func httpConnect(conn net.Conn, proxy *url.URL, addr string) (net.Conn, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if u := proxy.User; u != nil {
+		pass, _ := u.Password()
+		cred := base64.StdEncoding.EncodeToString([]byte(u.Username() + ":" + pass))
+		req.Header.Set("Proxy-Authorization", "Basic "+cred)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, fmt.Errorf("write CONNECT: %w", err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, fmt.Errorf("read CONNECT response: %w", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CONNECT %s: %s", addr, resp.Status)
+	}
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn reads through r first, so bytes buffered while parsing the
+// proxy response are not lost.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (b *bufferedConn) Read(p []byte) (int, error) { return b.r.Read(p) }
+
+// SOCKS5 protocol constants (RFC 1928 / RFC 1929).
+const (
+	socks5Version      = 0x05
+	socks5AuthNone     = 0x00
+	socks5AuthPassword = 0x02
+	socks5AuthNoAccept = 0xFF
+	socks5CmdConnect   = 0x01
+	socks5AtypIPv4     = 0x01
+	socks5AtypDomain   = 0x03
+	socks5AtypIPv6     = 0x04
+)
+
+// socks5Connect negotiates a SOCKS5 CONNECT to addr on conn. Host names are
+// sent to the proxy unresolved, so DNS happens on the proxy's side.
+func socks5Connect(conn net.Conn, proxy *url.URL, addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port %q", portStr)
+	}
+
+	// Greeting: offer username/password only when credentials are set.
+	methods := []byte{socks5AuthNone}
+	if proxy.User != nil {
+		methods = append(methods, socks5AuthPassword)
+	}
+	greeting := append([]byte{socks5Version, byte(len(methods))}, methods...)
+	if _, err := conn.Write(greeting); err != nil {
+		return fmt.Errorf("socks5 greeting: %w", err)
+	}
+	var choice [2]byte
+	if _, err := io.ReadFull(conn, choice[:]); err != nil {
+		return fmt.Errorf("socks5 greeting reply: %w", err)
+	}
+	if choice[0] != socks5Version {
+		return fmt.Errorf("socks5: unexpected version %d", choice[0])
+	}
+	switch choice[1] {
+	case socks5AuthNone:
+	case socks5AuthPassword:
+		if proxy.User == nil {
+			return errors.New("socks5: proxy requires authentication")
+		}
+		if err := socks5Auth(conn, proxy.User); err != nil {
+			return err
+		}
+	case socks5AuthNoAccept:
+		return errors.New("socks5: no acceptable authentication method")
+	default:
+		return fmt.Errorf("socks5: unsupported authentication method %d", choice[1])
+	}
+
+	// CONNECT request.
+	req := []byte{socks5Version, socks5CmdConnect, 0x00}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			req = append(append(req, socks5AtypIPv4), ip4...)
+		} else {
+			req = append(append(req, socks5AtypIPv6), ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return fmt.Errorf("socks5: host name too long (%d bytes)", len(host))
+		}
+		req = append(append(req, socks5AtypDomain, byte(len(host))), host...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		return fmt.Errorf("socks5 connect: %w", err)
+	}
+
+	// Reply: VER REP RSV ATYP BND.ADDR BND.PORT
+	var hdr [4]byte
+	if _, err := io.ReadFull(conn, hdr[:]); err != nil {
+		return fmt.Errorf("socks5 connect reply: %w", err)
+	}
+	if hdr[1] != 0x00 {
+		return fmt.Errorf("socks5: connect to %s failed (reply code %d)", addr, hdr[1])
+	}
+	var skip int
+	switch hdr[3] {
+	case socks5AtypIPv4:
+		skip = net.IPv4len
+	case socks5AtypIPv6:
+		skip = net.IPv6len
+	case socks5AtypDomain:
+		var n [1]byte
+		if _, err := io.ReadFull(conn, n[:]); err != nil {
+			return fmt.Errorf("socks5 connect reply: %w", err)
+		}
+		skip = int(n[0])
+	default:
+		return fmt.Errorf("socks5: unsupported bound address type %d", hdr[3])
+	}
+	if _, err := io.ReadFull(conn, make([]byte, skip+2)); err != nil {
+		return fmt.Errorf("socks5 connect reply: %w", err)
+	}
+	return nil
+}
+
+// socks5Auth performs RFC 1929 username/password authentication.
+func socks5Auth(conn net.Conn, user *url.Userinfo) error {
+	name := user.Username()
+	pass, _ := user.Password()
+	if len(name) > 255 || len(pass) > 255 {
+		return errors.New("socks5: username or password too long")
+	}
+	msg := []byte{0x01, byte(len(name))}
+	msg = append(msg, name...)
+	msg = append(msg, byte(len(pass)))
+	msg = append(msg, pass...)
+	if _, err := conn.Write(msg); err != nil {
+		return fmt.Errorf("socks5 auth: %w", err)
+	}
+	var reply [2]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return fmt.Errorf("socks5 auth reply: %w", err)
+	}
+	if reply[1] != 0x00 {
+		return errors.New("socks5: authentication failed")
+	}
+	return nil
+}
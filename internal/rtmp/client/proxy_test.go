@@ -0,0 +1,285 @@
+// proxy_test.go – tests for dialing through SOCKS5 and HTTP CONNECT proxies.
+//
+// Each test runs a tiny in-process proxy in front of a TCP echo server and
+// dials the echo server through it with dialProxy. A byte round-trip
+// through the tunnel proves the proxy handshake left the stream clean.
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// startEcho starts a TCP server that echoes everything it reads.
+func startEcho(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() { defer c.Close(); _, _ = io.Copy(c, c) }()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// startProxy runs handle for every connection accepted on a loopback port.
+func startProxy(t *testing.T, handle func(net.Conn)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go handle(c)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// pipe copies between the client and target until either side closes.
+func pipe(a, b net.Conn) {
+	defer a.Close()
+	defer b.Close()
+	go func() { _, _ = io.Copy(a, b) }()
+	_, _ = io.Copy(b, a)
+}
+
+// socks5Server is a minimal SOCKS5 CONNECT proxy. When user is non-empty it
+// requires username/password auth.
+func socks5Server(user, pass string) func(net.Conn) {
+	return func(c net.Conn) {
+		br := bufio.NewReader(c)
+		var hdr [2]byte
+		if _, err := io.ReadFull(br, hdr[:]); err != nil {
+			c.Close()
+			return
+		}
+		methods := make([]byte, hdr[1])
+		_, _ = io.ReadFull(br, methods)
+		want := byte(socks5AuthNone)
+		if user != "" {
+			want = socks5AuthPassword
+		}
+		offered := false
+		for _, m := range methods {
+			offered = offered || m == want
+		}
+		if !offered {
+			_, _ = c.Write([]byte{socks5Version, socks5AuthNoAccept})
+			c.Close()
+			return
+		}
+		_, _ = c.Write([]byte{socks5Version, want})
+		if user != "" {
+			var v [2]byte
+			_, _ = io.ReadFull(br, v[:])
+			name := make([]byte, v[1])
+			_, _ = io.ReadFull(br, name)
+			var n [1]byte
+			_, _ = io.ReadFull(br, n[:])
+			pw := make([]byte, n[0])
+			_, _ = io.ReadFull(br, pw)
+			if string(name) != user || string(pw) != pass {
+				_, _ = c.Write([]byte{0x01, 0x01})
+				c.Close()
+				return
+			}
+			_, _ = c.Write([]byte{0x01, 0x00})
+		}
+
+		var req [4]byte
+		if _, err := io.ReadFull(br, req[:]); err != nil {
+			c.Close()
+			return
+		}
+		var host string
+		switch req[3] {
+		case socks5AtypIPv4:
+			ip := make([]byte, 4)
+			_, _ = io.ReadFull(br, ip)
+			host = net.IP(ip).String()
+		case socks5AtypDomain:
+			var n [1]byte
+			_, _ = io.ReadFull(br, n[:])
+			name := make([]byte, n[0])
+			_, _ = io.ReadFull(br, name)
+			host = string(name)
+		}
+		var port [2]byte
+		_, _ = io.ReadFull(br, port[:])
+		target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:])))))
+		if err != nil {
+			_, _ = c.Write([]byte{socks5Version, 0x05, 0x00, socks5AtypIPv4, 0, 0, 0, 0, 0, 0})
+			c.Close()
+			return
+		}
+		_, _ = c.Write([]byte{socks5Version, 0x00, 0x00, socks5AtypIPv4, 127, 0, 0, 1, 0, 0})
+		pipe(c, target)
+	}
+}
+
+// connectServer is a minimal HTTP CONNECT proxy. When auth is non-empty the
+// Proxy-Authorization header must match it.
+func connectServer(auth string) func(net.Conn) {
+	return func(c net.Conn) {
+		br := bufio.NewReader(c)
+		req, err := http.ReadRequest(br)
+		if err != nil || req.Method != http.MethodConnect {
+			c.Close()
+			return
+		}
+		if auth != "" && req.Header.Get("Proxy-Authorization") != auth {
+			_, _ = io.WriteString(c, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+			c.Close()
+			return
+		}
+		target, err := net.Dial("tcp", req.Host)
+		if err != nil {
+			_, _ = io.WriteString(c, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+			c.Close()
+			return
+		}
+		_, _ = io.WriteString(c, "HTTP/1.1 200 Connection established\r\n\r\n")
+		pipe(c, target)
+	}
+}
+
+// roundTrip dials addr through proxyURL and checks bytes echo back.
+func roundTrip(t *testing.T, proxyURL, addr string) error {
+	t.Helper()
+	proxy, err := ParseProxyURL(proxyURL)
+	if err != nil {
+		t.Fatalf("ParseProxyURL: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	conn, err := dialProxy(ctx, (&net.Dialer{}).DialContext, proxy, addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Write([]byte("rtmp")); err != nil {
+		t.Fatalf("write through tunnel: %v", err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("read through tunnel: %v", err)
+	}
+	if string(buf) != "rtmp" {
+		t.Fatalf("echo = %q, want %q", buf, "rtmp")
+	}
+	return nil
+}
+
+func TestDialProxy_SOCKS5(t *testing.T) {
+	echo := startEcho(t)
+	proxy := startProxy(t, socks5Server("", ""))
+	if err := roundTrip(t, "socks5://"+proxy, echo); err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	// Host names are forwarded unresolved.
+	_, port, _ := net.SplitHostPort(echo)
+	if err := roundTrip(t, "socks5://"+proxy, net.JoinHostPort("localhost", port)); err != nil {
+		t.Fatalf("dial by name: %v", err)
+	}
+}
+
+func TestDialProxy_SOCKS5Auth(t *testing.T) {
+	echo := startEcho(t)
+	proxy := startProxy(t, socks5Server("relay", "s3cret"))
+	if err := roundTrip(t, "socks5://relay:s3cret@"+proxy, echo); err != nil {
+		t.Fatalf("dial with credentials: %v", err)
+	}
+	if err := roundTrip(t, "socks5://relay:wrong@"+proxy, echo); err == nil {
+		t.Fatalf("expected wrong password to fail")
+	}
+	if err := roundTrip(t, "socks5://"+proxy, echo); err == nil {
+		t.Fatalf("expected missing credentials to fail")
+	}
+}
+
+func TestDialProxy_HTTPConnect(t *testing.T) {
+	echo := startEcho(t)
+	auth := "Basic " + base64.StdEncoding.EncodeToString([]byte("relay:s3cret"))
+	proxy := startProxy(t, connectServer(auth))
+	if err := roundTrip(t, "http://relay:s3cret@"+proxy, echo); err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	if err := roundTrip(t, "http://"+proxy, echo); err == nil {
+		t.Fatalf("expected 407 without credentials")
+	}
+}
+
+// TestClientDial_CustomDialContext verifies a caller-supplied DialContext is
+// used to reach the proxy.
+func TestClientDial_CustomDialContext(t *testing.T) {
+	echo := startEcho(t)
+	proxy := startProxy(t, socks5Server("", ""))
+	c, err := New("rtmp://" + echo + "/live/test")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	c.ProxyURL = "socks5://" + proxy
+	var dialed string
+	c.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = addr
+		return (&net.Dialer{}).DialContext(ctx, network, addr)
+	}
+	conn, err := c.dial(context.Background(), echo)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	conn.Close()
+	if dialed != proxy {
+		t.Fatalf("DialContext called with %q, want proxy %q", dialed, proxy)
+	}
+}
+
+func TestParseProxyURL(t *testing.T) {
+	tests := []struct {
+		in       string
+		wantHost string
+		wantErr  bool
+	}{
+		{"socks5://proxy.corp:1081", "proxy.corp:1081", false},
+		{"socks5://proxy.corp", "proxy.corp:1080", false},
+		{"socks5h://proxy.corp", "proxy.corp:1080", false},
+		{"http://user:pw@proxy.corp", "proxy.corp:8080", false},
+		{"https://proxy.corp:443", "", true},
+		{"socks5://", "", true},
+		{"://bad", "", true},
+	}
+	for _, tt := range tests {
+		u, err := ParseProxyURL(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseProxyURL(%q) err=%v, wantErr=%v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && u.Host != tt.wantHost {
+			t.Errorf("ParseProxyURL(%q) host=%q, want %q", tt.in, u.Host, tt.wantHost)
+		}
+	}
+}
@@ -0,0 +1,372 @@
+package client
+
+// Pushing FLV
+// -----------
+// PushFLV publishes an FLV file or pipe the way `ffmpeg -re -i in.flv -c
+// copy -f flv rtmp://...` does: tags go out at the pace of their
+// timestamps, onMetaData is sent as @setDataFrame, and the source can be
+// looped with timestamps that keep increasing. A dropped connection is
+// re-established and the stream resumes where it was:
+//   * the last onMetaData and the audio and video sequence headers are
+//     sent again on the new connection before any frame,
+//   * video is held back until the next keyframe, so players joining the
+//     new publish never start on a frame they cannot decode,
+//   * timestamps continue from the last one sent rather than restarting.
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
+	"github.com/alxayo/go-rtmp/internal/rtmp/media"
+	"github.com/alxayo/go-rtmp/internal/rtmp/rpc"
+)
+
+// DefaultReconnectDelay is the wait before each reconnect when
+// PushOptions.ReconnectDelay is zero.
+const DefaultReconnectDelay = 2 * time.Second
+
+// ErrPublishRefused is returned (wrapped) when the server refuses publish
+// with an error status such as NetStream.Publish.Unauthorized. PushFLV does
+// not retry it. NetStream.Publish.BadName, usually the previous
+// connection's publish not yet released, is not a refusal and is retried.
+var ErrPublishRefused = errors.New("publish refused")
+
+// PushOptions configures PushFLV. The zero value sends the source once, in
+// real time, and gives up on the first connection failure.
+type PushOptions struct {
+	// Loop starts the source again from open when it ends, with
+	// timestamps continuing from the end of the previous pass.
+	Loop bool
+
+	// Speed scales the pace: 2 sends twice as fast as real time. Zero or
+	// negative means 1.
+	Speed float64
+
+	// NoPacing sends tags as fast as the connection takes them, for a
+	// source that is already paced (ffmpeg -re writing to a pipe).
+	NoPacing bool
+
+	// Reconnects is how many times in a row a failed connection is
+	// re-established before PushFLV gives up; negative retries forever.
+	// The count starts again once a reconnected push delivers media.
+	Reconnects int
+
+	// ReconnectDelay is the wait before each reconnect
+	// (DefaultReconnectDelay when zero).
+	ReconnectDelay time.Duration
+
+	// Configure, when set, is applied to every new Client before it
+	// connects, e.g. to set TLSConfig, ConnectTimeout or a logger.
+	Configure func(*Client)
+
+	// OnReconnect, when set, is called before each reconnect with the
+	// attempt number (from 1) and the error that ended the connection.
+	OnReconnect func(attempt int, err error)
+}
+
+// PushStats counts what PushFLV sent.
+type PushStats struct {
+	Messages      int    // audio, video and data messages sent
+	Bytes         int64  // payload bytes sent
+	Loops         int    // times the source was started again
+	Reconnects    int    // reconnect attempts after a failure
+	LastTimestamp uint32 // timestamp of the last message sent
+}
+
+// PushFLV publishes the FLV source returned by open to url until the
+// source ends (or, with Loop, until ctx is done). open is called again for
+// each loop, so it should reopen a file from the start; a source that
+// cannot be reopened, such as standard input, must not be looped. A source
+// that ends normally returns a nil error; cancelling ctx returns ctx's
+// error.
+func PushFLV(ctx context.Context, url string, open func() (io.ReadCloser, error), opts PushOptions) (PushStats, error) {
+	p := &flvPush{url: url, opts: opts}
+	defer p.disconnect()
+	for {
+		src, err := open()
+		if err != nil {
+			return p.stats, fmt.Errorf("open source: %w", err)
+		}
+		err = p.pushSource(ctx, src)
+		src.Close()
+		if err != nil {
+			return p.stats, err
+		}
+		if !opts.Loop {
+			return p.stats, nil
+		}
+		p.stats.Loops++
+		p.rebase = true
+	}
+}
+
+// flvPush is the state of one PushFLV call, carried across loops and
+// reconnects.
+type flvPush struct {
+	url   string
+	opts  PushOptions
+	pacer *Pacer
+	c     *Client
+	stats PushStats
+
+	// Cached headers, sent again on each new connection.
+	metadata, videoHeader, audioHeader []byte
+
+	offset       uint32 // added to source timestamps
+	rebase       bool   // recompute offset at the next tag (a new loop)
+	lastSrc      uint32 // source timestamp of the last tag
+	frameDelta   uint32 // last positive delta between source timestamps
+	hasVideo     bool   // the source has carried video
+	needKeyframe bool   // drop video until a keyframe (after a reconnect)
+	failures     int    // consecutive reconnect attempts
+}
+
+// pushSource sends every tag of one pass over src.
+func (p *flvPush) pushSource(ctx context.Context, src io.Reader) error {
+	r, err := media.NewFLVReader(bufio.NewReader(src))
+	if err != nil {
+		return err
+	}
+	for {
+		tag, err := r.ReadTag()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := p.send(ctx, tag); err != nil {
+			return err
+		}
+	}
+}
+
+// send delivers one tag, connecting or reconnecting as needed.
+func (p *flvPush) send(ctx context.Context, tag *media.FLVTag) error {
+	payload := tag.Data
+	header := false // payload is cached and resent by connect
+	switch {
+	case tag.Type == media.FLVTagScript:
+		if _, ok := media.ParseOnMetaData(payload); ok {
+			payload = setDataFrame(payload)
+			p.metadata = payload
+			header = true
+		}
+	case tag.Type == media.FLVTagVideo && media.IsVideoSequenceHeader(payload):
+		p.videoHeader = payload
+		header = true
+	case tag.Type == media.FLVTagAudio && media.IsAudioSequenceHeader(payload):
+		p.audioHeader = payload
+		header = true
+	case tag.Type != media.FLVTagVideo && tag.Type != media.FLVTagAudio:
+		return nil // not something a publisher sends
+	}
+	ts := p.timestamp(tag.Timestamp)
+	keyframe := tag.Type == media.FLVTagVideo && !header && media.IsVideoKeyframe(payload)
+	if tag.Type == media.FLVTagVideo {
+		p.hasVideo = true
+	}
+
+	for {
+		if p.c == nil {
+			if err := p.connect(ctx, ts); err != nil {
+				if ctx.Err() != nil || !p.retry(ctx, err) {
+					return err
+				}
+				continue
+			}
+			if header {
+				return nil
+			}
+		}
+		if tag.Type == media.FLVTagVideo && !header && !keyframe && p.needKeyframe {
+			return nil
+		}
+		if !p.opts.NoPacing {
+			if err := p.pacer.Wait(ctx, ts); err != nil {
+				return err
+			}
+		}
+		err := p.write(tag.Type, ts, payload)
+		if err == nil {
+			if keyframe {
+				p.needKeyframe = false
+			}
+			if !header {
+				p.failures = 0
+			}
+			return nil
+		}
+		p.disconnect()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !p.retry(ctx, err) {
+			return err
+		}
+		if header {
+			// Sent again by connect on the new connection.
+			return nil
+		}
+	}
+}
+
+// timestamp maps a source timestamp to the one sent. A new loop starts
+// one frame interval after the last timestamp sent.
+func (p *flvPush) timestamp(src uint32) uint32 {
+	if p.rebase {
+		p.rebase = false
+		p.offset = p.stats.LastTimestamp + max(p.frameDelta, 1) - src
+	} else if src > p.lastSrc {
+		p.frameDelta = src - p.lastSrc
+	}
+	p.lastSrc = src
+	return src + p.offset
+}
+
+// connect opens a new connection, publishes and resends the cached
+// headers at ts.
+func (p *flvPush) connect(ctx context.Context, ts uint32) error {
+	c, err := New(p.url)
+	if err != nil {
+		return err
+	}
+	if p.opts.Configure != nil {
+		p.opts.Configure(c)
+	}
+	if err := c.ConnectContext(ctx); err != nil {
+		return err
+	}
+	if err := c.publishAndWait(ctx); err != nil {
+		c.Close()
+		return err
+	}
+	// Drain what the server sends from now on (acknowledgements, status)
+	// so it never fills the socket buffer.
+	r := c.reader
+	go func() {
+		for {
+			if _, err := r.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	p.c = c
+	for _, h := range []struct {
+		typeID  uint8
+		payload []byte
+	}{{media.FLVTagScript, p.metadata}, {media.FLVTagVideo, p.videoHeader}, {media.FLVTagAudio, p.audioHeader}} {
+		if h.payload == nil {
+			continue
+		}
+		if err := p.write(h.typeID, ts, h.payload); err != nil {
+			p.disconnect()
+			return err
+		}
+	}
+	p.needKeyframe = p.hasVideo
+	// Pace from here rather than catching up on the time spent
+	// reconnecting.
+	p.pacer = &Pacer{Speed: p.opts.Speed}
+	return nil
+}
+
+// retry waits before the next connection attempt. It returns false when
+// the attempts are used up or ctx is done.
+func (p *flvPush) retry(ctx context.Context, err error) bool {
+	if errors.Is(err, ErrPublishRefused) || (p.opts.Reconnects >= 0 && p.failures >= p.opts.Reconnects) {
+		return false
+	}
+	p.failures++
+	if p.opts.OnReconnect != nil {
+		p.opts.OnReconnect(p.failures, err)
+	}
+	delay := p.opts.ReconnectDelay
+	if delay <= 0 {
+		delay = DefaultReconnectDelay
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+		return false
+	}
+	p.stats.Reconnects++
+	return true
+}
+
+func (p *flvPush) write(typeID uint8, ts uint32, payload []byte) error {
+	var err error
+	switch typeID {
+	case media.FLVTagAudio:
+		err = p.c.SendAudio(ts, payload)
+	case media.FLVTagVideo:
+		err = p.c.SendVideo(ts, payload)
+	default:
+		err = p.c.SendData(ts, payload)
+	}
+	if err != nil {
+		return err
+	}
+	p.stats.Messages++
+	p.stats.Bytes += int64(len(payload))
+	p.stats.LastTimestamp = ts
+	return nil
+}
+
+func (p *flvPush) disconnect() {
+	if p.c != nil {
+		p.c.Close()
+		p.c = nil
+	}
+}
+
+// setDataFrame wraps an FLV onMetaData script tag the way RTMP publishers
+// send it, as @setDataFrame so the server stores it for new players.
+func setDataFrame(onMetaData []byte) []byte {
+	prefix, err := amf.EncodeAll("@setDataFrame")
+	if err != nil {
+		return onMetaData
+	}
+	return append(prefix, onMetaData...)
+}
+
+// publishAndWait sends publish and waits for the server's answer. A
+// refusal is returned as ErrPublishRefused with the status code.
+func (c *Client) publishAndWait(ctx context.Context) error {
+	if err := c.Publish(); err != nil {
+		return err
+	}
+	c.setCommandDeadline(ctx)
+	for {
+		msg, err := c.reader.ReadMessage()
+		if err != nil {
+			return fmt.Errorf("wait for publish status: %w", err)
+		}
+		if msg.TypeID != rpc.CommandMessageAMF0TypeIDForTest() {
+			continue
+		}
+		vals, err := amf.DecodeAll(msg.Payload)
+		if err != nil || len(vals) < 4 || vals[0] != "onStatus" {
+			continue
+		}
+		info, _ := vals[3].(map[string]interface{})
+		code, _ := info["code"].(string)
+		level, _ := info["level"].(string)
+		switch {
+		case code == rpc.CodePublishStart:
+			_ = c.conn.SetDeadline(time.Time{})
+			return nil
+		case code == rpc.CodePublishBadName:
+			return fmt.Errorf("publish: %s", code)
+		case level == rpc.LevelError:
+			return fmt.Errorf("%w: %s", ErrPublishRefused, code)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// TLSOptions describes how the client verifies rtmps:// servers. The zero
+// value verifies against the system roots and sends the URL host as SNI.
+type TLSOptions struct {
+	// InsecureSkipVerify disables certificate verification. Only for
+	// testing against self-signed destinations.
+	InsecureSkipVerify bool
+	// RootCAFile is a PEM bundle of CA certificates to trust instead of the
+	// system roots (e.g. a private CA in front of an internal ingest).
+	RootCAFile string
+	// ServerName overrides the SNI / verification name, for endpoints
+	// reached by IP or through an alias.
+	ServerName string
+}
+
+// Config builds a tls.Config for use as Client.TLSConfig. It returns nil
+// for the zero value so the client falls back to its defaults.
+func (o TLSOptions) Config() (*tls.Config, error) {
+	if o == (TLSOptions{}) {
+		return nil, nil
+	}
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: o.InsecureSkipVerify,
+		ServerName:         o.ServerName,
+	}
+	if o.RootCAFile != "" {
+		pem, err := os.ReadFile(o.RootCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read root CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("root CA file contains no PEM certificates")
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
@@ -0,0 +1,145 @@
+// tls_test.go – tests for TLSOptions and rtmps:// dialing.
+//
+// A TLS listener with a freshly generated self-signed certificate (valid
+// only for "ingest.example") stands in for an RTMPS ingest. Dialing it by IP
+// shows how root CAs, SNI override and InsecureSkipVerify interact.
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// startTLSServer serves TLS with a self-signed certificate for
+// "ingest.example" and returns its address and a PEM file of the cert.
+func startTLSServer(t *testing.T) (addr, caFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ingest.example"},
+		DNSNames:              []string{"ingest.example"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	caFile = filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write CA file: %v", err)
+	}
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	})
+	if err != nil {
+		t.Fatalf("tls listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				_ = c.(*tls.Conn).Handshake()
+				silent(c)
+			}()
+		}
+	}()
+	return ln.Addr().String(), caFile
+}
+
+// dialRTMPS dials addr as an rtmps:// client configured with opts.
+func dialRTMPS(t *testing.T, addr string, opts TLSOptions) error {
+	t.Helper()
+	cfg, err := opts.Config()
+	if err != nil {
+		t.Fatalf("Config: %v", err)
+	}
+	c, err := New("rtmps://" + addr + "/live/test")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	c.TLSConfig = cfg
+	conn, err := c.dial(context.Background(), addr)
+	if err == nil {
+		conn.Close()
+	}
+	return err
+}
+
+func TestTLSOptions_Verification(t *testing.T) {
+	addr, caFile := startTLSServer(t)
+
+	if err := dialRTMPS(t, addr, TLSOptions{}); err == nil {
+		t.Errorf("expected self-signed certificate to fail against system roots")
+	}
+	if err := dialRTMPS(t, addr, TLSOptions{RootCAFile: caFile}); err == nil {
+		t.Errorf("expected name mismatch when dialing by IP without ServerName")
+	}
+	if err := dialRTMPS(t, addr, TLSOptions{RootCAFile: caFile, ServerName: "ingest.example"}); err != nil {
+		t.Errorf("custom root + SNI: %v", err)
+	}
+	if err := dialRTMPS(t, addr, TLSOptions{InsecureSkipVerify: true}); err != nil {
+		t.Errorf("insecure: %v", err)
+	}
+}
+
+func TestTLSOptions_Config(t *testing.T) {
+	if cfg, err := (TLSOptions{}).Config(); cfg != nil || err != nil {
+		t.Fatalf("zero options = (%v, %v), want (nil, nil)", cfg, err)
+	}
+	if _, err := (TLSOptions{RootCAFile: filepath.Join(t.TempDir(), "missing.pem")}).Config(); err == nil {
+		t.Fatalf("expected error for missing CA file")
+	}
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	_ = os.WriteFile(empty, []byte("not a certificate\n"), 0o600)
+	if _, err := (TLSOptions{RootCAFile: empty}).Config(); err == nil {
+		t.Fatalf("expected error for CA file without certificates")
+	}
+	cfg, err := TLSOptions{ServerName: "a.rtmp.youtube.com"}.Config()
+	if err != nil || cfg.ServerName != "a.rtmp.youtube.com" || cfg.MinVersion != tls.VersionTLS12 {
+		t.Fatalf("unexpected config %+v (err %v)", cfg, err)
+	}
+}
+
+// TestConnect_RTMPSDefaultPort verifies rtmps:// URLs without a port dial 443.
+func TestConnect_RTMPSDefaultPort(t *testing.T) {
+	c, err := New("rtmps://ingest.example/live/key")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	var dialed string
+	c.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = addr
+		return nil, &net.OpError{Op: "dial", Net: network, Err: os.ErrDeadlineExceeded}
+	}
+	_ = c.Connect()
+	if dialed != "ingest.example:443" {
+		t.Fatalf("dialed %q, want ingest.example:443", dialed)
+	}
+}
@@ -0,0 +1,29 @@
+// url_test.go – tests for RTMP URL parsing in New.
+package client
+
+import "testing"
+
+func TestNew_StreamName(t *testing.T) {
+	tests := []struct {
+		url, app, stream, tcURL string
+	}{
+		{"rtmp://localhost/live/test", "live", "test", "rtmp://localhost/live"},
+		{"rtmp://a.rtmp.youtube.com/live2/abcd/efgh-ijkl", "live2", "abcd/efgh-ijkl", "rtmp://a.rtmp.youtube.com/live2"},
+		{"rtmps://live-api-s.facebook.com:443/rtmp/FB-1-0-Ab?s_bl=1&s_sw=0", "rtmp", "FB-1-0-Ab?s_bl=1&s_sw=0", "rtmps://live-api-s.facebook.com:443/rtmp"},
+	}
+	for _, tt := range tests {
+		c, err := New(tt.url)
+		if err != nil {
+			t.Errorf("New(%q): %v", tt.url, err)
+			continue
+		}
+		if c.app != tt.app || c.streamKey != tt.app+"/"+tt.stream || c.tcURL() != tt.tcURL {
+			t.Errorf("New(%q): app=%q key=%q tcUrl=%q", tt.url, c.app, c.streamKey, c.tcURL())
+		}
+	}
+	for _, bad := range []string{"rtmp://localhost/live", "rtmp://localhost/live/", "rtmp://localhost//key"} {
+		if _, err := New(bad); err == nil {
+			t.Errorf("New(%q): expected error", bad)
+		}
+	}
+}
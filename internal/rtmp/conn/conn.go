@@ -5,6 +5,7 @@ package conn
 
 import (
 	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
@@ -16,28 +17,48 @@ import (
 
 	"github.com/alxayo/go-rtmp/internal/logger"
 	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/control"
 	"github.com/alxayo/go-rtmp/internal/rtmp/handshake"
 	"github.com/alxayo/go-rtmp/internal/rtmp/metrics"
 	"github.com/alxayo/go-rtmp/internal/rtmp/rpc"
+	"github.com/alxayo/go-rtmp/internal/rtmp/trace"
 )
 
 const (
-	// sendTimeout is the maximum time SendMessage will wait for space in the outbound
-	// queue. If the queue is full for longer than this, the message is dropped and an
-	// error is returned. This prevents a slow network from blocking the entire server.
+	// sendTimeout is the default maximum time SendMessage will wait for space in the
+	// outbound queue (Options.SendTimeout overrides it). If the queue is full for longer
+	// than this, the message is dropped and an error is returned. This prevents a slow
+	// network from blocking the entire server.
 	sendTimeout = 200 * time.Millisecond
 	// outboundQueueSize is the maximum number of messages that can be buffered for
 	// sending. When this limit is reached, new sends will block (up to sendTimeout).
-	// 100 messages provides ~3 seconds of buffer at 30fps video.
+	// 100 messages provides ~3 seconds of buffer at 30fps video. It is the
+	// default depth of each media lane; a player's SetBufferLength can raise
+	// it (see queueLimitForBuffer).
 	outboundQueueSize = 100
-
-	// readTimeout is the TCP read deadline for zombie connection detection.
+	// maxMediaQueueSize is the capacity of each media lane, and so the most
+	// a requested buffer length can raise the lane depth to.
+	maxMediaQueueSize = 1024
+	// mediaMessagesPerSecond estimates the media message rate of a typical
+	// stream (~30fps video plus ~45 AAC frames/s) when converting a
+	// buffer length in milliseconds to a queue depth.
+	mediaMessagesPerSecond = 75
+	// controlQueueSize bounds the control lane (protocol control, user
+	// control and command messages). These are small and infrequent, so a
+	// short queue is plenty; it only has to ride out a full media lane.
+	controlQueueSize = 32
+
+	// readTimeout is the default TCP read deadline for zombie connection
+	// detection (Options.ReadTimeout overrides it).
 	// Generous to accommodate idle subscribers that receive no data when
 	// no publisher is active. Publishers send data continuously (~30fps)
 	// so any timeout > a few seconds catches dead peers.
 	readTimeout = 90 * time.Second
 	// writeTimeout catches dead TCP peers that never acknowledge writes.
 	writeTimeout = 30 * time.Second
+	// shutdownTimeout bounds how long Shutdown waits for queued commands
+	// to be written before closing the connection anyway.
+	shutdownTimeout = 2 * time.Second
 )
 
 // Connection represents an accepted RTMP connection that has completed the
@@ -53,19 +74,75 @@ type Connection struct {
 	log               *slog.Logger
 
 	// Context & lifecycle
-	ctx    context.Context
-	cancel context.CancelFunc
-	wg     sync.WaitGroup
+	ctx          context.Context
+	cancel       context.CancelFunc
+	wg           sync.WaitGroup
+	shutdown     chan struct{} // closed by Shutdown; the write loop closes the connection once flushed
+	shutdownOnce sync.Once
 
 	// Protocol state (subset per T046 requirements)
 	readChunkSize  uint32
 	writeChunkSize uint32 // accessed atomically by multiple goroutines
+	pendingChunk   uint32 // size requested by SetWriteChunkSize, applied once its Set Chunk Size is written (atomic)
 	windowAckSize  uint32
-	outboundQueue  chan *chunk.Message
+	outboundQueue  chan *chunk.Message // lowest priority: video, data and anything not below
+	audioQueue     chan *chunk.Message // audio, written ahead of video
+	controlQueue   chan *chunk.Message // control and commands, written ahead of all media
+	readLimits     chunk.Limits        // inbound resource bounds applied to the chunk reader
+	limitsChanged  bool                // readLimits replaced by UpdateReadLimits (readLoop only)
+	sendTimeout    time.Duration       // how long SendMessage waits for room in a lane (0 = default sendTimeout)
+	idleTimeout    time.Duration       // read deadline per message (0 = default readTimeout)
+
+	// Media lane depth. Both media lanes are allocated with
+	// maxMediaQueueSize slots, but SendMessage only fills them up to
+	// mediaQueueLimit (atomic; 0 means the channel capacity). The write
+	// loop signals mediaDrained whenever it takes a media message so a
+	// waiting sender can recheck.
+	mediaQueueLimit int32
+	mediaDrained    chan struct{}
+
+	// Buffer lengths requested by the peer with SetBufferLength, per
+	// message stream ID, in milliseconds.
+	bufMu         sync.Mutex
+	bufferLengths map[uint32]uint32
+
+	// Inbound flow control (readLoop only). The peer announces its window
+	// with Window Acknowledgement Size; we send an Acknowledgement each time
+	// that many bytes have been received since the previous one.
+	bytesRead     atomic.Uint64 // also sampled by BytesRead
+	lastAckSent   uint64
+	peerWindowAck uint32 // set through ctrl
+
+	// Control values in both directions (see control_state.go). ctrl
+	// points control.Handle at the received ones; all of them, with
+	// readChunkSize and windowAckSize, are guarded by ctrlMu.
+	ctrlMu          sync.Mutex
+	ctrl            control.Context
+	peerBandwidth   uint32 // Set Peer Bandwidth sent to the peer
+	limitType       uint8
+	remoteBandwidth uint32 // Set Peer Bandwidth received from the peer
+	remoteLimitType uint8
+	lastPeerAck     uint32
+
+	bytesWritten atomic.Uint64 // bytes written by the writeLoop
+
+	// Heartbeat pings (see Ping): requests sent since the last response,
+	// and the round trip of the last one answered, in nanoseconds.
+	pingsUnanswered atomic.Int32
+	pingRTT         atomic.Int64
+
+	session *Session // negotiated parameters and protocol state machine
+
+	writeLatency metrics.LatencyWindow // ingest-to-write latency of stamped media messages
+
+	trace *trace.Writer // message trace (Options.TraceDir); nil when tracing is off
+
+	chunkDiagnostics int // inbound chunk headers kept for read error dumps (Options.ChunkDiagnostics)
 
 	// Internal helpers
-	onMessage    func(*chunk.Message) // test hook / dispatcher injection
-	onDisconnect func()               // called once when readLoop exits (cleanup cascade)
+	onMessage    func(*chunk.Message)     // test hook / dispatcher injection
+	onDisconnect func()                   // called once when readLoop exits (cleanup cascade)
+	onHeader     func(*chunk.ChunkHeader) // observes inbound chunk headers (nil = none)
 }
 
 // ID returns the logical connection id.
@@ -80,6 +157,24 @@ func (c *Connection) HandshakeDuration() time.Duration { return c.handshakeDurat
 // AcceptedAt returns the time the connection was accepted.
 func (c *Connection) AcceptedAt() time.Time { return c.acceptedAt }
 
+// WriteLatency returns the delivery latencies (ingest to fully written) of
+// recent media messages sent on this connection. Only messages stamped
+// with chunk.Message.Ingest are measured.
+func (c *Connection) WriteLatency() *metrics.LatencyWindow { return &c.writeLatency }
+
+// RemoteAddr returns the peer's address.
+func (c *Connection) RemoteAddr() net.Addr { return c.remoteAddr }
+
+// BytesRead returns the bytes received from the peer after the handshake.
+func (c *Connection) BytesRead() uint64 { return c.bytesRead.Load() }
+
+// BytesWritten returns the bytes of RTMP messages sent to the peer.
+func (c *Connection) BytesWritten() uint64 { return c.bytesWritten.Load() }
+
+// Session returns the connection's session state. It is closed when the
+// read loop exits, before the disconnect handler runs.
+func (c *Connection) Session() *Session { return c.session }
+
 // Close closes the underlying connection.
 func (c *Connection) Close() error {
 	if c.cancel != nil {
@@ -89,9 +184,35 @@ func (c *Connection) Close() error {
 	_ = c.netConn.Close()
 	// Wait for goroutines (bounded: they exit on ctx cancellation).
 	c.wg.Wait()
+	_ = c.trace.Close()
+	return nil
+}
+
+// Shutdown closes the connection once the control and command messages
+// already queued, such as an onStatus saying why, have been written, or
+// after shutdownTimeout. Unlike Close it does not wait for the read and
+// write loops to exit, so the message handler may call it. It always
+// returns nil.
+func (c *Connection) Shutdown() error {
+	c.shutdownOnce.Do(func() {
+		if c.shutdown == nil {
+			c.abort()
+			return
+		}
+		close(c.shutdown)
+		time.AfterFunc(shutdownTimeout, c.abort)
+	})
 	return nil
 }
 
+// abort cancels the connection and closes the socket, which ends both loops.
+func (c *Connection) abort() {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	_ = c.netConn.Close()
+}
+
 // SetMessageHandler installs a callback invoked by the readLoop for every
 // fully reassembled RTMP message. MUST be called before Start().
 func (c *Connection) SetMessageHandler(fn func(*chunk.Message)) { c.onMessage = fn }
@@ -100,37 +221,285 @@ func (c *Connection) SetMessageHandler(fn func(*chunk.Message)) { c.onMessage =
 // exits (for any reason: EOF, error, context cancel). MUST be called before Start().
 func (c *Connection) SetDisconnectHandler(fn func()) { c.onDisconnect = fn }
 
+// SetChunkHeaderHandler installs a callback invoked by the readLoop for
+// every inbound chunk header (see chunk.Reader.SetHeaderHandler). MUST be
+// called before Start().
+func (c *Connection) SetChunkHeaderHandler(fn func(*chunk.ChunkHeader)) { c.onHeader = fn }
+
+// SetReadLimits bounds inbound message sizes and chunk stream count. A peer
+// exceeding a limit is disconnected. MUST be called before Start().
+func (c *Connection) SetReadLimits(l chunk.Limits) { c.readLimits = l }
+
+// UpdateReadLimits replaces the read limits of a running connection before
+// the next message is read, e.g. to relax the limits applied before the
+// peer's connect succeeded. It MUST be called from the message handler.
+func (c *Connection) UpdateReadLimits(l chunk.Limits) {
+	c.readLimits = l
+	c.limitsChanged = true
+}
+
+// WriteChunkSize returns the outbound chunk size most recently advertised to
+// the peer.
+func (c *Connection) WriteChunkSize() uint32 { return atomic.LoadUint32(&c.writeChunkSize) }
+
+// SetWriteChunkSize changes the outbound chunk size mid-session. A Set Chunk
+// Size message is queued and the write loop switches to the new size right
+// after writing it, so messages already queued keep the size the peer
+// expects. Larger chunks cut per-chunk header overhead for high-bitrate
+// streams. size must be 1-65536; setting the current size is a no-op.
+func (c *Connection) SetWriteChunkSize(size uint32) error {
+	if size == 0 || size > maxWriteChunkSize {
+		return fmt.Errorf("chunk size %d out of range (1-%d)", size, maxWriteChunkSize)
+	}
+	if size == c.WriteChunkSize() {
+		return nil
+	}
+	atomic.StoreUint32(&c.pendingChunk, size)
+	if err := c.SendMessage(control.EncodeSetChunkSize(size)); err != nil {
+		atomic.CompareAndSwapUint32(&c.pendingChunk, size, 0)
+		return fmt.Errorf("send set chunk size: %w", err)
+	}
+	c.log.Info("Control sent: Set Chunk Size", "size", size)
+	return nil
+}
+
 // Start begins the readLoop. MUST be called after SetMessageHandler() to avoid race condition.
 func (c *Connection) Start() {
 	c.startReadLoop()
 }
 
+// ErrSendQueueFull is returned by SendMessage when the message's lane stays
+// full for the whole enqueue timeout. The message is dropped.
+var ErrSendQueueFull = errors.New("send queue full")
+
 // SendMessage enqueues a message for outbound transmission (chunked by writeLoop).
-// It enforces a small timeout to provide backpressure behavior.
+// It enforces a small timeout to provide backpressure behavior: when the
+// lane stays full for Options.SendTimeout (default 200ms) the message is
+// dropped with ErrSendQueueFull.
+//
+// Each message goes to one of three priority lanes (see queueFor), each
+// with its own capacity, so a backlog of video cannot cause ping responses
+// or onStatus replies to be dropped. Media lanes hold at most
+// MediaQueueLimit messages.
+//
+// Once queued, the connection owns the caller's reference to a pooled msg
+// and releases it after writing; on error the caller still holds it.
 func (c *Connection) SendMessage(msg *chunk.Message) error {
+	q, err := c.laneFor(msg)
+	if err != nil {
+		return err
+	}
+	// Fast-path: a lane with room needs no timer. This is the common case
+	// on the broadcast path.
+	if c.tryEnqueue(q, msg) {
+		return nil
+	}
+	t := acquireTimer(c.enqueueTimeout())
+	defer releaseTimer(t)
+	return c.enqueue(context.Background(), q, msg, t.C)
+}
+
+// SendMessageContext is SendMessage with the wait bounded by ctx instead of
+// the enqueue timeout: it blocks until the message is queued, ctx is done
+// (returning ctx.Err()) or the connection closes. Use a context with a
+// deadline to give one message a longer or shorter wait.
+func (c *Connection) SendMessageContext(ctx context.Context, msg *chunk.Message) error {
+	q, err := c.laneFor(msg)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if c.tryEnqueue(q, msg) {
+		return nil
+	}
+	return c.enqueue(ctx, q, msg, nil)
+}
+
+// laneFor validates msg and returns its lane, or context.Canceled once
+// the connection is closed.
+func (c *Connection) laneFor(msg *chunk.Message) (chan *chunk.Message, error) {
 	if c == nil || c.outboundQueue == nil {
-		return errors.New("connection not initialized")
+		return nil, errors.New("connection not initialized")
 	}
 	if msg == nil {
-		return errors.New("nil message")
+		return nil, errors.New("nil message")
 	}
-	// Fast-path: return immediately if context is already cancelled (connection closed).
+	// Return immediately if the connection is closed, rather than racing
+	// the enqueue against ctx.Done below.
 	select {
 	case <-c.ctx.Done():
-		return context.Canceled
+		return nil, context.Canceled
 	default:
 	}
-	// Derive short timeout context.
-	deadline := time.NewTimer(sendTimeout)
-	defer deadline.Stop()
+	return c.queueFor(msg), nil
+}
+
+// tryEnqueue queues msg on q if the lane has room right now.
+func (c *Connection) tryEnqueue(q chan *chunk.Message, msg *chunk.Message) bool {
+	if c.mediaLaneFull(q) {
+		return false
+	}
+	select {
+	case q <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// enqueue waits for room on q, giving up when ctx is done, the connection
+// closes or expired fires (a nil channel never does).
+func (c *Connection) enqueue(ctx context.Context, q chan *chunk.Message, msg *chunk.Message, expired <-chan time.Time) error {
+	// A media lane counts as full at MediaQueueLimit, which may be below
+	// its capacity; wait for the write loop to drain it.
+	for c.mediaLaneFull(q) {
+		select {
+		case <-c.ctx.Done():
+			return context.Canceled
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.mediaDrained:
+		case <-expired:
+			return fmt.Errorf("%w (len=%d)", ErrSendQueueFull, len(q))
+		}
+	}
 	select {
 	case <-c.ctx.Done():
 		return context.Canceled
-	case c.outboundQueue <- msg:
+	case <-ctx.Done():
+		return ctx.Err()
+	case q <- msg:
 		return nil
-	case <-deadline.C:
-		return fmt.Errorf("send queue full (len=%d)", len(c.outboundQueue))
+	case <-expired:
+		return fmt.Errorf("%w (len=%d)", ErrSendQueueFull, len(q))
+	}
+}
+
+// mediaLaneFull reports whether q is a media lane holding MediaQueueLimit
+// messages. The control lane is only bounded by its capacity.
+func (c *Connection) mediaLaneFull(q chan *chunk.Message) bool {
+	if q == c.controlQueue {
+		return false
+	}
+	limit := c.MediaQueueLimit()
+	return limit < cap(q) && len(q) >= limit
+}
+
+// enqueueTimeout returns how long SendMessage waits for room in a lane.
+func (c *Connection) enqueueTimeout() time.Duration {
+	if c.sendTimeout > 0 {
+		return c.sendTimeout
+	}
+	return sendTimeout
+}
+
+// timerPool holds stopped timers for SendMessage's slow path, so a
+// subscriber whose queue keeps filling does not allocate one per message.
+var timerPool sync.Pool
+
+func acquireTimer(d time.Duration) *time.Timer {
+	if t, ok := timerPool.Get().(*time.Timer); ok {
+		t.Reset(d)
+		return t
+	}
+	return time.NewTimer(d)
+}
+
+// releaseTimer stops t and returns it to the pool. Since Go 1.23 a stopped
+// timer's channel holds no stale value, so t can be reset safely.
+func releaseTimer(t *time.Timer) {
+	t.Stop()
+	timerPool.Put(t)
+}
+
+// queueFor picks the outbound lane for msg: protocol control, user control
+// and command messages first, then audio, then everything else. Data
+// messages such as onMetaData stay in the lowest lane so they keep their
+// position relative to the video they describe.
+func (c *Connection) queueFor(msg *chunk.Message) chan *chunk.Message {
+	switch {
+	case msg.TypeID >= control.TypeSetChunkSize && msg.TypeID <= control.TypeSetPeerBandwidth,
+		msg.TypeID == 20, msg.TypeID == 17: // AMF0 / AMF3 commands
+		if c.controlQueue != nil {
+			return c.controlQueue
+		}
+	case msg.TypeID == 8: // audio
+		if c.audioQueue != nil {
+			return c.audioQueue
+		}
+	}
+	return c.outboundQueue
+}
+
+// dequeue returns the next outbound message from the highest-priority lane
+// that has one, looking at the control lane only unless media is set. With
+// wait unset it returns nil when those lanes are empty; otherwise it blocks
+// until a message arrives or the connection closes. ok is false once the
+// connection is shutting down.
+func (c *Connection) dequeue(media, wait bool) (msg *chunk.Message, ok bool) {
+	lanes := [...]chan *chunk.Message{c.controlQueue, c.audioQueue, c.outboundQueue}
+	n := len(lanes)
+	if !media {
+		n = 1
+	}
+	for i, q := range lanes[:n] {
+		select {
+		case msg, ok = <-q:
+			if i > 0 {
+				c.signalDrained()
+			}
+			return msg, ok
+		default:
+		}
+	}
+	if !wait {
+		return nil, true
+	}
+	select {
+	case <-c.ctx.Done():
+		return nil, false
+	case <-c.shutdown:
+		return nil, true // let the write loop check whether it has flushed
+	case msg, ok = <-c.controlQueue:
+		return msg, ok
+	case msg, ok = <-c.audioQueue:
+	case msg, ok = <-c.outboundQueue:
+	}
+	c.signalDrained()
+	return msg, ok
+}
+
+// signalDrained wakes a sender waiting for room in a media lane.
+func (c *Connection) signalDrained() {
+	select {
+	case c.mediaDrained <- struct{}{}:
+	default:
+	}
+}
+
+// MediaQueueLimit returns how many messages each media lane may hold.
+func (c *Connection) MediaQueueLimit() int {
+	if limit := atomic.LoadInt32(&c.mediaQueueLimit); limit > 0 {
+		return int(limit)
 	}
+	return cap(c.outboundQueue)
+}
+
+// BufferLength returns the buffer length in milliseconds the peer
+// requested for streamID with SetBufferLength, or 0 if it never did.
+func (c *Connection) BufferLength(streamID uint32) uint32 {
+	c.bufMu.Lock()
+	defer c.bufMu.Unlock()
+	return c.bufferLengths[streamID]
+}
+
+// queueLimitForBuffer converts a buffer length in milliseconds to a media
+// lane depth, never below the default nor above the lane capacity.
+func queueLimitForBuffer(bufferMs uint32) int32 {
+	n := int64(bufferMs) * mediaMessagesPerSecond / 1000
+	return int32(min(max(n, outboundQueueSize), maxMediaQueueSize))
 }
 
 // SendReconnectRequest sends an E-RTMP v2 reconnect request to this connection,
@@ -156,23 +525,37 @@ func (c *Connection) startReadLoop() {
 	go func() {
 		defer c.wg.Done()
 		defer func() {
-			// Cleanup cascade: cancel context first (stops writeLoop via ctx.Done()),
-			// then invoke the disconnect handler for higher-level cleanup.
-			// cancel() is idempotent — safe if Close() already called it.
+			// Cleanup cascade: cancel context first (stops writeLoop via ctx.Done())
+			// and close the socket so a peer dropped for a timeout or limit
+			// violation sees the disconnect, then invoke the disconnect handler
+			// for higher-level cleanup. Both are idempotent — safe if Close()
+			// already ran.
 			c.cancel()
+			_ = c.netConn.Close()
+			_ = c.trace.Close()
+			if c.session != nil {
+				c.session.Close()
+			}
 			if c.onDisconnect != nil {
 				c.onDisconnect()
 			}
 		}()
-		r := chunk.NewReader(c.netConn, c.readChunkSize)
+		r := chunk.NewReader(countingReader{r: c.netConn, n: &c.bytesRead, trace: c.trace}, c.readChunkSize)
+		r.SetLimits(c.readLimits)
+		r.SetDiagnostics(c.chunkDiagnostics)
+		if c.onHeader != nil {
+			r.SetHeaderHandler(c.onHeader)
+		}
+		idle := c.idleTimeout
+		if idle <= 0 {
+			idle = readTimeout
+		}
 		for {
-			select {
-			case <-c.ctx.Done():
-				return
-			default:
-			}
-			_ = c.netConn.SetReadDeadline(time.Now().Add(readTimeout))
-			msg, err := r.ReadMessage()
+			// The deadline catches silent peers; cancelling c.ctx interrupts
+			// the read through the same deadline, so shutdown does not rely
+			// on the socket being closed underneath it.
+			_ = r.SetReadDeadline(time.Now().Add(idle))
+			msg, err := r.ReadMessageContext(c.ctx)
 			if err != nil {
 				// Normal disconnect paths — exit silently
 				if errors.Is(err, context.Canceled) || errors.Is(err, net.ErrClosed) || errors.Is(err, io.EOF) {
@@ -185,43 +568,227 @@ func (c *Connection) startReadLoop() {
 				c.log.Warn("readLoop timeout (zombie connection reaped)")
 					return
 				}
-				c.log.Error("readLoop error", "error", err)
+				// Resource limit violation — treat as a protocol error and drop the peer
+				if errors.Is(err, chunk.ErrLimitExceeded) {
+					metrics.ProtocolLimitViolationsTotal.Add(1)
+					c.log.Warn("readLoop limit exceeded (disconnecting)", append([]any{"error", err}, chunkDump(err)...)...)
+					return
+				}
+				c.log.Error("readLoop error", append([]any{"error", err}, chunkDump(err)...)...)
 				return
 			}
+			c.trace.Record(trace.In, msg)
+			c.handleControl(msg)
+			c.handleFlowControl()
+			c.handleUserControl(msg)
 			if c.onMessage != nil {
 				c.onMessage(msg)
 			}
+			if c.limitsChanged {
+				c.limitsChanged = false
+				r.SetLimits(c.readLimits)
+			}
 		}
 	}()
 }
 
-// startWriteLoop consumes outboundQueue and writes chunked messages.
+// handleFlowControl sends an Acknowledgement once the peer's Window
+// Acknowledgement Size (applied by handleControl) has arrived since the last one.
+// Clients such as librtmp-based encoders stall when the server never acks.
+func (c *Connection) handleFlowControl() {
+	read := c.bytesRead.Load()
+	if c.peerWindowAck == 0 || read-c.lastAckSent < uint64(c.peerWindowAck) {
+		return
+	}
+	c.lastAckSent = read
+	// The sequence number is the total received so far, modulo 2^32.
+	if err := c.SendMessage(control.EncodeAcknowledgement(uint32(read))); err != nil {
+		c.log.Debug("acknowledgement send failed", "error", err)
+	}
+}
+
+// handleUserControl tracks SetBufferLength (User Control event 3), which
+// players such as VLC and ffplay send before and during playback. The
+// largest buffer requested on any stream sets the media lane depth: a
+// player buffering several seconds absorbs a longer burst than the default
+// queue holds, so it should not have messages dropped on its behalf.
+// Ping Responses (event 7) answer the requests sent by Ping.
+func (c *Connection) handleUserControl(msg *chunk.Message) {
+	if msg.TypeID != control.TypeUserControl || msg.MessageStreamID != 0 {
+		return
+	}
+	uc, err := control.Decode(msg.TypeID, msg.Payload)
+	if err != nil {
+		c.log.Debug("user control decode failed", "error", err)
+		return
+	}
+	ev, ok := uc.(*control.UserControl)
+	if !ok {
+		return
+	}
+	if ev.EventType == control.UCPingResponse {
+		c.pingAnswered(ev.Timestamp)
+		return
+	}
+	if ev.EventType != control.UCSetBufferLength {
+		return
+	}
+	c.bufMu.Lock()
+	if c.bufferLengths == nil {
+		c.bufferLengths = make(map[uint32]uint32)
+	}
+	c.bufferLengths[ev.StreamID] = ev.BufferLength
+	var longest uint32
+	for _, ms := range c.bufferLengths {
+		longest = max(longest, ms)
+	}
+	c.bufMu.Unlock()
+	limit := queueLimitForBuffer(longest)
+	atomic.StoreInt32(&c.mediaQueueLimit, limit)
+	c.log.Debug("SetBufferLength received", "stream_id", ev.StreamID, "buffer_ms", ev.BufferLength, "media_queue", limit)
+}
+
+// chunkDump returns the log attribute carrying the chunk history of a read
+// error from a Reader in diagnostics mode, or nothing for other errors.
+func chunkDump(err error) []any {
+	var de *chunk.DiagnosticError
+	if !errors.As(err, &de) {
+		return nil
+	}
+	return []any{"chunk_diagnostics", de.Dump()}
+}
+
+// countingReader counts bytes read from the underlying reader into n and
+// adds them to the connection trace's raw capture.
+type countingReader struct {
+	r     io.Reader
+	n     *atomic.Uint64
+	trace *trace.Writer // captures the bytes read (nil when tracing is off)
+}
+
+func (cr countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n.Add(uint64(n))
+	cr.trace.RecordRaw(p[:n])
+	return n, err
+}
+
+// SetReadDeadline passes the deadline through to the underlying net.Conn,
+// letting chunk.Reader interrupt blocked reads.
+func (cr countingReader) SetReadDeadline(t time.Time) error {
+	if d, ok := cr.r.(interface{ SetReadDeadline(time.Time) error }); ok {
+		return d.SetReadDeadline(t)
+	}
+	return chunk.ErrNoDeadline
+}
+
+// countingWriter counts bytes written to the underlying writer into n.
+type countingWriter struct {
+	w io.Writer
+	n *atomic.Uint64
+}
+
+func (cw countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n.Add(uint64(n))
+	return n, err
+}
+
+// maxInterleaved caps how many media messages the write loop pulls off the
+// queues into the chunk scheduler at once. Beyond this the loop stops
+// pulling media, so the bounded queues still provide backpressure to
+// senders. The control lane is always drained; it is bounded on its own.
+const maxInterleaved = 64
+
+// startWriteLoop consumes the outbound lanes and writes chunked messages.
+// Control messages are pulled ahead of audio, and audio ahead of video.
+// Each message is moved to its chunk stream by type (see outboundCSID),
+// and chunks of messages on different chunk streams are then interleaved
+// round-robin, so a large keyframe does not hold back audio or control
+// messages queued after it.
+//
+// Set Chunk Size is a barrier: nothing queued after it is pulled into the
+// scheduler until it has been written, otherwise a later message on another
+// chunk stream could go out in the new size before the peer learns of it.
 func (c *Connection) startWriteLoop() {
 	c.wg.Add(1)
 	go func() {
 		defer c.wg.Done()
 		writeChunkSize := atomic.LoadUint32(&c.writeChunkSize)
-		w := chunk.NewWriter(c.netConn, writeChunkSize)
+		w := chunk.NewWriter(countingWriter{w: c.netConn, n: &c.bytesWritten}, writeChunkSize)
+		sched := chunk.NewScheduler(w)
+		barrier := false
 		for {
-			select {
-			case <-c.ctx.Done():
-				return
-			case msg, ok := <-c.outboundQueue:
+			// Block only when idle; otherwise pick up whatever is already
+			// queued so it can be interleaved with the message in progress.
+			wait := sched.Pending() == 0
+			for !barrier {
+				msg, ok := c.dequeue(sched.Pending() < maxInterleaved, wait)
 				if !ok {
 					return
 				}
-				currentChunkSize := atomic.LoadUint32(&c.writeChunkSize)
-				w.SetChunkSize(currentChunkSize)
-				_ = c.netConn.SetWriteDeadline(time.Now().Add(writeTimeout))
-				if err := w.WriteMessage(msg); err != nil {
+				if msg == nil {
+					break
+				}
+				msg = withOutboundCSID(msg)
+				if err := sched.Enqueue(msg); err != nil {
 					c.log.Error("writeLoop write failed", "error", err)
 					return
 				}
+				barrier = isSetChunkSize(msg)
+				wait = false
+			}
+			if c.ctx.Err() != nil {
+				return
+			}
+			if c.flushedForShutdown(sched) {
+				c.abort()
+				return
+			}
+
+			currentChunkSize := atomic.LoadUint32(&c.writeChunkSize)
+			w.SetChunkSize(currentChunkSize)
+			_ = c.netConn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			msg, err := sched.WriteNext()
+			if err != nil {
+				c.log.Error("writeLoop write failed", "error", err)
+				return
+			}
+			if msg != nil {
+				c.trace.Record(trace.Out, msg)
+			}
+			if msg != nil && !msg.Ingest.IsZero() {
+				c.writeLatency.Observe(time.Since(msg.Ingest))
+			}
+			// The peer applies a new chunk size from the chunk after Set
+			// Chunk Size onward; switch at exactly the same point.
+			if msg != nil && isSetChunkSize(msg) {
+				barrier = false
+				if size := binary.BigEndian.Uint32(msg.Payload[:4]); atomic.CompareAndSwapUint32(&c.pendingChunk, size, 0) {
+					atomic.StoreUint32(&c.writeChunkSize, size)
+				}
 			}
+			msg.Release()
 		}
 	}()
 }
 
+// flushedForShutdown reports whether Shutdown was called and every queued
+// control and command message has been written.
+func (c *Connection) flushedForShutdown(sched *chunk.Scheduler) bool {
+	select {
+	case <-c.shutdown:
+		return sched.Pending() == 0 && len(c.controlQueue) == 0
+	default:
+		return false
+	}
+}
+
+// isSetChunkSize reports whether msg is a Set Chunk Size control message.
+func isSetChunkSize(msg *chunk.Message) bool {
+	return msg.TypeID == control.TypeSetChunkSize && msg.MessageStreamID == 0 && len(msg.Payload) >= 4
+}
+
 var connCounter uint64
 
 // nextID generates a simple monotonically increasing connection identifier.
@@ -234,6 +801,12 @@ func nextID() string { return fmt.Sprintf("c%06d", atomic.AddUint64(&connCounter
 // This function is intentionally synchronous; a typical server will wrap it
 // inside an accept loop and launch a goroutine per successful connection.
 func Accept(l net.Listener) (*Connection, error) {
+	return AcceptWithOptions(l, Options{})
+}
+
+// AcceptWithOptions is Accept with control burst overrides (chunk size and
+// window acknowledgement size).
+func AcceptWithOptions(l net.Listener, opts Options) (*Connection, error) {
 	if l == nil {
 		return nil, fmt.Errorf("nil listener")
 	}
@@ -243,7 +816,7 @@ func Accept(l net.Listener) (*Connection, error) {
 	}
 
 	start := time.Now()
-	if err := handshake.ServerHandshake(raw); err != nil {
+	if err := handshake.ServerHandshakeWithOptions(raw, handshake.ServerOptions{ReplyUnsupported: opts.ReplyUnsupported}); err != nil {
 		// Handshake failure: ensure connection is closed and log context.
 		_ = raw.Close()
 		logger.Logger().Error("Handshake failed", "error", err, "remote", raw.RemoteAddr().String())
@@ -267,16 +840,35 @@ func Accept(l net.Listener) (*Connection, error) {
 		cancel:            cancel,
 		readChunkSize:     128,
 		windowAckSize:     windowAckSizeValue, // align with control burst constants
-		outboundQueue:     make(chan *chunk.Message, outboundQueueSize),
+		outboundQueue:     make(chan *chunk.Message, maxMediaQueueSize),
+		audioQueue:        make(chan *chunk.Message, maxMediaQueueSize),
+		controlQueue:      make(chan *chunk.Message, controlQueueSize),
+		mediaQueueLimit:   outboundQueueSize,
+		mediaDrained:      make(chan struct{}, 1),
+		sendTimeout:       opts.SendTimeout,
+		idleTimeout:       opts.ReadTimeout,
+		chunkDiagnostics:  opts.ChunkDiagnostics,
+		shutdown:          make(chan struct{}),
+		session:           NewSession(),
 	}
 	atomic.StoreUint32(&conn.writeChunkSize, 128)
+	conn.initControl()
+	if opts.TraceDir != "" {
+		// Opened before the write loop starts so the control burst is traced.
+		if tw, err := trace.Create(opts.TraceDir, id, raw.RemoteAddr().String()); err != nil {
+			lgr.Warn("connection trace disabled", "error", err)
+		} else {
+			conn.trace = tw
+			lgr.Info("tracing connection", "file", tw.Path())
+		}
+	}
 
 	// Start write loop first so control burst can be queued
 	conn.startWriteLoop()
 
 	// Send control burst synchronously BEFORE starting read loop
 	// This ensures the client receives the burst before we process any client messages
-	if err := sendInitialControlBurst(conn); err != nil {
+	if err := sendInitialControlBurst(conn, opts); err != nil {
 		conn.log.Error("Control burst failed", "error", err)
 		_ = conn.Close()
 		return nil, fmt.Errorf("control burst: %w", err)
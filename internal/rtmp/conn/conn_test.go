@@ -4,7 +4,8 @@
 //  1. Accept: TCP accept → server-side handshake → control burst
 //  2. ReadLoop: goroutine reads chunks and dispatches Messages via handler
 //  3. SendMessage: queues outbound messages for the write loop
-//  4. Close: graceful shutdown with context cancellation
+//  4. Close: graceful shutdown with context cancellation; Shutdown closes
+//     once queued messages are written
 //
 // Key Go concepts demonstrated:
 //   - net.Listen + net.Dial for in-process TCP testing.
@@ -15,15 +16,25 @@
 package conn
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
 	"io"
 	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/alxayo/go-rtmp/internal/logger"
 	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/control"
 	"github.com/alxayo/go-rtmp/internal/rtmp/handshake"
+	"github.com/alxayo/go-rtmp/internal/rtmp/trace"
 )
 
 // dialAndClientHandshake is a test helper that dials a TCP address and
@@ -195,16 +206,11 @@ func TestWriteLoopChunkingAndSend(t *testing.T) {
 	if serverConn == nil {
 		t.Fatalf("nil server conn")
 	}
-	atomic.StoreUint32(&serverConn.writeChunkSize, 5) // force fragmentation
-
-	payload := []byte("abcdefghij") // 10 bytes -> 2 chunks of 5
-	msg := &chunk.Message{CSID: 3, Timestamp: 0, MessageLength: uint32(len(payload)), TypeID: 20, MessageStreamID: 0, Payload: payload}
-	if err := serverConn.SendMessage(msg); err != nil {
-		t.Fatalf("SendMessage: %v", err)
-	}
 
 	r := chunk.NewReader(client, 128)
-	// Skip initial 3 control burst messages if they arrive first.
+	// Skip the initial 3 control burst messages. They must be read before
+	// the chunk size is forced below, since the write loop interleaves chunk
+	// streams and the client has not been told about the size of 5.
 	deadline := time.Now().Add(3 * time.Second)
 	burstRead := 0
 	for burstRead < 3 && time.Now().Before(deadline) {
@@ -218,6 +224,13 @@ func TestWriteLoopChunkingAndSend(t *testing.T) {
 	// The reader auto-updated to 4096 from the SetChunkSize control message.
 	// Override to match the server's forced writeChunkSize of 5.
 	r.SetChunkSize(5)
+	atomic.StoreUint32(&serverConn.writeChunkSize, 5) // force fragmentation
+
+	payload := []byte("abcdefghij") // 10 bytes -> 2 chunks of 5
+	msg := &chunk.Message{CSID: 3, Timestamp: 0, MessageLength: uint32(len(payload)), TypeID: 20, MessageStreamID: 0, Payload: payload}
+	if err := serverConn.SendMessage(msg); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
 
 	var received *chunk.Message
 	_ = client.SetReadDeadline(time.Now().Add(2 * time.Second))
@@ -264,6 +277,38 @@ func TestCloseGraceful(t *testing.T) {
 	}
 }
 
+// TestShutdownFlushesQueued verifies that Shutdown writes a message queued
+// just before it, then closes the connection without a call to Close.
+func TestShutdownFlushesQueued(t *testing.T) {
+	serverConn, client := acceptPair(t, Options{})
+	r := chunk.NewReader(client, 128)
+	readControlBurst(t, r, client)
+
+	payload := []byte("bye")
+	if err := serverConn.SendMessage(&chunk.Message{CSID: 3, TypeID: 20, MessageLength: uint32(len(payload)), Payload: payload}); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	if err := serverConn.Shutdown(); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	_ = client.SetReadDeadline(time.Now().Add(time.Second))
+	m, err := r.ReadMessage()
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(m.Payload) != string(payload) {
+		t.Fatalf("payload = %q, want %q", m.Payload, payload)
+	}
+	if _, err := r.ReadMessage(); err == nil {
+		t.Fatalf("expected the connection to be closed after Shutdown")
+	}
+	select {
+	case <-serverConn.ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("context not canceled after Shutdown")
+	}
+}
+
 // --- Disconnect Handler Tests ---
 
 // TestDisconnectHandler_FiresOnEOF verifies the disconnect handler fires
@@ -359,3 +404,693 @@ func TestDisconnectHandler_NilSafe(t *testing.T) {
 	// Close should complete without hanging or panicking
 	_ = serverConn.Close()
 }
+
+// acceptPair starts AcceptWithOptions on a loopback listener and returns the
+// server-side Connection plus the handshaken client socket.
+func acceptPair(t *testing.T, opts Options) (*Connection, net.Conn) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	connCh := make(chan *Connection, 1)
+	go func() { c, _ := AcceptWithOptions(ln, opts); connCh <- c }()
+	client := dialAndClientHandshake(t, ln.Addr().String())
+	t.Cleanup(func() { client.Close() })
+	serverConn := <-connCh
+	if serverConn == nil {
+		t.Fatalf("nil server conn")
+	}
+	t.Cleanup(func() { serverConn.Close() })
+	return serverConn, client
+}
+
+// readControlBurst reads the three control burst messages and returns the
+// last one (Set Chunk Size).
+func readControlBurst(t *testing.T, r *chunk.Reader, client net.Conn) *chunk.Message {
+	t.Helper()
+	var last *chunk.Message
+	for i := 0; i < 3; i++ {
+		_ = client.SetReadDeadline(time.Now().Add(2 * time.Second))
+		m, err := r.ReadMessage()
+		if err != nil {
+			t.Fatalf("read burst message %d: %v", i, err)
+		}
+		last = m
+	}
+	return last
+}
+
+// TestAcceptWithOptions_ChunkSize verifies a custom chunk size is advertised
+// in the control burst and used for outbound writes.
+func TestAcceptWithOptions_ChunkSize(t *testing.T) {
+	serverConn, client := acceptPair(t, Options{ChunkSize: 8192})
+	r := chunk.NewReader(client, 128)
+	scs := readControlBurst(t, r, client)
+	if scs.TypeID != control.TypeSetChunkSize || binary.BigEndian.Uint32(scs.Payload) != 8192 {
+		t.Fatalf("expected Set Chunk Size 8192, got type=%d payload=%x", scs.TypeID, scs.Payload)
+	}
+	if got := serverConn.WriteChunkSize(); got != 8192 {
+		t.Fatalf("WriteChunkSize=%d want 8192", got)
+	}
+}
+
+// TestSetWriteChunkSize verifies a mid-session change sends Set Chunk Size
+// and that the next message is chunked at the new size.
+func TestSetWriteChunkSize(t *testing.T) {
+	serverConn, client := acceptPair(t, Options{})
+	r := chunk.NewReader(client, 128)
+	readControlBurst(t, r, client)
+
+	if err := serverConn.SetWriteChunkSize(0); err == nil {
+		t.Fatalf("expected error for size 0")
+	}
+	if err := serverConn.SetWriteChunkSize(65537); err == nil {
+		t.Fatalf("expected error for size 65537")
+	}
+	if err := serverConn.SetWriteChunkSize(16); err != nil {
+		t.Fatalf("SetWriteChunkSize: %v", err)
+	}
+	payload := make([]byte, 100) // 7 chunks at 16 bytes
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	if err := serverConn.SendMessage(&chunk.Message{CSID: 3, MessageLength: uint32(len(payload)), TypeID: 20, Payload: payload}); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+
+	// The reader auto-applies the Set Chunk Size, so a successful read of
+	// the following message proves both sides switched at the same point.
+	_ = client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	scs, err := r.ReadMessage()
+	if err != nil {
+		t.Fatalf("read set chunk size: %v", err)
+	}
+	if scs.TypeID != control.TypeSetChunkSize || binary.BigEndian.Uint32(scs.Payload) != 16 {
+		t.Fatalf("expected Set Chunk Size 16, got type=%d payload=%x", scs.TypeID, scs.Payload)
+	}
+	m, err := r.ReadMessage()
+	if err != nil {
+		t.Fatalf("read payload: %v", err)
+	}
+	if string(m.Payload) != string(payload) {
+		t.Fatalf("payload mismatch")
+	}
+	if got := serverConn.WriteChunkSize(); got != 16 {
+		t.Fatalf("WriteChunkSize=%d want 16", got)
+	}
+}
+
+// TestAcknowledgementSentAfterPeerWindow verifies the server acknowledges
+// received bytes once the client's announced window is exceeded.
+func TestAcknowledgementSentAfterPeerWindow(t *testing.T) {
+	logger.UseWriter(io.Discard)
+	serverConn, client := acceptPair(t, Options{})
+	serverConn.Start()
+	r := chunk.NewReader(client, 128)
+	readControlBurst(t, r, client)
+
+	w := chunk.NewWriter(client, 128)
+	_ = client.SetWriteDeadline(time.Now().Add(2 * time.Second))
+	if err := w.WriteMessage(control.EncodeWindowAcknowledgementSize(100)); err != nil {
+		t.Fatalf("write window ack: %v", err)
+	}
+	payload := make([]byte, 120)
+	if err := w.WriteMessage(&chunk.Message{CSID: 4, MessageLength: uint32(len(payload)), TypeID: 8, MessageStreamID: 1, Payload: payload}); err != nil {
+		t.Fatalf("write audio: %v", err)
+	}
+
+	_ = client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	m, err := r.ReadMessage()
+	if err != nil {
+		t.Fatalf("read ack: %v", err)
+	}
+	if m.TypeID != control.TypeAcknowledgement {
+		t.Fatalf("expected Acknowledgement, got type=%d", m.TypeID)
+	}
+	if seq := binary.BigEndian.Uint32(m.Payload); seq < 100 {
+		t.Fatalf("ack sequence=%d want >= 100", seq)
+	}
+}
+
+// TestControlStateTracking verifies that control messages from the peer
+// are applied through control.Handle (ping requests answered, the peer's
+// values recorded) and that values sent with the Send helpers are tracked.
+func TestControlStateTracking(t *testing.T) {
+	logger.UseWriter(io.Discard)
+	serverConn, client := acceptPair(t, Options{PeerLimit: "soft"})
+	serverConn.Start()
+	r := chunk.NewReader(client, 128)
+	readControlBurst(t, r, client)
+
+	got := serverConn.ControlState()
+	if got.WindowAckSize != windowAckSizeValue || got.PeerBandwidth != peerBandwidthValue || got.LimitType != control.LimitSoft || got.WriteChunkSize != serverChunkSize {
+		t.Fatalf("state after burst = %+v", got)
+	}
+
+	w := chunk.NewWriter(client, 128)
+	_ = client.SetWriteDeadline(time.Now().Add(2 * time.Second))
+	for _, m := range []*chunk.Message{
+		control.EncodeSetChunkSize(1024),
+		control.EncodeWindowAcknowledgementSize(5_000_000),
+		control.EncodeSetPeerBandwidth(1_000_000, control.LimitHard),
+		control.EncodeAcknowledgement(4242),
+		control.EncodeUserControlPingRequest(77),
+	} {
+		if err := w.WriteMessage(m); err != nil {
+			t.Fatalf("write type %d: %v", m.TypeID, err)
+		}
+		if m.TypeID == control.TypeSetChunkSize {
+			w.SetChunkSize(1024)
+		}
+	}
+
+	_ = client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	m, err := r.ReadMessage()
+	if err != nil {
+		t.Fatalf("read ping response: %v", err)
+	}
+	v, err := control.Decode(m.TypeID, m.Payload)
+	if uc, ok := v.(*control.UserControl); err != nil || !ok || uc.EventType != control.UCPingResponse || uc.Timestamp != 77 {
+		t.Fatalf("expected ping response 77, got %#v (%v)", v, err)
+	}
+	got = serverConn.ControlState()
+	if got.ReadChunkSize != 1024 || got.RemoteWindowAckSize != 5_000_000 || got.RemoteBandwidth != 1_000_000 || got.RemoteLimitType != control.LimitHard || got.LastAck != 4242 {
+		t.Fatalf("received state = %+v", got)
+	}
+
+	if err := serverConn.SendWindowAckSize(1_000_000); err != nil {
+		t.Fatalf("SendWindowAckSize: %v", err)
+	}
+	if err := serverConn.SendSetPeerBandwidth(3_000_000, control.LimitHard); err != nil {
+		t.Fatalf("SendSetPeerBandwidth: %v", err)
+	}
+	got = serverConn.ControlState()
+	if got.WindowAckSize != 1_000_000 || got.PeerBandwidth != 3_000_000 || got.LimitType != control.LimitHard {
+		t.Fatalf("sent state = %+v", got)
+	}
+}
+
+// TestSendMessage_PriorityLanes verifies that a full video lane does not
+// block control or audio messages, and that the write loop dequeues control
+// first, then audio, then video.
+func TestSendMessage_PriorityLanes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := &Connection{
+		ctx:           ctx,
+		cancel:        cancel,
+		outboundQueue: make(chan *chunk.Message, 2),
+		audioQueue:    make(chan *chunk.Message, 2),
+		controlQueue:  make(chan *chunk.Message, 2),
+	}
+	video := func() *chunk.Message {
+		return &chunk.Message{CSID: 6, TypeID: 9, MessageStreamID: 1, Payload: []byte{0x17}}
+	}
+	for i := 0; i < 2; i++ {
+		if err := c.SendMessage(video()); err != nil {
+			t.Fatalf("video %d: %v", i, err)
+		}
+	}
+	if err := c.SendMessage(video()); err == nil {
+		t.Fatalf("expected full video lane to reject message")
+	}
+
+	ping := control.EncodeUserControlPingResponse(42)
+	if err := c.SendMessage(ping); err != nil {
+		t.Fatalf("ping response blocked by video backlog: %v", err)
+	}
+	audio := &chunk.Message{CSID: 4, TypeID: 8, MessageStreamID: 1, Payload: []byte{0xAF}}
+	if err := c.SendMessage(audio); err != nil {
+		t.Fatalf("audio blocked by video backlog: %v", err)
+	}
+
+	if m, _ := c.dequeue(false, false); m != ping {
+		t.Fatalf("control-only dequeue = %+v, want ping response", m)
+	}
+	if m, _ := c.dequeue(false, false); m != nil {
+		t.Fatalf("control-only dequeue returned media: %+v", m)
+	}
+	want := []uint8{8, 9, 9}
+	for i, typ := range want {
+		m, ok := c.dequeue(true, false)
+		if !ok || m == nil || m.TypeID != typ {
+			t.Fatalf("dequeue %d = %+v, want type %d", i, m, typ)
+		}
+	}
+}
+
+// TestControlSendHelpers verifies the typed control helpers put the
+// expected User Control events on the wire.
+func TestControlSendHelpers(t *testing.T) {
+	serverConn, client := acceptPair(t, Options{})
+	r := chunk.NewReader(client, 128)
+	readControlBurst(t, r, client)
+
+	sends := []struct {
+		send  func() error
+		event uint16
+	}{
+		{func() error { return serverConn.SendStreamBegin(1) }, control.UCStreamBegin},
+		{func() error { return serverConn.SendStreamDry(1) }, control.UCStreamDry},
+		{func() error { return serverConn.SendStreamIsRecorded(1) }, control.UCStreamIsRecorded},
+		{func() error { return serverConn.SendSetBufferLength(1, 500) }, control.UCSetBufferLength},
+		{serverConn.SendPingRequest, control.UCPingRequest},
+		{func() error { return serverConn.SendStreamEOF(1) }, control.UCStreamEOF},
+	}
+	for _, s := range sends {
+		if err := s.send(); err != nil {
+			t.Fatalf("send event %d: %v", s.event, err)
+		}
+	}
+	for _, s := range sends {
+		_ = client.SetReadDeadline(time.Now().Add(2 * time.Second))
+		m, err := r.ReadMessage()
+		if err != nil {
+			t.Fatalf("read event %d: %v", s.event, err)
+		}
+		v, err := control.Decode(m.TypeID, m.Payload)
+		if err != nil {
+			t.Fatalf("decode event %d: %v", s.event, err)
+		}
+		if uc, ok := v.(*control.UserControl); !ok || uc.EventType != s.event {
+			t.Fatalf("got %#v, want user control event %d", v, s.event)
+		}
+	}
+}
+
+// TestSetBufferLengthSizesMediaQueue verifies that a player's
+// SetBufferLength is recorded per stream and that the longest buffer
+// requested sets the media lane depth.
+func TestSetBufferLengthSizesMediaQueue(t *testing.T) {
+	logger.UseWriter(io.Discard)
+	serverConn, client := acceptPair(t, Options{})
+	serverConn.Start()
+	r := chunk.NewReader(client, 128)
+	readControlBurst(t, r, client)
+
+	if got := serverConn.MediaQueueLimit(); got != outboundQueueSize {
+		t.Fatalf("default media queue = %d, want %d", got, outboundQueueSize)
+	}
+	w := chunk.NewWriter(client, 128)
+	_ = client.SetWriteDeadline(time.Now().Add(2 * time.Second))
+	for _, m := range []*chunk.Message{
+		control.EncodeUserControlSetBufferLength(1, 4000),
+		control.EncodeUserControlSetBufferLength(2, 100),
+	} {
+		if err := w.WriteMessage(m); err != nil {
+			t.Fatalf("write SetBufferLength: %v", err)
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for serverConn.BufferLength(2) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := serverConn.BufferLength(1); got != 4000 {
+		t.Fatalf("BufferLength(1) = %d, want 4000", got)
+	}
+	if got := serverConn.BufferLength(2); got != 100 {
+		t.Fatalf("BufferLength(2) = %d, want 100", got)
+	}
+	if got, want := serverConn.MediaQueueLimit(), 4000*mediaMessagesPerSecond/1000; got != want {
+		t.Fatalf("media queue = %d, want %d", got, want)
+	}
+
+	for ms, want := range map[uint32]int32{0: outboundQueueSize, 100: outboundQueueSize, 60000: maxMediaQueueSize} {
+		if got := queueLimitForBuffer(ms); got != want {
+			t.Errorf("queueLimitForBuffer(%d) = %d, want %d", ms, got, want)
+		}
+	}
+}
+
+// TestPingTracksResponses verifies that Ping counts requests until the
+// peer answers one, and that the answer sets the round trip.
+func TestPingTracksResponses(t *testing.T) {
+	logger.UseWriter(io.Discard)
+	serverConn, client := acceptPair(t, Options{})
+	serverConn.Start()
+	r := chunk.NewReader(client, 128)
+	readControlBurst(t, r, client)
+
+	var ts uint32
+	for i := 0; i < 2; i++ {
+		if err := serverConn.Ping(); err != nil {
+			t.Fatalf("ping: %v", err)
+		}
+		_ = client.SetReadDeadline(time.Now().Add(2 * time.Second))
+		m, err := r.ReadMessage()
+		if err != nil {
+			t.Fatalf("read ping request: %v", err)
+		}
+		v, _ := control.Decode(m.TypeID, m.Payload)
+		uc, ok := v.(*control.UserControl)
+		if !ok || uc.EventType != control.UCPingRequest {
+			t.Fatalf("got %#v, want a ping request", v)
+		}
+		ts = uc.Timestamp
+	}
+	if n := serverConn.PingsUnanswered(); n != 2 || serverConn.PingRTT() != 0 {
+		t.Fatalf("unanswered = %d, rtt = %v before any response", n, serverConn.PingRTT())
+	}
+
+	w := chunk.NewWriter(client, 128)
+	_ = client.SetWriteDeadline(time.Now().Add(2 * time.Second))
+	if err := w.WriteMessage(control.EncodeUserControlPingResponse(ts)); err != nil {
+		t.Fatalf("write ping response: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for serverConn.PingsUnanswered() != 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := serverConn.PingsUnanswered(); n != 0 || serverConn.PingRTT() <= 0 {
+		t.Fatalf("unanswered = %d, rtt = %v after the response", n, serverConn.PingRTT())
+	}
+}
+
+// TestSendMessage_MediaQueueLimit verifies that a media lane counts as full
+// at the queue limit rather than its capacity, and accepts again once the
+// write loop takes a message.
+func TestSendMessage_MediaQueueLimit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := &Connection{
+		ctx:             ctx,
+		cancel:          cancel,
+		outboundQueue:   make(chan *chunk.Message, 8),
+		audioQueue:      make(chan *chunk.Message, 8),
+		controlQueue:    make(chan *chunk.Message, 2),
+		mediaQueueLimit: 2,
+		mediaDrained:    make(chan struct{}, 1),
+	}
+	video := &chunk.Message{CSID: 6, TypeID: 9, MessageStreamID: 1, Payload: []byte{0x17}}
+	for i := 0; i < 2; i++ {
+		if err := c.SendMessage(video); err != nil {
+			t.Fatalf("video %d: %v", i, err)
+		}
+	}
+	if err := c.SendMessage(video); err == nil {
+		t.Fatal("expected video lane at its limit to reject message")
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		c.dequeue(true, false)
+	}()
+	if err := c.SendMessage(video); err != nil {
+		t.Fatalf("send after drain: %v", err)
+	}
+}
+
+// TestSendMessageContext verifies that a full lane waits for the caller's
+// context rather than the enqueue timeout, and that SendMessage honours a
+// configured SendTimeout.
+func TestSendMessageContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := &Connection{
+		ctx:             ctx,
+		cancel:          cancel,
+		outboundQueue:   make(chan *chunk.Message, 8),
+		audioQueue:      make(chan *chunk.Message, 8),
+		controlQueue:    make(chan *chunk.Message, 2),
+		mediaQueueLimit: 1,
+		mediaDrained:    make(chan struct{}, 1),
+		sendTimeout:     10 * time.Millisecond,
+	}
+	video := &chunk.Message{CSID: 6, TypeID: 9, MessageStreamID: 1, Payload: []byte{0x17}}
+	if err := c.SendMessageContext(context.Background(), video); err != nil {
+		t.Fatalf("first video: %v", err)
+	}
+
+	start := time.Now()
+	if err := c.SendMessage(video); !errors.Is(err, ErrSendQueueFull) {
+		t.Fatalf("SendMessage on a full lane = %v, want ErrSendQueueFull", err)
+	}
+	if waited := time.Since(start); waited > 150*time.Millisecond {
+		t.Fatalf("SendMessage waited %v with a 10ms SendTimeout", waited)
+	}
+
+	short, stop := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer stop()
+	if err := c.SendMessageContext(short, video); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("SendMessageContext past its deadline = %v, want DeadlineExceeded", err)
+	}
+
+	// Without a deadline the send waits as long as it takes to drain.
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		c.dequeue(true, false)
+	}()
+	if err := c.SendMessageContext(context.Background(), video); err != nil {
+		t.Fatalf("SendMessageContext after drain: %v", err)
+	}
+
+	cancel()
+	if err := c.SendMessageContext(context.Background(), video); !errors.Is(err, context.Canceled) {
+		t.Fatalf("send after close = %v, want context.Canceled", err)
+	}
+}
+
+// TestWriteLoopAssignsCSIDs verifies that outbound messages go out on the
+// chunk stream for their type, whatever CSID the caller set, and that the
+// caller's message is left unchanged.
+func TestWriteLoopAssignsCSIDs(t *testing.T) {
+	serverConn, client := acceptPair(t, Options{})
+	r := chunk.NewReader(client, 128)
+	readControlBurst(t, r, client)
+
+	msgs := []struct {
+		msg  *chunk.Message
+		csid uint32
+	}{
+		{&chunk.Message{CSID: 3, TypeID: 20, MessageStreamID: 0, Payload: []byte{0x05}}, CSIDCommand},
+		{&chunk.Message{CSID: 3, TypeID: 20, MessageStreamID: 1, Payload: []byte{0x05}}, CSIDStreamCommand},
+		{&chunk.Message{CSID: 6, TypeID: 8, MessageStreamID: 1, Payload: []byte{0xAF}}, CSIDAudio},
+		{&chunk.Message{CSID: 7, TypeID: 9, MessageStreamID: 1, Payload: []byte{0x17}}, CSIDVideo},
+		{&chunk.Message{CSID: 4, TypeID: 18, MessageStreamID: 1, Payload: []byte{0x02}}, CSIDData},
+		{control.EncodeUserControlStreamBegin(1), CSIDProtocolControl},
+	}
+	for _, m := range msgs {
+		if err := serverConn.SendMessage(m.msg); err != nil {
+			t.Fatalf("send type %d: %v", m.msg.TypeID, err)
+		}
+	}
+	got := map[uint8][]uint32{}
+	for range msgs {
+		_ = client.SetReadDeadline(time.Now().Add(2 * time.Second))
+		m, err := r.ReadMessage()
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		got[m.TypeID] = append(got[m.TypeID], m.CSID)
+	}
+	for _, m := range msgs {
+		ids := got[m.msg.TypeID]
+		if len(ids) == 0 {
+			t.Fatalf("type %d not received", m.msg.TypeID)
+		}
+		// Commands arrive in order: stream 0 first, then stream 1.
+		if ids[0] != m.csid {
+			t.Errorf("type %d msid %d on CSID %d, want %d", m.msg.TypeID, m.msg.MessageStreamID, ids[0], m.csid)
+		}
+		got[m.msg.TypeID] = ids[1:]
+	}
+	if msgs[3].msg.CSID != 7 {
+		t.Fatalf("caller's message modified: CSID=%d", msgs[3].msg.CSID)
+	}
+}
+
+// TestPrechunk verifies that Prechunk frames a message for the chunk stream
+// the write loop moves it to, and that copies sent with different message
+// stream IDs arrive intact.
+func TestPrechunk(t *testing.T) {
+	serverConn, client := acceptPair(t, Options{})
+	r := chunk.NewReader(client, 128)
+	readControlBurst(t, r, client)
+
+	size := serverConn.WriteChunkSize()
+	payload := make([]byte, 3*size+5)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	msg := &chunk.Message{CSID: 9, TypeID: 9, MessageStreamID: 1, Payload: payload}
+	Prechunk(msg, size)
+	if !msg.Prechunked(CSIDVideo, size) {
+		t.Fatalf("no framing for CSID %d, chunk size %d", CSIDVideo, size)
+	}
+	for _, msid := range []uint32{1, 2} {
+		m := msg.Share()
+		m.MessageStreamID = msid
+		if err := serverConn.SendMessage(m); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+	for _, msid := range []uint32{1, 2} {
+		_ = client.SetReadDeadline(time.Now().Add(2 * time.Second))
+		m, err := r.ReadMessage()
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if m.MessageStreamID != msid || m.CSID != CSIDVideo || !bytes.Equal(m.Payload, payload) {
+			t.Fatalf("received msid %d on CSID %d, %d bytes; want msid %d, CSID %d, payload intact",
+				m.MessageStreamID, m.CSID, len(m.Payload), msid, CSIDVideo)
+		}
+	}
+}
+
+// TestConnectionTrace verifies that with Options.TraceDir the control burst
+// and inbound messages end up in the connection's trace file, and the bytes
+// the client sent in its raw capture.
+func TestConnectionTrace(t *testing.T) {
+	dir := t.TempDir()
+	serverConn, client := acceptPair(t, Options{TraceDir: dir})
+	received := make(chan struct{})
+	serverConn.SetMessageHandler(func(*chunk.Message) { close(received) })
+	serverConn.Start()
+
+	readControlBurst(t, chunk.NewReader(client, 128), client)
+	var sent bytes.Buffer
+	w := chunk.NewWriter(io.MultiWriter(client, &sent), 128)
+	if err := w.WriteMessage(&chunk.Message{CSID: 3, TypeID: 20, Payload: []byte{0x05}}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	select {
+	case <-received:
+	case <-time.After(2 * time.Second):
+		t.Fatal("message not received")
+	}
+	_ = serverConn.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, serverConn.ID()+"-*.jsonl"))
+	if len(files) != 1 {
+		t.Fatalf("trace files = %v, want one for %s", files, serverConn.ID())
+	}
+	f, err := os.Open(files[0])
+	if err != nil {
+		t.Fatalf("open trace: %v", err)
+	}
+	defer f.Close()
+	r, err := trace.NewReader(f)
+	if err != nil {
+		t.Fatalf("trace reader: %v", err)
+	}
+	var out, in []uint8
+	for {
+		rec, err := r.Next()
+		if err != nil {
+			break
+		}
+		if rec.Dir == trace.Out {
+			out = append(out, rec.TypeID)
+		} else {
+			in = append(in, rec.TypeID)
+			if rec.Raw != int64(sent.Len()) {
+				t.Errorf("inbound record ends at raw offset %d, want %d", rec.Raw, sent.Len())
+			}
+		}
+	}
+	if raw, err := trace.ReadRaw(files[0], r.Header()); err != nil || !bytes.Equal(raw, sent.Bytes()) {
+		t.Errorf("raw capture = %x, %v, want %x", raw, err, sent.Bytes())
+	}
+	if len(out) != 3 || out[0] != control.TypeWindowAcknowledgement || out[2] != control.TypeSetChunkSize {
+		t.Fatalf("traced outbound types = %v, want the control burst", out)
+	}
+	if len(in) != 1 || in[0] != 20 {
+		t.Fatalf("traced inbound types = %v, want [20]", in)
+	}
+}
+
+// TestReadTimeoutDisconnectsSilentPeer verifies that Options.ReadTimeout
+// ends the read loop of a peer that sends nothing, and that cancelling the
+// connection interrupts a blocked read without waiting for the deadline.
+func TestReadTimeoutDisconnectsSilentPeer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	for _, tc := range []struct {
+		name    string
+		timeout time.Duration
+		cancel  bool
+	}{
+		{"idle timeout", 100 * time.Millisecond, false},
+		{"cancel", time.Minute, true},
+	} {
+		connCh := make(chan *Connection, 1)
+		go func() { c, _ := AcceptWithOptions(ln, Options{ReadTimeout: tc.timeout}); connCh <- c }()
+		client := dialAndClientHandshake(t, ln.Addr().String())
+
+		serverConn := <-connCh
+		if serverConn == nil {
+			t.Fatalf("%s: server conn nil", tc.name)
+		}
+		gone := make(chan struct{})
+		serverConn.SetDisconnectHandler(func() { close(gone) })
+		serverConn.Start()
+		if tc.cancel {
+			serverConn.cancel()
+		}
+
+		select {
+		case <-gone:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s: read loop still running", tc.name)
+		}
+		_ = serverConn.Close()
+		client.Close()
+	}
+}
+
+// lockedBuffer is a bytes.Buffer safe for the connection's goroutines to log to.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// TestChunkDiagnosticsLogged verifies that with Options.ChunkDiagnostics a
+// peer dropping mid-message gets the chunk history logged with the error.
+func TestChunkDiagnosticsLogged(t *testing.T) {
+	var logs lockedBuffer
+	logger.UseWriter(&logs)
+	defer logger.UseWriter(io.Discard)
+	serverConn, client := acceptPair(t, Options{ChunkDiagnostics: 8})
+	done := make(chan struct{})
+	serverConn.SetDisconnectHandler(func() { close(done) })
+	serverConn.Start()
+
+	var buf bytes.Buffer
+	if err := chunk.NewWriter(&buf, 128).WriteMessage(&chunk.Message{CSID: 6, TypeID: 9, MessageStreamID: 1, Payload: make([]byte, 1000)}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := client.Write(buf.Bytes()[:300]); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	client.Close()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("read loop did not end")
+	}
+	out := logs.String()
+	for _, s := range []string{"readLoop error", "chunk_diagnostics", "csid 6: type 9, 256 of 1000 bytes received"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("log lacks %q:\n%s", s, out)
+		}
+	}
+}
@@ -7,10 +7,14 @@ package conn
 //   1. Window Acknowledgement Size — flow control (client must ack after N bytes)
 //   2. Set Peer Bandwidth — suggests the client's max output rate
 //   3. Set Chunk Size — increases chunk payload from default 128 to 4096 bytes
+//
+// The window, peer bandwidth (and its limit type) and chunk size can be
+// overridden per connection via Options.
 
 import (
 	"fmt"
 	"sync/atomic"
+	"time"
 
 	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
 	"github.com/alxayo/go-rtmp/internal/rtmp/control"
@@ -21,22 +25,28 @@ const (
 	peerBandwidthValue     uint32 = 2_500_000 // suggested maximum output rate for client
 	peerBandwidthLimitType        = 2         // Dynamic: client may adjust this value
 	serverChunkSize        uint32 = 4096      // negotiated chunk size (up from protocol default of 128)
+
+	// maxWriteChunkSize is the largest outbound chunk size we advertise. The
+	// protocol allows 31 bits, but common clients (and our own reader) reject
+	// anything above 65536.
+	maxWriteChunkSize uint32 = 65536
 )
 
 // sendInitialControlBurst performs the control burst by enqueuing messages
 // to the connection's outbound queue. It is invoked asynchronously by Accept().
 // A best-effort approach is used: the first encountered error aborts the
 // remaining sends (subsequent tasks may choose to retry / degrade gracefully).
-func sendInitialControlBurst(c *Connection) error {
+func sendInitialControlBurst(c *Connection, opts Options) error {
 	if c == nil {
 		return fmt.Errorf("control burst: nil connection")
 	}
+	opts.applyDefaults()
 
 	// Build messages in required order.
 	msgs := []*chunk.Message{
-		control.EncodeWindowAcknowledgementSize(windowAckSizeValue),
-		control.EncodeSetPeerBandwidth(peerBandwidthValue, peerBandwidthLimitType),
-		control.EncodeSetChunkSize(serverChunkSize),
+		control.EncodeWindowAcknowledgementSize(opts.WindowAckSize),
+		control.EncodeSetPeerBandwidth(opts.PeerBandwidth, opts.limitType),
+		control.EncodeSetChunkSize(opts.ChunkSize),
 	}
 
 	for _, m := range msgs {
@@ -46,9 +56,51 @@ func sendInitialControlBurst(c *Connection) error {
 	}
 
 	// Log what was sent and update connection's write chunk size to match.
-	c.log.Info("Control sent: Window Acknowledgement Size", "size", windowAckSizeValue)
-	c.log.Info("Control sent: Set Peer Bandwidth", "bandwidth", peerBandwidthValue, "limit_type", peerBandwidthLimitType)
-	c.log.Info("Control sent: Set Chunk Size", "size", serverChunkSize)
-	atomic.StoreUint32(&c.writeChunkSize, serverChunkSize)
+	// Switching before the Set Chunk Size message is written is safe because
+	// the two messages queued ahead of it are far smaller than 128 bytes.
+	c.log.Info("Control sent: Window Acknowledgement Size", "size", opts.WindowAckSize)
+	c.log.Info("Control sent: Set Peer Bandwidth", "bandwidth", opts.PeerBandwidth, "limit_type", opts.limitType)
+	c.log.Info("Control sent: Set Chunk Size", "size", opts.ChunkSize)
+	c.setAdvertised(opts.WindowAckSize, opts.PeerBandwidth, opts.limitType)
+	atomic.StoreUint32(&c.writeChunkSize, opts.ChunkSize)
 	return nil
 }
+
+// Options overrides the values advertised in the control burst. Zero fields
+// use the package defaults (4096-byte chunks, 2.5 MB window and peer
+// bandwidth, dynamic limit).
+type Options struct {
+	ChunkSize     uint32        // outbound chunk size (1-65536)
+	WindowAckSize uint32        // Window Acknowledgement Size sent to the peer (it acks every N bytes received)
+	PeerBandwidth uint32        // Set Peer Bandwidth value: the peer's suggested output limit in bytes
+	PeerLimit     string        // Set Peer Bandwidth limit type: "hard", "soft" or "dynamic" (see control.ParseLimitType)
+	TraceDir      string        // when set, every message in and out is traced to a file here (see package trace)
+	SendTimeout   time.Duration // how long SendMessage waits for room in a full lane (default 200ms)
+	ReadTimeout   time.Duration // how long the peer may send nothing before it is disconnected (default 90s)
+
+	// ChunkDiagnostics keeps the last N inbound chunk headers and raw bytes
+	// and logs them when a read fails (see chunk.Reader.SetDiagnostics).
+	// 0 disables it.
+	ChunkDiagnostics int
+
+	ReplyUnsupported bool // answer RTMPE/RTMPT clients before closing (see handshake.ServerOptions)
+
+	limitType uint8 // PeerLimit parsed by applyDefaults
+}
+
+func (o *Options) applyDefaults() {
+	if o.ChunkSize == 0 || o.ChunkSize > maxWriteChunkSize {
+		o.ChunkSize = serverChunkSize
+	}
+	if o.WindowAckSize == 0 {
+		o.WindowAckSize = windowAckSizeValue
+	}
+	if o.PeerBandwidth == 0 {
+		o.PeerBandwidth = peerBandwidthValue
+	}
+	lt, err := control.ParseLimitType(o.PeerLimit)
+	if err != nil {
+		lt = peerBandwidthLimitType
+	}
+	o.limitType = lt
+}
@@ -106,3 +106,47 @@ func TestControlBurstSequence(t *testing.T) {
 		}
 	}
 }
+
+// TestControlBurstPeerBandwidthOptions verifies that Options.PeerBandwidth
+// and Options.PeerLimit replace the default Set Peer Bandwidth payload.
+func TestControlBurstPeerBandwidthOptions(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	acceptCh := make(chan *Connection, 1)
+	go func() {
+		c, err := AcceptWithOptions(ln, Options{PeerBandwidth: 5_000_000, PeerLimit: "hard"})
+		if err == nil {
+			acceptCh <- c
+		}
+	}()
+
+	client := dialAndHandshake(t, ln.Addr().String())
+	defer client.Close()
+	select {
+	case serverConn := <-acceptCh:
+		defer serverConn.Close()
+	case <-time.After(3 * time.Second):
+		t.Fatalf("timeout waiting for accept")
+	}
+
+	r := chunk.NewReader(client, 128)
+	for i := 0; i < 2; i++ {
+		_ = client.SetReadDeadline(time.Now().Add(2 * time.Second))
+		msg, err := r.ReadMessage()
+		if err != nil {
+			t.Fatalf("read message %d: %v", i, err)
+		}
+		if msg.TypeID != control.TypeSetPeerBandwidth {
+			continue
+		}
+		if binary.BigEndian.Uint32(msg.Payload[:4]) != 5_000_000 || msg.Payload[4] != control.LimitHard {
+			t.Fatalf("SPB payload mismatch: % X", msg.Payload)
+		}
+		return
+	}
+	t.Fatal("no Set Peer Bandwidth message in the burst")
+}
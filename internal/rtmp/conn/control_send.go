@@ -0,0 +1,111 @@
+package conn
+
+// Control Message Helpers
+// =======================
+// Typed senders for RTMP protocol control and User Control messages, so
+// higher layers don't build them with the control package encoders and
+// SendMessage by hand. Each helper queues the message like SendMessage
+// (control lane, so it never waits behind media) and returns its error.
+
+import (
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/control"
+)
+
+// SendStreamBegin tells the peer that streamID is ready (User Control event 0).
+func (c *Connection) SendStreamBegin(streamID uint32) error {
+	return c.SendMessage(control.EncodeUserControlStreamBegin(streamID))
+}
+
+// SendStreamEOF tells the peer that playback on streamID has ended
+// (User Control event 1).
+func (c *Connection) SendStreamEOF(streamID uint32) error {
+	return c.SendMessage(control.EncodeUserControlStreamEOF(streamID))
+}
+
+// SendStreamDry tells the peer there is no more data on streamID for now
+// (User Control event 2).
+func (c *Connection) SendStreamDry(streamID uint32) error {
+	return c.SendMessage(control.EncodeUserControlStreamDry(streamID))
+}
+
+// SendSetBufferLength tells the peer how many milliseconds of streamID it
+// should buffer (User Control event 3). Clients send it before playing.
+func (c *Connection) SendSetBufferLength(streamID, bufferMs uint32) error {
+	return c.SendMessage(control.EncodeUserControlSetBufferLength(streamID, bufferMs))
+}
+
+// SendStreamIsRecorded tells the peer that streamID is a recorded stream
+// (User Control event 4).
+func (c *Connection) SendStreamIsRecorded(streamID uint32) error {
+	return c.SendMessage(control.EncodeUserControlStreamIsRecorded(streamID))
+}
+
+// SendPingRequest asks the peer to echo a timestamp (User Control event 6).
+// The timestamp is the milliseconds since the connection was accepted.
+func (c *Connection) SendPingRequest() error {
+	ts := uint32(time.Since(c.acceptedAt).Milliseconds())
+	return c.SendMessage(control.EncodeUserControlPingRequest(ts))
+}
+
+// Ping sends a Ping Request as a heartbeat and counts it as unanswered
+// until the peer's Ping Response arrives. It keeps NATs and firewalls from
+// timing out a player that receives nothing while its publisher is paused,
+// and PingsUnanswered tells when the peer has stopped responding.
+func (c *Connection) Ping() error {
+	if err := c.SendPingRequest(); err != nil {
+		return err
+	}
+	c.pingsUnanswered.Add(1)
+	return nil
+}
+
+// PingsUnanswered returns how many Pings were sent since the peer last
+// answered one.
+func (c *Connection) PingsUnanswered() int { return int(c.pingsUnanswered.Load()) }
+
+// PingRTT returns the round trip of the last Ping answered (0 before the
+// first answer).
+func (c *Connection) PingRTT() time.Duration { return time.Duration(c.pingRTT.Load()) }
+
+// pingAnswered records a Ping Response echoing ts, the milliseconds since
+// accept sent by SendPingRequest.
+func (c *Connection) pingAnswered(ts uint32) {
+	c.pingsUnanswered.Store(0)
+	if rtt := time.Since(c.acceptedAt) - time.Duration(ts)*time.Millisecond; rtt >= 0 {
+		c.pingRTT.Store(int64(rtt))
+	}
+}
+
+// SendPingResponse answers a ping request with its timestamp (User Control
+// event 7).
+func (c *Connection) SendPingResponse(ts uint32) error {
+	return c.SendMessage(control.EncodeUserControlPingResponse(ts))
+}
+
+// SendSetChunkSize changes the outbound chunk size; it is SetWriteChunkSize
+// under the name the other Send helpers use.
+func (c *Connection) SendSetChunkSize(size uint32) error {
+	return c.SetWriteChunkSize(size)
+}
+
+// SendWindowAckSize sets how many bytes the peer may receive before it
+// must send an Acknowledgement (Type 5).
+func (c *Connection) SendWindowAckSize(size uint32) error {
+	if err := c.SendMessage(control.EncodeWindowAcknowledgementSize(size)); err != nil {
+		return err
+	}
+	c.setAdvertised(size, 0, 0)
+	return nil
+}
+
+// SendSetPeerBandwidth limits the peer's output bandwidth (Type 6).
+// limitType is 0 (hard), 1 (soft) or 2 (dynamic).
+func (c *Connection) SendSetPeerBandwidth(bandwidth uint32, limitType uint8) error {
+	if err := c.SendMessage(control.EncodeSetPeerBandwidth(bandwidth, limitType)); err != nil {
+		return err
+	}
+	c.setAdvertised(0, bandwidth, limitType)
+	return nil
+}
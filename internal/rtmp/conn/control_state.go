@@ -0,0 +1,100 @@
+package conn
+
+// Control State
+// =============
+// Each connection tracks the protocol control values in both directions:
+//
+//   - what we advertised: the Window Acknowledgement Size, Set Peer
+//     Bandwidth and Set Chunk Size sent in the control burst or later with
+//     the Send helpers;
+//   - what the peer advertised: its Set Chunk Size, Window Acknowledgement
+//     Size, Set Peer Bandwidth and last Acknowledgement, applied by
+//     control.Handle from the read loop.
+//
+// control.Handle writes through the pointers in Connection.ctrl, so the
+// read loop calls it under ctrlMu and ControlState reads under the same lock.
+
+import (
+	"sync/atomic"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/control"
+)
+
+// ControlState is a snapshot of a connection's protocol control values.
+type ControlState struct {
+	// Sent to the peer.
+	WriteChunkSize uint32 // outbound chunk size in effect
+	WindowAckSize  uint32 // the peer acknowledges every WindowAckSize bytes it receives
+	PeerBandwidth  uint32 // output limit suggested to the peer with Set Peer Bandwidth
+	LimitType      uint8  // limit type sent with PeerBandwidth (control.LimitHard, ...)
+
+	// Received from the peer.
+	ReadChunkSize       uint32 // inbound chunk size
+	RemoteWindowAckSize uint32 // we acknowledge every RemoteWindowAckSize bytes received (0 = never)
+	RemoteBandwidth     uint32 // output limit the peer suggested to us (0 = none)
+	RemoteLimitType     uint8  // limit type sent with RemoteBandwidth
+	LastAck             uint32 // sequence number of the peer's last Acknowledgement
+}
+
+// ControlState returns the control values currently in effect on c.
+func (c *Connection) ControlState() ControlState {
+	c.ctrlMu.Lock()
+	defer c.ctrlMu.Unlock()
+	return ControlState{
+		WriteChunkSize:      atomic.LoadUint32(&c.writeChunkSize),
+		WindowAckSize:       c.windowAckSize,
+		PeerBandwidth:       c.peerBandwidth,
+		LimitType:           c.limitType,
+		ReadChunkSize:       c.readChunkSize,
+		RemoteWindowAckSize: c.peerWindowAck,
+		RemoteBandwidth:     c.remoteBandwidth,
+		RemoteLimitType:     c.remoteLimitType,
+		LastAck:             c.lastPeerAck,
+	}
+}
+
+// initControl points the control.Handle context at c's state.
+func (c *Connection) initControl() {
+	c.ctrl = control.Context{
+		ReadChunkSize: &c.readChunkSize,
+		WindowAckSize: &c.peerWindowAck,
+		PeerBandwidth: &c.remoteBandwidth,
+		LimitType:     &c.remoteLimitType,
+		LastPeerAck:   &c.lastPeerAck,
+		Log:           c.log,
+		Send:          c.SendMessage,
+	}
+}
+
+// handleControl applies a protocol control message (types 1-6) from the
+// peer. Ping requests are answered here. The message is still passed on to
+// the message handler afterwards.
+func (c *Connection) handleControl(msg *chunk.Message) {
+	if msg.TypeID < control.TypeSetChunkSize || msg.TypeID > control.TypeSetPeerBandwidth || msg.MessageStreamID != 0 {
+		return
+	}
+	if c.ctrl.Send == nil {
+		return // not set up by Accept (tests)
+	}
+	c.ctrlMu.Lock()
+	err := control.Handle(&c.ctrl, msg)
+	c.ctrlMu.Unlock()
+	if err != nil {
+		c.log.Debug("control message ignored", "type_id", msg.TypeID, "error", err)
+	}
+}
+
+// setAdvertised records the Window Acknowledgement Size or Set Peer
+// Bandwidth values sent to the peer; zero values are left unchanged.
+func (c *Connection) setAdvertised(windowAck, bandwidth uint32, limitType uint8) {
+	c.ctrlMu.Lock()
+	defer c.ctrlMu.Unlock()
+	if windowAck != 0 {
+		c.windowAckSize = windowAck
+	}
+	if bandwidth != 0 {
+		c.peerBandwidth = bandwidth
+		c.limitType = limitType
+	}
+}
@@ -0,0 +1,64 @@
+package conn
+
+// Outbound Chunk Stream IDs
+// =========================
+// Callers build messages with whatever CSID they picked (the publisher's own
+// chunk streams for relayed media, 4/6 for cached sequence headers, 3 or 5
+// for commands), so one subscriber connection could see audio and video on
+// the same chunk stream, or media on a command chunk stream. Some strict
+// clients reject that. The write loop therefore assigns every outbound
+// message a CSID by type, following the conventions of FMS and ffmpeg.
+
+import (
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/control"
+)
+
+// Chunk stream IDs used for outbound messages.
+const (
+	CSIDProtocolControl = 2 // protocol control and user control messages
+	CSIDCommand         = 3 // connection-level commands (message stream 0)
+	CSIDAudio           = 4
+	CSIDStreamCommand   = 5 // commands on a message stream, e.g. onStatus
+	CSIDVideo           = 6 // video and aggregate messages
+	CSIDData            = 8 // data messages such as onMetaData
+)
+
+// outboundCSID returns the chunk stream msg is sent on.
+func outboundCSID(msg *chunk.Message) uint32 {
+	switch {
+	case msg.TypeID >= control.TypeSetChunkSize && msg.TypeID <= control.TypeSetPeerBandwidth:
+		return CSIDProtocolControl
+	case msg.TypeID == 8:
+		return CSIDAudio
+	case msg.TypeID == 9, msg.TypeID == 22: // video, aggregate
+		return CSIDVideo
+	case msg.TypeID == 18, msg.TypeID == 15: // AMF0 / AMF3 data
+		return CSIDData
+	case msg.MessageStreamID == 0:
+		return CSIDCommand
+	default:
+		return CSIDStreamCommand
+	}
+}
+
+// withOutboundCSID returns msg on its outbound chunk stream. Messages are
+// often shared between subscribers, so a message on the wrong chunk stream
+// is copied rather than modified.
+func withOutboundCSID(msg *chunk.Message) *chunk.Message {
+	csid := outboundCSID(msg)
+	if msg.CSID == csid {
+		return msg
+	}
+	m := *msg
+	m.CSID = csid
+	return &m
+}
+
+// Prechunk lays out msg's payload for a connection writing chunks of
+// chunkSize, on the chunk stream the write loop will move it to, so every
+// connection with that chunk size can share the framing (see
+// chunk.Message.Prechunk). Call it before handing msg on.
+func Prechunk(msg *chunk.Message, chunkSize uint32) {
+	msg.Prechunk(outboundCSID(msg), chunkSize)
+}
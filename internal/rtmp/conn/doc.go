@@ -18,7 +18,22 @@
 //     calls the installed message handler callback.
 //   - writeLoop: drains the outbound message queue and writes chunks.
 //
-// The outbound queue is bounded (see [outboundQueueSize]) to provide
-// backpressure. [SendMessage] blocks briefly (see [sendTimeout]) and returns
-// an error if the queue is full.
+// The outbound queue is split into three priority lanes: control and
+// command messages, audio, and video/data. Each lane is bounded (see
+// [outboundQueueSize] and [controlQueueSize]) to provide backpressure. A
+// player's SetBufferLength request raises the media lane depth to roughly
+// the buffer it asked for (see [Connection.MediaQueueLimit]).
+// [SendMessage] blocks briefly (see [sendTimeout]) and returns an error if
+// the message's lane is full, so a video backlog never drops a ping
+// response or onStatus reply. The write loop sends each message on the
+// chunk stream for its type (see [CSIDAudio] and related constants),
+// whatever CSID the caller set.
+//
+// # Session
+//
+// Every connection owns a [Session] (see [Connection.Session]) recording the
+// connect parameters (app, tcUrl, objectEncoding) and each message stream
+// created with createStream, with its role and stream key. It enforces the
+// command order new → connected → stream created → publishing/playing →
+// closed, per message stream, so one connection can carry several streams.
 package conn
@@ -0,0 +1,292 @@
+package conn
+
+// Session
+// -------
+// A Session holds what the peer negotiated on this connection once the
+// handshake is done: the connect command's app, tcUrl, flashVer and
+// objectEncoding, the encoder a publisher names in its onMetaData, and
+// every message stream created with createStream together with what it is
+// used for (publishing or playing a stream key).
+//
+// It is also the connection's state machine:
+//
+//	new → connected → stream created → publishing / playing → closed
+//
+// Transitions that skip a step (publish before createStream, a second
+// connect, anything after close) are rejected with ErrSessionState, so
+// command handlers validate the sequence in one place. Each message stream
+// is tracked separately, which allows one connection to publish or play
+// several streams.
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// SessionState is the connection-level protocol state.
+type SessionState int
+
+const (
+	SessionNew           SessionState = iota // handshake done, waiting for connect
+	SessionConnected                         // connect accepted
+	SessionStreamCreated                     // at least one message stream, none active
+	SessionPublishing                        // at least one stream is publishing
+	SessionPlaying                           // at least one stream is playing (none publishing)
+	SessionClosed                            // connection closed
+)
+
+// String returns the state name used in logs and errors.
+func (s SessionState) String() string {
+	switch s {
+	case SessionNew:
+		return "new"
+	case SessionConnected:
+		return "connected"
+	case SessionStreamCreated:
+		return "stream_created"
+	case SessionPublishing:
+		return "publishing"
+	case SessionPlaying:
+		return "playing"
+	case SessionClosed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
+
+// Stream roles.
+const (
+	RolePublisher  = "publisher"
+	RoleSubscriber = "subscriber"
+)
+
+// ErrSessionState is returned for a command not allowed in the session's
+// current state.
+var ErrSessionState = errors.New("command not allowed in session state")
+
+// ConnectInfo is what the peer negotiated with the connect command.
+type ConnectInfo struct {
+	App            string                 // application name (e.g. "live")
+	TcURL          string                 // target URL as sent by the client
+	FlashVer       string                 // client version, e.g. "FMLE/3.0 (compatible; FMSc/1.0)"
+	ObjectEncoding float64                // requested: 0 = AMF0, 3 = AMF3 (the server answers 0)
+	FourCcList     []string               // Enhanced RTMP codecs the client supports
+	Params         map[string]interface{} // remaining connect object fields
+
+	// AppConfig is the server's configuration for App, attached by the
+	// connect handler for later handlers to consult (nil when none).
+	AppConfig interface{}
+}
+
+// SessionStream is one message stream created on the connection.
+type SessionStream struct {
+	ID   uint32 // message stream ID returned by createStream
+	Key  string // stream key being published or played ("" when idle)
+	Role string // RolePublisher, RoleSubscriber or "" when idle
+}
+
+// Session tracks negotiated parameters and per-stream state for one
+// connection. It is safe for concurrent use.
+type Session struct {
+	mu      sync.RWMutex
+	closed  bool
+	info    *ConnectInfo // nil until connect
+	encoder string       // onMetaData "encoder" of a publisher
+	streams map[uint32]*SessionStream
+}
+
+// NewSession returns a session in state SessionNew.
+func NewSession() *Session {
+	return &Session{streams: make(map[uint32]*SessionStream)}
+}
+
+// Connect records the connect command. It is allowed once.
+func (s *Session) Connect(info ConnectInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkLocked("connect", SessionNew); err != nil {
+		return err
+	}
+	s.info = &info
+	return nil
+}
+
+// CreateStream records a message stream allocated by createStream.
+func (s *Session) CreateStream(id uint32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.info == nil || s.closed {
+		return s.stateErrLocked("createStream")
+	}
+	if _, exists := s.streams[id]; exists {
+		return fmt.Errorf("createStream: stream %d already exists", id)
+	}
+	s.streams[id] = &SessionStream{ID: id}
+	return nil
+}
+
+// Publish marks stream id as publishing key. The stream must have been
+// created and not be active.
+func (s *Session) Publish(id uint32, key string) error {
+	return s.activate("publish", id, key, RolePublisher)
+}
+
+// Play marks stream id as playing key. A stream that is already playing
+// may switch to another key (playlist style); a publishing one may not.
+func (s *Session) Play(id uint32, key string) error {
+	return s.activate("play", id, key, RoleSubscriber)
+}
+
+// CheckStream reports whether stream id may start in role (RolePublisher
+// or RoleSubscriber) without changing anything, so handlers can reject a
+// command before doing any work.
+func (s *Session) CheckStream(id uint32, role string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, err := s.checkStreamLocked(id, role)
+	return err
+}
+
+func (s *Session) activate(cmd string, id uint32, key, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, err := s.checkStreamLocked(id, role)
+	if err != nil {
+		return fmt.Errorf("%s: %w", cmd, err)
+	}
+	st.Key, st.Role = key, role
+	return nil
+}
+
+func (s *Session) checkStreamLocked(id uint32, role string) (*SessionStream, error) {
+	if s.closed {
+		return nil, fmt.Errorf("%w %s", ErrSessionState, SessionClosed)
+	}
+	st, ok := s.streams[id]
+	if !ok {
+		return nil, fmt.Errorf("%w (stream %d was not created)", ErrSessionState, id)
+	}
+	if st.Role != "" && !(st.Role == RoleSubscriber && role == RoleSubscriber) {
+		return nil, fmt.Errorf("%w (stream %d is already %s %s)", ErrSessionState, id, st.Role, st.Key)
+	}
+	return st, nil
+}
+
+// EndStream returns stream id to idle (closeStream); the ID stays valid.
+func (s *Session) EndStream(id uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if st, ok := s.streams[id]; ok {
+		st.Key, st.Role = "", ""
+	}
+}
+
+// DeleteStream forgets stream id (deleteStream).
+func (s *Session) DeleteStream(id uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.streams, id)
+}
+
+// Close moves the session to SessionClosed. Streams remain readable so
+// disconnect cleanup can see what was active.
+func (s *Session) Close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+}
+
+// State returns the current state.
+func (s *Session) State() SessionState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.stateLocked()
+}
+
+// Info returns the negotiated connect parameters (zero value before connect).
+func (s *Session) Info() ConnectInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.info == nil {
+		return ConnectInfo{}
+	}
+	return *s.info
+}
+
+// App returns the connect command's app ("" before connect).
+func (s *Session) App() string { return s.Info().App }
+
+// SetEncoder records the encoder a publisher names in its onMetaData,
+// e.g. "obs-output module (libobs version 30.0.2)".
+func (s *Session) SetEncoder(name string) {
+	s.mu.Lock()
+	s.encoder = name
+	s.mu.Unlock()
+}
+
+// Encoder returns the name set by SetEncoder ("" when none was sent).
+func (s *Session) Encoder() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.encoder
+}
+
+// Stream returns a copy of stream id.
+func (s *Session) Stream(id uint32) (SessionStream, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	st, ok := s.streams[id]
+	if !ok {
+		return SessionStream{}, false
+	}
+	return *st, true
+}
+
+// Streams returns copies of all streams ordered by ID.
+func (s *Session) Streams() []SessionStream {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]SessionStream, 0, len(s.streams))
+	for _, st := range s.streams {
+		out = append(out, *st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+func (s *Session) stateLocked() SessionState {
+	switch {
+	case s.closed:
+		return SessionClosed
+	case s.info == nil:
+		return SessionNew
+	}
+	state := SessionConnected
+	for _, st := range s.streams {
+		switch st.Role {
+		case RolePublisher:
+			return SessionPublishing
+		case RoleSubscriber:
+			state = SessionPlaying
+		default:
+			if state == SessionConnected {
+				state = SessionStreamCreated
+			}
+		}
+	}
+	return state
+}
+
+func (s *Session) checkLocked(cmd string, want SessionState) error {
+	if s.stateLocked() != want {
+		return s.stateErrLocked(cmd)
+	}
+	return nil
+}
+
+func (s *Session) stateErrLocked(cmd string) error {
+	return fmt.Errorf("%s: %w %s", cmd, ErrSessionState, s.stateLocked())
+}
@@ -0,0 +1,101 @@
+// session_test.go – tests for the Session state machine.
+//
+// A Session moves new → connected → stream created → publishing/playing →
+// closed. Each test drives it through a command sequence and checks that
+// out-of-order commands fail with ErrSessionState.
+package conn
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSession_Lifecycle(t *testing.T) {
+	s := NewSession()
+	if s.State() != SessionNew {
+		t.Fatalf("initial state = %v", s.State())
+	}
+	if err := s.CreateStream(1); !errors.Is(err, ErrSessionState) {
+		t.Fatalf("createStream before connect: %v", err)
+	}
+	if err := s.Connect(ConnectInfo{App: "live", TcURL: "rtmp://host/live", ObjectEncoding: 0}); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if err := s.Connect(ConnectInfo{App: "other"}); !errors.Is(err, ErrSessionState) {
+		t.Fatalf("second connect: %v", err)
+	}
+	if s.App() != "live" || s.Info().TcURL != "rtmp://host/live" || s.State() != SessionConnected {
+		t.Fatalf("after connect: app=%q info=%+v state=%v", s.App(), s.Info(), s.State())
+	}
+
+	if err := s.Publish(1, "live/a"); !errors.Is(err, ErrSessionState) {
+		t.Fatalf("publish before createStream: %v", err)
+	}
+	if err := s.CreateStream(1); err != nil {
+		t.Fatalf("createStream: %v", err)
+	}
+	if err := s.CreateStream(1); err == nil {
+		t.Fatalf("expected duplicate stream ID to fail")
+	}
+	if s.State() != SessionStreamCreated {
+		t.Fatalf("state = %v, want stream_created", s.State())
+	}
+	if err := s.Publish(1, "live/a"); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if err := s.Play(1, "live/b"); !errors.Is(err, ErrSessionState) {
+		t.Fatalf("play on publishing stream: %v", err)
+	}
+	if s.State() != SessionPublishing {
+		t.Fatalf("state = %v, want publishing", s.State())
+	}
+
+	s.EndStream(1)
+	if st, ok := s.Stream(1); !ok || st.Role != "" || s.State() != SessionStreamCreated {
+		t.Fatalf("after closeStream: %+v %v state=%v", st, ok, s.State())
+	}
+	s.DeleteStream(1)
+	if _, ok := s.Stream(1); ok || s.State() != SessionConnected {
+		t.Fatalf("after deleteStream: state=%v", s.State())
+	}
+
+	s.Close()
+	if s.State() != SessionClosed {
+		t.Fatalf("state = %v, want closed", s.State())
+	}
+	if err := s.CreateStream(2); !errors.Is(err, ErrSessionState) {
+		t.Fatalf("createStream after close: %v", err)
+	}
+}
+
+func TestSession_MultipleStreams(t *testing.T) {
+	s := NewSession()
+	_ = s.Connect(ConnectInfo{App: "live"})
+	_ = s.CreateStream(1)
+	_ = s.CreateStream(2)
+	if err := s.Publish(1, "live/cam1"); err != nil {
+		t.Fatalf("publish 1: %v", err)
+	}
+	if err := s.Play(2, "live/cam2"); err != nil {
+		t.Fatalf("play 2: %v", err)
+	}
+	// A playing stream may switch keys.
+	if err := s.Play(2, "live/cam3"); err != nil {
+		t.Fatalf("play switch: %v", err)
+	}
+	if err := s.CheckStream(1, RolePublisher); !errors.Is(err, ErrSessionState) {
+		t.Fatalf("CheckStream on publishing stream: %v", err)
+	}
+
+	streams := s.Streams()
+	if len(streams) != 2 || streams[0].Key != "live/cam1" || streams[1].Key != "live/cam3" {
+		t.Fatalf("streams = %+v", streams)
+	}
+	if s.State() != SessionPublishing {
+		t.Fatalf("state = %v, want publishing", s.State())
+	}
+	s.EndStream(1)
+	if s.State() != SessionPlaying {
+		t.Fatalf("state = %v, want playing", s.State())
+	}
+}
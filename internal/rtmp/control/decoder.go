@@ -34,14 +34,18 @@ type Acknowledgement struct {
 // signal stream lifecycle events. The EventType field determines which
 // optional field is populated:
 //   - EventType 0 (Stream Begin): StreamID is set to the new stream's ID
+//   - EventType 1 (Stream EOF): StreamID is set to the stream that ended
+//   - EventType 2 (Stream Dry) / 4 (Stream Is Recorded): StreamID is set
+//   - EventType 3 (Set Buffer Length): StreamID and BufferLength are set
 //   - EventType 6 (Ping Request): Timestamp is set; client must reply with Ping Response
 //   - EventType 7 (Ping Response): Timestamp echoes the request's timestamp
 //   - Other events: RawData contains the unparsed payload bytes
 type UserControl struct {
-	EventType uint16
-	StreamID  uint32 // Event 0: the stream ID that is now active
-	Timestamp uint32 // Event 6/7: ping timestamp for latency measurement
-	RawData   []byte // Unparsed payload for unrecognized event types
+	EventType    uint16
+	StreamID     uint32 // Events 0-4: the stream the event applies to
+	BufferLength uint32 // Event 3: client buffer length in milliseconds
+	Timestamp    uint32 // Event 6/7: ping timestamp for latency measurement
+	RawData      []byte // Unparsed payload for unrecognized event types
 }
 
 // WindowAcknowledgementSize represents a Type 5 Window Ack Size message.
@@ -89,11 +93,17 @@ func Decode(typeID uint8, payload []byte) (any, error) { // any == interface{}
 		ev := binary.BigEndian.Uint16(payload[0:2])
 		uc := &UserControl{EventType: ev}
 		switch ev {
-		case UCStreamBegin: // requires 4 more bytes (stream ID)
+		case UCStreamBegin, UCStreamEOF, UCStreamDry, UCStreamIsRecorded: // requires 4 more bytes (stream ID)
 			if len(payload) != 6 { // exact length for this event per encoder
-				return nil, fmt.Errorf("user control stream begin: expected 6 bytes got=%d", len(payload))
+				return nil, fmt.Errorf("user control stream event %d: expected 6 bytes got=%d", ev, len(payload))
 			}
 			uc.StreamID = binary.BigEndian.Uint32(payload[2:6])
+		case UCSetBufferLength: // stream ID + buffer length
+			if len(payload) != 10 {
+				return nil, fmt.Errorf("user control set buffer length: expected 10 bytes got=%d", len(payload))
+			}
+			uc.StreamID = binary.BigEndian.Uint32(payload[2:6])
+			uc.BufferLength = binary.BigEndian.Uint32(payload[6:10])
 		case UCPingRequest, UCPingResponse: // timestamp 4 bytes
 			if len(payload) != 6 {
 				return nil, fmt.Errorf("user control ping: expected 6 bytes got=%d", len(payload))
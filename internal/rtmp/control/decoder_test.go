@@ -174,6 +174,7 @@ func TestDecodeControlMessages_Errors(t *testing.T) {
 		{"peer_bw_limit_type", TypeSetPeerBandwidth, []byte{0x00, 0x00, 0x00, 0x01, 0x03}},  // invalid limit type
 		{"unsupported_type", 99, []byte{0x00}},                                              // unsupported
 		{"user_control_ping_short", TypeUserControl, []byte{0x00, 0x06, 0x01}},              // ping incomplete
+		{"user_control_buffer_len_short", TypeUserControl, []byte{0x00, 0x03, 0, 0, 0, 1}},  // missing buffer length
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
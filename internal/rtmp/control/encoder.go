@@ -8,6 +8,7 @@ package control
 
 import (
 	"encoding/binary"
+	"fmt"
 
 	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
 )
@@ -24,11 +25,36 @@ const (
 
 // User Control (Type 4) event type IDs.
 const (
-	UCStreamBegin  uint16 = 0 // Server tells client a stream is ready
-	UCPingRequest  uint16 = 6 // Server checks if client is alive
-	UCPingResponse uint16 = 7 // Client responds to a ping
+	UCStreamBegin      uint16 = 0 // Server tells client a stream is ready
+	UCStreamEOF        uint16 = 1 // Server tells client playback of a stream ended
+	UCStreamDry        uint16 = 2 // Server tells client there is no more data on a stream for now
+	UCSetBufferLength  uint16 = 3 // Client tells server its buffer size (ms) for a stream
+	UCStreamIsRecorded uint16 = 4 // Server tells client a stream is a recording
+	UCPingRequest      uint16 = 6 // Server checks if client is alive
+	UCPingResponse     uint16 = 7 // Client responds to a ping
 )
 
+// Set Peer Bandwidth (Type 6) limit types.
+const (
+	LimitHard    uint8 = 0 // peer should limit its output to the given bandwidth
+	LimitSoft    uint8 = 1 // peer should limit to the given or its current limit, whichever is smaller
+	LimitDynamic uint8 = 2 // hard if the previous limit was hard, otherwise ignored
+)
+
+// ParseLimitType maps "hard", "soft" or "dynamic" to a Set Peer Bandwidth
+// limit type. An empty name is dynamic.
+func ParseLimitType(name string) (uint8, error) {
+	switch name {
+	case "hard":
+		return LimitHard, nil
+	case "soft":
+		return LimitSoft, nil
+	case "dynamic", "":
+		return LimitDynamic, nil
+	}
+	return 0, fmt.Errorf("invalid peer bandwidth limit type %q (expected hard, soft or dynamic)", name)
+}
+
 // newControlMessage builds a chunk.Message with the standard control channel
 // fields (CSID=2, MSID=0, Timestamp=0) that all control messages use.
 func newControlMessage(typeID uint8, payload []byte) *chunk.Message {
@@ -82,6 +108,33 @@ func EncodeUserControlStreamBegin(streamID uint32) *chunk.Message {
 	return encodeUserControl(UCStreamBegin, streamID, true)
 }
 
+// EncodeUserControlStreamEOF creates a User Control Stream EOF (event 1) message.
+func EncodeUserControlStreamEOF(streamID uint32) *chunk.Message {
+	return encodeUserControl(UCStreamEOF, streamID, true)
+}
+
+// EncodeUserControlStreamDry creates a User Control Stream Dry (event 2) message.
+func EncodeUserControlStreamDry(streamID uint32) *chunk.Message {
+	return encodeUserControl(UCStreamDry, streamID, true)
+}
+
+// EncodeUserControlSetBufferLength creates a User Control Set Buffer Length
+// (event 3) message: the stream ID followed by the buffer length in
+// milliseconds.
+func EncodeUserControlSetBufferLength(streamID, bufferMs uint32) *chunk.Message {
+	var payload [10]byte
+	binary.BigEndian.PutUint16(payload[0:2], UCSetBufferLength)
+	binary.BigEndian.PutUint32(payload[2:6], streamID)
+	binary.BigEndian.PutUint32(payload[6:10], bufferMs)
+	return newControlMessage(TypeUserControl, payload[:])
+}
+
+// EncodeUserControlStreamIsRecorded creates a User Control Stream Is
+// Recorded (event 4) message.
+func EncodeUserControlStreamIsRecorded(streamID uint32) *chunk.Message {
+	return encodeUserControl(UCStreamIsRecorded, streamID, true)
+}
+
 // EncodeUserControlPingRequest creates a Ping Request (event 6) user control message.
 func EncodeUserControlPingRequest(ts uint32) *chunk.Message {
 	return encodeUserControl(UCPingRequest, ts, true)
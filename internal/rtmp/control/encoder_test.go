@@ -126,3 +126,67 @@ func TestAdditionalCoverage(t *testing.T) {
 		t.Fatalf("peer bandwidth limit type mismatch got=%d", spb.Payload[4])
 	}
 }
+
+// TestEncodeUserControlStreamEOF checks event 0x0001 and round-trips the
+// stream ID through the decoder.
+func TestEncodeUserControlStreamEOF(t *testing.T) {
+	m := EncodeUserControlStreamEOF(3)
+	if m.TypeID != TypeUserControl || len(m.Payload) != 6 {
+		t.Fatalf("unexpected stream EOF encoding: type=%d len=%d", m.TypeID, len(m.Payload))
+	}
+	if m.Payload[0] != 0x00 || m.Payload[1] != 0x01 {
+		t.Fatalf("stream EOF event mismatch: % X", m.Payload[:2])
+	}
+	v, err := Decode(m.TypeID, m.Payload)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if uc := v.(*UserControl); uc.EventType != UCStreamEOF || uc.StreamID != 3 {
+		t.Fatalf("unexpected decoded stream EOF: %+v", uc)
+	}
+}
+
+// TestEncodeUserControlStreamEvents round-trips Stream Dry (event 2),
+// Set Buffer Length (event 3) and Stream Is Recorded (event 4) through
+// the decoder.
+func TestEncodeUserControlStreamEvents(t *testing.T) {
+	tests := []struct {
+		name   string
+		msg    *chunk.Message
+		event  uint16
+		size   int
+		buffer uint32
+	}{
+		{"stream_dry", EncodeUserControlStreamDry(5), UCStreamDry, 6, 0},
+		{"set_buffer_length", EncodeUserControlSetBufferLength(5, 3000), UCSetBufferLength, 10, 3000},
+		{"stream_is_recorded", EncodeUserControlStreamIsRecorded(5), UCStreamIsRecorded, 6, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.msg.TypeID != TypeUserControl || len(tt.msg.Payload) != tt.size {
+				t.Fatalf("unexpected encoding: type=%d len=%d", tt.msg.TypeID, len(tt.msg.Payload))
+			}
+			v, err := Decode(tt.msg.TypeID, tt.msg.Payload)
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			uc := v.(*UserControl)
+			if uc.EventType != tt.event || uc.StreamID != 5 || uc.BufferLength != tt.buffer {
+				t.Fatalf("unexpected decoded event: %+v", uc)
+			}
+		})
+	}
+}
+
+// TestParseLimitType maps the limit type names used in configuration.
+func TestParseLimitType(t *testing.T) {
+	for name, want := range map[string]uint8{"hard": LimitHard, "soft": LimitSoft, "dynamic": LimitDynamic, "": LimitDynamic} {
+		got, err := ParseLimitType(name)
+		if err != nil || got != want {
+			t.Fatalf("ParseLimitType(%q) = %d, %v; want %d", name, got, err, want)
+		}
+	}
+	if _, err := ParseLimitType("strict"); err == nil {
+		t.Fatal("expected error for unknown limit type")
+	}
+}
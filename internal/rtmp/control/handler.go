@@ -105,9 +105,9 @@ func Handle(ctx *Context, msg *chunk.Message) error {
 			ctx.Log.Debug("Set Peer Bandwidth received", "old_bw", oldBW, "new_bw", v.Bandwidth, "old_lt", oldLT, "new_lt", v.LimitType)
 		}
 	case *AbortMessage:
-		// Currently we don't buffer partial messages (chunk layer handles abort semantics).
+		// The chunk reader has already discarded the partial message on v.CSID.
 		if ctx.Log != nil {
-			ctx.Log.Debug("Abort Message received (ignored in this phase)", "csid", v.CSID)
+			ctx.Log.Debug("Abort Message received", "csid", v.CSID)
 		}
 	default:
 		return fmt.Errorf("control handler: unexpected decoded type %T", v)
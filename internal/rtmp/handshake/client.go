@@ -79,7 +79,21 @@ func ClientHandshake(conn net.Conn) error {
 	var s2buf [PacketSize]byte
 	// Tiny deadline to avoid blocking if S2 not yet sent by a non-compliant server.
 	_ = conn.SetReadDeadline(time.Now().Add(1 * time.Millisecond))
-	if _, err := io.ReadFull(conn, s2buf[:]); err == nil {
+	n, err := io.ReadFull(conn, s2buf[:])
+	if err != nil && n > 0 {
+		// S2 is arriving on a slow link; the bytes read so far are
+		// consumed, so the rest must be read here too.
+		if err = setReadDeadline(conn, clientReadTimeout); err != nil {
+			return err
+		}
+		if _, err = io.ReadFull(conn, s2buf[n:]); err != nil {
+			if isTimeoutErr(err) {
+				return rerrors.NewTimeoutError("read S2", clientReadTimeout, err)
+			}
+			return rerrors.NewHandshakeError("read S2", err)
+		}
+	}
+	if err == nil {
 		haveS2 = true
 		// Validate S2 echoes our original C1; warn if mismatch but continue.
 		if !bytes.Equal(s2buf[:], c1[:]) {
@@ -11,6 +11,7 @@
 //   - Write failure: failingWriteConn returns io.ErrClosedPipe.
 //   - Nil conn: should return error, not panic.
 //   - Mismatched S2: fake server sends wrong S2 – client still succeeds.
+//   - Slow S2: S2 arrives in two parts – the stream stays in step.
 //
 // Key Go pattern: each test runs client + server in separate goroutines
 // connected via net.Pipe(), with error channels for synchronization.
@@ -163,3 +164,46 @@ func TestClientHandshake_MismatchedS2(t *testing.T) {
 		t.Fatalf("client handshake failed: %v", err)
 	}
 }
+
+// TestClientHandshake_SlowS2 runs a fake server whose S2 arrives in two
+// parts, as on a slow link. The part read during the opportunistic S2 read
+// must not be lost: the byte the server sends after the handshake has to
+// be the next one the client reads.
+func TestClientHandshake_SlowS2(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	go func() {
+		c0c1 := make([]byte, 1+PacketSize)
+		if _, err := io.ReadFull(serverConn, c0c1); err != nil {
+			return
+		}
+		s0s1 := make([]byte, 1+PacketSize)
+		s0s1[0] = Version
+		if _, err := serverConn.Write(s0s1); err != nil {
+			return
+		}
+		s2 := c0c1[1:]
+		if _, err := serverConn.Write(s2[:100]); err != nil {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+		if _, err := serverConn.Write(s2[100:]); err != nil {
+			return
+		}
+		if _, err := io.ReadFull(serverConn, make([]byte, PacketSize)); err != nil {
+			return
+		}
+		_, _ = serverConn.Write([]byte{0xAB})
+	}()
+
+	if err := ClientHandshake(clientConn); err != nil {
+		t.Fatalf("client handshake failed: %v", err)
+	}
+	_ = clientConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	next := make([]byte, 1)
+	if _, err := io.ReadFull(clientConn, next); err != nil || next[0] != 0xAB {
+		t.Fatalf("byte after handshake = %x (%v), want ab", next, err)
+	}
+}
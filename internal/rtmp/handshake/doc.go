@@ -20,6 +20,13 @@
 //	       ◄──────────  S0+S1+S2
 //	C2     ──────────►
 //
+// # Other Schemes
+//
+// A client whose C0 asks for RTMPE (0x06, 0x08, 0x09), RTMPT (an HTTP
+// request) or TLS is rejected with an [UnsupportedSchemeError] naming the
+// scheme. [ServerHandshakeWithOptions] can answer it first (S0 = 0x03 or
+// HTTP 501) so the client reports "unsupported" rather than a reset.
+//
 // # Timeouts
 //
 // Each read/write phase uses a 5-second timeout to prevent hung connections.
@@ -0,0 +1,77 @@
+package handshake
+
+// Unsupported Handshake Schemes
+// -----------------------------
+// Only plain RTMP (C0 = 0x03) is implemented. Encoders configured for one of
+// the other schemes in the RTMP family still connect to the RTMP port, and
+// the first byte they send says which scheme they expect:
+//
+//   - 0x06, 0x08, 0x09: RTMPE, the Adobe "encrypted" handshake
+//   - 0x16: a TLS ClientHello, i.e. RTMPS sent to the plain port
+//   - an ASCII letter: an HTTP request, i.e. RTMPT (RTMP tunnelled in HTTP)
+//
+// ServerHandshake recognises these and fails with an *UnsupportedSchemeError
+// that names the scheme, so the log says why the encoder failed instead of
+// reporting a bare version mismatch.
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Scheme names reported in UnsupportedSchemeError.
+const (
+	SchemeRTMPE   = "rtmpe"
+	SchemeRTMPT   = "rtmpt"
+	SchemeRTMPS   = "rtmps"
+	SchemeUnknown = "unknown"
+)
+
+// httpUnsupported is the reply to an RTMPT request when
+// ServerOptions.ReplyUnsupported is set.
+const httpUnsupported = "HTTP/1.1 501 Not Implemented\r\nContent-Length: 0\r\nConnection: close\r\n\r\n"
+
+// UnsupportedSchemeError reports a client that opened with a handshake
+// scheme other than plain RTMP. ServerHandshake returns it wrapped in a
+// *errors.HandshakeError; use errors.As to get at it.
+type UnsupportedSchemeError struct {
+	Scheme  string // one of the Scheme constants
+	Version byte   // the C0 byte received
+}
+
+func (e *UnsupportedSchemeError) Error() string {
+	return fmt.Sprintf("unsupported version 0x%02x: %s", e.Version, e.Reason())
+}
+
+// Reason explains the rejection in terms an operator can act on.
+func (e *UnsupportedSchemeError) Reason() string {
+	switch e.Scheme {
+	case SchemeRTMPE:
+		return "client requested RTMPE (encrypted RTMP), which is not supported; use rtmp:// or rtmps://"
+	case SchemeRTMPT:
+		return "client sent an HTTP request (RTMPT tunnelling), which is not supported; use rtmp:// or rtmps://"
+	case SchemeRTMPS:
+		return "client started a TLS handshake on the plain RTMP port; point rtmps:// at the TLS listener"
+	}
+	return "client did not send an RTMP handshake"
+}
+
+// classifyVersion returns the scheme a C0 byte other than Version asks for.
+func classifyVersion(c0 byte) string {
+	switch {
+	case c0 == 0x06 || c0 == 0x08 || c0 == 0x09:
+		return SchemeRTMPE
+	case c0 == 0x16:
+		return SchemeRTMPS
+	case c0 >= 'A' && c0 <= 'Z':
+		return SchemeRTMPT // confirmed by isHTTPRequest once more bytes are in
+	}
+	return SchemeUnknown
+}
+
+// isHTTPRequest reports whether b (starting with C0) begins an HTTP request
+// line: "POST /open/1 HTTP/1.1", "GET / HTTP/1.0", ...
+func isHTTPRequest(b []byte) bool {
+	line, _, _ := bytes.Cut(b, []byte("\r\n"))
+	return bytes.Contains(line, []byte(" HTTP/1."))
+}
@@ -30,6 +30,21 @@ const (
 // the public API minimal for now; later integration (T016) can be adjusted to retain
 // timestamps if required.
 func ServerHandshake(conn net.Conn) error {
+	return ServerHandshakeWithOptions(conn, ServerOptions{})
+}
+
+// ServerOptions tunes ServerHandshakeWithOptions.
+type ServerOptions struct {
+	// ReplyUnsupported answers a client that asks for an unsupported scheme
+	// before closing: S0 = 0x03 (the only version spoken here) to RTMPE,
+	// "501 Not Implemented" to RTMPT. Otherwise the connection is just closed.
+	ReplyUnsupported bool
+}
+
+// ServerHandshakeWithOptions is ServerHandshake with options. A client that
+// opens with another scheme (RTMPE, RTMPT, ...) gets a *HandshakeError
+// wrapping an *UnsupportedSchemeError.
+func ServerHandshakeWithOptions(conn net.Conn, opts ServerOptions) error {
 	if conn == nil {
 		return rerrors.NewHandshakeError("init", fmt.Errorf("nil conn"))
 	}
@@ -39,12 +54,23 @@ func ServerHandshake(conn net.Conn) error {
 
 	// 1. Read C0 (version) + C1 (1536 bytes). We use a single buffer to ensure
 	// contiguous read semantics for potential future digest schemes (even though
-	// we implement simple handshake only).
+	// we implement simple handshake only). C0 is read on its own first so a
+	// client speaking another scheme is recognised before waiting for a C1 it
+	// may never send.
 	c0c1 := make([]byte, 1+PacketSize)
 	if err := setReadDeadline(conn, serverReadTimeout); err != nil {
 		return err
 	}
-	if _, err := io.ReadFull(conn, c0c1); err != nil {
+	if _, err := io.ReadFull(conn, c0c1[:1]); err != nil {
+		if isTimeoutErr(err) {
+			return rerrors.NewTimeoutError("read C0+C1", serverReadTimeout, err)
+		}
+		return rerrors.NewHandshakeError("read C0+C1", err)
+	}
+	if c0c1[0] != Version {
+		return rejectScheme(conn, c0c1[0], opts)
+	}
+	if _, err := io.ReadFull(conn, c0c1[1:]); err != nil {
 		if isTimeoutErr(err) {
 			return rerrors.NewTimeoutError("read C0+C1", serverReadTimeout, err)
 		}
@@ -132,6 +158,39 @@ func ServerHandshake(conn net.Conn) error {
 	return nil
 }
 
+// rejectScheme fails the handshake of a client whose C0 is not Version,
+// after consuming what it sent along with C0 and, with
+// opts.ReplyUnsupported, answering it in its own scheme.
+func rejectScheme(conn net.Conn, c0 byte, opts ServerOptions) error {
+	scheme := classifyVersion(c0)
+	var reply []byte
+	switch scheme {
+	case SchemeRTMPS:
+		// A TLS ClientHello; there is nothing useful to answer without TLS.
+	case SchemeRTMPT:
+		buf := make([]byte, PacketSize)
+		buf[0] = c0
+		n, _ := conn.Read(buf[1:])
+		if isHTTPRequest(buf[:1+n]) {
+			reply = []byte(httpUnsupported)
+		} else {
+			scheme = SchemeUnknown
+		}
+	default:
+		// RTMPE and unknown versions send a C1-sized block with C0.
+		_, _ = io.ReadFull(conn, make([]byte, PacketSize))
+		if scheme == SchemeRTMPE {
+			reply = []byte{Version}
+		}
+	}
+	if opts.ReplyUnsupported && reply != nil {
+		if err := setWriteDeadline(conn, serverWriteTimeout); err == nil {
+			_ = writeFull(conn, reply)
+		}
+	}
+	return rerrors.NewHandshakeError("validate version", &UnsupportedSchemeError{Scheme: scheme, Version: c0})
+}
+
 // setReadDeadline sets a timeout for the next read operation on the connection.
 // If the peer doesn't send data within the specified duration, the read will
 // return a timeout error. This prevents the handshake from hanging indefinitely.
@@ -7,6 +7,7 @@
 // These tests use net.Pipe() for in-process TCP simulation and exercise:
 //   - Happy path (valid C0+C1 + correct C2 echo).
 //   - Invalid version (0x06 instead of 0x03).
+//   - Unsupported schemes (RTMPE, RTMPT, TLS) and the optional reply.
 //   - Truncated C1 (induces timeout).
 //   - Mismatched C2 (should warn but still succeed – real clients diverge).
 //   - Write failures (failingConn returning io.ErrClosedPipe).
@@ -24,9 +25,11 @@ package handshake
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
 	"net"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -142,6 +145,62 @@ func TestServerHandshake_InvalidVersion(t *testing.T) {
 	}
 }
 
+// TestServerHandshake_UnsupportedScheme opens with the first bytes of other
+// schemes and checks that the server names the scheme and, with
+// ReplyUnsupported, answers in it.
+func TestServerHandshake_UnsupportedScheme(t *testing.T) {
+	rtmpe := make([]byte, 1+PacketSize)
+	rtmpe[0] = 0x06
+	garbage := make([]byte, 1+PacketSize)
+	garbage[0] = 0x02
+	cases := []struct {
+		name   string
+		send   []byte
+		scheme string
+		reply  string // expected with ReplyUnsupported; "" for none
+	}{
+		{"rtmpe", rtmpe, SchemeRTMPE, "\x03"},
+		{"rtmpt", []byte("POST /open/1 HTTP/1.1\r\nContent-Type: application/x-fcs\r\n\r\n"), SchemeRTMPT, "HTTP/1.1 501 Not Implemented\r\n"},
+		{"tls", []byte{0x16, 0x03, 0x01, 0x02, 0x00}, SchemeRTMPS, ""},
+		{"unknown", garbage, SchemeUnknown, ""},
+	}
+	for _, tc := range cases {
+		for _, reply := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/reply=%v", tc.name, reply), func(t *testing.T) {
+				serverConn, clientConn := net.Pipe()
+				defer clientConn.Close()
+				errCh := make(chan error, 1)
+				go func() {
+					errCh <- ServerHandshakeWithOptions(serverConn, ServerOptions{ReplyUnsupported: reply})
+					serverConn.Close()
+				}()
+				go func() { _, _ = clientConn.Write(tc.send) }()
+
+				got, _ := io.ReadAll(clientConn)
+				want := ""
+				if reply {
+					want = tc.reply
+				}
+				if !strings.HasPrefix(string(got), want) || (want == "" && len(got) > 0) {
+					t.Fatalf("reply = %q, want %q", got, want)
+				}
+
+				err := <-errCh
+				var unsupported *UnsupportedSchemeError
+				if !errors.As(err, &unsupported) {
+					t.Fatalf("expected UnsupportedSchemeError, got %v", err)
+				}
+				if unsupported.Scheme != tc.scheme || unsupported.Version != tc.send[0] {
+					t.Fatalf("got scheme %q version 0x%02x, want %q 0x%02x", unsupported.Scheme, unsupported.Version, tc.scheme, tc.send[0])
+				}
+				if !rerrors.IsProtocolError(err) {
+					t.Fatalf("expected protocol error, got %v", err)
+				}
+			})
+		}
+	}
+}
+
 // TestServerHandshake_TruncatedC1 sends only C0 + 500 bytes of C1 (instead
 // of the full 1536) and then stalls. The server's 5-second read deadline
 // should fire and return a timeout or protocol error.
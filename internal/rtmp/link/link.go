@@ -0,0 +1,258 @@
+// File: link.go
+// Purpose: The origin link, a lightweight transport that carries one
+// stream's reassembled messages from an origin server to an edge over
+// plain TCP. An RTMP pull costs a handshake, connect/createStream/play
+// commands in AMF and chunking on both ends; a link costs one request and
+// a status byte, after which every message is a 9-byte header and its
+// payload, written as the origin's registry hands it on.
+//
+// Wire format (integers big-endian):
+//
+//	request  "RLNK" | version (1) | key length (2) | key | secret length (2) | secret
+//	status   status (1) | reason length (2) | reason
+//	message  type ID (1) | timestamp (4) | payload length (4) | payload
+//
+// The edge sends the request; the origin answers with a status and, when
+// it is StatusOK, the stream's messages until either side closes the
+// connection. Messages are what an RTMP player would get after play:
+// sequence headers, media, data messages and onStatus commands such as
+// NetStream.Play.UnpublishNotify.
+package link
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+)
+
+// Scheme is the URL scheme of link addresses: link://host:port/app/name.
+const Scheme = "link"
+
+// DefaultPort is the port of link URLs that name none.
+const DefaultPort = "1940"
+
+// Version is the protocol version sent in requests.
+const Version = 1
+
+// MaxPayload bounds a message's payload, as the RTMP message length field
+// does.
+const MaxPayload = 1<<24 - 1
+
+// maxField bounds the stream key, secret and reason strings.
+const maxField = 4096
+
+var magic = [4]byte{'R', 'L', 'N', 'K'}
+
+// Status answers a request.
+type Status byte
+
+const (
+	StatusOK       Status = 0 // the stream's messages follow
+	StatusNotFound Status = 1 // the stream has no live publisher
+	StatusRefused  Status = 2 // bad secret or stream key
+)
+
+// Errors returned by Dial, wrapped with the origin's reason.
+var (
+	ErrNotFound = errors.New("link: stream not found")
+	ErrRefused  = errors.New("link: request refused")
+)
+
+// Request asks an origin for one stream.
+type Request struct {
+	StreamKey string // e.g. "live/show"
+	Secret    string // the origin's link secret; empty when it has none
+}
+
+// WriteRequest sends req.
+func WriteRequest(w io.Writer, req Request) error {
+	if len(req.StreamKey) > maxField || len(req.Secret) > maxField {
+		return errors.New("link: request field too long")
+	}
+	b := make([]byte, 0, 9+len(req.StreamKey)+len(req.Secret))
+	b = append(b, magic[:]...)
+	b = append(b, Version)
+	b = appendString(b, req.StreamKey)
+	b = appendString(b, req.Secret)
+	_, err := w.Write(b)
+	return err
+}
+
+// ReadRequest reads a request, rejecting other protocols and versions.
+func ReadRequest(r io.Reader) (Request, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return Request{}, err
+	}
+	if [4]byte(hdr[:4]) != magic {
+		return Request{}, errors.New("link: not a link request")
+	}
+	if hdr[4] != Version {
+		return Request{}, fmt.Errorf("link: unsupported version %d", hdr[4])
+	}
+	var req Request
+	var err error
+	if req.StreamKey, err = readString(r); err != nil {
+		return Request{}, err
+	}
+	if req.Secret, err = readString(r); err != nil {
+		return Request{}, err
+	}
+	return req, nil
+}
+
+// WriteStatus answers a request with st and a reason for the logs.
+func WriteStatus(w io.Writer, st Status, reason string) error {
+	if len(reason) > maxField {
+		reason = reason[:maxField]
+	}
+	_, err := w.Write(appendString([]byte{byte(st)}, reason))
+	return err
+}
+
+// ReadStatus reads the answer to a request. It returns nil for StatusOK,
+// and otherwise ErrNotFound or ErrRefused with the origin's reason.
+func ReadStatus(r io.Reader) error {
+	var st [1]byte
+	if _, err := io.ReadFull(r, st[:]); err != nil {
+		return err
+	}
+	reason, err := readString(r)
+	if err != nil {
+		return err
+	}
+	switch Status(st[0]) {
+	case StatusOK:
+		return nil
+	case StatusNotFound:
+		return fmt.Errorf("%w: %s", ErrNotFound, reason)
+	case StatusRefused:
+		return fmt.Errorf("%w: %s", ErrRefused, reason)
+	}
+	return fmt.Errorf("link: unknown status %d: %s", st[0], reason)
+}
+
+// WriteMessage sends m's type, timestamp and payload. Chunk stream and
+// message stream IDs are not carried.
+func WriteMessage(w io.Writer, m *chunk.Message) error {
+	if len(m.Payload) > MaxPayload {
+		return fmt.Errorf("link: payload of %d bytes exceeds %d", len(m.Payload), MaxPayload)
+	}
+	var hdr [9]byte
+	hdr[0] = m.TypeID
+	binary.BigEndian.PutUint32(hdr[1:5], m.Timestamp)
+	binary.BigEndian.PutUint32(hdr[5:9], uint32(len(m.Payload)))
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(m.Payload)
+	return err
+}
+
+// ReadMessage reads one message. It is given the chunk stream a client
+// would use for its type, and message stream 1.
+func ReadMessage(r io.Reader) (*chunk.Message, error) {
+	var hdr [9]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(hdr[5:9])
+	if n > MaxPayload {
+		return nil, fmt.Errorf("link: payload of %d bytes exceeds %d", n, MaxPayload)
+	}
+	m := &chunk.Message{
+		CSID:            csidFor(hdr[0]),
+		TypeID:          hdr[0],
+		Timestamp:       binary.BigEndian.Uint32(hdr[1:5]),
+		MessageStreamID: 1,
+		MessageLength:   n,
+		Payload:         make([]byte, n),
+	}
+	if _, err := io.ReadFull(r, m.Payload); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// csidFor returns the conventional chunk stream of a message type.
+func csidFor(typeID uint8) uint32 {
+	switch typeID {
+	case 8:
+		return 6
+	case 9:
+		return 7
+	case 15, 18:
+		return 5
+	}
+	return 3
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func readString(r io.Reader) (string, error) {
+	var n [2]byte
+	if _, err := io.ReadFull(r, n[:]); err != nil {
+		return "", err
+	}
+	size := binary.BigEndian.Uint16(n[:])
+	if size > maxField {
+		return "", fmt.Errorf("link: field of %d bytes exceeds %d", size, maxField)
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// Conn is the edge end of a link, reading one stream's messages.
+type Conn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// DialFunc opens a network connection, like net.Dialer.DialContext.
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// Dial connects to the origin at addr (host:port) with dial, or a plain
+// net.Dialer when nil, and requests req's stream. It returns once the
+// origin has answered; ctx bounds the whole exchange.
+func Dial(ctx context.Context, addr string, req Request, dial DialFunc) (*Conn, error) {
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	conn, err := dial(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	c := &Conn{conn: conn, r: bufio.NewReaderSize(conn, 64<<10)}
+	if err := WriteRequest(conn, req); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := ReadStatus(c.r); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return c, nil
+}
+
+// ReadMessage reads the stream's next message.
+func (c *Conn) ReadMessage() (*chunk.Message, error) { return ReadMessage(c.r) }
+
+// Close closes the connection.
+func (c *Conn) Close() error { return c.conn.Close() }
@@ -0,0 +1,128 @@
+package link
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+)
+
+func TestRequestRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	want := Request{StreamKey: "live/show", Secret: "s3cret"}
+	if err := WriteRequest(&buf, want); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	got, err := ReadRequest(&buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if got != want {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestReadRequestRejects(t *testing.T) {
+	for name, b := range map[string][]byte{
+		"rtmp handshake": {0x03, 0, 0, 0, 0, 0, 0},
+		"version":        {'R', 'L', 'N', 'K', 9, 0, 0, 0, 0},
+		"truncated":      {'R', 'L', 'N', 'K', Version, 0, 5, 'l', 'i'},
+		"long key":       {'R', 'L', 'N', 'K', Version, 0xFF, 0xFF},
+	} {
+		if _, err := ReadRequest(bytes.NewReader(b)); err == nil {
+			t.Errorf("%s: request accepted", name)
+		}
+	}
+}
+
+func TestStatus(t *testing.T) {
+	for _, tc := range []struct {
+		st   Status
+		want error
+	}{
+		{StatusOK, nil},
+		{StatusNotFound, ErrNotFound},
+		{StatusRefused, ErrRefused},
+	} {
+		var buf bytes.Buffer
+		if err := WriteStatus(&buf, tc.st, "reason"); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if err := ReadStatus(&buf); !errors.Is(err, tc.want) || (tc.want == nil) != (err == nil) {
+			t.Errorf("status %d: got %v, want %v", tc.st, err, tc.want)
+		}
+	}
+}
+
+func TestMessageRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	sent := []*chunk.Message{
+		{TypeID: 9, Timestamp: 40, Payload: []byte{0x17, 0x01, 0, 0, 0, 0xAA}},
+		{TypeID: 8, Timestamp: 0xFFFFFF + 10, Payload: []byte{0xAF, 0x01}},
+		{TypeID: 18, Payload: []byte{0x02, 0, 0}},
+		{TypeID: 20},
+	}
+	for _, m := range sent {
+		if err := WriteMessage(&buf, m); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	wantCSID := []uint32{7, 6, 5, 3}
+	for i, m := range sent {
+		got, err := ReadMessage(&buf)
+		if err != nil {
+			t.Fatalf("read %d: %v", i, err)
+		}
+		if got.TypeID != m.TypeID || got.Timestamp != m.Timestamp || !bytes.Equal(got.Payload, m.Payload) ||
+			got.MessageLength != uint32(len(m.Payload)) || got.CSID != wantCSID[i] || got.MessageStreamID != 1 {
+			t.Fatalf("message %d: got %+v, want %+v", i, got, m)
+		}
+	}
+	if _, err := ReadMessage(&buf); err == nil {
+		t.Fatal("read past the end succeeded")
+	}
+}
+
+func TestDial(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			req, err := ReadRequest(conn)
+			if err != nil || req.Secret != "s3cret" {
+				_ = WriteStatus(conn, StatusRefused, "bad secret")
+				conn.Close()
+				continue
+			}
+			_ = WriteStatus(conn, StatusOK, "")
+			_ = WriteMessage(conn, &chunk.Message{TypeID: 9, Timestamp: 40, Payload: []byte{0x17, 0x01}})
+			conn.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := Dial(ctx, ln.Addr().String(), Request{StreamKey: "live/show"}, nil); !errors.Is(err, ErrRefused) {
+		t.Fatalf("dial without secret: %v, want ErrRefused", err)
+	}
+	c, err := Dial(ctx, ln.Addr().String(), Request{StreamKey: "live/show", Secret: "s3cret"}, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer c.Close()
+	m, err := c.ReadMessage()
+	if err != nil || m.TypeID != 9 || m.Timestamp != 40 {
+		t.Fatalf("read: %+v, %v", m, err)
+	}
+}
@@ -0,0 +1,155 @@
+package media
+
+// Async Recording Writer
+// ----------------------
+// Recorders write to disk synchronously. Called from the publisher's read
+// loop, a slow or stalled disk would hold up the whole stream: subscribers,
+// relays and the publisher's acknowledgements. AsyncWriter moves the writes
+// onto a dedicated goroutine fed by a bounded queue.
+//
+// Overflow: when the queue is full the message is dropped and the writer
+// skips everything up to the next video keyframe (or, for audio-only
+// streams, the next audio message), so the recording resumes on a frame a
+// decoder can start from instead of a run of undecodable P-frames.
+//
+// Errors: the inner recorder disables itself on a write error. Once that
+// happens AsyncWriter discards queued and new messages; live relay is not
+// affected either way.
+
+import (
+	"log/slog"
+	"sync"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/metrics"
+)
+
+// DefaultRecordQueueSize is the number of messages an AsyncWriter buffers
+// when no size is given (a few seconds of typical audio+video).
+const DefaultRecordQueueSize = 1024
+
+// AsyncWriter wraps a MediaWriter so that WriteMessage never blocks on
+// file I/O. It is safe for concurrent use.
+type AsyncWriter struct {
+	w      MediaWriter
+	logger *slog.Logger
+	queue  chan *chunk.Message
+	done   chan struct{} // closed when the write goroutine exits
+
+	mu       sync.Mutex
+	closed   bool
+	waitKey  bool   // dropping until the next resume point after an overflow
+	hasVideo bool   // a video message has been seen
+	dropped  uint64 // messages dropped on overflow
+}
+
+// NewAsyncWriter starts a write goroutine for w with a queue of size
+// messages (DefaultRecordQueueSize if size <= 0).
+func NewAsyncWriter(w MediaWriter, size int, logger *slog.Logger) *AsyncWriter {
+	if size <= 0 {
+		size = DefaultRecordQueueSize
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	a := &AsyncWriter{
+		w:      w,
+		logger: logger,
+		queue:  make(chan *chunk.Message, size),
+		done:   make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// run writes queued messages until the queue is closed. After the inner
+// writer disables itself the remaining messages are discarded.
+func (a *AsyncWriter) run() {
+	defer close(a.done)
+	for msg := range a.queue {
+		if !a.w.Disabled() {
+			a.w.WriteMessage(msg)
+		}
+		msg.Release()
+	}
+}
+
+// WriteMessage queues a copy of msg for writing. It never blocks: if the
+// queue is full the message is dropped and recording skips ahead to the
+// next keyframe.
+func (a *AsyncWriter) WriteMessage(msg *chunk.Message) {
+	if msg == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed || a.w.Disabled() {
+		return
+	}
+	if msg.TypeID == 9 {
+		a.hasVideo = true
+	}
+	if a.waitKey && !a.resumePoint(msg) {
+		a.drop()
+		return
+	}
+	cp := msg.Share() // the caller may reuse msg; the payload is never mutated
+	select {
+	case a.queue <- cp:
+		if a.waitKey {
+			a.waitKey = false
+			a.logger.Info("recording resumed after queue overflow", "dropped", a.dropped)
+		}
+	default:
+		if !a.waitKey {
+			a.logger.Warn("recording queue full, dropping until next keyframe", "queue_size", cap(a.queue))
+		}
+		a.waitKey = true
+		a.drop()
+		cp.Release()
+	}
+}
+
+// resumePoint reports whether msg is a safe place to restart a recording
+// after dropped messages. Caller holds a.mu.
+func (a *AsyncWriter) resumePoint(msg *chunk.Message) bool {
+	switch msg.TypeID {
+	case 9:
+		return isVideoKeyframe(msg.Payload)
+	case 8:
+		return !a.hasVideo
+	}
+	return false
+}
+
+// drop records a dropped message. Caller holds a.mu.
+func (a *AsyncWriter) drop() {
+	a.dropped++
+	metrics.RecordingMessagesDropped.Add(1)
+}
+
+// Dropped returns the number of messages dropped because the queue was full.
+func (a *AsyncWriter) Dropped() uint64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.dropped
+}
+
+// Disabled reports whether the inner recorder has stopped after an error.
+func (a *AsyncWriter) Disabled() bool { return a.w.Disabled() }
+
+// Close stops accepting messages, waits for the queued ones to be written
+// and closes the inner recorder. Calling Close more than once is a no-op.
+func (a *AsyncWriter) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	close(a.queue)
+	a.mu.Unlock()
+
+	<-a.done
+	return a.w.Close()
+}
@@ -0,0 +1,162 @@
+package media
+
+// Tests for AsyncWriter — recording off the publisher's read loop.
+//
+// A fake MediaWriter blocks on a gate channel to simulate a stalled disk,
+// so the tests can fill the queue deterministically and check that
+// WriteMessage never blocks, overflow skips to the next keyframe, Close
+// drains the queue and a disabled recorder discards further messages.
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+)
+
+// gatedWriter records written timestamps. Each write waits on gate when
+// it is non-nil, simulating a slow disk.
+type gatedWriter struct {
+	gate chan struct{}
+
+	mu       sync.Mutex
+	written  []uint32
+	disabled bool
+	closed   bool
+}
+
+func (g *gatedWriter) WriteMessage(msg *chunk.Message) {
+	if g.gate != nil {
+		<-g.gate
+	}
+	g.mu.Lock()
+	g.written = append(g.written, msg.Timestamp)
+	g.mu.Unlock()
+}
+
+func (g *gatedWriter) Close() error {
+	g.mu.Lock()
+	g.closed = true
+	g.mu.Unlock()
+	return nil
+}
+
+func (g *gatedWriter) Disabled() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.disabled
+}
+
+func (g *gatedWriter) timestamps() []uint32 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]uint32(nil), g.written...)
+}
+
+func videoMsg(ts uint32, payload []byte) *chunk.Message {
+	return &chunk.Message{TypeID: 9, Timestamp: ts, Payload: payload}
+}
+
+func TestAsyncWriter_WritesInOrderAndDrainsOnClose(t *testing.T) {
+	inner := &gatedWriter{}
+	a := NewAsyncWriter(inner, 16, nil)
+	for ts := uint32(0); ts < 10; ts++ {
+		a.WriteMessage(videoMsg(ts, makeVideoPFrame()))
+	}
+	if err := a.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	got := inner.timestamps()
+	if len(got) != 10 {
+		t.Fatalf("wrote %d messages, want 10", len(got))
+	}
+	for i, ts := range got {
+		if ts != uint32(i) {
+			t.Fatalf("message %d has timestamp %d", i, ts)
+		}
+	}
+	if !inner.closed {
+		t.Fatal("inner writer not closed")
+	}
+	a.WriteMessage(videoMsg(99, makeVideoKeyframe())) // after Close: ignored
+	if err := a.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+}
+
+func TestAsyncWriter_OverflowSkipsToKeyframe(t *testing.T) {
+	inner := &gatedWriter{gate: make(chan struct{})}
+	a := NewAsyncWriter(inner, 2, nil)
+
+	// The write goroutine takes ts 0 and blocks on the gate; 1 and 2 fill
+	// the queue; 3 overflows and 4 (a P-frame) is skipped.
+	start := time.Now()
+	a.WriteMessage(videoMsg(0, makeVideoKeyframe()))
+	time.Sleep(20 * time.Millisecond)
+	for ts := uint32(1); ts <= 4; ts++ {
+		a.WriteMessage(videoMsg(ts, makeVideoPFrame()))
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("WriteMessage blocked for %v", d)
+	}
+	if a.Dropped() != 2 {
+		t.Fatalf("dropped = %d, want 2", a.Dropped())
+	}
+
+	close(inner.gate) // disk recovers
+	time.Sleep(20 * time.Millisecond)
+	a.WriteMessage(videoMsg(5, makeVideoPFrame()))   // still skipped
+	a.WriteMessage(videoMsg(6, makeVideoKeyframe())) // resumes here
+	a.WriteMessage(videoMsg(7, makeVideoPFrame()))
+	if err := a.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	want := []uint32{0, 1, 2, 6, 7}
+	got := inner.timestamps()
+	if len(got) != len(want) {
+		t.Fatalf("wrote %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("wrote %v, want %v", got, want)
+		}
+	}
+	if a.Dropped() != 3 {
+		t.Fatalf("dropped = %d, want 3", a.Dropped())
+	}
+}
+
+func TestAsyncWriter_AudioOnlyResumesOnAudio(t *testing.T) {
+	inner := &gatedWriter{gate: make(chan struct{})}
+	a := NewAsyncWriter(inner, 1, nil)
+	audio := func(ts uint32) *chunk.Message {
+		return &chunk.Message{TypeID: 8, Timestamp: ts, Payload: []byte{0xAF, 0x01, 0x00}}
+	}
+	a.WriteMessage(audio(0))
+	time.Sleep(20 * time.Millisecond)
+	a.WriteMessage(audio(1)) // queued
+	a.WriteMessage(audio(2)) // overflow
+	close(inner.gate)
+	time.Sleep(20 * time.Millisecond)
+	a.WriteMessage(audio(3))
+	_ = a.Close()
+
+	if got := inner.timestamps(); len(got) != 3 || got[2] != 3 {
+		t.Fatalf("wrote %v, want [0 1 3]", got)
+	}
+}
+
+func TestAsyncWriter_DisabledDiscards(t *testing.T) {
+	inner := &gatedWriter{disabled: true}
+	a := NewAsyncWriter(inner, 4, nil)
+	if !a.Disabled() {
+		t.Fatal("Disabled() should reflect the inner writer")
+	}
+	a.WriteMessage(videoMsg(0, makeVideoKeyframe()))
+	_ = a.Close()
+	if got := inner.timestamps(); len(got) != 0 {
+		t.Fatalf("disabled recorder wrote %v", got)
+	}
+}
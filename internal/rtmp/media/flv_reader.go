@@ -0,0 +1,114 @@
+package media
+
+// FLV Reader
+// ----------
+// Sequential reader for FLV files produced by FLVRecorder (or any standard
+// FLV muxer). It is the inverse of recorder.go: it validates the 9-byte FLV
+// header, skips PreviousTagSize0, and then yields one tag at a time.
+//
+// Tags are returned in file order. The reader does not buffer the whole file,
+// so it is suitable for streaming long recordings to VOD subscribers.
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// FLV tag types (match RTMP message type IDs for audio/video/script data).
+const (
+	FLVTagAudio  uint8 = 8
+	FLVTagVideo  uint8 = 9
+	FLVTagScript uint8 = 18
+)
+
+// maxFLVTagSize guards against corrupt DataSize fields. The field is 24 bits
+// wide so this is also the protocol maximum.
+const maxFLVTagSize = 0xFFFFFF
+
+// FLVTag is a single tag read from an FLV file.
+type FLVTag struct {
+	Type      uint8  // 8=audio, 9=video, 18=script data
+	Timestamp uint32 // milliseconds (lower 24 bits + extended byte combined)
+	Data      []byte // tag body (same layout as an RTMP message payload)
+}
+
+// FLVReader reads tags sequentially from an FLV byte stream.
+type FLVReader struct {
+	r        io.Reader
+	HasAudio bool // audio flag from the FLV header
+	HasVideo bool // video flag from the FLV header
+}
+
+// NewFLVReader validates the FLV header and positions the reader at the
+// first tag. Returns an error if the signature or header length is invalid.
+func NewFLVReader(r io.Reader) (*FLVReader, error) {
+	var hdr [9]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("flv.header.read: %w", err)
+	}
+	if hdr[0] != 'F' || hdr[1] != 'L' || hdr[2] != 'V' {
+		return nil, errors.New("flv.header: bad signature")
+	}
+	dataOffset := binary.BigEndian.Uint32(hdr[5:9])
+	if dataOffset < 9 {
+		return nil, fmt.Errorf("flv.header: invalid data offset %d", dataOffset)
+	}
+	// Skip any extra header bytes (spec allows DataOffset > 9) plus PreviousTagSize0.
+	if _, err := io.CopyN(io.Discard, r, int64(dataOffset-9)+4); err != nil {
+		return nil, fmt.Errorf("flv.header.skip: %w", err)
+	}
+	return &FLVReader{
+		r:        r,
+		HasAudio: hdr[4]&0x04 != 0,
+		HasVideo: hdr[4]&0x01 != 0,
+	}, nil
+}
+
+// ReadTag returns the next tag in the file. It returns io.EOF when the file
+// ends cleanly on a tag boundary.
+func (fr *FLVReader) ReadTag() (*FLVTag, error) {
+	var hdr [11]byte
+	if _, err := io.ReadFull(fr.r, hdr[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("flv.tag.header: %w", err)
+	}
+	tagType := hdr[0] & 0x1F // upper bits are reserved / filter flag
+	dataSize := uint32(hdr[1])<<16 | uint32(hdr[2])<<8 | uint32(hdr[3])
+	if dataSize > maxFLVTagSize {
+		return nil, fmt.Errorf("flv.tag: data size %d too large", dataSize)
+	}
+	ts := uint32(hdr[4])<<16 | uint32(hdr[5])<<8 | uint32(hdr[6]) | uint32(hdr[7])<<24
+
+	data := make([]byte, dataSize)
+	if _, err := io.ReadFull(fr.r, data); err != nil {
+		return nil, fmt.Errorf("flv.tag.data: %w", err)
+	}
+	// PreviousTagSize trailer — read and discard (we don't seek backwards).
+	var prev [4]byte
+	if _, err := io.ReadFull(fr.r, prev[:]); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("flv.tag.prev_size: %w", err)
+	}
+	return &FLVTag{Type: tagType, Timestamp: ts, Data: data}, nil
+}
+
+// IsSequenceHeader reports whether the tag carries codec configuration
+// (AVC/HEVC decoder config or AAC AudioSpecificConfig). Such tags must be
+// delivered to a player even when seeking past them.
+func (t *FLVTag) IsSequenceHeader() bool {
+	switch t.Type {
+	case FLVTagVideo:
+		return IsVideoSequenceHeader(t.Data)
+	case FLVTagAudio:
+		return IsAudioSequenceHeader(t.Data)
+	}
+	return false
+}
+
+// IsKeyframe reports whether the tag is a video keyframe.
+func (t *FLVTag) IsKeyframe() bool {
+	return t.Type == FLVTagVideo && isVideoKeyframe(t.Data)
+}
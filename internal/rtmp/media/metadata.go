@@ -1,14 +1,136 @@
 package media
 
+import (
+	"bytes"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
+)
+
 // FLVMetadata holds extracted properties for the FLV onMetaData script tag.
 type FLVMetadata struct {
 	Width           int
 	Height          int
-	VideoCodecID    float64 // FLV video codec ID: 7=AVC, 12=HEVC
+	VideoCodecID    float64 // FLV video codec ID: 7=AVC, 12=HEVC, else the FourCC (VideoCodecFLVID)
 	AudioCodecID    float64 // FLV audio codec ID: 10=AAC, 2=MP3
 	AudioSampleRate float64
 	AudioChannels   int
 	Stereo          bool
+
+	// Extra holds the publisher's own onMetaData properties (framerate,
+	// videodatarate, encoder, ...). They are written alongside the fields
+	// above, which win whenever they are known (non-zero).
+	Extra map[string]interface{}
+}
+
+// ParseOnMetaData decodes a data message (TypeID 18) carrying stream
+// metadata, as sent by encoders either as @setDataFrame("onMetaData", {...})
+// or as a bare onMetaData. It returns the properties, or false for any other
+// data message.
+func ParseOnMetaData(payload []byte) (map[string]interface{}, bool) {
+	r := bytes.NewReader(payload)
+	name, err := amf.DecodeValue(r)
+	if err != nil {
+		return nil, false
+	}
+	if name == "@setDataFrame" {
+		if name, err = amf.DecodeValue(r); err != nil {
+			return nil, false
+		}
+	}
+	if name != "onMetaData" {
+		return nil, false
+	}
+	v, err := amf.DecodeValue(r)
+	if err != nil {
+		return nil, false
+	}
+	props, ok := v.(map[string]interface{})
+	return props, ok
+}
+
+// ParseCuePoint decodes a data message (TypeID 18) carrying a cue or ad
+// marker: onCuePoint or onAdMarker, bare or wrapped in @setDataFrame. It
+// returns the handler name and the cue's properties (a non-object argument
+// is returned under "value"), or false for any other data message.
+func ParseCuePoint(payload []byte) (name string, props map[string]interface{}, ok bool) {
+	r := bytes.NewReader(payload)
+	v, err := amf.DecodeValue(r)
+	if err != nil {
+		return "", nil, false
+	}
+	if v == "@setDataFrame" {
+		if v, err = amf.DecodeValue(r); err != nil {
+			return "", nil, false
+		}
+	}
+	name, _ = v.(string)
+	if name != "onCuePoint" && name != "onAdMarker" {
+		return "", nil, false
+	}
+	props = map[string]interface{}{}
+	if r.Len() == 0 {
+		return name, props, true
+	}
+	if v, err = amf.DecodeValue(r); err != nil {
+		return "", nil, false
+	}
+	if m, isMap := v.(map[string]interface{}); isMap {
+		props = m
+	} else {
+		props["value"] = v
+	}
+	return name, props, true
+}
+
+// IsCuePoint reports whether payload is a cue point or ad marker data
+// message, as recognized by ParseCuePoint.
+func IsCuePoint(payload []byte) bool {
+	_, _, ok := ParseCuePoint(payload)
+	return ok
+}
+
+// FrameInfo is an onFI data message: the time stamp a hardware encoder (or
+// Adobe FMLE, Wirecast, ...) injects into the stream, used to line up
+// feeds recorded or produced separately.
+type FrameInfo struct {
+	Timecode   string // "tc": SMPTE timecode hh:mm:ss:ff (";" before ff when drop-frame)
+	SystemDate string // "sd": the encoder's date, dd-mm-yyyy
+	SystemTime string // "st": the encoder's time of day, hh:mm:ss.mmm
+}
+
+// ParseFrameInfo decodes a data message (TypeID 18) carrying onFI, bare or
+// wrapped in @setDataFrame. It returns false for any other data message
+// and for an onFI with none of tc, sd and st.
+func ParseFrameInfo(payload []byte) (FrameInfo, bool) {
+	r := bytes.NewReader(payload)
+	v, err := amf.DecodeValue(r)
+	if err != nil {
+		return FrameInfo{}, false
+	}
+	if v == "@setDataFrame" {
+		if v, err = amf.DecodeValue(r); err != nil {
+			return FrameInfo{}, false
+		}
+	}
+	if v != "onFI" {
+		return FrameInfo{}, false
+	}
+	if v, err = amf.DecodeValue(r); err != nil {
+		return FrameInfo{}, false
+	}
+	props, _ := v.(map[string]interface{})
+	var fi FrameInfo
+	fi.Timecode, _ = props["tc"].(string)
+	fi.SystemDate, _ = props["sd"].(string)
+	fi.SystemTime, _ = props["st"].(string)
+	return fi, fi != FrameInfo{}
+}
+
+// IsFrameInfo reports whether payload is an onFI data message, as
+// recognized by ParseFrameInfo.
+func IsFrameInfo(payload []byte) bool {
+	_, ok := ParseFrameInfo(payload)
+	return ok
 }
 
 // bitReader reads individual bits from a byte slice.
@@ -374,12 +496,22 @@ func ExtractAudioMetadata(payload []byte) (sampleRate int, channels int, stereo
 }
 
 // VideoCodecFLVID returns the FLV numeric codec ID for a video codec string.
+// Codecs without a legacy ID are identified the Enhanced RTMP way, by their
+// FourCC as a number (e.g. 0x61763031 for "av01").
 func VideoCodecFLVID(codec string) float64 {
 	switch codec {
 	case VideoCodecAVC:
 		return 7
 	case VideoCodecHEVC:
 		return 12
+	case VideoCodecAV1:
+		return float64(fourCC("av01"))
+	case VideoCodecVP9:
+		return float64(fourCC("vp09"))
+	case VideoCodecVP8:
+		return float64(fourCC("vp08"))
+	case VideoCodecVVC:
+		return float64(fourCC("vvc1"))
 	default:
 		return 0
 	}
@@ -2,6 +2,8 @@ package media
 
 import (
 	"testing"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
 )
 
 // buildAVCC wraps an SPS NALU in an RTMP video sequence header (keyframe + AVC + AVCC record).
@@ -221,6 +223,8 @@ func TestVideoCodecFLVID(t *testing.T) {
 	}{
 		{VideoCodecAVC, 7},
 		{VideoCodecHEVC, 12},
+		{VideoCodecAV1, 0x61763031},
+		{VideoCodecVP9, 0x76703039},
 		{"unknown", 0},
 		{"", 0},
 	}
@@ -250,3 +254,72 @@ func TestAudioCodecFLVID(t *testing.T) {
 		}
 	}
 }
+
+func TestParseOnMetaData(t *testing.T) {
+	props := map[string]interface{}{"framerate": 30.0, "encoder": "obs-output module"}
+	withSetDataFrame, _ := amf.EncodeAll("@setDataFrame", "onMetaData", amf.ECMAArray(props))
+	bare, _ := amf.EncodeAll("onMetaData", amf.ECMAArray(props))
+	other, _ := amf.EncodeAll("onCuePoint", amf.ECMAArray(props))
+
+	for name, payload := range map[string][]byte{"@setDataFrame": withSetDataFrame, "bare": bare} {
+		got, ok := ParseOnMetaData(payload)
+		if !ok || got["framerate"] != 30.0 || got["encoder"] != "obs-output module" {
+			t.Errorf("%s: got (%v, %v)", name, got, ok)
+		}
+	}
+	if _, ok := ParseOnMetaData(other); ok {
+		t.Errorf("onCuePoint parsed as metadata")
+	}
+	if _, ok := ParseOnMetaData([]byte{0xFF}); ok {
+		t.Errorf("garbage parsed as metadata")
+	}
+}
+
+func TestParseCuePoint(t *testing.T) {
+	cue := map[string]interface{}{"name": "splice", "type": "scte35", "time": 12.5}
+	bare, _ := amf.EncodeAll("onCuePoint", cue)
+	wrapped, _ := amf.EncodeAll("@setDataFrame", "onAdMarker", amf.ECMAArray(cue))
+	for name, payload := range map[string][]byte{"onCuePoint": bare, "onAdMarker": wrapped} {
+		got, props, ok := ParseCuePoint(payload)
+		if !ok || got != name || props["type"] != "scte35" || props["time"] != 12.5 {
+			t.Errorf("%s: got (%q, %v, %v)", name, got, props, ok)
+		}
+	}
+
+	scalar, _ := amf.EncodeAll("onAdMarker", "/DAlAAAAAAAAAP/wFAUAAAABf+/+")
+	if _, props, ok := ParseCuePoint(scalar); !ok || props["value"] != "/DAlAAAAAAAAAP/wFAUAAAABf+/+" {
+		t.Errorf("scalar argument: got (%v, %v)", props, ok)
+	}
+	noArg, _ := amf.EncodeAll("onCuePoint")
+	if _, props, ok := ParseCuePoint(noArg); !ok || len(props) != 0 {
+		t.Errorf("no argument: got (%v, %v)", props, ok)
+	}
+	meta, _ := amf.EncodeAll("@setDataFrame", "onMetaData", amf.ECMAArray(cue))
+	if IsCuePoint(meta) {
+		t.Errorf("onMetaData parsed as a cue point")
+	}
+}
+
+func TestParseFrameInfo(t *testing.T) {
+	fi := map[string]interface{}{"tc": "10:00:01:12", "sd": "17-10-2026", "st": "14:03:07.480"}
+	bare, _ := amf.EncodeAll("onFI", fi)
+	wrapped, _ := amf.EncodeAll("@setDataFrame", "onFI", amf.ECMAArray(fi))
+	want := FrameInfo{Timecode: "10:00:01:12", SystemDate: "17-10-2026", SystemTime: "14:03:07.480"}
+	for name, payload := range map[string][]byte{"bare": bare, "wrapped": wrapped} {
+		if got, ok := ParseFrameInfo(payload); !ok || got != want {
+			t.Errorf("%s: got (%+v, %v)", name, got, ok)
+		}
+	}
+
+	dateOnly, _ := amf.EncodeAll("onFI", map[string]interface{}{"sd": "17-10-2026", "st": "14:03:07.480"})
+	if got, ok := ParseFrameInfo(dateOnly); !ok || got.Timecode != "" || got.SystemTime != "14:03:07.480" {
+		t.Errorf("sd/st only: got (%+v, %v)", got, ok)
+	}
+	empty, _ := amf.EncodeAll("onFI", map[string]interface{}{})
+	cue, _ := amf.EncodeAll("onCuePoint", fi)
+	for name, payload := range map[string][]byte{"empty onFI": empty, "cue point": cue, "garbage": {0xFF}} {
+		if IsFrameInfo(payload) {
+			t.Errorf("%s parsed as onFI", name)
+		}
+	}
+}
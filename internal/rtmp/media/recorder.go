@@ -8,7 +8,8 @@ package media
 //
 // Design:
 //   * MediaWriter interface: unified API (WriteMessage, Close, Disabled)
-//   * FLVRecorder: writes FLV tags (existing format for H.264)
+//   * FLVRecorder: writes FLV tags (existing format for H.264); AppendFLVRecorder
+//     continues an existing FLV file (publish type "append")
 //   * MP4Recorder: writes MP4 atoms (simple mdat + moov for H.265+)
 //   * NewRecorder factory: routes to appropriate implementation based on codec
 //
@@ -17,15 +18,19 @@ package media
 // based on selected format (.flv or .mp4).
 
 import (
+	"bufio"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
 	"math"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
 	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
@@ -38,6 +43,24 @@ type MediaWriter interface {
 	Disabled() bool
 }
 
+// RecordingInfo describes a finished recording file. It is what the
+// record_complete hook event reports.
+type RecordingInfo struct {
+	Path        string
+	Duration    time.Duration
+	Bytes       int64
+	VideoCodec  string // VideoCodec* constant, empty if unknown
+	AudioCodec  string // AudioCodec* constant, empty if unknown
+	VideoFrames int    // video frames, not counting sequence headers
+	AudioFrames int    // audio frames, not counting sequence headers
+}
+
+// InfoReporter is implemented by recorders that can describe the file they
+// wrote. Info is complete once Close has returned.
+type InfoReporter interface {
+	Info() RecordingInfo
+}
+
 // SelectContainerFormat returns the recommended container format for the given video codec.
 // Defaults to FLV for backward compatibility when codec is empty or unknown.
 func SelectContainerFormat(codec string) string {
@@ -51,6 +74,18 @@ func SelectContainerFormat(codec string) string {
 	}
 }
 
+// ContainerFormat returns the container format a recording of codec is
+// written in: format when it is "flv" or "mp4", otherwise the one
+// SelectContainerFormat recommends. FLV can hold every codec; those without
+// a legacy FLV codec ID are stored as Enhanced RTMP tags (FourCC headers),
+// exactly as the publisher sent them.
+func ContainerFormat(codec, format string) string {
+	if format == "flv" || format == "mp4" {
+		return format
+	}
+	return SelectContainerFormat(codec)
+}
+
 // UpdateRecordingPath modifies the file extension based on the selected container format.
 // E.g., "recordings/stream_20260411_103406.flv" → "recordings/stream_20260411_103406.mp4" for H.265
 func UpdateRecordingPath(path string, format string) string {
@@ -68,11 +103,18 @@ func UpdateRecordingPath(path string, format string) string {
 // The codec parameter determines output format: H.265+ → MP4, H.264 → FLV (default).
 // The optional metadata parameter provides video/audio properties for the FLV onMetaData tag.
 func NewRecorder(path, codec string, logger *slog.Logger, meta ...FLVMetadata) (MediaWriter, error) {
+	return NewRecorderFormat(path, codec, "", logger, meta...)
+}
+
+// NewRecorderFormat is NewRecorder with the container format chosen by
+// ContainerFormat(codec, format), so "flv" records H.265, AV1 or VP9 as
+// Enhanced FLV instead of MP4.
+func NewRecorderFormat(path, codec, format string, logger *slog.Logger, meta ...FLVMetadata) (MediaWriter, error) {
 	if logger == nil {
 		logger = slog.Default()
 	}
 
-	format := SelectContainerFormat(codec)
+	format = ContainerFormat(codec, format)
 	finalPath := UpdateRecordingPath(path, format)
 
 	if format == "mp4" {
@@ -94,11 +136,18 @@ func NewRecorder(path, codec string, logger *slog.Logger, meta ...FLVMetadata) (
 type FLVRecorder struct {
 	mu           sync.Mutex
 	f            *os.File // need WriteAt for duration patching
+	path         string
 	logger       *slog.Logger
 	wroteHeader  bool
 	bytesWritten uint64
 	meta         FLVMetadata
 
+	// Codecs detected from the tags and frame counts, for Info.
+	videoCodec  string
+	audioCodec  string
+	videoFrames int
+	audioFrames int
+
 	// Offsets within the file where the duration and filesize AMF0 Number
 	// values are stored. These point to the 8-byte IEEE-754 double payload
 	// (after the AMF0 Number marker 0x00). Set by writeOnMetaData.
@@ -108,6 +157,10 @@ type FLVRecorder struct {
 	// Timestamp tracking for duration calculation on Close().
 	firstTimestamp int64 // -1 means unset
 	lastTimestamp  uint32
+
+	// tsOffset is added to every message timestamp. It is non-zero when
+	// appending, so new tags continue after the file's last one.
+	tsOffset uint32
 }
 
 // NewFLVRecorder creates an FLV recorder writing to the supplied file path.
@@ -121,7 +174,7 @@ func NewFLVRecorder(path string, logger *slog.Logger, meta FLVMetadata) (*FLVRec
 	if err != nil {
 		return nil, fmt.Errorf("recorder.create: %w", err)
 	}
-	r := &FLVRecorder{f: f, logger: logger, meta: meta, firstTimestamp: -1}
+	r := &FLVRecorder{f: f, path: path, logger: logger, meta: meta, firstTimestamp: -1}
 	if err := r.writeHeader(); err != nil {
 		return nil, err
 	}
@@ -131,6 +184,103 @@ func NewFLVRecorder(path string, logger *slog.Logger, meta FLVMetadata) (*FLVRec
 	return r, nil
 }
 
+// AppendFLVRecorder opens the FLV file at path to append to it, for a
+// publish of type "append". New tags are written after the existing ones,
+// with timestamps shifted to continue where the file left off, and Close
+// updates the duration and filesize of the file's onMetaData tag to cover
+// the whole file. A trailing tag cut short (e.g. by a crash) is truncated
+// first. A missing or empty file is created as with NewFLVRecorder.
+func AppendFLVRecorder(path string, logger *slog.Logger, meta FLVMetadata) (*FLVRecorder, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if errors.Is(err, fs.ErrNotExist) {
+		return NewFLVRecorder(path, logger, meta)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("recorder.append: %w", err)
+	}
+	if info, err := f.Stat(); err == nil && info.Size() == 0 {
+		f.Close()
+		return NewFLVRecorder(path, logger, meta)
+	}
+	r := &FLVRecorder{f: f, path: path, logger: logger, meta: meta, firstTimestamp: -1, wroteHeader: true}
+	end, err := r.scanExisting()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("recorder.append: %w", err)
+	}
+	if err := f.Truncate(end); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("recorder.append.truncate: %w", err)
+	}
+	if _, err := f.Seek(end, io.SeekStart); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("recorder.append.seek: %w", err)
+	}
+	r.bytesWritten = uint64(end)
+	if r.firstTimestamp >= 0 {
+		r.tsOffset = r.lastTimestamp + 1
+	}
+	return r, nil
+}
+
+// scanExisting reads the tags of the file being appended to. It picks up
+// the onMetaData duration and filesize offsets, the audio/video timestamp
+// range, codecs and frame counts, and returns the offset just past the last complete tag.
+func (r *FLVRecorder) scanExisting() (int64, error) {
+	cr := &countingReader{r: bufio.NewReader(r.f)}
+	fr, err := NewFLVReader(cr)
+	if err != nil {
+		return 0, err
+	}
+	end := cr.n
+	for {
+		tag, err := fr.ReadTag()
+		if err != nil {
+			break // io.EOF, or a damaged tail that is truncated away
+		}
+		tagStart := end
+		if cr.n < tagStart+11+int64(len(tag.Data))+4 {
+			break // PreviousTagSize missing
+		}
+		end = cr.n
+		switch tag.Type {
+		case FLVTagScript:
+			if r.durationOffset == 0 && r.fileSizeOffset == 0 {
+				if off := findAMFNumberOffset(tag.Data, "duration"); off >= 0 {
+					r.durationOffset = tagStart + 11 + off
+				}
+				if off := findAMFNumberOffset(tag.Data, "filesize"); off >= 0 {
+					r.fileSizeOffset = tagStart + 11 + off
+				}
+			}
+		case FLVTagAudio, FLVTagVideo:
+			if r.firstTimestamp < 0 {
+				r.firstTimestamp = int64(tag.Timestamp)
+			}
+			if tag.Timestamp > r.lastTimestamp {
+				r.lastTimestamp = tag.Timestamp
+			}
+			r.countFrameLocked(tag.Type, tag.Data)
+		}
+	}
+	return end, nil
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
 // newFLVRecorderWithWriter allows tests to inject a failing writer (disk full simulation).
 // Duration patching is not available through this path (requires *os.File).
 func newFLVRecorderWithWriter(w io.WriteCloser, logger *slog.Logger) *FLVRecorder {
@@ -200,18 +350,27 @@ func (r *FLVRecorder) writeOnMetaData() error {
 		return fmt.Errorf("recorder.metadata: file closed")
 	}
 
-	// Build the AMF0 payload: String("onMetaData") + ECMAArray({...})
-	props := amf.ECMAArray{
-		"duration":        0.0, // patched on Close()
-		"filesize":        0.0, // patched on Close()
-		"width":           float64(r.meta.Width),
-		"height":          float64(r.meta.Height),
-		"videocodecid":    r.meta.VideoCodecID,
-		"audiocodecid":    r.meta.AudioCodecID,
-		"audiosamplerate": r.meta.AudioSampleRate,
-		"audiosamplesize": float64(16),
-		"stereo":          r.meta.Stereo,
+	// Build the AMF0 payload: String("onMetaData") + ECMAArray({...}).
+	// Publisher-supplied properties come first; detected values replace
+	// them unless unknown (zero).
+	props := amf.ECMAArray{}
+	for k, v := range r.meta.Extra {
+		props[k] = v
+	}
+	detected := func(key string, v interface{}, known bool) {
+		if _, ok := props[key]; !ok || known {
+			props[key] = v
+		}
 	}
+	detected("width", float64(r.meta.Width), r.meta.Width != 0)
+	detected("height", float64(r.meta.Height), r.meta.Height != 0)
+	detected("videocodecid", r.meta.VideoCodecID, r.meta.VideoCodecID != 0)
+	detected("audiocodecid", r.meta.AudioCodecID, r.meta.AudioCodecID != 0)
+	detected("audiosamplerate", r.meta.AudioSampleRate, r.meta.AudioSampleRate != 0)
+	detected("audiosamplesize", float64(16), false)
+	detected("stereo", r.meta.Stereo, r.meta.AudioChannels != 0)
+	props["duration"] = 0.0 // patched on Close()
+	props["filesize"] = 0.0 // patched on Close()
 
 	payload, err := amf.EncodeAll("onMetaData", props)
 	if err != nil {
@@ -268,10 +427,14 @@ func findAMFNumberOffset(payload []byte, key string) int64 {
 	return -1
 }
 
-// WriteMessage persists an RTMP media message (audio=8, video=9). Other message
-// types are ignored silently. Safe to call after a failure; it no‑ops when disabled.
+// WriteMessage persists an RTMP media message (audio=8, video=9), or a cue
+// point or onFI timecode data message (18, see ParseCuePoint and
+// ParseFrameInfo) as a script tag. Other message types are ignored silently. Safe to call after a failure; it no‑ops when disabled.
 func (r *FLVRecorder) WriteMessage(msg *chunk.Message) {
-	if msg == nil || (msg.TypeID != 8 && msg.TypeID != 9) {
+	if msg == nil {
+		return
+	}
+	if msg.TypeID != 8 && msg.TypeID != 9 && (msg.TypeID != 18 || !(IsCuePoint(msg.Payload) || IsFrameInfo(msg.Payload))) {
 		return
 	}
 	r.mu.Lock()
@@ -285,20 +448,74 @@ func (r *FLVRecorder) WriteMessage(msg *chunk.Message) {
 		}
 	}
 
-	// Track timestamps for duration calculation (use max to handle out-of-order)
-	if r.firstTimestamp < 0 {
-		r.firstTimestamp = int64(msg.Timestamp)
-	}
-	if msg.Timestamp > r.lastTimestamp {
-		r.lastTimestamp = msg.Timestamp
+	// Track timestamps for duration calculation (use max to handle
+	// out-of-order); cue points and timecodes do not extend the recording.
+	ts := msg.Timestamp + r.tsOffset
+	if msg.TypeID != 18 {
+		if r.firstTimestamp < 0 {
+			r.firstTimestamp = int64(ts)
+		}
+		if ts > r.lastTimestamp {
+			r.lastTimestamp = ts
+		}
 	}
 
-	if err := r.writeTagLocked(msg.TypeID, msg.Timestamp, msg.Payload); err != nil {
+	if err := r.writeTagLocked(msg.TypeID, ts, msg.Payload); err != nil {
 		r.logger.Error("recorder tag write failed", "err", err)
 		r.closeLocked()
+		return
+	}
+	r.countFrameLocked(msg.TypeID, msg.Payload)
+}
+
+// countFrameLocked counts an audio (8) or video (9) tag written to the file
+// and notes its codec. Sequence headers are not frames.
+func (r *FLVRecorder) countFrameLocked(tagType uint8, payload []byte) {
+	switch tagType {
+	case 9:
+		if r.videoCodec == "" {
+			if vm, err := ParseVideoMessage(payload); err == nil {
+				r.videoCodec = vm.Codec
+			}
+		}
+		if !IsVideoSequenceHeader(payload) {
+			r.videoFrames++
+		}
+	case 8:
+		if r.audioCodec == "" {
+			if am, err := ParseAudioMessage(payload); err == nil {
+				r.audioCodec = am.Codec
+			}
+		}
+		if !IsAudioSequenceHeader(payload) {
+			r.audioFrames++
+		}
 	}
 }
 
+// Info describes the recording: for an appended file, the whole file.
+func (r *FLVRecorder) Info() RecordingInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return RecordingInfo{
+		Path:        r.path,
+		Duration:    time.Duration(r.durationMillis()) * time.Millisecond,
+		Bytes:       int64(r.bytesWritten),
+		VideoCodec:  r.videoCodec,
+		AudioCodec:  r.audioCodec,
+		VideoFrames: r.videoFrames,
+		AudioFrames: r.audioFrames,
+	}
+}
+
+// durationMillis returns the span between the first and last tag timestamps.
+func (r *FLVRecorder) durationMillis() uint32 {
+	if r.firstTimestamp >= 0 && r.lastTimestamp >= uint32(r.firstTimestamp) {
+		return r.lastTimestamp - uint32(r.firstTimestamp)
+	}
+	return 0
+}
+
 // writeTagLocked writes a single FLV tag and its PreviousTagSize.
 // Tag header (11 bytes):
 //
@@ -372,10 +589,7 @@ func (r *FLVRecorder) patchMetadata() {
 	}
 
 	// Calculate duration in seconds
-	var duration float64
-	if r.firstTimestamp >= 0 && r.lastTimestamp >= uint32(r.firstTimestamp) {
-		duration = float64(r.lastTimestamp-uint32(r.firstTimestamp)) / 1000.0
-	}
+	duration := float64(r.durationMillis()) / 1000.0
 
 	// Patch duration
 	if r.durationOffset > 0 {
@@ -27,6 +27,7 @@ import (
 "log/slog"
 "os"
 "sync"
+"time"
 
 "github.com/alxayo/go-rtmp/internal/rtmp/chunk"
 )
@@ -44,6 +45,7 @@ import (
 type MP4Recorder struct {
 mu           sync.Mutex
 file         *os.File
+path         string
 logger       *slog.Logger
 disabled     bool
 videoSamples []mp4VideoSample // per-video-frame metadata (separate from audio)
@@ -55,6 +57,7 @@ audioCodec   string           // detected audio codec: "AAC", "Opus", "FLAC", "A
 mdatStart    int64            // file offset where mdat box begins
 mdatDataSize int64            // total bytes written to mdat so far
 speexWarned  bool             // flag to warn only once about Speex not being supported
+fileSize     int64            // final file size, set by Close
 }
 
 // mp4VideoSample stores per-frame metadata for the video track.
@@ -92,6 +95,7 @@ return nil, fmt.Errorf("mp4_recorder.create: %w", err)
 
 r := &MP4Recorder{
 file:         f,
+path:         path,
 logger:       logger,
 videoSamples: make([]mp4VideoSample, 0, 512),
 audioSamples: make([]mp4AudioSample, 0, 512),
@@ -142,7 +146,7 @@ r.handleAudioMessage(msg)
 // Enhanced RTMP (IsExHeader=1, byte[0] bit 7 set):
 //   [ExHeader(1B)][FourCC(4B)][CTS?(3B)][NALUs...]
 //   - SequenceStart (pktType=0): config record after FourCC, no CTS
-//   - CodedFrames (pktType=1): 3-byte CTS after FourCC, then NALUs
+//   - CodedFrames (pktType=1): 3-byte CTS after FourCC (AVC/HEVC/VVC only), then data
 //   - CodedFramesX (pktType=3): no CTS, NALUs directly after FourCC
 //
 // Legacy (IsExHeader=0):
@@ -198,7 +202,11 @@ case 0: // SequenceStart — codec configuration record
 r.videoConfig = make([]byte, len(data[5:]))
 copy(r.videoConfig, data[5:])
 
-case 1: // CodedFrames — has 3-byte CTS after FourCC
+case 1: // CodedFrames — 3-byte CTS after FourCC for AVC/HEVC/VVC only
+if !hasCompositionTime(fourCC) {
+r.writeVideoSample(data[5:], msg.Timestamp, 0, isKey)
+return
+}
 if len(data) < 8 {
 return
 }
@@ -413,6 +421,9 @@ if r.file == nil {
 return nil
 }
 defer func() {
+if info, err := r.file.Stat(); err == nil {
+r.fileSize = info.Size()
+}
 r.file.Close()
 r.file = nil
 }()
@@ -438,6 +449,22 @@ return fmt.Errorf("mp4_recorder.moov: %w", err)
 return nil
 }
 
+// Info describes the recording. The duration is the one written to the
+// moov box.
+func (r *MP4Recorder) Info() RecordingInfo {
+r.mu.Lock()
+defer r.mu.Unlock()
+return RecordingInfo{
+Path:        r.path,
+Duration:    time.Duration(r.lastTimestamp()) * time.Millisecond,
+Bytes:       r.fileSize,
+VideoCodec:  r.videoCodec,
+AudioCodec:  r.audioCodec,
+VideoFrames: len(r.videoSamples),
+AudioFrames: len(r.audioSamples),
+}
+}
+
 // lastTimestamp returns the highest timestamp across all samples.
 func (r *MP4Recorder) lastTimestamp() uint32 {
 var last uint32
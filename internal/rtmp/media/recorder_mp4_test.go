@@ -17,6 +17,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
 )
@@ -168,6 +169,12 @@ func TestMP4Recorder_LegacyAAC(t *testing.T) {
 	if !findBoxRecursive(data, "esds") {
 		t.Error("esds box not found in moov")
 	}
+
+	want := RecordingInfo{Path: path, Duration: 46 * time.Millisecond, Bytes: int64(len(data)),
+		VideoCodec: "H265", AudioCodec: "AAC", VideoFrames: 1, AudioFrames: 2}
+	if got := rec.(InfoReporter).Info(); got != want {
+		t.Errorf("Info = %+v, want %+v", got, want)
+	}
 }
 
 // TestMP4Recorder_EnhancedOpus verifies that Opus via Enhanced RTMP produces
@@ -110,6 +110,20 @@ type SegmentedRecorder struct {
 	// disabled is set to true if a fatal error occurred (e.g. nameFn failed,
 	// or creating a segment file failed). Once disabled, all writes are no-ops.
 	disabled bool
+
+	// currentPath is the file path of the current segment.
+	currentPath string
+
+	// OnSegmentClosed, if set, is called with a description of each segment
+	// once it has been finalized (on rotation and on Close). It is called
+	// with the recorder's lock held, so it must not block. Set it before
+	// the first WriteMessage.
+	OnSegmentClosed func(info RecordingInfo)
+
+	// Format is the container of the segments, "flv" or "mp4"; empty
+	// chooses from the codec (see ContainerFormat). Set it before the
+	// first WriteMessage.
+	Format string
 }
 
 // NewSegmentedRecorder creates a segmented recorder that splits media into
@@ -155,8 +169,9 @@ func (s *SegmentedRecorder) WriteMessage(msg *chunk.Message) {
 		return
 	}
 
-	// Only process audio (TypeID=8) and video (TypeID=9) messages.
-	if msg.TypeID != 8 && msg.TypeID != 9 {
+	// Only process audio (TypeID=8) and video (TypeID=9) messages, and cue
+	// points and timecodes (TypeID=18), which go to the open segment.
+	if msg.TypeID != 8 && msg.TypeID != 9 && msg.TypeID != 18 {
 		return
 	}
 
@@ -168,6 +183,13 @@ func (s *SegmentedRecorder) WriteMessage(msg *chunk.Message) {
 		return
 	}
 
+	if msg.TypeID == 18 {
+		if s.current != nil {
+			s.current.WriteMessage(msg)
+		}
+		return
+	}
+
 	// --- Step 1: Cache sequence headers ---
 	// Sequence headers contain codec initialization data (SPS/PPS for video,
 	// AudioSpecificConfig for audio). We cache them so they can be written
@@ -255,6 +277,9 @@ func (s *SegmentedRecorder) Close() error {
 
 	if s.current != nil {
 		err := s.current.Close()
+		if err == nil {
+			s.segmentClosedLocked()
+		}
 		s.current = nil
 		return err
 	}
@@ -290,6 +315,8 @@ func (s *SegmentedRecorder) rotateLocked(newStartTS uint32) {
 				"error", err,
 				"segment", s.segmentCount,
 			)
+		} else {
+			s.segmentClosedLocked()
 		}
 		s.current = nil
 	}
@@ -298,6 +325,22 @@ func (s *SegmentedRecorder) rotateLocked(newStartTS uint32) {
 	s.openSegmentLocked(newStartTS)
 }
 
+// segmentClosedLocked reports the just-finalized current segment to
+// OnSegmentClosed.
+//
+// Must be called with s.mu held.
+func (s *SegmentedRecorder) segmentClosedLocked() {
+	if s.OnSegmentClosed == nil || s.currentPath == "" {
+		return
+	}
+	var info RecordingInfo
+	if r, ok := s.current.(InfoReporter); ok {
+		info = r.Info()
+	}
+	info.Path = s.currentPath
+	s.OnSegmentClosed(info)
+}
+
 // openSegmentLocked creates a new inner recorder for the next segment.
 // It calls the nameFn to get the file path, creates the recorder, increments
 // the segment count, and writes cached sequence headers into the new segment.
@@ -317,9 +360,10 @@ func (s *SegmentedRecorder) openSegmentLocked(startTS uint32) {
 		return
 	}
 
-	// Create the inner recorder (FLV for H.264, MP4 for H.265+).
-	// NewRecorder handles container format selection and file creation.
-	recorder, err := NewRecorder(path, s.codec, s.logger, s.meta)
+	// Create the inner recorder (FLV for H.264, MP4 for H.265+, unless
+	// Format says otherwise). NewRecorderFormat handles container format
+	// selection and file creation.
+	recorder, err := NewRecorderFormat(path, s.codec, s.Format, s.logger, s.meta)
 	if err != nil {
 		s.logger.Error("segmented recorder: failed to create segment",
 			"error", err,
@@ -331,6 +375,7 @@ func (s *SegmentedRecorder) openSegmentLocked(startTS uint32) {
 	}
 
 	s.current = recorder
+	s.currentPath = UpdateRecordingPath(path, ContainerFormat(s.codec, s.Format))
 	s.segmentCount++
 	s.segmentStartTS = startTS
 	s.needKeyframe = false
@@ -165,6 +165,34 @@ func TestSegmentedRecorder_BasicRotation(t *testing.T) {
 	}
 }
 
+// TestSegmentedRecorder_OnSegmentClosed verifies that each finished segment
+// is reported once, after it is finalized: on rotation and on Close.
+func TestSegmentedRecorder_OnSegmentClosed(t *testing.T) {
+	dir := t.TempDir()
+	nameFn, _ := makeSegmentNameFn(dir)
+	sr := NewSegmentedRecorder(1000, "H264", nameFn, NullLogger())
+	var closed []string
+	sr.OnSegmentClosed = func(info RecordingInfo) {
+		if info.VideoFrames != 1 || info.VideoCodec != VideoCodecAVC || info.Bytes == 0 {
+			t.Errorf("segment %s: info = %+v", info.Path, info)
+		}
+		closed = append(closed, info.Path)
+	}
+
+	sr.WriteMessage(&chunk.Message{TypeID: 9, Timestamp: 0, Payload: makeVideoKeyframe(0x01), MessageLength: 3})
+	sr.WriteMessage(&chunk.Message{TypeID: 9, Timestamp: 1000, Payload: makeVideoKeyframe(0x02), MessageLength: 3})
+	if len(closed) != 1 || closed[0] != filepath.Join(dir, "seg_1.flv") {
+		t.Fatalf("after rotation: closed = %v", closed)
+	}
+	if err := sr.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	_ = sr.Close()
+	if len(closed) != 2 || closed[1] != filepath.Join(dir, "seg_2.flv") {
+		t.Fatalf("after Close: closed = %v", closed)
+	}
+}
+
 // TestSegmentedRecorder_KeyframeAlignment verifies that rotation does NOT
 // happen on P-frames even when the duration has been exceeded. The recorder
 // must wait for a keyframe to ensure each segment is independently decodable.
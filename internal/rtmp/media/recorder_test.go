@@ -22,7 +22,9 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
 	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
@@ -243,6 +245,46 @@ func TestRecorder_OnMetaDataContent(t *testing.T) {
 	}
 }
 
+// TestRecorder_PublisherMetadataMerged verifies publisher onMetaData
+// properties are written to the file, detected values override them, and
+// duration stays a patchable Number even if the publisher sent one.
+func TestRecorder_PublisherMetadataMerged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "merged.flv")
+	meta := FLVMetadata{Width: 1280, Height: 720, VideoCodecID: 7, Extra: map[string]interface{}{
+		"framerate": 30.0,
+		"encoder":   "obs-output module",
+		"width":     640.0,   // overridden by the detected width
+		"duration":  "bogus", // replaced so it can be patched on Close
+	}}
+	rec, err := NewFLVRecorder(path, NullLogger(), meta)
+	if err != nil {
+		t.Fatalf("NewFLVRecorder: %v", err)
+	}
+	rec.WriteMessage(&chunk.Message{TypeID: 9, Timestamp: 0, Payload: []byte{0x17, 0x01}})
+	rec.WriteMessage(&chunk.Message{TypeID: 9, Timestamp: 2500, Payload: []byte{0x27, 0x01}})
+	rec.Close()
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	dataSize := int(b[14])<<16 | int(b[15])<<8 | int(b[16])
+	values, err := amf.DecodeAll(b[24 : 24+dataSize])
+	if err != nil || len(values) < 2 {
+		t.Fatalf("decode onMetaData: %v", err)
+	}
+	props := values[1].(map[string]interface{})
+	if props["framerate"] != 30.0 || props["encoder"] != "obs-output module" {
+		t.Errorf("publisher properties missing: %v", props)
+	}
+	if props["width"] != 1280.0 || props["height"] != 720.0 {
+		t.Errorf("detected size not preferred: %vx%v", props["width"], props["height"])
+	}
+	if props["duration"] != 2.5 {
+		t.Errorf("duration = %v, want 2.5", props["duration"])
+	}
+}
+
 // TestRecorder_DurationPatching verifies that Close() patches the duration
 // and filesize fields in the onMetaData tag.
 func TestRecorder_DurationPatching(t *testing.T) {
@@ -302,6 +344,62 @@ func TestRecorder_DurationPatching(t *testing.T) {
 	}
 }
 
+// TestRecorder_CuePoints verifies that cue points and onFI timecodes are
+// written as script tags in stream order, other data messages are not, and
+// neither extends the recorded duration.
+func TestRecorder_CuePoints(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cues.flv")
+	rec, err := NewFLVRecorder(path, NullLogger(), FLVMetadata{})
+	if err != nil {
+		t.Fatalf("NewFLVRecorder: %v", err)
+	}
+	cue, _ := amf.EncodeAll("onCuePoint", map[string]interface{}{"type": "scte35"})
+	fi, _ := amf.EncodeAll("onFI", map[string]interface{}{"tc": "10:00:01:12"})
+	text, _ := amf.EncodeAll("onTextData", map[string]interface{}{"text": "hi"})
+	rec.WriteMessage(writeMsg(0, 9, []byte{0x17, 0x00, 0x01}))
+	rec.WriteMessage(writeMsg(1000, 18, cue))
+	rec.WriteMessage(writeMsg(1000, 18, text))
+	rec.WriteMessage(writeMsg(1500, 18, fi))
+	rec.WriteMessage(writeMsg(2000, 9, []byte{0x17, 0x01, 0x02}))
+	rec.WriteMessage(writeMsg(9000, 18, cue))
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer f.Close()
+	fr, err := NewFLVReader(f)
+	if err != nil {
+		t.Fatalf("NewFLVReader: %v", err)
+	}
+	var got []uint32 // timestamps of the script tags after onMetaData
+	for i := 0; ; i++ {
+		tag, err := fr.ReadTag()
+		if err != nil {
+			break
+		}
+		if i > 0 && tag.Type == FLVTagScript {
+			want := cue
+			if tag.Timestamp == 1500 {
+				want = fi
+			}
+			if !bytes.Equal(tag.Data, want) {
+				t.Fatalf("unexpected script tag at %d", tag.Timestamp)
+			}
+			got = append(got, tag.Timestamp)
+		}
+	}
+	if !slices.Equal(got, []uint32{1000, 1500, 9000}) {
+		t.Fatalf("script tags at %v, want [1000 1500 9000]", got)
+	}
+	if d := rec.Info().Duration; d != 2*time.Second {
+		t.Fatalf("duration %v, want 2s from the media tags", d)
+	}
+}
+
 // TestRecorder_ZeroMetadata verifies that when no metadata is provided,
 // onMetaData is still written with zero/default values and recording works.
 func TestRecorder_ZeroMetadata(t *testing.T) {
@@ -412,3 +510,92 @@ func TestRecorder_TimestampOutOfOrder(t *testing.T) {
 		t.Errorf("duration: got %.3f want 3.000", dur)
 	}
 }
+
+// TestRecorder_Append writes a recording, cuts its last tag short as a crash
+// would, and appends to it: the damaged tag is dropped, new timestamps
+// continue after the old ones and the onMetaData covers the whole file.
+func TestRecorder_Append(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "append.flv")
+	rec, err := NewFLVRecorder(path, NullLogger(), FLVMetadata{})
+	if err != nil {
+		t.Fatalf("NewFLVRecorder: %v", err)
+	}
+	rec.WriteMessage(writeMsg(0, 9, []byte{0x17, 0x01, 0x01}))
+	rec.WriteMessage(writeMsg(2000, 9, []byte{0x27, 0x01, 0x02}))
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	f.Write([]byte{9, 0, 0, 50, 0, 0}) // partial tag header
+	f.Close()
+
+	rec, err = AppendFLVRecorder(path, NullLogger(), FLVMetadata{})
+	if err != nil {
+		t.Fatalf("AppendFLVRecorder: %v", err)
+	}
+	rec.WriteMessage(writeMsg(0, 9, []byte{0x17, 0x01, 0x03}))
+	rec.WriteMessage(writeMsg(1000, 8, []byte{0xAF, 0x01, 0x04}))
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	fr, err := NewFLVReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("NewFLVReader: %v", err)
+	}
+	var meta []interface{}
+	var stamps []uint32
+	for {
+		tag, err := fr.ReadTag()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("ReadTag: %v", err)
+		}
+		if tag.Type == FLVTagScript {
+			if meta, err = amf.DecodeAll(tag.Data); err != nil {
+				t.Fatalf("decode onMetaData: %v", err)
+			}
+			continue
+		}
+		stamps = append(stamps, tag.Timestamp)
+	}
+	if want := []uint32{0, 2000, 2001, 3001}; !slices.Equal(stamps, want) {
+		t.Fatalf("timestamps = %v, want %v", stamps, want)
+	}
+	arr := meta[1].(map[string]interface{})
+	if dur := arr["duration"].(float64); math.Abs(dur-3.001) > 0.0001 {
+		t.Errorf("duration: got %.3f want 3.001", dur)
+	}
+	if fs := arr["filesize"].(float64); int(fs) != len(b) {
+		t.Errorf("filesize: got %.0f want %d", fs, len(b))
+	}
+
+	// Info describes the whole file, not just the appended part.
+	want := RecordingInfo{Path: path, Duration: 3001 * time.Millisecond, Bytes: int64(len(b)),
+		VideoCodec: VideoCodecAVC, AudioCodec: AudioCodecAAC, VideoFrames: 3, AudioFrames: 1}
+	if got := rec.Info(); got != want {
+		t.Errorf("Info = %+v, want %+v", got, want)
+	}
+}
+
+// TestRecorder_AppendMissingFile verifies that appending to a file that
+// does not exist yet starts a new recording.
+func TestRecorder_AppendMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "new.flv")
+	rec, err := AppendFLVRecorder(path, NullLogger(), FLVMetadata{})
+	if err != nil {
+		t.Fatalf("AppendFLVRecorder: %v", err)
+	}
+	rec.WriteMessage(writeMsg(40, 9, []byte{0x17, 0x01, 0x01}))
+	rec.Close()
+	b, _ := os.ReadFile(path)
+	if len(b) < 13 || string(b[:3]) != "FLV" {
+		t.Fatalf("no FLV header written")
+	}
+}
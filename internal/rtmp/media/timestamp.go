@@ -0,0 +1,52 @@
+package media
+
+// Timestamp normalization for published streams.
+//
+// RTMP timestamps are 32-bit milliseconds. They roll over after ~49.7 days,
+// and encoders that reconnect (OBS) or restart their clock start again from
+// 0 mid-stream. Passing such jumps through confuses players and corrupts
+// recordings, so the server re-bases each stream's timestamps onto its own
+// monotonic timeline before fan-out.
+
+// Discontinuity thresholds in milliseconds. A backward step larger than
+// MaxTimestampRegression or a forward step larger than MaxTimestampJump is
+// treated as a timestamp reset rather than real elapsed time. Smaller
+// backward steps are normal audio/video interleaving and pass through.
+const (
+	MaxTimestampRegression = 1000
+	MaxTimestampJump       = 10_000
+)
+
+// TimestampNormalizer maps incoming timestamps onto a monotonic timeline.
+// Deltas are taken modulo 2^32, so a 32-bit rollover is an ordinary small
+// step; a discontinuity continues from the highest timestamp emitted so
+// far. The zero value is ready to use. It is not safe for concurrent use.
+type TimestampNormalizer struct {
+	started bool
+	lastIn  uint32 // last timestamp received
+	lastOut int64  // last timestamp emitted (not wrapped)
+	maxOut  int64  // highest timestamp emitted
+}
+
+// Normalize returns the re-based timestamp for ts and whether a
+// discontinuity was smoothed over. The first timestamp is kept as is.
+func (n *TimestampNormalizer) Normalize(ts uint32) (uint32, bool) {
+	if !n.started {
+		n.started = true
+		n.lastIn, n.lastOut, n.maxOut = ts, int64(ts), int64(ts)
+		return ts, false
+	}
+	delta := int64(int32(ts - n.lastIn))
+	out, rebased := n.lastOut+delta, false
+	if delta < -MaxTimestampRegression || delta > MaxTimestampJump {
+		out, rebased = n.maxOut, true
+	}
+	if out < 0 {
+		out = 0
+	}
+	n.lastIn, n.lastOut = ts, out
+	if out > n.maxOut {
+		n.maxOut = out
+	}
+	return uint32(out), rebased
+}
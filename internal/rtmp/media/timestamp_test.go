@@ -0,0 +1,42 @@
+// timestamp_test.go – tests for TimestampNormalizer.
+//
+// Each case feeds a sequence of publisher timestamps and checks the
+// re-based output: interleaving jitter passes through, while encoder
+// resets and large jumps continue from the highest timestamp emitted.
+package media
+
+import "testing"
+
+func TestTimestampNormalizer(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      []uint32
+		want    []uint32
+		rebases int
+	}{
+		{"monotonic", []uint32{0, 33, 66, 100}, []uint32{0, 33, 66, 100}, 0},
+		{"first timestamp kept", []uint32{5000, 5033}, []uint32{5000, 5033}, 0},
+		{"interleave jitter", []uint32{1000, 1023, 1000, 1046}, []uint32{1000, 1023, 1000, 1046}, 0},
+		{"encoder reset", []uint32{60000, 60033, 0, 33, 66}, []uint32{60000, 60033, 60033, 60066, 60099}, 1},
+		{"forward jump", []uint32{100, 133, 900000, 900033}, []uint32{100, 133, 133, 166}, 1},
+		{"32-bit rollover", []uint32{0xFFFFFFE0, 0xFFFFFFF0, 0x10}, []uint32{0xFFFFFFE0, 0xFFFFFFF0, 0x10}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var n TimestampNormalizer
+			rebases := 0
+			for i, ts := range tt.in {
+				got, rebased := n.Normalize(ts)
+				if rebased {
+					rebases++
+				}
+				if got != tt.want[i] {
+					t.Fatalf("Normalize(%d) #%d = %d, want %d", ts, i, got, tt.want[i])
+				}
+			}
+			if rebases != tt.rebases {
+				t.Fatalf("rebases = %d, want %d", rebases, tt.rebases)
+			}
+		})
+	}
+}
@@ -32,7 +32,7 @@ const (
 
 	// Enhanced RTMP VideoPacketType values (E-RTMP v2 spec)
 	PacketTypeSequenceStart   = "sequence_start"    // Codec configuration record (SPS/PPS/VPS)
-	PacketTypeCodedFrames     = "coded_frames"      // NALUs with 3-byte composition time offset
+	PacketTypeCodedFrames     = "coded_frames"      // Frames; AVC/HEVC/VVC add a 3-byte composition time offset
 	PacketTypeSequenceEnd     = "sequence_end"      // End of stream signal
 	PacketTypeCodedFramesX    = "coded_frames_x"    // NALUs without composition time (DTS==PTS)
 	PacketTypeMetadata        = "metadata"           // AMF-encoded metadata (e.g., colorInfo for HDR)
@@ -164,8 +164,10 @@ func parseEnhancedVideo(data []byte) (*VideoMessage, error) {
 		vm.Payload = data[5:]
 	case videoPacketTypeCodedFrames:
 		vm.PacketType = PacketTypeCodedFrames
-		// CodedFrames includes a 3-byte SI24 composition time offset after FourCC.
-		if len(data) < 8 {
+		// CodedFrames includes a 3-byte SI24 composition time offset after
+		// FourCC, but only for codecs with B-frame reordering; AV1 and VP9
+		// frames start right after the FourCC.
+		if !hasCompositionTime(fourCCStr) || len(data) < 8 {
 			vm.Payload = data[5:]
 		} else {
 			vm.Payload = data[8:] // skip 3-byte composition time
@@ -211,6 +213,18 @@ func parseEnhancedVideo(data []byte) (*VideoMessage, error) {
 	return vm, nil
 }
 
+// hasCompositionTime reports whether Enhanced RTMP CodedFrames packets of
+// the codec with this FourCC carry a composition time offset. The E-RTMP
+// spec adds it for AVC and HEVC (and VVC follows HEVC); AV1, VP9 and VP8
+// have no B-frame reordering and send the frame data directly.
+func hasCompositionTime(fourCC string) bool {
+	switch fourCC {
+	case "avc1", "hvc1", "vvc1":
+		return true
+	}
+	return false
+}
+
 // parseLegacyVideo handles the traditional FLV video tag format (4-bit FrameType + 4-bit CodecID).
 func parseLegacyVideo(data []byte) (*VideoMessage, error) {
 	b0 := data[0]
@@ -299,6 +313,12 @@ func BuildVideoSeqStartPayload(fourCC string, configData []byte) []byte {
 	return payload
 }
 
+// IsVideoKeyframe reports whether raw video tag data is a keyframe (legacy or
+// Enhanced RTMP). Used to resume paused subscribers on a decodable frame.
+func IsVideoKeyframe(data []byte) bool {
+	return isVideoKeyframe(data)
+}
+
 // IsVideoSequenceHeader checks whether raw video tag data represents a sequence header
 // (codec configuration record). This works for both legacy and Enhanced RTMP formats.
 // Used by the stream registry to cache sequence headers for late-joining subscribers.
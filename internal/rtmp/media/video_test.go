@@ -150,10 +150,10 @@ func TestParseVideoMessage_EnhancedAV1SequenceStart(t *testing.T) {
 }
 
 func TestParseVideoMessage_EnhancedVP9CodedFrames(t *testing.T) {
-	// CodedFrames (pktType=1) includes 3-byte composition time after FourCC.
-	compTime := []byte{0x00, 0x00, 0x00} // composition time = 0
-	payload := []byte{0x11, 0x22}
-	tag := buildEnhancedVideoTag(2, 1, "vp09", append(compTime, payload...)) // inter, CodedFrames
+	// CodedFrames (pktType=1) carries a composition time only for AVC, HEVC
+	// and VVC; a VP9 frame starts right after the FourCC.
+	payload := []byte{0x86, 0x00, 0x40}
+	tag := buildEnhancedVideoTag(2, 1, "vp09", payload) // inter, CodedFrames
 	m, err := ParseVideoMessage(tag)
 	if err != nil {
 		_tFatalf(t, "unexpected error: %v", err)
@@ -167,9 +167,8 @@ func TestParseVideoMessage_EnhancedVP9CodedFrames(t *testing.T) {
 	if m.PacketType != PacketTypeCodedFrames {
 		_tFatalf(t, "packetType mismatch want coded_frames got %s", m.PacketType)
 	}
-	// Payload should exclude the 3-byte composition time
-	if len(m.Payload) != 2 || m.Payload[0] != 0x11 {
-		_tFatalf(t, "payload mismatch (should skip comp time): %+v", m.Payload)
+	if len(m.Payload) != 3 || m.Payload[0] != 0x86 {
+		_tFatalf(t, "payload mismatch (no comp time to skip): %+v", m.Payload)
 	}
 }
 
@@ -198,11 +197,10 @@ func TestParseVideoMessage_EnhancedVP8SequenceStart(t *testing.T) {
 }
 
 // TestParseVideoMessage_EnhancedVP8CodedFrames verifies that VP8 coded frames
-// (with 3-byte composition time offset) are parsed correctly.
+// (without a composition time offset) are parsed correctly.
 func TestParseVideoMessage_EnhancedVP8CodedFrames(t *testing.T) {
-	compTime := []byte{0x00, 0x00, 0x00} // composition time = 0
 	payload := []byte{0x33, 0x44}
-	tag := buildEnhancedVideoTag(2, 1, "vp08", append(compTime, payload...)) // inter, CodedFrames
+	tag := buildEnhancedVideoTag(2, 1, "vp08", payload) // inter, CodedFrames
 	m, err := ParseVideoMessage(tag)
 	if err != nil {
 		_tFatalf(t, "unexpected error: %v", err)
@@ -216,8 +214,22 @@ func TestParseVideoMessage_EnhancedVP8CodedFrames(t *testing.T) {
 	if m.PacketType != PacketTypeCodedFrames {
 		_tFatalf(t, "packetType mismatch want coded_frames got %s", m.PacketType)
 	}
-	// Payload should exclude the 3-byte composition time
 	if len(m.Payload) != 2 || m.Payload[0] != 0x33 {
+		_tFatalf(t, "payload mismatch (no comp time to skip): %+v", m.Payload)
+	}
+}
+
+// TestParseVideoMessage_EnhancedHEVCCodedFrames verifies that HEVC coded
+// frames skip their 3-byte composition time offset.
+func TestParseVideoMessage_EnhancedHEVCCodedFrames(t *testing.T) {
+	compTime := []byte{0x00, 0x00, 0x28} // composition time = 40ms
+	payload := []byte{0x00, 0x00, 0x00, 0x02, 0x26, 0x01}
+	tag := buildEnhancedVideoTag(2, 1, "hvc1", append(compTime, payload...)) // inter, CodedFrames
+	m, err := ParseVideoMessage(tag)
+	if err != nil {
+		_tFatalf(t, "unexpected error: %v", err)
+	}
+	if len(m.Payload) != len(payload) || m.Payload[4] != 0x26 {
 		_tFatalf(t, "payload mismatch (should skip comp time): %+v", m.Payload)
 	}
 }
@@ -0,0 +1,134 @@
+package media
+
+// Enhanced RTMP AV1 / VP9 Validation
+// ----------------------------------
+// Codec detection only reads the FourCC; ValidateEnhancedVideo also checks
+// that the body of an av01 or vp09 packet is what the E-RTMP spec says it
+// is, so a malformed configuration record is not cached and replayed to
+// every late-joining player:
+//
+//	av01 SequenceStart: AV1CodecConfigurationRecord (av1C)
+//	    [marker:1=1][version:7=1][seq_profile:3][seq_level_idx_0:5]
+//	    [tier/bit depth/monochrome/subsampling:8][reserved+delay:8]
+//	    [configOBUs...]  (a sequence header OBU when present)
+//	vp09 SequenceStart: VPCodecConfigurationRecord (vpcC with its
+//	    version and flags, as FFmpeg and OBS write it)
+//	    [version=1][flags:24][profile][level][bitDepth:4|chroma:3|range:1]
+//	    [colourPrimaries][transferCharacteristics][matrixCoefficients]
+//	    [codecInitializationDataSize:16][codecInitializationData...]
+//	av01 frames: OBUs, the first with its forbidden bit clear and a
+//	    defined obu_type
+//	vp09 frames: an uncompressed header with frame_marker 0b10; a packet
+//	    flagged as a keyframe must carry a VP9 key frame
+//
+// AV1 and VP9 frames may use CodedFrames or CodedFramesX; neither carries a
+// composition time offset for these codecs (see hasCompositionTime).
+
+import "fmt"
+
+// ValidateEnhancedVideo checks the body of an Enhanced RTMP av01 or vp09
+// video packet: the configuration record of a SequenceStart and the start
+// of the bitstream of CodedFrames/CodedFramesX. Other codecs, legacy
+// packets and other packet types (SequenceEnd, Metadata, Multitrack, ModEx)
+// are not checked and return nil.
+func ValidateEnhancedVideo(data []byte) error {
+	if len(data) < 5 || data[0]>>7 != 1 {
+		return nil
+	}
+	fourCC := string(data[1:5])
+	if fourCC != "av01" && fourCC != "vp09" {
+		return nil
+	}
+	frameType := (data[0] >> 4) & 0x07
+	body := data[5:]
+	switch data[0] & 0x0F {
+	case videoPacketTypeSequenceStart:
+		if fourCC == "av01" {
+			return validateAV1Config(body)
+		}
+		return validateVP9Config(body)
+	case videoPacketTypeCodedFrames, videoPacketTypeCodedFramesX:
+		if len(body) == 0 {
+			return fmt.Errorf("video.validate: empty %s frame", fourCC)
+		}
+		if fourCC == "av01" {
+			return validateAV1Frame(body)
+		}
+		return validateVP9Frame(body, frameType == 1)
+	}
+	return nil
+}
+
+// validateAV1Config checks an AV1CodecConfigurationRecord.
+func validateAV1Config(rec []byte) error {
+	if len(rec) < 4 {
+		return fmt.Errorf("video.validate: av1C record truncated (need 4 bytes, got %d)", len(rec))
+	}
+	if rec[0] != 0x81 {
+		return fmt.Errorf("video.validate: av1C marker/version byte 0x%02x, want 0x81", rec[0])
+	}
+	if profile := rec[1] >> 5; profile > 2 {
+		return fmt.Errorf("video.validate: av1C seq_profile %d out of range", profile)
+	}
+	if len(rec) > 4 {
+		if obuType := (rec[4] >> 3) & 0x0F; rec[4]&0x80 != 0 || obuType != obuTypeSequenceHeader {
+			return fmt.Errorf("video.validate: av1C configOBUs start with OBU 0x%02x, want a sequence header", rec[4])
+		}
+	}
+	return nil
+}
+
+// validateVP9Config checks a VPCodecConfigurationRecord.
+func validateVP9Config(rec []byte) error {
+	if len(rec) < 12 {
+		return fmt.Errorf("video.validate: vpcC record truncated (need 12 bytes, got %d)", len(rec))
+	}
+	if rec[0] != 1 {
+		return fmt.Errorf("video.validate: vpcC version %d, want 1", rec[0])
+	}
+	if profile := rec[4]; profile > 3 {
+		return fmt.Errorf("video.validate: vpcC profile %d out of range", profile)
+	}
+	if depth := rec[6] >> 4; depth != 8 && depth != 10 && depth != 12 {
+		return fmt.Errorf("video.validate: vpcC bit depth %d, want 8, 10 or 12", depth)
+	}
+	if initSize := int(rec[10])<<8 | int(rec[11]); len(rec) < 12+initSize {
+		return fmt.Errorf("video.validate: vpcC codec initialization data truncated (need %d bytes, got %d)", initSize, len(rec)-12)
+	}
+	return nil
+}
+
+// AV1 OBU types used by validation.
+const (
+	obuTypeSequenceHeader uint8 = 1
+	obuTypePadding        uint8 = 15
+)
+
+// validateAV1Frame checks the first OBU header of an AV1 frame. Types 0 and
+// 9-14 are reserved.
+func validateAV1Frame(obus []byte) error {
+	if obus[0]&0x80 != 0 {
+		return fmt.Errorf("video.validate: av01 OBU header 0x%02x has the forbidden bit set", obus[0])
+	}
+	if obuType := (obus[0] >> 3) & 0x0F; obuType == 0 || (obuType > 8 && obuType < obuTypePadding) {
+		return fmt.Errorf("video.validate: av01 OBU type %d is reserved", obuType)
+	}
+	return nil
+}
+
+// validateVP9Frame checks the uncompressed header of the first VP9 frame.
+func validateVP9Frame(frame []byte, keyframe bool) error {
+	if marker := frame[0] >> 6; marker != 0x02 {
+		return fmt.Errorf("video.validate: vp09 frame_marker %d, want 2", marker)
+	}
+	// show_existing_frame (bit 3) and frame_type (bit 2) sit one bit lower
+	// in profile 3, which carries an extra reserved bit.
+	hdr := frame[0]
+	if hdr&0x30 == 0x30 {
+		hdr <<= 1
+	}
+	if keyframe && hdr&0x0C != 0 {
+		return fmt.Errorf("video.validate: vp09 packet flagged as a keyframe carries a non-key frame")
+	}
+	return nil
+}
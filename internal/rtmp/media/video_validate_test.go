@@ -0,0 +1,149 @@
+package media
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Golden Enhanced RTMP payloads in the layout FFmpeg's FLV muxer and OBS's
+// enhanced output send: a 1080p AV1 main profile and a VP9 profile 0
+// stream, each with its sequence start, a keyframe and an inter frame.
+var (
+	goldenAV1SequenceStart = []byte{
+		0x90, 'a', 'v', '0', '1', // keyframe, SequenceStart
+		0x81, 0x08, 0x0C, 0x00, // av1C: version 1, main profile level 4.0, 8-bit 4:2:0
+		0x0A, 0x0B, // configOBUs: sequence header OBU, 11 bytes
+		0x00, 0x00, 0x00, 0x4A, 0xAB, 0xBF, 0xC3, 0x77, 0x6B, 0xE4, 0x40,
+	}
+	goldenAV1Keyframe = []byte{
+		0x91, 'a', 'v', '0', '1', // keyframe, CodedFrames (no composition time)
+		0x0A, 0x0B, 0x00, 0x00, 0x00, 0x4A, 0xAB, 0xBF, 0xC3, 0x77, 0x6B, 0xE4, 0x40,
+		0x32, 0x06, 0x10, 0x00, 0x48, 0x02, 0x40, 0x80, // frame OBU, KEY_FRAME
+	}
+	goldenAV1InterFrame = []byte{
+		0xA3, 'a', 'v', '0', '1', // inter, CodedFramesX
+		0x32, 0x05, 0x30, 0x03, 0xC0, 0x15, 0x20, // frame OBU, INTER_FRAME
+	}
+	goldenVP9SequenceStart = []byte{
+		0x90, 'v', 'p', '0', '9', // keyframe, SequenceStart
+		0x01, 0x00, 0x00, 0x00, // vpcC version 1, flags 0
+		0x00, 0x28, 0x82, // profile 0, level 4.0, 8-bit, 4:2:0 colocated, limited range
+		0x02, 0x02, 0x02, // colour primaries, transfer, matrix: unspecified
+		0x00, 0x00, // no codec initialization data
+	}
+	goldenVP9Keyframe = []byte{
+		0x91, 'v', 'p', '0', '9', // keyframe, CodedFrames
+		0x82, 0x49, 0x83, 0x42, 0x00, 0x77, 0xF0, 0x43, 0x76, // key frame, sync code, 1920x1080
+	}
+	goldenVP9InterFrame = []byte{
+		0xA1, 'v', 'p', '0', '9', // inter, CodedFrames
+		0x86, 0x00, 0x40, 0x92, 0x88, 0x2C, // non-key frame
+	}
+)
+
+func TestValidateEnhancedVideoGolden(t *testing.T) {
+	for name, p := range map[string][]byte{
+		"av1 sequence start": goldenAV1SequenceStart,
+		"av1 keyframe":       goldenAV1Keyframe,
+		"av1 inter":          goldenAV1InterFrame,
+		"vp9 sequence start": goldenVP9SequenceStart,
+		"vp9 keyframe":       goldenVP9Keyframe,
+		"vp9 inter":          goldenVP9InterFrame,
+		"hevc not checked":   {0x91, 'h', 'v', 'c', '1', 0xFF},
+		"legacy not checked": {0x17, 0x01, 0x00},
+	} {
+		if err := ValidateEnhancedVideo(p); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	// Neither codec carries a composition time, so the parsed payload is
+	// the bitstream itself.
+	for _, p := range [][]byte{goldenAV1Keyframe, goldenVP9Keyframe} {
+		vm, err := ParseVideoMessage(p)
+		if err != nil || !bytes.Equal(vm.Payload, p[5:]) || vm.FrameType != VideoFrameTypeKey {
+			t.Fatalf("ParseVideoMessage(% x) = %+v, %v", p[:5], vm, err)
+		}
+	}
+}
+
+func TestValidateEnhancedVideoInvalid(t *testing.T) {
+	with := func(p []byte, i int, b byte) []byte {
+		p = bytes.Clone(p)
+		p[i] = b
+		return p
+	}
+	for name, p := range map[string][]byte{
+		"av1C truncated":          goldenAV1SequenceStart[:7],
+		"av1C version 0":          with(goldenAV1SequenceStart, 5, 0x80),
+		"av1C frame OBU":          with(goldenAV1SequenceStart, 9, 0x32),
+		"av1 forbidden bit":       with(goldenAV1InterFrame, 5, 0xB2),
+		"av1 reserved OBU type":   with(goldenAV1InterFrame, 5, 0x52),
+		"av1 empty frame":         goldenAV1InterFrame[:5],
+		"vpcC truncated":          goldenVP9SequenceStart[:13],
+		"vpcC version 0":          with(goldenVP9SequenceStart, 5, 0x00),
+		"vpcC bit depth 9":        with(goldenVP9SequenceStart, 11, 0x92),
+		"vpcC init data missing":  with(goldenVP9SequenceStart, 16, 0x04),
+		"vp9 frame marker":        with(goldenVP9InterFrame, 5, 0x46),
+		"vp9 keyframe flag lying": with(goldenVP9InterFrame, 0, 0x91),
+	} {
+		if err := ValidateEnhancedVideo(p); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+// TestRecorder_EnhancedFLV records AV1 and VP9 to FLV: the tags are the
+// Enhanced RTMP payloads as received, and onMetaData names the codec by
+// FourCC.
+func TestRecorder_EnhancedFLV(t *testing.T) {
+	if ContainerFormat(VideoCodecAV1, "") != "mp4" || ContainerFormat(VideoCodecAV1, "flv") != "flv" || ContainerFormat(VideoCodecAVC, "mp4") != "mp4" {
+		t.Fatal("ContainerFormat does not honour the forced format")
+	}
+	for codec, tags := range map[string][][]byte{
+		VideoCodecAV1: {goldenAV1SequenceStart, goldenAV1Keyframe, goldenAV1InterFrame},
+		VideoCodecVP9: {goldenVP9SequenceStart, goldenVP9Keyframe, goldenVP9InterFrame},
+	} {
+		path := filepath.Join(t.TempDir(), "enhanced.flv")
+		w, err := NewRecorderFormat(path, codec, "flv", NullLogger(), FLVMetadata{VideoCodecID: VideoCodecFLVID(codec)})
+		if err != nil {
+			t.Fatalf("NewRecorderFormat: %v", err)
+		}
+		for i, p := range tags {
+			w.WriteMessage(writeMsg(uint32(i*40), 9, p))
+		}
+		rec := w.(*FLVRecorder)
+		if err := rec.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+		if info := rec.Info(); info.VideoCodec != codec || info.VideoFrames != 2 {
+			t.Fatalf("%s: info %+v", codec, info)
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		fr, err := NewFLVReader(f)
+		if err != nil {
+			t.Fatalf("NewFLVReader: %v", err)
+		}
+		meta, err := fr.ReadTag()
+		if err != nil {
+			t.Fatalf("read onMetaData: %v", err)
+		}
+		props, _ := ParseOnMetaData(meta.Data)
+		if props["videocodecid"] != VideoCodecFLVID(codec) {
+			t.Fatalf("%s: videocodecid %v", codec, props["videocodecid"])
+		}
+		for i, want := range tags {
+			tag, err := fr.ReadTag()
+			if err != nil || tag.Type != FLVTagVideo || !bytes.Equal(tag.Data, want) {
+				t.Fatalf("%s: tag %d = %+v, %v", codec, i, tag, err)
+			}
+		}
+		f.Close()
+	}
+}
@@ -0,0 +1,86 @@
+package metrics
+
+// Latency Windows
+// ===============
+// A LatencyWindow keeps the most recent delivery latencies (time from a
+// media message arriving from its publisher to it being written to a
+// subscriber or relay destination) and reports percentiles over them.
+// Windows are fixed size, so memory stays bounded and the percentiles
+// follow current conditions rather than the whole session.
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// LatencyWindowSize is how many recent samples a LatencyWindow keeps.
+const LatencyWindowSize = 512
+
+// LatencyWindow is a concurrency-safe ring of recent latency samples.
+// The zero value is ready to use.
+type LatencyWindow struct {
+	mu      sync.Mutex
+	samples [LatencyWindowSize]time.Duration
+	n       int // samples stored (≤ LatencyWindowSize)
+	next    int // ring write position
+}
+
+// Observe records one latency sample.
+func (w *LatencyWindow) Observe(d time.Duration) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	w.samples[w.next] = d
+	w.next = (w.next + 1) % LatencyWindowSize
+	if w.n < LatencyWindowSize {
+		w.n++
+	}
+	w.mu.Unlock()
+}
+
+// appendTo appends the stored samples to dst.
+func (w *LatencyWindow) appendTo(dst []time.Duration) []time.Duration {
+	if w == nil {
+		return dst
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append(dst, w.samples[:w.n]...)
+}
+
+// LatencyStats summarises latency samples in milliseconds.
+type LatencyStats struct {
+	Samples int     `json:"samples"`
+	P50Ms   float64 `json:"p50_ms"`
+	P95Ms   float64 `json:"p95_ms"`
+	P99Ms   float64 `json:"p99_ms"`
+}
+
+// Stats returns percentiles over the window's samples.
+func (w *LatencyWindow) Stats() LatencyStats { return MergeLatency(w) }
+
+// MergeLatency returns percentiles over the samples of all windows
+// together (nil windows are skipped). Samples is 0 when there are none.
+func MergeLatency(windows ...*LatencyWindow) LatencyStats {
+	var all []time.Duration
+	for _, w := range windows {
+		all = w.appendTo(all)
+	}
+	if len(all) == 0 {
+		return LatencyStats{}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+	pct := func(p float64) float64 {
+		i := int(p*float64(len(all))+0.5) - 1
+		if i < 0 {
+			i = 0
+		}
+		if i >= len(all) {
+			i = len(all) - 1
+		}
+		return float64(all[i]) / float64(time.Millisecond)
+	}
+	return LatencyStats{Samples: len(all), P50Ms: pct(0.50), P95Ms: pct(0.95), P99Ms: pct(0.99)}
+}
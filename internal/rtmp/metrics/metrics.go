@@ -11,15 +11,19 @@ package metrics
 //   - RecordingsActive
 //
 // Counters (monotonically increasing):
-//   - ConnectionsTotal, PublishersTotal, SubscribersTotal
+//   - ConnectionsTotal, PublishersTotal, SubscribersTotal, StreamsCollectedTotal
 //   - MessagesAudio, MessagesVideo, BytesIngested, BytesEgress
 //   - SubscriberDropsTotal, AuthSuccessesTotal, AuthFailuresTotal
 //   - HandshakeFailuresTotal, RecordingErrorsTotal, ZombieConnectionsTotal
+//   - RecordingMessagesDropped
+//   - ProtocolLimitViolationsTotal
 //   - RelayMessagesSent, RelayMessagesDropped, RelayBytesSent
+//   - HookEventsDelivered, HookEventsDropped (HookEventsQueued is a gauge)
 //
 // Dynamic endpoints (expvar.Func, computed per HTTP request):
 //   - rtmp_streams: per-stream JSON (key, subscribers, codecs, uptime)
 //   - rtmp_relay_destinations: per-destination JSON (url, status, metrics)
+//   - rtmp_registry: stream registry size by state, and empty streams
 
 import (
 	"expvar"
@@ -42,6 +46,10 @@ var (
 
 var (
 	StreamsActive = expvar.NewInt("rtmp_streams_active")
+
+	// StreamsCollectedTotal counts streams removed from the registry after
+	// staying without publisher and subscribers (counter).
+	StreamsCollectedTotal = expvar.NewInt("rtmp_streams_collected_total")
 )
 
 // ── Publisher metrics ───────────────────────────────────────────────
@@ -86,12 +94,20 @@ var (
 var (
 	RecordingsActive     = expvar.NewInt("rtmp_recordings_active")
 	RecordingErrorsTotal = expvar.NewInt("rtmp_recording_errors_total")
+
+	// RecordingMessagesDropped counts media messages not recorded because
+	// a recorder's write queue was full (counter).
+	RecordingMessagesDropped = expvar.NewInt("rtmp_recording_messages_dropped")
 )
 
 // ── Connection health metrics ───────────────────────────────────────
 
 var (
 	ZombieConnectionsTotal = expvar.NewInt("rtmp_zombie_connections_total")
+
+	// ProtocolLimitViolationsTotal counts connections dropped for exceeding
+	// message size or chunk stream limits (counter).
+	ProtocolLimitViolationsTotal = expvar.NewInt("rtmp_protocol_limit_violations_total")
 )
 
 // ── Relay metrics ───────────────────────────────────────────────────
@@ -102,6 +118,21 @@ var (
 	RelayBytesSent       = expvar.NewInt("rtmp_relay_bytes_sent")
 )
 
+// ── Hook queue metrics ──────────────────────────────────────────────
+
+var (
+	// HookEventsQueued is the number of hook events waiting for delivery
+	// across all delivery queues (gauge).
+	HookEventsQueued = expvar.NewInt("rtmp_hook_events_queued")
+
+	// HookEventsDelivered counts queued hook events delivered (counter).
+	HookEventsDelivered = expvar.NewInt("rtmp_hook_events_delivered")
+
+	// HookEventsDropped counts queued hook events evicted for exceeding the
+	// queue's size or age limit (counter).
+	HookEventsDropped = expvar.NewInt("rtmp_hook_events_dropped")
+)
+
 // ── SRT metrics ─────────────────────────────────────────────────────
 
 var (
@@ -132,8 +163,11 @@ var snapshotMu sync.RWMutex
 // streamSnapshotFn and relaySnapshotFn hold the registered providers.
 // The expvar.Func wrappers (registered once in init) delegate to these.
 var (
-	streamSnapshotFn func() interface{}
-	relaySnapshotFn  func() interface{}
+	streamSnapshotFn      func() interface{}
+	relaySnapshotFn       func() interface{}
+	streamGroupSnapshotFn func() interface{}
+	transcodeSnapshotFn   func() interface{}
+	registrySnapshotFn    func() interface{}
 )
 
 // RegisterStreamSnapshot sets the function that returns per-stream info
@@ -154,6 +188,33 @@ func RegisterRelaySnapshot(fn func() interface{}) {
 	relaySnapshotFn = fn
 }
 
+// RegisterStreamGroupSnapshot sets the function that returns multi-bitrate
+// stream groups (logical stream → variants) as a JSON-serializable value.
+// Safe to call multiple times.
+func RegisterStreamGroupSnapshot(fn func() interface{}) {
+	snapshotMu.Lock()
+	defer snapshotMu.Unlock()
+	streamGroupSnapshotFn = fn
+}
+
+// RegisterTranscodeSnapshot sets the function that returns per-stream
+// transcoder process status as a JSON-serializable value. Safe to call
+// multiple times.
+func RegisterTranscodeSnapshot(fn func() interface{}) {
+	snapshotMu.Lock()
+	defer snapshotMu.Unlock()
+	transcodeSnapshotFn = fn
+}
+
+// RegisterRegistrySnapshot sets the function that returns the stream
+// registry's size by state as a JSON-serializable value. Safe to call
+// multiple times.
+func RegisterRegistrySnapshot(fn func() interface{}) {
+	snapshotMu.Lock()
+	defer snapshotMu.Unlock()
+	registrySnapshotFn = fn
+}
+
 func init() {
 	expvar.Publish("rtmp_uptime_seconds", expvar.Func(func() interface{} {
 		return int64(time.Since(startTime).Seconds())
@@ -187,4 +248,34 @@ func init() {
 		}
 		return fn()
 	}))
+
+	expvar.Publish("rtmp_stream_groups", expvar.Func(func() interface{} {
+		snapshotMu.RLock()
+		fn := streamGroupSnapshotFn
+		snapshotMu.RUnlock()
+		if fn == nil {
+			return []interface{}{}
+		}
+		return fn()
+	}))
+
+	expvar.Publish("rtmp_transcoders", expvar.Func(func() interface{} {
+		snapshotMu.RLock()
+		fn := transcodeSnapshotFn
+		snapshotMu.RUnlock()
+		if fn == nil {
+			return []interface{}{}
+		}
+		return fn()
+	}))
+
+	expvar.Publish("rtmp_registry", expvar.Func(func() interface{} {
+		snapshotMu.RLock()
+		fn := registrySnapshotFn
+		snapshotMu.RUnlock()
+		if fn == nil {
+			return map[string]int{}
+		}
+		return fn()
+	}))
 }
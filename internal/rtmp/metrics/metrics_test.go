@@ -8,6 +8,7 @@ import (
 	"runtime"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestCountersInitializedToZero(t *testing.T) {
@@ -115,6 +116,8 @@ func TestExpvarHandlerContainsRTMPKeys(t *testing.T) {
 		"rtmp_connections_total",
 		// Stream metrics
 		"rtmp_streams_active",
+		"rtmp_streams_collected_total",
+		"rtmp_registry",
 		// Publisher metrics
 		"rtmp_publishers_active",
 		"rtmp_publishers_total",
@@ -135,6 +138,7 @@ func TestExpvarHandlerContainsRTMPKeys(t *testing.T) {
 		// Recording metrics
 		"rtmp_recordings_active",
 		"rtmp_recording_errors_total",
+		"rtmp_recording_messages_dropped",
 		// Connection health
 		"rtmp_zombie_connections_total",
 		// Relay metrics
@@ -196,3 +200,59 @@ func TestRegisterRelaySnapshot(t *testing.T) {
 		t.Errorf("rtmp_relay_destinations should contain destination URL, got %s", raw)
 	}
 }
+
+func TestRegisterStreamGroupSnapshot(t *testing.T) {
+	RegisterStreamGroupSnapshot(func() interface{} {
+		return []map[string]interface{}{{"group": "live/show", "variants": []string{"480p", "720p"}}}
+	})
+
+	v := expvar.Get("rtmp_stream_groups")
+	if v == nil {
+		t.Fatal("rtmp_stream_groups not registered")
+	}
+	if raw := v.String(); !strings.Contains(raw, "live/show") || !strings.Contains(raw, "720p") {
+		t.Errorf("rtmp_stream_groups should contain group and variants, got %s", raw)
+	}
+}
+
+func TestRegisterRegistrySnapshot(t *testing.T) {
+	RegisterRegistrySnapshot(func() interface{} {
+		return map[string]int{"streams": 3, "empty": 1}
+	})
+
+	v := expvar.Get("rtmp_registry")
+	if v == nil {
+		t.Fatal("rtmp_registry not registered")
+	}
+	if raw := v.String(); !strings.Contains(raw, `"streams":3`) || !strings.Contains(raw, `"empty":1`) {
+		t.Errorf("rtmp_registry should contain the registry counts, got %s", raw)
+	}
+}
+
+func TestLatencyWindow(t *testing.T) {
+	var w LatencyWindow
+	if s := w.Stats(); s.Samples != 0 {
+		t.Fatalf("empty window stats = %+v", s)
+	}
+	for i := 1; i <= 100; i++ {
+		w.Observe(time.Duration(i) * time.Millisecond)
+	}
+	s := w.Stats()
+	if s.Samples != 100 || s.P50Ms != 50 || s.P95Ms != 95 || s.P99Ms != 99 {
+		t.Fatalf("stats = %+v", s)
+	}
+
+	// The window keeps only the most recent samples.
+	for i := 0; i < LatencyWindowSize; i++ {
+		w.Observe(time.Second)
+	}
+	if s := w.Stats(); s.Samples != LatencyWindowSize || s.P50Ms != 1000 {
+		t.Fatalf("stats after wrap = %+v", s)
+	}
+
+	var other LatencyWindow
+	other.Observe(time.Millisecond)
+	if s := MergeLatency(&w, &other, nil); s.Samples != LatencyWindowSize+1 {
+		t.Fatalf("merged samples = %d", s.Samples)
+	}
+}
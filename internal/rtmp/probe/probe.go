@@ -0,0 +1,306 @@
+// File: probe.go
+// Purpose: Analyzes the messages a player receives from a stream and
+// summarizes its health: codecs, resolution, bitrate, frame rate, keyframe
+// interval, timestamp continuity and an estimate of lost frames. It backs
+// cmd/rtmp-probe, a health check for monitoring systems, and works on any
+// message source (a client playing the stream, a recording read back).
+//
+// Key Types:
+//   - Analyzer: Accumulates messages one at a time (not safe for concurrent use)
+//   - Report: The JSON-friendly summary returned by Analyzer.Report
+//
+// Lost frames are estimated from timestamp gaps: a track's typical frame
+// interval is the median of its timestamp deltas, and a delta of more than
+// 1.5 intervals counts the frames that would have fit in it. Sequence
+// headers are not frames and are not counted. Resolution comes from the
+// H.264 SPS in the video sequence header, or from onMetaData for other
+// codecs.
+package probe
+
+import (
+	"math"
+	"slices"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/media"
+	"github.com/alxayo/go-rtmp/internal/rtmp/rpc"
+)
+
+// Message type IDs the analyzer looks at.
+const (
+	typeAudio      = 8
+	typeVideo      = 9
+	typeDataAMF0   = 18
+	typeCommandAMF = 20
+)
+
+// gapFactor is how many typical intervals a delta must exceed to count as a
+// gap with lost frames.
+const gapFactor = 1.5
+
+// Report summarizes what a player received.
+type Report struct {
+	Stream      string                 `json:"stream"`
+	DurationSec float64                `json:"duration_s"`       // wall-clock time played
+	Status      []string               `json:"status,omitempty"` // onStatus codes received, in order
+	Video       *VideoReport           `json:"video,omitempty"`  // nil when no video arrived
+	Audio       *AudioReport           `json:"audio,omitempty"`  // nil when no audio arrived
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// VideoReport describes the video track.
+type VideoReport struct {
+	Codec               string          `json:"codec"`
+	Width               int             `json:"width,omitempty"`
+	Height              int             `json:"height,omitempty"`
+	Frames              int             `json:"frames"`
+	Keyframes           int             `json:"keyframes"`
+	FrameRate           float64         `json:"fps"`
+	BitrateKbps         float64         `json:"bitrate_kbps"`
+	KeyframeIntervalSec float64         `json:"keyframe_interval_s,omitempty"`     // mean time between keyframes
+	MaxKeyframeInterval float64         `json:"max_keyframe_interval_s,omitempty"` // longest time between keyframes
+	Timestamps          TimestampReport `json:"timestamps"`
+}
+
+// AudioReport describes the audio track.
+type AudioReport struct {
+	Codec       string          `json:"codec"`
+	SampleRate  int             `json:"sample_rate,omitempty"`
+	Channels    int             `json:"channels,omitempty"`
+	Frames      int             `json:"frames"`
+	BitrateKbps float64         `json:"bitrate_kbps"`
+	Timestamps  TimestampReport `json:"timestamps"`
+}
+
+// TimestampReport describes the continuity of a track's timestamps.
+type TimestampReport struct {
+	FirstMs        uint32 `json:"first_ms"`
+	LastMs         uint32 `json:"last_ms"`
+	IntervalMs     uint32 `json:"interval_ms"`     // typical (median) delta between frames
+	MaxGapMs       uint32 `json:"max_gap_ms"`      // largest forward delta
+	Backwards      int    `json:"backwards"`       // frames timestamped before the previous one
+	Gaps           int    `json:"gaps"`            // deltas over 1.5 intervals
+	EstimatedDrops int    `json:"estimated_drops"` // frames missing from those gaps
+}
+
+// track accumulates one media track.
+type track struct {
+	codec     string
+	frames    int
+	bytes     int64
+	first     uint32
+	last      uint32
+	deltas    []uint32 // forward deltas between consecutive frames
+	backwards int
+	keyframes []uint32 // video keyframe timestamps
+}
+
+func (t *track) add(ts uint32, size int) {
+	if t.frames > 0 {
+		if ts < t.last {
+			t.backwards++
+		} else {
+			t.deltas = append(t.deltas, ts-t.last)
+		}
+	} else {
+		t.first = ts
+	}
+	t.frames++
+	t.bytes += int64(size)
+	t.last = ts
+}
+
+// spanSec is the time the track's timestamps cover.
+func (t *track) spanSec() float64 {
+	if t.last <= t.first {
+		return 0
+	}
+	return float64(t.last-t.first) / 1000
+}
+
+// bitrateKbps is the track's bitrate over its timestamp span, or over
+// elapsed seconds of wall-clock time when the span is empty.
+func (t *track) bitrateKbps(elapsed float64) float64 {
+	span := t.spanSec()
+	if span == 0 {
+		span = elapsed
+	}
+	if span == 0 {
+		return 0
+	}
+	return round(float64(t.bytes) * 8 / 1000 / span)
+}
+
+func (t *track) timestamps() TimestampReport {
+	r := TimestampReport{FirstMs: t.first, LastMs: t.last, Backwards: t.backwards}
+	if len(t.deltas) == 0 {
+		return r
+	}
+	sorted := slices.Clone(t.deltas)
+	slices.Sort(sorted)
+	r.IntervalMs = sorted[len(sorted)/2]
+	r.MaxGapMs = sorted[len(sorted)-1]
+	if r.IntervalMs == 0 {
+		return r
+	}
+	for _, d := range t.deltas {
+		if float64(d) > gapFactor*float64(r.IntervalMs) {
+			r.Gaps++
+			r.EstimatedDrops += int(math.Round(float64(d)/float64(r.IntervalMs))) - 1
+		}
+	}
+	return r
+}
+
+// Analyzer accumulates the messages of one played stream.
+type Analyzer struct {
+	stream     string
+	status     []string
+	failure    string // first onStatus code refusing or failing the play
+	video      track
+	audio      track
+	width      int
+	height     int
+	sampleRate int
+	channels   int
+	metadata   map[string]interface{}
+}
+
+// NewAnalyzer returns an analyzer for the stream named stream.
+func NewAnalyzer(stream string) *Analyzer {
+	return &Analyzer{stream: stream}
+}
+
+// Add records one message received from the stream.
+func (a *Analyzer) Add(m *chunk.Message) {
+	switch m.TypeID {
+	case typeVideo:
+		a.addVideo(m)
+	case typeAudio:
+		a.addAudio(m)
+	case typeDataAMF0:
+		if props, ok := media.ParseOnMetaData(m.Payload); ok {
+			a.metadata = props
+		}
+	case typeCommandAMF:
+		if code, level := statusCode(m.Payload); code != "" {
+			a.status = append(a.status, code)
+			if a.failure == "" && (level == rpc.LevelError || playFailures[code]) {
+				a.failure = code
+			}
+		}
+	}
+}
+
+func (a *Analyzer) addVideo(m *chunk.Message) {
+	vm, err := media.ParseVideoMessage(m.Payload)
+	if err != nil {
+		return
+	}
+	a.video.codec = vm.Codec
+	if media.IsVideoSequenceHeader(m.Payload) {
+		if w, h := media.ExtractVideoMetadata(m.Payload); w > 0 && h > 0 {
+			a.width, a.height = w, h
+		}
+		return
+	}
+	if media.IsVideoKeyframe(m.Payload) {
+		a.video.keyframes = append(a.video.keyframes, m.Timestamp)
+	}
+	a.video.add(m.Timestamp, len(m.Payload))
+}
+
+func (a *Analyzer) addAudio(m *chunk.Message) {
+	am, err := media.ParseAudioMessage(m.Payload)
+	if err != nil {
+		return
+	}
+	a.audio.codec = am.Codec
+	if media.IsAudioSequenceHeader(m.Payload) {
+		if rate, ch, _ := media.ExtractAudioMetadata(m.Payload); rate > 0 {
+			a.sampleRate, a.channels = rate, ch
+		}
+		return
+	}
+	a.audio.add(m.Timestamp, len(m.Payload))
+}
+
+// Report summarizes the messages added so far; elapsedSec is how long the
+// stream was played, used when the timestamps cover no time.
+func (a *Analyzer) Report(elapsedSec float64) Report {
+	r := Report{Stream: a.stream, DurationSec: round(elapsedSec), Status: a.status, Metadata: a.metadata}
+	if a.video.frames > 0 || a.video.codec != "" {
+		v := &VideoReport{
+			Codec:       a.video.codec,
+			Width:       a.width,
+			Height:      a.height,
+			Frames:      a.video.frames,
+			Keyframes:   len(a.video.keyframes),
+			BitrateKbps: a.video.bitrateKbps(elapsedSec),
+			Timestamps:  a.video.timestamps(),
+		}
+		if v.Width == 0 {
+			v.Width, v.Height = metaInt(a.metadata, "width"), metaInt(a.metadata, "height")
+		}
+		if span := a.video.spanSec(); span > 0 {
+			v.FrameRate = round(float64(a.video.frames-1) / span)
+		}
+		if k := a.video.keyframes; len(k) > 1 {
+			var longest uint32
+			for i := 1; i < len(k); i++ {
+				if k[i] > k[i-1] {
+					longest = max(longest, k[i]-k[i-1])
+				}
+			}
+			v.KeyframeIntervalSec = round(float64(k[len(k)-1]-k[0]) / 1000 / float64(len(k)-1))
+			v.MaxKeyframeInterval = round(float64(longest) / 1000)
+		}
+		r.Video = v
+	}
+	if a.audio.frames > 0 || a.audio.codec != "" {
+		r.Audio = &AudioReport{
+			Codec:       a.audio.codec,
+			SampleRate:  a.sampleRate,
+			Channels:    a.channels,
+			Frames:      a.audio.frames,
+			BitrateKbps: a.audio.bitrateKbps(elapsedSec),
+			Timestamps:  a.audio.timestamps(),
+		}
+	}
+	return r
+}
+
+// playFailures are the onStatus codes that end a play, whatever level the
+// server sends them at.
+var playFailures = map[string]bool{
+	rpc.CodePlayStreamNotFound: true,
+	rpc.CodePlayFailed:         true,
+	rpc.CodePlayUnauthorized:   true,
+}
+
+// Failure returns the code of the first onStatus that refused or failed
+// the play, such as NetStream.Play.StreamNotFound or any error-level
+// status, or "" when there was none.
+func (a *Analyzer) Failure() string { return a.failure }
+
+// statusCode returns the code and level of an onStatus command, or "".
+func statusCode(payload []byte) (code, level string) {
+	vals, err := amf.DecodeAll(payload)
+	if err != nil || len(vals) < 4 || vals[0] != "onStatus" {
+		return "", ""
+	}
+	info, _ := vals[3].(map[string]interface{})
+	code, _ = info["code"].(string)
+	level, _ = info["level"].(string)
+	return code, level
+}
+
+// metaInt returns a numeric onMetaData property as an int.
+func metaInt(props map[string]interface{}, key string) int {
+	n, _ := props[key].(float64)
+	return int(n)
+}
+
+// round rounds to two decimals for readable JSON.
+func round(f float64) float64 { return math.Round(f*100) / 100 }
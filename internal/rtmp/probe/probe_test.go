@@ -0,0 +1,94 @@
+package probe
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/client"
+)
+
+// avcSequenceHeader is an H.264 sequence header with a 640x360 SPS.
+var avcSequenceHeader = []byte{
+	0x17, 0x00, 0, 0, 0, // keyframe, AVC, sequence header
+	0x01, 0x42, 0xC0, 0x1E, 0xFF, 0xE1, 0x00, 0x09, // AVCC record, one SPS of 9 bytes
+	0x67, 0x42, 0xC0, 0x1E, 0xF4, 0x05, 0x01, 0x7B, 0xCA,
+}
+
+func msg(f client.Frame) *chunk.Message {
+	return &chunk.Message{TypeID: f.TypeID, Timestamp: f.Timestamp, Payload: f.Payload}
+}
+
+// TestAnalyzer feeds 10 seconds of a synthetic 25 fps stream with a 2s GOP,
+// minus three video frames, and checks the report.
+func TestAnalyzer(t *testing.T) {
+	a := NewAnalyzer("live/show")
+	status, _ := amf.EncodeAll("onStatus", float64(0), nil, map[string]interface{}{"level": "status", "code": "NetStream.Play.Start"})
+	a.Add(&chunk.Message{TypeID: 20, Payload: status})
+	meta, _ := amf.EncodeAll("onMetaData", map[string]interface{}{"encoder": "test"})
+	a.Add(&chunk.Message{TypeID: 18, Payload: meta})
+	a.Add(&chunk.Message{TypeID: 9, Payload: avcSequenceHeader})
+	a.Add(&chunk.Message{TypeID: 8, Payload: []byte{0xAF, 0x00, 0x12, 0x10}})
+
+	src := &client.SyntheticStream{FPS: 25, VideoBitrate: 1_000_000, KeyframeInterval: 2 * time.Second}
+	video := 0
+	for {
+		f := src.Next()
+		if f.Timestamp > 10_000 {
+			break
+		}
+		if f.TypeID == 9 {
+			video++
+			if video == 60 || video == 61 || video == 120 { // lost on the way
+				continue
+			}
+		}
+		a.Add(msg(f))
+	}
+
+	r := a.Report(10)
+	if len(r.Status) != 1 || r.Status[0] != "NetStream.Play.Start" || a.Failure() != "" || r.Metadata["encoder"] != "test" {
+		t.Fatalf("status %v (failure %q), metadata %v", r.Status, a.Failure(), r.Metadata)
+	}
+	v := r.Video
+	if v == nil || v.Codec != "H264" || v.Width != 640 || v.Height != 360 {
+		t.Fatalf("video = %+v", v)
+	}
+	if v.Frames != 251-3 || v.Keyframes != 6 || v.KeyframeIntervalSec != 2 || v.MaxKeyframeInterval != 2 {
+		t.Fatalf("frames %d, keyframes %d every %vs (max %vs)", v.Frames, v.Keyframes, v.KeyframeIntervalSec, v.MaxKeyframeInterval)
+	}
+	if v.FrameRate < 24 || v.FrameRate > 25 || v.BitrateKbps < 900 || v.BitrateKbps > 1100 {
+		t.Fatalf("fps %v, bitrate %v kbps", v.FrameRate, v.BitrateKbps)
+	}
+	ts := v.Timestamps
+	if ts.IntervalMs != 40 || ts.Gaps != 2 || ts.EstimatedDrops != 3 || ts.MaxGapMs != 120 || ts.Backwards != 0 {
+		t.Fatalf("video timestamps = %+v", ts)
+	}
+
+	au := r.Audio
+	if au == nil || au.Codec != "AAC" || au.SampleRate != 44100 || au.Channels != 2 {
+		t.Fatalf("audio = %+v", au)
+	}
+	if au.Timestamps.Gaps != 0 || au.BitrateKbps < 120 || au.BitrateKbps > 136 {
+		t.Fatalf("audio bitrate %v kbps, timestamps %+v", au.BitrateKbps, au.Timestamps)
+	}
+}
+
+func TestAnalyzerBackwardsAndEmpty(t *testing.T) {
+	a := NewAnalyzer("live/show")
+	if r := a.Report(5); r.Video != nil || r.Audio != nil {
+		t.Fatalf("empty report = %+v", r)
+	}
+	for _, ts := range []uint32{0, 40, 80, 20, 60} {
+		a.Add(&chunk.Message{TypeID: 9, Timestamp: ts, Payload: []byte{0x27, 0x01, 0, 0, 0, 0}})
+	}
+	if ts := a.Report(1).Video.Timestamps; ts.Backwards != 1 {
+		t.Fatalf("timestamps = %+v, want one backwards", ts)
+	}
+	notFound, _ := amf.EncodeAll("onStatus", float64(0), nil, map[string]interface{}{"level": "status", "code": "NetStream.Play.StreamNotFound"})
+	a.Add(&chunk.Message{TypeID: 20, Payload: notFound})
+	if a.Failure() != "NetStream.Play.StreamNotFound" {
+		t.Fatalf("Failure() = %q", a.Failure())
+	}
+}
@@ -2,6 +2,7 @@ package relay
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/url"
@@ -9,9 +10,15 @@ import (
 	"time"
 
 	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/media"
 	"github.com/alxayo/go-rtmp/internal/rtmp/metrics"
+	"github.com/alxayo/go-rtmp/internal/telemetry"
 )
 
+// DefaultQueueSize is the number of messages each destination buffers
+// between the publisher and its send goroutine when no size is given.
+const DefaultQueueSize = 512
+
 // RTMPClient defines the interface for connecting to a remote RTMP server
 // and sending media data. This interface exists to decouple the relay system
 // from the concrete client implementation, making it testable with mock clients.
@@ -23,6 +30,20 @@ type RTMPClient interface {
 	Close() error                                     // Disconnect and clean up
 }
 
+// DataSender is implemented by RTMPClients that can send data messages
+// (onMetaData, cue points). Destinations whose client does not implement
+// it are sent audio and video only.
+type DataSender interface {
+	SendData(timestamp uint32, payload []byte) error
+}
+
+// ContextConnector is implemented by RTMPClients whose connect can be
+// cancelled. Closing a destination aborts such a client's connect in
+// progress; other clients finish or time out first.
+type ContextConnector interface {
+	ConnectContext(ctx context.Context) error
+}
+
 // RTMPClientFactory is a constructor function that creates RTMPClient instances.
 // Using a factory allows the relay system to create fresh clients for each
 // destination without knowing the concrete client type.
@@ -64,22 +85,45 @@ type Destination struct {
 	LastError     error               // Most recent error (nil if healthy)
 	Metrics       *DestinationMetrics // Counters for sent/dropped messages and bytes
 	clientFactory RTMPClientFactory   // Creates new client instances for (re)connection
+	stream        string              // Source stream key for destinations resolved from a template ("" = all streams)
+	host          string              // URL host, the only part of the URL put on trace spans (the path holds the stream key)
 
 	// Internal state
 	mu              sync.RWMutex       // protects concurrent access to Status, Client, Metrics
 	reconnectCtx    context.Context    // cancellation context for shutdown signaling
 	reconnectCancel context.CancelFunc // called during Close() to signal shutdown
 	logger          *slog.Logger       // structured logger tagged with destination URL
+
+	latency  metrics.LatencyWindow // ingest-to-send latency of stamped messages
+	sendTime metrics.LatencyWindow // time each client send blocked (TCP backpressure)
+
+	// Send queue, started by the first enqueue. qmu also guards waitKey
+	// and profile, which only the enqueuing side uses.
+	qmu     sync.Mutex
+	queue   chan queuedMessage
+	done    chan struct{} // closed when the send goroutine exits
+	closed  bool
+	waitKey bool     // shedding video until the next keyframe
+	profile *Profile // push profile rewriting what is sent (nil = none)
 }
 
 // DestinationMetrics tracks performance for each destination
 type DestinationMetrics struct {
 	MessagesSent    uint64    // Total messages sent successfully
-	MessagesDropped uint64    // Messages dropped due to errors
+	MessagesDropped uint64    // Messages dropped due to errors or a full queue
+	QueueDropped    uint64    // Of MessagesDropped, those dropped because the queue was full
 	BytesSent       uint64    // Total bytes transmitted
 	LastSentTime    time.Time // Timestamp of last successful send
 	ConnectTime     time.Time // When connection was established
 	ReconnectCount  uint32    // Number of reconnection attempts
+
+	// Congestion: when the send queue backs up, video inter frames are shed
+	// (up to the next keyframe) while audio and keyframes keep flowing.
+	CongestionDropped uint64        // Of MessagesDropped, video frames shed while congested
+	WriteBlocked      time.Duration // Total time spent blocked in sends
+	Congested         bool          // Currently shedding video (queue at least half full)
+
+	Filtered uint64 // Frames not sent because the push profile excludes their codec (not counted as dropped)
 }
 
 // NewDestination creates a new destination with the given URL
@@ -101,54 +145,78 @@ func NewDestination(rawURL string, logger *slog.Logger, clientFactory RTMPClient
 		Status:          StatusDisconnected,
 		Metrics:         &DestinationMetrics{},
 		clientFactory:   clientFactory,
+		host:            parsedURL.Host,
 		reconnectCtx:    ctx,
 		reconnectCancel: cancel,
 		logger:          logger.With("destination_url", rawURL),
 	}, nil
 }
 
-// Connect establishes connection to the destination RTMP server
+// Connect establishes connection to the destination RTMP server. The
+// network round trips run without holding d.mu, so status and metrics stay
+// readable meanwhile. A connect already in progress is not repeated.
 func (d *Destination) Connect() error {
 	d.mu.Lock()
-	defer d.mu.Unlock()
-
-	if d.Status == StatusConnected {
+	if d.Status == StatusConnected || d.Status == StatusConnecting {
+		d.mu.Unlock()
 		return nil
 	}
-
 	d.Status = StatusConnecting
+	d.mu.Unlock()
+	return d.connect()
+}
+
+// connect connects a destination whose status was set to StatusConnecting.
+func (d *Destination) connect() error {
 	d.logger.Info("Connecting to destination")
 
-	client, err := d.clientFactory(d.URL)
+	client, err := d.dial()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err == nil && d.reconnectCtx.Err() != nil {
+		_ = client.Close() // closed while connecting
+		err = fmt.Errorf("client connect: %w", d.reconnectCtx.Err())
+	}
 	if err != nil {
 		d.Status = StatusError
 		d.LastError = err
+		return err
+	}
+	d.Client = client
+	d.Status = StatusConnected
+	d.Metrics.ConnectTime = time.Now()
+	d.LastError = nil
+	d.logger.Info("Connected to destination")
+	return nil
+}
+
+// dial creates a client and connects and publishes with it. A client that
+// implements ContextConnector connects until the destination is closed.
+func (d *Destination) dial() (RTMPClient, error) {
+	client, err := d.clientFactory(d.URL)
+	if err != nil {
 		d.logger.Error("Failed to create RTMP client", "error", err)
-		return fmt.Errorf("create client: %w", err)
+		return nil, fmt.Errorf("create client: %w", err)
 	}
 
-	if err := client.Connect(); err != nil {
+	if cc, ok := client.(ContextConnector); ok {
+		err = cc.ConnectContext(d.reconnectCtx)
+	} else {
+		err = client.Connect()
+	}
+	if err != nil {
 		_ = client.Close() // prevent leak: factory may have allocated TCP resources
-		d.Status = StatusError
-		d.LastError = err
 		d.logger.Error("Failed to connect RTMP client", "error", err)
-		return fmt.Errorf("client connect: %w", err)
+		return nil, fmt.Errorf("client connect: %w", err)
 	}
 
 	if err := client.Publish(); err != nil {
 		_ = client.Close() // prevent leak: connection established but publish failed
-		d.Status = StatusError
-		d.LastError = err
 		d.logger.Error("Failed to publish to destination", "error", err)
-		return fmt.Errorf("client publish: %w", err)
+		return nil, fmt.Errorf("client publish: %w", err)
 	}
-
-	d.Client = client
-	d.Status = StatusConnected
-	d.Metrics.ConnectTime = time.Now()
-	d.LastError = nil
-	d.logger.Info("Connected to destination")
-	return nil
+	return client, nil
 }
 
 // SendMessage sends a media message to this destination
@@ -167,17 +235,27 @@ func (d *Destination) SendMessage(msg *chunk.Message) error {
 	}
 
 	var err error
+	start := time.Now()
 	switch msg.TypeID {
 	case 8: // Audio message
 		err = client.SendAudio(msg.Timestamp, msg.Payload)
 	case 9: // Video message
 		err = client.SendVideo(msg.Timestamp, msg.Payload)
+	case 18: // Data message (onMetaData, cue points)
+		ds, ok := client.(DataSender)
+		if !ok {
+			return nil
+		}
+		err = ds.SendData(msg.Timestamp, msg.Payload)
 	default:
 		return nil // Skip non-media messages
 	}
+	blocked := time.Since(start)
+	d.sendTime.Observe(blocked)
 
 	if err != nil {
 		d.mu.Lock()
+		d.Metrics.WriteBlocked += blocked
 		d.Status = StatusError
 		d.LastError = err
 		d.Metrics.MessagesDropped++
@@ -187,7 +265,11 @@ func (d *Destination) SendMessage(msg *chunk.Message) error {
 		return fmt.Errorf("send message: %w", err)
 	}
 
+	if !msg.Ingest.IsZero() {
+		d.latency.Observe(time.Since(msg.Ingest))
+	}
 	d.mu.Lock()
+	d.Metrics.WriteBlocked += blocked
 	d.Metrics.MessagesSent++
 	d.Metrics.BytesSent += uint64(len(msg.Payload))
 	d.Metrics.LastSentTime = time.Now()
@@ -197,21 +279,211 @@ func (d *Destination) SendMessage(msg *chunk.Message) error {
 	return nil
 }
 
-// Close disconnects from the destination
-func (d *Destination) Close() error {
+// queuedMessage is a message waiting in a destination's send queue, with
+// the span tracing its send (nil when not traced).
+type queuedMessage struct {
+	msg  *chunk.Message
+	span *telemetry.Span
+}
+
+// enqueue queues a copy of msg for the destination's send goroutine,
+// starting it with a queue of size messages on first use. It never blocks,
+// so one slow destination cannot hold up the publisher, local subscribers
+// or the other destinations.
+//
+// Once the queue is half full the destination is congested: video inter
+// frames are shed up to the next keyframe while audio and keyframes are
+// still queued, and the congestion clears when the queue has drained to a
+// quarter. Messages that find the queue full are dropped; a dropped video
+// frame also sheds video up to the next keyframe.
+//
+// The destination's push profile, if any, is applied first: frames in a
+// codec it excludes are skipped and onMetaData is rewritten.
+//
+// If ctx carries a trace span, the send is traced as its child
+// "rtmp.relay.send" from here until the message is written or dropped.
+func (d *Destination) enqueue(ctx context.Context, msg *chunk.Message, size int) {
+	d.qmu.Lock()
+	defer d.qmu.Unlock()
+	if d.closed {
+		return
+	}
+	if d.queue == nil {
+		d.startLocked(size, false)
+	}
+	if p := d.profile; p != nil {
+		if !p.allows(msg) {
+			d.mu.Lock()
+			d.Metrics.Filtered++
+			d.mu.Unlock()
+			return
+		}
+		out, err := p.rewrite(msg)
+		if err != nil {
+			d.logger.Warn("onMetaData sent unchanged", "error", err)
+		} else {
+			msg = out
+		}
+	}
+	congested := d.updateCongestion()
+	_, span := telemetry.Start(ctx, "rtmp.relay.send",
+		telemetry.String("server.address", d.host),
+		telemetry.Int("rtmp.relay.queued", int64(len(d.queue))),
+		telemetry.Bool("rtmp.relay.congested", congested),
+	)
+	span.SetKind(telemetry.KindClient)
+
+	if msg.TypeID == 9 {
+		if media.IsVideoKeyframe(msg.Payload) {
+			d.waitKey = false
+		} else if d.waitKey || congested {
+			d.waitKey = true
+			d.drop(func(m *DestinationMetrics) { m.CongestionDropped++ })
+			span.RecordError(errCongestionDropped)
+			span.End()
+			return
+		}
+	}
+	cp := msg.Share() // the caller may reuse msg; the payload is never mutated
+	select {
+	case d.queue <- queuedMessage{msg: cp, span: span}:
+	default:
+		cp.Release()
+		if msg.TypeID == 9 {
+			d.waitKey = true
+		}
+		d.drop(func(m *DestinationMetrics) { m.QueueDropped++ })
+		span.RecordError(errQueueFull)
+		span.End()
+	}
+}
+
+// Reasons recorded on the trace span of a message dropped before sending.
+var (
+	errCongestionDropped = errors.New("dropped: destination congested")
+	errQueueFull         = errors.New("dropped: send queue full")
+)
+
+// updateCongestion enters or leaves the congested state from the queue's
+// fill level and reports whether the destination is congested. The queue
+// must have been started.
+func (d *Destination) updateCongestion() bool {
+	n, c := len(d.queue), cap(d.queue)
 	d.mu.Lock()
 	defer d.mu.Unlock()
+	switch {
+	case !d.Metrics.Congested && n >= (c+1)/2:
+		d.Metrics.Congested = true
+		d.logger.Warn("relay destination congested, shedding video inter frames", "queued", n, "queue_size", c)
+	case d.Metrics.Congested && n <= c/4:
+		d.Metrics.Congested = false
+		d.logger.Info("relay destination no longer congested",
+			"queue_dropped", d.Metrics.QueueDropped, "congestion_dropped", d.Metrics.CongestionDropped)
+	}
+	return d.Metrics.Congested
+}
 
-	d.reconnectCancel()
+// connectAsync starts the send goroutine with a queue of size messages and
+// has it connect before sending. Messages relayed meanwhile wait in the
+// queue, so sequence headers still go out first; if connecting fails they
+// are dropped as for a lost connection.
+func (d *Destination) connectAsync(size int) {
+	d.qmu.Lock()
+	defer d.qmu.Unlock()
+	if d.closed || d.queue != nil {
+		return
+	}
+	d.mu.Lock()
+	connected := d.Status == StatusConnected
+	if !connected {
+		d.Status = StatusConnecting
+	}
+	d.mu.Unlock()
+	d.startLocked(size, !connected)
+}
+
+// startLocked starts the send goroutine with a queue of size messages
+// (DefaultQueueSize if size <= 0); with connect set it connects first.
+// The caller holds d.qmu.
+func (d *Destination) startLocked(size int, connect bool) {
+	if size <= 0 {
+		size = DefaultQueueSize
+	}
+	d.queue = make(chan queuedMessage, size)
+	d.done = make(chan struct{})
+	go d.run(connect)
+}
+
+// run sends queued messages until the queue is closed, clearing the
+// congested state once the queue drains. With connect set it connects
+// first. Messages still queued when the destination is closed are
+// discarded.
+func (d *Destination) run(connect bool) {
+	defer close(d.done)
+	if connect {
+		_ = d.connect() // failures are logged and recorded in Status and LastError
+	}
+	for q := range d.queue {
+		if d.reconnectCtx.Err() == nil {
+			q.span.AddEvent("dequeued")
+			q.span.RecordError(d.SendMessage(q.msg)) // failures are logged and counted by SendMessage
+			d.updateCongestion()
+		} else {
+			q.span.RecordError(context.Canceled)
+		}
+		q.span.End()
+		q.msg.Release()
+	}
+}
+
+// drop records a message dropped before it was queued; count attributes
+// it to the reason.
+func (d *Destination) drop(count func(*DestinationMetrics)) {
+	d.mu.Lock()
+	d.Metrics.MessagesDropped++
+	count(d.Metrics)
+	d.mu.Unlock()
+	metrics.RelayMessagesDropped.Add(1)
+}
 
-	if d.Client != nil {
-		err := d.Client.Close()
-		d.Client = nil
+// QueueLen returns the number of messages waiting to be sent.
+func (d *Destination) QueueLen() int {
+	d.qmu.Lock()
+	defer d.qmu.Unlock()
+	return len(d.queue)
+}
+
+// Close disconnects from the destination. Queued messages are discarded;
+// a send in progress is interrupted by closing the client, and Close
+// returns once the send goroutine has exited.
+func (d *Destination) Close() error {
+	d.qmu.Lock()
+	done := d.done
+	if !d.closed {
+		d.closed = true
+		if d.queue != nil {
+			close(d.queue)
+		}
+	}
+	d.qmu.Unlock()
+
+	d.mu.Lock()
+	d.reconnectCancel()
+	client := d.Client
+	d.Client = nil
+	if client != nil {
 		d.Status = StatusDisconnected
-		return err
 	}
+	d.mu.Unlock()
 
-	return nil
+	var err error
+	if client != nil {
+		err = client.Close()
+	}
+	if done != nil {
+		<-done
+	}
+	return err
 }
 
 // GetMetrics returns a copy of current metrics
@@ -14,7 +14,9 @@
 //     (messages sent, bytes sent, dropped messages, reconnect count).
 //   - [DestinationManager]: Coordinates multiple destinations. Its
 //     [DestinationManager.RelayMessage] method fans out each media message
-//     to all connected destinations in parallel.
+//     to all connected destinations without waiting for them: every
+//     destination sends from its own goroutine behind a bounded queue, and
+//     one that falls behind drops messages up to the next keyframe.
 //
 // # Usage
 //
@@ -26,6 +28,29 @@
 // the media dispatch layer, which calls RelayMessage for every audio/video
 // message received from the publisher.
 //
+// # URL templates
+//
+// A destination URL containing {app} or {stream} is a template. It is not
+// connected at startup; [DestinationManager.StartStream] resolves it when a
+// stream is published, and the resulting destination only receives that
+// stream's media via [DestinationManager.RelayStreamMessage].
+//
+//	./rtmp-server -relay-to 'rtmp://backup.example.com/{app}/{stream}'
+//
+// # Push profiles
+//
+// A [Profile] tailors what one platform receives in a simulcast: it
+// rewrites the publisher's onMetaData (a title, removed encoder details)
+// and can restrict the audio and video codecs sent. It applies to the
+// destinations whose URL starts with its prefix; see
+// [DestinationManager.SetProfiles] and profile.go.
+//
+//	./rtmp-server -relay-to rtmp://a.rtmp.youtube.com/live2/KEY \
+//	  -relay-profile 'rtmp://a.rtmp.youtube.com/=set.title=My Show,video-codec=H264'
+//
+// Data messages (onMetaData, cue points) are relayed along with audio and
+// video to clients implementing [DataSender].
+//
 // # Interface
 //
 // [RTMPClient] defines the interface that relay destinations use to connect
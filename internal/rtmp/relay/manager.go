@@ -11,7 +11,12 @@
 //   - NewDestinationManager(urls, logger): Create manager with initial destinations
 //   - (dm *DestinationManager) AddDestination(url): Add new relay target
 //   - (dm *DestinationManager) RemoveDestination(url): Remove relay target
+//   - (dm *DestinationManager) StartStream(key): Resolve URL templates for a new publish
+//   - (dm *DestinationManager) StartStreamWith(key, urls): StartStream plus per-stream URLs
+//   - (dm *DestinationManager) SetQueueSize(n): Per-destination send queue length
+//   - (dm *DestinationManager) SetProfiles(ps): Per-destination push profiles (profile.go)
 //   - (dm *DestinationManager) RelayMessage(msg): Fan-out message to all destinations
+//   - (dm *DestinationManager) RelayStreamMessageContext(ctx, key, msg): Fan-out with send tracing
 //   - (dm *DestinationManager) Close(): Gracefully close all relay connections
 //
 // Dependencies:
@@ -21,16 +26,20 @@
 //   - log/slog: Structured logging
 //
 // Design: Each destination runs independently. If one relay fails, others continue.
-// Messages are buffered (bounded channel) to provide backpressure on slow relays.
+// Every destination sends from its own goroutine fed by a bounded queue, so
+// RelayMessage never waits on the network; a destination that falls behind
+// drops messages up to the next keyframe instead of stalling the publisher.
 // Relay is optional — if no destinations are configured, RelayMessage is a no-op.
 package relay
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"sync"
 
 	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/metrics"
 )
 
 // DestinationManager manages multiple RTMP relay destinations
@@ -39,6 +48,9 @@ type DestinationManager struct {
 	mu            sync.RWMutex
 	logger        *slog.Logger
 	clientFactory RTMPClientFactory
+	templates     []string // URLs with {app}/{stream} placeholders, resolved per publish
+	queueSize     int      // send queue length per destination (0 = DefaultQueueSize)
+	profiles      []Profile
 }
 
 // NewDestinationManager creates a new destination manager
@@ -49,8 +61,18 @@ func NewDestinationManager(destinationURLs []string, logger *slog.Logger, client
 		clientFactory: clientFactory,
 	}
 
-	// Initialize destinations from URLs
+	// Initialize destinations from URLs. Templates are only validated here;
+	// they are connected by StartStream once a publisher's key is known.
 	for _, url := range destinationURLs {
+		if IsTemplate(url) {
+			if _, err := NewDestination(ExpandTemplate(url, "app/stream"), dm.logger, clientFactory); err != nil {
+				dm.logger.Warn("Failed to add destination template", "url", url, "error", err)
+				continue
+			}
+			dm.templates = append(dm.templates, url)
+			dm.logger.Info("Added destination template", "url", url)
+			continue
+		}
 		if err := dm.AddDestination(url); err != nil {
 			dm.logger.Warn("Failed to add destination", "url", url, "error", err)
 			// Continue adding other destinations even if one fails
@@ -73,6 +95,7 @@ func (dm *DestinationManager) AddDestination(url string) error {
 	if err != nil {
 		return fmt.Errorf("create destination: %w", err)
 	}
+	dest.profile = dm.profileFor(url)
 
 	// Connect to the destination
 	if err := dest.Connect(); err != nil {
@@ -86,32 +109,137 @@ func (dm *DestinationManager) AddDestination(url string) error {
 	return nil
 }
 
+// StartStream connects one destination per URL template for a newly
+// published stream and returns a function that closes them again when the
+// publisher goes away. Each destination connects on its own send
+// goroutine, so StartStream does not wait for the remote servers and one
+// slow or unreachable destination delays neither the publish reply nor the
+// others. Media relayed meanwhile, sequence headers first, waits in the
+// destination's queue until it is connected.
+//
+// If a previous publisher of the same key still owns a resolved
+// destination (e.g. it was evicted), that destination is replaced; the
+// previous publisher's stop function then leaves the new one alone.
+func (dm *DestinationManager) StartStream(streamKey string) (stop func()) {
+	return dm.StartStreamWith(streamKey, nil)
+}
+
+// StartStreamWith is StartStream with additional destination URLs for this
+// stream only, such as those of the stream's application. They may contain
+// placeholders like the templates.
+func (dm *DestinationManager) StartStreamWith(streamKey string, urls []string) (stop func()) {
+	tmpls := append(dm.templates[:len(dm.templates):len(dm.templates)], urls...)
+	started := make([]*Destination, 0, len(tmpls))
+	for _, tmpl := range tmpls {
+		url := ExpandTemplate(tmpl, streamKey)
+		dest, err := NewDestination(url, dm.logger, dm.clientFactory)
+		if err != nil {
+			dm.logger.Warn("Failed to resolve destination template", "template", tmpl, "stream_key", streamKey, "error", err)
+			continue
+		}
+		dest.stream = streamKey
+
+		dm.mu.Lock()
+		dest.profile = dm.profileFor(url)
+		size := dm.queueSize
+		old := dm.destinations[url]
+		dm.destinations[url] = dest
+		dm.mu.Unlock()
+		if old != nil {
+			_ = old.Close()
+		}
+		dest.connectAsync(size)
+		started = append(started, dest)
+		dm.logger.Info("Added destination", "url", url, "stream_key", streamKey)
+	}
+
+	return func() {
+		for _, dest := range started {
+			dm.mu.Lock()
+			if dm.destinations[dest.URL] == dest {
+				delete(dm.destinations, dest.URL)
+			}
+			dm.mu.Unlock()
+			if err := dest.Close(); err != nil {
+				dm.logger.Error("Error closing destination", "url", dest.URL, "error", err)
+			}
+		}
+	}
+}
+
+// SetQueueSize sets how many messages each destination buffers before it
+// starts dropping (DefaultQueueSize if n <= 0). It applies to destinations
+// whose first message has not been relayed yet.
+func (dm *DestinationManager) SetQueueSize(n int) {
+	dm.mu.Lock()
+	dm.queueSize = n
+	dm.mu.Unlock()
+}
+
+// SetProfiles sets the push profiles applied to destinations: each
+// destination uses the first profile whose Match prefixes its URL. It
+// applies to existing destinations too.
+func (dm *DestinationManager) SetProfiles(profiles []Profile) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.profiles = append([]Profile(nil), profiles...)
+	for url, dest := range dm.destinations {
+		p := dm.profileFor(url)
+		dest.qmu.Lock()
+		dest.profile = p
+		dest.qmu.Unlock()
+	}
+}
+
+// profileFor returns the first profile matching url, or nil. The caller
+// holds dm.mu.
+func (dm *DestinationManager) profileFor(url string) *Profile {
+	for i := range dm.profiles {
+		if dm.profiles[i].matches(url) {
+			return &dm.profiles[i]
+		}
+	}
+	return nil
+}
+
 // RelayMessage sends a media message to all connected destinations
 func (dm *DestinationManager) RelayMessage(msg *chunk.Message) {
-	if msg == nil || (msg.TypeID != 8 && msg.TypeID != 9) {
-		return // Only relay audio/video messages
+	dm.relay(context.Background(), msg, func(*Destination) bool { return true })
+}
+
+// RelayStreamMessage sends a media message from streamKey to the static
+// destinations and to those resolved from a template for that stream.
+func (dm *DestinationManager) RelayStreamMessage(streamKey string, msg *chunk.Message) {
+	dm.relay(context.Background(), msg, func(d *Destination) bool { return d.stream == "" || d.stream == streamKey })
+}
+
+// RelayStreamMessageContext is RelayStreamMessage for a message whose
+// dispatch is being traced: each destination's send of it is recorded as a
+// child of the span in ctx.
+func (dm *DestinationManager) RelayStreamMessageContext(ctx context.Context, streamKey string, msg *chunk.Message) {
+	dm.relay(ctx, msg, func(d *Destination) bool { return d.stream == "" || d.stream == streamKey })
+}
+
+// relay queues msg on each destination accepted by match. It does not wait
+// for the sends; each destination delivers from its own goroutine.
+func (dm *DestinationManager) relay(ctx context.Context, msg *chunk.Message, match func(*Destination) bool) {
+	if msg == nil || (msg.TypeID != 8 && msg.TypeID != 9 && msg.TypeID != 18) {
+		return // Only relay audio, video and data messages
 	}
 
 	dm.mu.RLock()
 	destinations := make([]*Destination, 0, len(dm.destinations))
 	for _, dest := range dm.destinations {
-		destinations = append(destinations, dest)
+		if match(dest) {
+			destinations = append(destinations, dest)
+		}
 	}
+	size := dm.queueSize
 	dm.mu.RUnlock()
 
-	// Send to all destinations in parallel
-	var wg sync.WaitGroup
 	for _, dest := range destinations {
-		wg.Add(1)
-		go func(d *Destination) {
-			defer wg.Done()
-			if err := d.SendMessage(msg); err != nil {
-				dm.logger.Error("Failed to relay message",
-					"url", d.URL, "type_id", msg.TypeID, "error", err)
-			}
-		}(dest)
+		dest.enqueue(ctx, msg, size)
 	}
-	wg.Wait()
 }
 
 // GetStatus returns status of all destinations
@@ -139,15 +267,30 @@ func (dm *DestinationManager) GetMetrics() map[string]DestinationMetrics {
 }
 
 // DestinationInfo represents a point-in-time snapshot of a relay destination
-// for the metrics endpoint.
+// for the metrics endpoint. Status is "degraded" for a connected destination
+// that is congested and shedding video inter frames.
 type DestinationInfo struct {
-	URL             string `json:"url"`
-	Status          string `json:"status"`
-	MessagesSent    uint64 `json:"messages_sent"`
-	MessagesDropped uint64 `json:"messages_dropped"`
-	BytesSent       uint64 `json:"bytes_sent"`
-	ReconnectCount  uint32 `json:"reconnect_count"`
-	LastError       string `json:"last_error,omitempty"`
+	URL               string  `json:"url"`
+	Status            string  `json:"status"`
+	MessagesSent      uint64  `json:"messages_sent"`
+	MessagesDropped   uint64  `json:"messages_dropped"`
+	QueueDropped      uint64  `json:"queue_dropped"`
+	CongestionDropped uint64  `json:"congestion_dropped"`
+	Filtered          uint64  `json:"filtered"`
+	QueueLength       int     `json:"queue_length"`
+	WriteBlockedMs    float64 `json:"write_blocked_ms"`
+	BytesSent         uint64  `json:"bytes_sent"`
+	ReconnectCount    uint32  `json:"reconnect_count"`
+	LastError         string  `json:"last_error,omitempty"`
+	Profile           string  `json:"profile,omitempty"` // Match prefix of the push profile applied
+
+	// Latency is the ingest-to-send latency over recent messages; nil
+	// without samples (latency tracking disabled or nothing sent).
+	Latency *metrics.LatencyStats `json:"latency,omitempty"`
+
+	// SendTime is how long recent sends blocked on the connection; nil
+	// until something was sent.
+	SendTime *metrics.LatencyStats `json:"send_time,omitempty"`
 }
 
 // Snapshot returns a point-in-time view of all relay destinations for the
@@ -160,17 +303,36 @@ func (dm *DestinationManager) Snapshot() []DestinationInfo {
 	for _, d := range dm.destinations {
 		d.mu.RLock()
 		info := DestinationInfo{
-			URL:             d.URL,
-			Status:          d.Status.String(),
-			MessagesSent:    d.Metrics.MessagesSent,
-			MessagesDropped: d.Metrics.MessagesDropped,
-			BytesSent:       d.Metrics.BytesSent,
-			ReconnectCount:  d.Metrics.ReconnectCount,
+			URL:               d.URL,
+			Status:            d.Status.String(),
+			MessagesSent:      d.Metrics.MessagesSent,
+			MessagesDropped:   d.Metrics.MessagesDropped,
+			QueueDropped:      d.Metrics.QueueDropped,
+			CongestionDropped: d.Metrics.CongestionDropped,
+			Filtered:          d.Metrics.Filtered,
+			WriteBlockedMs:    float64(d.Metrics.WriteBlocked.Microseconds()) / 1000,
+			BytesSent:         d.Metrics.BytesSent,
+			ReconnectCount:    d.Metrics.ReconnectCount,
+		}
+		if d.Status == StatusConnected && d.Metrics.Congested {
+			info.Status = "degraded"
 		}
 		if d.LastError != nil {
 			info.LastError = d.LastError.Error()
 		}
 		d.mu.RUnlock()
+		info.QueueLength = d.QueueLen()
+		d.qmu.Lock()
+		if d.profile != nil {
+			info.Profile = d.profile.Match
+		}
+		d.qmu.Unlock()
+		if stats := d.latency.Stats(); stats.Samples > 0 {
+			info.Latency = &stats
+		}
+		if stats := d.sendTime.Stats(); stats.Samples > 0 {
+			info.SendTime = &stats
+		}
 		infos = append(infos, info)
 	}
 	return infos
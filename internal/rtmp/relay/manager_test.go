@@ -0,0 +1,355 @@
+package relay
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+)
+
+// mockClient records the timestamps it is sent. A blocked client holds
+// every send until block is closed (or the client is closed).
+type mockClient struct {
+	mu      sync.Mutex
+	video   []uint32
+	audio   []uint32
+	block   chan struct{} // nil = never block
+	closeCh chan struct{}
+	once    sync.Once
+}
+
+func newMockClient(blocked bool) *mockClient {
+	m := &mockClient{closeCh: make(chan struct{})}
+	if blocked {
+		m.block = make(chan struct{})
+	}
+	return m
+}
+
+func (m *mockClient) Connect() error { return nil }
+func (m *mockClient) Publish() error { return nil }
+
+func (m *mockClient) wait() {
+	if m.block == nil {
+		return
+	}
+	select {
+	case <-m.block:
+	case <-m.closeCh:
+	}
+}
+
+func (m *mockClient) SendAudio(ts uint32, payload []byte) error {
+	m.wait()
+	m.mu.Lock()
+	m.audio = append(m.audio, ts)
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *mockClient) SendVideo(ts uint32, payload []byte) error {
+	m.wait()
+	m.mu.Lock()
+	m.video = append(m.video, ts)
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *mockClient) Close() error {
+	m.once.Do(func() { close(m.closeCh) })
+	return nil
+}
+
+func (m *mockClient) videoSent() []uint32 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]uint32(nil), m.video...)
+}
+
+func (m *mockClient) audioSent() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.audio)
+}
+
+func audioMsg(ts uint32) *chunk.Message {
+	return &chunk.Message{CSID: 4, TypeID: 8, Timestamp: ts, Payload: []byte{0xAF, 0x01, 0xAA}}
+}
+
+func videoMsg(ts uint32, key bool) *chunk.Message {
+	b0 := byte(0x27) // inter frame, AVC
+	if key {
+		b0 = 0x17
+	}
+	return &chunk.Message{CSID: 6, TypeID: 9, Timestamp: ts, Payload: []byte{b0, 0x01, 0, 0, 0, 0xAA}}
+}
+
+// TestRelay_SlowDestinationIsolated verifies that a destination whose sends
+// block neither delays RelayMessage nor the other destinations, sheds video
+// while backed up and resumes on the next keyframe once it catches up.
+func TestRelay_SlowDestinationIsolated(t *testing.T) {
+	fast, slow := newMockClient(false), newMockClient(true)
+	clients := map[string]*mockClient{
+		"rtmp://fast.example.com/live/k": fast,
+		"rtmp://slow.example.com/live/k": slow,
+	}
+	factory := func(url string) (RTMPClient, error) { return clients[url], nil }
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	dm, err := NewDestinationManager([]string{"rtmp://fast.example.com/live/k", "rtmp://slow.example.com/live/k"}, logger, factory)
+	if err != nil {
+		t.Fatalf("NewDestinationManager: %v", err)
+	}
+	defer dm.Close()
+	dm.SetQueueSize(4)
+
+	// The fast destination keeps up message by message while the slow
+	// one is stuck and overflows its queue.
+	for i := uint32(0); i < 20; i++ {
+		start := time.Now()
+		dm.RelayMessage(videoMsg(i*40, i == 0))
+		if d := time.Since(start); d > 100*time.Millisecond {
+			t.Fatalf("RelayMessage blocked on the slow destination for %v", d)
+		}
+		deadline := time.Now().Add(time.Second)
+		for len(fast.videoSent()) <= int(i) && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if n := len(fast.videoSent()); n != 20 {
+		t.Fatalf("fast destination got %d messages, want 20", n)
+	}
+
+	m := dm.GetMetrics()["rtmp://slow.example.com/live/k"]
+	if m.MessagesDropped == 0 || m.MessagesDropped != m.QueueDropped+m.CongestionDropped {
+		t.Fatalf("slow destination drops = %d (queue %d, congestion %d)", m.MessagesDropped, m.QueueDropped, m.CongestionDropped)
+	}
+	if m := dm.GetMetrics()["rtmp://fast.example.com/live/k"]; m.MessagesDropped != 0 {
+		t.Fatalf("fast destination dropped %d messages", m.MessagesDropped)
+	}
+
+	// While recovering, inter frames are skipped until the next keyframe.
+	close(slow.block)
+	deadline := time.Now().Add(2 * time.Second)
+	for queueLen(dm, "rtmp://slow.example.com/live/k") > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	dm.RelayMessage(videoMsg(1000, false))
+	dm.RelayMessage(videoMsg(1040, true))
+	dm.RelayMessage(videoMsg(1080, false))
+
+	deadline = time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if got := slow.videoSent(); len(got) > 0 && got[len(got)-1] == 1080 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	got := slow.videoSent()
+	if len(got) < 2 || got[len(got)-2] != 1040 || got[len(got)-1] != 1080 {
+		t.Fatalf("slow destination sent %v, want it to resume at keyframe 1040", got)
+	}
+	for _, ts := range got {
+		if ts == 1000 {
+			t.Fatalf("inter frame before the resume keyframe was sent: %v", got)
+		}
+	}
+
+	var info DestinationInfo
+	for _, in := range dm.Snapshot() {
+		if in.URL == "rtmp://slow.example.com/live/k" {
+			info = in
+		}
+	}
+	if info.MessagesDropped != m.MessagesDropped+1 {
+		t.Fatalf("snapshot messages_dropped = %d, want %d", info.MessagesDropped, m.MessagesDropped+1)
+	}
+	if info.Status != "connected" {
+		t.Fatalf("snapshot status = %q after catching up, want connected", info.Status)
+	}
+}
+
+// TestRelay_CongestionShedsVideoKeepsAudio verifies that a backed-up
+// destination is reported as degraded and drops video inter frames while
+// still delivering audio and keyframes.
+func TestRelay_CongestionShedsVideoKeepsAudio(t *testing.T) {
+	const url = "rtmp://slow.example.com/live/k"
+	c := newMockClient(true)
+	dm, err := NewDestinationManager([]string{url}, slog.New(slog.NewTextHandler(io.Discard, nil)),
+		func(string) (RTMPClient, error) { return c, nil })
+	if err != nil {
+		t.Fatalf("NewDestinationManager: %v", err)
+	}
+	defer dm.Close()
+	dm.SetQueueSize(10)
+
+	// Keyframe, then five inter frame + audio pairs: the queue reaches the
+	// congestion mark after the second inter frame and never overflows.
+	dm.RelayMessage(videoMsg(0, true))
+	for i := uint32(1); i <= 5; i++ {
+		dm.RelayMessage(videoMsg(i*40, false))
+		dm.RelayMessage(audioMsg(i * 40))
+	}
+
+	m := dm.GetMetrics()[url]
+	if !m.Congested || m.CongestionDropped == 0 || m.QueueDropped != 0 {
+		t.Fatalf("metrics = %+v, want congested with video shed and nothing overflowed", m)
+	}
+	if st := dm.Snapshot()[0].Status; st != "degraded" {
+		t.Fatalf("snapshot status = %q, want degraded", st)
+	}
+	if s := dm.GetStatus()[url]; s != StatusConnected {
+		t.Fatalf("destination status = %v, want it to stay connected", s)
+	}
+	dm.RelayMessage(videoMsg(240, true)) // keyframes still pass
+
+	close(c.block)
+	deadline := time.Now().Add(2 * time.Second)
+	for (c.audioSent() < 5 || !containsTS(c.videoSent(), 240)) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := c.audioSent(); n != 5 {
+		t.Fatalf("audio delivered = %d, want all 5", n)
+	}
+	video := c.videoSent()
+	if video[len(video)-1] != 240 || uint64(len(video))+m.CongestionDropped != 7 {
+		t.Fatalf("video delivered %v with %d shed, want keyframe 240 last and 7 in total", video, m.CongestionDropped)
+	}
+	deadline = time.Now().Add(2 * time.Second)
+	for dm.GetMetrics()[url].Congested && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if dm.GetMetrics()[url].Congested {
+		t.Fatal("destination still congested after its queue drained")
+	}
+	if info := dm.Snapshot()[0]; info.SendTime == nil || info.WriteBlockedMs == 0 {
+		t.Fatalf("snapshot = %+v, want send time and write blocking reported", info)
+	}
+}
+
+func containsTS(ts []uint32, want uint32) bool {
+	for _, v := range ts {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
+
+// queueLen returns the send queue length of the destination for url.
+func queueLen(dm *DestinationManager, url string) int {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+	return dm.destinations[url].QueueLen()
+}
+
+// TestDestination_CloseInterruptsBlockedSend verifies that closing a
+// destination whose send is stuck returns instead of waiting for it.
+func TestDestination_CloseInterruptsBlockedSend(t *testing.T) {
+	c := newMockClient(true)
+	d, err := NewDestination("rtmp://slow.example.com/live/k", slog.New(slog.NewTextHandler(io.Discard, nil)),
+		func(string) (RTMPClient, error) { return c, nil })
+	if err != nil {
+		t.Fatalf("NewDestination: %v", err)
+	}
+	if err := d.Connect(); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	for i := uint32(0); i < 3; i++ {
+		d.enqueue(context.Background(), videoMsg(i*40, i == 0), 8)
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		_ = d.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close blocked on a stuck send")
+	}
+	d.enqueue(context.Background(), videoMsg(200, true), 8) // no-op after Close
+}
+
+// slowConnectClient is a mockClient whose ConnectContext blocks until
+// connected is closed or its context is cancelled.
+type slowConnectClient struct {
+	*mockClient
+	connected chan struct{}
+}
+
+func (c *slowConnectClient) ConnectContext(ctx context.Context) error {
+	select {
+	case <-c.connected:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// TestStartStream_ConnectsAsync verifies that StartStreamWith returns
+// while a destination is still connecting, that media relayed meanwhile
+// is sent once it connects, and that an unreachable destination neither
+// holds up the others nor stop.
+func TestStartStream_ConnectsAsync(t *testing.T) {
+	slow := &slowConnectClient{mockClient: newMockClient(false), connected: make(chan struct{})}
+	stuck := &slowConnectClient{mockClient: newMockClient(false), connected: make(chan struct{})}
+	fast := newMockClient(false)
+	clients := map[string]RTMPClient{"rtmp://slow/live/k": slow, "rtmp://stuck/live/k": stuck, "rtmp://fast/live/k": fast}
+	factory := func(url string) (RTMPClient, error) { return clients[url], nil }
+	dm, err := NewDestinationManager(nil, slog.New(slog.NewTextHandler(io.Discard, nil)), factory)
+	if err != nil {
+		t.Fatalf("NewDestinationManager: %v", err)
+	}
+
+	started := make(chan func())
+	go func() {
+		started <- dm.StartStreamWith("live/k", []string{"rtmp://slow/live/k", "rtmp://stuck/live/k", "rtmp://fast/live/k"})
+	}()
+	var stop func()
+	select {
+	case stop = <-started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("StartStreamWith waited for destinations to connect")
+	}
+	if s := dm.GetStatus()["rtmp://slow/live/k"]; s != StatusConnecting {
+		t.Fatalf("slow destination status = %v, want connecting", s)
+	}
+	dm.RelayStreamMessage("live/k", videoMsg(0, true))
+	dm.RelayStreamMessage("live/k", videoMsg(40, false))
+	waitSent(t, fast, 2)
+
+	close(slow.connected)
+	waitSent(t, slow.mockClient, 2)
+	if got := slow.videoSent(); got[0] != 0 || got[1] != 40 {
+		t.Fatalf("slow destination sent %v, want [0 40]", got)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("stop waited for a destination still connecting")
+	}
+}
+
+// waitSent waits for c to have sent n video messages.
+func waitSent(t *testing.T, c *mockClient, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(c.videoSent()) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("sent %v, want %d video messages", c.videoSent(), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
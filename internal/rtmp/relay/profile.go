@@ -0,0 +1,176 @@
+package relay
+
+// Push profiles
+// -------------
+// Platforms receiving the same simulcast want different things: one
+// needs a title in onMetaData, another rejects HEVC or Opus. A Profile
+// applies to the destinations whose URL starts with its Match prefix and
+// rewrites what is sent to them:
+//
+//	rtmp://a.rtmp.youtube.com/=set.title=My Show,remove=encoder,video-codec=H264
+//	rtmps://live-api-s.facebook.com/=audio-codec=AAC
+//
+// set.KEY=VALUE adds or replaces an onMetaData property (true/false and
+// numbers are typed; quote a value to keep it a string), remove=KEY deletes
+// one, and video-codec/audio-codec list the codecs sent to the destination:
+// frames in any other codec are not sent. Other streams' destinations and
+// local players are unaffected.
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/media"
+)
+
+// Profile rewrites the stream sent to the relay destinations it matches.
+type Profile struct {
+	Match          string                 // destination URL prefix, e.g. "rtmp://a.rtmp.youtube.com/"
+	SetMetadata    map[string]interface{} // onMetaData properties added or replaced
+	RemoveMetadata []string               // onMetaData properties deleted
+	VideoCodecs    []string               // video codecs sent (empty = all), e.g. "H264"
+	AudioCodecs    []string               // audio codecs sent (empty = all), e.g. "AAC"
+}
+
+// ParseProfile parses "PREFIX=setting[,setting...]" with the settings
+// set.KEY=VALUE, remove=KEY, video-codec=NAME and audio-codec=NAME (all
+// repeatable). The prefix may not contain "=" and values may not contain
+// ",".
+func ParseProfile(s string) (Profile, error) {
+	match, list, ok := strings.Cut(s, "=")
+	p := Profile{Match: strings.TrimSpace(match)}
+	if !ok || p.Match == "" || strings.TrimSpace(list) == "" {
+		return Profile{}, fmt.Errorf("relay profile %q: expected URL-prefix=setting=value[,setting=value...]", s)
+	}
+	for _, kv := range strings.Split(list, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(kv), "=")
+		value = strings.TrimSpace(value)
+		switch {
+		case strings.HasPrefix(name, "set."):
+			key := strings.TrimPrefix(name, "set.")
+			if key == "" {
+				return Profile{}, fmt.Errorf("relay profile %q: set needs a property name", s)
+			}
+			if p.SetMetadata == nil {
+				p.SetMetadata = make(map[string]interface{})
+			}
+			p.SetMetadata[key] = metadataValue(value)
+		case name == "remove":
+			if value == "" {
+				return Profile{}, fmt.Errorf("relay profile %q: remove needs a property name", s)
+			}
+			p.RemoveMetadata = append(p.RemoveMetadata, value)
+		case name == "video-codec" || name == "audio-codec":
+			if value == "" {
+				return Profile{}, fmt.Errorf("relay profile %q: %s needs a codec name", s, name)
+			}
+			if name == "video-codec" {
+				p.VideoCodecs = append(p.VideoCodecs, value)
+			} else {
+				p.AudioCodecs = append(p.AudioCodecs, value)
+			}
+		default:
+			return Profile{}, fmt.Errorf("relay profile %q: unknown setting %q", s, name)
+		}
+	}
+	return p, nil
+}
+
+// metadataValue types a set.KEY value: booleans and numbers become AMF
+// booleans and numbers, a double-quoted value is the string inside.
+func metadataValue(v string) interface{} {
+	if unq, err := strconv.Unquote(v); err == nil && strings.HasPrefix(v, `"`) {
+		return unq
+	}
+	if b, err := strconv.ParseBool(v); err == nil && (v == "true" || v == "false") {
+		return b
+	}
+	if f, err := strconv.ParseFloat(v, 64); err == nil {
+		return f
+	}
+	return v
+}
+
+// matches reports whether the profile applies to the destination URL.
+func (p *Profile) matches(rawURL string) bool {
+	return strings.HasPrefix(rawURL, p.Match)
+}
+
+// allows reports whether an audio or video message is in a codec the
+// profile sends. Messages whose codec cannot be parsed are sent.
+func (p *Profile) allows(m *chunk.Message) bool {
+	var allowed []string
+	var codec string
+	switch m.TypeID {
+	case 8:
+		if len(p.AudioCodecs) == 0 {
+			return true
+		}
+		am, err := media.ParseAudioMessage(m.Payload)
+		if err != nil {
+			return true
+		}
+		allowed, codec = p.AudioCodecs, am.Codec
+	case 9:
+		if len(p.VideoCodecs) == 0 {
+			return true
+		}
+		vm, err := media.ParseVideoMessage(m.Payload)
+		if err != nil {
+			return true
+		}
+		allowed, codec = p.VideoCodecs, vm.Codec
+	default:
+		return true
+	}
+	for _, name := range allowed {
+		if strings.EqualFold(name, codec) {
+			return true
+		}
+	}
+	return false
+}
+
+// rewrite returns m with the profile's onMetaData changes applied, as a
+// new message, or m itself if it is not onMetaData or nothing changes. The
+// @setDataFrame wrapper, if any, is kept.
+func (p *Profile) rewrite(m *chunk.Message) (*chunk.Message, error) {
+	if m.TypeID != 18 || len(p.SetMetadata)+len(p.RemoveMetadata) == 0 {
+		return m, nil
+	}
+	props, ok := media.ParseOnMetaData(m.Payload)
+	if !ok {
+		return m, nil
+	}
+	out := amf.ECMAArray{}
+	for k, v := range props {
+		out[k] = v
+	}
+	for _, k := range p.RemoveMetadata {
+		delete(out, k)
+	}
+	for k, v := range p.SetMetadata {
+		out[k] = v
+	}
+	values := []interface{}{"onMetaData", out}
+	if first, err := amf.DecodeValue(bytes.NewReader(m.Payload)); err == nil && first == "@setDataFrame" {
+		values = append([]interface{}{"@setDataFrame"}, values...)
+	}
+	payload, err := amf.EncodeAll(values...)
+	if err != nil {
+		return nil, fmt.Errorf("relay profile %s: encode onMetaData: %w", p.Match, err)
+	}
+	return &chunk.Message{
+		CSID:            m.CSID,
+		Timestamp:       m.Timestamp,
+		TypeID:          m.TypeID,
+		MessageStreamID: m.MessageStreamID,
+		MessageLength:   uint32(len(payload)),
+		Payload:         payload,
+		Ingest:          m.Ingest,
+	}, nil
+}
@@ -0,0 +1,118 @@
+package relay
+
+import (
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/media"
+)
+
+func TestParseProfile(t *testing.T) {
+	p, err := ParseProfile(`rtmp://a.rtmp.youtube.com/=set.title=My Show,set.year="2024",set.live=true,set.fps=30,remove=encoder,video-codec=H264,audio-codec=AAC`)
+	if err != nil {
+		t.Fatalf("ParseProfile: %v", err)
+	}
+	if p.Match != "rtmp://a.rtmp.youtube.com/" {
+		t.Fatalf("Match = %q", p.Match)
+	}
+	want := map[string]interface{}{"title": "My Show", "year": "2024", "live": true, "fps": 30.0}
+	for k, v := range want {
+		if p.SetMetadata[k] != v {
+			t.Fatalf("set.%s = %#v, want %#v", k, p.SetMetadata[k], v)
+		}
+	}
+	if len(p.RemoveMetadata) != 1 || len(p.VideoCodecs) != 1 || len(p.AudioCodecs) != 1 {
+		t.Fatalf("profile = %+v", p)
+	}
+
+	for _, bad := range []string{"", "rtmp://x/", "=video-codec=H264", "rtmp://x/=colour=red", "rtmp://x/=remove=", "rtmp://x/=set.=1", "rtmp://x/=video-codec"} {
+		if _, err := ParseProfile(bad); err == nil {
+			t.Errorf("ParseProfile(%q) accepted", bad)
+		}
+	}
+}
+
+// dataClient is a mockClient that also records data messages.
+type dataClient struct {
+	*mockClient
+	dmu  sync.Mutex
+	data [][]byte
+}
+
+func (c *dataClient) SendData(ts uint32, payload []byte) error {
+	c.dmu.Lock()
+	c.data = append(c.data, payload)
+	c.dmu.Unlock()
+	return nil
+}
+
+func (c *dataClient) dataSent() [][]byte {
+	c.dmu.Lock()
+	defer c.dmu.Unlock()
+	return append([][]byte(nil), c.data...)
+}
+
+// TestRelay_Profiles relays one stream to two destinations, one with a
+// profile, and checks each gets its own metadata and codecs.
+func TestRelay_Profiles(t *testing.T) {
+	yt := &dataClient{mockClient: newMockClient(false)}
+	plain := &dataClient{mockClient: newMockClient(false)}
+	clients := map[string]*dataClient{
+		"rtmp://a.rtmp.youtube.com/live2/key": yt,
+		"rtmp://backup.example.com/live/key":  plain,
+	}
+	factory := func(url string) (RTMPClient, error) { return clients[url], nil }
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	dm, err := NewDestinationManager([]string{"rtmp://a.rtmp.youtube.com/live2/key", "rtmp://backup.example.com/live/key"}, logger, factory)
+	if err != nil {
+		t.Fatalf("NewDestinationManager: %v", err)
+	}
+	defer dm.Close()
+	p, _ := ParseProfile("rtmp://a.rtmp.youtube.com/=set.title=My Show,remove=encoder,video-codec=H264")
+	dm.SetProfiles([]Profile{p})
+
+	meta, _ := amf.EncodeAll("@setDataFrame", "onMetaData", amf.ECMAArray{"encoder": "obs", "width": 1280.0})
+	dm.RelayMessage(&chunk.Message{CSID: 5, TypeID: 18, Payload: meta})
+	dm.RelayMessage(videoMsg(0, true)) // H.264
+	hevc := []byte{0x1C, 0x01, 0, 0, 0, 0xAA}
+	dm.RelayMessage(&chunk.Message{CSID: 6, TypeID: 9, Timestamp: 40, Payload: hevc})
+
+	deadline := time.Now().Add(time.Second)
+	for (len(yt.videoSent()) < 1 || len(plain.videoSent()) < 2) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := yt.videoSent(); len(got) != 1 || got[0] != 0 {
+		t.Fatalf("profiled destination got video %v, want only the H.264 frame", got)
+	}
+	if got := plain.videoSent(); len(got) != 2 {
+		t.Fatalf("plain destination got video %v, want both frames", got)
+	}
+	if m := dm.GetMetrics()["rtmp://a.rtmp.youtube.com/live2/key"]; m.Filtered != 1 || m.MessagesDropped != 0 {
+		t.Fatalf("profiled destination metrics = %+v, want 1 filtered, 0 dropped", m)
+	}
+
+	ytData, plainData := yt.dataSent(), plain.dataSent()
+	if len(ytData) != 1 || len(plainData) != 1 {
+		t.Fatalf("data messages sent: %d and %d, want 1 each", len(ytData), len(plainData))
+	}
+	props, ok := media.ParseOnMetaData(ytData[0])
+	if !ok || props["title"] != "My Show" || props["width"] != 1280.0 || props["encoder"] != nil {
+		t.Fatalf("rewritten onMetaData = %v", props)
+	}
+	if first, _ := amf.DecodeAll(ytData[0]); len(first) != 3 || first[0] != "@setDataFrame" {
+		t.Fatalf("rewritten payload lost its @setDataFrame wrapper: %v", first)
+	}
+	if props, _ := media.ParseOnMetaData(plainData[0]); props["encoder"] != "obs" || props["title"] != nil {
+		t.Fatalf("unprofiled onMetaData = %v", props)
+	}
+	for _, info := range dm.Snapshot() {
+		if want := map[bool]string{true: p.Match}[info.URL == "rtmp://a.rtmp.youtube.com/live2/key"]; info.Profile != want {
+			t.Fatalf("%s profile = %q, want %q", info.URL, info.Profile, want)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package relay
+
+import "strings"
+
+// Destination URL templates
+// -------------------------
+// A destination URL may contain {app} and {stream} placeholders. Such a
+// destination is not connected at startup; instead a concrete destination
+// is created for every publish, with the placeholders replaced by the
+// publisher's app and stream name:
+//
+//	rtmp://backup.example.com/{app}/{stream}   live/cam1 -> rtmp://backup.example.com/live/cam1
+//	rtmp://a.rtmp.youtube.com/live2/{stream}   live/abcd -> rtmp://a.rtmp.youtube.com/live2/abcd
+
+// Placeholders recognised in destination URL templates.
+const (
+	PlaceholderApp    = "{app}"
+	PlaceholderStream = "{stream}"
+)
+
+// IsTemplate reports whether a destination URL contains placeholders and
+// must be resolved per published stream.
+func IsTemplate(rawURL string) bool {
+	return strings.Contains(rawURL, PlaceholderApp) || strings.Contains(rawURL, PlaceholderStream)
+}
+
+// ExpandTemplate substitutes the app and stream name of streamKey
+// ("app/name") into a destination URL template. Values are inserted
+// verbatim, so a stream name containing slashes stays a multi-segment key.
+func ExpandTemplate(tmpl, streamKey string) string {
+	app, stream, _ := strings.Cut(streamKey, "/")
+	return strings.NewReplacer(PlaceholderApp, app, PlaceholderStream, stream).Replace(tmpl)
+}
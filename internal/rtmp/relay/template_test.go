@@ -0,0 +1,169 @@
+package relay
+
+import (
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+)
+
+func TestExpandTemplate(t *testing.T) {
+	tests := []struct {
+		tmpl, key, want string
+	}{
+		{"rtmp://backup/{app}/{stream}", "live/cam1", "rtmp://backup/live/cam1"},
+		{"rtmp://a.rtmp.youtube.com/live2/{stream}", "live/abcd/efgh", "rtmp://a.rtmp.youtube.com/live2/abcd/efgh"},
+		{"rtmp://cdn/live/fixed-key", "live/cam1", "rtmp://cdn/live/fixed-key"},
+	}
+	for _, tt := range tests {
+		if got := ExpandTemplate(tt.tmpl, tt.key); got != tt.want {
+			t.Errorf("ExpandTemplate(%q, %q) = %q, want %q", tt.tmpl, tt.key, got, tt.want)
+		}
+	}
+	if IsTemplate("rtmp://cdn/live/key") || !IsTemplate("rtmp://cdn/{app}/key") {
+		t.Errorf("IsTemplate misclassified URLs")
+	}
+}
+
+// recordingClient is a mock RTMPClient that counts video messages.
+type recordingClient struct {
+	mu     sync.Mutex
+	video  int
+	closed bool
+}
+
+func (c *recordingClient) Connect() error                 { return nil }
+func (c *recordingClient) Publish() error                 { return nil }
+func (c *recordingClient) SendAudio(uint32, []byte) error { return nil }
+func (c *recordingClient) SendVideo(uint32, []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.video++
+	return nil
+}
+func (c *recordingClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+// waitVideo returns the video message count once it reaches n, or the
+// count so far after a second. Destinations send asynchronously.
+func (c *recordingClient) waitVideo(n int) int {
+	deadline := time.Now().Add(time.Second)
+	for {
+		c.mu.Lock()
+		got := c.video
+		c.mu.Unlock()
+		if got >= n || time.Now().After(deadline) {
+			return got
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// clientSet records the recordingClients its factory creates, by URL.
+// Destinations connect on their own goroutines.
+type clientSet struct {
+	mu      sync.Mutex
+	clients map[string]*recordingClient
+}
+
+func (s *clientSet) factory(url string) (RTMPClient, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.clients == nil {
+		s.clients = make(map[string]*recordingClient)
+	}
+	c := &recordingClient{}
+	s.clients[url] = c
+	return c, nil
+}
+
+func (s *clientSet) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.clients)
+}
+
+// get returns the client created for url, waiting up to a second for it;
+// nil if there is none by then.
+func (s *clientSet) get(url string) *recordingClient {
+	deadline := time.Now().Add(time.Second)
+	for {
+		s.mu.Lock()
+		c := s.clients[url]
+		s.mu.Unlock()
+		if c != nil || time.Now().After(deadline) {
+			return c
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestStartStream_ResolvesTemplatesPerPublish verifies templated
+// destinations are created per publish, only receive their own stream and
+// are closed by the returned stop function.
+func TestStartStream_ResolvesTemplatesPerPublish(t *testing.T) {
+	clients := &clientSet{}
+	factory := clients.factory
+	dm, err := NewDestinationManager([]string{"rtmp://static/live/all", "rtmp://backup/{app}/{stream}"}, slog.Default(), factory)
+	if err != nil {
+		t.Fatalf("NewDestinationManager: %v", err)
+	}
+	if n := clients.len(); n != 1 {
+		t.Fatalf("expected only the static destination at startup, got %d", n)
+	}
+
+	stopA := dm.StartStream("live/a")
+	stopB := dm.StartStream("live/b")
+	video := &chunk.Message{TypeID: 9, Payload: []byte{0x17}}
+	dm.RelayStreamMessage("live/a", video)
+
+	if n := clients.get("rtmp://backup/live/a").waitVideo(1); n != 1 {
+		t.Errorf("live/a destination got %d messages, want 1", n)
+	}
+	if n := clients.get("rtmp://backup/live/b").waitVideo(0); n != 0 {
+		t.Errorf("live/b destination got %d messages from live/a", n)
+	}
+	if n := clients.get("rtmp://static/live/all").waitVideo(1); n != 1 {
+		t.Errorf("static destination got %d messages, want 1", n)
+	}
+
+	stopA()
+	if !clients.get("rtmp://backup/live/a").closed {
+		t.Errorf("stop did not close the resolved destination")
+	}
+	if _, ok := dm.GetStatus()["rtmp://backup/live/a"]; ok {
+		t.Errorf("resolved destination still registered after stop")
+	}
+	if _, ok := dm.GetStatus()["rtmp://backup/live/b"]; !ok {
+		t.Errorf("other stream's destination removed")
+	}
+	stopB()
+}
+
+// TestStartStreamWith_PerStreamURLs verifies that URLs passed to
+// StartStreamWith relay only the stream they were started for.
+func TestStartStreamWith_PerStreamURLs(t *testing.T) {
+	clients := &clientSet{}
+	factory := clients.factory
+	dm, err := NewDestinationManager(nil, slog.Default(), factory)
+	if err != nil {
+		t.Fatalf("NewDestinationManager: %v", err)
+	}
+	stop := dm.StartStreamWith("studio/a", []string{"rtmp://cdn/in/{stream}", "rtmp://archive/studio/all"})
+	defer stop()
+	video := &chunk.Message{TypeID: 9, Payload: []byte{0x17}}
+	dm.RelayStreamMessage("studio/a", video)
+	dm.RelayStreamMessage("live/b", video)
+
+	for _, url := range []string{"rtmp://cdn/in/a", "rtmp://archive/studio/all"} {
+		if c := clients.get(url); c == nil || c.waitVideo(1) != 1 {
+			t.Errorf("%s: got %v, want 1 video message", url, c)
+		}
+	}
+}
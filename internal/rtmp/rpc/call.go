@@ -0,0 +1,103 @@
+package rpc
+
+// NetConnection calls
+// ===================
+// Besides the stream commands, Flash-era and hardware players invoke
+// NetConnection.call methods on the server and wait for the matching
+// _result: getStreamLength before playing a recording, checkBandwidth or
+// _checkbw to start a bandwidth check. A client that never gets an answer
+// times out, so the dispatcher answers these (and fails unknown calls with
+// _error) rather than just logging them.
+
+import (
+	"fmt"
+
+	"github.com/alxayo/go-rtmp/internal/errors"
+	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/server/auth"
+)
+
+// GetStreamLengthCommand represents a parsed "getStreamLength" command.
+// Spec form: ["getStreamLength", txnID, null, streamName]
+type GetStreamLengthCommand struct {
+	TransactionID float64
+	StreamName    string // without query parameters
+	StreamKey     string // app/streamName
+}
+
+// ParseGetStreamLengthCommand parses a "getStreamLength" invocation. Expected
+// AMF0 sequence:
+//
+//	0: string "getStreamLength"
+//	1: number transaction ID
+//	2: null - ignored
+//	3: string streamName - may carry query parameters, which are dropped
+func ParseGetStreamLengthCommand(msg *chunk.Message, app string) (*GetStreamLengthCommand, error) {
+	if msg == nil {
+		return nil, errors.NewProtocolError("getstreamlength.parse", fmt.Errorf("nil message"))
+	}
+	if msg.TypeID != commandMessageAMF0TypeID {
+		return nil, errors.NewProtocolError("getstreamlength.parse", fmt.Errorf("unexpected message type %d", msg.TypeID))
+	}
+	vals, err := amf.DecodeAll(msg.Payload)
+	if err != nil {
+		return nil, errors.NewProtocolError("getstreamlength.parse.decode", err)
+	}
+	if len(vals) < 4 {
+		return nil, errors.NewProtocolError("getstreamlength.parse", fmt.Errorf("expected >=4 AMF values, got %d", len(vals)))
+	}
+	name, ok := vals[0].(string)
+	if !ok || name != "getStreamLength" {
+		return nil, errors.NewProtocolError("getstreamlength.parse", fmt.Errorf("first value must be string 'getStreamLength'"))
+	}
+	txn, _ := vals[1].(float64)
+	rawName, _ := vals[3].(string)
+	streamName := auth.ParseStreamURL(rawName).StreamName
+	if streamName == "" {
+		return nil, errors.NewProtocolError("getstreamlength.parse", fmt.Errorf("missing stream name"))
+	}
+	return &GetStreamLengthCommand{
+		TransactionID: txn,
+		StreamName:    streamName,
+		StreamKey:     fmt.Sprintf("%s/%s", app, streamName),
+	}, nil
+}
+
+// BuildResult constructs a _result response to a NetConnection call:
+//
+//	["_result", transactionID, null, values...]
+//
+// The message is sent at connection level (MessageStreamID 0, CSID 3).
+func BuildResult(transactionID float64, values ...interface{}) (*chunk.Message, error) {
+	payload, err := amf.EncodeAll(append([]interface{}{"_result", transactionID, nil}, values...)...)
+	if err != nil {
+		return nil, errors.NewProtocolError("result.encode", fmt.Errorf("amf encode: %w", err))
+	}
+	return &chunk.Message{
+		CSID:            3, // Command messages use CSID 3 per RTMP conventions
+		TypeID:          commandMessageAMF0TypeID,
+		MessageStreamID: 0,
+		Payload:         payload,
+		MessageLength:   uint32(len(payload)),
+	}, nil
+}
+
+// BuildOnBWDone constructs the onBWDone call that ends a bandwidth check:
+//
+//	["onBWDone", 0, null]
+//
+// Clients that send checkBandwidth or _checkbw wait for it before playing.
+func BuildOnBWDone() (*chunk.Message, error) {
+	payload, err := amf.EncodeAll("onBWDone", 0.0, nil)
+	if err != nil {
+		return nil, errors.NewProtocolError("onbwdone.encode", fmt.Errorf("amf encode: %w", err))
+	}
+	return &chunk.Message{
+		CSID:            3,
+		TypeID:          commandMessageAMF0TypeID,
+		MessageStreamID: 0,
+		Payload:         payload,
+		MessageLength:   uint32(len(payload)),
+	}, nil
+}
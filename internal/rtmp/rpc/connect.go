@@ -1,15 +1,45 @@
 package rpc
 
 import (
+	stderrors "errors"
 	"fmt"
+	"math"
 
 	"github.com/alxayo/go-rtmp/internal/errors"
 	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
 	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
 )
 
-// RTMP message type ID for AMF0 command messages.
-const commandMessageAMF0TypeID = 20
+// RTMP message type IDs for command messages. An AMF3 command message
+// (17) is what clients that negotiated objectEncoding 3 send; its payload
+// is a format byte (0) followed by AMF0 values.
+const (
+	commandMessageAMF0TypeID = 20
+	commandMessageAMF3TypeID = 17
+)
+
+// Object encodings a client may request in the connect object.
+const (
+	ObjectEncodingAMF0 = 0
+	ObjectEncodingAMF3 = 3
+)
+
+// Audio codec bits of the connect object's audioCodecs field.
+const (
+	AudioCodecMP3   = 0x0004
+	AudioCodecG711A = 0x0080
+	AudioCodecG711U = 0x0100
+	AudioCodecAAC   = 0x0400
+	AudioCodecSpeex = 0x0800
+)
+
+// Video codec bits of the connect object's videoCodecs field.
+const (
+	VideoCodecSorenson = 0x04
+	VideoCodecVP6      = 0x10
+	VideoCodecVP6Alpha = 0x20
+	VideoCodecH264     = 0x80
+)
 
 // CommandMessageAMF0TypeIDForTest exposes the command message type id (20)
 // to other packages that need to build AMF0 command messages (e.g. server
@@ -17,13 +47,31 @@ const commandMessageAMF0TypeID = 20
 // broadening the public API surface prematurely.
 func CommandMessageAMF0TypeIDForTest() uint8 { return commandMessageAMF0TypeID }
 
+// IsCommandMessage reports whether typeID is a command message the
+// Dispatcher accepts: AMF0 (20) or AMF3 (17).
+func IsCommandMessage(typeID uint8) bool {
+	return typeID == commandMessageAMF0TypeID || typeID == commandMessageAMF3TypeID
+}
+
+// ErrMissingApp is wrapped by ParseConnectCommand when the connect object has
+// no (or an empty) "app" field. The dispatcher answers it with
+// NetConnection.Connect.InvalidApp.
+var ErrMissingApp = stderrors.New("app field required")
+
 // ConnectCommand represents the parsed contents of a "connect" command.
+// Fields the client omitted are zero.
 type ConnectCommand struct {
 	TransactionID  float64
 	App            string
-	FlashVer       string
-	TcURL          string
-	ObjectEncoding float64                // must be 0 (AMF0)
+	FlashVer       string                 // client version, e.g. "FMLE/3.0" or "LNX 9,0,124,2"
+	TcURL          string                 // URL the client connected to, rtmp://host/app
+	SwfURL         string                 // URL of the SWF (or player) that made the connection
+	PageURL        string                 // URL of the page the player runs on
+	ObjectEncoding float64                // ObjectEncodingAMF0 or ObjectEncodingAMF3
+	Capabilities   uint32                 // client capability bits
+	AudioCodecs    uint32                 // AudioCodec* bits the client can play
+	VideoCodecs    uint32                 // VideoCodec* bits the client can play
+	VideoFunction  uint32                 // special video functions (1 = seek to a frame)
 	FourCcList     []string               // Enhanced RTMP: codec FourCCs the client supports (e.g. ["hvc1","av01"])
 	Extra          map[string]interface{} // all other connect object fields (auth tokens, etc.)
 }
@@ -68,25 +116,40 @@ func ParseConnectCommand(msg *chunk.Message) (*ConnectCommand, error) {
 
 	cc := &ConnectCommand{TransactionID: trx}
 
-	// Extract required fields
+	// Extract required fields. A non-string app is reported as missing.
 	if v, ok := obj["app"]; ok {
 		if s, ok := v.(string); ok {
-			cc.App = s
+			cc.App = NormalizeStreamName(s)
 		}
 	}
-	if v, ok := obj["flashVer"]; ok {
-		if s, ok := v.(string); ok {
-			cc.FlashVer = s
+	// Descriptive fields and capability masks are optional, but when
+	// present they must have the AMF type players send: a connect object
+	// with e.g. a string audioCodecs is malformed.
+	for name, dst := range map[string]*string{
+		"flashVer": &cc.FlashVer,
+		"tcUrl":    &cc.TcURL,
+		"swfUrl":   &cc.SwfURL,
+		"pageUrl":  &cc.PageURL,
+	} {
+		if err := stringField(obj, name, dst); err != nil {
+			return nil, err
 		}
 	}
-	if v, ok := obj["tcUrl"]; ok {
-		if s, ok := v.(string); ok {
-			cc.TcURL = s
+	if v, ok := obj["objectEncoding"]; ok {
+		n, ok := v.(float64)
+		if !ok {
+			return nil, errors.NewProtocolError("connect.validate", fmt.Errorf("objectEncoding must be a number, got %T", v))
 		}
+		cc.ObjectEncoding = n
 	}
-	if v, ok := obj["objectEncoding"]; ok {
-		if n, ok := v.(float64); ok {
-			cc.ObjectEncoding = n
+	for name, dst := range map[string]*uint32{
+		"capabilities":  &cc.Capabilities,
+		"audioCodecs":   &cc.AudioCodecs,
+		"videoCodecs":   &cc.VideoCodecs,
+		"videoFunction": &cc.VideoFunction,
+	} {
+		if err := bitmaskField(obj, name, dst); err != nil {
+			return nil, err
 		}
 	}
 
@@ -103,7 +166,9 @@ func ParseConnectCommand(msg *chunk.Message) (*ConnectCommand, error) {
 	}
 
 	// Capture any extra fields from the connect object (useful for auth tokens,
-	// custom parameters, etc.) that we don't explicitly parse above.
+	// custom parameters, etc.) that we don't explicitly parse above. The
+	// descriptive fields (swfUrl, pageUrl, codec masks, ...) are kept here
+	// too, since Extra is what auth callbacks see as the connect parameters.
 	var extra map[string]interface{}
 	for k, v := range obj {
 		switch k {
@@ -120,11 +185,43 @@ func ParseConnectCommand(msg *chunk.Message) (*ConnectCommand, error) {
 
 	// Validation
 	if cc.App == "" {
-		return nil, errors.NewProtocolError("connect.validate", fmt.Errorf("app field required"))
+		return nil, errors.NewProtocolError("connect.validate", ErrMissingApp)
 	}
-	if cc.ObjectEncoding != 0 { // only AMF0 supported
-		return nil, errors.NewProtocolError("connect.validate", fmt.Errorf("unsupported objectEncoding %.0f (only 0 supported)", cc.ObjectEncoding))
+	if cc.ObjectEncoding != ObjectEncodingAMF0 && cc.ObjectEncoding != ObjectEncodingAMF3 {
+		return nil, errors.NewProtocolError("connect.validate", fmt.Errorf("unsupported objectEncoding %v (expected 0 or 3)", cc.ObjectEncoding))
 	}
 
 	return cc, nil
 }
+
+// stringField sets *dst to the string field name of obj, if present.
+func stringField(obj map[string]interface{}, name string, dst *string) error {
+	v, ok := obj[name]
+	if !ok || v == nil { // AMF0 null/undefined counts as omitted
+		return nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return errors.NewProtocolError("connect.validate", fmt.Errorf("%s must be a string, got %T", name, v))
+	}
+	*dst = s
+	return nil
+}
+
+// bitmaskField sets *dst to the numeric field name of obj, if present. The
+// number must be a non-negative integer that fits in 32 bits.
+func bitmaskField(obj map[string]interface{}, name string, dst *uint32) error {
+	v, ok := obj[name]
+	if !ok || v == nil {
+		return nil
+	}
+	n, ok := v.(float64)
+	if !ok {
+		return errors.NewProtocolError("connect.validate", fmt.Errorf("%s must be a number, got %T", name, v))
+	}
+	if n < 0 || n > math.MaxUint32 || n != math.Trunc(n) {
+		return errors.NewProtocolError("connect.validate", fmt.Errorf("%s %v is not a bitmask", name, n))
+	}
+	*dst = uint32(n)
+	return nil
+}
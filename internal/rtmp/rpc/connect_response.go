@@ -8,6 +8,13 @@ import (
 	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
 )
 
+// Server identity and capabilities reported in the connect _result.
+const (
+	fmsVersion         = "3,0,1,123"
+	serverCapabilities = 31.0 // conventional FMS capabilities bitmask
+	serverMode         = 1.0  // 1 per observed implementations
+)
+
 // BuildConnectResponse builds the standard _result response for a successful
 // connect command. It returns an RTMP AMF0 command message (type 20) with the
 // following structure:
@@ -21,9 +28,10 @@ import (
 //
 // information fields:
 //
-//	level:       "status"
-//	code:        "NetConnection.Connect.Success"
-//	description: caller provided description
+//	level:          "status"
+//	code:           "NetConnection.Connect.Success"
+//	description:    caller provided description
+//	objectEncoding: number (always 0: AMF0)
 //
 // When fourCcList is non-nil/non-empty, the info object includes the fourCcList
 // to signal Enhanced RTMP support back to the client.
@@ -31,23 +39,42 @@ import (
 // The returned message uses MessageStreamID=0 (connection level) and CSID=3
 // (the conventional chunk stream for command messages).
 func BuildConnectResponse(transactionID float64, description string, fourCcList ...[]string) (*chunk.Message, error) {
+	var list []string
+	if len(fourCcList) > 0 {
+		list = fourCcList[0]
+	}
+	return buildConnectResponse(transactionID, description, ObjectEncodingAMF0, list)
+}
+
+// BuildConnectResponseFor builds the _result for cc, echoing the Enhanced
+// RTMP fourCcList the client asked for. The client's objectEncoding is
+// deliberately not echoed: the reply always says 0, downgrading clients
+// that asked for AMF3 to AMF0. Players read it from the reply to pick the
+// encoding of later commands, and the server has no AMF3 decoder, so
+// answering 3 would invite commands it cannot read.
+func BuildConnectResponseFor(cc *ConnectCommand, description string) (*chunk.Message, error) {
+	return buildConnectResponse(cc.TransactionID, description, ObjectEncodingAMF0, cc.FourCcList)
+}
+
+func buildConnectResponse(transactionID float64, description string, objectEncoding float64, fourCcList []string) (*chunk.Message, error) {
 	props := map[string]interface{}{
-		"fmsVer":       "FMS/3,0,1,123",
-		"capabilities": 31.0,
-		"mode":         1.0,
+		"fmsVer":       "FMS/" + fmsVersion,
+		"capabilities": serverCapabilities,
+		"mode":         serverMode,
 	}
 
 	info := map[string]interface{}{
-		"level":       "status",
-		"code":        "NetConnection.Connect.Success",
-		"description": description,
-		"data":        map[string]interface{}{"version": "3,0,1,123"},
+		"level":          "status",
+		"code":           "NetConnection.Connect.Success",
+		"description":    description,
+		"objectEncoding": objectEncoding,
+		"data":           map[string]interface{}{"version": fmsVersion},
 	}
 
 	// Echo fourCcList to signal Enhanced RTMP support.
-	if len(fourCcList) > 0 && len(fourCcList[0]) > 0 {
-		arr := make([]interface{}, len(fourCcList[0]))
-		for i, s := range fourCcList[0] {
+	if len(fourCcList) > 0 {
+		arr := make([]interface{}, len(fourCcList))
+		for i, s := range fourCcList {
 			arr[i] = s
 		}
 		info["fourCcList"] = arr
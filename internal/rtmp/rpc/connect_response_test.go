@@ -61,6 +61,33 @@ func TestBuildConnectResponse_EncodesStructure(t *testing.T) {
 	}
 }
 
+// TestBuildConnectResponseFor verifies the reply answers objectEncoding 0
+// (AMF0) whichever encoding the client asked for, so AMF3 players fall back
+// to AMF0 for later commands, and echoes the fourCcList.
+func TestBuildConnectResponseFor(t *testing.T) {
+	for _, enc := range []float64{ObjectEncodingAMF0, ObjectEncodingAMF3} {
+		msg, err := BuildConnectResponseFor(&ConnectCommand{TransactionID: 1, ObjectEncoding: enc, FourCcList: []string{"hvc1"}}, "ok")
+		if err != nil {
+			ttFatal(t, "BuildConnectResponseFor error: %v", err)
+		}
+		vals, err := amf.DecodeAll(msg.Payload)
+		if err != nil {
+			ttFatal(t, "decode: %v", err)
+		}
+		props := vals[2].(map[string]interface{})
+		info := vals[3].(map[string]interface{})
+		if info["objectEncoding"] != float64(ObjectEncodingAMF0) {
+			ttFatal(t, "objectEncoding = %#v for a client asking for %v, want 0", info["objectEncoding"], enc)
+		}
+		if props["capabilities"] != 31.0 || props["mode"] != 1.0 {
+			ttFatal(t, "properties = %#v", props)
+		}
+		if list, _ := info["fourCcList"].([]interface{}); len(list) != 1 || list[0] != "hvc1" {
+			ttFatal(t, "fourCcList = %#v", info["fourCcList"])
+		}
+	}
+}
+
 // ttFatal is a local test helper for concise failure messages with
 // accurate line numbers via t.Helper().
 func ttFatal(t *testing.T, format string, args ...interface{}) {
@@ -5,11 +5,12 @@
 //
 //	[0] "connect"  (string)      – command name
 //	[1] 1.0        (number)      – transaction ID
-//	[2] { app, flashVer, tcUrl, objectEncoding } (object) – connection properties
+//	[2] { app, flashVer, tcUrl, objectEncoding, ... } (object) – connection properties
 //
 // ParseConnectCommand decodes this and validates:
 //   - "app" field must be present.
-//   - objectEncoding must be 0 (AMF0); AMF3 (3) is rejected.
+//   - objectEncoding must be 0 (AMF0) or 3 (AMF3).
+//   - Known optional fields must have the AMF type players send.
 package rpc
 
 import (
@@ -74,26 +75,79 @@ func TestParseConnectCommand_MissingApp(t *testing.T) {
 	}
 }
 
-// TestParseConnectCommand_AMF3Rejected sets objectEncoding=3 (AMF3)
-// which this server does not support – must return error.
-func TestParseConnectCommand_AMF3Rejected(t *testing.T) {
-	payload, err := amf.EncodeAll(
-		"connect",
-		1.0,
-		map[string]interface{}{
+// TestParseConnectCommand_ObjectEncoding verifies that AMF0 and AMF3 are
+// accepted and any other object encoding is rejected.
+func TestParseConnectCommand_ObjectEncoding(t *testing.T) {
+	for _, tc := range []struct {
+		encoding float64
+		ok       bool
+	}{{0, true}, {3, true}, {1, false}, {3.5, false}} {
+		payload, err := amf.EncodeAll("connect", 1.0, map[string]interface{}{
 			"app":            "live",
-			"flashVer":       "LNX 9,0,124,2",
-			"tcUrl":          "rtmp://localhost:1935/live",
-			"objectEncoding": 3.0, // AMF3 (unsupported)
-		},
-	)
+			"objectEncoding": tc.encoding,
+		})
+		if err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+		cmd, err := ParseConnectCommand(buildMessage(payload))
+		if (err == nil) != tc.ok {
+			t.Fatalf("objectEncoding %v: err=%v, want ok=%v", tc.encoding, err, tc.ok)
+		}
+		if err == nil && cmd.ObjectEncoding != tc.encoding {
+			t.Fatalf("ObjectEncoding = %v, want %v", cmd.ObjectEncoding, tc.encoding)
+		}
+	}
+}
+
+// TestParseConnectCommand_Capabilities verifies the descriptive fields and
+// capability masks a Flash-era player sends are surfaced, and that a known
+// field with the wrong AMF type is rejected as malformed.
+func TestParseConnectCommand_Capabilities(t *testing.T) {
+	obj := map[string]interface{}{
+		"app":            "live",
+		"flashVer":       "WIN 32,0,0,465",
+		"swfUrl":         "https://example.com/player.swf",
+		"pageUrl":        "https://example.com/watch",
+		"tcUrl":          "rtmp://example.com/live",
+		"fpad":           false,
+		"capabilities":   239.0,
+		"audioCodecs":    3575.0,
+		"videoCodecs":    252.0,
+		"videoFunction":  1.0,
+		"objectEncoding": 3.0,
+	}
+	payload, _ := amf.EncodeAll("connect", 1.0, obj)
+	cmd, err := ParseConnectCommand(buildMessage(payload))
 	if err != nil {
-		t.Fatalf("encode: %v", err)
+		t.Fatalf("ParseConnectCommand: %v", err)
+	}
+	if cmd.FlashVer != "WIN 32,0,0,465" || cmd.SwfURL != "https://example.com/player.swf" || cmd.PageURL != "https://example.com/watch" {
+		t.Fatalf("descriptive fields: %+v", cmd)
+	}
+	if cmd.Capabilities != 239 || cmd.AudioCodecs != 3575 || cmd.VideoCodecs != 252 || cmd.VideoFunction != 1 {
+		t.Fatalf("capability masks: %+v", cmd)
+	}
+	if cmd.AudioCodecs&AudioCodecAAC == 0 || cmd.VideoCodecs&VideoCodecH264 == 0 {
+		t.Fatalf("expected AAC and H.264 bits in %x / %x", cmd.AudioCodecs, cmd.VideoCodecs)
+	}
+	// The descriptive fields stay available to auth callbacks.
+	if cmd.Extra["pageUrl"] != "https://example.com/watch" {
+		t.Fatalf("pageUrl missing from Extra: %v", cmd.Extra)
 	}
 
-	if _, err := ParseConnectCommand(buildMessage(payload)); err == nil {
-		// Must error because only objectEncoding 0 (AMF0) supported
-		t.Fatalf("expected error for AMF3 objectEncoding")
+	for field, bad := range map[string]interface{}{
+		"flashVer":       9.0,
+		"swfUrl":         true,
+		"audioCodecs":    "3575",
+		"videoCodecs":    -1.0,
+		"capabilities":   1.5,
+		"objectEncoding": "3",
+	} {
+		obj := map[string]interface{}{"app": "live", field: bad}
+		payload, _ := amf.EncodeAll("connect", 1.0, obj)
+		if _, err := ParseConnectCommand(buildMessage(payload)); err == nil {
+			t.Fatalf("expected error for %s = %#v", field, bad)
+		}
 	}
 }
 
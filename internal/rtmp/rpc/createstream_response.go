@@ -14,27 +14,54 @@ import (
 // stream ID returned by createStream; most simple implementations start at 1
 // and increment by 1 for each new logical stream.
 //
-// This lightweight allocator keeps implementation local to the response
-// builder. If broader session management later centralises stream tracking,
-// this can be replaced transparently by passing a different Allocate func.
+// A connection may create several streams (e.g. publish on one and play on
+// another), so the allocator also tracks which IDs are live. IDs are never
+// handed out twice on one connection, even after Release, so late messages
+// for a deleted stream cannot be mistaken for a new one.
 type StreamIDAllocator struct {
-	mu   sync.Mutex
-	next uint32
+	mu     sync.Mutex
+	next   uint32
+	active map[uint32]struct{}
 }
 
 // NewStreamIDAllocator returns an allocator whose first Allocate() call
 // returns 1 (the conventional first stream ID).
-func NewStreamIDAllocator() *StreamIDAllocator { return &StreamIDAllocator{next: 1} }
+func NewStreamIDAllocator() *StreamIDAllocator {
+	return &StreamIDAllocator{next: 1, active: make(map[uint32]struct{})}
+}
 
-// Allocate returns the next stream ID.
+// Allocate returns the next stream ID and marks it live.
 func (a *StreamIDAllocator) Allocate() uint32 {
 	a.mu.Lock()
 	id := a.next
 	a.next++
+	a.active[id] = struct{}{}
 	a.mu.Unlock()
 	return id
 }
 
+// Release marks id as no longer live (deleteStream). Unknown IDs are ignored.
+func (a *StreamIDAllocator) Release(id uint32) {
+	a.mu.Lock()
+	delete(a.active, id)
+	a.mu.Unlock()
+}
+
+// Active reports whether id was allocated and not yet released.
+func (a *StreamIDAllocator) Active(id uint32) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, ok := a.active[id]
+	return ok
+}
+
+// Len returns the number of live stream IDs.
+func (a *StreamIDAllocator) Len() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.active)
+}
+
 // BuildCreateStreamResponse constructs the standard _result response to a
 // createStream command. AMF0 sequence:
 // ["_result", transactionID, null, streamID]
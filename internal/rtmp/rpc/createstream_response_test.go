@@ -65,3 +65,21 @@ func TestBuildCreateStreamResponse_SequentialIDs(t *testing.T) {
 		t.Fatalf("expected stream ids 1 then 2, got %d then %d", sid1, sid2)
 	}
 }
+
+// TestStreamIDAllocator_Release verifies live IDs are tracked and that a
+// released ID is not handed out again.
+func TestStreamIDAllocator_Release(t *testing.T) {
+	alloc := NewStreamIDAllocator()
+	a, b := alloc.Allocate(), alloc.Allocate()
+	if !alloc.Active(a) || !alloc.Active(b) || alloc.Len() != 2 {
+		t.Fatalf("expected ids %d and %d active", a, b)
+	}
+	alloc.Release(a)
+	alloc.Release(99) // unknown IDs are ignored
+	if alloc.Active(a) || alloc.Len() != 1 {
+		t.Fatalf("expected id %d released", a)
+	}
+	if c := alloc.Allocate(); c == a || c == b {
+		t.Fatalf("allocated reused id %d", c)
+	}
+}
@@ -8,14 +8,29 @@ package rpc
 //   2. Parses the full command into a strongly-typed struct (ConnectCommand, etc.)
 //   3. Calls the registered handler function for that command
 //
-// Unknown commands (including OBS/FFmpeg extensions like releaseStream, FCPublish)
-// are logged and gracefully ignored — they don't cause errors.
+// The Flash Media Server extensions OBS, FFmpeg and Wirecast send around a
+// publish (releaseStream, FCPublish, FCUnpublish) are answered as FMS does:
+// a _result when they carry a transaction ID and, for FCPublish and
+// FCUnpublish, an onFCPublish/onFCUnpublish event (see txn.go). Other
+// unknown commands are logged; when they carry a transaction ID the client
+// is waiting for a reply, so they are also answered with _error (see call.go).
+//
+// Handlers report failures by returning an error, preferably an
+// *errors.CommandError naming the status for the client. The dispatcher
+// answers every failure, from parsing or from a handler, in one place and
+// closes the connection when the error calls for it (see failure.go).
+//
+// AMF3 command messages (TypeID 17), sent by clients that negotiated
+// objectEncoding 3, are accepted when their values are AMF0 encoded after
+// the format byte, which is how players send commands. Values switched to
+// AMF3 with the avmplus marker are not supported.
 //
 // The dispatcher uses an appProvider callback to lazily retrieve the application
 // name (set during the "connect" command) needed for publish/play parsing.
 
 import (
 	"bytes"
+	stderrors "errors"
 	"fmt"
 	"log/slog"
 
@@ -37,6 +52,14 @@ type (
 	// when ending a publishing/playback session. The raw AMF0 values are passed
 	// because closeStream has no formally standardized payload structure.
 	CloseStreamHandler func(values []interface{}, msg *chunk.Message) error
+	PauseHandler       func(*PauseCommand, *chunk.Message) error
+	SeekHandler        func(*SeekCommand, *chunk.Message) error
+	// ReceiveHandler handles receiveAudio and receiveVideo, which turn one
+	// track of a play stream off or back on.
+	ReceiveHandler func(*ReceiveCommand, *chunk.Message) error
+	// GetStreamLengthHandler returns the length of a stream in seconds
+	// (0 for live streams); the dispatcher sends it as the _result.
+	GetStreamLengthHandler func(*GetStreamLengthCommand, *chunk.Message) (float64, error)
 )
 
 // Dispatcher routes AMF0 command messages to registered handlers.
@@ -49,6 +72,29 @@ type Dispatcher struct {
 	OnPlay         PlayHandler
 	OnDeleteStream DeleteStreamHandler
 	OnCloseStream  CloseStreamHandler
+	OnPause        PauseHandler
+	OnSeek         SeekHandler
+	OnReceive      ReceiveHandler
+
+	// OnGetStreamLength answers getStreamLength. Without it the reply
+	// reports a length of 0, as for a live stream.
+	OnGetStreamLength GetStreamLengthHandler
+
+	// Reply, when set, sends the failure response (_error or onStatus) for
+	// a command that fails to parse or whose handler returns an error, so
+	// the client sees the error instead of waiting for a reply. The error
+	// is still returned from Dispatch. It also carries the answers to
+	// NetConnection calls (getStreamLength, checkBandwidth, unknown calls).
+	Reply func(*chunk.Message) error
+
+	// TxnMode is the transaction ID of the onStatus answering a failed
+	// stream command: TxnModeZero (or empty) or TxnModeEcho (see txn.go).
+	TxnMode string
+
+	// Close, when set, is called after the failure response to an error
+	// that ends the connection: a malformed command, or a CommandError
+	// with Close set (e.g. failed authentication).
+	Close func() error
 
 	log *slog.Logger
 }
@@ -61,15 +107,58 @@ func NewDispatcher(appProvider func() string) *Dispatcher {
 	return &Dispatcher{appProvider: appProvider, log: logger.Logger().With("component", "dispatcher")}
 }
 
-// Dispatch examines msg (expected TypeID=20) and routes to the appropriate
-// handler. It returns an error for parse/handler failures. Unknown commands
-// are logged at warn level and produce no error.
+// command is a command message being dispatched.
+type command struct {
+	name string         // command name; "" until decoded
+	vals []interface{}  // all AMF0 values of the payload
+	msg  *chunk.Message // the command message
+	key  string         // stream key once parsed, reported in onStatus details
+}
+
+// amf0Command returns the AMF0 command message carried by AMF3 command
+// message msg: the same message without its leading format byte, which
+// must be 0 (AMF0 values).
+func amf0Command(msg *chunk.Message) (*chunk.Message, error) {
+	if len(msg.Payload) == 0 || msg.Payload[0] != 0 {
+		return nil, errors.NewProtocolError("dispatch", fmt.Errorf("AMF3 command message without AMF0 format byte"))
+	}
+	m := *msg
+	m.TypeID = commandMessageAMF0TypeID
+	m.Payload = msg.Payload[1:]
+	m.MessageLength = uint32(len(m.Payload))
+	return &m, nil
+}
+
+// Dispatch examines msg (expected TypeID=20 or 17) and routes to the
+// appropriate handler. It returns an error for parse/handler failures,
+// after sending the failure response and, for errors that end the
+// connection, calling Close. Unknown commands are logged at warn level and produce no error.
 func (d *Dispatcher) Dispatch(msg *chunk.Message) error {
+	cmd, err := decodeCommand(msg)
+	if err == nil {
+		err = d.route(cmd)
+	}
+	if err != nil {
+		d.fail(cmd, err)
+	}
+	return err
+}
+
+// decodeCommand decodes msg's AMF0 payload and reads the command name.
+func decodeCommand(msg *chunk.Message) (*command, error) {
+	cmd := &command{msg: msg}
 	if msg == nil {
-		return errors.NewProtocolError("dispatch", fmt.Errorf("nil message"))
+		return cmd, errors.NewProtocolError("dispatch", fmt.Errorf("nil message"))
+	}
+	if msg.TypeID == commandMessageAMF3TypeID {
+		amf0, err := amf0Command(msg)
+		if err != nil {
+			return cmd, err
+		}
+		msg, cmd.msg = amf0, amf0
 	}
 	if msg.TypeID != commandMessageAMF0TypeID {
-		return errors.NewProtocolError("dispatch", fmt.Errorf("unexpected message type %d", msg.TypeID))
+		return cmd, errors.NewProtocolError("dispatch", fmt.Errorf("unexpected message type %d", msg.TypeID))
 	}
 
 	// Decode all AMF0 values. We decode once then branch; per current scope
@@ -77,16 +166,22 @@ func (d *Dispatcher) Dispatch(msg *chunk.Message) error {
 	// a single-value streaming decoder to read just the first marker.)
 	vals, err := amf.DecodeAll(msg.Payload)
 	if err != nil {
-		return errors.NewProtocolError("dispatch.decode", err)
+		return cmd, errors.NewProtocolError("dispatch.decode", err)
 	}
 	if len(vals) == 0 {
-		return errors.NewProtocolError("dispatch", fmt.Errorf("empty AMF payload"))
+		return cmd, errors.NewProtocolError("dispatch", fmt.Errorf("empty AMF payload"))
 	}
 	name, ok := vals[0].(string)
 	if !ok {
-		return errors.NewProtocolError("dispatch", fmt.Errorf("first AMF value not a string (command name)"))
+		return cmd, errors.NewProtocolError("dispatch", fmt.Errorf("first AMF value not a string (command name)"))
 	}
+	cmd.name, cmd.vals = name, vals
+	return cmd, nil
+}
 
+// route parses cmd and calls its handler.
+func (d *Dispatcher) route(cmd *command) error {
+	name, vals, msg := cmd.name, cmd.vals, cmd.msg
 	switch name {
 	case "connect":
 		d.log.Debug("dispatching connect command")
@@ -97,8 +192,11 @@ func (d *Dispatcher) Dispatch(msg *chunk.Message) error {
 		d.log.Debug("parsing connect command")
 		cc, err := ParseConnectCommand(msg)
 		if err != nil {
-			d.log.Error("connect parse error", "error", err)
-			return err
+			code, desc := CodeConnectRejected, "Invalid connect command."
+			if stderrors.Is(err, ErrMissingApp) {
+				code, desc = CodeConnectInvalidApp, "Application name required."
+			}
+			return malformed(name, code, desc, err)
 		}
 		d.log.Debug("invoking OnConnect handler", "app", cc.App, "tcUrl", cc.TcURL)
 		return d.OnConnect(cc, msg)
@@ -111,8 +209,7 @@ func (d *Dispatcher) Dispatch(msg *chunk.Message) error {
 		d.log.Debug("parsing createStream command")
 		cs, err := ParseCreateStreamCommand(msg)
 		if err != nil {
-			d.log.Error("createStream parse error", "error", err)
-			return err
+			return malformed(name, CodeCallFailed, "Invalid createStream command.", err)
 		}
 		d.log.Debug("invoking OnCreateStream handler", "txn_id", cs.TransactionID)
 		return d.OnCreateStream(cs, msg)
@@ -123,8 +220,9 @@ func (d *Dispatcher) Dispatch(msg *chunk.Message) error {
 		app := d.currentApp()
 		pc, err := ParsePublishCommand(app, msg)
 		if err != nil {
-			return err
+			return malformed(name, CodePublishBadName, "Invalid publish command.", err)
 		}
+		cmd.key = pc.StreamKey
 		return d.OnPublish(pc, msg)
 	case "play":
 		if d.OnPlay == nil {
@@ -133,8 +231,9 @@ func (d *Dispatcher) Dispatch(msg *chunk.Message) error {
 		app := d.currentApp()
 		pl, err := ParsePlayCommand(msg, app)
 		if err != nil {
-			return err
+			return malformed(name, CodePlayFailed, "Invalid play command.", err)
 		}
+		cmd.key = pl.StreamKey
 		return d.OnPlay(pl, msg)
 	case "deleteStream":
 		if d.OnDeleteStream == nil {
@@ -151,20 +250,121 @@ func (d *Dispatcher) Dispatch(msg *chunk.Message) error {
 			return nil
 		}
 		return d.OnCloseStream(vals, msg)
+	case "pause":
+		// pause is sent by players on a play stream. Without a handler it is
+		// ignored like other optional commands (playback simply continues).
+		if d.OnPause == nil {
+			d.log.Debug("ignoring pause (no handler registered)")
+			return nil
+		}
+		pc, err := ParsePauseCommand(msg)
+		if err != nil {
+			return malformed(name, CodePlayFailed, "Invalid pause command.", err)
+		}
+		return d.OnPause(pc, msg)
+	case "seek":
+		if d.OnSeek == nil {
+			d.log.Debug("ignoring seek (no handler registered)")
+			return nil
+		}
+		sc, err := ParseSeekCommand(msg)
+		if err != nil {
+			return malformed(name, CodeSeekFailed, "Invalid seek command.", err)
+		}
+		return d.OnSeek(sc, msg)
+	case "receiveAudio", "receiveVideo":
+		// Without a handler both tracks keep flowing, as for pause.
+		if d.OnReceive == nil {
+			d.log.Debug("ignoring track selection (no handler registered)", "name", name)
+			return nil
+		}
+		rc, err := ParseReceiveCommand(msg)
+		if err != nil {
+			return malformed(name, CodePlayFailed, "Invalid "+name+" command.", err)
+		}
+		return d.OnReceive(rc, msg)
+	case "getStreamLength":
+		gc, err := ParseGetStreamLengthCommand(msg, d.currentApp())
+		if err != nil {
+			return malformed(name, CodeCallFailed, "Invalid getStreamLength command.", err)
+		}
+		var length float64
+		if d.OnGetStreamLength != nil {
+			if length, err = d.OnGetStreamLength(gc, msg); err != nil {
+				return err
+			}
+		}
+		d.replyResult(gc.TransactionID, length)
+		return nil
+	case "checkBandwidth", "_checkbw":
+		// Bandwidth checks are not performed; answer at once so the client
+		// proceeds as if the check had finished.
+		d.log.Debug("answering bandwidth check", "name", name)
+		d.replyResult(transactionID(vals))
+		if done, err := BuildOnBWDone(); err == nil && d.Reply != nil {
+			if err := d.Reply(done); err != nil {
+				d.log.Debug("onBWDone send failed", "error", err)
+			}
+		}
+		return nil
 	case "releaseStream", "FCPublish", "FCUnpublish":
-		// OBS/FFmpeg pre-publish commands - treat as no-ops for now
-		// These are optional Flash Media Server extensions
-		d.log.Debug("ignoring optional command", "name", name)
+		// Flash Media Server extensions around publish; nothing to do but
+		// answer like FMS, for the clients that wait for it.
+		d.log.Debug("answering optional command", "name", name)
+		if txn := transactionID(vals); txn != 0 {
+			d.replyResult(txn)
+		}
+		if name != "releaseStream" && d.Reply != nil {
+			var streamName string
+			if len(vals) > 3 {
+				streamName, _ = vals[3].(string)
+			}
+			if ev, err := BuildOnFCPublish(name == "FCUnpublish", streamName); err == nil {
+				if err := d.Reply(ev); err != nil {
+					d.log.Debug("onFCPublish send failed", "error", err)
+				}
+			}
+		}
 		return nil
 	default:
 		// Unknown command – log warning (requirements) then ignore.
 		// Capture a short hex preview of payload for debugging.
 		preview := previewHex(msg.Payload, 32)
 		d.log.Warn("unknown command", "name", name, "len", len(vals), "payload_preview", preview)
+		// A call with a transaction ID expects a reply; fail it rather
+		// than leave the client waiting.
+		if transactionID(vals) != 0 {
+			d.replyError(vals, CodeCallFailed, fmt.Sprintf("Method not found (%s).", name))
+		}
 		return nil
 	}
 }
 
+// fail sends the failure response for err, returned while dispatching cmd,
+// and closes the connection if err ends it.
+func (d *Dispatcher) fail(cmd *command, err error) {
+	f := FailureFor(cmd.name, err)
+	switch {
+	case cmd.name == "":
+		// Not a decodable command: there is nothing to answer.
+	case isStreamCommand(cmd.name):
+		d.replyStatus(cmd.msg, cmd.key, f.Code, f.Description)
+	case transactionID(cmd.vals) != 0:
+		d.replyError(cmd.vals, f.Code, f.Description)
+	}
+	if f.Close && d.Close != nil {
+		if err := d.Close(); err != nil {
+			d.log.Debug("close after failed command", "error", err)
+		}
+	}
+}
+
+// malformed reports a command that failed to parse: the client is told
+// code and description, then the connection is closed.
+func malformed(name, code, description string, err error) error {
+	return &errors.CommandError{Op: name, Code: code, Description: description, Close: true, Err: err}
+}
+
 func (d *Dispatcher) currentApp() string {
 	if d.appProvider == nil {
 		return ""
@@ -172,8 +372,67 @@ func (d *Dispatcher) currentApp() string {
 	return d.appProvider()
 }
 
+// transactionID returns a command's transaction ID (vals[1]), or 0.
+func transactionID(vals []interface{}) float64 {
+	var txn float64
+	if len(vals) > 1 {
+		txn, _ = vals[1].(float64)
+	}
+	return txn
+}
+
+// replyResult sends a _result response with values when a Reply function
+// is configured.
+func (d *Dispatcher) replyResult(txn float64, values ...interface{}) {
+	if d.Reply == nil {
+		return
+	}
+	resp, err := BuildResult(txn, values...)
+	if err != nil {
+		d.log.Error("result build failed", "error", err)
+		return
+	}
+	if err := d.Reply(resp); err != nil {
+		d.log.Debug("result send failed", "error", err)
+	}
+}
+
+// replyError sends an _error response echoing the request's transaction ID
+// (vals[1]) when a Reply function is configured.
+func (d *Dispatcher) replyError(vals []interface{}, code, description string) {
+	if d.Reply == nil {
+		return
+	}
+	resp, err := BuildErrorResponse(transactionID(vals), code, description)
+	if err != nil {
+		d.log.Error("error response build failed", "error", err)
+		return
+	}
+	if err := d.Reply(resp); err != nil {
+		d.log.Debug("error response send failed", "error", err)
+	}
+}
+
+// replyStatus sends an error-level onStatus on the command's message stream
+// when a Reply function is configured. details is the stream key, if known.
+func (d *Dispatcher) replyStatus(msg *chunk.Message, details, code, description string) {
+	if d.Reply == nil {
+		return
+	}
+	resp, err := BuildStatusReply(d.TxnMode, msg, Status{Level: LevelError, Code: code, Description: description, Details: details})
+	if err != nil {
+		d.log.Error("onStatus build failed", "error", err)
+		return
+	}
+	if err := d.Reply(resp); err != nil {
+		d.log.Debug("onStatus send failed", "error", err)
+	}
+}
+
+// noHandlerErr refuses a command the server has no handler for.
 func (d *Dispatcher) noHandlerErr(name string) error {
-	return errors.NewProtocolError("dispatch", fmt.Errorf("no handler registered for command %q", name))
+	code, _ := genericFailure(name)
+	return errors.NewCommandError(name, code, "Command not supported.", fmt.Errorf("no handler registered for command %q", name))
 }
 
 // previewHex returns a small hex string of the first n bytes of b.
@@ -12,9 +12,11 @@ package rpc
 
 import (
 	"bytes"
+	stderrors "errors"
 	"strings"
 	"testing"
 
+	"github.com/alxayo/go-rtmp/internal/errors"
 	"github.com/alxayo/go-rtmp/internal/logger"
 	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
 	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
@@ -95,6 +97,32 @@ func TestDispatcher_DispatchKnownCommands(t *testing.T) {
 	}
 }
 
+// TestDispatcher_AMF3CommandMessage checks that an AMF3 command message
+// (TypeID 17) whose values are AMF0 after the format byte is routed like an
+// AMF0 one, and that other format bytes are rejected as malformed.
+func TestDispatcher_AMF3CommandMessage(t *testing.T) {
+	d := NewDispatcher(func() string { return "live" })
+	var key string
+	var typeID uint8
+	d.OnPlay = func(p *PlayCommand, msg *chunk.Message) error {
+		key, typeID = p.StreamKey, msg.TypeID
+		return nil
+	}
+	amf0 := buildCmd(t, "play", 0.0, nil, "show")
+	msg := &chunk.Message{TypeID: commandMessageAMF3TypeID, MessageStreamID: 1, Payload: append([]byte{0}, amf0.Payload...)}
+	if err := d.Dispatch(msg); err != nil {
+		t.Fatalf("dispatch AMF3 play: %v", err)
+	}
+	if key != "live/show" || typeID != commandMessageAMF0TypeID {
+		t.Fatalf("handler got key=%q type=%d", key, typeID)
+	}
+
+	msg.Payload[0] = 0x11 // avmplus marker: AMF3 values
+	if err := d.Dispatch(msg); !errors.IsProtocolError(err) {
+		t.Fatalf("expected protocol error for AMF3 values, got %v", err)
+	}
+}
+
 // TestDispatcher_UnknownCommand dispatches a command name the dispatcher
 // doesn't recognize ("someWeirdCommand") and verifies it doesn't error
 // but does log a warning containing "unknown command".
@@ -150,11 +178,11 @@ func TestDispatcher_DeleteStream(t *testing.T) {
 }
 
 // TestDispatcher_DeleteStream_NoHandler verifies that dispatching deleteStream
-// without a registered handler returns a protocol error (so the caller can
-// log it) rather than silently swallowing it.
+// without a registered handler returns an error (so the caller can log it)
+// rather than silently swallowing it.
 func TestDispatcher_DeleteStream_NoHandler(t *testing.T) {
 	d := NewDispatcher(nil)
-	// No OnDeleteStream handler set — should return a protocol error.
+	// No OnDeleteStream handler set — should return an error.
 	err := d.Dispatch(buildCmd(t, "deleteStream", 0.0, nil, 1.0))
 	if err == nil {
 		t.Fatal("expected error when no deleteStream handler is registered")
@@ -199,3 +227,206 @@ func TestDispatcher_CloseStream_NoHandler(t *testing.T) {
 		t.Fatalf("closeStream without handler should not error, got: %v", err)
 	}
 }
+
+// TestDispatcher_PauseSeek verifies pause and seek are parsed and routed to
+// their handlers, and are ignored without error when no handler is set.
+func TestDispatcher_PauseSeek(t *testing.T) {
+	d := NewDispatcher(nil)
+	if err := d.Dispatch(buildCmd(t, "pause", 0.0, nil, true, 100.0)); err != nil {
+		t.Fatalf("pause without handler should not error, got: %v", err)
+	}
+
+	var paused bool
+	var seekMs int64 = -1
+	d.OnPause = func(pc *PauseCommand, msg *chunk.Message) error { paused = pc.Pause; return nil }
+	d.OnSeek = func(sc *SeekCommand, msg *chunk.Message) error { seekMs = sc.Milliseconds; return nil }
+	if err := d.Dispatch(buildCmd(t, "pause", 0.0, nil, true, 100.0)); err != nil {
+		t.Fatalf("dispatch pause: %v", err)
+	}
+	if err := d.Dispatch(buildCmd(t, "seek", 0.0, nil, 2500.0)); err != nil {
+		t.Fatalf("dispatch seek: %v", err)
+	}
+	if !paused || seekMs != 2500 {
+		t.Fatalf("handlers not invoked correctly: paused=%v seekMs=%d", paused, seekMs)
+	}
+}
+
+// TestDispatcher_ReplyOnParseFailure checks that parse failures send an
+// _error (connect) or error-level onStatus (publish) through Reply while
+// still returning the error.
+func TestDispatcher_ReplyOnParseFailure(t *testing.T) {
+	var sent []*chunk.Message
+	d := NewDispatcher(func() string { return "live" })
+	d.OnConnect = func(*ConnectCommand, *chunk.Message) error { return nil }
+	d.OnPublish = func(*PublishCommand, *chunk.Message) error { return nil }
+	d.Reply = func(m *chunk.Message) error { sent = append(sent, m); return nil }
+
+	// connect without app -> _error NetConnection.Connect.InvalidApp echoing txn 1
+	if err := d.Dispatch(buildCmd(t, "connect", 1.0, map[string]interface{}{"tcUrl": "rtmp://h/"})); err == nil {
+		t.Fatalf("expected connect parse error")
+	}
+	// publish with non-string name -> onStatus NetStream.Publish.BadName
+	pub := buildCmd(t, "publish", 0.0, nil, 42.0, "live")
+	pub.MessageStreamID = 1
+	if err := d.Dispatch(pub); err == nil {
+		t.Fatalf("expected publish parse error")
+	}
+
+	if len(sent) != 2 {
+		t.Fatalf("expected 2 replies, got %d", len(sent))
+	}
+	vals, _ := amf.DecodeAll(sent[0].Payload)
+	if vals[0] != "_error" || vals[1] != 1.0 || vals[3].(map[string]interface{})["code"] != CodeConnectInvalidApp {
+		t.Fatalf("unexpected connect reply: %#v", vals)
+	}
+	vals, _ = amf.DecodeAll(sent[1].Payload)
+	info := vals[3].(map[string]interface{})
+	if vals[0] != "onStatus" || sent[1].MessageStreamID != 1 || info["code"] != CodePublishBadName || info["level"] != LevelError {
+		t.Fatalf("unexpected publish reply: %#v", vals)
+	}
+}
+
+// TestDispatcher_NetConnectionCalls checks that getStreamLength,
+// checkBandwidth and unknown calls with a transaction ID are answered, so
+// the client does not wait for a reply that never comes.
+func TestDispatcher_NetConnectionCalls(t *testing.T) {
+	logger.UseWriter(&bytes.Buffer{})
+	var sent []*chunk.Message
+	d := NewDispatcher(func() string { return "vod" })
+	d.Reply = func(m *chunk.Message) error { sent = append(sent, m); return nil }
+	var gotKey string
+	d.OnGetStreamLength = func(gc *GetStreamLengthCommand, _ *chunk.Message) (float64, error) {
+		gotKey = gc.StreamKey
+		return 12.5, nil
+	}
+
+	for _, cmd := range []*chunk.Message{
+		buildCmd(t, "getStreamLength", 3.0, nil, "movie?token=x"),
+		buildCmd(t, "checkBandwidth", 4.0, nil),
+		buildCmd(t, "customMethod", 5.0, nil, "arg"),
+		buildCmd(t, "customNotify", 0.0, nil),
+	} {
+		if err := d.Dispatch(cmd); err != nil {
+			t.Fatalf("dispatch: %v", err)
+		}
+	}
+	if gotKey != "vod/movie" {
+		t.Fatalf("getStreamLength key = %q, want vod/movie", gotKey)
+	}
+	want := [][]interface{}{
+		{"_result", 3.0, nil, 12.5},
+		{"_result", 4.0, nil},
+		{"onBWDone", 0.0, nil},
+		{"_error", 5.0, nil},
+	}
+	if len(sent) != len(want) {
+		t.Fatalf("expected %d replies, got %d", len(want), len(sent))
+	}
+	for i, w := range want {
+		vals, err := amf.DecodeAll(sent[i].Payload)
+		if err != nil || len(vals) < len(w) {
+			t.Fatalf("reply %d: %#v, %v", i, vals, err)
+		}
+		for j := range w {
+			if vals[j] != w[j] {
+				t.Fatalf("reply %d = %#v, want prefix %#v", i, vals, w)
+			}
+		}
+	}
+	vals, _ := amf.DecodeAll(sent[3].Payload)
+	if vals[3].(map[string]interface{})["code"] != CodeCallFailed {
+		t.Fatalf("unknown call reply: %#v", vals)
+	}
+}
+
+// TestDispatcher_HandlerFailures checks that errors returned by handlers are
+// answered by the dispatcher: a CommandError with its own status, other
+// errors with the command's generic failure status. Only errors that end
+// the connection (CommandError.Close, malformed commands) call Close.
+func TestDispatcher_HandlerFailures(t *testing.T) {
+	var sent []*chunk.Message
+	closes := 0
+	d := NewDispatcher(func() string { return "live" })
+	d.Reply = func(m *chunk.Message) error { sent = append(sent, m); return nil }
+	d.Close = func() error { closes++; return nil }
+	d.OnPublish = func(*PublishCommand, *chunk.Message) error {
+		return errors.NewCommandError("publish", CodePublishBadName, "Stream live/foo is already being published.", nil)
+	}
+	d.OnPlay = func(*PlayCommand, *chunk.Message) error { return stderrors.New("boom") }
+	d.OnConnect = func(*ConnectCommand, *chunk.Message) error {
+		return &errors.CommandError{Op: "connect", Code: CodeConnectRejected, Description: "Go away.", Close: true}
+	}
+
+	tests := []struct {
+		name   string
+		msg    *chunk.Message
+		reply  string // first AMF value of the reply; "" for none
+		code   string
+		closes int
+	}{
+		{"refused publish", buildCmd(t, "publish", 0.0, nil, "foo", "live"), "onStatus", CodePublishBadName, 0},
+		{"failed play", buildCmd(t, "play", 0.0, nil, "bar"), "onStatus", CodePlayFailed, 0},
+		{"refused connect closes", buildCmd(t, "connect", 1.0, map[string]interface{}{"app": "live"}), "_error", CodeConnectRejected, 1},
+		{"malformed play closes", buildCmd(t, "play", 0.0, nil), "onStatus", CodePlayFailed, 1},
+		{"undecodable closes", &chunk.Message{TypeID: commandMessageAMF0TypeID, Payload: []byte{0xFF}}, "", "", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sent, closes = nil, 0
+			if err := d.Dispatch(tt.msg); err == nil {
+				t.Fatalf("expected error")
+			}
+			if closes != tt.closes {
+				t.Fatalf("Close called %d times, want %d", closes, tt.closes)
+			}
+			if tt.reply == "" {
+				if len(sent) != 0 {
+					t.Fatalf("expected no reply, got %d", len(sent))
+				}
+				return
+			}
+			if len(sent) != 1 {
+				t.Fatalf("expected 1 reply, got %d", len(sent))
+			}
+			vals, _ := amf.DecodeAll(sent[0].Payload)
+			if vals[0] != tt.reply || vals[3].(map[string]interface{})["code"] != tt.code {
+				t.Fatalf("unexpected reply: %#v", vals)
+			}
+		})
+	}
+}
+
+// TestDispatcher_Receive verifies receiveAudio and receiveVideo are routed
+// to OnReceive with their track and flag, and that a missing flag is
+// answered with onStatus.
+func TestDispatcher_Receive(t *testing.T) {
+	var got []ReceiveCommand
+	var sent []*chunk.Message
+	d := NewDispatcher(nil)
+	d.Reply = func(m *chunk.Message) error { sent = append(sent, m); return nil }
+	if err := d.Dispatch(buildCmd(t, "receiveVideo", 0.0, nil, false)); err != nil {
+		t.Fatalf("receiveVideo without handler should not error, got: %v", err)
+	}
+
+	d.OnReceive = func(rc *ReceiveCommand, msg *chunk.Message) error { got = append(got, *rc); return nil }
+	if err := d.Dispatch(buildCmd(t, "receiveVideo", 0.0, nil, false)); err != nil {
+		t.Fatalf("dispatch receiveVideo: %v", err)
+	}
+	if err := d.Dispatch(buildCmd(t, "receiveAudio", 0.0, nil, true)); err != nil {
+		t.Fatalf("dispatch receiveAudio: %v", err)
+	}
+	want := []ReceiveCommand{{Video: true, Receive: false}, {Video: false, Receive: true}}
+	if len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("OnReceive got %+v, want %+v", got, want)
+	}
+
+	if err := d.Dispatch(buildCmd(t, "receiveAudio", 0.0, nil)); err == nil {
+		t.Fatal("receiveAudio without a flag accepted")
+	}
+	if len(sent) != 1 {
+		t.Fatalf("sent %d replies to the malformed command, want 1 onStatus", len(sent))
+	}
+	if vals, _ := amf.DecodeAll(sent[0].Payload); len(vals) == 0 || vals[0] != "onStatus" {
+		t.Fatalf("reply = %v, want onStatus", vals)
+	}
+}
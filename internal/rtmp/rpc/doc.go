@@ -20,12 +20,36 @@
 // callbacks. It decodes AMF0, identifies the command name, parses it into
 // a strongly-typed struct, and invokes the corresponding handler.
 //
-// Unknown commands (including OBS/FFmpeg extensions like releaseStream,
-// FCPublish) are logged and gracefully ignored.
+// The OBS/FFmpeg pre-publish extensions releaseStream, FCPublish and
+// FCUnpublish are answered as Flash Media Server answers them. Other unknown
+// commands are logged and ignored, or failed with _error when they carry a
+// transaction ID.
+//
+// # Transaction IDs
+//
+// _result and _error echo the transaction ID of the command they answer.
+// The onStatus answering a stream command carries 0, or with [TxnModeEcho]
+// the command's own ID ([BuildStatusReply]); see txn.go.
+//
+// # Failures
+//
+// Handlers report failures by returning an error; the Dispatcher answers
+// the client. [FailureFor] picks the status: a [errors.CommandError] gives
+// its own code and description, any other error the command's generic
+// failure. Stream commands get an error-level onStatus and calls with a
+// transaction ID an _error. Malformed commands and errors that ask for it
+// then close the connection through Dispatcher.Close.
 //
 // # Response Builders
 //
 //   - [BuildConnectResponse]: Creates a _result message for connect.
 //   - [BuildCreateStreamResponse]: Creates a _result message with the
 //     allocated stream ID.
+//   - [BuildOnStatus]: Creates an onStatus event from a [Status] using the
+//     standard level and code constants (LevelError, CodePublishBadName, ...).
+//   - [BuildErrorResponse]: Creates an _error reply for a failed
+//     transactional command such as connect.
+//   - [BuildStatusReply]: Creates the onStatus answering a stream command,
+//     with the transaction ID of the configured mode.
+//   - [BuildOnFCPublish]: Creates the onFCPublish/onFCUnpublish event.
 package rpc
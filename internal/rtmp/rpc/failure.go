@@ -0,0 +1,75 @@
+package rpc
+
+// failure.go maps command errors to what the client is told.
+//
+// Handlers return errors instead of sending failure replies themselves, and
+// the Dispatcher reports every failure the same way:
+//
+//   - A *errors.CommandError is a refusal. The client gets its Code and
+//     Description, and the connection stays open unless Close is set.
+//   - A protocol-layer error (errors.IsProtocolError) is a malformed or
+//     out-of-order command. The client gets the command's generic failure
+//     status where a reply is possible, then the connection is closed.
+//   - Anything else is an internal failure. The client gets the command's
+//     generic failure status and the connection stays open.
+//
+// The reply is an error-level onStatus for stream commands (publish, play,
+// pause, seek) and an _error for calls with a transaction ID.
+
+import (
+	stderrors "errors"
+
+	"github.com/alxayo/go-rtmp/internal/errors"
+)
+
+// Failure is how a failed command is reported.
+type Failure struct {
+	Code        string // status code of the reply
+	Description string // status description of the reply
+	Close       bool   // close the connection after the reply
+}
+
+// FailureFor classifies err, returned while handling command name.
+func FailureFor(name string, err error) Failure {
+	var ce *errors.CommandError
+	if stderrors.As(err, &ce) {
+		return Failure{Code: ce.Code, Description: ce.Description, Close: ce.Close}
+	}
+	code, desc := genericFailure(name)
+	return Failure{Code: code, Description: desc, Close: errors.IsProtocolError(err)}
+}
+
+// IsFatal reports whether err ends the connection it occurred on.
+func IsFatal(err error) bool {
+	return err != nil && FailureFor("", err).Close
+}
+
+// genericFailure is the status reported for a failed command that carries
+// no CommandError.
+func genericFailure(name string) (code, description string) {
+	switch name {
+	case "connect":
+		return CodeConnectRejected, "Connect failed."
+	case "publish":
+		return CodePublishFailed, "Publish failed."
+	case "play":
+		return CodePlayFailed, "Play failed."
+	case "pause":
+		return CodePlayFailed, "Pause failed."
+	case "seek":
+		return CodeSeekFailed, "Seek failed."
+	case "":
+		return CodeCallFailed, "Invalid command."
+	}
+	return CodeCallFailed, name + " failed."
+}
+
+// isStreamCommand reports whether name is answered with onStatus on its
+// message stream rather than with _error.
+func isStreamCommand(name string) bool {
+	switch name {
+	case "publish", "play", "pause", "seek", "receiveAudio", "receiveVideo":
+		return true
+	}
+	return false
+}
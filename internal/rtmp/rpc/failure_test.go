@@ -0,0 +1,49 @@
+// failure_test.go – tests for mapping command errors to client replies.
+package rpc
+
+import (
+	stderrors "errors"
+	"fmt"
+	"testing"
+
+	"github.com/alxayo/go-rtmp/internal/errors"
+)
+
+func TestFailureFor(t *testing.T) {
+	parseErr := errors.NewProtocolError("play.parse", fmt.Errorf("missing stream name"))
+	tests := []struct {
+		name    string
+		command string
+		err     error
+		want    Failure
+	}{
+		{"command error", "publish",
+			errors.NewCommandError("publish", CodePublishBadName, "Taken.", nil),
+			Failure{Code: CodePublishBadName, Description: "Taken."}},
+		{"wrapped command error", "play",
+			fmt.Errorf("origin: %w", errors.NewCommandError("play", CodePlayStreamNotFound, "Not here.", nil)),
+			Failure{Code: CodePlayStreamNotFound, Description: "Not here."}},
+		{"closing command error", "publish",
+			&errors.CommandError{Code: CodePublishUnauthorized, Description: "Authentication failed.", Close: true},
+			Failure{Code: CodePublishUnauthorized, Description: "Authentication failed.", Close: true}},
+		{"protocol error", "play", parseErr,
+			Failure{Code: CodePlayFailed, Description: "Play failed.", Close: true}},
+		{"internal error", "connect", stderrors.New("encode failed"),
+			Failure{Code: CodeConnectRejected, Description: "Connect failed."}},
+		{"internal error in call", "getStreamLength", stderrors.New("io"),
+			Failure{Code: CodeCallFailed, Description: "getStreamLength failed."}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FailureFor(tt.command, tt.err); got != tt.want {
+				t.Fatalf("FailureFor = %+v, want %+v", got, tt.want)
+			}
+			if IsFatal(tt.err) != tt.want.Close {
+				t.Fatalf("IsFatal = %v, want %v", IsFatal(tt.err), tt.want.Close)
+			}
+		})
+	}
+	if IsFatal(nil) {
+		t.Fatalf("IsFatal(nil) = true")
+	}
+}
@@ -0,0 +1,55 @@
+package rpc
+
+import (
+	"fmt"
+
+	"github.com/alxayo/go-rtmp/internal/errors"
+	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+)
+
+// PauseCommand represents a parsed "pause" command.
+// Spec form: ["pause", 0, null, pauseFlag, milliseconds]
+type PauseCommand struct {
+	Pause        bool  // true = pause, false = resume
+	Milliseconds int64 // stream time at which the client paused/resumed
+}
+
+// ParsePauseCommand parses an AMF0 command message assumed to contain a
+// "pause" invocation. Expected AMF0 sequence:
+//
+//	0: string "pause"
+//	1: number transaction ID (0) - ignored
+//	2: null - ignored
+//	3: boolean pause/unpause flag - required
+//	4: number milliseconds - optional
+func ParsePauseCommand(msg *chunk.Message) (*PauseCommand, error) {
+	if msg == nil {
+		return nil, errors.NewProtocolError("pause.parse", fmt.Errorf("nil message"))
+	}
+	if msg.TypeID != commandMessageAMF0TypeID {
+		return nil, errors.NewProtocolError("pause.parse", fmt.Errorf("unexpected message type %d", msg.TypeID))
+	}
+	vals, err := amf.DecodeAll(msg.Payload)
+	if err != nil {
+		return nil, errors.NewProtocolError("pause.parse.decode", err)
+	}
+	if len(vals) < 4 {
+		return nil, errors.NewProtocolError("pause.parse", fmt.Errorf("expected >=4 AMF values, got %d", len(vals)))
+	}
+	name, ok := vals[0].(string)
+	if !ok || name != "pause" {
+		return nil, errors.NewProtocolError("pause.parse", fmt.Errorf("first value must be string 'pause'"))
+	}
+	flag, ok := vals[3].(bool)
+	if !ok {
+		return nil, errors.NewProtocolError("pause.parse", fmt.Errorf("pause flag must be boolean"))
+	}
+	pc := &PauseCommand{Pause: flag}
+	if len(vals) >= 5 {
+		if v, ok := vals[4].(float64); ok && v > 0 {
+			pc.Milliseconds = int64(v)
+		}
+	}
+	return pc, nil
+}
@@ -0,0 +1,52 @@
+// pause_test.go – tests for parsing the RTMP "pause" and "seek" commands.
+//
+// Players send these on a play stream to control playback:
+//
+//	["pause", 0.0, null, pauseFlag, milliseconds]
+//	["seek",  0.0, null, milliseconds]
+package rpc
+
+import "testing"
+
+// TestParsePauseCommand covers pause, unpause, and a missing flag.
+func TestParsePauseCommand(t *testing.T) {
+	pc, err := ParsePauseCommand(buildCmd(t, "pause", 0.0, nil, true, 1500.0))
+	if err != nil {
+		t.Fatalf("ParsePauseCommand error: %v", err)
+	}
+	if !pc.Pause || pc.Milliseconds != 1500 {
+		t.Fatalf("unexpected pause command: %+v", pc)
+	}
+
+	pc, err = ParsePauseCommand(buildCmd(t, "pause", 0.0, nil, false))
+	if err != nil {
+		t.Fatalf("ParsePauseCommand (unpause) error: %v", err)
+	}
+	if pc.Pause || pc.Milliseconds != 0 {
+		t.Fatalf("unexpected unpause command: %+v", pc)
+	}
+
+	if _, err := ParsePauseCommand(buildCmd(t, "pause", 0.0, nil, "yes")); err == nil {
+		t.Fatalf("expected error for non-boolean pause flag")
+	}
+}
+
+// TestParseSeekCommand verifies the position is read and negatives clamp to 0.
+func TestParseSeekCommand(t *testing.T) {
+	sc, err := ParseSeekCommand(buildCmd(t, "seek", 0.0, nil, 30000.0))
+	if err != nil {
+		t.Fatalf("ParseSeekCommand error: %v", err)
+	}
+	if sc.Milliseconds != 30000 {
+		t.Fatalf("expected 30000ms, got %d", sc.Milliseconds)
+	}
+
+	sc, err = ParseSeekCommand(buildCmd(t, "seek", 0.0, nil, -5.0))
+	if err != nil || sc.Milliseconds != 0 {
+		t.Fatalf("expected clamp to 0, got %+v err=%v", sc, err)
+	}
+
+	if _, err := ParseSeekCommand(buildCmd(t, "seek", 0.0, nil)); err == nil {
+		t.Fatalf("expected error for missing position")
+	}
+}
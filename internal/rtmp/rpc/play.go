@@ -63,7 +63,7 @@ func ParsePlayCommand(msg *chunk.Message, app string) (*PlayCommand, error) {
 
 	// Parse query parameters from the stream name
 	parsed := auth.ParseStreamURL(rawName)
-	streamName := parsed.StreamName
+	streamName := NormalizeStreamName(parsed.StreamName)
 	if streamName == "" {
 		return nil, errors.NewProtocolError("play.parse", fmt.Errorf("empty stream name after query parse"))
 	}
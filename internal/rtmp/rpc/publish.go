@@ -9,9 +9,17 @@ import (
 	"github.com/alxayo/go-rtmp/internal/rtmp/server/auth"
 )
 
+// Publishing types, the publish command's fifth value.
+const (
+	PublishLive   = "live"   // broadcast only
+	PublishRecord = "record" // broadcast and record to a new file
+	PublishAppend = "append" // broadcast and append to the stream's latest recording
+)
+
 // PublishCommand represents a parsed "publish" command.
 // Spec form: ["publish", 0, null, publishingName, publishingType]
-// The stream key is constructed as app + "/" + cleanName (without query params).
+// The stream key is constructed as app + "/" + cleanName (without query params,
+// normalized with NormalizeStreamName).
 type PublishCommand struct {
 	PublishingName string            // clean name without query params (e.g. "mystream")
 	PublishingType string            // one of: live|record|append
@@ -62,11 +70,11 @@ func ParsePublishCommand(app string, msg *chunk.Message) (*PublishCommand, error
 	}
 	// Parse query parameters from the stream name (e.g. "mystream?token=abc").
 	// Empty names default to "default" (some clients send empty string).
-	if rawName == "" {
-		rawName = "default"
-	}
 	parsed := auth.ParseStreamURL(rawName)
-	publishingName := parsed.StreamName
+	publishingName := NormalizeStreamName(parsed.StreamName)
+	if publishingName == "" {
+		publishingName = "default"
+	}
 
 	// 4: publishingType
 	publishingType, ok := vals[4].(string)
@@ -74,7 +82,7 @@ func ParsePublishCommand(app string, msg *chunk.Message) (*PublishCommand, error
 		return nil, errors.NewProtocolError("publish.parse", fmt.Errorf("publishingType required"))
 	}
 	switch publishingType {
-	case "live", "record", "append":
+	case PublishLive, PublishRecord, PublishAppend:
 		// valid
 	default:
 		return nil, errors.NewProtocolError("publish.parse", fmt.Errorf("unsupported publishingType %q", publishingType))
@@ -45,6 +45,26 @@ func TestParsePublishCommand_Valid(t *testing.T) {
 	}
 }
 
+// TestParsePublishCommand_NormalizedName verifies the publishing name is
+// normalized before the stream key is built, and that a name that is empty
+// once its query is removed falls back to "default".
+func TestParsePublishCommand_NormalizedName(t *testing.T) {
+	for raw, want := range map[string]string{
+		"/stream1/":  "app/stream1",
+		"a//b":       "app/a/b",
+		"?token=abc": "app/default",
+	} {
+		payload, _ := amf.EncodeAll("publish", 0.0, nil, raw, "live")
+		cmd, err := ParsePublishCommand("app", buildPublishMessage(payload))
+		if err != nil {
+			fatalf(t, "ParsePublishCommand(%q) error: %v", raw, err)
+		}
+		if cmd.StreamKey != want {
+			fatalf(t, "ParsePublishCommand(%q) key = %q, want %q", raw, cmd.StreamKey, want)
+		}
+	}
+}
+
 // TestParsePublishCommand_WithToken verifies that query parameters
 // (like ?token=abc) are parsed from the stream name and stripped from
 // PublishingName and StreamKey.
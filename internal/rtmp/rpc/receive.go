@@ -0,0 +1,49 @@
+package rpc
+
+import (
+	"fmt"
+
+	"github.com/alxayo/go-rtmp/internal/errors"
+	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+)
+
+// ReceiveCommand represents a parsed "receiveAudio" or "receiveVideo"
+// command, sent by players to stop or restart one track of a play stream.
+// Spec form: ["receiveAudio", 0, null, flag]
+type ReceiveCommand struct {
+	Video   bool // true for receiveVideo, false for receiveAudio
+	Receive bool // true = deliver the track, false = stop delivering it
+}
+
+// ParseReceiveCommand parses an AMF0 command message assumed to contain a
+// "receiveAudio" or "receiveVideo" invocation. Expected AMF0 sequence:
+//
+//	0: string "receiveAudio" or "receiveVideo"
+//	1: number transaction ID (0) - ignored
+//	2: null - ignored
+//	3: boolean flag - required
+func ParseReceiveCommand(msg *chunk.Message) (*ReceiveCommand, error) {
+	if msg == nil {
+		return nil, errors.NewProtocolError("receive.parse", fmt.Errorf("nil message"))
+	}
+	if msg.TypeID != commandMessageAMF0TypeID {
+		return nil, errors.NewProtocolError("receive.parse", fmt.Errorf("unexpected message type %d", msg.TypeID))
+	}
+	vals, err := amf.DecodeAll(msg.Payload)
+	if err != nil {
+		return nil, errors.NewProtocolError("receive.parse.decode", err)
+	}
+	if len(vals) < 4 {
+		return nil, errors.NewProtocolError("receive.parse", fmt.Errorf("expected >=4 AMF values, got %d", len(vals)))
+	}
+	name, _ := vals[0].(string)
+	if name != "receiveAudio" && name != "receiveVideo" {
+		return nil, errors.NewProtocolError("receive.parse", fmt.Errorf("first value must be string 'receiveAudio' or 'receiveVideo'"))
+	}
+	flag, ok := vals[3].(bool)
+	if !ok {
+		return nil, errors.NewProtocolError("receive.parse", fmt.Errorf("%s flag must be boolean", name))
+	}
+	return &ReceiveCommand{Video: name == "receiveVideo", Receive: flag}, nil
+}
@@ -0,0 +1,50 @@
+package rpc
+
+import (
+	"fmt"
+
+	"github.com/alxayo/go-rtmp/internal/errors"
+	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+)
+
+// SeekCommand represents a parsed "seek" command.
+// Spec form: ["seek", 0, null, milliseconds]
+type SeekCommand struct {
+	Milliseconds int64 // target position in the stream
+}
+
+// ParseSeekCommand parses an AMF0 command message assumed to contain a
+// "seek" invocation. Expected AMF0 sequence:
+//
+//	0: string "seek"
+//	1: number transaction ID (0) - ignored
+//	2: null - ignored
+//	3: number milliseconds - required, negative values are clamped to 0
+func ParseSeekCommand(msg *chunk.Message) (*SeekCommand, error) {
+	if msg == nil {
+		return nil, errors.NewProtocolError("seek.parse", fmt.Errorf("nil message"))
+	}
+	if msg.TypeID != commandMessageAMF0TypeID {
+		return nil, errors.NewProtocolError("seek.parse", fmt.Errorf("unexpected message type %d", msg.TypeID))
+	}
+	vals, err := amf.DecodeAll(msg.Payload)
+	if err != nil {
+		return nil, errors.NewProtocolError("seek.parse.decode", err)
+	}
+	if len(vals) < 4 {
+		return nil, errors.NewProtocolError("seek.parse", fmt.Errorf("expected >=4 AMF values, got %d", len(vals)))
+	}
+	name, ok := vals[0].(string)
+	if !ok || name != "seek" {
+		return nil, errors.NewProtocolError("seek.parse", fmt.Errorf("first value must be string 'seek'"))
+	}
+	ms, ok := vals[3].(float64)
+	if !ok {
+		return nil, errors.NewProtocolError("seek.parse", fmt.Errorf("seek position must be a number"))
+	}
+	if ms < 0 {
+		ms = 0
+	}
+	return &SeekCommand{Milliseconds: int64(ms)}, nil
+}
@@ -0,0 +1,134 @@
+package rpc
+
+// status.go builds onStatus events and _error responses.
+//
+// RTMP reports command outcomes in two ways:
+//   - Transactional commands (connect, createStream) get a "_result" or
+//     "_error" reply carrying the request's transaction ID.
+//   - Stream commands (publish, play, pause, seek) get an "onStatus" event
+//     on the message stream the command arrived on.
+//
+// Encoders such as OBS and FFmpeg wait for one of these replies. If a failure
+// is only logged on the server, the client hangs until its own timeout, so
+// failure paths should always send one of the messages built here.
+
+import (
+	"fmt"
+
+	"github.com/alxayo/go-rtmp/internal/errors"
+	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+)
+
+// onStatus / _error info object levels.
+const (
+	LevelStatus  = "status"
+	LevelWarning = "warning"
+	LevelError   = "error"
+)
+
+// Standard NetConnection / NetStream status codes used by this server.
+const (
+	CodeConnectSuccess    = "NetConnection.Connect.Success"
+	CodeConnectRejected   = "NetConnection.Connect.Rejected"
+	CodeConnectInvalidApp = "NetConnection.Connect.InvalidApp"
+	CodeCallFailed        = "NetConnection.Call.Failed"
+
+	CodePublishStart        = "NetStream.Publish.Start"
+	CodePublishBadName      = "NetStream.Publish.BadName"
+	CodePublishFailed       = "NetStream.Publish.Failed"
+	CodePublishUnauthorized = "NetStream.Publish.Unauthorized"
+	CodeUnpublishSuccess    = "NetStream.Unpublish.Success"
+
+	CodeRecordStart = "NetStream.Record.Start"
+	CodeRecordStop  = "NetStream.Record.Stop"
+
+	CodePlayStart          = "NetStream.Play.Start"
+	CodePlayStreamNotFound = "NetStream.Play.StreamNotFound"
+	CodePlayFailed         = "NetStream.Play.Failed"
+	CodePlayUnauthorized   = "NetStream.Play.Unauthorized"
+	CodePlayUnpublish      = "NetStream.Play.UnpublishNotify"
+
+	CodePauseNotify   = "NetStream.Pause.Notify"
+	CodeUnpauseNotify = "NetStream.Unpause.Notify"
+	CodeSeekNotify    = "NetStream.Seek.Notify"
+	CodeSeekFailed    = "NetStream.Seek.Failed"
+)
+
+// onStatusCSID is the chunk stream used for stream-level status events.
+const onStatusCSID = 5
+
+// Status is the info object carried by an onStatus event.
+type Status struct {
+	Level       string // LevelStatus, LevelWarning or LevelError
+	Code        string // e.g. CodePublishStart
+	Description string // human-readable text shown by some clients
+	Details     string // optional; conventionally the stream key
+
+	// TransactionID is 0 except in a reply echoing the ID of the command
+	// it answers (TxnModeEcho, see BuildStatusReply).
+	TransactionID float64
+}
+
+// BuildOnStatus builds an onStatus event for the given message stream:
+//
+//	["onStatus", transactionID, null, {level, code, description[, details]}]
+//
+// An empty Level defaults to LevelStatus. Details is omitted when empty.
+func BuildOnStatus(streamID uint32, st Status) (*chunk.Message, error) {
+	if st.Code == "" {
+		return nil, errors.NewProtocolError("onstatus.build", fmt.Errorf("status code required"))
+	}
+	level := st.Level
+	if level == "" {
+		level = LevelStatus
+	}
+	info := map[string]interface{}{
+		"level":       level,
+		"code":        st.Code,
+		"description": st.Description,
+	}
+	if st.Details != "" {
+		info["details"] = st.Details
+	}
+	payload, err := amf.EncodeAll("onStatus", st.TransactionID, nil, info)
+	if err != nil {
+		return nil, errors.NewProtocolError("onstatus.encode", fmt.Errorf("amf encode: %w", err))
+	}
+	return &chunk.Message{
+		CSID:            onStatusCSID,
+		TypeID:          commandMessageAMF0TypeID,
+		MessageStreamID: streamID,
+		Payload:         payload,
+		MessageLength:   uint32(len(payload)),
+	}, nil
+}
+
+// BuildErrorResponse builds the "_error" reply to a transactional command
+// (connect, createStream, ...):
+//
+//	["_error", transactionID, null, {level: "error", code, description}]
+//
+// The message is sent at connection level (MessageStreamID 0, CSID 3), like
+// the matching _result responses.
+func BuildErrorResponse(transactionID float64, code, description string) (*chunk.Message, error) {
+	if code == "" {
+		return nil, errors.NewProtocolError("error.response.build", fmt.Errorf("status code required"))
+	}
+	info := map[string]interface{}{
+		"level":       LevelError,
+		"code":        code,
+		"description": description,
+	}
+	payload, err := amf.EncodeAll("_error", transactionID, nil, info)
+	if err != nil {
+		return nil, errors.NewProtocolError("error.response.encode", fmt.Errorf("amf encode: %w", err))
+	}
+	return &chunk.Message{
+		CSID:            3, // Command messages use CSID 3 per RTMP conventions
+		TypeID:          commandMessageAMF0TypeID,
+		MessageStreamID: 0,
+		Payload:         payload,
+		MessageLength:   uint32(len(payload)),
+	}, nil
+}
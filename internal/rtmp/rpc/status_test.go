@@ -0,0 +1,75 @@
+// status_test.go – tests for the onStatus and _error builders.
+//
+// BuildOnStatus encodes ["onStatus", 0, null, info] on a message stream and
+// BuildErrorResponse encodes ["_error", txn, null, info] at connection level.
+// These tests decode the payloads back and check the info object fields.
+package rpc
+
+import (
+	"testing"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
+)
+
+// TestBuildOnStatus_EncodesInfo verifies structure, routing fields and that
+// the level defaults to "status" and details is omitted when empty.
+func TestBuildOnStatus_EncodesInfo(t *testing.T) {
+	msg, err := BuildOnStatus(1, Status{Level: LevelError, Code: CodePublishBadName, Description: "taken", Details: "live/x"})
+	if err != nil {
+		t.Fatalf("BuildOnStatus error: %v", err)
+	}
+	if msg.TypeID != commandMessageAMF0TypeID || msg.MessageStreamID != 1 || msg.CSID != onStatusCSID {
+		t.Fatalf("unexpected routing: type=%d msid=%d csid=%d", msg.TypeID, msg.MessageStreamID, msg.CSID)
+	}
+	vals, err := amf.DecodeAll(msg.Payload)
+	if err != nil || len(vals) != 4 {
+		t.Fatalf("decode: %v (values=%d)", err, len(vals))
+	}
+	if vals[0] != "onStatus" || vals[1] != 0.0 || vals[2] != nil {
+		t.Fatalf("unexpected header values: %#v", vals[:3])
+	}
+	info := vals[3].(map[string]interface{})
+	if info["level"] != LevelError || info["code"] != CodePublishBadName || info["description"] != "taken" || info["details"] != "live/x" {
+		t.Fatalf("unexpected info: %#v", info)
+	}
+
+	msg, err = BuildOnStatus(0, Status{Code: CodePlayStart})
+	if err != nil {
+		t.Fatalf("BuildOnStatus error: %v", err)
+	}
+	vals, _ = amf.DecodeAll(msg.Payload)
+	info = vals[3].(map[string]interface{})
+	if info["level"] != LevelStatus {
+		t.Fatalf("expected default level status, got %v", info["level"])
+	}
+	if _, ok := info["details"]; ok {
+		t.Fatalf("details should be omitted when empty")
+	}
+
+	if _, err := BuildOnStatus(0, Status{}); err == nil {
+		t.Fatalf("expected error for missing code")
+	}
+}
+
+// TestBuildErrorResponse_EncodesInfo verifies the _error reply echoes the
+// transaction ID and carries an error-level info object.
+func TestBuildErrorResponse_EncodesInfo(t *testing.T) {
+	msg, err := BuildErrorResponse(1, CodeConnectInvalidApp, "no app")
+	if err != nil {
+		t.Fatalf("BuildErrorResponse error: %v", err)
+	}
+	if msg.MessageStreamID != 0 || msg.CSID != 3 {
+		t.Fatalf("unexpected routing: msid=%d csid=%d", msg.MessageStreamID, msg.CSID)
+	}
+	vals, err := amf.DecodeAll(msg.Payload)
+	if err != nil || len(vals) != 4 {
+		t.Fatalf("decode: %v (values=%d)", err, len(vals))
+	}
+	if vals[0] != "_error" || vals[1] != 1.0 || vals[2] != nil {
+		t.Fatalf("unexpected header values: %#v", vals[:3])
+	}
+	info := vals[3].(map[string]interface{})
+	if info["level"] != LevelError || info["code"] != CodeConnectInvalidApp || info["description"] != "no app" {
+		t.Fatalf("unexpected info: %#v", info)
+	}
+}
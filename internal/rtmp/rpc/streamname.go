@@ -0,0 +1,15 @@
+package rpc
+
+import "strings"
+
+// NormalizeStreamName trims surrounding spaces and slashes from a stream or
+// app name and collapses repeated slashes, so "live//show/" and "live/show"
+// name the same stream. The command parsers apply it to the names they
+// build stream keys from.
+func NormalizeStreamName(name string) string {
+	name = strings.Trim(strings.TrimSpace(name), "/")
+	for strings.Contains(name, "//") {
+		name = strings.ReplaceAll(name, "//", "/")
+	}
+	return name
+}
@@ -0,0 +1,20 @@
+package rpc
+
+import "testing"
+
+func TestNormalizeStreamName(t *testing.T) {
+	for in, want := range map[string]string{
+		"show":            "show",
+		" show ":          "show",
+		"/show/":          "show",
+		"live//show":      "live/show",
+		"a///b//c/":       "a/b/c",
+		"//":              "",
+		"../etc":          "../etc", // rejected later by the server's key policy
+		"stream with gap": "stream with gap",
+	} {
+		if got := NormalizeStreamName(in); got != want {
+			t.Errorf("NormalizeStreamName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package rpc
+
+// Transaction IDs
+// ---------------
+// Every command carries a transaction ID, its second AMF value. The replies
+// use it as follows:
+//   - _result and _error echo the ID of the call they answer (connect,
+//     createStream, releaseStream, FCPublish, getStreamLength, ...). This is
+//     how the client matches a reply to its call, so it is always echoed.
+//   - onStatus answering a stream command (publish, play, pause) carries 0,
+//     as Adobe Media Server, Wowza and nginx-rtmp send it. FFmpeg and OBS
+//     (librtmp) number their publish and play (5 after connect, releaseStream,
+//     FCPublish and createStream) but match onStatus by code, so either
+//     value works for them. A few encoders match onStatus to their command
+//     by ID; TxnModeEcho answers them with the command's own ID.
+//   - Events the server sends on its own (UnpublishNotify, onFCPublish,
+//     onBWDone) carry 0.
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/alxayo/go-rtmp/internal/errors"
+	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+)
+
+// Transaction ID modes of the onStatus answering a stream command.
+const (
+	TxnModeZero = "zero" // always 0 (the default)
+	TxnModeEcho = "echo" // the command's transaction ID
+)
+
+// ValidTxnMode reports whether mode is a transaction ID mode; empty means
+// TxnModeZero.
+func ValidTxnMode(mode string) bool {
+	return mode == "" || mode == TxnModeZero || mode == TxnModeEcho
+}
+
+// TransactionID returns the transaction ID of command message msg (AMF0 or
+// AMF3), or 0 when it has none or does not decode.
+func TransactionID(msg *chunk.Message) float64 {
+	if msg == nil {
+		return 0
+	}
+	if msg.TypeID == commandMessageAMF3TypeID {
+		m, err := amf0Command(msg)
+		if err != nil {
+			return 0
+		}
+		msg = m
+	}
+	r := bytes.NewReader(msg.Payload)
+	if _, err := amf.DecodeValue(r); err != nil {
+		return 0
+	}
+	v, _ := amf.DecodeValue(r)
+	txn, _ := v.(float64)
+	return txn
+}
+
+// StatusTransactionID returns the transaction ID of the onStatus answering
+// command message cmd under mode.
+func StatusTransactionID(mode string, cmd *chunk.Message) float64 {
+	if mode != TxnModeEcho {
+		return 0
+	}
+	return TransactionID(cmd)
+}
+
+// BuildStatusReply builds the onStatus answering command message cmd, on
+// cmd's message stream, with the transaction ID mode gives it.
+func BuildStatusReply(mode string, cmd *chunk.Message, st Status) (*chunk.Message, error) {
+	st.TransactionID = StatusTransactionID(mode, cmd)
+	return BuildOnStatus(cmd.MessageStreamID, st)
+}
+
+// BuildOnFCPublish builds the onFCPublish (or, for unpublish,
+// onFCUnpublish) event that Flash Media Server sends at connection level
+// after FCPublish and FCUnpublish. Some encoders wait for it before
+// publishing; the rest ignore it.
+//
+//	["onFCPublish", 0, null, {code: NetStream.Publish.Start, description: name}]
+func BuildOnFCPublish(unpublish bool, streamName string) (*chunk.Message, error) {
+	name, code := "onFCPublish", CodePublishStart
+	if unpublish {
+		name, code = "onFCUnpublish", CodeUnpublishSuccess
+	}
+	payload, err := amf.EncodeAll(name, 0.0, nil, map[string]interface{}{
+		"code":        code,
+		"description": streamName,
+	})
+	if err != nil {
+		return nil, errors.NewProtocolError("onfcpublish.encode", fmt.Errorf("amf encode: %w", err))
+	}
+	return &chunk.Message{
+		CSID:            3,
+		TypeID:          commandMessageAMF0TypeID,
+		MessageStreamID: 0,
+		Payload:         payload,
+		MessageLength:   uint32(len(payload)),
+	}, nil
+}
@@ -0,0 +1,146 @@
+// txn_test.go – tests for the transaction IDs of replies.
+//
+// Each profile replays the command sequence a known publisher sends after
+// connect, through a Dispatcher whose handlers answer the way the server
+// does, and checks the IDs of the replies it gets back.
+package rpc
+
+import (
+	"testing"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+)
+
+// publisherProfile is the command sequence of a publisher after connect:
+// its transaction IDs for releaseStream, FCPublish, createStream and
+// publish.
+type publisherProfile struct {
+	name                                string
+	release, fcPublish, create, publish float64
+}
+
+var publisherProfiles = []publisherProfile{
+	{name: "ffmpeg", release: 2, fcPublish: 3, create: 4, publish: 5},
+	{name: "obs", release: 2, fcPublish: 3, create: 4, publish: 5}, // librtmp
+	{name: "wirecast", release: 2, fcPublish: 3, create: 4, publish: 0},
+}
+
+// reply is a decoded reply: its command name and transaction ID.
+type reply struct {
+	name string
+	txn  float64
+}
+
+// runPublisherProfile plays p through a dispatcher in mode and returns the
+// replies in order.
+func runPublisherProfile(t *testing.T, p publisherProfile, mode string) []reply {
+	t.Helper()
+	var out []reply
+	d := NewDispatcher(func() string { return "live" })
+	d.TxnMode = mode
+	d.Reply = func(m *chunk.Message) error {
+		vals, err := amf.DecodeAll(m.Payload)
+		if err != nil || len(vals) < 2 {
+			t.Fatalf("undecodable reply % x", m.Payload)
+		}
+		name, _ := vals[0].(string)
+		txn, _ := vals[1].(float64)
+		out = append(out, reply{name, txn})
+		return nil
+	}
+	alloc := NewStreamIDAllocator()
+	d.OnCreateStream = func(cs *CreateStreamCommand, _ *chunk.Message) error {
+		resp, _, err := BuildCreateStreamResponse(cs.TransactionID, alloc)
+		if err == nil {
+			err = d.Reply(resp)
+		}
+		return err
+	}
+	d.OnPublish = func(pc *PublishCommand, msg *chunk.Message) error {
+		resp, err := BuildStatusReply(d.TxnMode, msg, Status{Code: CodePublishStart, Details: pc.StreamKey})
+		if err == nil {
+			err = d.Reply(resp)
+		}
+		return err
+	}
+	for _, vals := range [][]interface{}{
+		{"releaseStream", p.release, nil, "cam1"},
+		{"FCPublish", p.fcPublish, nil, "cam1"},
+		{"createStream", p.create, nil},
+		{"publish", p.publish, nil, "cam1", "live"},
+	} {
+		msg := buildCmd(t, vals...)
+		if vals[0] == "publish" {
+			msg.MessageStreamID = 1
+		}
+		if err := d.Dispatch(msg); err != nil {
+			t.Fatalf("%s: dispatch %v: %v", p.name, vals[0], err)
+		}
+	}
+	return out
+}
+
+func TestPublisherProfiles_TransactionIDs(t *testing.T) {
+	for _, p := range publisherProfiles {
+		for _, mode := range []string{"", TxnModeZero, TxnModeEcho} {
+			want := []reply{
+				{"_result", p.release},
+				{"_result", p.fcPublish},
+				{"onFCPublish", 0},
+				{"_result", p.create},
+				{"onStatus", 0},
+			}
+			if mode == TxnModeEcho {
+				want[4].txn = p.publish
+			}
+			got := runPublisherProfile(t, p, mode)
+			if len(got) != len(want) {
+				t.Fatalf("%s/%q: replies %v, want %v", p.name, mode, got, want)
+			}
+			for i := range want {
+				if got[i] != want[i] {
+					t.Errorf("%s/%q: reply %d = %v, want %v", p.name, mode, i, got[i], want[i])
+				}
+			}
+		}
+	}
+}
+
+// TestTxnMode_FailureStatus checks that the error onStatus for a failed
+// stream command follows the mode, while _error always echoes the ID.
+func TestTxnMode_FailureStatus(t *testing.T) {
+	for mode, wantStatus := range map[string]float64{TxnModeZero: 0, TxnModeEcho: 7} {
+		var got []reply
+		d := NewDispatcher(func() string { return "" }) // no app: publish fails to parse
+		d.TxnMode = mode
+		d.Reply = func(m *chunk.Message) error {
+			vals, _ := amf.DecodeAll(m.Payload)
+			got = append(got, reply{vals[0].(string), vals[1].(float64)})
+			return nil
+		}
+		d.OnPublish = func(*PublishCommand, *chunk.Message) error { return nil }
+		_ = d.Dispatch(buildCmd(t, "publish", 7.0, nil, "cam1", "live"))
+		_ = d.Dispatch(buildCmd(t, "someCall", 8.0, nil))
+		if len(got) != 2 || got[0] != (reply{"onStatus", wantStatus}) || got[1] != (reply{"_error", 8}) {
+			t.Fatalf("%s: replies %v", mode, got)
+		}
+	}
+}
+
+func TestTransactionID(t *testing.T) {
+	amf0 := buildCmd(t, "play", 9.0, nil, "cam1")
+	amf3 := &chunk.Message{TypeID: commandMessageAMF3TypeID, Payload: append([]byte{0}, amf0.Payload...)}
+	if TransactionID(amf0) != 9 || TransactionID(amf3) != 9 {
+		t.Fatalf("TransactionID = %v, %v", TransactionID(amf0), TransactionID(amf3))
+	}
+	if TransactionID(nil) != 0 || TransactionID(buildCmd(t, "play")) != 0 {
+		t.Fatal("missing transaction ID not 0")
+	}
+	if StatusTransactionID(TxnModeZero, amf0) != 0 || StatusTransactionID(TxnModeEcho, amf0) != 9 {
+		t.Fatal("StatusTransactionID ignores the mode")
+	}
+	if !ValidTxnMode("") || ValidTxnMode("auto") {
+		t.Fatal("ValidTxnMode")
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+)
+
+// RecordingStatus is one live stream in the recording admin API.
+type RecordingStatus struct {
+	StreamKey string `json:"stream_key"`
+	Recording bool   `json:"recording"` // a recording is requested (it may wait for a keyframe)
+}
+
+// RecordingHandler returns the admin HTTP API for runtime recording
+// control (record_control.go):
+//
+//	GET    /api/recordings         list live streams and whether each is recorded
+//	POST   /api/recordings/{key}   start recording, e.g. /api/recordings/live/show
+//	DELETE /api/recordings/{key}   stop recording
+//
+// Starting answers 202, since the file opens at the next keyframe, and
+// stopping 204. A stream that is not live is 404 for POST, as is one that
+// is not recorded for DELETE; starting a recorded stream is 409. The
+// handler does no authentication: wrap it, e.g. with auth.RequireBearer.
+func (s *Server) RecordingHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/recordings", func(w http.ResponseWriter, r *http.Request) {
+		list := []RecordingStatus{}
+		for _, stream := range s.reg.liveStreams() {
+			stream.mu.RLock()
+			recording := stream.RecordDir != "" || stream.Recorder != nil
+			stream.mu.RUnlock()
+			list = append(list, RecordingStatus{StreamKey: stream.Key, Recording: recording})
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].StreamKey < list[j].StreamKey })
+		writeAdminJSON(w, http.StatusOK, list)
+	})
+	mux.HandleFunc("POST /api/recordings/{key...}", func(w http.ResponseWriter, r *http.Request) {
+		key := r.PathValue("key")
+		err := s.StartRecording(key)
+		switch {
+		case errors.Is(err, ErrStreamNotLive):
+			writeAdminError(w, http.StatusNotFound, err)
+		case errors.Is(err, ErrAlreadyRecording):
+			writeAdminError(w, http.StatusConflict, err)
+		case err != nil:
+			writeAdminError(w, http.StatusInternalServerError, err)
+		default:
+			writeAdminJSON(w, http.StatusAccepted, RecordingStatus{StreamKey: key, Recording: true})
+		}
+	})
+	mux.HandleFunc("DELETE /api/recordings/{key...}", func(w http.ResponseWriter, r *http.Request) {
+		err := s.StopRecording(r.PathValue("key"))
+		switch {
+		case errors.Is(err, ErrNotRecording):
+			writeAdminError(w, http.StatusNotFound, err)
+		case err != nil:
+			writeAdminError(w, http.StatusInternalServerError, err)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	return mux
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeAdminError(w http.ResponseWriter, status int, err error) {
+	writeAdminJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,377 @@
+package server
+
+// Stream Aliases
+// --------------
+// An alias is a stream key with no publisher of its own ("live/show") that
+// plays whichever of its source keys is live, in priority order: typically
+// a primary encoder and a backup ("live/show=live/primary,live/backup").
+// Players play the alias like any live stream. When the active source stops
+// publishing, the alias switches to the next live source; when a higher-
+// priority source comes back, it switches back. Players stay attached to
+// the alias throughout and never have to reconnect.
+//
+// Each alias is a Stream in the registry whose publisher is an
+// aliasForwarder. The forwarder subscribes to the active source and
+// re-broadcasts its audio and video on the alias, so the alias's own
+// timestamp normalization, sequence header cache and subscriber handling
+// apply unchanged. After a switch the new source's cached sequence headers
+// are sent first and video resumes at its next keyframe.
+//
+// A source that is still connected but has sent no media for the failover
+// timeout, or has sent none since it started publishing, counts as
+// stalled: the alias moves past it as if it had gone, and returns once its
+// media flows. With redundant ingest enabled,
+// publishing "live/show_primary" or "live/show_backup" creates the alias
+// "live/show" over the pair on demand; it goes away once neither is live.
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/media"
+	"github.com/alxayo/go-rtmp/internal/rtmp/server/hooks"
+)
+
+// aliasCheckInterval is how often a forwarder re-checks its sources. The
+// active source ending also wakes it immediately.
+const aliasCheckInterval = 250 * time.Millisecond
+
+// StreamAlias maps a stream key players can play to the source keys it
+// shows, in priority order.
+type StreamAlias struct {
+	Key     string   // alias stream key, e.g. "live/show"
+	Sources []string // source stream keys, highest priority first
+}
+
+// ParseStreamAlias parses "alias=source1,source2,...", e.g.
+// "live/show=live/primary,live/backup".
+func ParseStreamAlias(s string) (StreamAlias, error) {
+	key, list, ok := strings.Cut(s, "=")
+	key = strings.TrimSpace(key)
+	if !ok || !strings.Contains(key, "/") {
+		return StreamAlias{}, fmt.Errorf("stream alias %q: expected app/alias=app/source[,app/source...]", s)
+	}
+	a := StreamAlias{Key: key}
+	for _, src := range strings.Split(list, ",") {
+		src = strings.TrimSpace(src)
+		if !strings.Contains(src, "/") {
+			return StreamAlias{}, fmt.Errorf("stream alias %q: source %q is not an app/stream key", s, src)
+		}
+		if src == key {
+			return StreamAlias{}, fmt.Errorf("stream alias %q: alias cannot be its own source", s)
+		}
+		a.Sources = append(a.Sources, src)
+	}
+	return a, nil
+}
+
+// isStreamAlias reports whether key is a configured alias. Aliases cannot
+// be published to.
+func (cfg *Config) isStreamAlias(key string) bool {
+	for _, a := range cfg.StreamAliases {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// aliasForwarder publishes an alias stream from its active source. It is
+// the alias stream's publisher and a subscriber of the source.
+type aliasForwarder struct {
+	reg   *Registry
+	alias StreamAlias
+	log   *slog.Logger
+	wake  chan struct{}
+
+	// stallTimeout is how long a publishing source may go without media
+	// before it is passed over. Zero disables stall detection.
+	stallTimeout time.Duration
+	// onSwitch, when set, is called when the alias moves off a source;
+	// to is "" when no source is left. reason is "disconnect", "stall"
+	// or "restored" (a higher-priority source is back).
+	onSwitch func(from, to, reason string)
+	// idleExit, when set, is called once the alias has no live source;
+	// returning true ends run. Used by on-demand redundant-ingest aliases.
+	idleExit func() bool
+
+	mu       sync.Mutex
+	stream   *Stream // the alias stream while it is publishing
+	source   *Stream // the source currently forwarded, nil when none is live
+	waitKey  bool    // drop video until the new source's next keyframe
+	detector media.CodecDetector
+}
+
+func newAliasForwarder(reg *Registry, alias StreamAlias, log *slog.Logger) *aliasForwarder {
+	return &aliasForwarder{
+		reg:   reg,
+		alias: alias,
+		log:   log.With("stream_alias", alias.Key),
+		wake:  make(chan struct{}, 1),
+	}
+}
+
+// run keeps the alias on its best live source until done is closed, then
+// ends it.
+func (f *aliasForwarder) run(done <-chan struct{}) {
+	t := time.NewTicker(aliasCheckInterval)
+	defer t.Stop()
+	for {
+		f.update()
+		if f.idleExit != nil && f.activeSource() == nil && f.idleExit() {
+			return
+		}
+		select {
+		case <-done:
+			f.onSwitch = nil // shutting down is not a failover
+			f.switchTo(nil)
+			return
+		case <-t.C:
+		case <-f.wake:
+		}
+	}
+}
+
+// update switches to the highest-priority source that is publishing and
+// not stalled. When every live source is stalled the alias stays where it
+// is, or takes the first live one if its own source has gone.
+func (f *aliasForwarder) update() {
+	current := f.activeSource()
+	var best, fallback *Stream
+	for _, key := range f.alias.Sources {
+		s := f.reg.GetStream(key)
+		if s.State() != StreamPublishing {
+			continue
+		}
+		if !f.stalled(s) {
+			best = s
+			break
+		}
+		if fallback == nil || s == current {
+			fallback = s
+		}
+	}
+	if best == nil {
+		best = fallback
+	}
+	if best != current {
+		f.switchTo(best)
+	}
+}
+
+// activeSource returns the source currently forwarded, nil when none is live.
+func (f *aliasForwarder) activeSource() *Stream {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.source
+}
+
+// stalled reports whether a publishing source has sent no media for the
+// stall timeout, or none yet: a source counts as live from its first media.
+func (f *aliasForwarder) stalled(s *Stream) bool {
+	if f.stallTimeout <= 0 {
+		return false
+	}
+	last := s.LastMediaAt()
+	return last.IsZero() || time.Since(last) > f.stallTimeout
+}
+
+// switchReason describes why the alias is leaving prev, for onSwitch.
+func (f *aliasForwarder) switchReason(prev *Stream) string {
+	switch {
+	case prev.State() != StreamPublishing:
+		return "disconnect"
+	case f.stalled(prev):
+		return "stall"
+	default:
+		return "restored"
+	}
+}
+
+// switchTo detaches from the current source and attaches to next. With no
+// next source the alias stream ends, so its players are told it went away.
+func (f *aliasForwarder) switchTo(next *Stream) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.source != nil {
+		f.source.RemoveSubscriber(f)
+	}
+	prev := f.source
+	f.source = next
+	if prev != nil && f.onSwitch != nil {
+		to := ""
+		if next != nil {
+			to = next.Key
+		}
+		f.onSwitch(prev.Key, to, f.switchReason(prev))
+	}
+	if next == nil {
+		if f.stream != nil {
+			f.stream.EndPublish(f)
+			f.stream = nil
+			f.log.Info("stream alias has no live source", "previous", prev.Key)
+		}
+		return
+	}
+
+	if f.stream == nil {
+		// The alias stream may have been collected while it had no
+		// source, so look it up afresh.
+		stream, err := f.reg.PublishStream(f.alias.Key, f)
+		if err != nil {
+			f.log.Error("stream alias cannot publish", "error", err)
+			f.source = nil
+			return
+		}
+		f.stream = stream
+	}
+	if prev != nil {
+		// The new source may use other codecs; detect them afresh.
+		f.stream.SetAudioCodec("")
+		f.stream.SetVideoCodec("")
+		f.log.Info("stream alias switched source", "from", prev.Key, "to", next.Key)
+	} else {
+		f.log.Info("stream alias source live", "source", next.Key)
+	}
+
+	// Send the new source's codec configuration ahead of its media.
+	next.mu.RLock()
+	headers := []*chunk.Message{next.VideoSequenceHeader, next.AudioSequenceHeader}
+	next.mu.RUnlock()
+	for _, h := range headers {
+		if h != nil {
+			f.forwardLocked(h)
+		}
+	}
+	f.waitKey = true
+	next.AddSubscriber(f)
+}
+
+// SendMessage receives the active source's broadcast. Audio and video are
+// forwarded; anything else (the UnpublishNotify and Stream EOF sent when
+// the source ends) wakes the forwarder to pick another source.
+func (f *aliasForwarder) SendMessage(msg *chunk.Message) error {
+	if msg.TypeID != 8 && msg.TypeID != 9 {
+		select {
+		case f.wake <- struct{}{}:
+		default:
+		}
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.stream == nil {
+		return nil
+	}
+	if msg.TypeID == 9 && f.waitKey {
+		if !media.IsVideoKeyframe(msg.Payload) {
+			return nil
+		}
+		f.waitKey = false
+	}
+	f.forwardLocked(msg)
+	return nil
+}
+
+// forwardLocked broadcasts a copy of msg on the alias stream. f.mu is held.
+func (f *aliasForwarder) forwardLocked(msg *chunk.Message) {
+	m := *msg
+	if from := m.Timestamp; f.stream.NormalizeTimestamp(&m) {
+		f.log.Debug("timestamp discontinuity re-based", "from", from, "to", m.Timestamp)
+	}
+	f.stream.BroadcastMessage(&f.detector, &m, f.log)
+}
+
+// newAliasForwarder returns a forwarder for alias that uses the server's
+// failover timeout and reports each failover as a stream_failover event.
+func (s *Server) newAliasForwarder(alias StreamAlias) *aliasForwarder {
+	f := newAliasForwarder(s.reg, alias, s.log)
+	f.stallTimeout = s.cfg.FailoverTimeout
+	f.onSwitch = func(from, to, reason string) {
+		s.triggerHookEvent(hooks.EventStreamFailover, "", alias.Key, map[string]interface{}{
+			"from":   from,
+			"to":     to,
+			"reason": reason,
+		})
+	}
+	return f
+}
+
+// Redundant ingest key suffixes, in priority order.
+const (
+	redundantPrimarySuffix = "_primary"
+	redundantBackupSuffix  = "_backup"
+)
+
+// redundantAliasKey returns the alias key a redundant-ingest publish key
+// belongs to: "live/show" for "live/show_primary" and "live/show_backup".
+func redundantAliasKey(key string) (string, bool) {
+	for _, suffix := range []string{redundantPrimarySuffix, redundantBackupSuffix} {
+		if base, ok := strings.CutSuffix(key, suffix); ok && base != "" && !strings.HasSuffix(base, "/") {
+			return base, true
+		}
+	}
+	return "", false
+}
+
+// ensureRedundantAlias starts the redundant-ingest alias for a key that
+// just began publishing, or wakes it if it is already running. Keys without
+// a _primary or _backup suffix are ignored.
+func (s *Server) ensureRedundantAlias(streamKey string) {
+	if s == nil || !s.cfg.RedundantIngest {
+		return
+	}
+	key, ok := redundantAliasKey(streamKey)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f := s.aliases[key]; f != nil {
+		select {
+		case f.wake <- struct{}{}:
+		default:
+		}
+		return
+	}
+	if s.closing || s.gcDone == nil {
+		return
+	}
+	f := s.newAliasForwarder(StreamAlias{Key: key, Sources: []string{key + redundantPrimarySuffix, key + redundantBackupSuffix}})
+	f.idleExit = func() bool {
+		// Checked under s.mu so a publish racing with the exit either
+		// finds this forwarder still registered or starts a new one.
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, src := range f.alias.Sources {
+			if s.reg.GetStream(src).State() == StreamPublishing {
+				return false
+			}
+		}
+		delete(s.aliases, key)
+		return true
+	}
+	if s.aliases == nil {
+		s.aliases = make(map[string]*aliasForwarder)
+	}
+	s.aliases[key] = f
+	go f.run(s.gcDone)
+}
+
+// isStreamAlias reports whether key is a configured alias or a running
+// redundant-ingest alias. Aliases cannot be published to.
+func (s *Server) isStreamAlias(key string) bool {
+	if s == nil {
+		return false
+	}
+	if s.cfg.isStreamAlias(key) {
+		return true
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.aliases[key] != nil
+}
@@ -0,0 +1,233 @@
+// alias_test.go – tests for stream aliases with primary/backup failover.
+package server
+
+import (
+	"io"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/logger"
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/server/hooks"
+)
+
+func TestParseStreamAlias(t *testing.T) {
+	a, err := ParseStreamAlias("live/show = live/primary, live/backup")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if a.Key != "live/show" || len(a.Sources) != 2 || a.Sources[0] != "live/primary" || a.Sources[1] != "live/backup" {
+		t.Fatalf("alias = %+v", a)
+	}
+	for _, bad := range []string{"live/show", "show=live/a", "live/show=", "live/show=live/a,b", "live/show=live/show"} {
+		if _, err := ParseStreamAlias(bad); err == nil {
+			t.Errorf("ParseStreamAlias(%q) succeeded", bad)
+		}
+	}
+}
+
+// TestAliasFailover walks an alias through primary → backup → primary →
+// none, checking what a player attached to the alias receives.
+func TestAliasFailover(t *testing.T) {
+	logger.UseWriter(io.Discard)
+	reg := NewRegistry()
+	primary, _ := reg.CreateStream("live/primary")
+	backup, _ := reg.CreateStream("live/backup")
+	primaryPub, backupPub := &capturingConn{}, &capturingConn{}
+	_ = primary.SetPublisher(primaryPub)
+	_ = backup.SetPublisher(backupPub)
+
+	f := newAliasForwarder(reg, StreamAlias{Key: "live/show", Sources: []string{"live/primary", "live/backup"}}, logger.Logger())
+	f.update()
+	alias := reg.GetStream("live/show")
+	if alias.State() != StreamPublishing {
+		t.Fatalf("alias state = %v, want publishing", alias.State())
+	}
+	viewer := &capturingSubscriber{}
+	alias.AddStreamSubscriber(viewer, 1)
+
+	keyframe := func(ts uint32) *chunk.Message {
+		return &chunk.Message{TypeID: 9, Timestamp: ts, MessageStreamID: 1, Payload: []byte{0x17, 0x01, 0, 0, 0}}
+	}
+	interframe := &chunk.Message{TypeID: 9, Timestamp: 40, MessageStreamID: 1, Payload: []byte{0x27, 0x01, 0, 0, 0}}
+	seqHeader := &chunk.Message{TypeID: 9, MessageStreamID: 1, Payload: []byte{0x17, 0x00, 0, 0, 0}}
+
+	primary.BroadcastMessage(nil, keyframe(0), logger.Logger())
+	backup.BroadcastMessage(nil, seqHeader, logger.Logger())
+	backup.BroadcastMessage(nil, keyframe(0), logger.Logger())
+	if len(viewer.messages) != 1 || viewer.messages[0].MessageStreamID != 1 {
+		t.Fatalf("viewer got %d messages from primary, want 1 on stream 1", len(viewer.messages))
+	}
+
+	// Primary stops: the alias moves to the backup and starts with its
+	// sequence header, then waits for a keyframe.
+	primary.EndPublish(primaryPub)
+	select {
+	case <-f.wake:
+	default:
+		t.Fatal("source unpublish did not wake the forwarder")
+	}
+	f.update()
+	backup.BroadcastMessage(nil, interframe, logger.Logger())
+	backup.BroadcastMessage(nil, keyframe(80), logger.Logger())
+	got := viewer.messages[1:]
+	if len(got) != 2 || got[0].Payload[1] != 0x00 || got[1].Payload[0] != 0x17 {
+		t.Fatalf("after failover viewer got %d messages, want sequence header + keyframe", len(got))
+	}
+	if alias.State() != StreamPublishing {
+		t.Fatal("alias ended during failover")
+	}
+
+	// Primary returns: the alias switches back.
+	_ = primary.SetPublisher(&capturingConn{})
+	f.update()
+	if f.source != primary {
+		t.Fatalf("alias source = %v, want primary", f.source.Key)
+	}
+	if backup.SubscriberCount() != 0 {
+		t.Fatal("forwarder still subscribed to backup")
+	}
+
+	// No live source: the alias ends and its player is told.
+	primary.EndPublish(primary.Publisher)
+	backup.EndPublish(backupPub)
+	n := len(viewer.messages)
+	f.update()
+	if alias.State() != StreamEnded {
+		t.Fatalf("alias state = %v, want ended", alias.State())
+	}
+	if len(viewer.messages) == n || viewer.messages[n].TypeID != 20 {
+		t.Fatal("player not sent UnpublishNotify when the alias ended")
+	}
+}
+
+// TestAliasStallFailover checks that a source that stays connected but
+// sends no media is passed over, and that the alias returns once its media
+// flows again. A source that has just started publishing counts as live
+// only once its first media arrives.
+func TestAliasStallFailover(t *testing.T) {
+	logger.UseWriter(io.Discard)
+	reg := NewRegistry()
+	primary, _ := reg.CreateStream("live/primary")
+	backup, _ := reg.CreateStream("live/backup")
+	_ = primary.SetPublisher(&capturingConn{})
+	_ = backup.SetPublisher(&capturingConn{})
+
+	f := newAliasForwarder(reg, StreamAlias{Key: "live/show", Sources: []string{"live/primary", "live/backup"}}, logger.Logger())
+	f.stallTimeout = 50 * time.Millisecond
+	var switches []string
+	f.onSwitch = func(from, to, reason string) {
+		switches = append(switches, from+">"+to+":"+reason)
+	}
+	f.update()
+	if f.source != primary {
+		t.Fatal("alias did not start on the primary")
+	}
+
+	// Both stall: the alias stays on the primary.
+	time.Sleep(80 * time.Millisecond)
+	f.update()
+	if f.source != primary {
+		t.Fatal("alias left the primary with no fresh source to go to")
+	}
+
+	// Only the backup has media: the alias fails over to it.
+	audio := &chunk.Message{TypeID: 8, MessageStreamID: 1, Payload: []byte{0xAF, 0x01}}
+	backup.BroadcastMessage(nil, audio, logger.Logger())
+	f.update()
+	if f.source != backup {
+		t.Fatal("alias did not fail over from the stalled primary")
+	}
+
+	// The primary's media resumes: the alias goes back.
+	primary.BroadcastMessage(nil, audio, logger.Logger())
+	f.update()
+	if f.source != primary {
+		t.Fatal("alias did not return to the recovered primary")
+	}
+
+	// A new primary publisher has sent nothing yet: the backup is preferred
+	// until it does.
+	primary.EvictPublisher(&capturingConn{})
+	backup.BroadcastMessage(nil, audio, logger.Logger())
+	f.update()
+	if f.source != backup {
+		t.Fatal("alias stayed on a primary publisher that has sent no media")
+	}
+	primary.BroadcastMessage(nil, audio, logger.Logger())
+	f.update()
+	if f.source != primary {
+		t.Fatal("alias did not return to the primary once its media flowed")
+	}
+
+	want := []string{"live/primary>live/backup:stall", "live/backup>live/primary:restored",
+		"live/primary>live/backup:stall", "live/backup>live/primary:restored"}
+	if !slices.Equal(switches, want) {
+		t.Fatalf("switches = %v, want %v", switches, want)
+	}
+}
+
+func TestRedundantAliasKey(t *testing.T) {
+	for key, want := range map[string]string{
+		"live/show_primary": "live/show",
+		"live/show_backup":  "live/show",
+		"live/show":         "",
+		"live/_primary":     "",
+	} {
+		got, ok := redundantAliasKey(key)
+		if got != want || ok != (want != "") {
+			t.Errorf("redundantAliasKey(%q) = %q, %v; want %q", key, got, ok, want)
+		}
+	}
+}
+
+// TestRedundantIngest publishes a primary and a backup, then drops the
+// primary: the base key fails over, reports it, and goes away with both.
+func TestRedundantIngest(t *testing.T) {
+	logger.UseWriter(io.Discard)
+	s := New(Config{RedundantIngest: true})
+	s.gcDone = make(chan struct{})
+	defer close(s.gcDone)
+	events, cancel := s.Subscribe(4, hooks.EventStreamFailover)
+	defer cancel()
+
+	primary, _ := s.reg.CreateStream("live/show_primary")
+	backup, _ := s.reg.CreateStream("live/show_backup")
+	primaryPub := &capturingConn{}
+	_ = primary.SetPublisher(primaryPub)
+	s.ensureRedundantAlias("live/show_primary")
+	_ = backup.SetPublisher(&capturingConn{})
+	s.ensureRedundantAlias("live/show_backup")
+
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitFor("alias to publish", func() bool { return s.reg.GetStream("live/show").State() == StreamPublishing })
+	if !s.isStreamAlias("live/show") {
+		t.Fatal("redundant-ingest key is publishable")
+	}
+
+	primary.EndPublish(primaryPub)
+	select {
+	case e := <-events:
+		if e.StreamKey != "live/show" || e.Data["from"] != "live/show_primary" || e.Data["to"] != "live/show_backup" || e.Data["reason"] != "disconnect" {
+			t.Fatalf("failover event = %+v", e)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no stream_failover event")
+	}
+
+	backup.EndPublish(backup.Publisher)
+	waitFor("alias to end", func() bool { return !s.isStreamAlias("live/show") })
+	if s.reg.GetStream("live/show").State() != StreamEnded {
+		t.Fatal("alias stream did not end")
+	}
+}
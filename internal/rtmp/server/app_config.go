@@ -0,0 +1,266 @@
+package server
+
+// Application Settings
+// --------------------
+// Config.Apps holds settings scoped to one application, the first segment
+// of the stream key ("live" in live/show), like an nginx-rtmp application
+// block. The connect handler resolves the app's settings and attaches them
+// to the session (ConnectInfo.AppConfig); the publish, play and media
+// handlers consult them there. Anything an app does not set follows the
+// server-wide configuration.
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	iconn "github.com/alxayo/go-rtmp/internal/rtmp/conn"
+	"github.com/alxayo/go-rtmp/internal/rtmp/media"
+)
+
+// App authentication scopes (AppConfig.Auth): which requests of the app go
+// through Config.AuthValidator (plays through Config.PlayAuthValidator
+// when it is set).
+const (
+	AppAuthAll     = "all"     // publish and play (the default)
+	AppAuthPublish = "publish" // publish only; anyone may play
+	AppAuthPlay    = "play"    // play only; anyone may publish
+	AppAuthNone    = "none"    // neither
+)
+
+// AppConfig is the configuration of one application.
+type AppConfig struct {
+	// Record turns recording of every stream in the app on or off. Nil
+	// follows RecordAll and RecordStreams. A publish of type "record" or
+	// "append" is recorded either way.
+	Record *bool
+
+	// Auth selects which requests are authenticated: AppAuthAll (or
+	// empty), AppAuthPublish, AppAuthPlay or AppAuthNone.
+	Auth string
+
+	// RelayDestinations are forwarded the app's published streams in
+	// addition to Config.RelayDestinations. {app} and {stream} placeholders
+	// are expanded as there.
+	RelayDestinations []string
+
+	// MaxPublishers limits how many streams of the app may be live at
+	// once (0 = no limit). A publisher replacing one on the same key does
+	// not count twice.
+	MaxPublishers int
+
+	// MaxSubscribers limits the players of each of the app's streams,
+	// replacing Config.MaxSubscribersPerStream (0 = follow it).
+	MaxSubscribers int
+
+	// VideoCodecs and AudioCodecs list the codecs the app accepts, by the
+	// names media uses ("H264", "H265", "AV1", "AAC", "Opus", ...). Empty
+	// accepts any. A publisher sending another codec is disconnected.
+	VideoCodecs []string
+	AudioCodecs []string
+
+	// Control overrides the control burst values for the app's clients.
+	Control ControlSettings
+}
+
+// ParseAppConfig parses an application block of the form
+// "app=setting=value,setting=value,...". Settings are record=on|off,
+// auth=all|publish|play|none, relay=URL, max-publishers=N,
+// max-subscribers=N, video-codec=NAME and audio-codec=NAME (relay and the
+// codecs repeatable), and the control
+// settings chunk-size, window-ack-size, peer-bandwidth and
+// peer-bandwidth-limit.
+func ParseAppConfig(s string) (app string, ac AppConfig, err error) {
+	app, list, ok := strings.Cut(s, "=")
+	app = strings.TrimSpace(app)
+	if !ok || app == "" || strings.Contains(app, "/") {
+		return "", ac, fmt.Errorf("app %q: expected app=setting=value[,setting=value...]", s)
+	}
+	for _, kv := range strings.Split(list, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(kv), "=")
+		if err := ac.set(name, value); err != nil {
+			return "", AppConfig{}, fmt.Errorf("app %q: %w", s, err)
+		}
+	}
+	return app, ac, nil
+}
+
+// set applies one setting of an application block.
+func (ac *AppConfig) set(name, value string) error {
+	if ok, err := ac.Control.setControl(name, value); ok {
+		return err
+	}
+	switch name {
+	case "record":
+		on := value == "on"
+		if !on && value != "off" {
+			return fmt.Errorf("record must be on or off, got %q", value)
+		}
+		ac.Record = &on
+	case "auth":
+		switch value {
+		case AppAuthAll, AppAuthPublish, AppAuthPlay, AppAuthNone:
+			ac.Auth = value
+		default:
+			return fmt.Errorf("invalid auth %q (expected all, publish, play or none)", value)
+		}
+	case "relay":
+		if !strings.HasPrefix(value, "rtmp://") && !strings.HasPrefix(value, "rtmps://") {
+			return fmt.Errorf("relay must be an rtmp:// or rtmps:// URL, got %q", value)
+		}
+		ac.RelayDestinations = append(ac.RelayDestinations, value)
+	case "max-publishers":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return fmt.Errorf("max-publishers needs a positive number, got %q", value)
+		}
+		ac.MaxPublishers = n
+	case "max-subscribers":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return fmt.Errorf("max-subscribers needs a positive number, got %q", value)
+		}
+		ac.MaxSubscribers = n
+	case "video-codec", "audio-codec":
+		if value == "" {
+			return fmt.Errorf("%s needs a codec name", name)
+		}
+		if name == "video-codec" {
+			ac.VideoCodecs = append(ac.VideoCodecs, value)
+		} else {
+			ac.AudioCodecs = append(ac.AudioCodecs, value)
+		}
+	default:
+		return fmt.Errorf("unknown setting %q", name)
+	}
+	return nil
+}
+
+// Merge returns ac with the settings made in other added: lists are
+// appended, other fields are replaced where other sets them. It combines
+// several blocks given for the same app.
+func (ac AppConfig) Merge(other AppConfig) AppConfig {
+	if other.Record != nil {
+		ac.Record = other.Record
+	}
+	if other.Auth != "" {
+		ac.Auth = other.Auth
+	}
+	if other.MaxPublishers != 0 {
+		ac.MaxPublishers = other.MaxPublishers
+	}
+	if other.MaxSubscribers != 0 {
+		ac.MaxSubscribers = other.MaxSubscribers
+	}
+	ac.RelayDestinations = append(ac.RelayDestinations[:len(ac.RelayDestinations):len(ac.RelayDestinations)], other.RelayDestinations...)
+	ac.VideoCodecs = append(ac.VideoCodecs[:len(ac.VideoCodecs):len(ac.VideoCodecs)], other.VideoCodecs...)
+	ac.AudioCodecs = append(ac.AudioCodecs[:len(ac.AudioCodecs):len(ac.AudioCodecs)], other.AudioCodecs...)
+	oc := other.Control
+	if oc.ChunkSize != 0 {
+		ac.Control.ChunkSize = oc.ChunkSize
+	}
+	if oc.WindowAckSize != 0 {
+		ac.Control.WindowAckSize = oc.WindowAckSize
+	}
+	if oc.PeerBandwidth != 0 {
+		ac.Control.PeerBandwidth = oc.PeerBandwidth
+	}
+	if oc.PeerBandwidthLimit != "" {
+		ac.Control.PeerBandwidthLimit = oc.PeerBandwidthLimit
+	}
+	return ac
+}
+
+// appConfig returns the settings of app, or nil when it has none.
+func (cfg *Config) appConfig(app string) *AppConfig {
+	ac, ok := cfg.Apps[app]
+	if !ok {
+		return nil
+	}
+	return &ac
+}
+
+// hasAppRelays reports whether any app relays its streams.
+func (cfg *Config) hasAppRelays() bool {
+	for _, ac := range cfg.Apps {
+		if len(ac.RelayDestinations) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// sessionApp returns the app settings attached to sess at connect, or nil.
+func sessionApp(sess *iconn.Session) *AppConfig {
+	ac, _ := sess.Info().AppConfig.(*AppConfig)
+	return ac
+}
+
+// authenticates reports whether requests of action ("publish" or "play")
+// go through the auth validator.
+func (ac *AppConfig) authenticates(action string) bool {
+	if ac == nil {
+		return true
+	}
+	switch ac.Auth {
+	case AppAuthNone:
+		return false
+	case AppAuthPublish, AppAuthPlay:
+		return ac.Auth == action
+	}
+	return true
+}
+
+// allowsCodec reports whether the app accepts codec for a message of
+// typeID (8 audio, 9 video).
+func (ac *AppConfig) allowsCodec(typeID uint8, codec string) bool {
+	if ac == nil {
+		return true
+	}
+	allowed := ac.AudioCodecs
+	if typeID == 9 {
+		allowed = ac.VideoCodecs
+	}
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, name := range allowed {
+		if strings.EqualFold(name, codec) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkCodec checks the codec of the first audio and the first video
+// message of a publish against app's allowed codecs. It returns the codec
+// and false when the app does not accept it.
+func (ss *streamState) checkCodec(app *AppConfig, m *chunk.Message) (string, bool) {
+	if app == nil || len(app.VideoCodecs)+len(app.AudioCodecs) == 0 {
+		return "", true
+	}
+	checked := &ss.audioChecked
+	if m.TypeID == 9 {
+		checked = &ss.videoChecked
+	}
+	if *checked {
+		return "", true
+	}
+	var codec string
+	if m.TypeID == 9 {
+		vm, err := media.ParseVideoMessage(m.Payload)
+		if err != nil {
+			return "", true // undecodable; check the next one
+		}
+		codec = vm.Codec
+	} else {
+		am, err := media.ParseAudioMessage(m.Payload)
+		if err != nil {
+			return "", true
+		}
+		codec = am.Codec
+	}
+	*checked = true
+	return codec, app.allowsCodec(m.TypeID, codec)
+}
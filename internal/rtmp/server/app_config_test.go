@@ -0,0 +1,181 @@
+// app_config_test.go – tests for per-application settings: parsing of
+// application blocks and how publish, play and media handlers apply the
+// settings attached to the session at connect.
+package server
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/logger"
+	"github.com/alxayo/go-rtmp/internal/rtmp/server/auth"
+	"github.com/alxayo/go-rtmp/internal/rtmp/server/hooks"
+)
+
+func TestParseAppConfig(t *testing.T) {
+	app, ac, err := ParseAppConfig("studio=record=on,auth=publish,relay=rtmp://cdn/{app}/{stream},relay=rtmp://backup/live/x,max-publishers=3,max-subscribers=50,video-codec=H264,video-codec=H265,audio-codec=AAC,chunk-size=8192,peer-bandwidth-limit=hard")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if app != "studio" || ac.Record == nil || !*ac.Record || ac.Auth != AppAuthPublish || ac.MaxPublishers != 3 || ac.MaxSubscribers != 50 {
+		t.Fatalf("got %q %+v", app, ac)
+	}
+	if len(ac.RelayDestinations) != 2 || len(ac.VideoCodecs) != 2 || len(ac.AudioCodecs) != 1 {
+		t.Fatalf("lists = %v %v %v", ac.RelayDestinations, ac.VideoCodecs, ac.AudioCodecs)
+	}
+	if ac.Control != (ControlSettings{ChunkSize: 8192, PeerBandwidthLimit: "hard"}) {
+		t.Fatalf("control = %+v", ac.Control)
+	}
+	for _, bad := range []string{
+		"studio",
+		"=record=on",
+		"live/studio=record=on",
+		"studio=record=yes",
+		"studio=auth=token",
+		"studio=relay=http://cdn/live",
+		"studio=max-publishers=0",
+		"studio=max-subscribers=-1",
+		"studio=video-codec=",
+		"studio=chunk-size=70000",
+		"studio=peer-bandwidth-limit=strict",
+		"studio=buffer=10",
+	} {
+		if _, _, err := ParseAppConfig(bad); err == nil {
+			t.Errorf("ParseAppConfig(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestAppConfigMerge(t *testing.T) {
+	on := true
+	a := AppConfig{RelayDestinations: []string{"rtmp://a/live/x"}, Control: ControlSettings{ChunkSize: 8192}}
+	b := AppConfig{Record: &on, RelayDestinations: []string{"rtmp://b/live/x"}, Control: ControlSettings{PeerBandwidth: 1000}}
+	m := a.Merge(b)
+	if m.Record != &on || len(m.RelayDestinations) != 2 || m.Control != (ControlSettings{ChunkSize: 8192, PeerBandwidth: 1000}) {
+		t.Fatalf("merged = %+v", m)
+	}
+	if len(a.RelayDestinations) != 1 {
+		t.Fatalf("Merge modified its receiver: %v", a.RelayDestinations)
+	}
+}
+
+func TestConfigControlOptions(t *testing.T) {
+	cfg := Config{}
+	cfg.applyDefaults()
+	opts := cfg.controlOptions()
+	if opts.PeerBandwidth != 2_500_000 || opts.PeerLimit != "dynamic" {
+		t.Fatalf("default control options = %+v", opts)
+	}
+}
+
+// TestAppSettings checks each setting of an app end to end: the app's
+// publisher and player limits, authentication scope, recording switch and
+// codecs.
+func TestAppSettings(t *testing.T) {
+	logger.UseWriter(io.Discard)
+	off := false
+	s := New(Config{
+		ListenAddr:    "127.0.0.1:0",
+		RecordAll:     true,
+		RecordDir:     t.TempDir(),
+		AuthValidator: &auth.TokenValidator{Tokens: map[string]string{}}, // rejects everything
+		Apps: map[string]AppConfig{
+			"open":  {Auth: AppAuthNone, MaxPublishers: 1, Record: &off},
+			"watch": {Auth: AppAuthPublish},
+			"hevc":  {Auth: AppAuthNone, VideoCodecs: []string{"H265"}},
+			"small": {Auth: AppAuthNone, MaxSubscribers: 1},
+		},
+	})
+	limits := make(chan hooks.Event, 1)
+	defer s.OnEvent(hooks.EventSubscriberLimit, func(e hooks.Event) error {
+		limits <- e
+		return nil
+	})()
+	if err := s.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer s.Stop()
+
+	t.Run("open app: no auth, no recording, one publisher", func(t *testing.T) {
+		c := connectTo(t, s, "open/one")
+		if err := c.Publish(); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+		watchMessages(c).waitStatus(t, "NetStream.Publish.Start")
+		stream := s.reg.GetStream("open/one")
+		stream.mu.RLock()
+		dir := stream.RecordDir
+		stream.mu.RUnlock()
+		if dir != "" {
+			t.Fatalf("stream records to %q with record=off", dir)
+		}
+
+		c = connectTo(t, s, "open/two")
+		if err := c.Publish(); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+		watchMessages(c).waitStatus(t, "NetStream.Publish.Failed")
+	})
+
+	t.Run("play-only auth scope", func(t *testing.T) {
+		c := connectTo(t, s, "watch/show")
+		if err := c.Play(); err != nil {
+			t.Fatalf("play: %v", err)
+		}
+		watchMessages(c).waitStatus(t, "NetStream.Play.StreamNotFound")
+
+		c = connectTo(t, s, "watch/show")
+		if err := c.Publish(); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+		watchMessages(c).waitStatus(t, "NetStream.Publish.Unauthorized")
+	})
+
+	t.Run("codec not allowed", func(t *testing.T) {
+		c := connectTo(t, s, "hevc/cam")
+		if err := c.Publish(); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+		p := watchMessages(c)
+		p.waitStatus(t, "NetStream.Publish.Start")
+		if err := c.SendVideo(0, []byte{0x17, 0x00, 0, 0, 0, 0x01, 0x64, 0x00, 0x1f}); err != nil {
+			t.Fatalf("send video: %v", err)
+		}
+		p.waitStatus(t, "NetStream.Publish.Failed")
+		if p.open(3 * time.Second) {
+			t.Fatalf("publisher still connected after sending H.264 to an H.265-only app")
+		}
+	})
+
+	t.Run("player limit", func(t *testing.T) {
+		pub := connectTo(t, s, "small/show")
+		if err := pub.Publish(); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+		watchMessages(pub).waitStatus(t, "NetStream.Publish.Start")
+
+		c := connectTo(t, s, "small/show")
+		if err := c.Play(); err != nil {
+			t.Fatalf("play: %v", err)
+		}
+		watchMessages(c).waitStatus(t, "NetStream.Play.Start")
+
+		c = connectTo(t, s, "small/show")
+		if err := c.Play(); err != nil {
+			t.Fatalf("play: %v", err)
+		}
+		watchMessages(c).waitStatus(t, "NetStream.Play.Failed")
+		select {
+		case e := <-limits:
+			if e.StreamKey != "small/show" || e.Data["limit"] != 1 {
+				t.Fatalf("subscriber_limit event = %+v", e)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("subscriber_limit not fired")
+		}
+		if n := s.reg.GetStream("small/show").SubscriberCount(); n != 1 {
+			t.Fatalf("stream has %d players, want 1", n)
+		}
+	})
+}
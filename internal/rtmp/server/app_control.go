@@ -0,0 +1,103 @@
+package server
+
+// Per-App Control Settings
+// ------------------------
+// The control burst (Window Acknowledgement Size, Set Peer Bandwidth, Set
+// Chunk Size) goes out right after the handshake, before the client has
+// named its app, so it always carries the server-wide values from Config.
+// When the app a client connects to has control settings in Config.Apps,
+// the values that differ are sent again once connect succeeds, ahead of
+// the connect _result.
+
+import (
+	"fmt"
+	"strconv"
+
+	iconn "github.com/alxayo/go-rtmp/internal/rtmp/conn"
+	"github.com/alxayo/go-rtmp/internal/rtmp/control"
+)
+
+// ControlSettings are the values advertised in the control burst. Zero
+// fields keep the server-wide value.
+type ControlSettings struct {
+	ChunkSize          uint32 // outbound chunk size (1-65536)
+	WindowAckSize      uint32 // bytes the client may receive before acknowledging
+	PeerBandwidth      uint32 // output limit suggested to the client, in bytes
+	PeerBandwidthLimit string // "hard", "soft" or "dynamic"
+}
+
+// setControl applies one control setting of an app configuration. It
+// reports false for names that are not control settings.
+func (cs *ControlSettings) setControl(name, value string) (bool, error) {
+	if name == "peer-bandwidth-limit" {
+		if _, err := control.ParseLimitType(value); err != nil || value == "" {
+			return true, fmt.Errorf("invalid peer-bandwidth-limit %q (expected hard, soft or dynamic)", value)
+		}
+		cs.PeerBandwidthLimit = value
+		return true, nil
+	}
+	var field *uint32
+	switch name {
+	case "chunk-size":
+		field = &cs.ChunkSize
+	case "window-ack-size":
+		field = &cs.WindowAckSize
+	case "peer-bandwidth":
+		field = &cs.PeerBandwidth
+	default:
+		return false, nil
+	}
+	n, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || n == 0 {
+		return true, fmt.Errorf("%s needs a positive number, got %q", name, value)
+	}
+	if name == "chunk-size" && n > 65536 {
+		return true, fmt.Errorf("chunk-size must be between 1 and 65536")
+	}
+	*field = uint32(n)
+	return true, nil
+}
+
+// controlOptions returns the control burst options for new connections.
+func (cfg *Config) controlOptions() iconn.Options {
+	return iconn.Options{
+		ChunkSize:     cfg.ChunkSize,
+		WindowAckSize: cfg.WindowAckSize,
+		PeerBandwidth: cfg.PeerBandwidth,
+		PeerLimit:     cfg.PeerBandwidthLimit,
+	}
+}
+
+// applyAppControl sends c the control settings of its app that differ from
+// the server-wide ones the control burst advertised.
+func applyAppControl(c *iconn.Connection, cfg *Config, app *AppConfig) error {
+	if app == nil {
+		return nil
+	}
+	cs := app.Control
+	if cs.WindowAckSize != 0 && cs.WindowAckSize != cfg.WindowAckSize {
+		if err := c.SendWindowAckSize(cs.WindowAckSize); err != nil {
+			return err
+		}
+	}
+	bw, limit := cfg.PeerBandwidth, cfg.PeerBandwidthLimit
+	if cs.PeerBandwidth != 0 {
+		bw = cs.PeerBandwidth
+	}
+	if cs.PeerBandwidthLimit != "" {
+		limit = cs.PeerBandwidthLimit
+	}
+	if bw != cfg.PeerBandwidth || limit != cfg.PeerBandwidthLimit {
+		lt, err := control.ParseLimitType(limit)
+		if err != nil {
+			return err
+		}
+		if err := c.SendSetPeerBandwidth(bw, lt); err != nil {
+			return err
+		}
+	}
+	if cs.ChunkSize != 0 {
+		return c.SetWriteChunkSize(cs.ChunkSize) // no-op when unchanged
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// NewTokenHandler returns the admin HTTP API for the tokens in store:
+//
+//	GET    /api/tokens[?stream_key=K]  list tokens (secrets omitted)
+//	POST   /api/tokens                 create {"stream_key", "ttl", "token"}
+//	DELETE /api/tokens/{id}            revoke
+//
+// "ttl" is a Go duration ("24h"; empty = never expires) and "token" is
+// generated when empty. The created token, secret included, is returned
+// with status 201. Every request must carry "Authorization: Bearer
+// <adminToken>"; adminToken must not be empty.
+func NewTokenHandler(store TokenStore, adminToken string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/tokens", func(w http.ResponseWriter, r *http.Request) {
+		tokens, err := store.List(r.Context(), r.URL.Query().Get("stream_key"))
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		for i := range tokens {
+			tokens[i].Token = ""
+		}
+		writeJSON(w, http.StatusOK, tokens)
+	})
+	mux.HandleFunc("POST /api/tokens", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			StreamKey string `json:"stream_key"`
+			TTL       string `json:"ttl"`
+			Token     string `json:"token"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&body); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+			return
+		}
+		if body.StreamKey == "" {
+			writeAPIError(w, http.StatusBadRequest, "stream_key is required")
+			return
+		}
+		var ttl time.Duration
+		if body.TTL != "" {
+			d, err := time.ParseDuration(body.TTL)
+			if err != nil || d <= 0 {
+				writeAPIError(w, http.StatusBadRequest, "ttl must be a positive duration such as 24h")
+				return
+			}
+			ttl = d
+		}
+		t, err := NewStreamToken(body.StreamKey, ttl)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if body.Token != "" {
+			t.Token = body.Token
+		}
+		if err := store.Add(r.Context(), t); err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusCreated, t)
+	})
+	mux.HandleFunc("DELETE /api/tokens/{id}", func(w http.ResponseWriter, r *http.Request) {
+		err := store.Revoke(r.Context(), r.PathValue("id"))
+		switch {
+		case errors.Is(err, ErrTokenNotFound):
+			writeAPIError(w, http.StatusNotFound, err.Error())
+		case err != nil:
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+
+	return RequireBearer(adminToken, mux)
+}
+
+// RequireBearer wraps an admin API handler so that requests without
+// "Authorization: Bearer <adminToken>" are refused with 401. An empty
+// adminToken refuses every request.
+func RequireBearer(adminToken string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || adminToken == "" || subtle.ConstantTimeCompare([]byte(got), []byte(adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeAPIError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
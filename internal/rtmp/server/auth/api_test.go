@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTokenHandler(t *testing.T) {
+	store := NewMemoryTokenStore()
+	srv := httptest.NewServer(NewTokenHandler(store, "admin-secret"))
+	defer srv.Close()
+
+	do := func(method, path, body, bearer string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	if resp := do("GET", "/api/tokens", "", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("no bearer: status %d", resp.StatusCode)
+	}
+	if resp := do("GET", "/api/tokens", "", "wrong"); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("wrong bearer: status %d", resp.StatusCode)
+	}
+
+	resp := do("POST", "/api/tokens", `{"stream_key":"live/cam1","ttl":"24h"}`, "admin-secret")
+	var created StreamToken
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil || resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create: status %d, %v", resp.StatusCode, err)
+	}
+	if created.StreamKey != "live/cam1" || created.Token == "" || created.ExpiresAt.IsZero() {
+		t.Fatalf("created = %+v", created)
+	}
+	resp = do("POST", "/api/tokens", `{"stream_key":"live/cam2","token":"chosen"}`, "admin-secret")
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create with token: status %d", resp.StatusCode)
+	}
+	for _, bad := range []string{`{"ttl":"1h"}`, `{"stream_key":"live/x","ttl":"soon"}`, `{`} {
+		if resp := do("POST", "/api/tokens", bad, "admin-secret"); resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("create %s: status %d, want 400", bad, resp.StatusCode)
+		}
+	}
+
+	resp = do("GET", "/api/tokens?stream_key=live/cam1", "", "admin-secret")
+	var listed []StreamToken
+	if err := json.NewDecoder(resp.Body).Decode(&listed); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("list: status %d, %v", resp.StatusCode, err)
+	}
+	if len(listed) != 1 || listed[0].ID != created.ID || listed[0].Token != "" {
+		t.Fatalf("listed = %+v, want %s without its secret", listed, created.ID)
+	}
+
+	if resp := do("DELETE", "/api/tokens/"+created.ID, "", "admin-secret"); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("revoke: status %d", resp.StatusCode)
+	}
+	if resp := do("DELETE", "/api/tokens/"+created.ID, "", "admin-secret"); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("revoke twice: status %d", resp.StatusCode)
+	}
+	v := &StoreValidator{Store: store}
+	if err := v.ValidatePublish(context.Background(), publishReq("live/cam2", "chosen")); err != nil {
+		t.Fatalf("token created through the API: %v", err)
+	}
+	if err := v.ValidatePublish(context.Background(), publishReq("live/cam1", created.Token)); err == nil {
+		t.Fatal("revoked token still accepted")
+	}
+}
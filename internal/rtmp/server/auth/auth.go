@@ -2,12 +2,15 @@
 // publish and play requests.
 //
 // The package defines a [Validator] interface that all authentication
-// backends implement. Four built-in validators are provided:
+// backends implement. Seven built-in validators are provided:
 //
 //   - [AllowAllValidator]: accepts every request (default, backward-compatible)
 //   - [TokenValidator]: validates against an in-memory map of stream-key → token pairs
 //   - [FileValidator]: loads tokens from a JSON file, supports live reload via [FileValidator.Reload]
 //   - [CallbackValidator]: delegates validation to an external HTTP webhook
+//   - [SignedURLValidator]: checks expiring HMAC-signed tokens (?token=exp.sig)
+//   - [StoreValidator]: checks tokens kept in a [TokenStore], managed at runtime
+//   - [ViewerTokenValidator]: play-only viewer tokens, each limited to a number of concurrent sessions
 //
 // # How Tokens Are Passed
 //
@@ -53,6 +56,7 @@ type Request struct {
 	QueryParams   map[string]string      // parsed from stream name (e.g. {"token": "abc123"})
 	ConnectParams map[string]interface{} // extra fields from connect command object
 	RemoteAddr    string                 // client IP:port (e.g. "192.168.1.100:54321")
+	ClientCert    string                 // common name of the verified TLS client certificate; empty without mutual TLS
 }
 
 // Sentinel errors returned by validators. Callers can use errors.Is to
@@ -60,4 +64,5 @@ type Request struct {
 var (
 	ErrUnauthorized = errors.New("authentication failed: invalid credentials")
 	ErrTokenMissing = errors.New("authentication failed: token missing")
+	ErrTokenExpired = errors.New("authentication failed: token expired")
 )
@@ -24,8 +24,12 @@ import (
 //	  "stream_name": "mystream",
 //	  "stream_key":  "live/mystream",
 //	  "token":       "abc123",
-//	  "remote_addr": "192.168.1.100:54321"
+//	  "remote_addr": "192.168.1.100:54321",
+//	  "client_cert": "encoder-1.studio.example"
 //	}
+//
+// client_cert, the common name of a verified TLS client certificate, is
+// only sent for connections using mutual TLS.
 type CallbackValidator struct {
 	URL    string       // webhook URL (e.g. "https://auth.example.com/validate")
 	Client *http.Client // HTTP client with configured timeout
@@ -49,6 +53,7 @@ type callbackRequest struct {
 	StreamKey  string `json:"stream_key"`
 	Token      string `json:"token"`
 	RemoteAddr string `json:"remote_addr"`
+	ClientCert string `json:"client_cert,omitempty"`
 }
 
 // ValidatePublish sends a "publish" callback to the webhook.
@@ -70,6 +75,7 @@ func (v *CallbackValidator) call(ctx context.Context, action string, req *Reques
 		StreamKey:  req.StreamKey,
 		Token:      req.QueryParams["token"],
 		RemoteAddr: req.RemoteAddr,
+		ClientCert: req.ClientCert,
 	}
 	data, err := json.Marshal(body)
 	if err != nil {
@@ -2,12 +2,15 @@
 // publish and play requests.
 //
 // The package defines a [Validator] interface that all authentication
-// backends implement. Four built-in validators are provided:
+// backends implement. Seven built-in validators are provided:
 //
 //   - [AllowAllValidator]: accepts every request (default, backward-compatible)
 //   - [TokenValidator]: validates against an in-memory map of stream-key → token pairs
 //   - [FileValidator]: loads tokens from a JSON file, supports live reload
 //   - [CallbackValidator]: delegates validation to an external HTTP webhook
+//   - [SignedURLValidator]: checks expiring HMAC-signed tokens
+//   - [StoreValidator]: checks tokens kept in a [TokenStore], managed at runtime
+//   - [ViewerTokenValidator]: play-only viewer tokens, each limited to a number of concurrent sessions
 //
 // # How Tokens Are Passed
 //
@@ -54,6 +57,35 @@
 //	v, _ := auth.NewCallbackValidator("https://auth.example.com/validate")
 //	v.ValidatePublish(ctx, req)  // Makes HTTP request to webhook
 //
+// SignedURLValidator: Stateless expiring tokens signed with a shared secret
+// (optionally one per app). Whoever issues links signs them with
+// [SignToken]; the server only needs the secret.
+//
+//	v := &auth.SignedURLValidator{Secret: "s3cret", ClockSkew: 30 * time.Second}
+//	tok := auth.SignToken("s3cret", "play", "live/stream1", time.Now().Add(time.Hour))
+//	// rtmp://server/live/stream1?token=<tok>
+//
+// StoreValidator: Tokens in a [TokenStore] (memory, JSON file or Redis) that
+// are created and revoked while the server runs, through the store's
+// methods or the admin API from [NewTokenHandler]. Several tokens per stream
+// key allow rotating one without downtime.
+//
+//	store := auth.NewMemoryTokenStore()
+//	tok, _ := auth.NewStreamToken("live/stream1", 30*24*time.Hour)
+//	store.Add(ctx, tok)
+//	v := &auth.StoreValidator{Store: store}
+//	store.Revoke(ctx, tok.ID)  // later: tok.Token is refused from now on
+//
+// ViewerTokenValidator: Play tokens for one stream each, loaded from a JSON
+// file. It implements [SessionValidator]: the server holds one of the
+// token's MaxSessions sessions for every play and frees it when the play
+// ends. Usually set as the server's play validator, so players and
+// publishers hold different secrets.
+//
+//	v, _ := auth.LoadViewerTokens("viewers.json")
+//	release, err := v.AcquirePlay(ctx, req)  // ErrSessionLimit when all sessions are held
+//	defer release()
+//
 // # Token File Format
 //
 // JSON file with stream_key → token mapping:
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/alxayo/go-rtmp/internal/cluster"
+)
+
+// DefaultRedisTokenKey is the Redis hash RedisTokenStore uses by default.
+const DefaultRedisTokenKey = "rtmp:tokens"
+
+// RedisTokenStore is a TokenStore kept in a Redis hash mapping token IDs to
+// the tokens as JSON, so every server sharing the Redis sees a token as
+// soon as it is created or revoked.
+type RedisTokenStore struct {
+	Redis *cluster.Redis
+	Key   string // hash key (default DefaultRedisTokenKey)
+}
+
+// NewRedisTokenStore returns a store for a redis:// or rediss:// URL.
+func NewRedisTokenStore(rawURL string) (*RedisTokenStore, error) {
+	r, err := cluster.ParseRedisURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisTokenStore{Redis: r}, nil
+}
+
+func (s *RedisTokenStore) key() string {
+	if s.Key != "" {
+		return s.Key
+	}
+	return DefaultRedisTokenKey
+}
+
+// Add stores t with HSET.
+func (s *RedisTokenStore) Add(ctx context.Context, t StreamToken) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	_, err = s.Redis.Do(ctx, "HSET", s.key(), t.ID, string(data))
+	return err
+}
+
+// List reads the whole hash and returns the tokens for streamKey (all if
+// empty), oldest first.
+func (s *RedisTokenStore) List(ctx context.Context, streamKey string) ([]StreamToken, error) {
+	reply, err := s.Redis.Do(ctx, "HGETALL", s.key())
+	if err != nil {
+		return nil, err
+	}
+	items, _ := reply.([]interface{})
+	tokens := make(map[string]StreamToken, len(items)/2)
+	for i := 0; i+1 < len(items); i += 2 {
+		data, _ := items[i+1].(string)
+		var t StreamToken
+		if err := json.Unmarshal([]byte(data), &t); err != nil {
+			return nil, fmt.Errorf("token %v: %w", items[i], err)
+		}
+		tokens[t.ID] = t
+	}
+	return filterTokens(tokens, streamKey), nil
+}
+
+// Revoke deletes the token with HDEL.
+func (s *RedisTokenStore) Revoke(ctx context.Context, id string) error {
+	reply, err := s.Redis.Do(ctx, "HDEL", s.key(), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := reply.(int64); n == 0 {
+		return ErrTokenNotFound
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestSignedURLValidator covers signature, action binding, expiry with
+// clock skew and per-app secrets.
+func TestSignedURLValidator(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	v := &SignedURLValidator{
+		Secret:     "default",
+		AppSecrets: map[string]string{"vip": "vip-secret"},
+		ClockSkew:  30 * time.Second,
+		now:        func() time.Time { return now },
+	}
+	future := now.Add(time.Hour)
+
+	tests := []struct {
+		name    string
+		app     string
+		key     string
+		token   string
+		play    bool
+		wantErr error
+	}{
+		{"valid_publish", "live", "live/cam1", SignToken("default", "publish", "live/cam1", future), false, nil},
+		{"valid_play", "live", "live/cam1", SignToken("default", "play", "live/cam1", future), true, nil},
+		{"play_token_cannot_publish", "live", "live/cam1", SignToken("default", "play", "live/cam1", future), false, ErrUnauthorized},
+		{"other_stream", "live", "live/cam2", SignToken("default", "play", "live/cam1", future), true, ErrUnauthorized},
+		{"wrong_secret", "live", "live/cam1", SignToken("guess", "play", "live/cam1", future), true, ErrUnauthorized},
+		{"expired", "live", "live/cam1", SignToken("default", "play", "live/cam1", now.Add(-time.Minute)), true, ErrTokenExpired},
+		{"within_skew", "live", "live/cam1", SignToken("default", "play", "live/cam1", now.Add(-10*time.Second)), true, nil},
+		{"app_secret", "vip", "vip/cam1", SignToken("vip-secret", "play", "vip/cam1", future), true, nil},
+		{"app_ignores_default", "vip", "vip/cam1", SignToken("default", "play", "vip/cam1", future), true, ErrUnauthorized},
+		{"malformed", "live", "live/cam1", "not-a-token", true, ErrUnauthorized},
+		{"missing", "live", "live/cam1", "", true, ErrTokenMissing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &Request{App: tt.app, StreamKey: tt.key, QueryParams: map[string]string{}}
+			if tt.token != "" {
+				req.QueryParams["token"] = tt.token
+			}
+			var err error
+			if tt.play {
+				err = v.ValidatePlay(context.Background(), req)
+			} else {
+				err = v.ValidatePublish(context.Background(), req)
+			}
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("expected nil, got %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
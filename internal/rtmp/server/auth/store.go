@@ -0,0 +1,261 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrTokenNotFound is returned by TokenStore.Revoke for an unknown token ID.
+var ErrTokenNotFound = errors.New("token not found")
+
+// StreamToken is one token accepted for a stream key. A stream key may have
+// several, so a replacement can be issued before the leaked or expiring one
+// is revoked.
+type StreamToken struct {
+	ID        string    `json:"id"`                  // identifies the token for revocation
+	StreamKey string    `json:"stream_key"`          // e.g. "live/cam1"
+	Token     string    `json:"token,omitempty"`     // the secret clients send as ?token=
+	CreatedAt time.Time `json:"created_at"`          // when it was issued
+	ExpiresAt time.Time `json:"expires_at,omitzero"` // zero = never expires
+}
+
+// Expired reports whether t has expired at now.
+func (t StreamToken) Expired(now time.Time) bool {
+	return !t.ExpiresAt.IsZero() && !now.Before(t.ExpiresAt)
+}
+
+// NewStreamToken returns a token for streamKey with a random ID and secret,
+// expiring after ttl (0 = never).
+func NewStreamToken(streamKey string, ttl time.Duration) (StreamToken, error) {
+	var id [8]byte
+	var secret [24]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return StreamToken{}, err
+	}
+	if _, err := rand.Read(secret[:]); err != nil {
+		return StreamToken{}, err
+	}
+	now := time.Now().UTC()
+	t := StreamToken{ID: hex.EncodeToString(id[:]), StreamKey: streamKey, Token: hex.EncodeToString(secret[:]), CreatedAt: now}
+	if ttl > 0 {
+		t.ExpiresAt = now.Add(ttl)
+	}
+	return t, nil
+}
+
+// TokenStore holds stream-key tokens that can be created, listed and
+// revoked at runtime, so a leaked stream key is rotated without restarting
+// the server. Implementations must be safe for concurrent use.
+type TokenStore interface {
+	// Add stores t, replacing any token with the same ID.
+	Add(ctx context.Context, t StreamToken) error
+	// List returns the tokens for streamKey, or all tokens if streamKey is
+	// empty, oldest first. Expired tokens are included until revoked.
+	List(ctx context.Context, streamKey string) ([]StreamToken, error)
+	// Revoke deletes the token with the given ID, or returns ErrTokenNotFound.
+	Revoke(ctx context.Context, id string) error
+}
+
+// StoreValidator validates requests against the tokens in a TokenStore.
+// A request passes if its ?token= matches an unexpired token for its stream
+// key. A store that cannot be read fails the request (fail-closed).
+type StoreValidator struct {
+	Store TokenStore
+
+	now func() time.Time // overridable clock for tests
+}
+
+// ValidatePublish checks the token for a publish request.
+func (v *StoreValidator) ValidatePublish(ctx context.Context, req *Request) error {
+	return v.validate(ctx, req)
+}
+
+// ValidatePlay checks the token for a play (subscribe) request.
+func (v *StoreValidator) ValidatePlay(ctx context.Context, req *Request) error {
+	return v.validate(ctx, req)
+}
+
+// validate looks for a matching token; a match that has expired is
+// reported as expired rather than unauthorized.
+func (v *StoreValidator) validate(ctx context.Context, req *Request) error {
+	token := req.QueryParams["token"]
+	if token == "" {
+		return ErrTokenMissing
+	}
+	tokens, err := v.Store.List(ctx, req.StreamKey)
+	if err != nil {
+		return fmt.Errorf("auth token store: %w", err)
+	}
+	now := time.Now
+	if v.now != nil {
+		now = v.now
+	}
+	result := ErrUnauthorized
+	for _, t := range tokens {
+		if t.StreamKey != req.StreamKey || subtle.ConstantTimeCompare([]byte(t.Token), []byte(token)) != 1 {
+			continue
+		}
+		if !t.Expired(now()) {
+			return nil
+		}
+		result = ErrTokenExpired
+	}
+	return result
+}
+
+// MemoryTokenStore is a TokenStore held in memory. Its tokens are lost on
+// restart.
+type MemoryTokenStore struct {
+	mu     sync.RWMutex
+	tokens map[string]StreamToken // by ID
+}
+
+// NewMemoryTokenStore returns an empty MemoryTokenStore.
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{tokens: make(map[string]StreamToken)}
+}
+
+// Add stores t.
+func (s *MemoryTokenStore) Add(_ context.Context, t StreamToken) error {
+	s.mu.Lock()
+	s.tokens[t.ID] = t
+	s.mu.Unlock()
+	return nil
+}
+
+// List returns the tokens for streamKey (all if empty), oldest first.
+func (s *MemoryTokenStore) List(_ context.Context, streamKey string) ([]StreamToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return filterTokens(s.tokens, streamKey), nil
+}
+
+// Revoke deletes the token with the given ID.
+func (s *MemoryTokenStore) Revoke(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tokens[id]; !ok {
+		return ErrTokenNotFound
+	}
+	delete(s.tokens, id)
+	return nil
+}
+
+// filterTokens returns the tokens for streamKey (all if empty) sorted by
+// creation time, then ID.
+func filterTokens(tokens map[string]StreamToken, streamKey string) []StreamToken {
+	out := make([]StreamToken, 0, len(tokens))
+	for _, t := range tokens {
+		if streamKey == "" || t.StreamKey == streamKey {
+			out = append(out, t)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.Before(out[j].CreatedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// FileTokenStore is a TokenStore persisted to a JSON file holding an array
+// of tokens. The file is rewritten (via a temporary file and rename) on
+// every change, so tokens survive restarts.
+type FileTokenStore struct {
+	path string
+	mem  *MemoryTokenStore
+	mu   sync.Mutex // serializes changes and their writes
+}
+
+// NewFileTokenStore loads the tokens in path, which need not exist yet.
+func NewFileTokenStore(path string) (*FileTokenStore, error) {
+	s := &FileTokenStore{path: path, mem: NewMemoryTokenStore()}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load token store %s: %w", path, err)
+	}
+	var tokens []StreamToken
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("parse token store %s: %w", path, err)
+	}
+	for _, t := range tokens {
+		s.mem.tokens[t.ID] = t
+	}
+	return s, nil
+}
+
+// Add stores t and rewrites the file.
+func (s *FileTokenStore) Add(ctx context.Context, t StreamToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, had := s.mem.tokens[t.ID]
+	_ = s.mem.Add(ctx, t)
+	if err := s.save(); err != nil {
+		if had {
+			_ = s.mem.Add(ctx, prev)
+		} else {
+			_ = s.mem.Revoke(ctx, t.ID)
+		}
+		return err
+	}
+	return nil
+}
+
+// List returns the tokens for streamKey (all if empty), oldest first.
+func (s *FileTokenStore) List(ctx context.Context, streamKey string) ([]StreamToken, error) {
+	return s.mem.List(ctx, streamKey)
+}
+
+// Revoke deletes the token with the given ID and rewrites the file.
+func (s *FileTokenStore) Revoke(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev := s.mem.tokens[id]
+	if err := s.mem.Revoke(ctx, id); err != nil {
+		return err
+	}
+	if err := s.save(); err != nil {
+		_ = s.mem.Add(ctx, prev)
+		return err
+	}
+	return nil
+}
+
+// save writes all tokens to the file. The caller holds s.mu.
+func (s *FileTokenStore) save() error {
+	tokens, _ := s.mem.List(context.Background(), "")
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("save token store: %w", err)
+	}
+	_, err = tmp.Write(append(data, '\n'))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("save token store: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func publishReq(streamKey, token string) *Request {
+	return &Request{StreamKey: streamKey, QueryParams: map[string]string{"token": token}}
+}
+
+// TestStoreValidator_Rotation issues a replacement token, revokes the old
+// one and checks expiry, all without recreating the validator.
+func TestStoreValidator_Rotation(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryTokenStore()
+	v := &StoreValidator{Store: store}
+
+	old, err := NewStreamToken("live/cam1", 0)
+	if err != nil {
+		t.Fatalf("NewStreamToken: %v", err)
+	}
+	if old.ID == "" || len(old.Token) < 32 || !old.ExpiresAt.IsZero() {
+		t.Fatalf("token = %+v", old)
+	}
+	_ = store.Add(ctx, old)
+	if err := v.ValidatePublish(ctx, publishReq("live/cam1", old.Token)); err != nil {
+		t.Fatalf("valid token: %v", err)
+	}
+	if err := v.ValidatePublish(ctx, publishReq("live/cam2", old.Token)); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("token for another stream: got %v", err)
+	}
+	if err := v.ValidatePublish(ctx, publishReq("live/cam1", "")); !errors.Is(err, ErrTokenMissing) {
+		t.Fatalf("missing token: got %v", err)
+	}
+
+	replacement, _ := NewStreamToken("live/cam1", time.Hour)
+	_ = store.Add(ctx, replacement)
+	if err := store.Revoke(ctx, old.ID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if err := store.Revoke(ctx, old.ID); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("second Revoke: got %v", err)
+	}
+	if err := v.ValidatePublish(ctx, publishReq("live/cam1", old.Token)); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("revoked token: got %v", err)
+	}
+	if err := v.ValidatePlay(ctx, publishReq("live/cam1", replacement.Token)); err != nil {
+		t.Fatalf("replacement token: %v", err)
+	}
+
+	v.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if err := v.ValidatePublish(ctx, publishReq("live/cam1", replacement.Token)); !errors.Is(err, ErrTokenExpired) {
+		t.Fatalf("expired token: got %v", err)
+	}
+}
+
+func TestFileTokenStore_Persists(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	s, err := NewFileTokenStore(path)
+	if err != nil {
+		t.Fatalf("NewFileTokenStore on a missing file: %v", err)
+	}
+	a, _ := NewStreamToken("live/a", time.Hour)
+	b, _ := NewStreamToken("live/b", 0)
+	for _, tok := range []StreamToken{a, b} {
+		if err := s.Add(ctx, tok); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	if err := s.Revoke(ctx, a.ID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+
+	reopened, err := NewFileTokenStore(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	got, _ := reopened.List(ctx, "")
+	if len(got) != 1 || got[0].ID != b.ID || got[0].Token != b.Token {
+		t.Fatalf("tokens after reopen = %+v, want only %s", got, b.ID)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm()&0o077 != 0 {
+		t.Fatalf("token file mode = %v (%v), want it private", fi.Mode(), err)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileTokenStore(path); err == nil {
+		t.Fatal("invalid JSON accepted")
+	}
+}
+
+// fakeRedisHash serves HSET, HGETALL and HDEL on hashes.
+type fakeRedisHash struct {
+	mu     sync.Mutex
+	hashes map[string]map[string]string
+}
+
+func startFakeRedisHash(t *testing.T) (*fakeRedisHash, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	f := &fakeRedisHash{hashes: map[string]map[string]string{}}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(c)
+		}
+	}()
+	return f, "redis://" + ln.Addr().String()
+}
+
+func (f *fakeRedisHash) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		h := f.hashes[args[1]]
+		reply := "-ERR unknown command\r\n"
+		switch strings.ToUpper(args[0]) {
+		case "HSET":
+			if h == nil {
+				h = map[string]string{}
+				f.hashes[args[1]] = h
+			}
+			h[args[2]] = args[3]
+			reply = ":1\r\n"
+		case "HGETALL":
+			reply = fmt.Sprintf("*%d\r\n", 2*len(h))
+			for k, v := range h {
+				reply += fmt.Sprintf("$%d\r\n%s\r\n$%d\r\n%s\r\n", len(k), k, len(v), v)
+			}
+		case "HDEL":
+			reply = ":0\r\n"
+			if _, ok := h[args[2]]; ok {
+				delete(h, args[2])
+				reply = ":1\r\n"
+			}
+		}
+		f.mu.Unlock()
+		io.WriteString(c, reply)
+	}
+}
+
+// readCommand reads one RESP command, an array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil || n < 2 {
+		return nil, errors.New("bad command")
+	}
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, errors.New("bad bulk string")
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func TestRedisTokenStore(t *testing.T) {
+	ctx := context.Background()
+	f, url := startFakeRedisHash(t)
+	s, err := NewRedisTokenStore(url)
+	if err != nil {
+		t.Fatalf("NewRedisTokenStore: %v", err)
+	}
+	a, _ := NewStreamToken("live/a", time.Hour)
+	b, _ := NewStreamToken("live/b", 0)
+	for _, tok := range []StreamToken{a, b} {
+		if err := s.Add(ctx, tok); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	if got, err := s.List(ctx, "live/a"); err != nil || len(got) != 1 || got[0].Token != a.Token || !got[0].ExpiresAt.Equal(a.ExpiresAt) {
+		t.Fatalf("List(live/a) = %+v, %v", got, err)
+	}
+	if got, _ := s.List(ctx, ""); len(got) != 2 {
+		t.Fatalf("List() = %d tokens, want 2", len(got))
+	}
+	if err := s.Revoke(ctx, a.ID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if err := s.Revoke(ctx, a.ID); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("second Revoke: got %v", err)
+	}
+	if n := len(f.hashes[DefaultRedisTokenKey]); n != 1 {
+		t.Fatalf("hash holds %d tokens, want 1", n)
+	}
+
+	v := &StoreValidator{Store: s}
+	if err := v.ValidatePublish(ctx, publishReq("live/b", b.Token)); err != nil {
+		t.Fatalf("validate via Redis: %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrSessionLimit is returned when a play token already holds as many
+// concurrent sessions as it allows.
+var ErrSessionLimit = errors.New("authentication failed: token session limit reached")
+
+// SessionValidator is a Validator that counts the plays it admits, so a
+// credential can be limited to a number of concurrent viewers. The server
+// calls AcquirePlay instead of ValidatePlay and calls release when the
+// play ends.
+type SessionValidator interface {
+	Validator
+
+	// AcquirePlay validates a play request like ValidatePlay and, on
+	// success, holds one session of its credential until release is
+	// called. Calling release more than once is harmless.
+	AcquirePlay(ctx context.Context, req *Request) (release func(), err error)
+}
+
+// ViewerToken is a play token for one stream.
+type ViewerToken struct {
+	Token       string    `json:"token"`               // the secret players send as ?token=
+	StreamKey   string    `json:"stream_key"`          // stream the token plays, e.g. "live/show"
+	MaxSessions int       `json:"max_sessions"`        // concurrent plays allowed; 0 = unlimited
+	ExpiresAt   time.Time `json:"expires_at,omitzero"` // zero = never expires
+}
+
+// ViewerTokenValidator admits players holding a viewer token for the
+// stream they play, each token good for at most MaxSessions plays at a
+// time. Viewer tokens never publish. Tokens are loaded from a JSON array:
+//
+//	[{"token": "v1a2b3", "stream_key": "live/show", "max_sessions": 2}]
+//
+// Call [ViewerTokenValidator.Reload] to re-read the file at runtime (e.g.
+// on SIGHUP). Sessions held when a token is reloaded keep counting against
+// it. All methods are safe for concurrent use.
+type ViewerTokenValidator struct {
+	path string
+
+	mu     sync.Mutex
+	tokens map[string]ViewerToken // by token
+	active map[string]int         // sessions held, by token
+
+	now func() time.Time // overridable clock for tests
+}
+
+// NewViewerTokenValidator returns a ViewerTokenValidator holding tokens.
+func NewViewerTokenValidator(tokens []ViewerToken) *ViewerTokenValidator {
+	v := &ViewerTokenValidator{active: make(map[string]int)}
+	v.set(tokens)
+	return v
+}
+
+// LoadViewerTokens creates a ViewerTokenValidator from the JSON token file
+// at path.
+func LoadViewerTokens(path string) (*ViewerTokenValidator, error) {
+	v := &ViewerTokenValidator{path: path, active: make(map[string]int)}
+	if err := v.Reload(); err != nil {
+		return nil, fmt.Errorf("load viewer token file %s: %w", path, err)
+	}
+	return v, nil
+}
+
+// Reload re-reads the token file. It does nothing for a validator built
+// with NewViewerTokenValidator.
+func (v *ViewerTokenValidator) Reload() error {
+	if v.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(v.path)
+	if err != nil {
+		return err
+	}
+	var tokens []ViewerToken
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return fmt.Errorf("parse viewer token file: %w", err)
+	}
+	for _, t := range tokens {
+		if t.Token == "" || t.StreamKey == "" {
+			return errors.New("parse viewer token file: every token needs token and stream_key")
+		}
+	}
+	v.set(tokens)
+	return nil
+}
+
+// set replaces the token table.
+func (v *ViewerTokenValidator) set(tokens []ViewerToken) {
+	m := make(map[string]ViewerToken, len(tokens))
+	for _, t := range tokens {
+		m[t.Token] = t
+	}
+	v.mu.Lock()
+	v.tokens = m
+	v.mu.Unlock()
+}
+
+// ValidatePublish always fails: viewer tokens only play.
+func (v *ViewerTokenValidator) ValidatePublish(context.Context, *Request) error {
+	return ErrUnauthorized
+}
+
+// ValidatePlay checks the token without holding a session, so the
+// session limit is only reported, not enforced.
+func (v *ViewerTokenValidator) ValidatePlay(_ context.Context, req *Request) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	_, err := v.check(req)
+	return err
+}
+
+// AcquirePlay checks the token and holds one of its sessions.
+func (v *ViewerTokenValidator) AcquirePlay(_ context.Context, req *Request) (func(), error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	token, err := v.check(req)
+	if err != nil {
+		return nil, err
+	}
+	v.active[token]++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			v.mu.Lock()
+			defer v.mu.Unlock()
+			if v.active[token]--; v.active[token] <= 0 {
+				delete(v.active, token)
+			}
+		})
+	}, nil
+}
+
+// ActiveSessions returns the number of sessions token holds.
+func (v *ViewerTokenValidator) ActiveSessions(token string) int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.active[token]
+}
+
+// check finds the request's token and returns it if it may start another
+// session. The caller holds v.mu.
+func (v *ViewerTokenValidator) check(req *Request) (string, error) {
+	token := req.QueryParams["token"]
+	if token == "" {
+		return "", ErrTokenMissing
+	}
+	t, ok := v.tokens[token]
+	if !ok || t.StreamKey != req.StreamKey {
+		return "", ErrUnauthorized
+	}
+	now := time.Now
+	if v.now != nil {
+		now = v.now
+	}
+	if !t.ExpiresAt.IsZero() && !now().Before(t.ExpiresAt) {
+		return "", ErrTokenExpired
+	}
+	if t.MaxSessions > 0 && v.active[token] >= t.MaxSessions {
+		return "", ErrSessionLimit
+	}
+	return token, nil
+}
@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestViewerTokenValidator_Validate checks tokens against the stream they
+// were issued for, expiry, and that viewer tokens never publish.
+func TestViewerTokenValidator_Validate(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	v := NewViewerTokenValidator([]ViewerToken{
+		{Token: "v1", StreamKey: "live/show"},
+		{Token: "old", StreamKey: "live/show", ExpiresAt: now.Add(-time.Minute)},
+	})
+	v.now = func() time.Time { return now }
+
+	tests := []struct {
+		name  string
+		key   string
+		token string
+		want  error
+	}{
+		{"valid", "live/show", "v1", nil},
+		{"other stream", "live/other", "v1", ErrUnauthorized},
+		{"unknown token", "live/show", "nope", ErrUnauthorized},
+		{"missing token", "live/show", "", ErrTokenMissing},
+		{"expired", "live/show", "old", ErrTokenExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &Request{StreamKey: tt.key, QueryParams: map[string]string{}}
+			if tt.token != "" {
+				req.QueryParams["token"] = tt.token
+			}
+			if err := v.ValidatePlay(context.Background(), req); !errors.Is(err, tt.want) {
+				t.Fatalf("ValidatePlay = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	req := &Request{StreamKey: "live/show", QueryParams: map[string]string{"token": "v1"}}
+	if err := v.ValidatePublish(context.Background(), req); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("ValidatePublish = %v, want ErrUnauthorized", err)
+	}
+}
+
+// TestViewerTokenValidator_Sessions checks that a token holds at most
+// MaxSessions plays and that releasing one (once, even if called twice)
+// frees its slot.
+func TestViewerTokenValidator_Sessions(t *testing.T) {
+	v := NewViewerTokenValidator([]ViewerToken{{Token: "v1", StreamKey: "live/show", MaxSessions: 2}})
+	req := &Request{StreamKey: "live/show", QueryParams: map[string]string{"token": "v1"}}
+	ctx := context.Background()
+
+	r1, err := v.AcquirePlay(ctx, req)
+	if err != nil {
+		t.Fatalf("first session: %v", err)
+	}
+	if _, err := v.AcquirePlay(ctx, req); err != nil {
+		t.Fatalf("second session: %v", err)
+	}
+	if _, err := v.AcquirePlay(ctx, req); !errors.Is(err, ErrSessionLimit) {
+		t.Fatalf("third session = %v, want ErrSessionLimit", err)
+	}
+	if err := v.ValidatePlay(ctx, req); !errors.Is(err, ErrSessionLimit) {
+		t.Fatalf("ValidatePlay at the limit = %v, want ErrSessionLimit", err)
+	}
+
+	r1()
+	r1()
+	if n := v.ActiveSessions("v1"); n != 1 {
+		t.Fatalf("sessions after release = %d, want 1", n)
+	}
+	if _, err := v.AcquirePlay(ctx, req); err != nil {
+		t.Fatalf("session after release: %v", err)
+	}
+}
+
+// TestLoadViewerTokens loads a token file, reloads it and rejects tokens
+// without a stream key.
+func TestLoadViewerTokens(t *testing.T) {
+	path := writeTokenFile(t, `[{"token": "v1", "stream_key": "live/show", "max_sessions": 1}]`)
+	v, err := LoadViewerTokens(path)
+	if err != nil {
+		t.Fatalf("LoadViewerTokens: %v", err)
+	}
+	req := &Request{StreamKey: "live/show", QueryParams: map[string]string{"token": "v1"}}
+	release, err := v.AcquirePlay(context.Background(), req)
+	if err != nil {
+		t.Fatalf("AcquirePlay: %v", err)
+	}
+	defer release()
+
+	// A reload keeps the sessions the token holds.
+	if err := v.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if _, err := v.AcquirePlay(context.Background(), req); !errors.Is(err, ErrSessionLimit) {
+		t.Fatalf("AcquirePlay after reload = %v, want ErrSessionLimit", err)
+	}
+
+	if _, err := LoadViewerTokens(writeTokenFile(t, `[{"token": "v1"}]`)); err == nil {
+		t.Fatal("token without stream_key accepted")
+	}
+}
@@ -0,0 +1,158 @@
+package server
+
+// A/V Drift Monitoring
+// --------------------
+// An encoder whose audio and video clocks run at different rates produces a
+// stream whose two tracks drift apart: lips no longer match the voice, and
+// the gap grows until the publisher restarts. The server cannot fix this,
+// but it can notice it early.
+//
+// Each stream remembers the latest audio and the latest video timestamp as
+// the publisher sent them (before normalization, which would hide the gap)
+// and the drift is video minus audio in milliseconds. It is reported in the
+// stream snapshot while both tracks are flowing. With Config.AVDriftThreshold
+// set, a stream whose drift stays beyond the threshold for avDriftChecks
+// consecutive checks is flagged (av_drift_warning in /debug/vars) and
+// EventAVDrift fires; it fires again with drifting=false once the drift
+// stays back within the threshold.
+
+import (
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/media"
+	"github.com/alxayo/go-rtmp/internal/rtmp/server/hooks"
+)
+
+// avDriftInterval is how often stream drift is checked against
+// Config.AVDriftThreshold.
+const avDriftInterval = time.Second
+
+// avDriftChecks is how many consecutive checks must agree before a stream's
+// drift warning is raised or cleared, so interleaving jitter and encoder
+// restarts do not flap it.
+const avDriftChecks = 3
+
+// avDriftStale is how long a track may send nothing before the drift is no
+// longer measured: a missing track is not drift.
+const avDriftStale = 2 * time.Second
+
+// avSync holds a stream's A/V drift state. It is protected by Stream.mu.
+type avSync struct {
+	audioTS, videoTS uint32    // latest raw timestamps
+	audioAt, videoAt time.Time // when they arrived; zero until the track is seen
+
+	drifting bool // warning raised
+	streak   int  // consecutive checks disagreeing with drifting
+}
+
+// record notes the timestamp of a published media message. Sequence
+// headers are skipped: encoders often send them with timestamp 0.
+func (a *avSync) record(m *chunk.Message, now time.Time) {
+	switch {
+	case m.TypeID == 8 && !media.IsAudioSequenceHeader(m.Payload):
+		a.audioTS, a.audioAt = m.Timestamp, now
+	case m.TypeID == 9 && !media.IsVideoSequenceHeader(m.Payload):
+		a.videoTS, a.videoAt = m.Timestamp, now
+	}
+}
+
+// reset forgets the tracks, e.g. when a new publisher starts.
+func (a *avSync) reset() {
+	a.audioAt, a.videoAt = time.Time{}, time.Time{}
+}
+
+// drift returns video minus audio in milliseconds. ok is false unless both
+// tracks have sent media within avDriftStale.
+func (a *avSync) drift(now time.Time) (ms int64, ok bool) {
+	if a.audioAt.IsZero() || a.videoAt.IsZero() ||
+		now.Sub(a.audioAt) > avDriftStale || now.Sub(a.videoAt) > avDriftStale {
+		return 0, false
+	}
+	return int64(int32(a.videoTS - a.audioTS)), true // modulo 2^32, like the normalizer
+}
+
+// check compares the drift with threshold and reports whether the warning
+// was raised or cleared. A stream whose drift cannot be measured has its
+// warning cleared without a report.
+func (a *avSync) check(now time.Time, threshold time.Duration) (ms int64, changed bool) {
+	ms, ok := a.drift(now)
+	if !ok {
+		a.drifting, a.streak = false, 0
+		return 0, false
+	}
+	over := ms > threshold.Milliseconds() || -ms > threshold.Milliseconds()
+	if over == a.drifting {
+		a.streak = 0
+		return ms, false
+	}
+	if a.streak++; a.streak < avDriftChecks {
+		return ms, false
+	}
+	a.drifting, a.streak = over, 0
+	return ms, true
+}
+
+// AVDrift returns the stream's current audio/video drift in milliseconds
+// (video ahead of audio is positive). ok is false unless both tracks are
+// flowing.
+func (s *Stream) AVDrift() (ms int64, ok bool) {
+	if s == nil {
+		return 0, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.avsync.drift(time.Now())
+}
+
+// checkAVDrift runs one drift check of the stream. It reports the drift,
+// whether the warning changed, its new state and the publisher's
+// connection ID, if it has one.
+func (s *Stream) checkAVDrift(now time.Time, threshold time.Duration) (ms int64, changed, drifting bool, connID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ms, changed = s.avsync.check(now, threshold)
+	if c, ok := s.Publisher.(interface{ ID() string }); ok {
+		connID = c.ID()
+	}
+	return ms, changed, s.avsync.drifting, connID
+}
+
+// monitorAVDrift checks every stream's drift against
+// Config.AVDriftThreshold until done is closed, logging and firing
+// EventAVDrift when a warning is raised or cleared.
+func (s *Server) monitorAVDrift(done <-chan struct{}) {
+	t := time.NewTicker(avDriftInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-t.C:
+			for _, stream := range s.streamList() {
+				s.checkAVDrift(stream, now)
+			}
+		}
+	}
+}
+
+// checkAVDrift checks one stream and reports a raised or cleared warning.
+func (s *Server) checkAVDrift(stream *Stream, now time.Time) {
+	threshold := s.cfg.AVDriftThreshold
+	ms, changed, drifting, connID := stream.checkAVDrift(now, threshold)
+	if !changed {
+		return
+	}
+	if drifting {
+		s.log.Warn("audio/video drift above threshold", "stream_key", stream.Key, "conn_id", connID,
+			"drift_ms", ms, "threshold_ms", threshold.Milliseconds())
+	} else {
+		s.log.Info("audio/video drift back within threshold", "stream_key", stream.Key, "conn_id", connID,
+			"drift_ms", ms, "threshold_ms", threshold.Milliseconds())
+	}
+	s.triggerHookEvent(hooks.EventAVDrift, connID, stream.Key, vhostHookData(stream.vhost, map[string]interface{}{
+		"drift_ms":     ms,
+		"threshold_ms": threshold.Milliseconds(),
+		"drifting":     drifting,
+	}))
+}
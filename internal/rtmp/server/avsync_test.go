@@ -0,0 +1,92 @@
+// avsync_test.go – tests for audio/video drift monitoring.
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/server/hooks"
+)
+
+// TestAVDriftReporting feeds a stream whose video runs ahead of its audio
+// and verifies the drift in the snapshot, the warning after avDriftChecks
+// checks, and the av_drift events when it is raised and cleared.
+func TestAVDriftReporting(t *testing.T) {
+	srv := New(Config{ListenAddr: "127.0.0.1:0", AVDriftThreshold: time.Second})
+	events, cancel := srv.Subscribe(4, hooks.EventAVDrift)
+	defer cancel()
+	s, _ := srv.reg.CreateStream("live/drift")
+	send := func(audioTS, videoTS uint32) {
+		s.NormalizeTimestamp(&chunk.Message{TypeID: 8, Timestamp: audioTS, Payload: []byte{0xAF, 0x01, 0x21}})
+		s.NormalizeTimestamp(&chunk.Message{TypeID: 9, Timestamp: videoTS, Payload: []byte{0x27, 0x01, 0, 0, 0}})
+	}
+	info := func() StreamInfo {
+		for _, in := range srv.reg.Snapshot() {
+			if in.Key == "live/drift" {
+				return in
+			}
+		}
+		t.Fatal("stream missing from snapshot")
+		return StreamInfo{}
+	}
+
+	if _, ok := s.AVDrift(); ok {
+		t.Fatal("drift measured before any media")
+	}
+	// Sequence headers at timestamp 0 do not count.
+	s.NormalizeTimestamp(&chunk.Message{TypeID: 9, Timestamp: 0, Payload: []byte{0x17, 0x00, 0, 0, 0, 0x01, 0x64, 0x00, 0x1f}})
+	send(5000, 5040)
+	if ms, ok := s.AVDrift(); !ok || ms != 40 {
+		t.Fatalf("AVDrift = %d, %v; want 40, true", ms, ok)
+	}
+
+	send(5000, 6500) // video 1.5s ahead
+	if in := info(); in.AVDriftMs == nil || *in.AVDriftMs != 1500 || in.AVDriftWarning {
+		t.Fatalf("snapshot drift = %v, warning %v; want 1500 without warning yet", in.AVDriftMs, in.AVDriftWarning)
+	}
+	now := time.Now()
+	for i := 0; i < avDriftChecks; i++ {
+		srv.checkAVDrift(s, now)
+	}
+	if !info().AVDriftWarning {
+		t.Fatal("no warning after the drift persisted")
+	}
+	select {
+	case ev := <-events:
+		if ev.StreamKey != "live/drift" || ev.Data["drifting"] != true || ev.Data["drift_ms"] != int64(1500) {
+			t.Fatalf("event = %+v", ev)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no av_drift event")
+	}
+
+	// A single good check does not clear it; avDriftChecks do.
+	send(7000, 7020)
+	srv.checkAVDrift(s, now)
+	if !info().AVDriftWarning {
+		t.Fatal("warning cleared after one check")
+	}
+	for i := 1; i < avDriftChecks; i++ {
+		srv.checkAVDrift(s, now)
+	}
+	if info().AVDriftWarning {
+		t.Fatal("warning not cleared")
+	}
+	select {
+	case ev := <-events:
+		if ev.Data["drifting"] != false {
+			t.Fatalf("event = %+v, want drifting=false", ev)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no av_drift recovery event")
+	}
+
+	// A track that stops is not drift.
+	if _, changed := s.avsync.check(now.Add(avDriftStale+time.Second), time.Second); changed {
+		t.Fatal("stale tracks reported as a change")
+	}
+	if _, ok := s.avsync.drift(now.Add(avDriftStale + time.Second)); ok {
+		t.Fatal("drift measured on stale tracks")
+	}
+}
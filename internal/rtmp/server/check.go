@@ -0,0 +1,231 @@
+package server
+
+// Configuration Check
+// -------------------
+// New accepts any Config: a hook for an unknown event, a relay destination
+// it cannot parse or a webhook queue it cannot open are logged and the
+// server runs without them, and an unwritable recording directory shows up
+// only when the first recording starts. That keeps a running server up, but
+// a deploy pipeline wants to refuse such a configuration before it restarts
+// a production ingest server.
+//
+// Check validates a Config the way New and Start would use it, without
+// listening on any address or connecting anywhere: hook specs and their
+// targets, relay destination URLs (global, per app and per virtual host),
+// the directories recordings, thumbnails, traces, inspect reports and
+// webhook queues are written to, and the RTMPS certificate and client CA.
+// It returns one CheckResult per item so the caller can print a report
+// (rtmp-server -check-config).
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/client"
+	"github.com/alxayo/go-rtmp/internal/rtmp/relay"
+	"github.com/alxayo/go-rtmp/internal/rtmp/server/hooks"
+)
+
+// CheckResult is the outcome of one configuration check.
+type CheckResult struct {
+	Name   string // what was checked, e.g. "record dir"
+	Detail string // what was found, e.g. the directory or certificate expiry
+	Err    error  // why the check failed; nil when it passed
+}
+
+// Check validates cfg without starting the server. Checks of settings that
+// are not in use are left out, so the results may be empty.
+func Check(cfg Config) []CheckResult {
+	cfg.applyDefaults()
+	var results []CheckResult
+	add := func(name, detail string, err error) {
+		results = append(results, CheckResult{Name: name, Detail: detail, Err: err})
+	}
+
+	for _, spec := range cfg.HookScripts {
+		add("hook "+spec, "", checkHook(spec, checkScript))
+	}
+	for _, spec := range cfg.HookWebhooks {
+		add("hook "+spec, "", checkHook(spec, checkWebhookURL))
+	}
+	if cfg.HookQueueSize > 0 && cfg.HookQueueDir != "" && len(cfg.HookWebhooks) > 0 {
+		add("hook queue dir", cfg.HookQueueDir, checkWritable(cfg.HookQueueDir))
+	}
+
+	for _, dest := range relayDestinations(cfg) {
+		add("relay "+dest, "", checkRelayURL(dest))
+	}
+
+	if recordsAny(cfg.RecordAll, cfg.RecordStreams, cfg.Apps) {
+		add("record dir", cfg.RecordDir, checkWritable(cfg.RecordDir))
+	}
+	for _, name := range slices.Sorted(maps.Keys(cfg.VHosts)) {
+		vc := cfg.VHosts[name]
+		if !recordsAny(vc.RecordAll, vc.RecordStreams, vc.Apps) {
+			continue
+		}
+		dir := vc.RecordDir
+		if dir == "" {
+			dir = filepath.Join(cfg.RecordDir, name)
+		}
+		add("record dir (vhost "+name+")", dir, checkWritable(dir))
+	}
+	if cfg.ThumbnailInterval > 0 && cfg.ThumbnailCommand != "" {
+		add("thumbnail dir", cfg.ThumbnailDir, checkWritable(cfg.ThumbnailDir))
+	}
+	if cfg.TraceDir != "" {
+		add("trace dir", cfg.TraceDir, checkWritable(cfg.TraceDir))
+	}
+	if cfg.InspectDir != "" {
+		add("inspect dir", cfg.InspectDir, checkWritable(cfg.InspectDir))
+	}
+
+	if cfg.TLSListenAddr != "" {
+		if cfg.TLSSelfSigned && cfg.TLSCertFile == "" && cfg.TLSKeyFile == "" {
+			add("tls certificate", "self-signed, generated at startup", nil)
+		} else {
+			detail, err := checkCertificate(cfg.TLSCertFile, cfg.TLSKeyFile, time.Now())
+			add("tls certificate", detail, err)
+		}
+		if cfg.TLSClientCAFile != "" {
+			_, err := loadClientCAs(cfg.TLSClientCAFile)
+			add("tls client ca", cfg.TLSClientCAFile, err)
+		}
+	}
+	return results
+}
+
+// checkHook checks a hook spec and its target.
+func checkHook(spec string, checkTarget func(string) error) error {
+	eventType, _, target, err := parseHookSpec(spec)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(hooks.AllEventTypes, eventType) {
+		return fmt.Errorf("unknown event type %q", eventType)
+	}
+	return checkTarget(target)
+}
+
+// checkScript checks that a shell hook's script is a file.
+func checkScript(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+	return nil
+}
+
+// checkWebhookURL checks that a webhook target is an http(s) URL.
+func checkWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("webhook URL must be http:// or https:// with a host, got %q", raw)
+	}
+	return nil
+}
+
+// relayDestinations lists every relay destination of the default host, its
+// apps and the virtual hosts and their apps.
+func relayDestinations(cfg Config) []string {
+	dests := slices.Clone(cfg.RelayDestinations)
+	appDests := func(apps map[string]AppConfig) {
+		for _, ac := range apps {
+			dests = append(dests, ac.RelayDestinations...)
+		}
+	}
+	appDests(cfg.Apps)
+	for _, vc := range cfg.VHosts {
+		dests = append(dests, vc.RelayDestinations...)
+		appDests(vc.Apps)
+	}
+	slices.Sort(dests)
+	return slices.Compact(dests)
+}
+
+// checkRelayURL checks that a relay destination (or template, expanded
+// with a sample key) is a URL the RTMP client can publish to.
+func checkRelayURL(dest string) error {
+	if relay.IsTemplate(dest) {
+		dest = relay.ExpandTemplate(dest, "app/stream")
+	}
+	_, err := client.New(dest)
+	return err
+}
+
+// recordsAny reports whether recording settings record some streams.
+func recordsAny(all bool, streams []string, apps map[string]AppConfig) bool {
+	if all || len(streams) > 0 {
+		return true
+	}
+	for _, ac := range apps {
+		if ac.Record != nil && *ac.Record {
+			return true
+		}
+	}
+	return false
+}
+
+// checkWritable checks that files can be created in dir. A missing dir is
+// not created: its nearest existing parent must be writable instead.
+func checkWritable(dir string) error {
+	existing := dir
+	for {
+		fi, err := os.Stat(existing)
+		if err == nil {
+			if !fi.IsDir() {
+				return fmt.Errorf("%s is not a directory", existing)
+			}
+			break
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return err
+		}
+		existing = parent
+	}
+	f, err := os.CreateTemp(existing, ".rtmp-server-check-*")
+	if err != nil {
+		return fmt.Errorf("not writable: %w", err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// checkCertificate loads the RTMPS certificate and key and checks that the
+// certificate is valid at now. The detail names its subject and expiry.
+func checkCertificate(certFile, keyFile string, now time.Time) (string, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return certFile, fmt.Errorf("load TLS certificate: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return certFile, fmt.Errorf("parse TLS certificate: %w", err)
+	}
+	detail := fmt.Sprintf("%s, CN %q, expires %s", certFile, leaf.Subject.CommonName, leaf.NotAfter.UTC().Format(time.RFC3339))
+	switch {
+	case now.After(leaf.NotAfter):
+		return detail, errors.New("certificate has expired")
+	case now.Before(leaf.NotBefore):
+		return detail, fmt.Errorf("certificate is not valid before %s", leaf.NotBefore.UTC().Format(time.RFC3339))
+	}
+	return detail, nil
+}
@@ -0,0 +1,137 @@
+// check_test.go – tests for the configuration check (Check).
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// checkErrors returns the results of Check(cfg) by name, with the error
+// text ("" for passed checks).
+func checkErrors(t *testing.T, cfg Config) map[string]string {
+	t.Helper()
+	got := make(map[string]string)
+	for _, r := range Check(cfg) {
+		got[r.Name] = ""
+		if r.Err != nil {
+			got[r.Name] = r.Err.Error()
+		}
+	}
+	return got
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "on_publish.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	notDir := filepath.Join(dir, "file")
+	if err := os.WriteFile(notDir, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	on := true
+
+	got := checkErrors(t, Config{
+		HookScripts:       []string{"publish_start=" + script, "publish_begin=" + script, "publish_stop=" + filepath.Join(dir, "missing.sh")},
+		HookWebhooks:      []string{"play_start@live/*=https://hooks.example.com/play", "play_stop=ftp://hooks.example.com"},
+		RelayDestinations: []string{"rtmp://cdn.example.com/live/{stream}", "rtmp://cdn.example.com/live"},
+		Apps:              map[string]AppConfig{"live": {Record: &on, RelayDestinations: []string{"http://cdn.example.com/live/x"}}},
+		RecordDir:         filepath.Join(dir, "recordings", "new"),
+		VHosts:            map[string]VHostConfig{"a.example.com": {RecordAll: true, RecordDir: filepath.Join(notDir, "a")}},
+		TraceDir:          notDir,
+	})
+	want := map[string]string{
+		"hook publish_start=" + script:                          "",
+		"hook publish_begin=" + script:                          `unknown event type "publish_begin"`,
+		"hook publish_stop=" + filepath.Join(dir, "missing.sh"): "no such file",
+		"hook play_start@live/*=https://hooks.example.com/play": "",
+		"hook play_stop=ftp://hooks.example.com":                "must be http:// or https://",
+		"relay rtmp://cdn.example.com/live/{stream}":            "",
+		"relay rtmp://cdn.example.com/live":                     "rtmp[s]://host/app/stream",
+		"relay http://cdn.example.com/live/x":                   "must start with rtmp://",
+		"record dir":                                            "",
+		"record dir (vhost a.example.com)":                      "not a directory",
+		"trace dir":                                             "is not a directory",
+	}
+	for name, w := range want {
+		e, ok := got[name]
+		switch {
+		case !ok:
+			t.Errorf("no result for %q", name)
+		case w == "" && e != "":
+			t.Errorf("%s: unexpected error %q", name, e)
+		case !strings.Contains(e, w):
+			t.Errorf("%s: error %q, want it to contain %q", name, e, w)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("results = %v, want %d", got, len(want))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "recordings")); !os.IsNotExist(err) {
+		t.Error("Check created the record dir")
+	}
+
+	if got := Check(Config{}); len(got) != 0 {
+		t.Errorf("Check of the default config = %+v, want no results", got)
+	}
+}
+
+// TestCheckTLS checks the RTMPS certificate and client CA checks.
+func TestCheckTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := testCertificate(t, nil, "Test Ingest CA")
+	writePEM := func(name, typ string, der []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	certFile := writePEM("cert.pem", "CERTIFICATE", ca.Certificate[0])
+	keyFile := keyPEM(t, dir, ca)
+
+	detail, err := checkCertificate(certFile, keyFile, time.Now())
+	if err != nil || !strings.Contains(detail, `CN "Test Ingest CA"`) {
+		t.Fatalf("checkCertificate = %q, %v", detail, err)
+	}
+	if _, err := checkCertificate(certFile, keyFile, time.Now().Add(2*time.Hour)); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("expired certificate: %v", err)
+	}
+
+	got := checkErrors(t, Config{TLSListenAddr: ":443", TLSCertFile: certFile, TLSKeyFile: filepath.Join(dir, "missing.pem"), TLSClientCAFile: keyFile})
+	if e := got["tls certificate"]; !strings.Contains(e, "load TLS certificate") {
+		t.Errorf("missing key: %q", e)
+	}
+	if e := got["tls client ca"]; !strings.Contains(e, "no PEM certificates") {
+		t.Errorf("client CA without certificates: %q", e)
+	}
+	got = checkErrors(t, Config{TLSListenAddr: ":443", TLSSelfSigned: true, TLSClientCAFile: certFile})
+	if e, ok := got["tls certificate"]; !ok || e != "" {
+		t.Errorf("self-signed: %q", e)
+	}
+	if e, ok := got["tls client ca"]; !ok || e != "" {
+		t.Errorf("client CA: %q", e)
+	}
+}
+
+// keyPEM writes cert's private key to dir as PKCS #8 PEM and returns the
+// file's path.
+func keyPEM(t *testing.T, dir string, cert tls.Certificate) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
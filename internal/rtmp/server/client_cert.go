@@ -0,0 +1,185 @@
+package server
+
+// Client Certificate Authentication
+// ---------------------------------
+// On private ingest networks the RTMPS listener can require mutual TLS.
+// With Config.TLSClientCAFile set, a client must present a certificate
+// signed by one of the CAs in that file, or its TLS handshake fails before
+// any RTMP is spoken. The identity of the verified certificate, its common
+// name and subject alternative names (DNS names, email addresses, URIs),
+// is kept with the connection. Hook events carry it as "client_cn" and
+// "client_san", and authentication validators see the common name in
+// auth.Request.ClientCert.
+//
+// Config.TLSClientACL then limits each identity to a set of stream keys,
+// written as globs or regular expressions (hooks.StreamMatcher):
+//
+//	{
+//	  "encoder-1.studio.example": ["live/studio1", "live/studio1_*"],
+//	  "ops@example.com":          ["live/*", "backup/*"]
+//	}
+//
+// A connection may publish or play a stream when any of its certificate's
+// names has a pattern matching the key; otherwise it gets
+// NetStream.Publish.Unauthorized (or Play.Unauthorized) and is closed, as
+// for a failed token. The check comes before the auth validator, and it
+// applies on every virtual host. Connections without a client certificate,
+// such as those on the plain RTMP listener, are not checked.
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/server/hooks"
+)
+
+// errClientCertDenied is the authentication error for a stream the
+// connection's client certificate is not allowed.
+var errClientCertDenied = errors.New("authentication failed: client certificate not allowed for stream")
+
+// ClientCert is the identity of a connection's verified TLS client
+// certificate.
+type ClientCert struct {
+	CommonName string   // subject common name
+	SANs       []string // DNS names, email addresses and URIs
+}
+
+// clientCertOf returns the verified client certificate of nc, or nil if nc
+// is not TLS or the client presented none.
+func clientCertOf(nc net.Conn) *ClientCert {
+	tc, ok := nc.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	cs := tc.ConnectionState()
+	if len(cs.VerifiedChains) == 0 || len(cs.PeerCertificates) == 0 {
+		return nil
+	}
+	leaf := cs.PeerCertificates[0]
+	cert := &ClientCert{CommonName: leaf.Subject.CommonName}
+	cert.SANs = append(cert.SANs, leaf.DNSNames...)
+	cert.SANs = append(cert.SANs, leaf.EmailAddresses...)
+	for _, u := range leaf.URIs {
+		cert.SANs = append(cert.SANs, u.String())
+	}
+	return cert
+}
+
+// names returns every name the certificate identifies its holder by.
+func (c *ClientCert) names() []string {
+	if c.CommonName == "" {
+		return c.SANs
+	}
+	return append([]string{c.CommonName}, c.SANs...)
+}
+
+// hookData adds the certificate's identity to the data of a hook event. A
+// nil certificate adds nothing.
+func (c *ClientCert) hookData(data map[string]interface{}) map[string]interface{} {
+	if c != nil {
+		data["client_cn"] = c.CommonName
+		data["client_san"] = c.SANs
+	}
+	return data
+}
+
+// loadClientCAs reads the PEM CA certificates client certificates must be
+// signed by.
+func loadClientCAs(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read TLS client CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("TLS client CA file %s: no PEM certificates", path)
+	}
+	return pool, nil
+}
+
+// ClientCertACL maps client certificate names to the stream keys they may
+// publish and play. Call [ClientCertACL.Reload] to re-read its file at
+// runtime (e.g. on SIGHUP). All methods are safe for concurrent use.
+type ClientCertACL struct {
+	path string
+
+	mu    sync.RWMutex
+	rules map[string][]*hooks.StreamMatcher // by certificate name
+}
+
+// NewClientCertACL returns an ACL allowing each certificate name the
+// stream key patterns it maps to.
+func NewClientCertACL(rules map[string][]string) (*ClientCertACL, error) {
+	a := &ClientCertACL{}
+	if err := a.set(rules); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// LoadClientCertACL creates a ClientCertACL from the JSON file at path, an
+// object mapping certificate names to arrays of stream key patterns.
+func LoadClientCertACL(path string) (*ClientCertACL, error) {
+	a := &ClientCertACL{path: path}
+	if err := a.Reload(); err != nil {
+		return nil, fmt.Errorf("load client certificate ACL %s: %w", path, err)
+	}
+	return a, nil
+}
+
+// Reload re-reads the ACL file. It does nothing for an ACL built with
+// NewClientCertACL.
+func (a *ClientCertACL) Reload() error {
+	if a.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(a.path)
+	if err != nil {
+		return err
+	}
+	var rules map[string][]string
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return fmt.Errorf("parse client certificate ACL: %w", err)
+	}
+	return a.set(rules)
+}
+
+// set replaces the rules.
+func (a *ClientCertACL) set(rules map[string][]string) error {
+	m := make(map[string][]*hooks.StreamMatcher, len(rules))
+	for name, patterns := range rules {
+		for _, p := range patterns {
+			sm, err := hooks.NewStreamMatcher(p)
+			if err != nil {
+				return fmt.Errorf("client %s: %w", name, err)
+			}
+			m[name] = append(m[name], sm)
+		}
+	}
+	a.mu.Lock()
+	a.rules = m
+	a.mu.Unlock()
+	return nil
+}
+
+// Allows reports whether any of cert's names may use streamKey. A nil ACL
+// allows everything.
+func (a *ClientCertACL) Allows(cert *ClientCert, streamKey string) bool {
+	if a == nil {
+		return true
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for _, name := range cert.names() {
+		if hooks.MatchAny(a.rules[name], streamKey) {
+			return true
+		}
+	}
+	return false
+}
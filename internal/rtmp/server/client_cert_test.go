@@ -0,0 +1,175 @@
+// client_cert_test.go – tests for mutual TLS and the client certificate ACL.
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/logger"
+	"github.com/alxayo/go-rtmp/internal/rtmp/client"
+	"github.com/alxayo/go-rtmp/internal/rtmp/server/hooks"
+)
+
+// testCertificate creates a certificate for cn and dnsNames signed by
+// parent (self-signed, as a CA, when parent is nil).
+func testCertificate(t *testing.T, parent *tls.Certificate, cn string, dnsNames ...string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := tmpl, any(key)
+	if parent == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestClientCertACL(t *testing.T) {
+	acl, err := NewClientCertACL(map[string][]string{
+		"encoder-1":          {"live/studio1"},
+		"enc.studio.example": {"backup/*"},
+	})
+	if err != nil {
+		t.Fatalf("NewClientCertACL: %v", err)
+	}
+	cert := &ClientCert{CommonName: "encoder-1", SANs: []string{"enc.studio.example"}}
+	for key, want := range map[string]bool{"live/studio1": true, "backup/studio1": true, "live/other": false} {
+		if got := acl.Allows(cert, key); got != want {
+			t.Errorf("Allows(%s) = %v, want %v", key, got, want)
+		}
+	}
+	if acl.Allows(&ClientCert{CommonName: "stranger"}, "live/studio1") {
+		t.Error("unlisted certificate allowed")
+	}
+	if !(*ClientCertACL)(nil).Allows(cert, "live/other") {
+		t.Error("nil ACL refused a stream")
+	}
+	if _, err := NewClientCertACL(map[string][]string{"x": {"~("}}); err == nil {
+		t.Error("invalid pattern accepted")
+	}
+
+	path := filepath.Join(t.TempDir(), "acl.json")
+	if err := os.WriteFile(path, []byte(`{"encoder-1": ["live/*"]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	acl, err = LoadClientCertACL(path)
+	if err != nil || !acl.Allows(cert, "live/other") {
+		t.Fatalf("LoadClientCertACL: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(`{"encoder-1": ["vod/*"]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := acl.Reload(); err != nil || acl.Allows(cert, "live/other") {
+		t.Fatalf("Reload: %v", err)
+	}
+}
+
+// TestMutualTLS checks that the RTMPS listener refuses clients without a
+// certificate from the configured CA, limits a verified client to the
+// streams its names are allowed, and reports its identity in hook events.
+func TestMutualTLS(t *testing.T) {
+	logger.UseWriter(io.Discard)
+	ca := testCertificate(t, nil, "Test Ingest CA")
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Certificate[0]}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	acl, _ := NewClientCertACL(map[string][]string{
+		"encoder-1":          {"live/studio1"},
+		"enc.studio.example": {"backup/*"},
+	})
+	s := New(Config{
+		ListenAddr:      "127.0.0.1:0",
+		TLSListenAddr:   "127.0.0.1:0",
+		TLSSelfSigned:   true,
+		TLSClientCAFile: caFile,
+		TLSClientACL:    acl,
+	})
+	if err := s.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer s.Stop()
+	events, cancel := s.Subscribe(8, hooks.EventPublishStart)
+	defer cancel()
+
+	dial := func(key string, certs ...tls.Certificate) (*client.Client, error) {
+		c, err := client.New(fmt.Sprintf("rtmps://%s/%s", s.TLSAddr(), key))
+		if err != nil {
+			t.Fatalf("client.New: %v", err)
+		}
+		c.TLSConfig = &tls.Config{InsecureSkipVerify: true, Certificates: certs}
+		t.Cleanup(func() { c.Close() })
+		return c, c.Connect()
+	}
+
+	if _, err := dial("live/studio1"); err == nil {
+		t.Fatal("client without a certificate connected")
+	}
+	if _, err := dial("live/studio1", testCertificate(t, nil, "encoder-1")); err == nil {
+		t.Fatal("client with a certificate from another CA connected")
+	}
+
+	enc := testCertificate(t, &ca, "encoder-1", "enc.studio.example")
+	for _, key := range []string{"live/studio1", "backup/studio1"} {
+		c, err := dial(key, enc)
+		if err != nil {
+			t.Fatalf("connect with client certificate: %v", err)
+		}
+		if err := c.Publish(); err != nil {
+			t.Fatalf("publish %s: %v", key, err)
+		}
+		waitFor(t, "publish "+key, func() bool { return hasLivePublisher(s.reg, key) })
+		select {
+		case ev := <-events:
+			if ev.Data["client_cn"] != "encoder-1" || !reflect.DeepEqual(ev.Data["client_san"], []string{"enc.studio.example"}) {
+				t.Fatalf("publish_start data = %v", ev.Data)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("no publish_start event")
+		}
+	}
+
+	c, err := dial("live/other", enc)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if err := c.Publish(); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	p := watchMessages(c)
+	p.waitStatus(t, "NetStream.Publish.Unauthorized")
+	if p.open(3 * time.Second) {
+		t.Fatal("connection still open after publishing a stream the certificate is not allowed")
+	}
+}
@@ -0,0 +1,142 @@
+package server
+
+// Cluster Directory
+// -----------------
+// With Config.ClusterRedisURL set, servers behind one load balancer share a
+// stream directory in Redis (see internal/cluster). Each server announces
+// the streams published on it, with its Config.ClusterNodeURL, codecs and
+// start time, and refreshes the entries while the streams are live; an
+// entry whose server stops refreshing it expires.
+//
+// A play request for a stream with no local publisher is then served like
+// in edge mode (origin.go): the server looks the key up and pulls the
+// stream from the node that has it, falling back to Config.OriginURL when
+// no node announces the key. Streams pulled from another node are not
+// announced, so every entry names the node the stream is published on.
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/cluster"
+)
+
+// clusterSyncInterval is how often local streams are compared with what
+// this server has announced.
+const clusterSyncInterval = time.Second
+
+// clusterTimeout bounds one directory request.
+const clusterTimeout = 3 * time.Second
+
+// announcement is the directory entry this server keeps for a stream.
+type announcement struct {
+	presence  cluster.Presence
+	refreshed time.Time
+}
+
+// announceStreams keeps the directory in line with the locally published
+// streams until done is closed, then withdraws every entry.
+func (s *Server) announceStreams(done <-chan struct{}) {
+	defer s.announcer.Done()
+	announced := make(map[string]*announcement)
+	t := time.NewTicker(clusterSyncInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-done:
+			for key := range announced {
+				s.withdrawStream(key)
+			}
+			return
+		case now := <-t.C:
+			s.syncDirectory(now, announced)
+		}
+	}
+}
+
+// syncDirectory announces new and changed streams, refreshes entries
+// nearing their TTL and withdraws streams that are no longer published.
+func (s *Server) syncDirectory(now time.Time, announced map[string]*announcement) {
+	live := make(map[string]bool)
+	for _, stream := range s.reg.streamList() {
+		if !publishedLocally(stream) {
+			continue
+		}
+		live[stream.Key] = true
+		p := cluster.Presence{
+			Key:        stream.Key,
+			Node:       s.cfg.ClusterNodeURL,
+			AudioCodec: stream.GetAudioCodec(),
+			VideoCodec: stream.GetVideoCodec(),
+			StartedAt:  now.UTC().Truncate(time.Second),
+		}
+		a := announced[stream.Key]
+		if a != nil {
+			p.StartedAt = a.presence.StartedAt
+			if p == a.presence && now.Sub(a.refreshed) < s.directory.TTL/3 {
+				continue
+			}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), clusterTimeout)
+		err := s.directory.Announce(ctx, p)
+		cancel()
+		if err != nil {
+			s.log.Warn("cluster announce failed", "stream_key", stream.Key, "error", err)
+			continue
+		}
+		if a == nil {
+			s.log.Info("stream announced to cluster", "stream_key", stream.Key, "node", p.Node)
+		}
+		announced[stream.Key] = &announcement{presence: p, refreshed: now}
+	}
+	for key := range announced {
+		if !live[key] {
+			s.withdrawStream(key)
+			delete(announced, key)
+		}
+	}
+}
+
+// withdrawStream removes this server's directory entry for key.
+func (s *Server) withdrawStream(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), clusterTimeout)
+	defer cancel()
+	if err := s.directory.Withdraw(ctx, key); err != nil {
+		s.log.Warn("cluster withdraw failed", "stream_key", key, "error", err)
+		return
+	}
+	s.log.Info("stream withdrawn from cluster", "stream_key", key)
+}
+
+// publishedLocally reports whether stream has a live publisher on this
+// server, as opposed to none or an origin pull.
+func publishedLocally(stream *Stream) bool {
+	if stream.State() != StreamPublishing {
+		return false
+	}
+	stream.mu.RLock()
+	defer stream.mu.RUnlock()
+	_, pulled := stream.Publisher.(*originPull)
+	return stream.Publisher != nil && !pulled
+}
+
+// resolveOrigin returns the server to pull key from: the cluster node that
+// announces it, else Config.OriginURL.
+func (s *Server) resolveOrigin(key string) (string, error) {
+	if s.directory != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), clusterTimeout)
+		p, err := s.directory.Lookup(ctx, key)
+		cancel()
+		switch {
+		case err == nil && p.Node != "" && p.Node != s.cfg.ClusterNodeURL:
+			return p.Node, nil
+		case err != nil && !errors.Is(err, cluster.ErrNotFound):
+			s.log.Warn("cluster lookup failed", "stream_key", key, "error", err)
+		}
+	}
+	if s.cfg.OriginURL != "" {
+		return s.cfg.OriginURL, nil
+	}
+	return "", errOriginNotFound
+}
@@ -0,0 +1,190 @@
+// cluster_test.go – tests for the shared stream directory: a server
+// announces its published streams, and another server pulls a stream it
+// does not have from the node the directory names.
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alxayo/go-rtmp/internal/cluster"
+	"github.com/alxayo/go-rtmp/internal/logger"
+	"github.com/alxayo/go-rtmp/internal/rtmp/client"
+)
+
+// miniRedis is an in-memory Redis answering GET, SET and the compare-and-
+// delete EVAL the directory withdraws with. TTLs are ignored.
+type miniRedis struct {
+	ln   net.Listener
+	mu   sync.Mutex
+	data map[string]string
+}
+
+func startMiniRedis(t *testing.T) *miniRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	m := &miniRedis{ln: ln, data: map[string]string{}}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go m.serve(c)
+		}
+	}()
+	return m
+}
+
+func (m *miniRedis) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	for {
+		args, err := readRESPCommand(r)
+		if err != nil {
+			return
+		}
+		m.mu.Lock()
+		reply := "-ERR unknown command\r\n"
+		switch strings.ToUpper(args[0]) {
+		case "GET":
+			reply = "$-1\r\n"
+			if v, ok := m.data[args[1]]; ok {
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+			}
+		case "SET":
+			m.data[args[1]] = args[2]
+			reply = "+OK\r\n"
+		case "EVAL":
+			reply = ":0\r\n"
+			if m.data[args[3]] == args[4] {
+				delete(m.data, args[3])
+				reply = ":1\r\n"
+			}
+		}
+		m.mu.Unlock()
+		io.WriteString(c, reply)
+	}
+}
+
+// readRESPCommand reads one command, an array of bulk strings.
+func readRESPCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil || n < 1 {
+		return nil, errors.New("bad command")
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, errors.New("bad bulk string")
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+// freeAddr returns a loopback address with a port that was free just now.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func TestClusterDirectory(t *testing.T) {
+	logger.UseWriter(io.Discard)
+	redis := startMiniRedis(t)
+	redisURL := "redis://" + redis.ln.Addr().String()
+	dir, _ := cluster.Open(redisURL, "", 0)
+	defer dir.Close()
+
+	addrA := freeAddr(t)
+	nodeA := New(Config{ListenAddr: addrA, ClusterRedisURL: redisURL, ClusterNodeURL: "rtmp://" + addrA})
+	if err := nodeA.Start(); err != nil {
+		t.Fatalf("start node A: %v", err)
+	}
+	defer nodeA.Stop()
+	nodeB := New(Config{ListenAddr: "127.0.0.1:0", ClusterRedisURL: redisURL})
+	if err := nodeB.Start(); err != nil {
+		t.Fatalf("start node B: %v", err)
+	}
+	defer nodeB.Stop()
+
+	pub, err := client.New(fmt.Sprintf("rtmp://%s/live/show", addrA))
+	if err != nil {
+		t.Fatalf("client.New: %v", err)
+	}
+	if err := pub.Connect(); err != nil {
+		t.Fatalf("connect publisher: %v", err)
+	}
+	defer pub.Close()
+	if err := pub.Publish(); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	seqHeader := []byte{0x17, 0x00, 0, 0, 0, 0x01, 0x64, 0x00, 0x1f}
+	_ = pub.SendVideo(0, seqHeader)
+
+	// Node A announces the stream with its address and codec.
+	var p cluster.Presence
+	waitFor(t, "announcement", func() bool {
+		p, err = dir.Lookup(context.Background(), "live/show")
+		return err == nil && p.VideoCodec != ""
+	})
+	if p.Node != "rtmp://"+addrA || p.VideoCodec != "H264" || p.StartedAt.IsZero() {
+		t.Fatalf("announced %+v", p)
+	}
+
+	// Node B has no publisher for the key and pulls it from node A.
+	player := playOn(t, nodeB, "live/show")
+	player.waitStatus(t, "NetStream.Play.Start")
+	player.waitVideo(t, seqHeader)
+	keyframe := []byte{0x17, 0x01, 0, 0, 0, 0xBB}
+	_ = pub.SendVideo(40, keyframe)
+	player.waitVideo(t, keyframe)
+
+	// The pulled stream is not announced by node B: the entry still names A.
+	if p, _ := dir.Lookup(context.Background(), "live/show"); p.Node != "rtmp://"+addrA {
+		t.Fatalf("entry moved to %s", p.Node)
+	}
+	player.c.Close()
+
+	// When the publisher leaves, node A withdraws the stream.
+	pub.Close()
+	waitFor(t, "withdrawal", func() bool {
+		_, err := dir.Lookup(context.Background(), "live/show")
+		return errors.Is(err, cluster.ErrNotFound)
+	})
+
+	// A key no node announces is not found.
+	missing := playOn(t, nodeB, "live/missing")
+	defer missing.c.Close()
+	missing.waitStatus(t, "NetStream.Play.StreamNotFound")
+}
@@ -12,167 +12,425 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
+	rtmperrors "github.com/alxayo/go-rtmp/internal/errors"
 	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
-	"github.com/alxayo/go-rtmp/internal/rtmp/metrics"
 	iconn "github.com/alxayo/go-rtmp/internal/rtmp/conn"
-	"github.com/alxayo/go-rtmp/internal/rtmp/control"
 	"github.com/alxayo/go-rtmp/internal/rtmp/media"
+	"github.com/alxayo/go-rtmp/internal/rtmp/metrics"
 	"github.com/alxayo/go-rtmp/internal/rtmp/relay"
 	"github.com/alxayo/go-rtmp/internal/rtmp/rpc"
 	"github.com/alxayo/go-rtmp/internal/rtmp/server/auth"
 	"github.com/alxayo/go-rtmp/internal/rtmp/server/hooks"
+	"github.com/alxayo/go-rtmp/internal/telemetry"
 )
 
 // commandState holds mutable per-connection state needed by the command handlers.
 // Each accepted connection gets its own commandState instance.
+// Negotiated connect parameters and the per-message-stream protocol state
+// live in the connection's iconn.Session; commandState only keeps what the
+// media pipeline (recording, relay, hooks) needs for each active stream.
+//
+// All fields are touched only from the connection's read goroutine
+// (command handlers, media dispatch and the disconnect handler), so no
+// locking is needed.
 type commandState struct {
-	app           string                 // application name from the connect command (e.g. "live")
-	streamKey     string                 // current stream key (e.g. "live/mystream")
-	connectParams map[string]interface{} // extra fields from connect command object (for auth context)
-	allocator     *rpc.StreamIDAllocator // assigns unique message stream IDs for createStream
-	mediaLogger   *MediaLogger           // tracks audio/video packet statistics
-	codecDetector *media.CodecDetector   // identifies audio/video codecs on first packets
-	role          string                 // "publisher" or "subscriber" — set by OnPublish/OnPlay handlers
-	enhancedRTMP  bool                   // true if client advertised fourCcList in connect
-	fourCcList    []string               // Enhanced RTMP FourCC codecs supported by client
+	sess        *iconn.Session          // negotiated parameters and state machine (c.Session())
+	allocator   *rpc.StreamIDAllocator  // assigns unique message stream IDs for createStream
+	mediaLogger *MediaLogger            // tracks audio/video packet statistics
+	streams     map[uint32]*streamState // publishing/playing streams by message stream ID
+	inspect     *inspector              // protocol report in inspect mode (nil otherwise)
+	trace       context.Context         // carries the connection's trace span (telemetry)
+	vhost       *vhost                  // virtual host resolved at connect (nil: default host)
+	clientCert  *ClientCert             // verified TLS client certificate (nil without mutual TLS)
+}
+
+// hookData adds the connection's virtual host and client certificate
+// identity, if any, to the data of a hook event.
+func (st *commandState) hookData(data map[string]interface{}) map[string]interface{} {
+	return st.clientCert.hookData(st.vhost.hookData(data))
+}
+
+// streamState is the media pipeline state of one publishing or playing
+// message stream.
+type streamState struct {
+	id            uint32               // message stream ID the publish/play was issued on
+	streamKey     string               // stream key (e.g. "live/mystream")
+	role          string               // iconn.RolePublisher or iconn.RoleSubscriber
+	codecDetector *media.CodecDetector // identifies audio/video codecs on first packets
+	vod           *vodSession          // active recorded-file playback (nil when playing live)
+	dvr           *dvrSession          // active time-shifted playback from the DVR buffer
+	relayStop     func()               // closes relay destinations resolved for this publish
+	recording     bool                 // published as "record" or "append": Record.Stop is due on teardown
+	pull          *originPull          // origin pull this player holds a reference on (edge mode)
+	authRelease   func()               // frees the play token's session (session-counted play auth)
+	audioChecked  bool                 // audio codec checked against the app's allowed codecs
+	videoChecked  bool                 // video codec checked against the app's allowed codecs
+	inspected     bool                 // accepted in inspect mode: not registered, media dropped
+	golive        *telemetry.Span      // publish not yet live: ended at the first keyframe (tracing.go)
+}
+
+// findStream returns the active stream on another message stream than id
+// that uses key in role, or nil.
+func (st *commandState) findStream(key, role string, id uint32) *streamState {
+	for _, ss := range st.streams {
+		if ss.id != id && ss.streamKey == key && ss.role == role {
+			return ss
+		}
+	}
+	return nil
+}
+
+// mediaStream returns the publishing stream media on message stream id
+// belongs to. Encoders that send media on a different message stream than
+// they published on are tolerated when the connection publishes only one
+// stream.
+func (st *commandState) mediaStream(id uint32) *streamState {
+	if ss := st.streams[id]; ss != nil {
+		if ss.role == iconn.RolePublisher {
+			return ss
+		}
+		return nil
+	}
+	var only *streamState
+	for _, ss := range st.streams {
+		if ss.role != iconn.RolePublisher {
+			continue
+		}
+		if only != nil {
+			return nil
+		}
+		only = ss
+	}
+	return only
+}
+
+// sortedStreams returns the active streams ordered by message stream ID.
+func (st *commandState) sortedStreams() []*streamState {
+	out := make([]*streamState, 0, len(st.streams))
+	for _, ss := range st.streams {
+		out = append(out, ss)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].id < out[j].id })
+	return out
 }
 
 // attachCommandHandling installs a dispatcher-backed message handler on the
-// provided connection. Safe to call immediately after Accept returns.
-func attachCommandHandling(c *iconn.Connection, reg *Registry, cfg *Config, log *slog.Logger, destMgr *relay.DestinationManager, srv *Server) {
+// provided connection. Safe to call immediately after Accept returns. ctx
+// carries the connection's trace span, which is ended on disconnect.
+func attachCommandHandling(ctx context.Context, c *iconn.Connection, reg *Registry, cfg *Config, log *slog.Logger, destMgr *relay.DestinationManager, srv *Server) {
 	if c == nil || reg == nil || cfg == nil {
 		return
 	}
 	st := &commandState{
-		allocator:     rpc.NewStreamIDAllocator(),
-		mediaLogger:   NewMediaLogger(c.ID(), log, 30*time.Second),
-		codecDetector: &media.CodecDetector{},
+		sess:        c.Session(),
+		allocator:   rpc.NewStreamIDAllocator(),
+		mediaLogger: NewMediaLogger(c.ID(), log, 30*time.Second),
+		streams:     make(map[uint32]*streamState),
+		trace:       ctx,
+		clientCert:  clientCertOf(c.NetConn()),
 	}
-	// Install disconnect handler — fires when readLoop exits for any reason.
-	c.SetDisconnectHandler(func() {
-		// 1. Stop media logger (prevents goroutine + ticker leak)
-		st.mediaLogger.Stop()
+	if cfg.Inspect {
+		st.inspect = newInspector(c)
+	}
+	// endStream releases everything an active stream holds: recorder and
+	// publisher slot (so another client can publish the same key), relay
+	// destinations and transcoder, or the subscriber slot and VOD playback.
+	// It fires the matching stop hook and forgets the stream. Used by the
+	// deleteStream/closeStream handlers and on disconnect.
+	endStream := func(ss *streamState, reason string) {
+		log.Info("stream teardown", "reason", reason, "conn_id", c.ID(),
+			"stream_id", ss.id, "stream_key", ss.streamKey, "role", ss.role)
+		delete(st.streams, ss.id)
+		st.sess.EndStream(ss.id)
+		ss.endGoLive()
+		if ss.inspected {
+			return
+		}
 
-		// Compute session duration for hook data.
+		if ss.vod != nil {
+			ss.vod.Stop()
+			ss.vod = nil
+		}
+		if ss.dvr != nil {
+			ss.dvr.Stop()
+			ss.dvr = nil
+		}
 		durationSec := time.Since(c.AcceptedAt()).Seconds()
 
-		// 2. Publisher cleanup: close recorder, unregister publisher, fire hook
-		if st.streamKey != "" && st.role == "publisher" {
-			stream := reg.GetStream(st.streamKey)
+		switch ss.role {
+		case iconn.RolePublisher:
+			stream := reg.GetStream(ss.streamKey)
 			if stream != nil {
-				// Close recorder under lock (concurrent with cleanupAllRecorders)
+				// Close the recorder (if active) under lock to avoid races
+				// with cleanupAllRecorders and the media dispatch path.
 				stream.mu.Lock()
 				if stream.Recorder != nil {
 					if err := stream.Recorder.Close(); err != nil {
 						metrics.RecordingErrorsTotal.Add(1)
-						log.Error("recorder close error on disconnect", "error", err, "stream_key", st.streamKey)
+						log.Error("recorder close error on stream teardown",
+							"error", err, "stream_key", ss.streamKey)
 					}
 					metrics.RecordingsActive.Add(-1)
 					stream.Recorder = nil
 				}
 				stream.mu.Unlock()
-				// Unregister publisher (allows stream key reuse by new publisher)
-				PublisherDisconnected(reg, st.streamKey, c)
 			}
+
+			if ss.recording && reason != "disconnect" {
+				if status, err := buildOnStatus(ss.id, ss.streamKey, rpc.CodeRecordStop,
+					fmt.Sprintf("Stopped recording %s.", ss.streamKey)); err == nil {
+					_ = c.SendMessage(status)
+				}
+			}
+
+			// Remove this connection as the publisher. After this call, a new
+			// client can successfully publish to the same stream key.
+			PublisherDisconnected(reg, ss.streamKey, c)
+			if st.vhost == nil {
+				srv.stopTranscode(ss.streamKey)
+			}
+			if ss.relayStop != nil {
+				ss.relayStop()
+			}
+
+			// Fire the publish-stop hook so external systems (webhooks, scripts)
+			// know the stream has ended.
 			audioPkts, videoPkts, totalBytes, audioCodec, videoCodec := st.mediaLogger.GetStats()
-			srv.triggerHookEvent(hooks.EventPublishStop, c.ID(), st.streamKey, map[string]interface{}{
+			srv.triggerHookEvent(hooks.EventPublishStop, c.ID(), ss.streamKey, st.hookData(map[string]interface{}{
 				"audio_packets": audioPkts,
 				"video_packets": videoPkts,
 				"total_bytes":   totalBytes,
 				"audio_codec":   audioCodec,
 				"video_codec":   videoCodec,
 				"duration_sec":  durationSec,
-			})
-		}
-
-		// 3. Subscriber cleanup: unregister subscriber, fire hook
-		if st.streamKey != "" && st.role == "subscriber" {
-			SubscriberDisconnected(reg, st.streamKey, c)
-			srv.triggerHookEvent(hooks.EventPlayStop, c.ID(), st.streamKey, map[string]interface{}{
+			}))
+		case iconn.RoleSubscriber:
+			// Subscriber cleanup: remove from the stream's subscriber list,
+			// keeping its drop counts for the play_stop event.
+			drops, _ := reg.GetStream(ss.streamKey).SubscriberDrops(c)
+			SubscriberDisconnected(reg, ss.streamKey, c)
+			if ss.pull != nil {
+				srv.releaseOriginPull(ss.pull)
+			}
+			if ss.authRelease != nil {
+				ss.authRelease()
+			}
+			if reason != "disconnect" {
+				// The player closed this stream but keeps the connection:
+				// confirm playback on it has ended.
+				_ = c.SendStreamEOF(ss.id)
+			}
+			// Both events carry the number of players left, for viewer
+			// count dashboards.
+			stream := reg.GetStream(ss.streamKey)
+			count := 0
+			if stream != nil {
+				count = stream.SubscriberCount()
+			}
+			srv.triggerHookEvent(hooks.EventPlayStop, c.ID(), ss.streamKey, st.hookData(map[string]interface{}{
 				"duration_sec": durationSec,
-			})
-			// Fire subscriber count change after removal
-			stream := reg.GetStream(st.streamKey)
+				"audio_drops":  drops.AudioDrops,
+				"video_drops":  drops.VideoDrops,
+				"subscribers":  count,
+			}))
+			// Notify external systems about the updated subscriber count.
 			if stream != nil {
-				srv.triggerHookEvent(hooks.EventSubscriberCount, c.ID(), st.streamKey, map[string]interface{}{
-					"count": stream.SubscriberCount(),
-				})
+				srv.triggerHookEvent(hooks.EventSubscriberCount, c.ID(), ss.streamKey, st.hookData(map[string]interface{}{
+					"count": count,
+				}))
 			}
 		}
+	}
 
-		// 4. Remove from server connection tracking (fixes memory leak)
-		srv.RemoveConnection(c.ID())
+	// Install disconnect handler — fires when readLoop exits for any reason.
+	c.SetDisconnectHandler(func() {
+		// 1. Stop media logger (prevents goroutine + ticker leak)
+		st.mediaLogger.Stop()
 
-		// 5. Fire connection close hook
-		srv.triggerHookEvent(hooks.EventConnectionClose, c.ID(), st.streamKey, map[string]interface{}{
-			"role":         st.role,
-			"duration_sec": durationSec,
-		})
+		// The connection close hook reports the first active stream.
+		var streamKey, role string
+		active := st.sortedStreams()
+		if len(active) > 0 {
+			streamKey, role = active[0].streamKey, active[0].role
+		}
+
+		// 2. Release every publishing/playing stream (recorders, publisher
+		// and subscriber slots, relays) and fire their stop hooks.
+		for _, ss := range active {
+			endStream(ss, "disconnect")
+		}
+
+		// 3. Remove from server connection tracking (fixes memory leak)
+		srv.RemoveConnection(c.ID())
+		if st.inspect != nil {
+			srv.reportInspection(st.inspect.finish())
+		}
 
-		log.Info("connection disconnected", "conn_id", c.ID(), "stream_key", st.streamKey, "role", st.role)
+		// 4. Fire connection close hook
+		srv.triggerHookEvent(hooks.EventConnectionClose, c.ID(), streamKey, st.hookData(map[string]interface{}{
+			"role":         role,
+			"duration_sec": time.Since(c.AcceptedAt()).Seconds(),
+		}))
+
+		// The summary names the peer's software and the control values it
+		// negotiated, to tell which encoder a problematic session ran.
+		info, ctrl := st.sess.Info(), c.ControlState()
+		log.Info("connection disconnected", "conn_id", c.ID(), "stream_key", streamKey, "role", role,
+			"flash_ver", info.FlashVer, "encoder", st.sess.Encoder(), "peer_chunk_size", ctrl.ReadChunkSize,
+			"peer_window_ack_size", ctrl.RemoteWindowAckSize, "peer_bandwidth", ctrl.RemoteBandwidth,
+			"bytes_in", c.BytesRead(), "bytes_out", c.BytesWritten(), "duration_sec", time.Since(c.AcceptedAt()).Seconds())
+		telemetry.SpanFromContext(st.trace).End()
 	})
-	d := rpc.NewDispatcher(func() string { return st.app })
+	// Handlers return failures as errors; the dispatcher answers them and
+	// closes the connection when the error calls for it.
+	d := rpc.NewDispatcher(st.sess.App)
+	d.Reply = c.SendMessage
+	d.Close = c.Shutdown
+	d.TxnMode = cfg.StatusTxnMode
 
 	d.OnConnect = func(cc *rpc.ConnectCommand, msg *chunk.Message) error {
-		log.Debug("OnConnect handler invoked", "app", cc.App, "tcUrl", cc.TcURL, "txn_id", cc.TransactionID)
-		st.app = cc.App
-		st.connectParams = cc.Extra // preserve extra connect fields for auth context
+		log.Debug("OnConnect handler invoked", "app", cc.App, "tcUrl", cc.TcURL, "txn_id", cc.TransactionID,
+			"flashVer", cc.FlashVer, "swfUrl", cc.SwfURL, "pageUrl", cc.PageURL, "objectEncoding", cc.ObjectEncoding,
+			"audioCodecs", cc.AudioCodecs, "videoCodecs", cc.VideoCodecs)
+		if err := srv.keyPolicy.Check(cc.App); err != nil {
+			return rtmperrors.NewCommandError("connect", rpc.CodeConnectInvalidApp, "Invalid application name.", fmt.Errorf("app %q: %w", cc.App, err))
+		}
+		// A virtual host's connections use its registry, configuration
+		// and relays from here on (vhost.go).
+		if vh := srv.vhostFor(cc.TcURL); vh != nil {
+			st.vhost = vh
+			reg, cfg, destMgr = vh.reg, &vh.cfg, vh.destMgr
+			log = log.With("vhost", vh.name)
+			log.Info("virtual host resolved", "conn_id", c.ID(), "tcUrl", cc.TcURL)
+		}
+		info := iconn.ConnectInfo{
+			App:            cc.App,
+			TcURL:          cc.TcURL,
+			FlashVer:       cc.FlashVer,
+			ObjectEncoding: cc.ObjectEncoding,
+			FourCcList:     cc.FourCcList,
+			Params:         cc.Extra, // preserved for auth context
+		}
+		// The app's own settings ride on the session for the publish, play
+		// and media handlers.
+		app := cfg.appConfig(cc.App)
+		if app != nil {
+			info.AppConfig = app
+		}
+		if err := st.sess.Connect(info); err != nil {
+			return rtmperrors.NewCommandError("connect", rpc.CodeConnectRejected, "Already connected.", err)
+		}
+		c.UpdateReadLimits(cfg.readLimits(true))
+		if err := applyAppControl(c, cfg, app); err != nil {
+			log.Warn("app control settings not sent", "app", cc.App, "error", err)
+		}
 
 		// Track Enhanced RTMP capabilities from client's fourCcList.
 		if len(cc.FourCcList) > 0 {
-			st.enhancedRTMP = true
-			st.fourCcList = cc.FourCcList
 			log.Info("Enhanced RTMP client detected", "fourCcList", cc.FourCcList)
 		}
 
-		resp, err := rpc.BuildConnectResponse(cc.TransactionID, "Connection succeeded.", cc.FourCcList)
+		resp, err := rpc.BuildConnectResponseFor(cc, "Connection succeeded.")
 		if err != nil {
-			log.Error("connect response build failed", "error", err)
-			return nil
+			return err
 		}
 		if err := c.SendMessage(resp); err != nil {
-			log.Error("connect response send failed", "error", err)
-		} else {
-			log.Info("connect response sent", "app", cc.App)
+			return fmt.Errorf("send connect response: %w", err)
 		}
+		log.Info("connect response sent", "app", cc.App)
 		return nil
 	}
 
 	d.OnCreateStream = func(cs *rpc.CreateStreamCommand, msg *chunk.Message) error {
 		resp, streamID, err := rpc.BuildCreateStreamResponse(cs.TransactionID, st.allocator)
 		if err != nil {
-			log.Error("createStream response build failed", "error", err)
-			return nil
+			return err
+		}
+		if err := st.sess.CreateStream(streamID); err != nil {
+			return rtmperrors.NewCommandError("createStream", rpc.CodeCallFailed, "createStream failed.", err)
 		}
 		if err := c.SendMessage(resp); err != nil {
-			log.Error("createStream response send failed", "error", err)
-		} else {
-			log.Info("createStream response sent", "stream_id", streamID, "txn_id", cs.TransactionID)
+			return fmt.Errorf("send createStream response: %w", err)
 		}
+		log.Info("createStream response sent", "stream_id", streamID, "txn_id", cs.TransactionID)
 
 		// Send UserControl StreamBegin to signal stream is ready.
-		streamBegin := control.EncodeUserControlStreamBegin(streamID)
-		if err := c.SendMessage(streamBegin); err != nil {
+		if err := c.SendStreamBegin(streamID); err != nil {
 			log.Error("StreamBegin send failed", "error", err, "stream_id", streamID)
 		}
 		return nil
 	}
 
 	d.OnPublish = func(pc *rpc.PublishCommand, msg *chunk.Message) error {
+		// The stream must have been created and be idle on this connection.
+		if err := st.sess.CheckStream(msg.MessageStreamID, iconn.RolePublisher); err != nil {
+			return rtmperrors.NewCommandError("publish", rpc.CodePublishFailed, "Stream is not ready for publishing.", err)
+		}
+		if err := srv.keyPolicy.Check(pc.StreamKey); err != nil {
+			return rtmperrors.NewCommandError("publish", rpc.CodePublishBadName, "Invalid stream name.", fmt.Errorf("stream key %q: %w", pc.StreamKey, err))
+		}
+		if cfg.Inspect {
+			return inspectPublish(c, st, pc, msg, cfg.StatusTxnMode)
+		}
+
+		// Publisher identity is the connection, so one connection cannot
+		// publish the same key on two message streams.
+		if st.findStream(pc.StreamKey, iconn.RolePublisher, msg.MessageStreamID) != nil {
+			return rtmperrors.NewCommandError("publish", rpc.CodePublishBadName, fmt.Sprintf("Stream %s is already being published.", pc.StreamKey), nil)
+		}
+
+		// An alias only carries its sources' media.
+		if cfg.isStreamAlias(pc.StreamKey) || (st.vhost == nil && srv.isStreamAlias(pc.StreamKey)) {
+			return rtmperrors.NewCommandError("publish", rpc.CodePublishBadName, fmt.Sprintf("Stream %s is an alias and cannot be published to.", pc.StreamKey), nil)
+		}
+
+		// The app may cap how many of its streams are live; a publisher
+		// taking over a live key does not add one.
+		app := sessionApp(st.sess)
+		if app != nil && app.MaxPublishers > 0 && !hasLivePublisher(reg, pc.StreamKey) &&
+			reg.LivePublishers(st.sess.App()) >= app.MaxPublishers {
+			return rtmperrors.NewCommandError("publish", rpc.CodePublishFailed,
+				fmt.Sprintf("Application %s is limited to %d publishers.", st.sess.App(), app.MaxPublishers), nil)
+		}
+
 		// Validate auth token before allowing publish.
-		if rejected := authenticateRequest(cfg, c, st, msg, "publish", pc.PublishingName, pc.StreamKey, pc.QueryParams, log, srv); rejected {
-			return nil
+		if _, err := authenticateRequest(cfg, c, st, "publish", pc.PublishingName, pc.StreamKey, pc.QueryParams, log, srv); err != nil {
+			return err
 		}
 
 		// Delegate to existing publish handler (sends onStatus internally).
-		_, err := HandlePublish(reg, c, st.app, msg)
+		_, err := HandlePublish(reg, c, st.sess.App(), msg)
+
+		// Under the rename policy a duplicate publisher is moved to a free
+		// "<key>_dupN" key and told about it in the Publish.Start details.
+		if err == ErrPublisherExists && cfg.DuplicatePublisherPolicy == PublisherPolicyRename {
+			if newKey, renameErr := claimRenamedStream(reg, pc.StreamKey, c); renameErr == nil {
+				log.Warn("renaming duplicate publisher",
+					"stream_key", pc.StreamKey,
+					"new_stream_key", newKey,
+					"new_conn_id", c.ID())
+				if onStatus, buildErr := buildStatusReply(cfg.StatusTxnMode, msg, newKey, rpc.CodePublishStart,
+					fmt.Sprintf("Publishing %s as %s.", pc.StreamKey, newKey)); buildErr == nil {
+					_ = c.SendMessage(onStatus)
+				}
+				pc.StreamKey = newKey
+				err = nil
+			}
+		}
+		if err == ErrPublisherExists && cfg.DuplicatePublisherPolicy == PublisherPolicyReject {
+			log.Warn("rejecting duplicate publisher",
+				"stream_key", pc.StreamKey,
+				"new_conn_id", c.ID())
+		}
 
 		// If publish failed because another publisher already occupies this
 		// stream key, evict the stale publisher and retry. This handles the
@@ -180,7 +438,7 @@ func attachCommandHandling(c *iconn.Connection, reg *Registry, cfg *Config, log
 		// then reconnects on a new TCP connection while the old zombie
 		// connection hasn't timed out yet. Without eviction, the new
 		// connection would be rejected with "publisher already registered".
-		if err == ErrPublisherExists {
+		if err == ErrPublisherExists && cfg.DuplicatePublisherPolicy == PublisherPolicyReplace {
 			log.Warn("evicting stale publisher",
 				"stream_key", pc.StreamKey,
 				"new_conn_id", c.ID())
@@ -209,8 +467,9 @@ func attachCommandHandling(c *iconn.Connection, reg *Registry, cfg *Config, log
 
 				// Send onStatus to the new publisher since HandlePublish
 				// didn't get to send it (it failed with ErrPublisherExists).
-				onStatus, buildErr := buildOnStatus(
-					msg.MessageStreamID,
+				onStatus, buildErr := buildStatusReply(
+					cfg.StatusTxnMode,
+					msg,
 					pc.StreamKey,
 					"NetStream.Publish.Start",
 					fmt.Sprintf("Publishing %s.", pc.StreamKey),
@@ -229,6 +488,12 @@ func attachCommandHandling(c *iconn.Connection, reg *Registry, cfg *Config, log
 				stream.VideoCodec = ""
 				stream.VideoTrackHeaders = make(map[uint8][]byte)
 				stream.AudioTrackHeaders = make(map[uint8][]byte)
+				stream.VideoFourCCHeaders = nil
+				stream.timecode = nil
+				stream.keyframe = nil
+				stream.thumbnail = nil
+				stream.invalidVideoWarned.Store(false)
+				stream.clearRecordGOP()
 				stream.mu.Unlock()
 
 				// Clear the error so we proceed with normal publish setup below.
@@ -237,33 +502,82 @@ func attachCommandHandling(c *iconn.Connection, reg *Registry, cfg *Config, log
 		}
 
 		if err != nil {
-			log.Error("publish handle", "error", err)
-			return nil
+			code, desc := rpc.CodePublishFailed, fmt.Sprintf("Failed to publish %s.", pc.StreamKey)
+			if err == ErrPublisherExists {
+				code, desc = rpc.CodePublishBadName, fmt.Sprintf("Stream %s is already being published.", pc.StreamKey)
+			}
+			return rtmperrors.NewCommandError("publish", code, desc, err)
 		}
 
-		// Track stream key for this connection
-		st.streamKey = pc.StreamKey
-		st.role = "publisher"
+		// Track the publish on its message stream.
+		ss := &streamState{
+			id:            msg.MessageStreamID,
+			streamKey:     pc.StreamKey,
+			role:          iconn.RolePublisher,
+			codecDetector: &media.CodecDetector{},
+		}
+		st.streams[ss.id] = ss
+		_ = st.sess.Publish(ss.id, pc.StreamKey) // checked above
+		st.startGoLive(ss)
 
 		// Trigger publish start hook event
-		srv.triggerHookEvent(hooks.EventPublishStart, c.ID(), pc.StreamKey, map[string]interface{}{
-			"app":             st.app,
+		srv.triggerHookEvent(hooks.EventPublishStart, c.ID(), pc.StreamKey, st.hookData(map[string]interface{}{
+			"app":             st.sess.App(),
 			"publishing_name": pc.PublishingName,
-		})
+		}))
+		if st.vhost == nil { // default-host features (vhost.go)
+			srv.startTranscode(pc.StreamKey, pc.QueryParams)
+			srv.ensureRedundantAlias(pc.StreamKey)
+		}
+		if destMgr != nil {
+			var appRelays []string
+			if app != nil {
+				appRelays = app.RelayDestinations
+			}
+			ss.relayStop = destMgr.StartStreamWith(ss.streamKey, appRelays)
+		}
 
 		// Mark stream for recording — actual recorder creation is deferred to the
 		// first media frame (in dispatchMedia → ensureRecorder) so that the video
 		// codec is known and the correct container format (FLV for H.264, MP4 for
-		// H.265+) is selected.
-		if cfg.RecordAll {
-			stream := reg.GetStream(pc.StreamKey)
-			if stream != nil {
-				stream.mu.Lock()
+		// H.265+) is selected. Streams are recorded under RecordAll or a
+		// matching RecordStreams pattern, unless their app turns recording
+		// on or off, and a publish of type "record" or "append" is recorded
+		// regardless; "append" continues the stream's latest FLV recording.
+		record := srv.recordsStream(pc.StreamKey)
+		if st.vhost != nil {
+			record = st.vhost.recordsStream(pc.StreamKey)
+		}
+		if app != nil && app.Record != nil {
+			record = *app.Record
+		}
+		record = record || pc.PublishingType == rpc.PublishRecord || pc.PublishingType == rpc.PublishAppend
+		if stream := reg.GetStream(pc.StreamKey); stream != nil {
+			stream.mu.Lock()
+			stream.RecordDir = "" // a previous publish's request does not carry over
+			stream.RecordAppend = false
+			stream.recordSync, stream.recordBase = record, 0
+			if record {
 				stream.RecordDir = cfg.RecordDir
+				stream.RecordAppend = pc.PublishingType == rpc.PublishAppend
 				stream.SegmentDuration = cfg.SegmentDuration // propagate segment config
 				stream.SegmentPattern = cfg.SegmentPattern   // propagate segment config
-				stream.mu.Unlock()
-				log.Info("recording requested", "stream_key", pc.StreamKey, "record_dir", cfg.RecordDir)
+				stream.RecordFormat = cfg.RecordFormat
+				stream.RecordTimecode = cfg.RecordTimecode
+				stream.RecordQueueSize = cfg.RecordQueueSize
+				stream.RecordingClosed = srv.recordingClosedFunc(st.vhost, pc.StreamKey)
+			}
+			stream.mu.Unlock()
+			if record {
+				log.Info("recording requested", "stream_key", pc.StreamKey, "record_dir", cfg.RecordDir,
+					"publishing_type", pc.PublishingType)
+			}
+		}
+		if pc.PublishingType != rpc.PublishLive {
+			ss.recording = true
+			if status, buildErr := buildStatusReply(cfg.StatusTxnMode, msg, pc.StreamKey, rpc.CodeRecordStart,
+				fmt.Sprintf("Recording %s.", pc.StreamKey)); buildErr == nil {
+				_ = c.SendMessage(status)
 			}
 		}
 
@@ -271,127 +585,163 @@ func attachCommandHandling(c *iconn.Connection, reg *Registry, cfg *Config, log
 	}
 
 	d.OnPlay = func(pl *rpc.PlayCommand, msg *chunk.Message) error {
-		// Validate auth token before allowing play.
-		if rejected := authenticateRequest(cfg, c, st, msg, "play", pl.StreamName, pl.StreamKey, pl.QueryParams, log, srv); rejected {
-			return nil
+		// The stream must have been created and not be publishing.
+		if err := st.sess.CheckStream(msg.MessageStreamID, iconn.RoleSubscriber); err != nil {
+			return rtmperrors.NewCommandError("play", rpc.CodePlayFailed, "Stream is not ready for playback.", err)
+		}
+		if err := srv.keyPolicy.Check(pl.StreamKey); err != nil {
+			return rtmperrors.NewCommandError("play", rpc.CodePlayFailed, "Invalid stream name.", fmt.Errorf("stream key %q: %w", pl.StreamKey, err))
+		}
+		if _, err := ParseMediaFilter(pl.QueryParams["media"]); err != nil {
+			return rtmperrors.NewCommandError("play", rpc.CodePlayFailed, "Invalid media selection.", err)
+		}
+
+		// Subscriber identity is the connection, so one connection cannot
+		// play the same key on two message streams.
+		if st.findStream(pl.StreamKey, iconn.RoleSubscriber, msg.MessageStreamID) != nil {
+			return rtmperrors.NewCommandError("play", rpc.CodePlayFailed, fmt.Sprintf("Already playing %s.", pl.StreamKey), nil)
+		}
+
+		// Validate auth token before allowing play. A session-counted token
+		// holds its session until the play ends; every path below that
+		// does not start the play gives it back.
+		releaseAuth, err := authenticateRequest(cfg, c, st, "play", pl.StreamName, pl.StreamKey, pl.QueryParams, log, srv)
+		if err != nil {
+			return err
+		}
+
+		// Play on a stream that is already playing switches to the new key.
+		if prev := st.streams[msg.MessageStreamID]; prev != nil {
+			endStream(prev, "play")
+		}
+
+		// Edge mode: a stream with no local publisher is pulled from the
+		// origin or the cluster node publishing it, and every player of it
+		// holds a reference on the pull.
+		var pull *originPull
+		if st.vhost == nil {
+			if pull, err = srv.acquireOriginPull(pl.StreamKey); err != nil {
+				log.Warn("origin pull unavailable", "stream_key", pl.StreamKey, "error", err)
+			}
+		}
+
+		// A negative start offset plays the stream from its DVR buffer.
+		if offset, ok := dvrStartOffset(pl.Start); ok && hasLivePublisher(reg, pl.StreamKey) {
+			if session := startDVRPlayback(reg, c, st, pl, msg, offset, log); session != nil {
+				st.streams[msg.MessageStreamID].pull = pull
+				st.streams[msg.MessageStreamID].authRelease = releaseAuth
+				count := reg.GetStream(pl.StreamKey).SubscriberCount()
+				srv.triggerHookEvent(hooks.EventPlayStart, c.ID(), pl.StreamKey, st.hookData(map[string]interface{}{
+					"app":           st.sess.App(),
+					"subscribers":   count,
+					"dvr_offset_ms": offset.Milliseconds(),
+				}))
+				srv.triggerHookEvent(hooks.EventSubscriberCount, c.ID(), pl.StreamKey, st.hookData(map[string]interface{}{
+					"count": count,
+				}))
+				return nil
+			}
+		}
+
+		// No live publisher: fall back to a matching recording when VOD is enabled.
+		if cfg.VODEnabled && !hasLivePublisher(reg, pl.StreamKey) {
+			if started := startVODPlayback(cfg, c, st, pl, msg, log); started {
+				st.streams[msg.MessageStreamID].authRelease = releaseAuth
+				srv.triggerHookEvent(hooks.EventPlayStart, c.ID(), pl.StreamKey, st.hookData(map[string]interface{}{
+					"app": st.sess.App(),
+					"vod": true,
+				}))
+				return nil
+			}
 		}
 
 		// Delegate to existing play handler (sends onStatus internally).
-		if _, err := HandlePlay(reg, c, st.app, msg); err != nil {
-			log.Error("play handle", "error", err)
-			return nil
+		if _, err := HandlePlay(reg, c, st.sess.App(), msg); err != nil {
+			if pull != nil {
+				srv.releaseOriginPull(pull)
+			}
+			if releaseAuth != nil {
+				releaseAuth()
+			}
+			if errors.Is(err, ErrSubscriberLimit) {
+				limit := reg.subscriberLimit(st.sess.App())
+				srv.triggerHookEvent(hooks.EventSubscriberLimit, c.ID(), pl.StreamKey, st.hookData(map[string]interface{}{
+					"app":   st.sess.App(),
+					"limit": limit,
+				}))
+				return rtmperrors.NewCommandError("play", rpc.CodePlayFailed, fmt.Sprintf("Stream %s is limited to %d players.", pl.StreamKey, limit), err)
+			}
+			return rtmperrors.NewCommandError("play", rpc.CodePlayFailed, fmt.Sprintf("Failed to play %s.", pl.StreamKey), err)
 		}
 
-		// Track stream key for this connection
-		st.streamKey = pl.StreamKey
-		st.role = "subscriber"
+		// Track the play on its message stream.
+		st.streams[msg.MessageStreamID] = &streamState{
+			id:          msg.MessageStreamID,
+			streamKey:   pl.StreamKey,
+			role:        iconn.RoleSubscriber,
+			pull:        pull,
+			authRelease: releaseAuth,
+		}
+		_ = st.sess.Play(msg.MessageStreamID, pl.StreamKey) // checked above
 
-		// Trigger play start hook event
-		srv.triggerHookEvent(hooks.EventPlayStart, c.ID(), pl.StreamKey, map[string]interface{}{
-			"app": st.app,
-		})
-		// Fire subscriber count change after addition
+		// Trigger play start hook event, with the player count including
+		// this one.
 		stream := reg.GetStream(pl.StreamKey)
+		count := 0
 		if stream != nil {
-			srv.triggerHookEvent(hooks.EventSubscriberCount, c.ID(), pl.StreamKey, map[string]interface{}{
-				"count": stream.SubscriberCount(),
-			})
+			count = stream.SubscriberCount()
+		}
+		srv.triggerHookEvent(hooks.EventPlayStart, c.ID(), pl.StreamKey, st.hookData(map[string]interface{}{
+			"app":         st.sess.App(),
+			"subscribers": count,
+		}))
+		// Fire subscriber count change after addition
+		if stream != nil {
+			srv.triggerHookEvent(hooks.EventSubscriberCount, c.ID(), pl.StreamKey, st.hookData(map[string]interface{}{
+				"count": count,
+			}))
 		}
 
 		return nil
 	}
 
 	// handleStreamTeardown is a shared helper used by both the deleteStream and
-	// closeStream handlers below. When an RTMP client ends a session, it sends
-	// one of these commands to tell the server to release the stream. Without
-	// this cleanup, the publisher stays registered in the registry even after
-	// the client disconnects, which blocks any new publisher from reusing the
-	// same stream key (they get "publisher already registered" errors).
+	// closeStream handlers below. When an RTMP client ends a stream, it sends
+	// one of these commands to tell the server to release it. Without this
+	// cleanup, the publisher stays registered in the registry even after the
+	// client stops, which blocks any new publisher from reusing the same
+	// stream key (they get "publisher already registered" errors).
 	//
-	// This function performs three things:
-	//   1. Clears the publisher or subscriber from the stream registry
-	//   2. Closes any active FLV recorder for the stream
-	//   3. Resets the connection's role and stream key so the disconnect handler
-	//      (which fires later when the TCP connection closes) doesn't try to
-	//      clean up the same state a second time
-	handleStreamTeardown := func(commandName string) {
-		// If no stream was ever published or played on this connection, there
-		// is nothing to clean up. This can happen if the client sends
-		// deleteStream before completing a publish or play handshake.
-		if st.streamKey == "" {
-			log.Debug("stream teardown: no active stream", "command", commandName, "conn_id", c.ID())
+	// Only the named message stream is released; other streams on the same
+	// connection keep publishing or playing. Forgetting it here also means
+	// the disconnect handler won't clean up the same state a second time.
+	handleStreamTeardown := func(commandName string, streamID uint32) {
+		// If nothing was published or played on this stream there is nothing
+		// to clean up. This can happen if the client sends deleteStream
+		// before completing a publish or play handshake.
+		ss := st.streams[streamID]
+		if ss == nil {
+			log.Debug("stream teardown: no active stream", "command", commandName, "conn_id", c.ID(), "stream_id", streamID)
 			return
 		}
-
-		log.Info("stream teardown", "command", commandName, "conn_id", c.ID(),
-			"stream_key", st.streamKey, "role", st.role)
-
-		if st.role == "publisher" {
-			// Publisher cleanup: close the recorder and unregister from the
-			// registry so another client can publish to the same stream key.
-			stream := reg.GetStream(st.streamKey)
-			if stream != nil {
-				// Close the FLV recorder (if active) under lock to avoid races
-				// with the media dispatch goroutine that writes to it.
-				stream.mu.Lock()
-				if stream.Recorder != nil {
-					if err := stream.Recorder.Close(); err != nil {
-						metrics.RecordingErrorsTotal.Add(1)
-						log.Error("recorder close error on stream teardown",
-							"error", err, "stream_key", st.streamKey)
-					}
-					metrics.RecordingsActive.Add(-1)
-					stream.Recorder = nil
-				}
-				stream.mu.Unlock()
-			}
-
-			// Remove this connection as the publisher. After this call, a new
-			// client can successfully publish to the same stream key.
-			PublisherDisconnected(reg, st.streamKey, c)
-
-			// Fire the publish-stop hook so external systems (webhooks, scripts)
-			// know the stream has ended.
-			audioPkts, videoPkts, totalBytes, audioCodec, videoCodec := st.mediaLogger.GetStats()
-			durationSec := time.Since(c.AcceptedAt()).Seconds()
-			srv.triggerHookEvent(hooks.EventPublishStop, c.ID(), st.streamKey, map[string]interface{}{
-				"audio_packets": audioPkts,
-				"video_packets": videoPkts,
-				"total_bytes":   totalBytes,
-				"audio_codec":   audioCodec,
-				"video_codec":   videoCodec,
-				"duration_sec":  durationSec,
-			})
-		} else if st.role == "subscriber" {
-			// Subscriber cleanup: remove from the stream's subscriber list.
-			SubscriberDisconnected(reg, st.streamKey, c)
-
-			durationSec := time.Since(c.AcceptedAt()).Seconds()
-			srv.triggerHookEvent(hooks.EventPlayStop, c.ID(), st.streamKey, map[string]interface{}{
-				"duration_sec": durationSec,
-			})
-			// Notify external systems about the updated subscriber count.
-			stream := reg.GetStream(st.streamKey)
-			if stream != nil {
-				srv.triggerHookEvent(hooks.EventSubscriberCount, c.ID(), st.streamKey, map[string]interface{}{
-					"count": stream.SubscriberCount(),
-				})
-			}
-		}
-
-		// Clear the role and stream key so the disconnect handler (which fires
-		// when the TCP connection finally closes) knows there is nothing left
-		// to clean up. Without this, we would double-free the publisher or
-		// subscriber slot.
-		st.role = ""
-		st.streamKey = ""
+		endStream(ss, commandName)
 	}
 
 	// deleteStream handler: called when the client sends the standard RTMP
 	// "deleteStream" command to release a previously created stream. This is
 	// the primary teardown command defined in the RTMP specification.
 	d.OnDeleteStream = func(values []interface{}, msg *chunk.Message) error {
-		handleStreamTeardown("deleteStream")
+		// deleteStream names the stream in its argument; fall back to the
+		// message stream for clients that send it on the stream itself.
+		streamID := msg.MessageStreamID
+		if len(values) > 3 {
+			if id, ok := values[3].(float64); ok {
+				streamID = uint32(id)
+			}
+		}
+		handleStreamTeardown("deleteStream", streamID)
+		st.sess.DeleteStream(streamID)
+		st.allocator.Release(streamID)
 		return nil
 	}
 
@@ -400,89 +750,342 @@ func attachCommandHandling(c *iconn.Connection, reg *Registry, cfg *Config, log
 	// certain mobile streaming apps use this non-standard command. It serves
 	// the same purpose as deleteStream so we perform identical cleanup.
 	d.OnCloseStream = func(values []interface{}, msg *chunk.Message) error {
-		handleStreamTeardown("closeStream")
+		handleStreamTeardown("closeStream", msg.MessageStreamID)
+		st.sess.EndStream(msg.MessageStreamID)
+		return nil
+	}
+
+	// receiveAudio / receiveVideo handler: players turn one track of a live
+	// or DVR play off and back on (media_filter.go). Recorded playback
+	// keeps sending both.
+	d.OnReceive = func(rc *rpc.ReceiveCommand, msg *chunk.Message) error {
+		ss := st.streams[msg.MessageStreamID]
+		if ss == nil || ss.role != iconn.RoleSubscriber || ss.vod != nil {
+			log.Debug("track selection ignored: not playing live", "conn_id", c.ID(), "stream_id", msg.MessageStreamID)
+			return nil
+		}
+		stream := reg.GetStream(ss.streamKey)
+		f := stream.SubscriberMedia(c)
+		if rc.Video {
+			f.NoVideo = !rc.Receive
+		} else {
+			f.NoAudio = !rc.Receive
+		}
+		stream.SetSubscriberMedia(c, f)
+		log.Debug("track selection", "conn_id", c.ID(), "stream_key", ss.streamKey, "media", f.String())
+		return nil
+	}
+
+	// pause handler: players send pause(true) / pause(false) on the play
+	// stream. VOD sessions stop reading the file and DVR sessions the
+	// buffer; live subscribers have media skipped (not buffered) and resume
+	// at the next keyframe.
+	d.OnPause = func(pc *rpc.PauseCommand, msg *chunk.Message) error {
+		ss := st.streams[msg.MessageStreamID]
+		if ss == nil || ss.role != iconn.RoleSubscriber {
+			log.Debug("pause ignored: not playing", "conn_id", c.ID(), "stream_id", msg.MessageStreamID)
+			return nil
+		}
+		if ss.vod != nil && !ss.vod.Finished() {
+			// The VOD goroutine sends the notification once it has paused.
+			ss.vod.Pause(pc.Pause)
+			return nil
+		}
+		if ss.dvr != nil {
+			ss.dvr.Pause(pc.Pause)
+			return nil
+		}
+		if ss.vod == nil {
+			if stream := reg.GetStream(ss.streamKey); stream != nil {
+				if pc.Pause {
+					stream.PauseSubscriber(c)
+				} else {
+					stream.ResumeSubscriber(c)
+				}
+			}
+		}
+		code, desc := "NetStream.Unpause.Notify", fmt.Sprintf("Unpausing %s.", ss.streamKey)
+		if pc.Pause {
+			code, desc = "NetStream.Pause.Notify", fmt.Sprintf("Pausing %s.", ss.streamKey)
+		}
+		if status, err := buildStatusReply(cfg.StatusTxnMode, msg, ss.streamKey, code, desc); err == nil {
+			_ = c.SendMessage(status)
+		}
+		log.Info("play pause", "conn_id", c.ID(), "stream_key", ss.streamKey, "paused", pc.Pause)
+		return nil
+	}
+
+	// seek handler: only recordings can be repositioned. A seek after the
+	// recording has finished restarts playback from the requested offset.
+	d.OnSeek = func(sc *rpc.SeekCommand, msg *chunk.Message) error {
+		ss := st.streams[msg.MessageStreamID]
+		if ss == nil || ss.role != iconn.RoleSubscriber {
+			log.Debug("seek ignored: not playing", "conn_id", c.ID(), "stream_id", msg.MessageStreamID)
+			return nil
+		}
+		if ss.vod == nil {
+			return rtmperrors.NewCommandError("seek", rpc.CodeSeekFailed, "Seeking is not supported on live streams.", nil)
+		}
+		if !ss.vod.Finished() {
+			ss.vod.Seek(uint32(sc.Milliseconds))
+			return nil
+		}
+		session := newVODSession(ss.vod.path, c, ss.vod.streamID, uint32(sc.Milliseconds), log)
+		if err := session.Start(ss.streamKey); err != nil {
+			return fmt.Errorf("restart VOD playback of %s: %w", ss.streamKey, err)
+		}
+		ss.vod = session
 		return nil
 	}
 
+	// getStreamLength handler: live streams have no length; a recording
+	// reports the duration from its onMetaData.
+	d.OnGetStreamLength = func(gc *rpc.GetStreamLengthCommand, msg *chunk.Message) (float64, error) {
+		if hasLivePublisher(reg, gc.StreamKey) {
+			return 0, nil
+		}
+		return recordingDuration(findRecording(cfg.RecordDir, gc.StreamKey)), nil
+	}
+
+	// Trace the commands that set up a stream (no-ops when not tracing).
+	d.OnConnect = traceCommand(st, "connect", d.OnConnect)
+	d.OnCreateStream = traceCommand(st, "createStream", d.OnCreateStream)
+	d.OnPublish = traceCommand(st, "publish", d.OnPublish)
+	d.OnPlay = traceCommand(st, "play", d.OnPlay)
+
 	c.SetMessageHandler(func(m *chunk.Message) {
 		if m == nil {
 			return
 		}
+		if st.inspect != nil {
+			st.inspect.message(m)
+			if m.TypeID == 8 || m.TypeID == 9 || m.TypeID == 18 {
+				return // inspect mode discards media
+			}
+		}
 
 		// Route audio/video messages to media dispatch (recording + relay + broadcast).
 		if m.TypeID == 8 || m.TypeID == 9 {
-			dispatchMedia(m, st, reg, destMgr, log)
+			if cfg.LatencyStats {
+				m.Ingest = time.Now()
+			}
+			st.mediaLogger.ProcessMessage(m)
+			if ss := st.mediaStream(m.MessageStreamID); ss != nil {
+				if codec, ok := ss.checkCodec(sessionApp(st.sess), m); !ok {
+					log.Warn("codec not allowed, disconnecting publisher", "stream_key", ss.streamKey, "app", st.sess.App(), "codec", codec)
+					if status, err := rpc.BuildOnStatus(ss.id, rpc.Status{
+						Level:       rpc.LevelError,
+						Code:        rpc.CodePublishFailed,
+						Description: fmt.Sprintf("Codec %s is not allowed in application %s.", codec, st.sess.App()),
+						Details:     ss.streamKey,
+					}); err == nil {
+						_ = c.SendMessage(status)
+					}
+					_ = c.Shutdown()
+					return
+				}
+				dispatchMedia(m, ss, reg, destMgr, cfg.Tracer, log)
+			}
 			return
 		}
 
-		if m.TypeID != rpc.CommandMessageAMF0TypeIDForTest() {
+		// Publisher metadata (@setDataFrame onMetaData) is kept on the
+		// stream for recordings; other data messages go to the players,
+		// and cue points and onFI timecodes are reported to hooks. All are
+		// relayed, where push profiles may rewrite onMetaData per
+		// destination.
+		if m.TypeID == 18 {
+			if ss := st.mediaStream(m.MessageStreamID); ss != nil {
+				if props, ok := media.ParseOnMetaData(m.Payload); ok {
+					if enc, _ := props["encoder"].(string); enc != "" {
+						st.sess.SetEncoder(enc)
+					}
+				}
+				stream := reg.GetStream(ss.streamKey)
+				if out := stream.publishData(m, log); out != nil {
+					srv.reportCuePoint(st.vhost, c.ID(), ss.streamKey, out)
+					srv.reportTimecode(st.vhost, c.ID(), ss.streamKey, stream, out)
+					if destMgr != nil {
+						destMgr.RelayStreamMessage(ss.streamKey, out)
+					}
+				}
+			}
+			return
+		}
+
+		if !rpc.IsCommandMessage(m.TypeID) {
 			return
 		}
 		if err := d.Dispatch(m); err != nil {
-			log.Error("dispatch error", "error", err)
+			logCommandError(log, m, err)
 		}
 	})
 }
 
+// logCommandError logs a command failure that the dispatcher has answered,
+// at a level matching its class: refusals are routine, malformed commands
+// cost the client its connection, anything else is a server-side failure.
+func logCommandError(log *slog.Logger, m *chunk.Message, err error) {
+	var ce *rtmperrors.CommandError
+	switch {
+	case rpc.IsFatal(err):
+		log.Warn("command failed, closing connection", "stream_id", m.MessageStreamID, "error", err)
+	case errors.As(err, &ce):
+		log.Warn(ce.Op+" rejected", "stream_id", m.MessageStreamID, "code", ce.Code, "error", err)
+	default:
+		log.Error("command failed", "stream_id", m.MessageStreamID, "error", err)
+	}
+}
+
 // authenticateRequest validates an auth token for a publish or play request.
-// Returns true if the request was rejected (caller should return nil).
-// Returns false if auth passed or no auth is configured (caller should proceed).
+// Plays are checked by cfg.PlayAuthValidator when it is set. It returns nil
+// if auth passed or no auth is configured, and otherwise a CommandError
+// that has the dispatcher send the Unauthorized status and close the
+// connection. A play token that already holds all its sessions gets
+// NetStream.Play.Failed instead and keeps the connection.
+//
+// When the validator counts sessions (auth.SessionValidator), the returned
+// release frees the play's session and must be called when the play ends;
+// otherwise it is nil.
 func authenticateRequest(
 	cfg *Config,
 	c *iconn.Connection,
 	st *commandState,
-	msg *chunk.Message,
 	action string, // "publish" or "play"
 	streamName string,
 	streamKey string,
 	queryParams map[string]string,
 	log *slog.Logger,
 	srv *Server,
-) bool {
-	if cfg.AuthValidator == nil {
-		return false // no auth configured — allow
-	}
-
+) (release func(), err error) {
 	authReq := &auth.Request{
-		App:           st.app,
+		App:           st.sess.App(),
 		StreamName:    streamName,
 		StreamKey:     streamKey,
 		QueryParams:   queryParams,
-		ConnectParams: st.connectParams,
+		ConnectParams: st.sess.Info().Params,
 		RemoteAddr:    c.NetConn().RemoteAddr().String(),
 	}
+	if st.clientCert != nil {
+		authReq.ClientCert = st.clientCert.CommonName
+	}
 
-	var err error
-	if action == "publish" {
-		err = cfg.AuthValidator.ValidatePublish(context.Background(), authReq)
-	} else {
-		err = cfg.AuthValidator.ValidatePlay(context.Background(), authReq)
+	validator := cfg.AuthValidator
+	if action == "play" && cfg.PlayAuthValidator != nil {
+		validator = cfg.PlayAuthValidator
+	}
+	switch {
+	case st.clientCert != nil && !cfg.TLSClientACL.Allows(st.clientCert, streamKey):
+		err = errClientCertDenied
+	case validator == nil:
+		return nil, nil // no auth configured — allow
+	case !sessionApp(st.sess).authenticates(action):
+		return nil, nil // the app leaves this action open
+	case action == "publish":
+		err = validator.ValidatePublish(context.Background(), authReq)
+	default:
+		if sv, ok := validator.(auth.SessionValidator); ok {
+			release, err = sv.AcquirePlay(context.Background(), authReq)
+		} else {
+			err = validator.ValidatePlay(context.Background(), authReq)
+		}
 	}
 
 	if err == nil {
 		log.Info(action+" authenticated", "stream_key", streamKey)
 		metrics.AuthSuccessesTotal.Add(1)
-		return false // auth passed
+		return release, nil // auth passed
 	}
 
-	// Auth failed — send error, emit hook, close connection.
+	// Auth failed — emit hook; the dispatcher sends the error and closes
+	// the connection.
 	metrics.AuthFailuresTotal.Add(1)
 	log.Warn(action+" authentication failed",
 		"stream_key", streamKey,
 		"remote_addr", authReq.RemoteAddr,
+		"client_cn", authReq.ClientCert,
 		"error", err)
 
-	statusCode := "NetStream." + strings.ToUpper(action[:1]) + action[1:] + ".Unauthorized"
-	errStatus, _ := buildOnStatus(msg.MessageStreamID, streamKey, statusCode, "Authentication failed.")
-	_ = c.SendMessage(errStatus)
-
-	srv.triggerHookEvent(hooks.EventAuthFailed, c.ID(), streamKey, map[string]interface{}{
+	srv.triggerHookEvent(hooks.EventAuthFailed, c.ID(), streamKey, st.hookData(map[string]interface{}{
 		"action": action,
 		"error":  err.Error(),
-	})
+	}))
 
-	_ = c.Close()
-	return true // rejected
+	if errors.Is(err, auth.ErrSessionLimit) {
+		return nil, rtmperrors.NewCommandError(action, rpc.CodePlayFailed, "Too many sessions for this token.", err)
+	}
+	return nil, &rtmperrors.CommandError{
+		Op:          action,
+		Code:        "NetStream." + strings.ToUpper(action[:1]) + action[1:] + ".Unauthorized",
+		Description: "Authentication failed.",
+		Close:       true,
+		Err:         err,
+	}
+}
+
+// hasLivePublisher reports whether streamKey currently has an active publisher.
+func hasLivePublisher(reg *Registry, streamKey string) bool {
+	return reg.GetStream(streamKey).State() == StreamPublishing
+}
+
+// startVODPlayback looks for a recording matching the play request and, if
+// found, starts streaming it to the connection. Returns true when playback
+// started (the caller must not fall through to live play handling).
+func startVODPlayback(cfg *Config, c *iconn.Connection, st *commandState, pl *rpc.PlayCommand, msg *chunk.Message, log *slog.Logger) bool {
+	offsetMs, ok := vodStartOffset(pl.Start)
+	if !ok {
+		return false
+	}
+	path := findRecording(cfg.RecordDir, pl.StreamKey)
+	if path == "" {
+		return false
+	}
+	session := newVODSession(path, c, msg.MessageStreamID, offsetMs, log)
+	session.playTxn = rpc.StatusTransactionID(cfg.StatusTxnMode, msg)
+	if err := session.Start(pl.StreamKey); err != nil {
+		log.Error("VOD playback failed to start", "stream_key", pl.StreamKey, "file", path, "error", err)
+		return false
+	}
+	st.streams[msg.MessageStreamID] = &streamState{
+		id:        msg.MessageStreamID,
+		streamKey: pl.StreamKey,
+		role:      iconn.RoleSubscriber,
+		vod:       session,
+	}
+	_ = st.sess.Play(msg.MessageStreamID, pl.StreamKey)
+	log.Info("VOD playback started", "stream_key", pl.StreamKey, "file", path, "start_ms", offsetMs)
+	return true
+}
+
+// startDVRPlayback plays the stream offset behind live from its DVR buffer
+// and returns the session, or nil when the stream has no buffered media
+// (the caller then plays it live).
+func startDVRPlayback(reg *Registry, c *iconn.Connection, st *commandState, pl *rpc.PlayCommand, msg *chunk.Message, offset time.Duration, log *slog.Logger) *dvrSession {
+	stream := reg.GetStream(pl.StreamKey)
+	if stream == nil || stream.dvr == nil {
+		return nil
+	}
+	session := newDVRSession(stream, c, msg.MessageStreamID, offset, log)
+	session.playTxn = rpc.StatusTransactionID(reg.statusTxnMode(), msg)
+	filter, _ := ParseMediaFilter(pl.QueryParams["media"]) // checked by OnPlay
+	stream.SetSubscriberMedia(c, filter)
+	if err := stream.addStreamSubscriberLimit(c, msg.MessageStreamID, reg.subscriberLimit(st.sess.App()), true); err != nil {
+		stream.RemoveSubscriber(c) // the live play path refuses it or looks the key up again
+		return nil
+	}
+	if !session.Start() {
+		stream.RemoveSubscriber(c)
+		return nil
+	}
+	st.streams[msg.MessageStreamID] = &streamState{
+		id:        msg.MessageStreamID,
+		streamKey: pl.StreamKey,
+		role:      iconn.RoleSubscriber,
+		dvr:       session,
+	}
+	_ = st.sess.Play(msg.MessageStreamID, pl.StreamKey)
+	log.Info("DVR playback started", "stream_key", pl.StreamKey, "offset_ms", offset.Milliseconds())
+	return session
 }
 
 // ensureRecorder lazily creates a recorder for the given stream once the video
@@ -494,6 +1097,9 @@ func authenticateRequest(
 //
 // This deferred approach ensures H.265 streams get MP4 containers (not FLV),
 // because the codec is only known after the first video frame is parsed.
+// With stream.RecordAppend set, a single-file FLV recording continues the
+// stream's latest recording (recordingPaths.latest) instead of starting a
+// new file.
 func ensureRecorder(stream *Stream, log *slog.Logger) {
 	if stream == nil {
 		return
@@ -516,6 +1122,10 @@ func ensureRecorder(stream *Stream, log *slog.Logger) {
 	audioCodec := stream.AudioCodec
 	segmentDuration := stream.SegmentDuration // extract segment config under same lock
 	segmentPattern := stream.SegmentPattern   // extract segment config under same lock
+	recordFormat := stream.RecordFormat
+	queueSize := stream.RecordQueueSize
+	onClosed := stream.RecordingClosed
+	appendTo := stream.RecordAppend
 
 	// Snapshot sequence headers for metadata extraction (under lock)
 	var videoSeqPayload, audioSeqPayload []byte
@@ -525,6 +1135,7 @@ func ensureRecorder(stream *Stream, log *slog.Logger) {
 	if stream.AudioSequenceHeader != nil {
 		audioSeqPayload = stream.AudioSequenceHeader.Payload
 	}
+	publisherMeta := stream.Metadata
 	stream.mu.Unlock()
 
 	// File creation happens outside the lock to avoid blocking media dispatch
@@ -540,6 +1151,7 @@ func ensureRecorder(stream *Stream, log *slog.Logger) {
 	meta := media.FLVMetadata{
 		VideoCodecID: media.VideoCodecFLVID(codec),
 		AudioCodecID: media.AudioCodecFLVID(audioCodec),
+		Extra:        publisherMeta,
 	}
 	if len(videoSeqPayload) > 0 {
 		meta.Width, meta.Height = media.ExtractVideoMetadata(videoSeqPayload)
@@ -557,8 +1169,9 @@ func ensureRecorder(stream *Stream, log *slog.Logger) {
 	// playable because sequence headers are re-injected at the start of each file.
 	if segmentDuration > 0 {
 		// Determine the container format and file extension from the video codec.
-		// H.264 → FLV, H.265+ → MP4 (same logic as single-file recording).
-		format := media.SelectContainerFormat(codec)
+		// H.264 → FLV, H.265+ → MP4 unless RecordFormat forces one (same
+		// logic as single-file recording).
+		format := media.ContainerFormat(codec, recordFormat)
 		extension := "." + format
 
 		// Create the segment namer from the user's pattern. The namer expands
@@ -582,9 +1195,11 @@ func ensureRecorder(stream *Stream, log *slog.Logger) {
 		// because RTMP timestamps are in milliseconds.
 		segDurMs := uint32(segmentDuration.Milliseconds())
 		recorder := media.NewSegmentedRecorder(segDurMs, codec, nameFn, log, meta)
+		recorder.OnSegmentClosed = onClosed
+		recorder.Format = format
 
 		stream.mu.Lock()
-		stream.Recorder = recorder
+		stream.Recorder = media.NewAsyncWriter(recorder, queueSize, log)
 		stream.mu.Unlock()
 		metrics.RecordingsActive.Add(1)
 
@@ -600,11 +1215,32 @@ func ensureRecorder(stream *Stream, log *slog.Logger) {
 	// Generate filename with the correct extension based on detected codec
 	safeKey := strings.ReplaceAll(stream.Key, "/", "_")
 	timestamp := time.Now().Format("20060102_150405")
-	format := media.SelectContainerFormat(codec)
+	format := media.ContainerFormat(codec, recordFormat)
 	filename := fmt.Sprintf("%s_%s.%s", safeKey, timestamp, format)
 	fpath := filepath.Join(recordDir, filename)
 
-	recorder, err := media.NewRecorder(fpath, codec, log, meta)
+	// Publish type "append" continues the latest FLV recording, if any;
+	// MP4 files are finalized on close and cannot be extended.
+	var recorder media.MediaWriter
+	var err error
+	latest := ""
+	if appendTo && format == "flv" {
+		latest = stream.recordings.latest(stream.Key, recordDir)
+	} else if appendTo {
+		log.Warn("cannot append to an MP4 recording, starting a new file", "stream_key", stream.Key, "codec", codec)
+	}
+	if latest != "" {
+		fpath = latest
+		var flv *media.FLVRecorder
+		if flv, err = media.AppendFLVRecorder(fpath, log, meta); err == nil {
+			recorder = flv
+		}
+	} else {
+		recorder, err = media.NewRecorderFormat(fpath, codec, format, log, meta)
+	}
+	if err == nil && format == "flv" {
+		stream.recordings.set(stream.Key, fpath)
+	}
 	if err != nil {
 		metrics.RecordingErrorsTotal.Add(1)
 		log.Error("failed to create recorder", "error", err, "stream_key", stream.Key)
@@ -614,11 +1250,17 @@ func ensureRecorder(stream *Stream, log *slog.Logger) {
 		return
 	}
 
+	if onClosed != nil {
+		recorder = &closeNotifier{MediaWriter: recorder, path: fpath, onClosed: onClosed}
+	}
+
+	// Writes go through a bounded queue so a slow disk cannot stall the
+	// publisher's read loop.
 	stream.mu.Lock()
-	stream.Recorder = recorder
+	stream.Recorder = media.NewAsyncWriter(recorder, queueSize, log)
 	stream.mu.Unlock()
 	metrics.RecordingsActive.Add(1)
 
 	log.Info("recorder initialized", "stream_key", stream.Key, "file", fpath, "codec", codec, "format", format,
-		"width", meta.Width, "height", meta.Height)
+		"width", meta.Width, "height", meta.Height, "append", latest != "")
 }
@@ -0,0 +1,110 @@
+// command_integration_test.go – tests for how command failures reach the
+// client: refusals (including invalid stream keys) are answered and the
+// connection kept, authentication failures and malformed commands are
+// answered and the connection closed.
+package server
+
+import (
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/logger"
+	"github.com/alxayo/go-rtmp/internal/rtmp/client"
+	"github.com/alxayo/go-rtmp/internal/rtmp/server/auth"
+)
+
+// connectTo connects a client for key without starting to publish or play.
+func connectTo(t *testing.T, s *Server, key string) *client.Client {
+	t.Helper()
+	c, err := client.New(fmt.Sprintf("rtmp://%s/%s", s.Addr(), key))
+	if err != nil {
+		t.Fatalf("client.New: %v", err)
+	}
+	if err := c.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// open reports whether the connection is still open after d.
+func (p *edgePlayer) open(d time.Duration) bool {
+	timeout := time.After(d)
+	for {
+		select {
+		case _, ok := <-p.msgs:
+			if !ok {
+				return false
+			}
+		case <-timeout:
+			return true
+		}
+	}
+}
+
+func TestCommandFailures(t *testing.T) {
+	logger.UseWriter(io.Discard)
+	s := New(Config{
+		ListenAddr:    "127.0.0.1:0",
+		StreamAliases: []StreamAlias{{Key: "live/show", Sources: []string{"live/main"}}},
+		AuthValidator: &auth.TokenValidator{Tokens: map[string]string{"live/secret": "letmein"}},
+	})
+	if err := s.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer s.Stop()
+
+	t.Run("refused publish keeps the connection", func(t *testing.T) {
+		c := connectTo(t, s, "live/show")
+		if err := c.Publish(); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+		p := watchMessages(c)
+		p.waitStatus(t, "NetStream.Publish.BadName")
+		if !p.open(200 * time.Millisecond) {
+			t.Fatalf("connection closed after a refused publish")
+		}
+	})
+
+	t.Run("invalid stream key is refused", func(t *testing.T) {
+		c := connectTo(t, s, "live/../etc")
+		if err := c.Publish(); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+		p := watchMessages(c)
+		p.waitStatus(t, "NetStream.Publish.BadName")
+		if !p.open(200 * time.Millisecond) {
+			t.Fatalf("connection closed after an invalid stream key")
+		}
+		if s.reg.GetStream("live/../etc") != nil {
+			t.Fatalf("stream registered under an invalid key")
+		}
+	})
+
+	t.Run("failed authentication closes the connection", func(t *testing.T) {
+		c := connectTo(t, s, "live/secret")
+		if err := c.Play(); err != nil {
+			t.Fatalf("play: %v", err)
+		}
+		p := watchMessages(c)
+		p.waitStatus(t, "NetStream.Play.Unauthorized")
+		if p.open(3 * time.Second) {
+			t.Fatalf("connection still open after failed authentication")
+		}
+	})
+
+	t.Run("malformed publish closes the connection", func(t *testing.T) {
+		c := connectTo(t, s, "live/other")
+		c.PublishingType = "broadcast"
+		if err := c.Publish(); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+		p := watchMessages(c)
+		p.waitStatus(t, "NetStream.Publish.BadName")
+		if p.open(3 * time.Second) {
+			t.Fatalf("connection still open after a malformed publish")
+		}
+	})
+}
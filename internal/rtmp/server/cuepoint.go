@@ -0,0 +1,31 @@
+package server
+
+// Cue Points
+// ----------
+// Encoders and playout systems signal ad breaks and other splice points
+// (SCTE-35) in-band with AMF data messages such as onCuePoint and
+// onAdMarker. The server passes them through like any other data message
+// (players get them, recordings keep them) and fires a cue_point hook
+// event so ad-insertion systems can react without parsing the stream.
+
+import (
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/media"
+	"github.com/alxayo/go-rtmp/internal/rtmp/server/hooks"
+)
+
+// reportCuePoint fires the cue_point event if m, a data message published
+// by connID on streamKey of virtual host vh (nil for the default host), is
+// a cue point or ad marker.
+func (s *Server) reportCuePoint(vh *vhost, connID, streamKey string, m *chunk.Message) {
+	name, cue, ok := media.ParseCuePoint(m.Payload)
+	if !ok {
+		return
+	}
+	s.log.Info("cue point", "stream_key", streamKey, "conn_id", connID, "name", name, "timestamp", m.Timestamp)
+	s.triggerHookEvent(hooks.EventCuePoint, connID, streamKey, vh.hookData(map[string]interface{}{
+		"name":      name,
+		"timestamp": m.Timestamp,
+		"cue":       cue,
+	}))
+}
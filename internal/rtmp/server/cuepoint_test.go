@@ -0,0 +1,76 @@
+// cuepoint_test.go – tests for cue point passthrough and the cue_point event.
+package server
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/logger"
+	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
+	"github.com/alxayo/go-rtmp/internal/rtmp/server/hooks"
+)
+
+// TestCuePointPassthrough publishes an onCuePoint and verifies players get
+// it and a cue_point event carries its payload, while other data messages
+// fire no event.
+func TestCuePointPassthrough(t *testing.T) {
+	logger.UseWriter(io.Discard)
+	s := New(Config{ListenAddr: "127.0.0.1:0"})
+	if err := s.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer s.Stop()
+	events, cancel := s.Subscribe(4, hooks.EventCuePoint)
+	defer cancel()
+
+	pub := connectTo(t, s, "live/ads")
+	if err := pub.Publish(); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	waitFor(t, "publish", func() bool { return hasLivePublisher(s.reg, "live/ads") })
+	player := playOn(t, s, "live/ads")
+	defer player.c.Close()
+	player.waitStatus(t, "NetStream.Play.Start")
+
+	text, _ := amf.EncodeAll("onTextData", map[string]interface{}{"text": "hello"})
+	cue, _ := amf.EncodeAll("onCuePoint", map[string]interface{}{
+		"name": "scte35", "type": "event", "time": 30.0,
+		"parameters": map[string]interface{}{"duration": 30.0},
+	})
+	_ = pub.SendData(1000, text)
+	_ = pub.SendData(2000, cue)
+
+	timeout := time.After(3 * time.Second)
+	for got := false; !got; {
+		select {
+		case m, ok := <-player.msgs:
+			if !ok {
+				t.Fatal("player connection closed")
+			}
+			got = m.TypeID == 18 && bytes.Equal(m.Payload, cue)
+		case <-timeout:
+			t.Fatal("timed out waiting for the cue point")
+		}
+	}
+
+	select {
+	case ev := <-events:
+		props, _ := ev.Data["cue"].(map[string]interface{})
+		if ev.StreamKey != "live/ads" || ev.Data["name"] != "onCuePoint" || ev.Data["timestamp"] != uint32(2000) || props["name"] != "scte35" {
+			t.Fatalf("event = %+v", ev)
+		}
+		params, _ := props["parameters"].(map[string]interface{})
+		if params["duration"] != 30.0 {
+			t.Fatalf("cue parameters = %v", props["parameters"])
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no cue_point event")
+	}
+	select {
+	case ev := <-events:
+		t.Fatalf("unexpected event %+v", ev)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,316 @@
+package server
+
+// Subscriber Drop Tracking
+// ------------------------
+// BroadcastMessage never blocks on a subscriber for long: when a
+// subscriber's outbound queue is full the media message is dropped for that
+// subscriber only. Each drop is counted per subscriber and per stream, split
+// into audio and video, and reported in the stream snapshot (/debug/vars)
+// and in the play_stop hook event.
+//
+// Dropping is keyframe aware. Once a video frame is lost the frames that
+// depend on it cannot be decoded, so the subscriber sheds the rest of the
+// GOP: every video frame up to the next keyframe is dropped without trying
+// to queue it, which also gives the queue time to drain. Audio and sequence
+// headers are never shed, and a sequence header that was lost anyway is
+// sent again ahead of the next frame that needs it.
+//
+// With Config.SlowSubscriberDropRate set, a subscriber that drops more than
+// that fraction of its media for Config.SlowSubscriberWindow is
+// disconnected: it cannot keep up, and its player would only stutter.
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/media"
+	"github.com/alxayo/go-rtmp/internal/rtmp/server/hooks"
+)
+
+// DefaultSlowSubscriberWindow is how long a subscriber's drop rate must stay
+// above Config.SlowSubscriberDropRate before it is disconnected.
+const DefaultSlowSubscriberWindow = 10 * time.Second
+
+// slowSubscriberInterval is how often drop rates are evaluated.
+const slowSubscriberInterval = time.Second
+
+// minRateSamples is the fewest media messages an interval needs before its
+// drop rate counts; quieter intervals leave the subscriber's state as is.
+const minRateSamples = 10
+
+// DropStats counts the media messages offered to one subscriber.
+type DropStats struct {
+	Delivered  uint64 `json:"delivered"`   // messages queued for the subscriber
+	AudioDrops uint64 `json:"audio_drops"` // audio messages dropped
+	VideoDrops uint64 `json:"video_drops"` // video messages dropped
+}
+
+// Drops returns all dropped messages.
+func (d DropStats) Drops() uint64 { return d.AudioDrops + d.VideoDrops }
+
+// SubscriberDropInfo is one subscriber's entry in StreamInfo.
+type SubscriberDropInfo struct {
+	ConnID string `json:"conn_id"`
+	DropStats
+}
+
+// dropCounter holds one subscriber's counts. The counters are atomic so
+// BroadcastMessage can update them without the stream lock.
+type dropCounter struct {
+	delivered atomic.Uint64
+	audio     atomic.Uint64
+	video     atomic.Uint64
+
+	// Keyframe-aware shedding (see shed and lost).
+	shedding        atomic.Bool // dropping video until the next keyframe
+	videoHeaderLost atomic.Bool // resend the video sequence header before the next keyframe
+	audioHeaderLost atomic.Bool // resend the audio sequence header before the next audio frame
+
+	// Rate tracking, used only by the slow-subscriber check.
+	lastDelivered uint64
+	lastDrops     uint64
+	overSince     time.Time // zero while under the limit
+}
+
+func (c *dropCounter) stats() DropStats {
+	return DropStats{Delivered: c.delivered.Load(), AudioDrops: c.audio.Load(), VideoDrops: c.video.Load()}
+}
+
+// recordDelivery counts msg type typeID as delivered or dropped for the
+// subscriber owning c (nil if it was not added with AddSubscriber).
+func (s *Stream) recordDelivery(c *dropCounter, typeID uint8, delivered bool) {
+	if delivered {
+		if c != nil {
+			c.delivered.Add(1)
+		}
+		return
+	}
+	switch typeID {
+	case 8:
+		s.audioDrops.Add(1)
+		if c != nil {
+			c.audio.Add(1)
+		}
+	case 9:
+		s.videoDrops.Add(1)
+		if c != nil {
+			c.video.Add(1)
+		}
+	}
+}
+
+// isVideoFrame reports whether msg is a video frame other than a sequence
+// header: the only kind of message that is shed.
+func isVideoFrame(msg *chunk.Message) bool {
+	return msg.TypeID == 9 && !media.IsVideoSequenceHeader(msg.Payload)
+}
+
+// shed reports whether msg should be dropped for the subscriber owning c
+// without trying to send it, because an earlier frame of its GOP was lost.
+// A keyframe ends the shedding.
+func (c *dropCounter) shed(msg *chunk.Message) bool {
+	if c == nil || !c.shedding.Load() || !isVideoFrame(msg) {
+		return false
+	}
+	if media.IsVideoKeyframe(msg.Payload) {
+		c.shedding.Store(false)
+		return false
+	}
+	return true
+}
+
+// lost records that msg could not be queued for the subscriber owning c.
+func (c *dropCounter) lost(msg *chunk.Message) {
+	if c == nil {
+		return
+	}
+	switch {
+	case msg.TypeID == 9:
+		if !isVideoFrame(msg) {
+			c.videoHeaderLost.Store(true)
+		}
+		c.shedding.Store(true)
+	case msg.TypeID == 8 && media.IsAudioSequenceHeader(msg.Payload):
+		c.audioHeaderLost.Store(true)
+	}
+}
+
+// pendingHeader returns the cached sequence header (video or audio, from
+// the stream) to send ahead of msg because the subscriber owning c lost it,
+// or nil. The caller calls lost again if sending it fails.
+func (c *dropCounter) pendingHeader(msg, video, audio *chunk.Message) *chunk.Message {
+	if c == nil {
+		return nil
+	}
+	switch msg.TypeID {
+	case 9:
+		if !c.videoHeaderLost.Load() {
+			return nil
+		}
+		if !isVideoFrame(msg) {
+			c.videoHeaderLost.Store(false) // msg is the new header
+			return nil
+		}
+		if !media.IsVideoKeyframe(msg.Payload) {
+			return nil
+		}
+		c.videoHeaderLost.Store(false)
+		return video
+	case 8:
+		if !c.audioHeaderLost.Load() {
+			return nil
+		}
+		c.audioHeaderLost.Store(false)
+		if media.IsAudioSequenceHeader(msg.Payload) {
+			return nil
+		}
+		return audio
+	}
+	return nil
+}
+
+// SubscriberDrops returns the delivery counts of sub, or false if it is not
+// subscribed.
+func (s *Stream) SubscriberDrops(sub media.Subscriber) (DropStats, bool) {
+	if s == nil {
+		return DropStats{}, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, ok := s.dropCounters[sub]
+	if !ok {
+		return DropStats{}, false
+	}
+	return c.stats(), true
+}
+
+// Drops returns the audio and video messages dropped for all subscribers
+// of the stream so far, including ones that have left.
+func (s *Stream) Drops() (audio, video uint64) {
+	if s == nil {
+		return 0, 0
+	}
+	return s.audioDrops.Load(), s.videoDrops.Load()
+}
+
+// subscriberDropsLocked lists the subscribers that dropped media, by
+// connection ID. Callers hold s.mu.
+func (s *Stream) subscriberDropsLocked() []SubscriberDropInfo {
+	var out []SubscriberDropInfo
+	for sub, c := range s.dropCounters {
+		st := c.stats()
+		if st.Drops() == 0 {
+			continue
+		}
+		id, ok := sub.(interface{ ID() string })
+		if !ok {
+			continue
+		}
+		out = append(out, SubscriberDropInfo{ConnID: id.ID(), DropStats: st})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ConnID < out[j].ConnID })
+	return out
+}
+
+// slowSubscriber is a subscriber found over the drop rate limit.
+type slowSubscriber struct {
+	sub   media.Subscriber
+	stats DropStats // totals so far
+	rate  float64   // drop rate over the last interval
+}
+
+// slowSubscribers updates each subscriber's drop rate over the last
+// interval and returns those that stayed above limit for window. Only the
+// slow-subscriber check calls it, so the rate fields need no lock of their
+// own.
+func (s *Stream) slowSubscribers(now time.Time, limit float64, window time.Duration) []slowSubscriber {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var slow []slowSubscriber
+	for sub, c := range s.dropCounters {
+		st := c.stats()
+		delivered, drops := st.Delivered-c.lastDelivered, st.Drops()-c.lastDrops
+		if delivered+drops < minRateSamples {
+			continue
+		}
+		c.lastDelivered, c.lastDrops = st.Delivered, st.Drops()
+		rate := float64(drops) / float64(delivered+drops)
+		if rate <= limit {
+			c.overSince = time.Time{}
+			continue
+		}
+		if c.overSince.IsZero() {
+			c.overSince = now
+		}
+		if now.Sub(c.overSince) >= window {
+			slow = append(slow, slowSubscriber{sub: sub, stats: st, rate: rate})
+		}
+	}
+	return slow
+}
+
+// evictSlowSubscribers disconnects subscribers whose drop rate exceeds
+// Config.SlowSubscriberDropRate for Config.SlowSubscriberWindow, until done
+// is closed.
+func (s *Server) evictSlowSubscribers(done <-chan struct{}) {
+	t := time.NewTicker(slowSubscriberInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-t.C:
+			for _, stream := range s.streamList() {
+				for _, slow := range stream.slowSubscribers(now, s.cfg.SlowSubscriberDropRate, s.cfg.SlowSubscriberWindow) {
+					s.evictSlowSubscriber(stream, slow)
+				}
+			}
+		}
+	}
+}
+
+// evictSlowSubscriber disconnects a subscriber of stream that keeps
+// dropping media, and fires EventSubscriberEvicted.
+func (s *Server) evictSlowSubscriber(stream *Stream, slow slowSubscriber) {
+	c, ok := slow.sub.(interface {
+		ID() string
+		Close() error
+	})
+	if !ok {
+		return
+	}
+	st := slow.stats
+	s.log.Warn("disconnecting slow subscriber",
+		"conn_id", c.ID(), "stream_key", stream.Key, "drop_rate", slow.rate,
+		"audio_drops", st.AudioDrops, "video_drops", st.VideoDrops, "delivered", st.Delivered)
+	s.triggerHookEvent(hooks.EventSubscriberEvicted, c.ID(), stream.Key, vhostHookData(stream.vhost, map[string]interface{}{
+		"reason":      "slow_subscriber",
+		"drop_rate":   slow.rate,
+		"audio_drops": st.AudioDrops,
+		"video_drops": st.VideoDrops,
+		"delivered":   st.Delivered,
+	}))
+	_ = c.Close()
+}
+
+// streamList returns the streams of every host's registry.
+func (s *Server) streamList() []*Stream {
+	var out []*Stream
+	for _, reg := range s.registries() {
+		out = append(out, reg.streamList()...)
+	}
+	return out
+}
+
+// streamList returns the registry's streams.
+func (r *Registry) streamList() []*Stream {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]*Stream, 0, len(r.streams))
+	for _, s := range r.streams {
+		out = append(out, s)
+	}
+	return out
+}
@@ -0,0 +1,211 @@
+// drops_test.go – tests for per-subscriber drop counting and the
+// slow-subscriber eviction.
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/logger"
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/server/hooks"
+)
+
+// lossySubscriber accepts TrySendMessage only while its queue has room;
+// room is refilled by the test. Accepted messages are kept in got; Close
+// records the eviction.
+type lossySubscriber struct {
+	id     string
+	room   int
+	got    []*chunk.Message
+	closed bool
+}
+
+func (l *lossySubscriber) SendMessage(*chunk.Message) error { return nil }
+func (l *lossySubscriber) TrySendMessage(m *chunk.Message) bool {
+	if l.room == 0 {
+		return false
+	}
+	l.room--
+	l.got = append(l.got, m)
+	return true
+}
+func (l *lossySubscriber) ID() string   { return l.id }
+func (l *lossySubscriber) Close() error { l.closed = true; return nil }
+
+func TestSubscriberDropCounts(t *testing.T) {
+	s := &Stream{Key: "live/drops"}
+	slow := &lossySubscriber{id: "c000002", room: 1}
+	fast := &lossySubscriber{id: "c000001", room: 100}
+	s.AddSubscriber(slow)
+	s.AddSubscriber(fast)
+
+	audio := &chunk.Message{TypeID: 8, MessageStreamID: 1, Payload: []byte{0xAF, 0x01, 0x00}}
+	video := &chunk.Message{TypeID: 9, MessageStreamID: 1, Payload: []byte{0x27, 0x01, 0, 0, 0}}
+	s.BroadcastMessage(nil, video, logger.Logger()) // slow: delivered
+	s.BroadcastMessage(nil, video, logger.Logger()) // slow: dropped
+	s.BroadcastMessage(nil, audio, logger.Logger()) // slow: dropped
+
+	got, ok := s.SubscriberDrops(slow)
+	if want := (DropStats{Delivered: 1, AudioDrops: 1, VideoDrops: 1}); !ok || got != want {
+		t.Fatalf("slow subscriber drops = %+v, %v; want %+v", got, ok, want)
+	}
+	if got, _ := s.SubscriberDrops(fast); got.Drops() != 0 || got.Delivered != 3 {
+		t.Fatalf("fast subscriber drops = %+v, want 3 delivered", got)
+	}
+
+	r := NewRegistry()
+	r.streams[s.Key] = s
+	info := r.Snapshot()[0]
+	if info.AudioDrops != 1 || info.VideoDrops != 1 {
+		t.Fatalf("stream drops = %d audio, %d video; want 1, 1", info.AudioDrops, info.VideoDrops)
+	}
+	if len(info.SubscriberDrops) != 1 || info.SubscriberDrops[0].ConnID != "c000002" {
+		t.Fatalf("subscriber drops = %+v, want only c000002", info.SubscriberDrops)
+	}
+
+	// Stream totals outlive the subscriber.
+	s.RemoveSubscriber(slow)
+	if _, ok := s.SubscriberDrops(slow); ok {
+		t.Fatal("drop counts kept for a removed subscriber")
+	}
+	if a, v := s.Drops(); a != 1 || v != 1 {
+		t.Fatalf("stream drops after removal = %d, %d; want 1, 1", a, v)
+	}
+}
+
+func TestGOPShedding(t *testing.T) {
+	s := &Stream{Key: "live/gop"}
+	sub := &lossySubscriber{id: "c000003", room: 100}
+	s.AddSubscriber(sub)
+
+	msg := func(typeID uint8, payload ...byte) *chunk.Message {
+		return &chunk.Message{TypeID: typeID, MessageStreamID: 1, Payload: payload}
+	}
+	videoHeader := msg(9, 0x17, 0x00, 0, 0, 0, 0x01)
+	key := msg(9, 0x17, 0x01, 0, 0, 0)
+	inter := msg(9, 0x27, 0x01, 0, 0, 0)
+	audioHeader := msg(8, 0xAF, 0x00, 0x12, 0x10)
+	audio := msg(8, 0xAF, 0x01, 0x21)
+
+	send := func(room int, msgs ...*chunk.Message) {
+		sub.room = room
+		for _, m := range msgs {
+			s.BroadcastMessage(nil, m, logger.Logger())
+		}
+	}
+	send(100, videoHeader, audioHeader, key, inter)
+	send(0, inter)          // lost: the rest of the GOP goes
+	send(100, inter, audio) // shed; audio still delivered
+	send(0, audioHeader)    // lost header
+	send(100, audio, inter, key, inter)
+
+	got := sub.got
+	want := []*chunk.Message{videoHeader, audioHeader, key, inter, audio, audioHeader, audio, key, inter}
+	if len(got) != len(want) {
+		t.Fatalf("delivered %d messages, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if string(got[i].Payload) != string(want[i].Payload) {
+			t.Fatalf("message %d = % x, want % x", i, got[i].Payload, want[i].Payload)
+		}
+	}
+	if st, _ := s.SubscriberDrops(sub); st.VideoDrops != 3 || st.AudioDrops != 1 {
+		t.Fatalf("drops = %+v, want 3 video, 1 audio", st)
+	}
+
+	// A video sequence header lost while behind goes out again ahead of the
+	// keyframe that ends the shedding.
+	send(0, videoHeader)
+	send(100, inter, key)
+	tail := sub.got[len(sub.got)-2:]
+	if string(tail[0].Payload) != string(videoHeader.Payload) || string(tail[1].Payload) != string(key.Payload) {
+		t.Fatalf("after a lost video header got % x, % x; want header then keyframe", tail[0].Payload, tail[1].Payload)
+	}
+}
+
+func TestSlowSubscriberEviction(t *testing.T) {
+	srv := New(Config{ListenAddr: "127.0.0.1:0", SlowSubscriberDropRate: 0.5, SlowSubscriberWindow: 2 * time.Second})
+	events, cancel := srv.Subscribe(4, hooks.EventSubscriberEvicted)
+	defer cancel()
+	s, _ := srv.reg.CreateStream("live/slow")
+	slow := &lossySubscriber{id: "c000009"}
+	s.AddSubscriber(slow)
+	key := &chunk.Message{TypeID: 9, MessageStreamID: 1, Payload: []byte{0x17, 0x01, 0, 0, 0}}
+	video := &chunk.Message{TypeID: 9, MessageStreamID: 1, Payload: []byte{0x27, 0x01, 0, 0, 0}}
+
+	// Each interval: a 20-frame GOP, of which the subscriber takes room.
+	interval := func(room int) {
+		slow.room = room
+		s.BroadcastMessage(nil, key, logger.Logger())
+		for i := 1; i < 20; i++ {
+			s.BroadcastMessage(nil, video, logger.Logger())
+		}
+	}
+	start := time.Now()
+	check := func(at time.Duration) []slowSubscriber {
+		return s.slowSubscribers(start.Add(at), srv.cfg.SlowSubscriberDropRate, srv.cfg.SlowSubscriberWindow)
+	}
+
+	interval(2) // 90% dropped: over the limit from now on
+	if got := check(0); len(got) != 0 {
+		t.Fatal("evicted before the window elapsed")
+	}
+	interval(18) // 10% dropped: recovered, the window restarts
+	if got := check(time.Second); len(got) != 0 {
+		t.Fatal("evicted after recovering")
+	}
+	interval(0)
+	check(2 * time.Second)
+	interval(0)
+	if got := check(3 * time.Second); len(got) != 0 {
+		t.Fatal("evicted one second into the window")
+	}
+	interval(0)
+	got := check(4 * time.Second)
+	if len(got) != 1 || got[0].sub != slow || got[0].rate != 1 {
+		t.Fatalf("slowSubscribers = %+v, want the lossy subscriber at rate 1", got)
+	}
+
+	srv.evictSlowSubscriber(s, got[0])
+	if !slow.closed {
+		t.Fatal("slow subscriber not closed")
+	}
+	select {
+	case ev := <-events:
+		if ev.ConnID != "c000009" || ev.StreamKey != "live/slow" || ev.Data["reason"] != "slow_subscriber" {
+			t.Fatalf("event = %+v", ev)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no subscriber_evicted event")
+	}
+}
+
+// TestBroadcastSharesPayload verifies that subscribers get their own
+// message header over one shared payload, each holding a reference.
+func TestBroadcastSharesPayload(t *testing.T) {
+	s := &Stream{Key: "live/share"}
+	a := &lossySubscriber{id: "c000001", room: 1}
+	b := &lossySubscriber{id: "c000002", room: 1}
+	s.AddStreamSubscriber(a, 1)
+	s.AddStreamSubscriber(b, 3)
+
+	video := chunk.NewPooledMessage(5)
+	copy(video.Payload, []byte{0x27, 0x01, 0, 0, 0})
+	video.TypeID, video.MessageStreamID = 9, 1
+	s.BroadcastMessage(nil, video, logger.Logger())
+	video.Release() // the publisher's reference
+
+	ga, gb := a.got[0], b.got[0]
+	if ga == gb || ga.MessageStreamID != 1 || gb.MessageStreamID != 3 {
+		t.Fatalf("headers not per subscriber: %+v %+v", ga, gb)
+	}
+	if &ga.Payload[0] != &gb.Payload[0] {
+		t.Fatal("subscribers got payload copies instead of a shared payload")
+	}
+	ga.Release()
+	if gb.Payload[0] != 0x27 {
+		t.Fatal("payload changed while referenced")
+	}
+	gb.Release()
+}
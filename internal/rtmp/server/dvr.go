@@ -0,0 +1,451 @@
+package server
+
+// DVR Window
+// ----------
+// With Config.DVRWindow set, every stream keeps the media of its last
+// DVRWindow in memory (the DVR buffer). A play request whose start argument
+// is a negative offset in milliseconds, other than the -1000/-2000 (and
+// -1/-2) that mean "live" and "live or recorded", plays the stream that far
+// behind live: playback starts at the last keyframe at or before the
+// requested point and continues at real-time pace, so the player stays the
+// same distance behind. Offsets beyond the window start at its oldest
+// keyframe; a stream with nothing buffered yet is played live.
+//
+// Time-shifted players are subscribers of the stream (they count as
+// players, keep it registered and get play hooks) but their media comes
+// from their own dvrSession reading the buffer, not from BroadcastMessage.
+// Pausing one keeps its place; if that place falls out of the window it
+// resumes at the oldest keyframe. When the publisher leaves, the player
+// gets NetStream.Play.UnpublishNotify once it has played what was
+// buffered.
+//
+// The buffer is trimmed one GOP at a time, so it holds up to one GOP more
+// than DVRWindow. Memory use is roughly the stream's bitrate times that.
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/control"
+	"github.com/alxayo/go-rtmp/internal/rtmp/media"
+)
+
+// dvrBuffer is a stream's rolling window of recent media. Messages are
+// numbered in arrival order; seq numbers stay valid as the buffer is
+// trimmed. It is protected by Stream.mu.
+type dvrBuffer struct {
+	window time.Duration
+	msgs   []*chunk.Message // oldest first; starts at a keyframe once video is seen
+	first  uint64           // seq of msgs[0]
+	starts []uint64         // seqs of the buffered video keyframes, oldest first
+	bytes  int              // payload bytes buffered
+	video  bool             // the stream has sent a video keyframe
+
+	// changed is closed when a message is added; created on demand by
+	// wait so streams nobody time-shifts do not allocate one per message.
+	changed chan struct{}
+}
+
+// add appends a copy of m and trims what fell out of the window.
+func (b *dvrBuffer) add(m *chunk.Message) {
+	cp := *m
+	cp.Payload = make([]byte, len(m.Payload))
+	copy(cp.Payload, m.Payload)
+	if m.TypeID == 9 && media.IsVideoKeyframe(m.Payload) && !media.IsVideoSequenceHeader(m.Payload) {
+		if !b.video {
+			// Nothing before the first keyframe can start playback.
+			b.video = true
+			b.drop(len(b.msgs))
+		}
+		b.starts = append(b.starts, b.first+uint64(len(b.msgs)))
+	}
+	b.msgs = append(b.msgs, &cp)
+	b.bytes += len(cp.Payload)
+
+	oldest := int64(cp.Timestamp) - b.window.Milliseconds()
+	if b.video {
+		// Drop whole GOPs while the next one still covers the window.
+		for len(b.starts) > 1 && int64(b.msgs[b.starts[1]-b.first].Timestamp) <= oldest {
+			b.drop(int(b.starts[1] - b.first))
+		}
+	} else {
+		n := 0
+		for n < len(b.msgs)-1 && int64(b.msgs[n].Timestamp) < oldest {
+			n++
+		}
+		b.drop(n)
+	}
+
+	if b.changed != nil {
+		close(b.changed)
+		b.changed = nil
+	}
+}
+
+// drop removes the n oldest messages.
+func (b *dvrBuffer) drop(n int) {
+	if n <= 0 {
+		return
+	}
+	for _, m := range b.msgs[:n] {
+		b.bytes -= len(m.Payload)
+	}
+	clear(b.msgs[:n])
+	b.msgs = b.msgs[n:]
+	b.first += uint64(n)
+	for len(b.starts) > 0 && b.starts[0] < b.first {
+		b.starts = b.starts[1:]
+	}
+}
+
+// seek returns the seq to start playing offset behind the newest message:
+// the last keyframe at or before that point, or the oldest one. ok is false
+// when nothing is buffered.
+func (b *dvrBuffer) seek(offset time.Duration) (seq uint64, ok bool) {
+	if len(b.msgs) == 0 {
+		return 0, false
+	}
+	target := int64(b.msgs[len(b.msgs)-1].Timestamp) - offset.Milliseconds()
+	if !b.video {
+		for i, m := range b.msgs {
+			if int64(m.Timestamp) >= target {
+				return b.first + uint64(i), true
+			}
+		}
+		return b.first + uint64(len(b.msgs)-1), true
+	}
+	seq = b.starts[0]
+	for _, k := range b.starts[1:] {
+		if int64(b.msgs[k-b.first].Timestamp) > target {
+			break
+		}
+		seq = k
+	}
+	return seq, true
+}
+
+// get returns message seq. A seq that was trimmed away moves to the oldest
+// message (skipped reports it). A nil message means seq has not arrived.
+func (b *dvrBuffer) get(seq uint64) (m *chunk.Message, at uint64, skipped bool) {
+	if seq < b.first {
+		seq, skipped = b.first, true
+	}
+	if i := seq - b.first; i < uint64(len(b.msgs)) {
+		return b.msgs[i], seq, skipped
+	}
+	return nil, seq, skipped
+}
+
+// wait returns a channel closed when the next message is added.
+func (b *dvrBuffer) wait() <-chan struct{} {
+	if b.changed == nil {
+		b.changed = make(chan struct{})
+	}
+	return b.changed
+}
+
+// duration returns the time span buffered.
+func (b *dvrBuffer) duration() time.Duration {
+	if len(b.msgs) < 2 {
+		return 0
+	}
+	return time.Duration(int64(b.msgs[len(b.msgs)-1].Timestamp)-int64(b.msgs[0].Timestamp)) * time.Millisecond
+}
+
+// SetDVRWindow makes streams created after the call buffer their last
+// window of media for time-shifted playback. Zero disables the buffer.
+func (r *Registry) SetDVRWindow(window time.Duration) {
+	r.mu.Lock()
+	r.dvrWindow = window
+	r.mu.Unlock()
+}
+
+// bufferDVR adds a published media message to the stream's DVR buffer.
+func (s *Stream) bufferDVR(m *chunk.Message) {
+	if s.dvr == nil || (m.TypeID != 8 && m.TypeID != 9) {
+		return
+	}
+	s.mu.Lock()
+	s.dvr.add(m)
+	s.mu.Unlock()
+}
+
+// DVRBuffered returns the time span and payload bytes in the stream's DVR
+// buffer (zero without one).
+func (s *Stream) DVRBuffered() (time.Duration, int) {
+	if s == nil || s.dvr == nil {
+		return 0, 0
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.dvr.duration(), s.dvr.bytes
+}
+
+// AddDVRSubscriber adds sub like AddStreamSubscriber, for a player fed from
+// the DVR buffer by its own session: BroadcastMessage and EndPublish leave
+// it alone.
+func (s *Stream) AddDVRSubscriber(sub media.Subscriber, streamID uint32) {
+	_ = s.addStreamSubscriberLimit(sub, streamID, 0, true)
+}
+
+// dvrStartOffset interprets the play command's start argument (ms on the
+// wire, see vodStartOffset) as a time shift. ok is false for the values
+// that ask for live or recorded playback.
+func dvrStartOffset(start int64) (time.Duration, bool) {
+	switch start {
+	case -1, -2, -1000, -2000:
+		return 0, false
+	}
+	if start >= 0 {
+		return 0, false
+	}
+	return time.Duration(-start) * time.Millisecond, true
+}
+
+// dvrSession plays one stream's DVR buffer to one subscriber connection.
+type dvrSession struct {
+	stream   *Stream
+	conn     sender
+	streamID uint32 // message stream ID the subscriber issued play on
+	offset   time.Duration
+	playTxn  float64 // transaction ID of the Play.Start reply (Config.StatusTxnMode)
+	log      *slog.Logger
+
+	mu     sync.Mutex
+	paused bool
+	wake   chan struct{}
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// newDVRSession creates an unstarted session playing stream offset behind
+// live.
+func newDVRSession(stream *Stream, conn sender, streamID uint32, offset time.Duration, log *slog.Logger) *dvrSession {
+	return &dvrSession{
+		stream:   stream,
+		conn:     conn,
+		streamID: streamID,
+		offset:   offset,
+		log:      log,
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start finds the starting keyframe, sends the play preamble and cached
+// sequence headers, and launches the pacing goroutine. It returns false,
+// sending nothing, when the buffer is empty.
+func (d *dvrSession) Start() bool {
+	s := d.stream
+	s.mu.RLock()
+	seq, ok := s.dvr.seek(d.offset)
+	s.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	_ = d.conn.SendMessage(control.EncodeUserControlStreamBegin(d.streamID))
+	if m, err := buildOnStatusTxn(d.streamID, d.playTxn, s.Key, "NetStream.Play.Start", fmt.Sprintf("Started playing %s.", s.Key)); err == nil {
+		_ = d.conn.SendMessage(m)
+	}
+	sendSequenceHeaders(d.conn, s, d.streamID, s.Key)
+	go func() {
+		defer close(d.done)
+		d.run(seq)
+	}()
+	return true
+}
+
+// Stop ends playback and waits for the pacing goroutine to exit. Safe to
+// call multiple times.
+func (d *dvrSession) Stop() {
+	if d == nil {
+		return
+	}
+	d.stopOnce.Do(func() { close(d.stop) })
+	<-d.done
+}
+
+// Pause suspends (true) or resumes (false) delivery. The goroutine sends
+// the pause notifications, as for VOD.
+func (d *dvrSession) Pause(paused bool) {
+	d.mu.Lock()
+	d.paused = paused
+	d.mu.Unlock()
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run delivers the buffer from seq at real-time pace.
+func (d *dvrSession) run(seq uint64) {
+	s := d.stream
+	var (
+		baseTs      uint32
+		baseWall    time.Time
+		haveBase    bool
+		wasPaused   bool
+		unpublished bool
+		sent        int
+	)
+	// Tracks the player opted out of at play got no sequence header.
+	initial := s.SubscriberMedia(d.conn)
+	gate := trackGate{audioGap: initial.NoAudio, videoGap: initial.NoVideo}
+	defer func() {
+		d.log.Info("DVR playback stopped", "stream_key", s.Key, "messages_sent", sent)
+	}()
+	for {
+		select {
+		case <-d.stop:
+			return
+		default:
+		}
+
+		d.mu.Lock()
+		paused := d.paused
+		d.mu.Unlock()
+		if paused != wasPaused {
+			wasPaused = paused
+			if paused {
+				d.notify("NetStream.Pause.Notify", fmt.Sprintf("Pausing %s.", s.Key))
+			} else {
+				haveBase = false
+				_ = d.conn.SendMessage(control.EncodeUserControlStreamBegin(d.streamID))
+				d.notify("NetStream.Unpause.Notify", fmt.Sprintf("Unpausing %s.", s.Key))
+			}
+		}
+		if paused {
+			select {
+			case <-d.stop:
+				return
+			case <-d.wake:
+			}
+			continue
+		}
+
+		s.mu.Lock()
+		m, at, skipped := s.dvr.get(seq)
+		var more <-chan struct{}
+		if m == nil {
+			more = s.dvr.wait()
+		}
+		s.mu.Unlock()
+		if skipped {
+			d.log.Info("DVR playback fell out of the window, skipping ahead", "stream_key", s.Key)
+			haveBase = false
+		}
+		seq = at
+
+		if m == nil {
+			// Caught up with live. Tell the player once when the publisher
+			// has left, as EndPublish does for live players.
+			if !unpublished && s.State() != StreamPublishing {
+				unpublished = true
+				d.notify("NetStream.Play.UnpublishNotify", fmt.Sprintf("%s is now unpublished.", s.Key))
+				if eof, ok := d.conn.(streamEOFSender); ok {
+					_ = eof.SendStreamEOF(d.streamID)
+				}
+			}
+			select {
+			case <-d.stop:
+				return
+			case <-d.wake:
+			case <-more:
+			}
+			continue
+		}
+		unpublished = false
+
+		send, hdr := gate.admit(s, s.SubscriberMedia(d.conn), m)
+		if !send {
+			seq++
+			continue
+		}
+
+		if !haveBase {
+			baseTs, baseWall, haveBase = m.Timestamp, time.Now(), true
+		}
+		if m.Timestamp > baseTs {
+			due := baseWall.Add(time.Duration(m.Timestamp-baseTs) * time.Millisecond)
+			if wait := time.Until(due); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-d.stop:
+					timer.Stop()
+					return
+				case <-d.wake:
+					timer.Stop()
+					continue // pause arrived mid-wait; seq is unchanged
+				case <-timer.C:
+				}
+			}
+		}
+		if hdr != nil {
+			h := *hdr
+			h.Timestamp, h.MessageStreamID = m.Timestamp, d.streamID
+			_ = d.conn.SendMessage(&h)
+		}
+		out := *m // the buffered payload is never modified, so it can be shared
+		out.MessageStreamID = d.streamID
+		_ = d.conn.SendMessage(&out)
+		sent++
+		seq++
+	}
+}
+
+// trackGate applies a DVR player's track selection (media_filter.go):
+// skipped tracks are not sent, and a track switched back on restarts with
+// its sequence header, video at a keyframe.
+type trackGate struct {
+	audioGap bool // audio was skipped; resend the audio sequence header
+	videoGap bool // video was skipped; wait for a keyframe
+}
+
+// admit reports whether m is sent under filter f, and returns the cached
+// sequence header of s to send ahead of it, if any.
+func (g *trackGate) admit(s *Stream, f MediaFilter, m *chunk.Message) (bool, *chunk.Message) {
+	if f.skips(m.TypeID) {
+		if m.TypeID == 8 {
+			g.audioGap = true
+		} else {
+			g.videoGap = true
+		}
+		return false, nil
+	}
+	switch {
+	case m.TypeID == 9 && g.videoGap:
+		if media.IsVideoSequenceHeader(m.Payload) {
+			g.videoGap = false
+			return true, nil
+		}
+		if !media.IsVideoKeyframe(m.Payload) {
+			return false, nil
+		}
+		g.videoGap = false
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		return true, s.VideoSequenceHeader
+	case m.TypeID == 8 && g.audioGap:
+		g.audioGap = false
+		if media.IsAudioSequenceHeader(m.Payload) {
+			return true, nil
+		}
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		return true, s.AudioSequenceHeader
+	}
+	return true, nil
+}
+
+// notify sends an onStatus message on the subscriber's stream.
+func (d *dvrSession) notify(code, desc string) {
+	if m, err := buildOnStatus(d.streamID, d.stream.Key, code, desc); err == nil {
+		_ = d.conn.SendMessage(m)
+	}
+}
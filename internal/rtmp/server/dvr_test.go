@@ -0,0 +1,151 @@
+// dvr_test.go – tests for the DVR buffer and time-shifted playback.
+package server
+
+import (
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/logger"
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/client"
+)
+
+// TestDVRBuffer verifies trimming by whole GOPs, seeking to the keyframe
+// at or before the requested point, and skipping ahead from a trimmed seq.
+func TestDVRBuffer(t *testing.T) {
+	b := &dvrBuffer{window: 2 * time.Second}
+	audio := func(ts uint32) { b.add(&chunk.Message{TypeID: 8, Timestamp: ts, Payload: []byte{0xAF, 0x01}}) }
+	video := func(ts uint32, key bool) {
+		p := []byte{0x27, 0x01, 0, 0, 0}
+		if key {
+			p[0] = 0x17
+		}
+		b.add(&chunk.Message{TypeID: 9, Timestamp: ts, Payload: p})
+	}
+
+	audio(0) // before the first keyframe: dropped once video starts
+	if _, ok := b.seek(0); !ok {
+		t.Fatal("audio-only buffer not seekable")
+	}
+	for ts := uint32(100); ts <= 5000; ts += 100 {
+		video(ts, ts%1000 == 100) // a keyframe every second, at 100, 1100, ...
+		audio(ts)
+	}
+	first, _, _ := b.get(b.first)
+	if first.TypeID != 9 || first.Timestamp != 2100 {
+		t.Fatalf("buffer starts at type %d ts %d, want the keyframe at 2100, the GOP covering 3000", first.TypeID, first.Timestamp)
+	}
+	if d := b.duration(); d < 1900*time.Millisecond || d > 3*time.Second {
+		t.Fatalf("buffered %v, want the 2s window plus at most a GOP", d)
+	}
+
+	for _, tc := range []struct {
+		offset time.Duration
+		want   uint32
+	}{
+		{0, 4100},                      // live edge: the last keyframe
+		{800 * time.Millisecond, 4100}, // 4200 is after the last keyframe
+		{1500 * time.Millisecond, 3100},
+		{time.Minute, 2100}, // beyond the window: the oldest keyframe
+	} {
+		seq, ok := b.seek(tc.offset)
+		m, _, _ := b.get(seq)
+		if !ok || m.Timestamp != tc.want {
+			t.Errorf("seek(%v) = ts %d, want %d", tc.offset, m.Timestamp, tc.want)
+		}
+	}
+
+	old := b.first
+	for ts := uint32(5100); ts <= 6000; ts += 100 {
+		video(ts, ts%1000 == 100)
+	}
+	if m, at, skipped := b.get(old); !skipped || at != b.first || m.Timestamp != 3100 {
+		t.Fatalf("get(trimmed) = ts %d at %d skipped %v, want the oldest keyframe", m.Timestamp, at, skipped)
+	}
+	if m, _, _ := b.get(b.first + uint64(len(b.msgs))); m != nil {
+		t.Fatal("get past the newest message returned one")
+	}
+}
+
+func TestDVRStartOffset(t *testing.T) {
+	for start, want := range map[int64]time.Duration{
+		-30000: 30 * time.Second,
+		-500:   500 * time.Millisecond,
+	} {
+		if got, ok := dvrStartOffset(start); !ok || got != want {
+			t.Errorf("dvrStartOffset(%d) = %v, %v; want %v", start, got, ok, want)
+		}
+	}
+	for _, start := range []int64{-1, -2, -1000, -2000, 0, 5000} {
+		if _, ok := dvrStartOffset(start); ok {
+			t.Errorf("dvrStartOffset(%d) is a time shift", start)
+		}
+	}
+}
+
+// TestDVRPlayback plays a stream 1.5s behind live and verifies playback
+// starts at the keyframe before that point, paced, while live players get
+// the live edge.
+func TestDVRPlayback(t *testing.T) {
+	logger.UseWriter(io.Discard)
+	s := New(Config{ListenAddr: "127.0.0.1:0", DVRWindow: 10 * time.Second})
+	if err := s.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer s.Stop()
+
+	pub := connectTo(t, s, "live/dvr")
+	if err := pub.Publish(); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	waitFor(t, "publish", func() bool { return hasLivePublisher(s.reg, "live/dvr") })
+	seqHeader := []byte{0x17, 0x00, 0, 0, 0, 0x01, 0x64, 0x00, 0x1f}
+	_ = pub.SendVideo(0, seqHeader)
+	keyframe := func(n byte) []byte { return []byte{0x17, 0x01, 0, 0, 0, n} }
+	for n := byte(0); n <= 3; n++ {
+		_ = pub.SendVideo(uint32(n)*1000, keyframe(n))
+	}
+	waitFor(t, "DVR buffer", func() bool {
+		d, _ := s.reg.GetStream("live/dvr").DVRBuffered()
+		return d == 3*time.Second
+	})
+
+	c, err := client.New(fmt.Sprintf("rtmp://%s/live/dvr", s.Addr()))
+	if err != nil {
+		t.Fatalf("client.New: %v", err)
+	}
+	c.PlayStart = -1500
+	if err := c.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer c.Close()
+	if err := c.Play(); err != nil {
+		t.Fatalf("play: %v", err)
+	}
+	shifted := watchMessages(c)
+	shifted.waitStatus(t, "NetStream.Play.Start")
+	shifted.waitVideo(t, seqHeader)
+	shifted.waitVideo(t, keyframe(2)) // the keyframe at 2000, 1.5s before 3000
+	if n := s.reg.GetStream("live/dvr").SubscriberCount(); n != 1 {
+		t.Fatalf("%d players, want the time-shifted one counted", n)
+	}
+
+	live := playOn(t, s, "live/dvr")
+	defer live.c.Close()
+	live.waitStatus(t, "NetStream.Play.Start")
+	_ = pub.SendVideo(4000, keyframe(4))
+	live.waitVideo(t, keyframe(4))
+	start := time.Now()
+	shifted.waitVideo(t, keyframe(3))
+	shifted.waitVideo(t, keyframe(4))
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Fatalf("time-shifted player got 2s of media in %v, want real-time pace", elapsed)
+	}
+
+	info := s.reg.Snapshot()[0]
+	if info.DVRSeconds != 4 || info.DVRBytes == 0 {
+		t.Fatalf("snapshot DVR = %vs, %d bytes; want 4s buffered", info.DVRSeconds, info.DVRBytes)
+	}
+}
@@ -0,0 +1,111 @@
+package server
+
+// Video sequence headers by FourCC
+// --------------------------------
+// A stream keeps the latest video sequence header of every codec its
+// publisher has configured, keyed by FourCC (legacy AVC and HEVC headers
+// count as "avc1" and "hvc1"). VideoSequenceHeader, the one late joiners
+// and resumed players get, follows the codec of the frames actually being
+// sent: if a publisher switches from, say, HEVC to AV1 and back, players
+// joining after the switch back get the HEVC configuration rather than
+// the AV1 header that arrived last.
+//
+// Enhanced RTMP AV1 and VP9 packets are validated on the way through
+// (media.ValidateEnhancedVideo). A malformed sequence start is relayed but
+// not cached, so it is not replayed to every new player; malformed frames
+// are relayed as they are and logged.
+
+import (
+	"log/slog"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/media"
+)
+
+// videoFourCC returns the FourCC of the codec of a video payload, with
+// legacy AVC and HEVC mapped to their Enhanced RTMP FourCC, or "" when
+// the payload names no known codec.
+func videoFourCC(payload []byte) string {
+	if len(payload) == 0 {
+		return ""
+	}
+	if payload[0]&0x80 != 0 {
+		if len(payload) < 5 {
+			return ""
+		}
+		return string(payload[1:5])
+	}
+	switch payload[0] & 0x0F {
+	case 7:
+		return "avc1"
+	case 12:
+		return "hvc1"
+	}
+	return ""
+}
+
+// cacheVideoSequenceHeader stores a copy of a video sequence header as the
+// stream's current one and as the latest for its FourCC. An Enhanced RTMP
+// header that fails validation is not cached.
+func (s *Stream) cacheVideoSequenceHeader(msg *chunk.Message, logger *slog.Logger) {
+	if err := media.ValidateEnhancedVideo(msg.Payload); err != nil {
+		logger.Warn("Invalid video sequence header not cached", "stream_key", s.Key, "error", err)
+		return
+	}
+	hdr := &chunk.Message{
+		CSID:            msg.CSID,
+		TypeID:          msg.TypeID,
+		Timestamp:       msg.Timestamp,
+		MessageStreamID: msg.MessageStreamID,
+		MessageLength:   msg.MessageLength,
+		Payload:         make([]byte, len(msg.Payload)),
+	}
+	copy(hdr.Payload, msg.Payload)
+	fourCC := videoFourCC(msg.Payload)
+	s.mu.Lock()
+	s.VideoSequenceHeader = hdr
+	if fourCC != "" {
+		if s.VideoFourCCHeaders == nil {
+			s.VideoFourCCHeaders = make(map[string]*chunk.Message)
+		}
+		s.VideoFourCCHeaders[fourCC] = hdr
+	}
+	s.mu.Unlock()
+	logger.Info("Cached video sequence header", "stream_key", s.Key, "size", len(msg.Payload), "fourcc", fourCC)
+}
+
+// followVideoCodec checks a video frame (not a sequence header): Enhanced
+// RTMP AV1 and VP9 frames are validated, and when the frame's codec has a
+// cached header other than the current one, that header becomes current.
+func (s *Stream) followVideoCodec(msg *chunk.Message, logger *slog.Logger) {
+	p := msg.Payload
+	if len(p) >= 5 && p[0]&0x80 != 0 {
+		if pt := p[0] & 0x0F; pt != 1 && pt != 3 { // CodedFrames / CodedFramesX
+			return
+		}
+		if err := media.ValidateEnhancedVideo(p); err != nil {
+			if s.invalidVideoWarned.CompareAndSwap(false, true) {
+				logger.Warn("Invalid enhanced video frame", "stream_key", s.Key, "error", err)
+			} else if s.samplePacketLog(logger) {
+				logger.Debug("Invalid enhanced video frame", "stream_key", s.Key, "error", err, sampledAttr())
+			}
+		}
+	}
+	fourCC := videoFourCC(p)
+	if fourCC == "" {
+		return
+	}
+	s.mu.RLock()
+	hdr := s.VideoFourCCHeaders[fourCC]
+	current := hdr == nil || hdr == s.VideoSequenceHeader
+	s.mu.RUnlock()
+	if current {
+		return
+	}
+	s.mu.Lock()
+	if s.VideoFourCCHeaders[fourCC] == hdr {
+		s.VideoSequenceHeader = hdr
+	}
+	s.mu.Unlock()
+	logger.Info("Video codec changed, switched cached sequence header", "stream_key", s.Key, "fourcc", fourCC)
+}
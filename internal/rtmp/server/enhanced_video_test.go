@@ -0,0 +1,82 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/alxayo/go-rtmp/internal/logger"
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+)
+
+// Enhanced RTMP AV1 and VP9 payloads in the layout FFmpeg and OBS send
+// (see media/video_validate_test.go for the annotated versions).
+var (
+	av1Header = []byte{0x90, 'a', 'v', '0', '1', 0x81, 0x08, 0x0C, 0x00,
+		0x0A, 0x0B, 0x00, 0x00, 0x00, 0x4A, 0xAB, 0xBF, 0xC3, 0x77, 0x6B, 0xE4, 0x40}
+	av1Frame  = []byte{0xA1, 'a', 'v', '0', '1', 0x32, 0x05, 0x30, 0x03, 0xC0, 0x15, 0x20}
+	vp9Header = []byte{0x90, 'v', 'p', '0', '9', 0x01, 0x00, 0x00, 0x00,
+		0x00, 0x28, 0x82, 0x02, 0x02, 0x02, 0x00, 0x00}
+	vp9Frame = []byte{0xA1, 'v', 'p', '0', '9', 0x86, 0x00, 0x40, 0x92, 0x88, 0x2C}
+)
+
+// TestEnhancedVideoHeadersByFourCC checks that AV1 and VP9 packets reach
+// players unchanged, that sequence headers are cached per FourCC with the
+// current one following the codec of the frames, and that a malformed
+// configuration record is relayed but not cached.
+func TestEnhancedVideoHeadersByFourCC(t *testing.T) {
+	logger.UseWriter(io.Discard)
+	r := NewRegistry()
+	s, _ := r.CreateStream("live/enhanced")
+	sub := &capturingSubscriber{}
+	s.AddSubscriber(sub)
+	send := func(ts uint32, p []byte) {
+		s.BroadcastMessage(nil, &chunk.Message{CSID: 6, TypeID: 9, Timestamp: ts, MessageStreamID: 1,
+			MessageLength: uint32(len(p)), Payload: p}, logger.Logger())
+	}
+	current := func() string {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		if s.VideoSequenceHeader == nil {
+			return ""
+		}
+		return string(s.VideoSequenceHeader.Payload[1:5])
+	}
+
+	badHeader := bytes.Clone(av1Header)
+	badHeader[5] = 0x01 // av1C marker bit missing
+	sent := [][]byte{badHeader, av1Header, av1Frame, vp9Header, vp9Frame, av1Frame}
+	send(0, badHeader)
+	if current() != "" {
+		t.Fatal("malformed av1C record was cached")
+	}
+	send(0, av1Header)
+	send(40, av1Frame)
+	send(80, vp9Header)
+	if current() != "vp09" {
+		t.Fatalf("current header %q after the vp09 sequence start", current())
+	}
+	send(80, vp9Frame)
+	send(120, av1Frame) // publisher switched back to AV1
+	if current() != "av01" {
+		t.Fatalf("current header %q after AV1 frames resumed, want av01", current())
+	}
+	if h := s.VideoFourCCHeaders["vp09"]; h == nil || !bytes.Equal(h.Payload, vp9Header) {
+		t.Fatalf("vp09 header not kept: %v", h)
+	}
+
+	if len(sub.messages) != len(sent) {
+		t.Fatalf("player got %d messages, want %d", len(sub.messages), len(sent))
+	}
+	for i, m := range sub.messages {
+		if !bytes.Equal(m.Payload, sent[i]) {
+			t.Fatalf("message %d = % x, want % x", i, m.Payload, sent[i])
+		}
+	}
+
+	s.SetPublisher("pub")
+	s.EndPublish("pub")
+	if s.VideoFourCCHeaders != nil || s.VideoSequenceHeader != nil {
+		t.Fatal("headers survived the end of the publish")
+	}
+}
@@ -0,0 +1,85 @@
+package server
+
+// Player Heartbeat
+// ----------------
+// A player receives nothing while its publisher is paused or between the
+// sparse messages of an audio-only gap, and some NATs and firewalls drop a
+// connection that stays quiet for long. With Config.PingInterval set, the
+// server sends every player a User Control Ping Request at that interval.
+// The request is traffic in itself, and the Ping Response that players
+// such as ffplay, VLC and OBS send back keeps the read side busy too.
+//
+// Responses are tracked per connection (iconn.Connection.Ping). A player
+// that leaves Config.PingMisses requests in a row unanswered is treated as
+// gone: it is disconnected and EventSubscriberEvicted fires with reason
+// "ping_timeout".
+
+import (
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/server/hooks"
+)
+
+// DefaultPingMisses is how many heartbeat pings in a row a player may
+// leave unanswered before it is disconnected.
+const DefaultPingMisses = 3
+
+// pinger is a subscriber that answers heartbeat pings: an RTMP connection
+// (origin links and recorders are not).
+type pinger interface {
+	ID() string
+	Ping() error
+	PingsUnanswered() int
+	Close() error
+}
+
+// pingPlayers pings every player each Config.PingInterval and disconnects
+// the unresponsive ones, until done is closed.
+func (s *Server) pingPlayers(done <-chan struct{}) {
+	t := time.NewTicker(s.cfg.PingInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+			s.pingRound()
+		}
+	}
+}
+
+// pingRound sends one round of pings. A connection playing several
+// streams is pinged once.
+func (s *Server) pingRound() {
+	seen := make(map[pinger]bool)
+	for _, stream := range s.streamList() {
+		stream.mu.RLock()
+		subs := make([]pinger, 0, len(stream.Subscribers))
+		for _, sub := range stream.Subscribers {
+			if p, ok := sub.(pinger); ok && !seen[p] {
+				seen[p] = true
+				subs = append(subs, p)
+			}
+		}
+		stream.mu.RUnlock()
+		for _, p := range subs {
+			if missed := p.PingsUnanswered(); missed >= s.cfg.PingMisses {
+				s.evictUnresponsive(stream, p, missed)
+				continue
+			}
+			_ = p.Ping()
+		}
+	}
+}
+
+// evictUnresponsive disconnects a player of stream that stopped answering
+// pings, and fires EventSubscriberEvicted.
+func (s *Server) evictUnresponsive(stream *Stream, p pinger, missed int) {
+	s.log.Warn("disconnecting unresponsive player", "conn_id", p.ID(), "stream_key", stream.Key,
+		"pings_unanswered", missed, "ping_interval", s.cfg.PingInterval)
+	s.triggerHookEvent(hooks.EventSubscriberEvicted, p.ID(), stream.Key, vhostHookData(stream.vhost, map[string]interface{}{
+		"reason":           "ping_timeout",
+		"pings_unanswered": missed,
+	}))
+	_ = p.Close()
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/server/hooks"
+)
+
+// pingSubscriber is a player that answers heartbeat pings or not.
+type pingSubscriber struct {
+	id         string
+	answers    bool
+	pings      int
+	unanswered int
+	closed     bool
+}
+
+func (p *pingSubscriber) SendMessage(*chunk.Message) error { return nil }
+func (p *pingSubscriber) ID() string                       { return p.id }
+func (p *pingSubscriber) Close() error                     { p.closed = true; return nil }
+func (p *pingSubscriber) PingsUnanswered() int             { return p.unanswered }
+func (p *pingSubscriber) Ping() error {
+	p.pings++
+	if !p.answers {
+		p.unanswered++
+	}
+	return nil
+}
+
+func TestPingRoundEvictsUnresponsivePlayers(t *testing.T) {
+	srv := New(Config{ListenAddr: "127.0.0.1:0", PingInterval: time.Second, PingMisses: 2})
+	events, cancel := srv.Subscribe(4, hooks.EventSubscriberEvicted)
+	defer cancel()
+	show, _ := srv.reg.CreateStream("live/show")
+	other, _ := srv.reg.CreateStream("live/other")
+	live := &pingSubscriber{id: "c000001", answers: true}
+	silent := &pingSubscriber{id: "c000002"}
+	show.AddSubscriber(live)
+	show.AddSubscriber(silent)
+	show.AddSubscriber(&stubConn{}) // cannot be pinged; left alone
+	other.AddSubscriber(live)       // plays two streams, pinged once a round
+
+	srv.pingRound()
+	srv.pingRound()
+	if live.pings != 2 || silent.pings != 2 || silent.closed {
+		t.Fatalf("after two rounds: live pinged %d times, silent %d (closed %v)", live.pings, silent.pings, silent.closed)
+	}
+	srv.pingRound()
+	if !silent.closed || silent.pings != 2 || live.closed || live.pings != 3 {
+		t.Fatalf("after three rounds: silent closed %v, pinged %d; live closed %v, pinged %d", silent.closed, silent.pings, live.closed, live.pings)
+	}
+	select {
+	case ev := <-events:
+		if ev.ConnID != "c000002" || ev.StreamKey != "live/show" || ev.Data["reason"] != "ping_timeout" {
+			t.Fatalf("event = %+v", ev)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no subscriber_evicted event")
+	}
+}
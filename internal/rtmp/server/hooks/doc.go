@@ -8,6 +8,13 @@
 //   - Shell: Execute a script with event data as environment variables
 //   - Stdio: Print structured event data to stderr (for log pipelines)
 //
+// Applications embedding the server can also register Go callbacks
+// ([FuncHook]) or channel subscriptions ([ChanHook]), normally through
+// Server.OnEvent and Server.Subscribe.
+//
+// Any hook can be wrapped in a [QueuedHook], a bounded (optionally
+// persisted) queue giving at-least-once delivery across receiver outages.
+//
 // # Architecture
 //
 // The system has three main components:
@@ -16,6 +23,8 @@
 //   - [Hook]: Interface for handlers (Execute, Type, ID)
 //   - [HookManager]: Central registry that maps event types to hooks and
 //     dispatches events via a bounded concurrency pool
+//   - [StreamMatcher]: Optional glob or regexp scoping a hook to stream keys
+//     (see [HookManager.RegisterHookFor])
 //
 // # Supported Events
 //
@@ -24,7 +24,14 @@ const (
 	EventConnectionClose   EventType = "connection_close"
 	EventHandshakeComplete EventType = "handshake_complete"
 
-	// Stream events
+	// EventHandshakeRejected fires when a client opens with a handshake
+	// scheme the server does not speak (RTMPE, RTMPT, TLS on the plain
+	// port). It has no connection ID: no connection was established.
+	EventHandshakeRejected EventType = "handshake_rejected"
+
+	// Stream events. EventStreamDelete fires when a stream that has had
+	// no publisher and no subscribers for Config.EndedStreamTTL is removed
+	// from the registry.
 	EventStreamCreate EventType = "stream_create"
 	EventStreamDelete EventType = "stream_delete"
 	EventPublishStart EventType = "publish_start"
@@ -32,9 +39,50 @@ const (
 	EventPlayStart    EventType = "play_start"
 	EventPlayStop     EventType = "play_stop"
 
+	// EventSubscriberEvicted fires when a subscriber is disconnected for
+	// dropping too much media (Config.SlowSubscriberDropRate, reason
+	// "slow_subscriber") or for leaving heartbeat pings unanswered
+	// (Config.PingInterval, reason "ping_timeout").
+	EventSubscriberEvicted EventType = "subscriber_evicted"
+
+	// EventSubscriberLimit fires when a play is refused because the stream
+	// already has as many players as its limit allows
+	// (Config.MaxSubscribersPerStream, AppConfig.MaxSubscribers).
+	EventSubscriberLimit EventType = "subscriber_limit"
+
+	// Failover events
+	EventStreamFailover EventType = "stream_failover"
+
 	// Media events
 	EventCodecDetected EventType = "codec_detected"
 
+	// EventAVDrift fires when a stream's audio/video timestamp drift goes
+	// beyond Config.AVDriftThreshold, and again when it is back within it.
+	EventAVDrift EventType = "av_drift"
+
+	// EventCuePoint fires when a publisher sends a cue point or ad marker
+	// (onCuePoint, onAdMarker), e.g. a SCTE-35 splice signal.
+	EventCuePoint EventType = "cue_point"
+
+	// EventTimecode fires on the first onFI timecode of a publish and when
+	// the publisher's timecode jumps (no longer follows the stream
+	// timestamps).
+	EventTimecode EventType = "timecode"
+
+	// Recording events
+	EventRecordComplete    EventType = "record_complete"
+	EventRecordingUploaded EventType = "recording_uploaded"
+
+	// EventRecordStart and EventRecordStop fire when recording of a live
+	// stream is turned on or off at runtime (Server.StartRecording and
+	// Server.StopRecording, e.g. from the admin API).
+	EventRecordStart EventType = "record_start"
+	EventRecordStop  EventType = "record_stop"
+
+	// EventThumbnail fires when a new JPEG preview of a live stream has
+	// been written (Config.ThumbnailCommand).
+	EventThumbnail EventType = "thumbnail"
+
 	// Analytics events
 	EventSubscriberCount EventType = "subscriber_count"
 
@@ -42,6 +90,17 @@ const (
 	EventAuthFailed EventType = "auth_failed"
 )
 
+// AllEventTypes lists every event type, e.g. to subscribe to all of them.
+var AllEventTypes = []EventType{
+	EventConnectionAccept, EventConnectionClose, EventHandshakeComplete,
+	EventStreamCreate, EventStreamDelete, EventPublishStart, EventPublishStop,
+	EventPlayStart, EventPlayStop, EventCodecDetected, EventSubscriberCount,
+	EventAuthFailed, EventRecordComplete, EventRecordingUploaded, EventStreamFailover,
+	EventSubscriberEvicted, EventHandshakeRejected, EventAVDrift, EventCuePoint,
+	EventRecordStart, EventRecordStop, EventSubscriberLimit, EventTimecode,
+	EventThumbnail,
+}
+
 // Event represents a single RTMP event that can trigger hooks.
 // It carries enough context for any hook to act on: what happened (Type),
 // which connection (ConnID), which stream (StreamKey), and event-specific
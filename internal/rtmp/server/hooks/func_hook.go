@@ -0,0 +1,104 @@
+// Go-native Hooks
+// ===============
+// Embedding applications can react to server events in-process instead of
+// spawning scripts or running an HTTP endpoint:
+//   - FuncHook: calls a Go function for each event
+//   - ChanHook: delivers events on a channel for a consumer goroutine
+//
+// Both run through the HookManager's execution pool like any other hook, so
+// a slow callback never blocks RTMP message processing.
+package hooks
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrEventDropped is reported when a ChanHook's buffer is full.
+var ErrEventDropped = errors.New("event dropped: subscriber channel full")
+
+// FuncHook calls a Go function for each event.
+type FuncHook struct {
+	id string
+	fn func(Event) error
+}
+
+// NewFuncHook creates a hook that calls fn. A returned error is logged by
+// the HookManager like any other hook failure.
+func NewFuncHook(id string, fn func(Event) error) *FuncHook {
+	return &FuncHook{id: id, fn: fn}
+}
+
+// Execute calls the function with the event.
+func (h *FuncHook) Execute(ctx context.Context, event Event) error {
+	return h.fn(event)
+}
+
+// Type returns the hook type
+func (h *FuncHook) Type() string {
+	return "func"
+}
+
+// ID returns the hook ID
+func (h *FuncHook) ID() string {
+	return h.id
+}
+
+// ChanHook delivers events on a buffered channel. Events are dropped rather
+// than blocking the execution pool when the consumer falls behind.
+type ChanHook struct {
+	id     string
+	ch     chan Event
+	mu     sync.Mutex // guards closed against concurrent Execute/Close
+	closed bool
+}
+
+// NewChanHook creates a hook whose channel buffers up to size events.
+func NewChanHook(id string, size int) *ChanHook {
+	if size < 0 {
+		size = 0
+	}
+	return &ChanHook{id: id, ch: make(chan Event, size)}
+}
+
+// Events returns the channel events are delivered on. It is closed by Close.
+func (h *ChanHook) Events() <-chan Event {
+	return h.ch
+}
+
+// Execute queues the event, reporting ErrEventDropped if the buffer is full.
+func (h *ChanHook) Execute(ctx context.Context, event Event) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil
+	}
+	select {
+	case h.ch <- event:
+		return nil
+	default:
+		return ErrEventDropped
+	}
+}
+
+// Close closes the events channel. Unregister the hook first so no further
+// events are routed to it.
+func (h *ChanHook) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.closed {
+		h.closed = true
+		close(h.ch)
+	}
+}
+
+// Type returns the hook type
+func (h *ChanHook) Type() string {
+	return "chan"
+}
+
+// ID returns the hook ID
+func (h *ChanHook) ID() string {
+	return h.id
+}
@@ -183,3 +183,94 @@ func TestWebhookHook(t *testing.T) {
 		t.Errorf("Expected Authorization header 'Bearer token', got %s", hook.headers["Authorization"])
 	}
 }
+
+// TestChanHook verifies events are buffered, dropped once the buffer is
+// full, and ignored after Close.
+func TestChanHook(t *testing.T) {
+	hook := NewChanHook("chan-test", 1)
+	ctx := context.Background()
+	if err := hook.Execute(ctx, *NewEvent(EventPublishStart)); err != nil {
+		t.Fatalf("first event: %v", err)
+	}
+	if err := hook.Execute(ctx, *NewEvent(EventPublishStop)); err != ErrEventDropped {
+		t.Fatalf("expected ErrEventDropped with full buffer, got %v", err)
+	}
+	if e := <-hook.Events(); e.Type != EventPublishStart {
+		t.Fatalf("unexpected event %s", e.Type)
+	}
+	hook.Close()
+	if err := hook.Execute(ctx, *NewEvent(EventPublishStart)); err != nil {
+		t.Fatalf("execute after close: %v", err)
+	}
+	if _, ok := <-hook.Events(); ok {
+		t.Fatal("expected closed channel")
+	}
+}
+
+// TestStreamMatcher checks glob and "~" regular expression patterns.
+func TestStreamMatcher(t *testing.T) {
+	tests := []struct {
+		pattern, key string
+		want         bool
+	}{
+		{"events/*", "events/launch", true},
+		{"events/*", "live/events", false},
+		{"events/*", "events/a/b", false},
+		{"*/backup", "live/backup", true},
+		{"live/cam?", "live/cam1", true},
+		{"~^vod/.+_hd$", "vod/movie_hd", true},
+		{"~^vod/.+_hd$", "vod/movie_sd", false},
+		{"~cam", "live/cam2", true},
+	}
+	for _, tt := range tests {
+		m, err := NewStreamMatcher(tt.pattern)
+		if err != nil {
+			t.Fatalf("NewStreamMatcher(%q): %v", tt.pattern, err)
+		}
+		if got := m.Match(tt.key); got != tt.want {
+			t.Errorf("%q.Match(%q) = %v, want %v", tt.pattern, tt.key, got, tt.want)
+		}
+	}
+	for _, bad := range []string{"", "live/[", "~("} {
+		if _, err := NewStreamMatcher(bad); err == nil {
+			t.Errorf("NewStreamMatcher(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+// TestHookManagerStreamScope verifies a hook registered with a matcher only
+// sees events for matching stream keys.
+func TestHookManagerStreamScope(t *testing.T) {
+	manager := NewHookManager(DefaultHookConfig(), nil)
+	defer manager.Close()
+	scoped := NewChanHook("scoped", 4)
+	all := NewChanHook("all", 4)
+	m, _ := NewStreamMatcher("events/*")
+	manager.RegisterHookFor(EventPublishStart, scoped, m)
+	manager.RegisterHook(EventPublishStart, all)
+
+	ctx := context.Background()
+	manager.TriggerEvent(ctx, *NewEvent(EventPublishStart).WithStreamKey("live/show"))
+	manager.TriggerEvent(ctx, *NewEvent(EventPublishStart).WithStreamKey("events/launch"))
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-all.Events():
+		case <-time.After(time.Second):
+			t.Fatalf("unscoped hook got %d events, want 2", i)
+		}
+	}
+	select {
+	case e := <-scoped.Events():
+		if e.StreamKey != "events/launch" {
+			t.Fatalf("scoped hook got %s", e.StreamKey)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("scoped hook got no event")
+	}
+	select {
+	case e := <-scoped.Events():
+		t.Fatalf("scoped hook got a second event for %s", e.StreamKey)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -3,7 +3,8 @@
 // The HookManager is the central registry for event hooks. It maintains a
 // map of event types to hook lists, and dispatches events to all matching
 // hooks via a bounded concurrency pool. Hooks execute asynchronously so
-// they don't block RTMP message processing.
+// they don't block RTMP message processing. A hook registered with a
+// StreamMatcher only runs for events whose stream key it matches.
 package hooks
 
 import (
@@ -16,12 +17,18 @@ import (
 
 // HookManager manages hook registration and event dispatch.
 type HookManager struct {
-	hooks     map[EventType][]Hook // registered hooks, keyed by event type
-	stdioHook *StdioHook           // optional always-on stdio output hook
-	mu        sync.RWMutex         // protects hooks map
-	pool      *executionPool       // bounds concurrent hook executions
-	logger    *slog.Logger         // structured logger
-	config    HookConfig           // timeout, concurrency, stdio settings
+	hooks     map[EventType][]registration // registered hooks, keyed by event type
+	stdioHook *StdioHook                   // optional always-on stdio output hook
+	mu        sync.RWMutex                 // protects hooks map
+	pool      *executionPool               // bounds concurrent hook executions
+	logger    *slog.Logger                 // structured logger
+	config    HookConfig                   // timeout, concurrency, stdio settings
+}
+
+// registration is a hook and the streams it is scoped to.
+type registration struct {
+	hook  Hook
+	match *StreamMatcher // nil: every event
 }
 
 // NewHookManager creates a new hook manager
@@ -37,7 +44,7 @@ func NewHookManager(config HookConfig, logger *slog.Logger) *HookManager {
 	}
 
 	manager := &HookManager{
-		hooks:  make(map[EventType][]Hook),
+		hooks:  make(map[EventType][]registration),
 		logger: logger,
 		config: config,
 		pool:   newExecutionPool(config.Concurrency, logger),
@@ -53,6 +60,14 @@ func NewHookManager(config HookConfig, logger *slog.Logger) *HookManager {
 
 // RegisterHook registers a hook for the specified event type
 func (hm *HookManager) RegisterHook(eventType EventType, hook Hook) error {
+	return hm.RegisterHookFor(eventType, hook, nil)
+}
+
+// RegisterHookFor registers a hook for the specified event type that only
+// runs for events whose stream key match matches (every event when match
+// is nil). Events without a stream key, such as connection_accept, only
+// reach hooks whose matcher accepts the empty key.
+func (hm *HookManager) RegisterHookFor(eventType EventType, hook Hook, match *StreamMatcher) error {
 	if hook == nil {
 		return fmt.Errorf("cannot register nil hook")
 	}
@@ -60,11 +75,12 @@ func (hm *HookManager) RegisterHook(eventType EventType, hook Hook) error {
 	hm.mu.Lock()
 	defer hm.mu.Unlock()
 
-	hm.hooks[eventType] = append(hm.hooks[eventType], hook)
+	hm.hooks[eventType] = append(hm.hooks[eventType], registration{hook: hook, match: match})
 	hm.logger.Info("Hook registered",
 		"event_type", eventType,
 		"hook_type", hook.Type(),
-		"hook_id", hook.ID())
+		"hook_id", hook.ID(),
+		"stream_pattern", match.String())
 
 	return nil
 }
@@ -75,8 +91,8 @@ func (hm *HookManager) UnregisterHook(eventType EventType, hookID string) bool {
 	defer hm.mu.Unlock()
 
 	hooks := hm.hooks[eventType]
-	for i, hook := range hooks {
-		if hook.ID() == hookID {
+	for i, reg := range hooks {
+		if reg.hook.ID() == hookID {
 			// Remove hook from slice
 			hm.hooks[eventType] = append(hooks[:i], hooks[i+1:]...)
 			hm.logger.Info("Hook unregistered",
@@ -95,15 +111,15 @@ func (hm *HookManager) TriggerEvent(ctx context.Context, event Event) {
 		return
 	}
 
-	// Get hooks for this event type
+	// Get hooks for this event type and stream
 	hm.mu.RLock()
 	registered := hm.hooks[event.Type]
-	extra := 0
-	if hm.stdioHook != nil {
-		extra = 1
+	hooks := make([]Hook, 0, len(registered)+1)
+	for _, reg := range registered {
+		if reg.match.Match(event.StreamKey) {
+			hooks = append(hooks, reg.hook)
+		}
 	}
-	hooks := make([]Hook, len(registered), len(registered)+extra)
-	copy(hooks, registered)
 	hm.mu.RUnlock()
 
 	// Add stdio hook if enabled
@@ -177,11 +193,24 @@ func (hm *HookManager) GetStats() map[string]interface{} {
 	return stats
 }
 
-// Close shuts down the hook manager and waits for pending executions
+// Close shuts down the hook manager and waits for pending executions.
+// Hooks that hold resources of their own (such as a QueuedHook's worker)
+// are closed afterwards.
 func (hm *HookManager) Close() error {
 	if hm.pool != nil {
 		hm.pool.close()
 	}
+	hm.mu.RLock()
+	closed := make(map[Hook]bool)
+	for _, hooks := range hm.hooks {
+		for _, reg := range hooks {
+			if c, ok := reg.hook.(interface{ Close() error }); ok && !closed[reg.hook] {
+				closed[reg.hook] = true
+				_ = c.Close()
+			}
+		}
+	}
+	hm.mu.RUnlock()
 	hm.logger.Info("Hook manager closed")
 	return nil
 }
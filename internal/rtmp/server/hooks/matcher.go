@@ -0,0 +1,74 @@
+// Stream Matchers
+// ===============
+// A StreamMatcher scopes a hook (or another per-stream rule, such as which
+// streams are recorded) to the stream keys it matches:
+//   - a glob in path.Match syntax: "events/*", "live/cam?", "*/backup"
+//   - a regular expression, written with a leading "~": "~^vod/.+_hd$"
+//
+// Globs match the whole key and "*" does not cross a "/", so "events/*"
+// matches "events/launch" but not "live/events". Regular expressions match
+// anywhere in the key unless anchored.
+package hooks
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// StreamMatcher reports whether a stream key is in scope.
+type StreamMatcher struct {
+	pattern string
+	re      *regexp.Regexp // nil for a glob
+}
+
+// NewStreamMatcher parses a glob, or a regular expression when pattern
+// starts with "~".
+func NewStreamMatcher(pattern string) (*StreamMatcher, error) {
+	if expr, ok := strings.CutPrefix(pattern, "~"); ok {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stream pattern %q: %w", pattern, err)
+		}
+		return &StreamMatcher{pattern: pattern, re: re}, nil
+	}
+	if pattern == "" {
+		return nil, fmt.Errorf("empty stream pattern")
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid stream pattern %q: %w", pattern, err)
+	}
+	return &StreamMatcher{pattern: pattern}, nil
+}
+
+// Match reports whether streamKey matches. A nil matcher matches every key,
+// including the empty key of events not tied to a stream.
+func (m *StreamMatcher) Match(streamKey string) bool {
+	if m == nil {
+		return true
+	}
+	if m.re != nil {
+		return m.re.MatchString(streamKey)
+	}
+	ok, _ := path.Match(m.pattern, streamKey) // validated in NewStreamMatcher
+	return ok
+}
+
+// String returns the pattern the matcher was created from.
+func (m *StreamMatcher) String() string {
+	if m == nil {
+		return ""
+	}
+	return m.pattern
+}
+
+// MatchAny reports whether streamKey matches any of the matchers.
+func MatchAny(matchers []*StreamMatcher, streamKey string) bool {
+	for _, m := range matchers {
+		if m.Match(streamKey) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,335 @@
+// Hook Delivery Queue
+// ===================
+// A QueuedHook puts a delivery queue in front of another hook (normally a
+// webhook) so events raised while the receiver is down are not lost:
+//   - Execute only enqueues, so the execution pool is never held up.
+//   - A single worker delivers events in order and retries the head of the
+//     queue with backoff until it succeeds: at-least-once delivery.
+//   - The queue is bounded by size and age; the oldest events are evicted
+//     first and counted in the rtmp_hook_events_dropped metric.
+//   - With a directory configured the queue is journaled to
+//     <dir>/<name>.jsonl and reloaded on startup, so pending events survive
+//     a restart. Each change appends one line (an event queued, or events
+//     removed from the front), so Execute and deliveries write a few bytes
+//     instead of the whole queue. The journal is truncated whenever the
+//     queue empties and rewritten from the queue once it holds more than
+//     twice MaxSize records.
+package hooks
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/metrics"
+)
+
+// Retry backoff for the head of the queue.
+const (
+	queueRetryMin = time.Second
+	queueRetryMax = 30 * time.Second
+)
+
+// QueueConfig bounds a QueuedHook.
+type QueueConfig struct {
+	MaxSize int           // maximum queued events (oldest evicted first); must be > 0
+	MaxAge  time.Duration // events older than this are evicted (0 = no limit)
+	Dir     string        // directory for the persisted queue ("" = memory only)
+	Name    string        // persisted queue's file name without extension ("" = the inner hook's ID)
+}
+
+// QueuedHook delivers events to an inner hook through a bounded queue.
+type QueuedHook struct {
+	inner  Hook
+	cfg    QueueConfig
+	path   string // persisted queue journal ("" = memory only)
+	logger *slog.Logger
+
+	mu        sync.Mutex
+	pending   []Event
+	journal   *os.File      // open for appending (nil = memory only or closed)
+	records   int           // records in journal
+	evictions uint64        // bumped whenever eviction removes events from the front
+	wake      chan struct{} // signals the worker that events were queued
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// NewQueuedHook wraps inner with a delivery queue and starts its worker.
+// Events persisted by a previous run are loaded when cfg.Dir is set.
+func NewQueuedHook(inner Hook, cfg QueueConfig, logger *slog.Logger) (*QueuedHook, error) {
+	if cfg.MaxSize <= 0 {
+		return nil, fmt.Errorf("hook queue %s: max size must be positive", inner.ID())
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	q := &QueuedHook{
+		inner:  inner,
+		cfg:    cfg,
+		logger: logger,
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if cfg.Dir != "" {
+		if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+			return nil, fmt.Errorf("hook queue %s: %w", inner.ID(), err)
+		}
+		name := cfg.Name
+		if name == "" {
+			name = inner.ID()
+		}
+		q.path = filepath.Join(cfg.Dir, name+".jsonl")
+		if err := q.load(); err != nil {
+			return nil, err
+		}
+		// Start from a journal of just the restored events.
+		q.compactLocked()
+	}
+	go q.run()
+	return q, nil
+}
+
+// Execute enqueues the event for delivery and returns immediately.
+func (q *QueuedHook) Execute(ctx context.Context, event Event) error {
+	q.mu.Lock()
+	q.pending = append(q.pending, event)
+	metrics.HookEventsQueued.Add(1)
+	q.journalLocked(queueRecord{Event: &event})
+	q.evictLocked(time.Now())
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Len returns the number of events waiting for delivery.
+func (q *QueuedHook) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// Close stops the worker. Undelivered events stay in the persisted queue
+// (when a directory is configured) for the next run.
+func (q *QueuedHook) Close() error {
+	select {
+	case <-q.stop:
+	default:
+		close(q.stop)
+	}
+	<-q.done
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.journal != nil {
+		_ = q.journal.Close()
+		q.journal = nil
+	}
+	return nil
+}
+
+// Type returns the inner hook's type
+func (q *QueuedHook) Type() string {
+	return q.inner.Type()
+}
+
+// ID returns the inner hook's ID
+func (q *QueuedHook) ID() string {
+	return q.inner.ID()
+}
+
+// run delivers queued events in order until Close.
+func (q *QueuedHook) run() {
+	defer close(q.done)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-q.stop
+		cancel()
+	}()
+
+	backoff := queueRetryMin
+	for {
+		q.mu.Lock()
+		q.evictLocked(time.Now())
+		var head *Event
+		if len(q.pending) > 0 {
+			ev := q.pending[0]
+			head = &ev
+		}
+		gen := q.evictions
+		q.mu.Unlock()
+
+		if head == nil {
+			select {
+			case <-q.wake:
+				continue
+			case <-q.stop:
+				return
+			}
+		}
+
+		if err := q.inner.Execute(ctx, *head); err != nil {
+			q.logger.Warn("Queued hook delivery failed, will retry",
+				"hook_id", q.ID(), "event_type", head.Type, "retry_in", backoff, "error", err)
+			select {
+			case <-time.After(backoff):
+			case <-q.stop:
+				return
+			}
+			backoff = min(backoff*2, queueRetryMax)
+			continue
+		}
+		backoff = queueRetryMin
+
+		q.mu.Lock()
+		// If eviction ran meanwhile it already removed the delivered head.
+		if q.evictions == gen {
+			q.pending = q.pending[1:]
+			metrics.HookEventsQueued.Add(-1)
+			q.journalLocked(queueRecord{Removed: 1})
+		}
+		q.mu.Unlock()
+		metrics.HookEventsDelivered.Add(1)
+	}
+}
+
+// evictLocked drops events beyond MaxSize or older than MaxAge.
+func (q *QueuedHook) evictLocked(now time.Time) {
+	drop := 0
+	if over := len(q.pending) - q.cfg.MaxSize; over > 0 {
+		drop = over
+	}
+	if q.cfg.MaxAge > 0 {
+		cutoff := now.Add(-q.cfg.MaxAge).Unix()
+		for drop < len(q.pending) && q.pending[drop].Timestamp < cutoff {
+			drop++
+		}
+	}
+	if drop == 0 {
+		return
+	}
+	q.pending = q.pending[drop:]
+	q.evictions++
+	q.journalLocked(queueRecord{Removed: drop})
+	metrics.HookEventsQueued.Add(int64(-drop))
+	metrics.HookEventsDropped.Add(int64(drop))
+	q.logger.Warn("Evicted queued hook events", "hook_id", q.ID(), "dropped", drop)
+}
+
+// queueRecord is one line of the persisted queue's journal: an event
+// queued, or a number of events removed from the front of the queue.
+type queueRecord struct {
+	Event   *Event `json:"event,omitempty"`
+	Removed int    `json:"removed,omitempty"`
+}
+
+// journalLocked appends rec to the journal. Once the queue is empty the
+// journal is truncated instead, and once it holds more than twice MaxSize
+// records it is rewritten from the queue.
+func (q *QueuedHook) journalLocked(rec queueRecord) {
+	if q.journal == nil {
+		return
+	}
+	var err error
+	switch {
+	case len(q.pending) == 0:
+		err = q.journal.Truncate(0)
+		q.records = 0
+	case q.records >= 2*q.cfg.MaxSize:
+		q.compactLocked()
+		return
+	default:
+		var line []byte
+		if line, err = json.Marshal(rec); err == nil {
+			_, err = q.journal.Write(append(line, '\n'))
+			q.records++
+		}
+	}
+	if err != nil {
+		q.logger.Error("Failed to persist hook queue", "hook_id", q.ID(), "path", q.path, "error", err)
+	}
+}
+
+// compactLocked rewrites the journal as one record per queued event, via a
+// temp file and rename, and reopens it for appending.
+func (q *QueuedHook) compactLocked() {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for i := range q.pending {
+		if err := enc.Encode(queueRecord{Event: &q.pending[i]}); err != nil {
+			q.logger.Error("Failed to persist hook queue", "hook_id", q.ID(), "path", q.path, "error", err)
+			return
+		}
+	}
+	tmp := q.path + ".tmp"
+	err := os.WriteFile(tmp, buf.Bytes(), 0o600)
+	if err == nil {
+		err = os.Rename(tmp, q.path)
+	}
+	if q.journal != nil {
+		_ = q.journal.Close()
+		q.journal = nil
+	}
+	if err == nil {
+		q.journal, err = os.OpenFile(q.path, os.O_WRONLY|os.O_APPEND, 0o600)
+	}
+	if err != nil {
+		q.logger.Error("Failed to persist hook queue", "hook_id", q.ID(), "path", q.path, "error", err)
+		return
+	}
+	q.records = len(q.pending)
+}
+
+// load restores a queue journaled by a previous run. A last line cut short
+// by a crash is skipped.
+func (q *QueuedHook) load() error {
+	f, err := os.Open(q.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("hook queue %s: %w", q.ID(), err)
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				q.logger.Warn("Skipped incomplete hook queue record", "hook_id", q.ID(), "path", q.path)
+			}
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("hook queue %s: %w", q.ID(), err)
+		}
+		var rec queueRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return fmt.Errorf("hook queue %s: corrupt queue file %s: %w", q.ID(), q.path, err)
+		}
+		if rec.Event != nil {
+			q.pending = append(q.pending, *rec.Event)
+		}
+		q.pending = q.pending[min(rec.Removed, len(q.pending)):]
+	}
+	metrics.HookEventsQueued.Add(int64(len(q.pending)))
+	q.evictLocked(time.Now())
+	if len(q.pending) > 0 {
+		q.logger.Info("Restored queued hook events", "hook_id", q.ID(), "count", len(q.pending))
+	}
+	return nil
+}
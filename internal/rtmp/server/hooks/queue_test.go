@@ -0,0 +1,179 @@
+// queue_test.go – tests for QueuedHook: in-order at-least-once delivery,
+// size/age eviction, persistence across restarts and the journal.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyHook fails while down is set and records delivered stream keys.
+type flakyHook struct {
+	mu        sync.Mutex
+	down      bool
+	delivered []string
+}
+
+func (h *flakyHook) Execute(ctx context.Context, e Event) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.down {
+		return errors.New("endpoint down")
+	}
+	h.delivered = append(h.delivered, e.StreamKey)
+	return nil
+}
+func (h *flakyHook) Type() string { return "flaky" }
+func (h *flakyHook) ID() string   { return "flaky" }
+
+func (h *flakyHook) setDown(down bool) {
+	h.mu.Lock()
+	h.down = down
+	h.mu.Unlock()
+}
+
+func (h *flakyHook) got() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.delivered...)
+}
+
+func event(key string) Event {
+	return *NewEvent(EventPublishStart).WithStreamKey(key)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestQueuedHook_DeliversAfterOutage verifies events queued while the
+// receiver is down are delivered in order once it recovers.
+func TestQueuedHook_DeliversAfterOutage(t *testing.T) {
+	inner := &flakyHook{down: true}
+	q, err := NewQueuedHook(inner, QueueConfig{MaxSize: 10}, nil)
+	if err != nil {
+		t.Fatalf("NewQueuedHook: %v", err)
+	}
+	defer q.Close()
+
+	for _, k := range []string{"live/a", "live/b", "live/c"} {
+		_ = q.Execute(context.Background(), event(k))
+	}
+	inner.setDown(false)
+	waitFor(t, func() bool { return q.Len() == 0 })
+	if got := inner.got(); len(got) != 3 || got[0] != "live/a" || got[2] != "live/c" {
+		t.Fatalf("delivered %v, want [live/a live/b live/c]", got)
+	}
+}
+
+// TestQueuedHook_Eviction verifies the oldest events are dropped beyond
+// MaxSize and events older than MaxAge are dropped.
+func TestQueuedHook_Eviction(t *testing.T) {
+	inner := &flakyHook{down: true}
+	q, err := NewQueuedHook(inner, QueueConfig{MaxSize: 2, MaxAge: time.Hour}, nil)
+	if err != nil {
+		t.Fatalf("NewQueuedHook: %v", err)
+	}
+	defer q.Close()
+
+	stale := event("live/stale")
+	stale.Timestamp = time.Now().Add(-2 * time.Hour).Unix()
+	_ = q.Execute(context.Background(), stale)
+	if n := q.Len(); n != 0 {
+		t.Fatalf("stale event kept: len = %d", n)
+	}
+	for _, k := range []string{"live/a", "live/b", "live/c"} {
+		_ = q.Execute(context.Background(), event(k))
+	}
+	if n := q.Len(); n != 2 {
+		t.Fatalf("len = %d, want 2", n)
+	}
+	inner.setDown(false)
+	waitFor(t, func() bool { return q.Len() == 0 })
+	if got := inner.got(); len(got) != 2 || got[0] != "live/b" {
+		t.Fatalf("delivered %v, want [live/b live/c]", got)
+	}
+}
+
+// TestQueuedHook_Persistence verifies undelivered events are reloaded by
+// a new queue using the same directory.
+func TestQueuedHook_Persistence(t *testing.T) {
+	dir := t.TempDir()
+	inner := &flakyHook{down: true}
+	q, err := NewQueuedHook(inner, QueueConfig{MaxSize: 10, Dir: dir}, nil)
+	if err != nil {
+		t.Fatalf("NewQueuedHook: %v", err)
+	}
+	_ = q.Execute(context.Background(), event("live/a"))
+	_ = q.Execute(context.Background(), event("live/b"))
+	q.Close()
+
+	restarted := &flakyHook{}
+	q2, err := NewQueuedHook(restarted, QueueConfig{MaxSize: 10, Dir: dir}, nil)
+	if err != nil {
+		t.Fatalf("NewQueuedHook after restart: %v", err)
+	}
+	defer q2.Close()
+	waitFor(t, func() bool { return q2.Len() == 0 })
+	if got := restarted.got(); len(got) != 2 || got[0] != "live/a" || got[1] != "live/b" {
+		t.Fatalf("delivered %v after restart, want [live/a live/b]", got)
+	}
+}
+
+// TestQueuedHook_Journal verifies that the journal stays bounded while
+// events are queued and evicted, that a restart restores the queue from it
+// despite a record cut short, and that it is emptied once the queue is.
+func TestQueuedHook_Journal(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "q.jsonl")
+	cfg := QueueConfig{MaxSize: 3, Dir: dir, Name: "q"}
+	q, err := NewQueuedHook(&flakyHook{down: true}, cfg, nil)
+	if err != nil {
+		t.Fatalf("NewQueuedHook: %v", err)
+	}
+	for _, k := range []string{"live/a", "live/b", "live/c", "live/d", "live/e", "live/f", "live/g"} {
+		_ = q.Execute(context.Background(), event(k))
+	}
+	q.Close()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(data, []byte("\n")); n > 2*cfg.MaxSize+1 {
+		t.Fatalf("journal has %d records for a queue of %d", n, cfg.MaxSize)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"event":{"type":"publish_st`)
+	f.Close()
+
+	restarted := &flakyHook{}
+	q2, err := NewQueuedHook(restarted, cfg, nil)
+	if err != nil {
+		t.Fatalf("NewQueuedHook after restart: %v", err)
+	}
+	defer q2.Close()
+	waitFor(t, func() bool { return q2.Len() == 0 })
+	if got := restarted.got(); !slices.Equal(got, []string{"live/e", "live/f", "live/g"}) {
+		t.Fatalf("delivered %v after restart, want [live/e live/f live/g]", got)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Size() != 0 {
+		t.Fatalf("journal of the empty queue: %v, %v", fi, err)
+	}
+}
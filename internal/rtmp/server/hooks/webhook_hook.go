@@ -3,17 +3,44 @@
 // Sends an HTTP POST request with JSON event data to a URL when an RTMP
 // event occurs. Useful for notifying external APIs (e.g. authentication
 // servers, analytics platforms, CDN management systems).
+//
+// Delivery is hardened for unreliable receivers:
+//   - Retries: failed deliveries (network errors, 429 and 5xx) are retried
+//     with exponential backoff. Other 4xx responses are not retried.
+//   - Signing: with a shared secret, each request carries an HMAC-SHA256 of
+//     the JSON body in the X-RTMP-Signature-256 header ("sha256=<hex>").
+//   - Circuit breaker: after several consecutive failed deliveries the hook
+//     fails fast for a cooldown period, so a dead endpoint does not tie up
+//     the execution pool with timeouts and retries.
 package hooks
 
 import (
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 )
 
+// SignatureHeader carries the HMAC-SHA256 of the request body when a
+// webhook secret is configured.
+const SignatureHeader = "X-RTMP-Signature-256"
+
+// Default circuit breaker settings for new webhook hooks.
+const (
+	DefaultBreakerThreshold = 5                // consecutive failed deliveries before opening
+	DefaultBreakerCooldown  = 30 * time.Second // how long an open breaker rejects events
+)
+
+// ErrCircuitOpen is returned while a webhook's circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
 // WebhookHook sends an HTTP POST with JSON event data when an event occurs.
 type WebhookHook struct {
 	id      string            // unique identifier for this hook
@@ -21,9 +48,20 @@ type WebhookHook struct {
 	headers map[string]string // custom HTTP headers (e.g. Authorization)
 	timeout time.Duration     // HTTP request timeout
 	client  *http.Client      // reusable HTTP client
+	secret  []byte            // HMAC key for SignatureHeader (nil = unsigned)
+
+	retries int           // extra attempts after a failed delivery
+	backoff time.Duration // delay before the first retry, doubled per retry
+
+	breakerThreshold int           // consecutive failures that open the breaker (0 = disabled)
+	breakerCooldown  time.Duration // how long the breaker stays open
+	mu               sync.Mutex    // protects failures and openUntil
+	failures         int           // consecutive failed deliveries
+	openUntil        time.Time     // breaker rejects events until this time
 }
 
-// NewWebhookHook creates a new webhook hook
+// NewWebhookHook creates a new webhook hook. It does not retry and uses the
+// default circuit breaker settings.
 func NewWebhookHook(id, url string, timeout time.Duration) *WebhookHook {
 	return &WebhookHook{
 		id:      id,
@@ -33,9 +71,37 @@ func NewWebhookHook(id, url string, timeout time.Duration) *WebhookHook {
 		client: &http.Client{
 			Timeout: timeout,
 		},
+		breakerThreshold: DefaultBreakerThreshold,
+		breakerCooldown:  DefaultBreakerCooldown,
 	}
 }
 
+// SetRetry retries a failed delivery up to retries more times, waiting
+// backoff before the first retry and doubling it for each further one.
+func (h *WebhookHook) SetRetry(retries int, backoff time.Duration) *WebhookHook {
+	h.retries = retries
+	h.backoff = backoff
+	return h
+}
+
+// SetSecret enables request signing with an HMAC-SHA256 shared secret.
+// An empty secret disables signing.
+func (h *WebhookHook) SetSecret(secret string) *WebhookHook {
+	h.secret = nil
+	if secret != "" {
+		h.secret = []byte(secret)
+	}
+	return h
+}
+
+// SetCircuitBreaker opens the breaker after threshold consecutive failed
+// deliveries and keeps it open for cooldown. A threshold of 0 disables it.
+func (h *WebhookHook) SetCircuitBreaker(threshold int, cooldown time.Duration) *WebhookHook {
+	h.breakerThreshold = threshold
+	h.breakerCooldown = cooldown
+	return h
+}
+
 // SetHeaders sets custom HTTP headers for the webhook request
 func (h *WebhookHook) SetHeaders(headers map[string]string) *WebhookHook {
 	h.headers = headers
@@ -51,18 +117,46 @@ func (h *WebhookHook) AddHeader(key, value string) *WebhookHook {
 	return h
 }
 
-// Execute sends the event data as JSON to the webhook URL
+// Execute sends the event data as JSON to the webhook URL, retrying and
+// tripping the circuit breaker as configured.
 func (h *WebhookHook) Execute(ctx context.Context, event Event) error {
+	if !h.allow() {
+		return fmt.Errorf("webhook hook %s: %w", h.id, ErrCircuitOpen)
+	}
+
 	// Marshal event to JSON
 	jsonData, err := json.Marshal(event)
 	if err != nil {
 		return fmt.Errorf("webhook hook %s: failed to marshal JSON: %w", h.id, err)
 	}
 
-	// Create HTTP request
-	req, err := http.NewRequestWithContext(ctx, "POST", h.url, bytes.NewBuffer(jsonData))
+	backoff := h.backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := h.post(ctx, jsonData)
+		if err == nil {
+			h.record(true)
+			return nil
+		}
+		if !retry || attempt >= h.retries {
+			h.record(false)
+			return fmt.Errorf("webhook hook %s: %w", h.id, err)
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			h.record(false)
+			return fmt.Errorf("webhook hook %s: %w (%v)", h.id, ctx.Err(), err)
+		}
+		backoff *= 2
+	}
+}
+
+// post performs one delivery attempt and reports whether a failure is
+// worth retrying.
+func (h *WebhookHook) post(ctx context.Context, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", h.url, bytes.NewReader(body))
 	if err != nil {
-		return fmt.Errorf("webhook hook %s: failed to create request: %w", h.id, err)
+		return false, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Set default content type
@@ -72,20 +166,54 @@ func (h *WebhookHook) Execute(ctx context.Context, event Event) error {
 	for key, value := range h.headers {
 		req.Header.Set(key, value)
 	}
+	if h.secret != nil {
+		req.Header.Set(SignatureHeader, Sign(h.secret, body))
+	}
 
-	// Execute request
 	resp, err := h.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("webhook hook %s: request failed: %w", h.id, err)
+		return ctx.Err() == nil, fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	// Check response status
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("webhook hook %s: server returned status %d", h.id, resp.StatusCode)
+		retry = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return retry, fmt.Errorf("server returned status %d", resp.StatusCode)
 	}
+	return false, nil
+}
+
+// allow reports whether the circuit breaker lets a delivery through. Once
+// the cooldown has passed, deliveries are attempted again; a further
+// failure re-opens the breaker immediately.
+func (h *WebhookHook) allow() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.breakerThreshold <= 0 || !time.Now().Before(h.openUntil)
+}
+
+// record updates the circuit breaker with the outcome of a delivery.
+func (h *WebhookHook) record(ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if ok {
+		h.failures = 0
+		return
+	}
+	h.failures++
+	if h.breakerThreshold > 0 && h.failures >= h.breakerThreshold {
+		h.openUntil = time.Now().Add(h.breakerCooldown)
+	}
+}
 
-	return nil
+// Sign returns the SignatureHeader value for body: "sha256=" followed by
+// the hex HMAC-SHA256 of body keyed with secret. Receivers should compare
+// it with hmac.Equal.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
 }
 
 // Type returns the hook type
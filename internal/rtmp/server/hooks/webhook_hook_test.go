@@ -0,0 +1,98 @@
+// webhook_hook_test.go – delivery tests for WebhookHook against an
+// httptest server: signing, custom headers, retries and circuit breaking.
+package hooks
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestWebhookHook_SignsAndSendsHeaders verifies the signature header
+// matches the body and custom headers are sent.
+func TestWebhookHook_SignsAndSendsHeaders(t *testing.T) {
+	var gotSig, gotHeader string
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotSig = r.Header.Get(SignatureHeader)
+		gotHeader = r.Header.Get("X-Tenant")
+		gotBody, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	hook := NewWebhookHook("signed", srv.URL, 5*time.Second).SetSecret("s3cret").AddHeader("X-Tenant", "acme")
+	if err := hook.Execute(context.Background(), *NewEvent(EventPublishStart).WithStreamKey("live/test")); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if want := Sign([]byte("s3cret"), gotBody); gotSig != want {
+		t.Errorf("signature = %q, want %q", gotSig, want)
+	}
+	if gotHeader != "acme" {
+		t.Errorf("X-Tenant = %q, want acme", gotHeader)
+	}
+}
+
+// TestWebhookHook_Retries verifies 5xx responses are retried and 4xx are not.
+func TestWebhookHook_Retries(t *testing.T) {
+	var calls atomic.Int32
+	status := http.StatusServiceUnavailable
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(status)
+		}
+	}))
+	defer srv.Close()
+
+	hook := NewWebhookHook("retry", srv.URL, 5*time.Second).SetRetry(3, time.Millisecond)
+	if err := hook.Execute(context.Background(), *NewEvent(EventPublishStart)); err != nil {
+		t.Fatalf("expected success after retries, got %v", err)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("calls = %d, want 3", n)
+	}
+
+	calls.Store(0)
+	status = http.StatusBadRequest
+	if err := hook.Execute(context.Background(), *NewEvent(EventPublishStart)); err == nil {
+		t.Fatal("expected 400 to fail")
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("400 was retried: calls = %d, want 1", n)
+	}
+}
+
+// TestWebhookHook_CircuitBreaker verifies a failing endpoint is skipped
+// once the breaker opens, and tried again after the cooldown.
+func TestWebhookHook_CircuitBreaker(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	hook := NewWebhookHook("breaker", srv.URL, 5*time.Second).SetCircuitBreaker(2, 50*time.Millisecond)
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		_ = hook.Execute(ctx, *NewEvent(EventPublishStart))
+	}
+	if err := hook.Execute(ctx, *NewEvent(EventPublishStart)); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("calls = %d, want 2 (open breaker must not call the endpoint)", n)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if err := hook.Execute(ctx, *NewEvent(EventPublishStart)); errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("breaker still open after cooldown")
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("calls = %d, want 3 after cooldown", n)
+	}
+}
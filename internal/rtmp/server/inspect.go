@@ -0,0 +1,532 @@
+package server
+
+// Inspect Mode
+// ------------
+// With Config.Inspect the server is a protocol analyzer for debugging
+// encoders. Every publish is accepted (no authentication, app limits or
+// stream registration) and media is parsed but discarded: nothing is
+// broadcast, recorded or relayed. Instead, each connection gets a report
+// of what its peer sent, written when it disconnects:
+//
+//   - the commands, in order, with their arguments (connect object included)
+//   - the protocol control messages it sent (chunk size, window, ...)
+//   - chunk header formats used per message type, and extended timestamps
+//   - per track: codec, sequence headers and the parameters in them
+//     (resolution, AVC profile/level, sample rate, channels), keyframes,
+//     timestamp deltas and regressions, frame rate, bitrate, and how fast
+//     media timestamps advanced compared to the wall clock
+//   - metadata and other data messages
+//   - warnings for common encoder mistakes
+//
+// The report is logged and, with Config.InspectDir, written there as JSON.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	iconn "github.com/alxayo/go-rtmp/internal/rtmp/conn"
+	"github.com/alxayo/go-rtmp/internal/rtmp/control"
+	"github.com/alxayo/go-rtmp/internal/rtmp/media"
+	"github.com/alxayo/go-rtmp/internal/rtmp/rpc"
+)
+
+// Bounds on the lists in a report, so a misbehaving peer cannot grow it
+// without limit. Counters keep counting past them.
+const (
+	inspectMaxCommands = 200
+	inspectMaxControl  = 100
+	inspectMaxData     = 100
+	inspectMaxWarnings = 50
+)
+
+// InspectReport describes what one connection sent, as analyzed in inspect
+// mode.
+type InspectReport struct {
+	ConnID      string    `json:"conn_id"`
+	RemoteAddr  string    `json:"remote_addr"`
+	Start       time.Time `json:"start"`
+	DurationSec float64   `json:"duration_sec"`
+	HandshakeMs int64     `json:"handshake_ms"`
+	BytesRead   uint64    `json:"bytes_read"`
+
+	Commands []InspectCommand `json:"commands"`
+	Control  []InspectControl `json:"control,omitempty"`
+	Chunks   InspectChunks    `json:"chunks"`
+	Messages map[string]int   `json:"messages"` // messages by type name
+
+	Video    *InspectTrack          `json:"video,omitempty"`
+	Audio    *InspectTrack          `json:"audio,omitempty"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	Data     []InspectData          `json:"data,omitempty"` // data messages other than onMetaData
+
+	Warnings []string `json:"warnings,omitempty"`
+	// Truncated counts entries left out of the lists above once full.
+	Truncated int `json:"truncated,omitempty"`
+}
+
+// InspectCommand is one command message (AMF0 or AMF3).
+type InspectCommand struct {
+	AtMs          int64         `json:"at_ms"` // since the connection was accepted
+	StreamID      uint32        `json:"stream_id"`
+	Name          string        `json:"name"`
+	TransactionID float64       `json:"transaction_id"`
+	Args          []interface{} `json:"args,omitempty"`  // command object and arguments
+	Error         string        `json:"error,omitempty"` // why the payload could not be decoded
+}
+
+// InspectControl is one protocol control message (types 1-6).
+type InspectControl struct {
+	AtMs  int64       `json:"at_ms"`
+	Type  string      `json:"type"`
+	Value interface{} `json:"value,omitempty"` // decoded fields
+	Error string      `json:"error,omitempty"`
+}
+
+// InspectData is one data message other than onMetaData.
+type InspectData struct {
+	AtMs      int64         `json:"at_ms"`
+	Timestamp uint32        `json:"timestamp"`
+	Name      string        `json:"name"`
+	Args      []interface{} `json:"args,omitempty"`
+}
+
+// InspectChunks summarizes the chunk headers received.
+type InspectChunks struct {
+	Total              int               `json:"total"`
+	Formats            map[string][4]int `json:"formats"` // chunks by header format 0-3, per message type name
+	ExtendedTimestamps int               `json:"extended_timestamps"`
+	ChunkStreams       []uint32          `json:"chunk_streams"`  // CSIDs used
+	MaxChunkSize       uint32            `json:"max_chunk_size"` // the chunk size the peer set (128 if never)
+}
+
+// InspectTrack summarizes one media track.
+type InspectTrack struct {
+	Codec           string `json:"codec,omitempty"`
+	Enhanced        bool   `json:"enhanced,omitempty"` // Enhanced RTMP (FourCC) tags
+	Messages        int    `json:"messages"`
+	Bytes           uint64 `json:"bytes"`
+	SequenceHeaders int    `json:"sequence_headers"`
+	Keyframes       int    `json:"keyframes,omitempty"`
+
+	// Codec parameters from the sequence header, when they could be parsed.
+	Width      int `json:"width,omitempty"`
+	Height     int `json:"height,omitempty"`
+	Profile    int `json:"profile,omitempty"` // AVC profile_idc
+	Level      int `json:"level,omitempty"`   // AVC level_idc
+	SampleRate int `json:"sample_rate,omitempty"`
+	Channels   int `json:"channels,omitempty"`
+
+	// Timing, from the message timestamps.
+	FirstTimestamp     uint32  `json:"first_timestamp"`
+	LastTimestamp      uint32  `json:"last_timestamp"`
+	MinDeltaMs         int64   `json:"min_delta_ms"`
+	MaxDeltaMs         int64   `json:"max_delta_ms"`
+	Regressions        int     `json:"regressions"` // timestamps lower than the previous one
+	FrameRate          float64 `json:"frame_rate,omitempty"`
+	BitrateKbps        float64 `json:"bitrate_kbps,omitempty"`
+	KeyframeIntervalMs int64   `json:"keyframe_interval_ms,omitempty"` // average
+	// Speed is how fast timestamps advanced compared to the wall clock:
+	// 1 is real time, above 1 the encoder sends faster than real time.
+	Speed float64 `json:"speed,omitempty"`
+
+	started       bool // a non-sequence-header frame was seen
+	hasPrev       bool
+	prev          uint32
+	firstKey      uint32
+	lastKey       uint32
+	firstAt       time.Time
+	lastAt        time.Time
+	frames        int // messages other than sequence headers
+	missingHeader bool
+}
+
+// inspector builds the InspectReport of one connection. It is touched only
+// from the connection's read goroutine (header and message callbacks and
+// the disconnect handler), so it needs no locking.
+type inspector struct {
+	c         *iconn.Connection
+	report    InspectReport
+	csids     map[uint32]bool
+	published bool
+	warned    map[string]bool
+}
+
+// newInspector starts the report of c and installs its chunk header
+// handler. Call before c.Start.
+func newInspector(c *iconn.Connection) *inspector {
+	in := &inspector{
+		c: c,
+		report: InspectReport{
+			ConnID:      c.ID(),
+			Start:       c.AcceptedAt(),
+			HandshakeMs: c.HandshakeDuration().Milliseconds(),
+			Messages:    make(map[string]int),
+			Chunks:      InspectChunks{Formats: make(map[string][4]int), MaxChunkSize: 128},
+		},
+		csids:  make(map[uint32]bool),
+		warned: make(map[string]bool),
+	}
+	if addr := c.RemoteAddr(); addr != nil {
+		in.report.RemoteAddr = addr.String()
+	}
+	c.SetChunkHeaderHandler(in.header)
+	return in
+}
+
+// header counts a chunk header.
+func (in *inspector) header(h *chunk.ChunkHeader) {
+	ch := &in.report.Chunks
+	ch.Total++
+	name := messageTypeName(h.MessageTypeID)
+	f := ch.Formats[name]
+	f[h.FMT&3]++
+	ch.Formats[name] = f
+	if h.HasExtendedTimestamp {
+		ch.ExtendedTimestamps++
+	}
+	in.csids[h.CSID] = true
+}
+
+// message analyzes a complete message.
+func (in *inspector) message(m *chunk.Message) {
+	in.report.Messages[messageTypeName(m.TypeID)]++
+	at := time.Since(in.report.Start).Milliseconds()
+	switch m.TypeID {
+	case 8:
+		in.media(m, &in.report.Audio)
+	case 9:
+		in.media(m, &in.report.Video)
+	case 18:
+		in.data(m, at, m.Payload)
+	case 15:
+		if len(m.Payload) > 0 {
+			in.data(m, at, m.Payload[1:])
+		}
+	case 20, 17:
+		in.command(m, at)
+	case control.TypeSetChunkSize, control.TypeAbortMessage, control.TypeAcknowledgement,
+		control.TypeUserControl, control.TypeWindowAcknowledgement, control.TypeSetPeerBandwidth:
+		in.control(m, at)
+	default:
+		in.warn(fmt.Sprintf("unexpected message type %d", m.TypeID))
+	}
+}
+
+// command records a command message.
+func (in *inspector) command(m *chunk.Message, at int64) {
+	cmd := InspectCommand{AtMs: at, StreamID: m.MessageStreamID}
+	payload := m.Payload
+	if m.TypeID == 17 && len(payload) > 0 {
+		payload = payload[1:] // AMF3 command: a format byte, then AMF0 values
+	}
+	vals, err := amf.DecodeAll(payload)
+	if err != nil {
+		cmd.Error = err.Error()
+	}
+	if len(vals) > 0 {
+		cmd.Name, _ = vals[0].(string)
+	}
+	if len(vals) > 1 {
+		cmd.TransactionID, _ = vals[1].(float64)
+	}
+	if len(vals) > 2 {
+		cmd.Args = vals[2:]
+	}
+	if cmd.Name == "publish" {
+		in.published = true
+	}
+	if len(in.report.Commands) >= inspectMaxCommands {
+		in.report.Truncated++
+		return
+	}
+	in.report.Commands = append(in.report.Commands, cmd)
+}
+
+// control records a protocol control message.
+func (in *inspector) control(m *chunk.Message, at int64) {
+	v, err := control.Decode(m.TypeID, m.Payload)
+	ctl := InspectControl{AtMs: at, Type: messageTypeName(m.TypeID), Value: v}
+	if err != nil {
+		ctl.Error = err.Error()
+	}
+	if cs, ok := v.(*control.SetChunkSize); ok {
+		in.report.Chunks.MaxChunkSize = max(in.report.Chunks.MaxChunkSize, cs.Size)
+	}
+	if m.MessageStreamID != 0 || m.CSID != 2 {
+		in.warn(fmt.Sprintf("%s sent on chunk stream %d, message stream %d (expected 2 and 0)", ctl.Type, m.CSID, m.MessageStreamID))
+	}
+	if len(in.report.Control) >= inspectMaxControl {
+		in.report.Truncated++
+		return
+	}
+	in.report.Control = append(in.report.Control, ctl)
+}
+
+// data records a data message: onMetaData as the metadata, anything else
+// in the data list.
+func (in *inspector) data(m *chunk.Message, at int64, payload []byte) {
+	if props, ok := media.ParseOnMetaData(payload); ok {
+		if in.report.Metadata != nil {
+			in.warn("onMetaData sent more than once")
+		}
+		in.report.Metadata = props
+		return
+	}
+	vals, err := amf.DecodeAll(payload)
+	if err != nil || len(vals) == 0 {
+		in.warn(fmt.Sprintf("undecodable data message at timestamp %d", m.Timestamp))
+		return
+	}
+	d := InspectData{AtMs: at, Timestamp: m.Timestamp, Args: vals[1:]}
+	d.Name, _ = vals[0].(string)
+	if len(in.report.Data) >= inspectMaxData {
+		in.report.Truncated++
+		return
+	}
+	in.report.Data = append(in.report.Data, d)
+}
+
+// media updates a track's statistics with an audio or video message.
+func (in *inspector) media(m *chunk.Message, track **InspectTrack) {
+	kind := "audio"
+	if m.TypeID == 9 {
+		kind = "video"
+	}
+	if !in.published {
+		in.warn(kind + " sent before publish")
+	}
+	t := *track
+	if t == nil {
+		t = &InspectTrack{}
+		*track = t
+	}
+	now := time.Now()
+	t.Messages++
+	t.Bytes += uint64(len(m.Payload))
+	if t.firstAt.IsZero() {
+		t.firstAt = now
+	}
+	t.lastAt = now
+	if len(m.Payload) == 0 {
+		in.warn("empty " + kind + " message")
+		return
+	}
+
+	seqHeader := false
+	if m.TypeID == 9 {
+		if vm, err := media.ParseVideoMessage(m.Payload); err == nil {
+			t.Codec, t.Enhanced = vm.Codec, vm.Enhanced
+		}
+		seqHeader = media.IsVideoSequenceHeader(m.Payload)
+		if seqHeader {
+			t.Width, t.Height = media.ExtractVideoMetadata(m.Payload)
+			// Legacy AVC: the AVCDecoderConfigurationRecord follows the
+			// 5-byte tag header; bytes 1 and 3 are profile and level.
+			if m.Payload[0]&0x0F == 7 && len(m.Payload) >= 9 {
+				t.Profile, t.Level = int(m.Payload[6]), int(m.Payload[8])
+			}
+		} else if media.IsVideoKeyframe(m.Payload) {
+			if t.Keyframes == 0 {
+				t.firstKey = m.Timestamp
+			}
+			t.lastKey = m.Timestamp
+			t.Keyframes++
+		}
+	} else {
+		if am, err := media.ParseAudioMessage(m.Payload); err == nil {
+			t.Codec, t.Enhanced = am.Codec, am.Enhanced
+		}
+		seqHeader = media.IsAudioSequenceHeader(m.Payload)
+		if seqHeader {
+			t.SampleRate, t.Channels, _ = media.ExtractAudioMetadata(m.Payload)
+		}
+	}
+	if seqHeader {
+		t.SequenceHeaders++
+		return
+	}
+
+	if !t.started {
+		t.started = true
+		t.FirstTimestamp = m.Timestamp
+		if t.SequenceHeaders == 0 && needsSequenceHeader(t.Codec) {
+			t.missingHeader = true
+			in.warn(fmt.Sprintf("first %s frame (%s) sent before any sequence header", kind, t.Codec))
+		}
+		if m.TypeID == 9 && !media.IsVideoKeyframe(m.Payload) {
+			in.warn("video starts with an inter frame, not a keyframe")
+		}
+	}
+	t.frames++
+	if t.hasPrev {
+		delta := int64(m.Timestamp) - int64(t.prev)
+		if delta < 0 {
+			t.Regressions++
+			in.warn(fmt.Sprintf("%s timestamp went backwards (%d after %d)", kind, m.Timestamp, t.prev))
+		}
+		if t.frames == 2 || delta < t.MinDeltaMs {
+			t.MinDeltaMs = delta
+		}
+		if t.frames == 2 || delta > t.MaxDeltaMs {
+			t.MaxDeltaMs = delta
+		}
+	}
+	t.hasPrev, t.prev = true, m.Timestamp
+	t.LastTimestamp = max(t.LastTimestamp, m.Timestamp)
+}
+
+// needsSequenceHeader reports whether codec frames cannot be decoded
+// without a sequence header carrying the decoder configuration.
+func needsSequenceHeader(codec string) bool {
+	switch codec {
+	case media.VideoCodecAVC, media.VideoCodecHEVC, media.VideoCodecAV1, media.VideoCodecVVC, media.AudioCodecAAC:
+		return true
+	}
+	return false
+}
+
+// warn adds a warning once.
+func (in *inspector) warn(msg string) {
+	if in.warned[msg] {
+		return
+	}
+	in.warned[msg] = true
+	if len(in.report.Warnings) >= inspectMaxWarnings {
+		in.report.Truncated++
+		return
+	}
+	in.report.Warnings = append(in.report.Warnings, msg)
+}
+
+// finish completes and returns the report.
+func (in *inspector) finish() *InspectReport {
+	r := &in.report
+	r.DurationSec = time.Since(r.Start).Seconds()
+	r.BytesRead = in.c.BytesRead()
+	for csid := range in.csids {
+		r.Chunks.ChunkStreams = append(r.Chunks.ChunkStreams, csid)
+	}
+	sort.Slice(r.Chunks.ChunkStreams, func(i, j int) bool { return r.Chunks.ChunkStreams[i] < r.Chunks.ChunkStreams[j] })
+	for _, t := range []*InspectTrack{r.Video, r.Audio} {
+		if t == nil || !t.started {
+			continue
+		}
+		if span := t.LastTimestamp - t.FirstTimestamp; span > 0 {
+			secs := float64(span) / 1000
+			if t == r.Video {
+				t.FrameRate = round2(float64(t.frames-1) / secs)
+			}
+			t.BitrateKbps = round2(float64(t.Bytes) * 8 / 1000 / secs)
+			if wall := t.lastAt.Sub(t.firstAt).Seconds(); wall > 0 {
+				t.Speed = round2(secs / wall)
+			}
+		}
+		if t.Keyframes > 1 {
+			t.KeyframeIntervalMs = int64(t.lastKey-t.firstKey) / int64(t.Keyframes-1)
+		}
+	}
+	if r.Video != nil && r.Video.Keyframes == 0 && r.Video.started {
+		in.warn("no video keyframe received")
+	}
+	if r.Video == nil && r.Audio == nil && in.published {
+		in.warn("published but sent no media")
+	}
+	return r
+}
+
+// round2 rounds v to two decimals.
+func round2(v float64) float64 { return float64(int64(v*100+0.5)) / 100 }
+
+// messageTypeName names an RTMP message type for reports.
+func messageTypeName(id uint8) string {
+	switch id {
+	case control.TypeSetChunkSize:
+		return "set_chunk_size"
+	case control.TypeAbortMessage:
+		return "abort"
+	case control.TypeAcknowledgement:
+		return "acknowledgement"
+	case control.TypeUserControl:
+		return "user_control"
+	case control.TypeWindowAcknowledgement:
+		return "window_ack_size"
+	case control.TypeSetPeerBandwidth:
+		return "set_peer_bandwidth"
+	case 8:
+		return "audio"
+	case 9:
+		return "video"
+	case 15:
+		return "data_amf3"
+	case 16:
+		return "shared_object_amf3"
+	case 17:
+		return "command_amf3"
+	case 18:
+		return "data"
+	case 19:
+		return "shared_object"
+	case 20:
+		return "command"
+	case 22:
+		return "aggregate"
+	}
+	return fmt.Sprintf("type_%d", id)
+}
+
+// inspectPublish accepts a publish in inspect mode: the publisher is told
+// it is live, but the stream is not registered and its media is dropped.
+func inspectPublish(c *iconn.Connection, st *commandState, pc *rpc.PublishCommand, msg *chunk.Message, txnMode string) error {
+	if status, err := buildStatusReply(txnMode, msg, pc.StreamKey, rpc.CodePublishStart,
+		fmt.Sprintf("Publishing %s (inspect mode).", pc.StreamKey)); err == nil {
+		_ = c.SendMessage(status)
+	}
+	st.streams[msg.MessageStreamID] = &streamState{
+		id:        msg.MessageStreamID,
+		streamKey: pc.StreamKey,
+		role:      iconn.RolePublisher,
+		inspected: true,
+	}
+	return st.sess.Publish(msg.MessageStreamID, pc.StreamKey)
+}
+
+// reportInspection logs a connection's report and writes it to InspectDir.
+func (s *Server) reportInspection(r *InspectReport) {
+	log := s.log.With("conn_id", r.ConnID)
+	if dir := s.cfg.InspectDir; dir != "" {
+		path, err := writeInspectReport(dir, r)
+		if err != nil {
+			log.Error("inspect report not written", "error", err)
+		} else {
+			log.Info("inspect report written", "path", path, "warnings", len(r.Warnings))
+			return
+		}
+	}
+	log.Info("inspect report", "report", r)
+}
+
+// writeInspectReport writes r as indented JSON to a file in dir named
+// after the connection and its start time.
+func writeInspectReport(dir string, r *InspectReport) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("inspect dir: %w", err)
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		return "", fmt.Errorf("encode inspect report: %w", err)
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s.json", r.ConnID, r.Start.UTC().Format("20060102T150405")))
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
@@ -0,0 +1,118 @@
+// inspect_test.go – tests for inspect (protocol analyzer) mode.
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/alxayo/go-rtmp/internal/logger"
+	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
+)
+
+// TestInspectMode publishes the same key from two encoders, one well-formed
+// and one sending frames before its sequence header, and verifies both are
+// accepted without registering the stream and that each report describes
+// what its encoder sent.
+func TestInspectMode(t *testing.T) {
+	logger.UseWriter(io.Discard)
+	dir := t.TempDir()
+	s := New(Config{ListenAddr: "127.0.0.1:0", Inspect: true, InspectDir: dir})
+	if err := s.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer s.Stop()
+
+	seqHeader := []byte{0x17, 0x00, 0, 0, 0, 0x01, 0x64, 0x00, 0x1f}
+	keyframe := []byte{0x17, 0x01, 0, 0, 0, 0xAA}
+	inter := []byte{0x27, 0x01, 0, 0, 0, 0xBB}
+	meta, _ := amf.EncodeAll("@setDataFrame", "onMetaData", map[string]interface{}{"encoder": "test"})
+
+	good := connectTo(t, s, "live/probe")
+	if err := good.Publish(); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	watchMessages(good).waitStatus(t, "NetStream.Publish.Start")
+	_ = good.SendData(0, meta)
+	_ = good.SendVideo(0, seqHeader)
+	for i := uint32(0); i < 60; i++ {
+		frame := inter
+		if i%30 == 0 {
+			frame = keyframe
+		}
+		_ = good.SendVideo(i*40, frame)
+	}
+
+	bad := connectTo(t, s, "live/probe") // same key: accepted too
+	if err := bad.Publish(); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	watchMessages(bad).waitStatus(t, "NetStream.Publish.Start")
+	_ = bad.SendVideo(40, inter)
+	_ = bad.SendVideo(40, seqHeader)
+	_ = bad.SendVideo(20, keyframe)
+
+	if st := s.reg.GetStream("live/probe"); st != nil {
+		t.Fatal("inspected publish registered the stream")
+	}
+	good.Close()
+	bad.Close()
+
+	var reports []*InspectReport
+	waitFor(t, "inspect reports", func() bool {
+		files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+		return len(files) == 2
+	})
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatalf("read report: %v", err)
+		}
+		r := &InspectReport{}
+		if err := json.Unmarshal(b, r); err != nil {
+			t.Fatalf("decode %s: %v", f, err)
+		}
+		reports = append(reports, r)
+	}
+	slices.SortFunc(reports, func(a, b *InspectReport) int { return len(a.Warnings) - len(b.Warnings) })
+
+	r := reports[0]
+	var names []string
+	for _, c := range r.Commands {
+		names = append(names, c.Name)
+	}
+	if !slices.Equal(names, []string{"connect", "createStream", "publish"}) {
+		t.Fatalf("commands %v", names)
+	}
+	if app, _ := r.Commands[0].Args[0].(map[string]interface{}); app["app"] != "live" {
+		t.Fatalf("connect object %v", r.Commands[0].Args)
+	}
+	v := r.Video
+	if v == nil || v.Codec != "H264" || v.SequenceHeaders != 1 || v.Keyframes != 2 || v.Messages != 61 {
+		t.Fatalf("video track %+v", v)
+	}
+	if v.Profile != 100 || v.Level != 31 || v.MinDeltaMs != 40 || v.MaxDeltaMs != 40 || v.KeyframeIntervalMs != 1200 || v.FrameRate != 25 {
+		t.Fatalf("video parameters %+v", v)
+	}
+	if f := r.Chunks.Formats["video"]; f[0] == 0 || r.Messages["video"] != 61 {
+		t.Fatalf("video chunks %v, messages %v", f, r.Messages)
+	}
+	if r.Metadata["encoder"] != "test" || len(r.Warnings) != 0 {
+		t.Fatalf("metadata %v, warnings %v", r.Metadata, r.Warnings)
+	}
+
+	bw := reports[1].Warnings
+	for _, want := range []string{
+		"first video frame (H264) sent before any sequence header",
+		"video starts with an inter frame, not a keyframe",
+		"video timestamp went backwards (20 after 40)",
+	} {
+		if !slices.Contains(bw, want) {
+			t.Errorf("warnings %q lack %q", bw, want)
+		}
+	}
+}
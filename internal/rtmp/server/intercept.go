@@ -0,0 +1,143 @@
+package server
+
+// Message Interceptors
+// --------------------
+// Embedding applications can rewrite or drop what publishers send before
+// the server acts on it: strip or edit metadata, turn cue points into
+// onTextData captions, shift timestamps, or filter a track. An interceptor
+// is registered for the streams matching a pattern (Server.Intercept) and
+// sees each audio, video and data message published on them, in
+// registration order, after timestamp normalization and before the message
+// is broadcast, buffered for DVR, recorded, relayed or kept as metadata.
+//
+// Data messages other than onMetaData (onTextData, onCuePoint, ...) are
+// passed on to the stream's players after the interceptors ran; onMetaData
+// is kept for recordings as before.
+
+import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/media"
+	"github.com/alxayo/go-rtmp/internal/rtmp/server/hooks"
+)
+
+// MessageInterceptor inspects a published audio (8), video (9) or data (18)
+// message. It returns the message to pass on (m, changed in place, or a
+// replacement) or nil to drop it. It runs on the publisher's connection
+// goroutine and should return quickly. An interceptor that keeps m after
+// returning must take its own reference with m.Share().
+type MessageInterceptor func(m *chunk.Message) *chunk.Message
+
+// interceptor is one registered MessageInterceptor.
+type interceptor struct {
+	id    uint64
+	match *hooks.StreamMatcher // nil matches every stream
+	fn    MessageInterceptor
+}
+
+// interceptors is the registry's interceptor chain. The list is replaced on
+// every change, so the publishing path reads it without locking.
+type interceptors struct {
+	mu     sync.Mutex // serializes changes
+	nextID uint64
+	list   atomic.Pointer[[]interceptor]
+}
+
+// add appends fn to the chain and returns a function removing it.
+func (is *interceptors) add(match *hooks.StreamMatcher, fn MessageInterceptor) (remove func()) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	is.nextID++
+	id := is.nextID
+	var list []interceptor
+	if cur := is.list.Load(); cur != nil {
+		list = append(list, *cur...)
+	}
+	list = append(list, interceptor{id: id, match: match, fn: fn})
+	is.list.Store(&list)
+	return func() {
+		is.mu.Lock()
+		defer is.mu.Unlock()
+		var rest []interceptor
+		for _, ic := range *is.list.Load() {
+			if ic.id != id {
+				rest = append(rest, ic)
+			}
+		}
+		is.list.Store(&rest)
+	}
+}
+
+// apply runs the interceptors matching streamKey on m, stopping when one
+// drops it.
+func (is *interceptors) apply(streamKey string, m *chunk.Message) *chunk.Message {
+	list := is.list.Load()
+	if list == nil {
+		return m
+	}
+	for _, ic := range *list {
+		if m == nil {
+			break
+		}
+		if ic.match.Match(streamKey) {
+			m = ic.fn(m)
+		}
+	}
+	return m
+}
+
+// Intercept registers fn for the streams whose key matches pattern: a glob
+// such as "live/*" or a "~regexp", as for scoped hooks; "" matches every
+// stream. It applies to messages published after the call, including on
+// streams already live. remove unregisters fn.
+func (s *Server) Intercept(pattern string, fn MessageInterceptor) (remove func(), err error) {
+	var match *hooks.StreamMatcher
+	if pattern != "" {
+		if match, err = hooks.NewStreamMatcher(pattern); err != nil {
+			return nil, err
+		}
+	}
+	return s.reg.interceptors.add(match, fn), nil
+}
+
+// intercept runs the registry's interceptors for the stream on m.
+func (s *Stream) intercept(m *chunk.Message) *chunk.Message {
+	if s.interceptors == nil {
+		return m
+	}
+	return s.interceptors.apply(s.Key, m)
+}
+
+// publishData handles a data message (type 18) published on the stream:
+// onMetaData is kept for recordings, anything else (onTextData,
+// onCuePoint, ...) goes to the players, and cue points are also recorded.
+// It returns the message as the interceptors left it, for relay
+// destinations, or nil if they dropped it.
+func (s *Stream) publishData(m *chunk.Message, log *slog.Logger) *chunk.Message {
+	if s == nil {
+		return nil
+	}
+	if m = s.intercept(m); m == nil {
+		return nil
+	}
+	if props, ok := media.ParseOnMetaData(m.Payload); ok {
+		s.SetMetadata(props)
+		return m
+	}
+	s.BroadcastMessage(nil, m, log)
+	// Recorders keep cue points, and onFI timecodes when RecordTimecode
+	// is set.
+	if media.IsFrameInfo(m.Payload) {
+		s.mu.RLock()
+		record := s.RecordTimecode
+		s.mu.RUnlock()
+		if !record {
+			return m
+		}
+	}
+	s.writeRecording(m)
+	return m
+}
@@ -0,0 +1,148 @@
+// intercept_test.go – tests for message interceptors.
+package server
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/logger"
+	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/media"
+)
+
+// TestInterceptorChain verifies registration order, stream patterns,
+// dropping and removal.
+func TestInterceptorChain(t *testing.T) {
+	s := New(Config{ListenAddr: "127.0.0.1:0"})
+	var order []string
+	mark := func(name string) MessageInterceptor {
+		return func(m *chunk.Message) *chunk.Message { order = append(order, name); return m }
+	}
+	removeA, err := s.Intercept("", mark("a"))
+	if err != nil {
+		t.Fatalf("Intercept: %v", err)
+	}
+	if _, err := s.Intercept("live/*", mark("b")); err != nil {
+		t.Fatalf("Intercept: %v", err)
+	}
+	if _, err := s.Intercept("~^vod/", func(*chunk.Message) *chunk.Message { return nil }); err != nil {
+		t.Fatalf("Intercept: %v", err)
+	}
+	if _, err := s.Intercept("~(", mark("bad")); err == nil {
+		t.Fatal("invalid pattern accepted")
+	}
+
+	live, _ := s.reg.CreateStream("live/show")
+	vod, _ := s.reg.CreateStream("vod/film")
+	m := &chunk.Message{TypeID: 9}
+	if got := live.intercept(m); got != m || len(order) != 2 || order[0] != "a" || order[1] != "b" {
+		t.Fatalf("live/show: got %v, ran %v; want the message through a then b", got, order)
+	}
+	order = nil
+	if got := vod.intercept(m); got != nil || len(order) != 1 {
+		t.Fatalf("vod/film: got %v, ran %v; want a, then dropped", got, order)
+	}
+
+	order = nil
+	removeA()
+	live.intercept(m)
+	if len(order) != 1 || order[0] != "b" {
+		t.Fatalf("after remove ran %v, want b only", order)
+	}
+}
+
+// TestInterceptedPublishing publishes through an interceptor that drops
+// audio and rewrites video, and verifies players get the result.
+func TestInterceptedPublishing(t *testing.T) {
+	logger.UseWriter(io.Discard)
+	s := New(Config{ListenAddr: "127.0.0.1:0"})
+	if err := s.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer s.Stop()
+	if _, err := s.Intercept("live/*", func(m *chunk.Message) *chunk.Message {
+		if m.TypeID == 8 {
+			return nil
+		}
+		m.Timestamp += 1000
+		return m
+	}); err != nil {
+		t.Fatalf("Intercept: %v", err)
+	}
+
+	pub := connectTo(t, s, "live/overlay")
+	if err := pub.Publish(); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	waitFor(t, "publish", func() bool { return hasLivePublisher(s.reg, "live/overlay") })
+	player := playOn(t, s, "live/overlay")
+	defer player.c.Close()
+	player.waitStatus(t, "NetStream.Play.Start")
+
+	_ = pub.SendAudio(0, []byte{0xAF, 0x01, 0x21})
+	keyframe := []byte{0x17, 0x01, 0, 0, 0, 0xAA}
+	_ = pub.SendVideo(40, keyframe)
+	timeout := time.After(3 * time.Second)
+	for {
+		select {
+		case m, ok := <-player.msgs:
+			if !ok {
+				t.Fatal("player connection closed")
+			}
+			if m.TypeID == 8 {
+				t.Fatal("dropped audio reached the player")
+			}
+			if m.TypeID == 9 && bytes.Equal(m.Payload, keyframe) {
+				if m.Timestamp != 1040 {
+					t.Fatalf("video timestamp %d, want 1040 after the rewrite", m.Timestamp)
+				}
+				return
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for video")
+		}
+	}
+}
+
+// TestPublishData verifies data messages: onMetaData is kept for
+// recordings unless an interceptor strips it, other data messages reach
+// players.
+func TestPublishData(t *testing.T) {
+	s := New(Config{ListenAddr: "127.0.0.1:0"})
+	stream, _ := s.reg.CreateStream("live/captions")
+	sub := &lossySubscriber{id: "c000001", room: 10}
+	stream.AddSubscriber(sub)
+	data := func(vals ...interface{}) *chunk.Message {
+		p, err := amf.EncodeAll(vals...)
+		if err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+		return &chunk.Message{TypeID: 18, MessageStreamID: 1, Payload: p}
+	}
+
+	stream.publishData(data("@setDataFrame", "onMetaData", map[string]interface{}{"width": 1280.0}), logger.Logger())
+	if stream.Metadata["width"] != 1280.0 || len(sub.got) != 0 {
+		t.Fatalf("metadata %v, %d messages to the player; want it kept, not sent", stream.Metadata, len(sub.got))
+	}
+	stream.publishData(data("onTextData", map[string]interface{}{"text": "hello"}), logger.Logger())
+	if len(sub.got) != 1 || sub.got[0].TypeID != 18 {
+		t.Fatalf("player got %d messages, want the onTextData", len(sub.got))
+	}
+
+	stream.SetMetadata(nil)
+	if _, err := s.Intercept("", func(m *chunk.Message) *chunk.Message {
+		if _, ok := media.ParseOnMetaData(m.Payload); ok {
+			return nil // strip metadata
+		}
+		return m
+	}); err != nil {
+		t.Fatalf("Intercept: %v", err)
+	}
+	stream.publishData(data("@setDataFrame", "onMetaData", map[string]interface{}{"width": 1280.0}), logger.Logger())
+	if stream.Metadata != nil {
+		t.Fatalf("metadata %v kept, want it stripped", stream.Metadata)
+	}
+}
@@ -0,0 +1,221 @@
+package server
+
+// Origin Link
+// -----------
+// Config.LinkListenAddr serves the origin end of the link transport
+// (internal/rtmp/link) for edges and cluster nodes of this server. An edge
+// whose origin is a link://host:port URL, Config.OriginURL or a
+// ClusterNodeURL announced in the directory, pulls streams over it
+// (origin.go) instead of playing them over RTMP: no handshake, no AMF
+// commands and no chunking, only a request, a status and the messages.
+//
+// On the origin a link session is a player of the stream like any other:
+// it gets the cached sequence headers first, then every message the
+// registry broadcasts, including NetStream.Play.UnpublishNotify when the
+// publisher leaves. A session buffers Config.RelayQueueSize messages in
+// front of its writer; when the edge falls behind the registry drops
+// media for it as for a slow player. Requests must carry Config.LinkSecret
+// when one is set. Links serve the default host's streams.
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/link"
+)
+
+// errLinkQueueFull is returned by linkSession.SendMessage when the
+// session's queue has no room.
+var errLinkQueueFull = errors.New("link queue full")
+
+// linkSession is one edge's link to a stream on this server.
+type linkSession struct {
+	conn  net.Conn
+	queue chan *chunk.Message
+	done  chan struct{}
+	once  sync.Once
+}
+
+func newLinkSession(conn net.Conn, queueSize int) *linkSession {
+	return &linkSession{conn: conn, queue: make(chan *chunk.Message, queueSize), done: make(chan struct{})}
+}
+
+// SendMessage queues m for the edge without blocking.
+func (l *linkSession) SendMessage(m *chunk.Message) error {
+	if !l.TrySendMessage(m) {
+		return errLinkQueueFull
+	}
+	return nil
+}
+
+// TrySendMessage queues m for the edge, reporting false when the queue is
+// full or the session has ended.
+func (l *linkSession) TrySendMessage(m *chunk.Message) bool {
+	select {
+	case <-l.done:
+		return false
+	default:
+	}
+	select {
+	case l.queue <- m:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close ends the session and closes its connection.
+func (l *linkSession) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return l.conn.Close()
+}
+
+// write sends queued messages to the edge, flushing whenever the queue
+// runs empty, until the session ends or a write fails.
+func (l *linkSession) write() error {
+	w := bufio.NewWriterSize(l.conn, 64<<10)
+	for {
+		select {
+		case <-l.done:
+			return nil
+		case m := <-l.queue:
+			err := link.WriteMessage(w, m)
+			m.Release()
+			if err == nil && len(l.queue) == 0 {
+				err = w.Flush()
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// startLinkListener opens Config.LinkListenAddr and accepts link sessions
+// on it.
+func (s *Server) startLinkListener() error {
+	ln, err := net.Listen("tcp", s.cfg.LinkListenAddr)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.linkListener = ln
+	s.mu.Unlock()
+	s.logListenerInfo("link", ln)
+	s.acceptingWg.Add(1)
+	go s.acceptLinks(ln)
+	return nil
+}
+
+// acceptLinks serves each connection on ln until it is closed.
+func (s *Server) acceptLinks(ln net.Listener) {
+	defer s.acceptingWg.Done()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				s.log.Warn("link accept error (loop terminating)", "error", err)
+			}
+			return
+		}
+		go s.serveLink(conn)
+	}
+}
+
+// serveLink answers one link request and, when the stream is live, feeds
+// it to the edge until either side ends the session.
+func (s *Server) serveLink(conn net.Conn) {
+	log := s.log.With("component", "link", "remote", conn.RemoteAddr().String())
+	_ = conn.SetReadDeadline(time.Now().Add(originStartTimeout))
+	req, err := link.ReadRequest(conn)
+	if err != nil {
+		log.Warn("link request rejected", "error", err)
+		conn.Close()
+		return
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+	log = log.With("stream_key", req.StreamKey)
+
+	refuse := func(st link.Status, reason string) {
+		log.Warn("link request refused", "reason", reason)
+		_ = conn.SetWriteDeadline(time.Now().Add(originStartTimeout))
+		_ = link.WriteStatus(conn, st, reason)
+		conn.Close()
+	}
+	if s.cfg.LinkSecret != "" && subtle.ConstantTimeCompare([]byte(req.Secret), []byte(s.cfg.LinkSecret)) != 1 {
+		refuse(link.StatusRefused, "bad secret")
+		return
+	}
+	if err := s.keyPolicy.Check(req.StreamKey); err != nil {
+		refuse(link.StatusRefused, err.Error())
+		return
+	}
+	stream := s.reg.GetStream(req.StreamKey)
+	if stream.State() != StreamPublishing {
+		refuse(link.StatusNotFound, "no live publisher")
+		return
+	}
+
+	l := newLinkSession(conn, s.cfg.RelayQueueSize)
+	s.mu.Lock()
+	if s.closing {
+		s.mu.Unlock()
+		conn.Close()
+		return
+	}
+	if s.links == nil {
+		s.links = make(map[*linkSession]struct{})
+	}
+	s.links[l] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.links, l)
+		s.mu.Unlock()
+	}()
+
+	if err := link.WriteStatus(conn, link.StatusOK, ""); err != nil {
+		l.Close()
+		return
+	}
+	sendSequenceHeaders(l, stream, 1, req.StreamKey)
+	stream.AddStreamSubscriber(l, 1)
+	log.Info("link session started")
+
+	go func() {
+		if err := l.write(); err != nil {
+			log.Debug("link write failed", "error", err)
+		}
+		l.Close()
+	}()
+	// The edge sends nothing after its request; a read returns once it
+	// closes the connection or the session is closed here.
+	_, _ = io.Copy(io.Discard, conn)
+	l.Close()
+	stream.RemoveSubscriber(l)
+	log.Info("link session ended")
+}
+
+// closeLinks closes the link listener and every link session.
+func (s *Server) closeLinks() {
+	s.mu.Lock()
+	ln := s.linkListener
+	s.linkListener = nil
+	sessions := make([]*linkSession, 0, len(s.links))
+	for l := range s.links {
+		sessions = append(sessions, l)
+	}
+	s.mu.Unlock()
+	if ln != nil {
+		_ = ln.Close()
+	}
+	for _, l := range sessions {
+		_ = l.Close()
+	}
+}
@@ -0,0 +1,81 @@
+// link_test.go – tests for the origin link: an edge pulls a stream from a
+// link:// origin and the origin refuses requests without its secret.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/logger"
+	"github.com/alxayo/go-rtmp/internal/rtmp/client"
+	"github.com/alxayo/go-rtmp/internal/rtmp/link"
+)
+
+func TestOriginLink(t *testing.T) {
+	logger.UseWriter(io.Discard)
+	origin := New(Config{ListenAddr: "127.0.0.1:0", LinkListenAddr: "127.0.0.1:0", LinkSecret: "s3cret"})
+	if err := origin.Start(); err != nil {
+		t.Fatalf("start origin: %v", err)
+	}
+	defer origin.Stop()
+	waitFor(t, "link listener", func() bool {
+		origin.mu.RLock()
+		defer origin.mu.RUnlock()
+		return origin.linkListener != nil
+	})
+	origin.mu.RLock()
+	linkAddr := origin.linkListener.Addr().String()
+	origin.mu.RUnlock()
+
+	edge := New(Config{ListenAddr: "127.0.0.1:0", OriginURL: "link://" + linkAddr, LinkSecret: "s3cret"})
+	if err := edge.Start(); err != nil {
+		t.Fatalf("start edge: %v", err)
+	}
+	defer edge.Stop()
+
+	// Nothing is published yet: the origin answers not found.
+	missing := playOn(t, edge, "live/show")
+	missing.waitStatus(t, "NetStream.Play.StreamNotFound")
+	missing.c.Close()
+
+	pub, err := client.New(fmt.Sprintf("rtmp://%s/live/show", origin.Addr()))
+	if err != nil {
+		t.Fatalf("client.New: %v", err)
+	}
+	if err := pub.Connect(); err != nil {
+		t.Fatalf("connect publisher: %v", err)
+	}
+	defer pub.Close()
+	if err := pub.Publish(); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	waitFor(t, "origin publish", func() bool { return hasLivePublisher(origin.reg, "live/show") })
+	seqHeader := []byte{0x17, 0x00, 0, 0, 0, 0x01, 0x64, 0x00, 0x1f}
+	_ = pub.SendVideo(0, seqHeader)
+
+	player := playOn(t, edge, "live/show")
+	defer player.c.Close()
+	player.waitStatus(t, "NetStream.Play.Start")
+	player.waitVideo(t, seqHeader)
+	keyframe := []byte{0x17, 0x01, 0, 0, 0, 0xAA}
+	_ = pub.SendVideo(40, keyframe)
+	player.waitVideo(t, keyframe)
+	if n := origin.reg.GetStream("live/show").SubscriberCount(); n != 1 {
+		t.Fatalf("origin has %d players, want the edge's link", n)
+	}
+
+	// A request without the secret is refused.
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := link.Dial(ctx, linkAddr, link.Request{StreamKey: "live/show"}, nil); !errors.Is(err, link.ErrRefused) {
+		t.Fatalf("dial without secret: %v, want ErrRefused", err)
+	}
+
+	// The link ends with the last edge player.
+	player.c.Close()
+	waitFor(t, "link to end", func() bool { return origin.reg.GetStream("live/show").SubscriberCount() == 0 })
+}
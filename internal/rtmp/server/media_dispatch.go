@@ -5,14 +5,18 @@ package server
 // from the per-connection message handler installed by attachCommandHandling.
 
 import (
+	"context"
 	"log/slog"
 
 	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
 	"github.com/alxayo/go-rtmp/internal/rtmp/relay"
+	"github.com/alxayo/go-rtmp/internal/telemetry"
 )
 
 // dispatchMedia handles a single audio (TypeID 8) or video (TypeID 9)
-// message: logging, codec detection, recording, local broadcast, and external relay.
+// message of the publishing stream ss: interceptors, codec detection,
+// recording, local broadcast, and external relay. With a tracer, each
+// keyframe's dispatch is traced (see tracing.go).
 //
 // The ordering is important: codec detection (via BroadcastMessage) runs first
 // so that ensureRecorder can select the correct container format (FLV for H.264,
@@ -20,37 +24,62 @@ import (
 // codec detection, ensuring no format mismatch.
 func dispatchMedia(
 	m *chunk.Message,
-	st *commandState,
+	ss *streamState,
 	reg *Registry,
 	destMgr *relay.DestinationManager,
+	tracer *telemetry.Tracer,
 	log *slog.Logger,
 ) {
-	st.mediaLogger.ProcessMessage(m)
-
-	if st.streamKey == "" {
+	stream := reg.GetStream(ss.streamKey)
+	if stream == nil {
 		return
 	}
-	stream := reg.GetStream(st.streamKey)
-	if stream == nil {
+
+	// 0. Re-base the timestamp so every consumer below sees the same
+	// monotonic timeline.
+	if from := m.Timestamp; stream.NormalizeTimestamp(m) {
+		log.Info("timestamp discontinuity re-based", "stream_key", ss.streamKey, "from", from, "to", m.Timestamp)
+	}
+	// Registered interceptors may rewrite or drop the message.
+	if m = stream.intercept(m); m == nil {
 		return
 	}
 
+	f := classifyFrame(m)
+	ctx, span := context.Background(), (*telemetry.Span)(nil)
+	if f.keyframe {
+		ctx, span = tracer.Start(ctx, "rtmp.keyframe",
+			telemetry.String("rtmp.stream_key", ss.streamKey),
+			telemetry.Bool("rtmp.sequence_header", f.seqHeader),
+			telemetry.Int("rtmp.timestamp", int64(m.Timestamp)),
+			telemetry.Int("rtmp.payload_bytes", int64(len(m.Payload))),
+		)
+		defer span.End()
+	}
+
 	// 1. Codec detection + subscriber broadcast first.
 	// BroadcastMessage performs one-shot codec detection (setting stream.VideoCodec
 	// and stream.AudioCodec) and fans out the frame to all subscribers.
-	stream.BroadcastMessage(st.codecDetector, m, log)
+	_, bspan := telemetry.Start(ctx, "rtmp.broadcast")
+	stream.BroadcastMessage(ss.codecDetector, m, log)
+	subscribers := stream.SubscriberCount()
+	bspan.SetAttributes(telemetry.Int("rtmp.subscribers", int64(subscribers)))
+	bspan.End()
+	ss.observeGoLive(m, f, subscribers)
 
 	// 2. Lazy recorder initialization — creates the recorder once the video codec
 	// is known, selecting the correct container format automatically.
 	ensureRecorder(stream, log)
 
 	// 3. Write to recorder (snapshot under lock to avoid race with teardown).
-	if rec := stream.GetRecorder(); rec != nil {
-		rec.WriteMessage(m)
+	if stream.GetRecorder() != nil {
+		_, rspan := telemetry.Start(ctx, "rtmp.record")
+		stream.writeRecording(m)
+		rspan.End()
 	}
 
 	// 4. Forward to external relay destinations.
 	if destMgr != nil {
-		destMgr.RelayMessage(m)
+		destMgr.RelayStreamMessageContext(ctx, ss.streamKey, m)
 	}
 }
@@ -0,0 +1,112 @@
+package server
+
+// Audio-only and Video-only Playback
+// ----------------------------------
+// A player can ask for one track of a stream, e.g. an audio dashboard or a
+// low-bandwidth monitor that does not need the video:
+//
+//	rtmp://host/live/show?media=audio   audio and data messages only
+//	rtmp://host/live/show?media=video   video and data messages only
+//
+// Players can also switch a track off and on while playing with the
+// standard receiveAudio / receiveVideo commands. Each subscriber's
+// MediaFilter is kept in its Stream and applied by BroadcastMessage and by
+// DVR playback; the skipped messages are neither sent nor counted as
+// drops. A track switched back on restarts cleanly: video waits for the
+// next keyframe and both tracks get the cached sequence header first.
+// Recorded (VOD) playback always sends both tracks.
+
+import (
+	"fmt"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/media"
+)
+
+// MediaFilter selects the tracks delivered to one subscriber. The zero
+// value delivers everything.
+type MediaFilter struct {
+	NoAudio bool // skip audio messages
+	NoVideo bool // skip video messages
+}
+
+// ParseMediaFilter parses the media play query parameter: "audio" (audio
+// only), "video" (video only), or "all" or empty (both).
+func ParseMediaFilter(v string) (MediaFilter, error) {
+	switch v {
+	case "", "all":
+		return MediaFilter{}, nil
+	case "audio":
+		return MediaFilter{NoVideo: true}, nil
+	case "video":
+		return MediaFilter{NoAudio: true}, nil
+	}
+	return MediaFilter{}, fmt.Errorf("media %q: want audio, video or all", v)
+}
+
+// String returns the filter as a media query value.
+func (f MediaFilter) String() string {
+	switch {
+	case f.NoAudio && f.NoVideo:
+		return "none"
+	case f.NoVideo:
+		return "audio"
+	case f.NoAudio:
+		return "video"
+	}
+	return "all"
+}
+
+// skips reports whether messages of type typeID are filtered out. Data
+// messages always pass.
+func (f MediaFilter) skips(typeID uint8) bool {
+	return (typeID == 8 && f.NoAudio) || (typeID == 9 && f.NoVideo)
+}
+
+// SetSubscriberMedia sets the tracks delivered to sub. A track switched
+// back on resumes with its sequence header, video at the next keyframe
+// (using the resume state of ResumeSubscriber). It may be called before sub
+// is added, so that no message slips through.
+func (s *Stream) SetSubscriberMedia(sub media.Subscriber, f MediaFilter) {
+	if s == nil || sub == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev := s.subMedia[sub]
+	if f == (MediaFilter{}) {
+		delete(s.subMedia, sub)
+	} else {
+		if s.subMedia == nil {
+			s.subMedia = make(map[media.Subscriber]MediaFilter)
+		}
+		s.subMedia[sub] = f
+	}
+	if prev.NoVideo && !f.NoVideo {
+		if s.pausedSubs == nil {
+			s.pausedSubs = make(map[media.Subscriber]bool)
+		}
+		if _, paused := s.pausedSubs[sub]; !paused {
+			s.pausedSubs[sub] = false // wait for a keyframe
+		}
+	}
+	c := s.dropCounters[sub]
+	if c == nil {
+		return
+	}
+	if prev.NoVideo && !f.NoVideo {
+		c.videoHeaderLost.Store(true)
+	}
+	if prev.NoAudio && !f.NoAudio {
+		c.audioHeaderLost.Store(true)
+	}
+}
+
+// SubscriberMedia returns the tracks delivered to sub.
+func (s *Stream) SubscriberMedia(sub media.Subscriber) MediaFilter {
+	if s == nil || sub == nil {
+		return MediaFilter{}
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.subMedia[sub]
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"io"
+	"testing"
+
+	"github.com/alxayo/go-rtmp/internal/logger"
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+)
+
+func TestParseMediaFilter(t *testing.T) {
+	for in, want := range map[string]MediaFilter{
+		"":      {},
+		"all":   {},
+		"audio": {NoVideo: true},
+		"video": {NoAudio: true},
+	} {
+		got, err := ParseMediaFilter(in)
+		if err != nil || got != want {
+			t.Errorf("ParseMediaFilter(%q) = %+v, %v; want %+v", in, got, err, want)
+		}
+	}
+	if _, err := ParseMediaFilter("subtitles"); err == nil {
+		t.Error("ParseMediaFilter accepted an unknown track")
+	}
+}
+
+// TestBroadcastMessage_MediaFilter plays a stream audio-only, then switches
+// video back on and checks it restarts at a keyframe after its sequence
+// header.
+func TestBroadcastMessage_MediaFilter(t *testing.T) {
+	logger.UseWriter(io.Discard)
+	reg := NewRegistry()
+	s, _ := reg.CreateStream("app/radio")
+	if err := s.SetPublisher(&stubPublisher{}); err != nil {
+		t.Fatalf("set publisher: %v", err)
+	}
+	audioHdr := &chunk.Message{TypeID: 8, Payload: []byte{0xAF, 0x00, 0x12, 0x10}}
+	videoHdr := &chunk.Message{TypeID: 9, Payload: []byte{0x17, 0x00, 0, 0, 0, 0x01}}
+	audio := &chunk.Message{TypeID: 8, Payload: []byte{0xAF, 0x01, 0x21}}
+	keyframe := &chunk.Message{TypeID: 9, Payload: []byte{0x17, 0x01, 0, 0, 0, 0xAA}}
+	inter := &chunk.Message{TypeID: 9, Payload: []byte{0x27, 0x01, 0, 0, 0, 0xBB}}
+	data := &chunk.Message{TypeID: 18, Payload: []byte{0x02, 0x00, 0x01, 'x'}}
+	s.BroadcastMessage(nil, audioHdr, logger.Logger())
+	s.BroadcastMessage(nil, videoHdr, logger.Logger())
+
+	conn := &capturingConn{}
+	if _, err := HandlePlay(reg, conn, "app", buildPlayMessage("radio?media=audio")); err != nil {
+		t.Fatalf("play: %v", err)
+	}
+	// StreamBegin, onStatus, then the audio sequence header only.
+	if len(conn.sent) != 3 || conn.sent[2].TypeID != 8 {
+		t.Fatalf("play sent %d messages, want StreamBegin, onStatus and the audio header", len(conn.sent))
+	}
+	conn.sent = nil
+
+	for _, m := range []*chunk.Message{keyframe, audio, inter, data} {
+		s.BroadcastMessage(nil, m, logger.Logger())
+	}
+	if len(conn.sent) != 2 || conn.sent[0].TypeID != 8 || conn.sent[1].TypeID != 18 {
+		t.Fatalf("audio-only subscriber got %d messages, want the audio frame and the data message", len(conn.sent))
+	}
+	if st, _ := s.SubscriberDrops(conn); st.Drops() != 0 {
+		t.Fatalf("filtered messages counted as drops: %+v", st)
+	}
+	conn.sent = nil
+
+	s.SetSubscriberMedia(conn, MediaFilter{})
+	for _, m := range []*chunk.Message{inter, audio, keyframe, inter} {
+		s.BroadcastMessage(nil, m, logger.Logger())
+	}
+	// The first inter frame is skipped; the keyframe follows the cached
+	// video sequence header.
+	want := []*chunk.Message{audio, videoHdr, keyframe, inter}
+	if len(conn.sent) != len(want) {
+		t.Fatalf("after switching video on got %d messages, want %d", len(conn.sent), len(want))
+	}
+	for i, m := range conn.sent {
+		if string(m.Payload) != string(want[i].Payload) {
+			t.Fatalf("message %d = % x, want % x", i, m.Payload, want[i].Payload)
+		}
+	}
+	if s.SubscriberMedia(conn) != (MediaFilter{}) || len(s.subMedia) != 0 {
+		t.Fatalf("filter not cleared: %+v", s.subMedia)
+	}
+}
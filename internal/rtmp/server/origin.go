@@ -0,0 +1,352 @@
+package server
+
+// Origin/Edge Replication
+// -----------------------
+// With Config.OriginURL set the server is an edge: a play request for a
+// stream key that has no local publisher is served by pulling the stream
+// from the origin server with the internal client and publishing it
+// locally. Every player of the key on this edge shares the one pull, so
+// playback scales out across edges while the origin sees one connection
+// per stream and edge.
+//
+// Each player holds a reference on the pull; when the last one leaves, the
+// pull stops and the origin connection is closed. If the origin has no
+// such stream, the player gets NetStream.Play.StreamNotFound as it would
+// locally. When the origin's publisher goes away the local stream ends
+// too, and resumes if the origin's stream comes back while players are
+// still attached. A local publisher on the key takes over from the pull.
+//
+// With a cluster directory configured (cluster.go) the pull goes to the
+// node that announces the stream instead, and Config.OriginURL is the
+// fallback for keys no node announces.
+//
+// An origin reached at a link:// URL is pulled over the link transport
+// (link.go) rather than played over RTMP; both deliver the same messages
+// to forward.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/client"
+	"github.com/alxayo/go-rtmp/internal/rtmp/link"
+	"github.com/alxayo/go-rtmp/internal/rtmp/media"
+	"github.com/alxayo/go-rtmp/internal/rtmp/rpc"
+)
+
+// originStartTimeout bounds connecting to the origin and waiting for its
+// answer to play.
+const originStartTimeout = 10 * time.Second
+
+// errOriginNotFound is returned when the origin has no live stream for the
+// requested key.
+var errOriginNotFound = errors.New("origin has no such stream")
+
+// messageSource is the origin connection of a pull: an RTMP client
+// playing the stream, or a link.Conn.
+type messageSource interface {
+	ReadMessage() (*chunk.Message, error)
+	Close() error
+}
+
+// originPull replicates one stream from the origin. It is the local
+// stream's publisher.
+type originPull struct {
+	key string
+	url string // the origin stream: origin server + "/" + key; set by runOriginPull
+	log *slog.Logger
+
+	refs int // players holding the pull; guarded by Server.mu
+
+	ready chan struct{} // closed once the pull is running or has failed
+	err   error         // why the pull failed; set before ready is closed
+	done  chan struct{} // closed when the pull has stopped
+
+	mu       sync.Mutex
+	conn     net.Conn // the origin connection, closed to stop the pull
+	stopped  bool
+	stream   *Stream
+	detector media.CodecDetector
+}
+
+func newOriginPull(key string, log *slog.Logger) *originPull {
+	return &originPull{
+		key:   key,
+		log:   log.With("stream_key", key),
+		ready: make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+}
+
+// setOrigin points the pull at the origin server originURL.
+func (p *originPull) setOrigin(originURL string) {
+	p.url = strings.TrimSuffix(originURL, "/") + "/" + p.key
+	p.log = p.log.With("origin", p.url)
+}
+
+// ID identifies the pull as a publisher in logs and stream snapshots.
+func (p *originPull) ID() string { return "origin:" + p.key }
+
+// Close stops the pull. It is called when a local publisher evicts it.
+func (p *originPull) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stopped = true
+	if p.conn != nil {
+		return p.conn.Close()
+	}
+	return nil
+}
+
+// dial opens the TCP connection to the origin and keeps it so Close can
+// interrupt the client's reads.
+func (p *originPull) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopped {
+		conn.Close()
+		return nil, net.ErrClosed
+	}
+	p.conn = conn
+	return conn, nil
+}
+
+// start connects to the origin and plays the stream, returning once the
+// origin has answered the play. linkSecret is sent to link:// origins.
+func (p *originPull) start(linkSecret string) (messageSource, error) {
+	if strings.HasPrefix(p.url, link.Scheme+"://") {
+		return p.startLink(linkSecret)
+	}
+	c, err := client.New(p.url)
+	if err != nil {
+		return nil, err
+	}
+	c.SetLogger(p.log)
+	c.DialContext = p.dial
+	c.ConnectTimeout = originStartTimeout
+	if err := c.Connect(); err != nil {
+		return nil, err
+	}
+	if err := c.Play(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	p.mu.Lock()
+	conn := p.conn
+	p.mu.Unlock()
+	_ = conn.SetReadDeadline(time.Now().Add(originStartTimeout))
+	for {
+		msg, err := c.ReadMessage()
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("waiting for play: %w", err)
+		}
+		switch statusCode(msg) {
+		case rpc.CodePlayStart:
+			_ = conn.SetReadDeadline(time.Time{})
+			return c, nil
+		case rpc.CodePlayStreamNotFound:
+			c.Close()
+			return nil, errOriginNotFound
+		case rpc.CodePlayFailed, rpc.CodePlayUnauthorized:
+			c.Close()
+			return nil, fmt.Errorf("origin refused play: %s", statusCode(msg))
+		}
+	}
+}
+
+// startLink requests the stream from a link:// origin.
+func (p *originPull) startLink(secret string) (messageSource, error) {
+	u, err := url.Parse(p.url)
+	if err != nil {
+		return nil, err
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), link.DefaultPort)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), originStartTimeout)
+	defer cancel()
+	c, err := link.Dial(ctx, addr, link.Request{StreamKey: p.key, Secret: secret}, p.dial)
+	if errors.Is(err, link.ErrNotFound) {
+		return nil, errOriginNotFound
+	}
+	return c, err
+}
+
+// forward publishes what the origin sends on the local stream until the
+// origin connection closes or a local publisher takes over.
+func (p *originPull) forward(c messageSource) error {
+	for {
+		msg, err := c.ReadMessage()
+		if err != nil {
+			return err
+		}
+		switch msg.TypeID {
+		case 8, 9:
+			if p.stream.State() != StreamPublishing {
+				// The origin's stream is back after an unpublish.
+				if err := p.stream.SetPublisher(p); err != nil {
+					return err
+				}
+				p.log.Info("origin stream republished")
+			}
+			if from := msg.Timestamp; p.stream.NormalizeTimestamp(msg) {
+				p.log.Debug("timestamp discontinuity re-based", "from", from, "to", msg.Timestamp)
+			}
+			if msg = p.stream.intercept(msg); msg != nil {
+				p.stream.BroadcastMessage(&p.detector, msg, p.log)
+			}
+		case 18:
+			p.stream.publishData(msg, p.log)
+		default:
+			if statusCode(msg) == rpc.CodePlayUnpublish && p.stream.EndPublish(p) {
+				p.log.Info("origin stream unpublished")
+			}
+		}
+	}
+}
+
+// statusCode returns the code of an onStatus command, or "".
+func statusCode(msg *chunk.Message) string {
+	if msg.TypeID != rpc.CommandMessageAMF0TypeIDForTest() {
+		return ""
+	}
+	vals, err := amf.DecodeAll(msg.Payload)
+	if err != nil || len(vals) < 4 {
+		return ""
+	}
+	if name, _ := vals[0].(string); name != "onStatus" {
+		return ""
+	}
+	info, _ := vals[3].(map[string]interface{})
+	code, _ := info["code"].(string)
+	return code
+}
+
+// runOriginPull starts p and forwards the origin stream until p is
+// stopped, the origin connection fails or a local publisher takes over.
+func (s *Server) runOriginPull(p *originPull) {
+	defer close(p.done)
+	defer s.forgetOriginPull(p)
+
+	origin, err := s.resolveOrigin(p.key)
+	var c messageSource
+	if err == nil {
+		p.setOrigin(origin)
+		c, err = p.start(s.cfg.LinkSecret)
+	}
+	if err == nil {
+		if p.stream, err = s.reg.PublishStream(p.key, p); err != nil {
+			c.Close()
+			err = fmt.Errorf("stream is published locally")
+		}
+	}
+	if err != nil {
+		p.err = err
+		close(p.ready)
+		p.log.Warn("origin pull failed", "error", err)
+		return
+	}
+	close(p.ready)
+	p.log.Info("origin pull started")
+
+	err = p.forward(c)
+	c.Close()
+	p.stream.EndPublish(p)
+	p.mu.Lock()
+	stopped := p.stopped
+	p.mu.Unlock()
+	if stopped {
+		p.log.Info("origin pull stopped")
+	} else {
+		p.log.Warn("origin pull ended", "error", err)
+	}
+}
+
+// forgetOriginPull removes p from the running pulls, so the next player
+// of its key starts a new one.
+func (s *Server) forgetOriginPull(p *originPull) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pulls[p.key] == p {
+		delete(s.pulls, p.key)
+	}
+}
+
+// acquireOriginPull returns the pull of key from the origin with a
+// reference held for the caller, starting the pull if needed, once it is
+// running. It returns nil, nil when the server is not an edge or key is
+// published locally. Release the reference with releaseOriginPull.
+func (s *Server) acquireOriginPull(key string) (*originPull, error) {
+	if s == nil || (s.cfg.OriginURL == "" && s.directory == nil) || s.isStreamAlias(key) {
+		return nil, nil
+	}
+	s.mu.Lock()
+	p := s.pulls[key]
+	if p == nil {
+		if s.closing || hasLivePublisher(s.reg, key) {
+			s.mu.Unlock()
+			return nil, nil
+		}
+		p = newOriginPull(key, s.log)
+		if s.pulls == nil {
+			s.pulls = make(map[string]*originPull)
+		}
+		s.pulls[key] = p
+		go s.runOriginPull(p)
+	}
+	p.refs++
+	s.mu.Unlock()
+
+	<-p.ready
+	if p.err != nil {
+		s.releaseOriginPull(p)
+		return nil, p.err
+	}
+	return p, nil
+}
+
+// releaseOriginPull drops a reference taken by acquireOriginPull. The last
+// one stops the pull and waits for it to end.
+func (s *Server) releaseOriginPull(p *originPull) {
+	s.mu.Lock()
+	p.refs--
+	last := p.refs == 0
+	if last && s.pulls[p.key] == p {
+		delete(s.pulls, p.key)
+	}
+	s.mu.Unlock()
+	if last {
+		_ = p.Close()
+		<-p.done
+	}
+}
+
+// stopOriginPulls stops every running pull, on shutdown.
+func (s *Server) stopOriginPulls() {
+	s.mu.Lock()
+	pulls := make([]*originPull, 0, len(s.pulls))
+	for _, p := range s.pulls {
+		pulls = append(pulls, p)
+	}
+	clear(s.pulls)
+	s.mu.Unlock()
+	for _, p := range pulls {
+		_ = p.Close()
+		<-p.done
+	}
+}
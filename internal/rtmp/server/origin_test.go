@@ -0,0 +1,160 @@
+// origin_test.go – tests for origin/edge replication: an edge server pulls
+// streams it does not have from the origin, once per stream, and stops
+// when its last player leaves.
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/logger"
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/client"
+)
+
+// edgePlayer is a client playing a stream, with its messages read in the
+// background.
+type edgePlayer struct {
+	c    *client.Client
+	msgs chan *chunk.Message
+}
+
+func playOn(t *testing.T, s *Server, key string) *edgePlayer {
+	t.Helper()
+	c, err := client.New(fmt.Sprintf("rtmp://%s/%s", s.Addr(), key))
+	if err != nil {
+		t.Fatalf("client.New: %v", err)
+	}
+	if err := c.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if err := c.Play(); err != nil {
+		t.Fatalf("play: %v", err)
+	}
+	return watchMessages(c)
+}
+
+// watchMessages reads c's messages in the background.
+func watchMessages(c *client.Client) *edgePlayer {
+	p := &edgePlayer{c: c, msgs: make(chan *chunk.Message, 64)}
+	go func() {
+		defer close(p.msgs)
+		for {
+			msg, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			p.msgs <- msg
+		}
+	}()
+	return p
+}
+
+// waitStatus waits for an onStatus with code.
+func (p *edgePlayer) waitStatus(t *testing.T, code string) {
+	t.Helper()
+	p.wait(t, code, func(m *chunk.Message) bool { return statusCode(m) == code })
+}
+
+// waitVideo waits for a video message with payload.
+func (p *edgePlayer) waitVideo(t *testing.T, payload []byte) {
+	t.Helper()
+	p.wait(t, "video", func(m *chunk.Message) bool { return m.TypeID == 9 && bytes.Equal(m.Payload, payload) })
+}
+
+func (p *edgePlayer) wait(t *testing.T, what string, match func(*chunk.Message) bool) {
+	t.Helper()
+	timeout := time.After(3 * time.Second)
+	for {
+		select {
+		case m, ok := <-p.msgs:
+			if !ok {
+				t.Fatalf("connection closed waiting for %s", what)
+			}
+			if match(m) {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+// waitFor polls cond for up to 3s.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestOriginPull(t *testing.T) {
+	logger.UseWriter(io.Discard)
+	origin := New(Config{ListenAddr: "127.0.0.1:0"})
+	if err := origin.Start(); err != nil {
+		t.Fatalf("start origin: %v", err)
+	}
+	defer origin.Stop()
+	edge := New(Config{ListenAddr: "127.0.0.1:0", OriginURL: "rtmp://" + origin.Addr().String()})
+	if err := edge.Start(); err != nil {
+		t.Fatalf("start edge: %v", err)
+	}
+	defer edge.Stop()
+
+	pub, err := client.New(fmt.Sprintf("rtmp://%s/live/show", origin.Addr()))
+	if err != nil {
+		t.Fatalf("client.New: %v", err)
+	}
+	if err := pub.Connect(); err != nil {
+		t.Fatalf("connect publisher: %v", err)
+	}
+	defer pub.Close()
+	if err := pub.Publish(); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	waitFor(t, "origin publish", func() bool { return hasLivePublisher(origin.reg, "live/show") })
+	seqHeader := []byte{0x17, 0x00, 0, 0, 0, 0x01, 0x64, 0x00, 0x1f}
+	_ = pub.SendVideo(0, seqHeader)
+
+	// Two players on the edge share one pull: the origin sees one player.
+	first := playOn(t, edge, "live/show")
+	first.waitStatus(t, "NetStream.Play.Start")
+	first.waitVideo(t, seqHeader) // cached on the origin, relayed by the edge
+	second := playOn(t, edge, "live/show")
+	second.waitStatus(t, "NetStream.Play.Start")
+	if n := origin.reg.GetStream("live/show").SubscriberCount(); n != 1 {
+		t.Fatalf("origin has %d players, want the edge's one pull", n)
+	}
+
+	keyframe := []byte{0x17, 0x01, 0, 0, 0, 0xAA}
+	_ = pub.SendVideo(40, keyframe)
+	first.waitVideo(t, keyframe)
+	second.waitVideo(t, keyframe)
+
+	// The pull lasts until the last edge player leaves.
+	first.c.Close()
+	time.Sleep(100 * time.Millisecond)
+	if n := origin.reg.GetStream("live/show").SubscriberCount(); n != 1 {
+		t.Fatalf("origin has %d players after one of two left, want 1", n)
+	}
+	second.c.Close()
+	waitFor(t, "pull to stop", func() bool { return origin.reg.GetStream("live/show").SubscriberCount() == 0 })
+	edge.mu.RLock()
+	pulls := len(edge.pulls)
+	edge.mu.RUnlock()
+	if pulls != 0 {
+		t.Fatalf("%d pulls still running", pulls)
+	}
+
+	// A stream the origin does not have is not found on the edge either.
+	missing := playOn(t, edge, "live/missing")
+	defer missing.c.Close()
+	missing.waitStatus(t, "NetStream.Play.StreamNotFound")
+}
@@ -0,0 +1,67 @@
+// play_auth_test.go – tests for play authentication separate from publish
+// authentication, with per-token session limits.
+package server
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/logger"
+	"github.com/alxayo/go-rtmp/internal/rtmp/server/auth"
+)
+
+// TestPlayAuthValidator checks that plays go through PlayAuthValidator,
+// not the publish secret, and that a viewer token limited to one session
+// refuses a second player until the first has stopped.
+func TestPlayAuthValidator(t *testing.T) {
+	logger.UseWriter(io.Discard)
+	viewers := auth.NewViewerTokenValidator([]auth.ViewerToken{{Token: "v1", StreamKey: "live/show", MaxSessions: 1}})
+	s := New(Config{
+		ListenAddr:        "127.0.0.1:0",
+		AuthValidator:     &auth.TokenValidator{Tokens: map[string]string{"live/show": "pub"}},
+		PlayAuthValidator: viewers,
+	})
+	if err := s.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer s.Stop()
+
+	pub := connectTo(t, s, "live/show?token=pub")
+	if err := pub.Publish(); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	waitFor(t, "publish", func() bool { return hasLivePublisher(s.reg, "live/show") })
+
+	play := func(key string) *edgePlayer {
+		c := connectTo(t, s, key)
+		if err := c.Play(); err != nil {
+			t.Fatalf("play: %v", err)
+		}
+		return watchMessages(c)
+	}
+
+	t.Run("publish secret does not play", func(t *testing.T) {
+		p := play("live/show?token=pub")
+		p.waitStatus(t, "NetStream.Play.Unauthorized")
+		if p.open(3 * time.Second) {
+			t.Fatalf("connection still open after failed play authentication")
+		}
+	})
+
+	first := play("live/show?token=v1")
+	first.waitStatus(t, "NetStream.Play.Start")
+	if n := viewers.ActiveSessions("v1"); n != 1 {
+		t.Fatalf("sessions after first play = %d, want 1", n)
+	}
+
+	second := play("live/show?token=v1")
+	second.waitStatus(t, "NetStream.Play.Failed")
+	if !second.open(200 * time.Millisecond) {
+		t.Fatalf("connection closed after the session limit refused a play")
+	}
+
+	first.c.Close()
+	waitFor(t, "session release", func() bool { return viewers.ActiveSessions("v1") == 0 })
+	play("live/show?token=v1").waitStatus(t, "NetStream.Play.Start")
+}
@@ -9,11 +9,11 @@ package server
 // onStatus message (already sent) for test assertions.
 
 import (
+	"errors"
 	"fmt"
 
 	rtmperrors "github.com/alxayo/go-rtmp/internal/errors"
 	"github.com/alxayo/go-rtmp/internal/logger"
-	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
 	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
 	"github.com/alxayo/go-rtmp/internal/rtmp/control"
 	"github.com/alxayo/go-rtmp/internal/rtmp/rpc"
@@ -26,6 +26,8 @@ import (
 //  2. onStatus NetStream.Play.Start
 //
 // Only the final onStatus (either StreamNotFound or Play.Start) is returned.
+// A stream at its subscriber limit (Registry.SetSubscriberLimit) sends
+// nothing and returns ErrSubscriberLimit.
 func HandlePlay(reg *Registry, conn sender, app string, msg *chunk.Message) (*chunk.Message, error) {
 	if reg == nil || conn == nil || msg == nil {
 		return nil, rtmperrors.NewProtocolError("play.handle", fmt.Errorf("nil argument"))
@@ -40,21 +42,37 @@ func HandlePlay(reg *Registry, conn sender, app string, msg *chunk.Message) (*ch
 	log := logger.Logger().With("component", "rtmp_server")
 	log.Info("play command", "stream_key", pcmd.StreamKey)
 
-	stream := reg.GetStream(pcmd.StreamKey)
-	if stream == nil || stream.Publisher == nil { // not found or no active publisher
-		// Build and send StreamNotFound onStatus (dependency T039 pattern - inline builder).
-		log.Warn("play command failed - stream not found or no publisher", "stream_key", pcmd.StreamKey)
-		notFound, _ := buildOnStatus(msg.MessageStreamID, pcmd.StreamKey, "NetStream.Play.StreamNotFound", fmt.Sprintf("Stream %s not found.", pcmd.StreamKey))
-		_ = conn.SendMessage(notFound)
-		return notFound, nil
-	}
+	var stream *Stream
+	for {
+		stream = reg.GetStream(pcmd.StreamKey)
+		if stream.State() != StreamPublishing { // not found, not yet published or ended
+			// Build and send StreamNotFound onStatus (dependency T039 pattern - inline builder).
+			log.Warn("play command failed - stream not found or no publisher", "stream_key", pcmd.StreamKey)
+			notFound, _ := buildStatusReply(reg.statusTxnMode(), msg, pcmd.StreamKey, "NetStream.Play.StreamNotFound", fmt.Sprintf("Stream %s not found.", pcmd.StreamKey))
+			_ = conn.SendMessage(notFound)
+			return notFound, nil
+		}
 
-	// Add subscriber.
-	sub, ok := conn.(interface{ SendMessage(*chunk.Message) error })
-	if !ok {
-		return nil, rtmperrors.NewProtocolError("play.handle", fmt.Errorf("connection does not implement Subscriber interface"))
+		// Add subscriber.
+		sub, ok := conn.(interface{ SendMessage(*chunk.Message) error })
+		if !ok {
+			return nil, rtmperrors.NewProtocolError("play.handle", fmt.Errorf("connection does not implement Subscriber interface"))
+		}
+		// Track selection (?media=audio|video) applies from the first message.
+		if filter, err := ParseMediaFilter(pcmd.QueryParams["media"]); err == nil {
+			stream.SetSubscriberMedia(sub, filter)
+		}
+		err := stream.addStreamSubscriberLimit(sub, msg.MessageStreamID, reg.subscriberLimit(app), false)
+		if err == nil {
+			break
+		}
+		stream.RemoveSubscriber(sub) // forget the media filter
+		if errors.Is(err, ErrStreamCollected) {
+			continue // collected since the lookup; look the key up again
+		}
+		log.Warn("play refused - subscriber limit reached", "stream_key", pcmd.StreamKey, "subscribers", stream.SubscriberCount())
+		return nil, ErrSubscriberLimit
 	}
-	stream.AddSubscriber(sub)
 	log.Info("Subscriber added", "stream_key", pcmd.StreamKey, "total_subscribers", len(stream.Subscribers))
 
 	// 1. User Control Stream Begin (event 0) with the play command's message stream id.
@@ -62,14 +80,23 @@ func HandlePlay(reg *Registry, conn sender, app string, msg *chunk.Message) (*ch
 	_ = conn.SendMessage(uc)
 
 	// 2. onStatus NetStream.Play.Start
-	started, err := buildOnStatus(msg.MessageStreamID, pcmd.StreamKey, "NetStream.Play.Start", fmt.Sprintf("Started playing %s.", pcmd.StreamKey))
+	started, err := buildStatusReply(reg.statusTxnMode(), msg, pcmd.StreamKey, "NetStream.Play.Start", fmt.Sprintf("Started playing %s.", pcmd.StreamKey))
 	if err != nil {
 		return nil, rtmperrors.NewProtocolError("play.handle.encode", err)
 	}
 	_ = conn.SendMessage(started)
 
 	// 3. Send cached sequence headers to late-joining subscriber.
-	//
+	sendSequenceHeaders(conn, stream, msg.MessageStreamID, pcmd.StreamKey)
+
+	return started, nil
+}
+
+// sendSequenceHeaders sends stream's cached sequence headers to a player
+// starting on streamID.
+func sendSequenceHeaders(conn sender, stream *Stream, streamID uint32, streamKey string) {
+	log := logger.Logger().With("component", "rtmp_server")
+
 	// WHY: When a viewer joins a live stream that's already in progress, their
 	// video/audio decoder needs initialization data before it can process any
 	// media frames. For H.264 video, this is the SPS/PPS (Sequence Parameter Set /
@@ -109,21 +136,30 @@ func HandlePlay(reg *Registry, conn sender, app string, msg *chunk.Message) (*ch
 			extraAudioTracks[k] = cp
 		}
 	}
+	filter := stream.subMedia[conn]
 	stream.mu.RUnlock()
 
+	// A track the player opted out of gets no header (media_filter.go).
+	if filter.NoAudio {
+		audioSeqHdr, extraAudioTracks = nil, nil
+	}
+	if filter.NoVideo {
+		videoSeqHdr, extraVideoTracks = nil, nil
+	}
+
 	if audioSeqHdr != nil {
 		// Clone the cached audio sequence header with the subscriber's message stream ID
 		audioMsg := &chunk.Message{
 			CSID:            audioSeqHdr.CSID,
 			TypeID:          audioSeqHdr.TypeID,
 			Timestamp:       0, // Sequence headers always use timestamp 0
-			MessageStreamID: msg.MessageStreamID,
+			MessageStreamID: streamID,
 			MessageLength:   audioSeqHdr.MessageLength,
 			Payload:         make([]byte, len(audioSeqHdr.Payload)),
 		}
 		copy(audioMsg.Payload, audioSeqHdr.Payload)
 		_ = conn.SendMessage(audioMsg)
-		log.Info("Sent cached audio sequence header to subscriber", "stream_key", pcmd.StreamKey, "size", len(audioMsg.Payload))
+		log.Info("Sent cached audio sequence header to subscriber", "stream_key", streamKey, "size", len(audioMsg.Payload))
 	}
 
 	if videoSeqHdr != nil {
@@ -132,16 +168,16 @@ func HandlePlay(reg *Registry, conn sender, app string, msg *chunk.Message) (*ch
 			CSID:            videoSeqHdr.CSID,
 			TypeID:          videoSeqHdr.TypeID,
 			Timestamp:       0, // Sequence headers always use timestamp 0
-			MessageStreamID: msg.MessageStreamID,
+			MessageStreamID: streamID,
 			MessageLength:   videoSeqHdr.MessageLength,
 			Payload:         make([]byte, len(videoSeqHdr.Payload)),
 		}
 		copy(videoMsg.Payload, videoSeqHdr.Payload)
 		_ = conn.SendMessage(videoMsg)
-		log.Info("Sent cached video sequence header to subscriber", "stream_key", pcmd.StreamKey, "size", len(videoMsg.Payload))
+		log.Info("Sent cached video sequence header to subscriber", "stream_key", streamKey, "size", len(videoMsg.Payload))
 	}
 
-	// 4. Send per-track multitrack sequence headers for non-zero tracks.
+	// Send per-track multitrack sequence headers for non-zero tracks.
 	//
 	// Multitrack E-RTMP streams carry multiple audio/video tracks (e.g.,
 	// multiple camera angles or language tracks). Each track has its own
@@ -153,13 +189,13 @@ func HandlePlay(reg *Registry, conn sender, app string, msg *chunk.Message) (*ch
 			CSID:            4,
 			TypeID:          8, // audio
 			Timestamp:       0,
-			MessageStreamID: msg.MessageStreamID,
+			MessageStreamID: streamID,
 			MessageLength:   uint32(len(payload)),
 			Payload:         payload,
 		}
 		_ = conn.SendMessage(trackMsg)
 		log.Info("Sent cached multitrack audio header to subscriber",
-			"stream_key", pcmd.StreamKey, "track_id", trackID, "size", len(payload))
+			"stream_key", streamKey, "track_id", trackID, "size", len(payload))
 	}
 
 	for trackID, payload := range extraVideoTracks {
@@ -167,37 +203,37 @@ func HandlePlay(reg *Registry, conn sender, app string, msg *chunk.Message) (*ch
 			CSID:            6,
 			TypeID:          9, // video
 			Timestamp:       0,
-			MessageStreamID: msg.MessageStreamID,
+			MessageStreamID: streamID,
 			MessageLength:   uint32(len(payload)),
 			Payload:         payload,
 		}
 		_ = conn.SendMessage(trackMsg)
 		log.Info("Sent cached multitrack video header to subscriber",
-			"stream_key", pcmd.StreamKey, "track_id", trackID, "size", len(payload))
+			"stream_key", streamKey, "track_id", trackID, "size", len(payload))
 	}
-
-	return started, nil
 }
 
-// buildOnStatus creates an AMF0 onStatus command message.
+// buildOnStatus creates an AMF0 onStatus command message. Failure
+// statuses are sent by the dispatcher from the handler's error.
 func buildOnStatus(streamID uint32, streamKey, code, description string) (*chunk.Message, error) {
-	info := map[string]interface{}{
-		"level":       "status",
-		"code":        code,
-		"description": description,
-		"details":     streamKey,
-	}
-	payload, err := amf.EncodeAll("onStatus", float64(0), nil, info)
-	if err != nil {
-		return nil, err
-	}
-	return &chunk.Message{
-		CSID:            5,
-		TypeID:          rpc.CommandMessageAMF0TypeIDForTest(),
-		MessageStreamID: streamID,
-		MessageLength:   uint32(len(payload)),
-		Payload:         payload,
-	}, nil
+	return buildOnStatusTxn(streamID, 0, streamKey, code, description)
+}
+
+// buildStatusReply builds the onStatus answering command message cmd, on
+// its message stream, with the transaction ID mode gives it
+// (Config.StatusTxnMode).
+func buildStatusReply(mode string, cmd *chunk.Message, streamKey, code, description string) (*chunk.Message, error) {
+	return buildOnStatusTxn(cmd.MessageStreamID, rpc.StatusTransactionID(mode, cmd), streamKey, code, description)
+}
+
+func buildOnStatusTxn(streamID uint32, txn float64, streamKey, code, description string) (*chunk.Message, error) {
+	return rpc.BuildOnStatus(streamID, rpc.Status{
+		Level:         rpc.LevelStatus,
+		Code:          code,
+		Description:   description,
+		Details:       streamKey,
+		TransactionID: txn,
+	})
 }
 
 // SubscriberDisconnected removes the subscriber from the stream's list.
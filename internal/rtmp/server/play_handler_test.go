@@ -12,6 +12,7 @@
 package server
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
@@ -119,3 +120,35 @@ func TestHandlePlayWithQueryParams(t *testing.T) {
 		t.Fatalf("expected 1 subscriber, got %d", s.SubscriberCount())
 	}
 }
+
+// TestHandlePlaySubscriberLimit checks the server-wide and per-app player
+// limits: a play beyond them sends nothing, returns ErrSubscriberLimit and
+// leaves the stream's players as they were.
+func TestHandlePlaySubscriberLimit(t *testing.T) {
+	reg := NewRegistry()
+	reg.SetSubscriberLimit(2, map[string]int{"vip": 1})
+	for _, tc := range []struct {
+		app   string
+		limit int
+	}{{"app", 2}, {"vip", 1}} {
+		s, _ := reg.CreateStream(tc.app + "/show")
+		if err := s.SetPublisher(&stubPublisher{}); err != nil {
+			t.Fatalf("set publisher: %v", err)
+		}
+		for i := 0; i < tc.limit; i++ {
+			if _, err := HandlePlay(reg, &capturingConn{}, tc.app, buildPlayMessage("show")); err != nil {
+				t.Fatalf("%s: play %d: %v", tc.app, i+1, err)
+			}
+		}
+		conn := &capturingConn{}
+		if _, err := HandlePlay(reg, conn, tc.app, buildPlayMessage("show?media=audio")); !errors.Is(err, ErrSubscriberLimit) {
+			t.Fatalf("%s: play beyond the limit: err = %v, want ErrSubscriberLimit", tc.app, err)
+		}
+		if len(conn.sent) != 0 || s.SubscriberCount() != tc.limit {
+			t.Fatalf("%s: refused player got %d messages; stream has %d players", tc.app, len(conn.sent), s.SubscriberCount())
+		}
+		if s.SubscriberMedia(conn) != (MediaFilter{}) {
+			t.Fatalf("%s: refused player's media filter kept", tc.app)
+		}
+	}
+}
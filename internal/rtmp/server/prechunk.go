@@ -0,0 +1,75 @@
+package server
+
+// Shared Chunking
+// ---------------
+// Every RTMP subscriber's write loop splits the messages it sends into
+// chunks. For a stream with hundreds of viewers that meant chunking each
+// frame hundreds of times, all producing the same continuation chunks.
+//
+// BroadcastMessage runs on the one goroutine delivering a stream's media.
+// Before fanning a message out it frames the payload once for each outbound
+// chunk size that two or more subscribers use (see conn.Prechunk), and the
+// subscribers' writers send the continuation chunks straight from that
+// shared framing. Only the first chunk, which carries the subscriber's
+// message stream ID and compressed header, is encoded per connection. A
+// subscriber whose chunk size changed before the message was written just
+// chunks it itself.
+
+import (
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	iconn "github.com/alxayo/go-rtmp/internal/rtmp/conn"
+	"github.com/alxayo/go-rtmp/internal/rtmp/media"
+)
+
+// chunkSizer is implemented by subscribers that chunk their own output
+// (RTMP connections).
+type chunkSizer interface {
+	WriteChunkSize() uint32
+}
+
+// sizeCount is the number of subscribers using one chunk size.
+type sizeCount struct {
+	size uint32
+	n    int
+}
+
+// prechunkFor returns msg framed for every chunk size shared by at least
+// two of subs, or msg itself if no size is shared or the payload fits in
+// one chunk anyway. msg is not modified: the framing goes on a copy of its
+// header, which shares the payload.
+func prechunkFor(msg *chunk.Message, subs []media.Subscriber) *chunk.Message {
+	if len(subs) < 2 {
+		return msg
+	}
+	counts := make([]sizeCount, 0, 4)
+	for _, sub := range subs {
+		cs, ok := sub.(chunkSizer)
+		if !ok {
+			continue
+		}
+		size := cs.WriteChunkSize()
+		i := 0
+		for i < len(counts) && counts[i].size != size {
+			i++
+		}
+		if i == len(counts) {
+			counts = append(counts, sizeCount{size: size})
+		}
+		counts[i].n++
+	}
+	var framed *chunk.Message
+	for _, c := range counts {
+		if c.n < 2 || uint32(len(msg.Payload)) <= c.size {
+			continue
+		}
+		if framed == nil {
+			cp := *msg
+			framed = &cp
+		}
+		iconn.Prechunk(framed, c.size)
+	}
+	if framed == nil {
+		return msg
+	}
+	return framed
+}
@@ -0,0 +1,104 @@
+// prechunk_test.go – tests for chunking broadcast messages once per chunk size.
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/alxayo/go-rtmp/internal/logger"
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	iconn "github.com/alxayo/go-rtmp/internal/rtmp/conn"
+)
+
+// chunkingSubscriber chunks what it is sent through its own Writer, like a
+// connection's write loop.
+type chunkingSubscriber struct {
+	size uint32
+	w    *chunk.Writer
+	last *chunk.Message
+	n    int
+}
+
+func newChunkingSubscriber(size uint32, out io.Writer) *chunkingSubscriber {
+	return &chunkingSubscriber{size: size, w: chunk.NewWriter(out, size)}
+}
+
+func (s *chunkingSubscriber) WriteChunkSize() uint32 { return s.size }
+
+func (s *chunkingSubscriber) SendMessage(m *chunk.Message) error {
+	s.last, s.n = m, s.n+1
+	m.CSID = iconn.CSIDVideo
+	return s.w.WriteMessage(m)
+}
+
+// TestBroadcastPrechunk checks that a message is framed for the chunk sizes
+// shared by two or more subscribers only, that the caller's message is left
+// alone, and that the subscribers' output matches plain chunking.
+func TestBroadcastPrechunk(t *testing.T) {
+	logger.UseWriter(io.Discard)
+	r := NewRegistry()
+	s, _ := r.CreateStream("app/prechunk")
+	var out [3]bytes.Buffer
+	subs := []*chunkingSubscriber{
+		newChunkingSubscriber(128, &out[0]),
+		newChunkingSubscriber(128, &out[1]),
+		newChunkingSubscriber(4096, &out[2]),
+	}
+	for _, sub := range subs {
+		s.AddSubscriber(sub)
+	}
+
+	payload := make([]byte, 1000)
+	payload[0], payload[1] = 0x27, 0x01 // inter frame
+	msg := &chunk.Message{CSID: 7, TypeID: 9, MessageStreamID: 1, Payload: payload}
+	s.BroadcastMessage(nil, msg, logger.Logger())
+
+	if msg.Prechunked(iconn.CSIDVideo, 128) {
+		t.Fatal("caller's message was framed")
+	}
+	for i, sub := range subs {
+		if sub.n != 1 {
+			t.Fatalf("subscriber %d got %d messages, want 1", i, sub.n)
+		}
+	}
+	if !subs[0].last.Prechunked(iconn.CSIDVideo, 128) {
+		t.Fatal("message not framed for the shared 128-byte chunk size")
+	}
+	if subs[2].last.Prechunked(iconn.CSIDVideo, 4096) {
+		t.Fatal("message framed for a chunk size only one subscriber uses")
+	}
+
+	var plain bytes.Buffer
+	_ = chunk.NewWriter(&plain, 128).WriteMessage(&chunk.Message{CSID: iconn.CSIDVideo, TypeID: 9, MessageStreamID: 1, Payload: payload})
+	if !bytes.Equal(out[0].Bytes(), plain.Bytes()) || !bytes.Equal(out[1].Bytes(), plain.Bytes()) {
+		t.Fatal("pre-chunked output differs from plain chunking")
+	}
+}
+
+// BenchmarkBroadcastChunking measures fanning one 64 KB keyframe out to N
+// subscribers that each chunk it at 4096 bytes, as connections do.
+func BenchmarkBroadcastChunking(b *testing.B) {
+	logger.UseWriter(io.Discard)
+	for _, n := range []int{10, 100, 500} {
+		b.Run(fmt.Sprintf("subscribers=%d", n), func(b *testing.B) {
+			r := NewRegistry()
+			s, _ := r.CreateStream("app/bench")
+			for i := 0; i < n; i++ {
+				s.AddSubscriber(newChunkingSubscriber(4096, io.Discard))
+			}
+			payload := make([]byte, 64*1024)
+			payload[0], payload[1] = 0x17, 0x01 // keyframe, not a sequence header
+			msg := &chunk.Message{CSID: 6, TypeID: 9, MessageStreamID: 1, Payload: payload}
+			log := logger.Logger()
+			b.ReportAllocs()
+			b.SetBytes(int64(len(payload) * n))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				msg.Timestamp = uint32(i)
+				s.BroadcastMessage(nil, msg, log)
+			}
+		})
+	}
+}
@@ -14,7 +14,6 @@ import (
 
 	rtmperrors "github.com/alxayo/go-rtmp/internal/errors"
 	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
-	"github.com/alxayo/go-rtmp/internal/rtmp/metrics"
 	"github.com/alxayo/go-rtmp/internal/rtmp/rpc"
 )
 
@@ -41,19 +40,18 @@ func HandlePublish(reg *Registry, conn sender, app string, msg *chunk.Message) (
 		return nil, err
 	}
 
-	// Look up or create the stream in the registry (dependency T048).
-	stream, _ := reg.CreateStream(pcmd.StreamKey)
+	// Look up or create the stream in the registry (dependency T048) and
+	// enforce single publisher (spec requirement).
+	stream, err := reg.PublishStream(pcmd.StreamKey, conn)
 	if stream == nil {
 		return nil, rtmperrors.NewProtocolError("publish.handle", fmt.Errorf("failed to create stream"))
 	}
-
-	// Enforce single publisher (spec requirement).
-	if err := stream.SetPublisher(conn); err != nil {
+	if err != nil {
 		return nil, err // already a *errors.ProtocolError from registry or ErrPublisherExists
 	}
 
 	// Build onStatus NetStream.Publish.Start (reuses shared builder from play_handler.go).
-	onStatus, err := buildOnStatus(msg.MessageStreamID, pcmd.StreamKey, "NetStream.Publish.Start", fmt.Sprintf("Publishing %s.", pcmd.StreamKey))
+	onStatus, err := buildStatusReply(reg.statusTxnMode(), msg, pcmd.StreamKey, "NetStream.Publish.Start", fmt.Sprintf("Publishing %s.", pcmd.StreamKey))
 	if err != nil {
 		return nil, rtmperrors.NewProtocolError("publish.handle.encode", err)
 	}
@@ -64,21 +62,12 @@ func HandlePublish(reg *Registry, conn sender, app string, msg *chunk.Message) (
 	return onStatus, nil
 }
 
-// PublisherDisconnected clears the publisher from the stream if it matches
-// the provided connection. Called during connection teardown to allow the
-// stream key to be re-used by a new publisher.
+// PublisherDisconnected ends the stream (see Stream.EndPublish) if its
+// publisher is the provided connection. Called during connection teardown
+// to allow the stream key to be re-used by a new publisher.
 func PublisherDisconnected(reg *Registry, streamKey string, pub sender) {
 	if reg == nil || streamKey == "" || pub == nil {
 		return
 	}
-	s := reg.GetStream(streamKey)
-	if s == nil {
-		return
-	}
-	s.mu.Lock()
-	if s.Publisher == pub {
-		s.Publisher = nil
-		metrics.PublishersActive.Add(-1)
-	}
-	s.mu.Unlock()
+	reg.GetStream(streamKey).EndPublish(pub)
 }
@@ -15,6 +15,8 @@ import (
 	"testing"
 
 	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/rpc"
 )
 
 // TestHandlePublishSuccess publishes a stream and verifies:
@@ -53,6 +55,25 @@ func TestHandlePublishSuccess(t *testing.T) {
 	}
 }
 
+// TestHandlePublishTxnMode publishes with an FFmpeg-style transaction ID
+// and checks the onStatus carries 0, or the ID once the registry echoes it.
+func TestHandlePublishTxnMode(t *testing.T) {
+	for mode, want := range map[string]float64{rpc.TxnModeZero: 0, rpc.TxnModeEcho: 5} {
+		reg := NewRegistry()
+		reg.SetStatusTxnMode(mode)
+		payload, _ := amf.EncodeAll("publish", 5.0, nil, "cam1", "live")
+		msg := &chunk.Message{TypeID: rpc.CommandMessageAMF0TypeIDForTest(), Payload: payload, MessageLength: uint32(len(payload)), MessageStreamID: 1}
+		onStatus, err := HandlePublish(reg, &stubConn{}, "live", msg)
+		if err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+		vals, _ := amf.DecodeAll(onStatus.Payload)
+		if vals[1] != want || onStatus.MessageStreamID != 1 {
+			t.Fatalf("%s: onStatus transaction ID %v on stream %d, want %v", mode, vals[1], onStatus.MessageStreamID, want)
+		}
+	}
+}
+
 // TestHandlePublishDuplicate attempts to publish to the same stream key
 // twice and expects an error on the second attempt.
 func TestHandlePublishDuplicate(t *testing.T) {
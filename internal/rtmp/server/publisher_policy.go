@@ -0,0 +1,50 @@
+package server
+
+// Duplicate Publisher Policy
+// --------------------------
+// Only one publisher may own a stream key. When a second encoder publishes
+// to a key that is already live, Config.DuplicatePublisherPolicy decides:
+//
+//   - "replace" (default): the current publisher is disconnected and the new
+//     one takes over. This covers encoders reconnecting after a crash while
+//     the old TCP connection lingers, and deliberate "takeover" workflows.
+//   - "reject": the new publisher receives NetStream.Publish.BadName and the
+//     current one keeps the stream.
+//   - "rename": the new publisher is registered under the first free key of
+//     the form "<key>_dup<N>" (N = 2, 3, ...). The new key is reported in the
+//     details field of its NetStream.Publish.Start.
+//
+// SRT publishers cannot be told about a new key, so "rename" rejects them.
+
+import "fmt"
+
+// Duplicate publisher policies for Config.DuplicatePublisherPolicy.
+const (
+	PublisherPolicyReplace = "replace"
+	PublisherPolicyReject  = "reject"
+	PublisherPolicyRename  = "rename"
+)
+
+// maxRenameAttempts bounds the "<key>_dupN" search under the rename policy.
+const maxRenameAttempts = 100
+
+// validPublisherPolicy reports whether p is a recognized policy name.
+func validPublisherPolicy(p string) bool {
+	switch p {
+	case PublisherPolicyReplace, PublisherPolicyReject, PublisherPolicyRename:
+		return true
+	}
+	return false
+}
+
+// claimRenamedStream registers pub as the publisher of the first free
+// "<key>_dupN" stream and returns the key it was registered under.
+func claimRenamedStream(reg *Registry, key string, pub interface{}) (string, error) {
+	for n := 2; n < 2+maxRenameAttempts; n++ {
+		candidate := fmt.Sprintf("%s_dup%d", key, n)
+		if _, err := reg.PublishStream(candidate, pub); err == nil {
+			return candidate, nil
+		}
+	}
+	return "", ErrPublisherExists
+}
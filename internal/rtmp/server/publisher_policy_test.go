@@ -0,0 +1,43 @@
+// publisher_policy_test.go – tests for the duplicate publisher policy helpers.
+//
+// The rename policy moves a second publisher to the first free
+// "<key>_dup<N>" stream; these tests cover the key search and policy
+// validation. The replace path is covered by the eviction tests in
+// publish_handler_test.go.
+package server
+
+import "testing"
+
+// TestClaimRenamedStream verifies that the first free "_dupN" key is claimed
+// and that an occupied candidate is skipped.
+func TestClaimRenamedStream(t *testing.T) {
+	reg := NewRegistry()
+	orig, _ := reg.CreateStream("live/show")
+	_ = orig.SetPublisher(&stubConn{})
+
+	key, err := claimRenamedStream(reg, "live/show", &stubConn{})
+	if err != nil || key != "live/show_dup2" {
+		t.Fatalf("first rename = %q, %v; want live/show_dup2", key, err)
+	}
+	key, err = claimRenamedStream(reg, "live/show", &stubConn{})
+	if err != nil || key != "live/show_dup3" {
+		t.Fatalf("second rename = %q, %v; want live/show_dup3", key, err)
+	}
+	if s := reg.GetStream("live/show_dup2"); s == nil || s.Publisher == nil {
+		t.Fatalf("renamed stream should have a publisher")
+	}
+}
+
+// TestValidPublisherPolicy checks the accepted policy names.
+func TestValidPublisherPolicy(t *testing.T) {
+	for _, p := range []string{PublisherPolicyReplace, PublisherPolicyReject, PublisherPolicyRename} {
+		if !validPublisherPolicy(p) {
+			t.Errorf("%q should be valid", p)
+		}
+	}
+	for _, p := range []string{"", "kick", "Replace"} {
+		if validPublisherPolicy(p) {
+			t.Errorf("%q should be invalid", p)
+		}
+	}
+}
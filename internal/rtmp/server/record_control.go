@@ -0,0 +1,252 @@
+package server
+
+// Runtime Recording Control
+// -------------------------
+// Recording is normally decided when a stream is published (-record-all,
+// -record-streams, per-app record=, publish type "record"). StartRecording
+// and StopRecording turn it on and off for a stream that is already live,
+// e.g. from the admin API (admin.go) to record only the interesting part of
+// a long broadcast.
+//
+// A recording must open cleanly however late it starts, whether by
+// StartRecording or because the recorder could only be created once the
+// video codec was known: a file that begins with inter frames cannot be
+// decoded until the next keyframe. So every stream keeps its current GOP,
+// the media since its last video keyframe, and a new recording writes the
+// cached sequence headers followed by that GOP, or waits for the next
+// keyframe when there is none (or it outgrew maxRecordGOPBytes).
+// Timestamps are shifted so the file starts at zero. Stopping closes the file as an unpublish would, firing record_complete;
+// starting again opens a new file. The stream's next publish decides
+// recording afresh.
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/media"
+	"github.com/alxayo/go-rtmp/internal/rtmp/metrics"
+	"github.com/alxayo/go-rtmp/internal/rtmp/server/hooks"
+)
+
+// Errors returned by StartRecording and StopRecording.
+var (
+	ErrStreamNotLive    = errors.New("stream is not being published")
+	ErrAlreadyRecording = errors.New("stream is already being recorded")
+	ErrNotRecording     = errors.New("stream is not being recorded")
+)
+
+// maxRecordGOPBytes caps a stream's buffered GOP; a longer GOP is dropped
+// and the next recording waits for a keyframe instead.
+const maxRecordGOPBytes = 16 << 20
+
+// StartRecording starts recording the live stream streamKey into
+// Config.RecordDir, from its last video keyframe.
+func (s *Server) StartRecording(streamKey string) error {
+	stream := s.reg.GetStream(streamKey)
+	if stream.State() != StreamPublishing {
+		return fmt.Errorf("start recording %s: %w", streamKey, ErrStreamNotLive)
+	}
+	stream.mu.Lock()
+	if stream.RecordDir != "" || stream.Recorder != nil {
+		stream.mu.Unlock()
+		return fmt.Errorf("start recording %s: %w", streamKey, ErrAlreadyRecording)
+	}
+	stream.RecordDir = s.cfg.RecordDir
+	stream.RecordAppend = false
+	stream.SegmentDuration = s.cfg.SegmentDuration
+	stream.SegmentPattern = s.cfg.SegmentPattern
+	stream.RecordFormat = s.cfg.RecordFormat
+	stream.RecordTimecode = s.cfg.RecordTimecode
+	stream.RecordQueueSize = s.cfg.RecordQueueSize
+	stream.RecordingClosed = s.recordingClosedFunc(nil, streamKey)
+	stream.recordSync = true
+	stream.recordBase = 0
+	stream.mu.Unlock()
+
+	s.log.Info("recording started", "stream_key", streamKey, "record_dir", s.cfg.RecordDir)
+	s.triggerHookEvent(hooks.EventRecordStart, "", streamKey, map[string]interface{}{
+		"record_dir": s.cfg.RecordDir,
+	})
+	return nil
+}
+
+// StopRecording stops recording the stream streamKey and closes its
+// recording file.
+func (s *Server) StopRecording(streamKey string) error {
+	stream := s.reg.GetStream(streamKey)
+	if stream == nil {
+		return fmt.Errorf("stop recording %s: %w", streamKey, ErrNotRecording)
+	}
+	stream.mu.Lock()
+	if stream.RecordDir == "" && stream.Recorder == nil {
+		stream.mu.Unlock()
+		return fmt.Errorf("stop recording %s: %w", streamKey, ErrNotRecording)
+	}
+	stream.RecordDir = "" // keeps ensureRecorder from opening a new file
+	stream.recordSync = false
+	var err error
+	if stream.Recorder != nil {
+		if err = stream.Recorder.Close(); err != nil {
+			metrics.RecordingErrorsTotal.Add(1)
+		}
+		metrics.RecordingsActive.Add(-1)
+		stream.Recorder = nil
+	}
+	stream.mu.Unlock()
+
+	s.log.Info("recording stopped", "stream_key", streamKey)
+	s.triggerHookEvent(hooks.EventRecordStop, "", streamKey, nil)
+	if err != nil {
+		return fmt.Errorf("stop recording %s: close recorder: %w", streamKey, err)
+	}
+	return nil
+}
+
+// writeRecording writes m to the stream's recorder, if it has one. A new
+// recording starts with the cached sequence headers and the buffered GOP,
+// or skips everything before the next video keyframe when nothing is
+// buffered, and is shifted to start at timestamp zero.
+func (s *Stream) writeRecording(m *chunk.Message) {
+	s.mu.Lock()
+	rec := s.Recorder
+	if rec == nil {
+		s.mu.Unlock()
+		return
+	}
+	var headers, gop []*chunk.Message
+	if s.recordSync {
+		if len(s.recordGOP) == 0 {
+			s.mu.Unlock()
+			return
+		}
+		s.recordSync = false
+		s.recordBase = s.recordGOP[0].Timestamp
+		for _, h := range []*chunk.Message{s.AudioSequenceHeader, s.VideoSequenceHeader} {
+			if h != nil {
+				headers = append(headers, h)
+			}
+		}
+		// BroadcastMessage has already buffered m, unless it is a sequence
+		// header (written with the headers) or a data message.
+		gop = append(gop, s.recordGOP...)
+		if m.TypeID == 8 || m.TypeID == 9 {
+			m = nil
+		}
+	}
+	base := s.recordBase
+	s.mu.Unlock()
+
+	for _, h := range headers {
+		hdr := *h
+		hdr.Timestamp = 0
+		rec.WriteMessage(&hdr)
+	}
+	for _, g := range gop {
+		rec.WriteMessage(rebased(g, base))
+	}
+	if m != nil {
+		rec.WriteMessage(rebased(m, base))
+	}
+}
+
+// rebased returns m shifted back by base, clamped at zero (e.g. audio
+// slightly older than the keyframe). The recorder keeps its own reference
+// (AsyncWriter), so m itself is never changed.
+func rebased(m *chunk.Message, base uint32) *chunk.Message {
+	if base == 0 {
+		return m
+	}
+	shifted := *m
+	if shifted.Timestamp >= base {
+		shifted.Timestamp -= base
+	} else {
+		shifted.Timestamp = 0
+	}
+	return &shifted
+}
+
+// bufferRecordGOP adds a published media message to the stream's current
+// GOP, which a video keyframe restarts. Sequence headers are cached on
+// their own and not buffered.
+func (s *Stream) bufferRecordGOP(m *chunk.Message) {
+	if m.TypeID != 8 && m.TypeID != 9 {
+		return
+	}
+	if (m.TypeID == 9 && media.IsVideoSequenceHeader(m.Payload)) || (m.TypeID == 8 && media.IsAudioSequenceHeader(m.Payload)) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m.TypeID == 9 && media.IsVideoKeyframe(m.Payload) {
+		s.clearRecordGOP()
+	} else if len(s.recordGOP) == 0 {
+		return // nothing to start a recording from before the first keyframe
+	}
+	if s.recordGOPBytes+len(m.Payload) > maxRecordGOPBytes {
+		s.clearRecordGOP()
+		return
+	}
+	cp := *m
+	cp.Payload = make([]byte, len(m.Payload))
+	copy(cp.Payload, m.Payload)
+	s.recordGOP = append(s.recordGOP, &cp)
+	s.recordGOPBytes += len(cp.Payload)
+}
+
+// clearRecordGOP drops the buffered GOP. The caller holds s.mu.
+func (s *Stream) clearRecordGOP() {
+	clear(s.recordGOP)
+	s.recordGOP = s.recordGOP[:0]
+	s.recordGOPBytes = 0
+}
+
+// recordingPaths remembers the single-file FLV recording each stream key
+// last wrote, so that publish type "append" continues the stream's own file.
+// Filenames cannot tell "live/a_b" from "live_a/b" (both record to
+// live_a_b_<timestamp>.flv), so the newest file findRecording matches is
+// only used for a key that has not recorded since the server started, and
+// not when it is known to be another key's recording.
+type recordingPaths struct {
+	mu     sync.Mutex
+	byKey  map[string]string // stream key → its latest recording
+	owners map[string]string // recording → stream key
+}
+
+// set records that key's latest recording is path.
+func (p *recordingPaths) set(key, path string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.byKey == nil {
+		p.byKey = make(map[string]string)
+		p.owners = make(map[string]string)
+	}
+	p.byKey[key] = path
+	p.owners[path] = key
+}
+
+// latest returns the recording in recordDir that key should append to, or
+// "" to start a new one.
+func (p *recordingPaths) latest(key, recordDir string) string {
+	if p == nil {
+		return findRecording(recordDir, key)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if path, ok := p.byKey[key]; ok && filepath.Dir(path) == filepath.Clean(recordDir) {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	path := findRecording(recordDir, key)
+	if owner, ok := p.owners[path]; ok && owner != key {
+		return ""
+	}
+	return path
+}
@@ -0,0 +1,231 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/logger"
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/media"
+	"github.com/alxayo/go-rtmp/internal/rtmp/server/hooks"
+)
+
+// TestStartRecording_MidStream starts recording a live stream and checks
+// the file opens at its last keyframe, after the cached sequence headers,
+// with timestamps starting at zero.
+func TestStartRecording_MidStream(t *testing.T) {
+	logger.UseWriter(io.Discard)
+	s := New(Config{ListenAddr: "127.0.0.1:0", RecordDir: t.TempDir()})
+	if err := s.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer s.Stop()
+	events, cancel := s.Subscribe(4, hooks.EventRecordStart, hooks.EventRecordStop, hooks.EventRecordComplete)
+	defer cancel()
+
+	// The last timestamp the publisher's read loop has reached: every
+	// message before it has been handed to the recorder.
+	var seen atomic.Uint32
+	remove, _ := s.Intercept("", func(m *chunk.Message) *chunk.Message { seen.Store(m.Timestamp); return m })
+	defer remove()
+
+	if err := s.StartRecording("live/rec"); !errors.Is(err, ErrStreamNotLive) {
+		t.Fatalf("StartRecording before publish = %v, want ErrStreamNotLive", err)
+	}
+	pub := connectTo(t, s, "live/rec")
+	if err := pub.Publish(); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	waitFor(t, "publish", func() bool { return hasLivePublisher(s.reg, "live/rec") })
+	audioHdr := []byte{0xAF, 0x00, 0x12, 0x10}
+	videoHdr := []byte{0x17, 0x00, 0, 0, 0, 0x01, 0x64, 0x00, 0x1f}
+	_ = pub.SendAudio(0, audioHdr)
+	_ = pub.SendVideo(0, videoHdr)
+	_ = pub.SendVideo(0, []byte{0x17, 0x01, 0, 0, 0, 0xA0})
+	_ = pub.SendVideo(40, []byte{0x27, 0x01, 0, 0, 0, 0xB0})
+	waitFor(t, "first GOP", func() bool { return seen.Load() == 40 })
+
+	if err := s.StartRecording("live/rec"); err != nil {
+		t.Fatalf("StartRecording: %v", err)
+	}
+	if err := s.StartRecording("live/rec"); !errors.Is(err, ErrAlreadyRecording) {
+		t.Fatalf("second StartRecording = %v, want ErrAlreadyRecording", err)
+	}
+	_ = pub.SendVideo(1000, []byte{0x27, 0x01, 0, 0, 0, 0xB1})
+	_ = pub.SendAudio(1020, []byte{0xAF, 0x01, 0x21})
+	_ = pub.SendVideo(1040, []byte{0x17, 0x01, 0, 0, 0, 0xA1})
+	_ = pub.SendAudio(1060, []byte{0xAF, 0x01, 0x22})
+	_ = pub.SendVideo(1080, []byte{0x27, 0x01, 0, 0, 0, 0xB2})
+	_ = pub.SendAudio(1100, []byte{0xAF, 0x01, 0x23})
+	waitFor(t, "second GOP", func() bool { return seen.Load() == 1100 })
+
+	if err := s.StopRecording("live/rec"); err != nil {
+		t.Fatalf("StopRecording: %v", err)
+	}
+	if err := s.StopRecording("live/rec"); !errors.Is(err, ErrNotRecording) {
+		t.Fatalf("second StopRecording = %v, want ErrNotRecording", err)
+	}
+
+	// Hook events are delivered asynchronously, in any order.
+	fired := map[hooks.EventType]hooks.Event{}
+	for len(fired) < 3 {
+		select {
+		case e := <-events:
+			fired[e.Type] = e
+		case <-time.After(2 * time.Second):
+			t.Fatalf("got events %v, want record_start, record_stop and record_complete", fired)
+		}
+	}
+	file, _ := fired[hooks.EventRecordComplete].Data["file"].(string)
+
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatalf("open recording: %v", err)
+	}
+	defer f.Close()
+	fr, err := media.NewFLVReader(f)
+	if err != nil {
+		t.Fatalf("read recording: %v", err)
+	}
+	type tag struct {
+		ts   uint32
+		last byte
+	}
+	var got []tag
+	for {
+		tg, err := fr.ReadTag()
+		if err != nil {
+			break
+		}
+		if tg.Type != media.FLVTagScript {
+			got = append(got, tag{tg.Timestamp, tg.Data[len(tg.Data)-1]})
+		}
+	}
+	want := []tag{{0, audioHdr[3]}, {0, videoHdr[8]}, {0, 0xA0}, {40, 0xB0}, {1000, 0xB1},
+		{1020, 0x21}, {1040, 0xA1}, {1060, 0x22}, {1080, 0xB2}, {1100, 0x23}}
+	if len(got) != len(want) {
+		t.Fatalf("recorded tags %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("recorded tags %v, want %v", got, want)
+		}
+	}
+}
+
+// capturingWriter is a media.MediaWriter that keeps what it is given.
+type capturingWriter struct{ msgs []*chunk.Message }
+
+func (w *capturingWriter) WriteMessage(m *chunk.Message) { w.msgs = append(w.msgs, m) }
+func (w *capturingWriter) Close() error                  { return nil }
+func (w *capturingWriter) Disabled() bool                { return false }
+
+// TestWriteRecording_WaitsForKeyframe creates a recorder before any
+// keyframe was seen, as a late recorder init does, and checks the file
+// opens at the first keyframe after the sequence headers.
+func TestWriteRecording_WaitsForKeyframe(t *testing.T) {
+	logger.UseWriter(io.Discard)
+	s, _ := NewRegistry().CreateStream("live/late")
+	w := &capturingWriter{}
+	s.Recorder, s.recordSync = w, true
+	audioHdr := &chunk.Message{TypeID: 8, Timestamp: 480, Payload: []byte{0xAF, 0x00, 0x12, 0x10}}
+	videoHdr := &chunk.Message{TypeID: 9, Timestamp: 480, Payload: []byte{0x17, 0x00, 0, 0, 0, 0x01}}
+	inter := &chunk.Message{TypeID: 9, Timestamp: 480, Payload: []byte{0x27, 0x01, 0, 0, 0, 0xB0}}
+	audio := &chunk.Message{TypeID: 8, Timestamp: 490, Payload: []byte{0xAF, 0x01, 0x21}}
+	keyframe := &chunk.Message{TypeID: 9, Timestamp: 500, Payload: []byte{0x17, 0x01, 0, 0, 0, 0xA0}}
+	later := &chunk.Message{TypeID: 8, Timestamp: 520, Payload: []byte{0xAF, 0x01, 0x22}}
+	for _, m := range []*chunk.Message{audioHdr, videoHdr, inter, audio, keyframe, later} {
+		s.BroadcastMessage(nil, m, logger.Logger())
+		s.writeRecording(m)
+	}
+
+	want := []struct {
+		ts   uint32
+		last byte
+	}{{0, 0x10}, {0, 0x01}, {0, 0xA0}, {20, 0x22}}
+	if len(w.msgs) != len(want) {
+		t.Fatalf("recorded %d messages, want %d", len(w.msgs), len(want))
+	}
+	for i, m := range w.msgs {
+		if m.Timestamp != want[i].ts || m.Payload[len(m.Payload)-1] != want[i].last {
+			t.Fatalf("message %d = ts %d % x, want ts %d ending %#x", i, m.Timestamp, m.Payload, want[i].ts, want[i].last)
+		}
+	}
+	if keyframe.Timestamp != 500 {
+		t.Fatal("writeRecording changed the published message")
+	}
+}
+
+// TestRecordingHandler drives StartRecording and StopRecording through
+// the admin API.
+func TestRecordingHandler(t *testing.T) {
+	logger.UseWriter(io.Discard)
+	s := New(Config{ListenAddr: "127.0.0.1:0", RecordDir: t.TempDir()})
+	stream, _ := s.reg.CreateStream("live/show")
+	if err := stream.SetPublisher(&stubPublisher{}); err != nil {
+		t.Fatal(err)
+	}
+	h := s.RecordingHandler()
+	do := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	for _, tc := range []struct {
+		method, path string
+		status       int
+	}{
+		{http.MethodPost, "/api/recordings/live/missing", http.StatusNotFound},
+		{http.MethodPost, "/api/recordings/live/show", http.StatusAccepted},
+		{http.MethodPost, "/api/recordings/live/show", http.StatusConflict},
+		{http.MethodGet, "/api/recordings", http.StatusOK},
+		{http.MethodDelete, "/api/recordings/live/show", http.StatusNoContent},
+		{http.MethodDelete, "/api/recordings/live/show", http.StatusNotFound},
+	} {
+		w := do(tc.method, tc.path)
+		if w.Code != tc.status {
+			t.Fatalf("%s %s = %d %s, want %d", tc.method, tc.path, w.Code, w.Body, tc.status)
+		}
+		if tc.method == http.MethodGet {
+			if body := w.Body.String(); body != `[{"stream_key":"live/show","recording":true}]`+"\n" {
+				t.Fatalf("GET /api/recordings = %s", body)
+			}
+		}
+	}
+}
+
+// TestRecordingPaths_Collision keeps "live/a_b" and "live_a/b", whose
+// recordings share a filename prefix, from appending to each other's file.
+func TestRecordingPaths_Collision(t *testing.T) {
+	dir := t.TempDir()
+	old := writeTestRecording(t, dir, "live_a_b_20250101_000000.flv")
+	ab := writeTestRecording(t, dir, "live_a_b_20250102_000000.flv")
+	past := time.Now().Add(-time.Hour)
+	_ = os.Chtimes(old, past, past)
+
+	var p recordingPaths
+	if got := p.latest("live_a/b", dir); got != ab {
+		t.Fatalf("latest before any recording = %q, want the newest file %q", got, ab)
+	}
+	p.set("live/a_b", ab)
+	if got := p.latest("live_a/b", dir); got != "" {
+		t.Fatalf("live_a/b latest = %q, want none (the file is live/a_b's)", got)
+	}
+	if got := p.latest("live/a_b", dir); got != ab {
+		t.Fatalf("live/a_b latest = %q, want %q", got, ab)
+	}
+	p.set("live_a/b", old)
+	if got := p.latest("live_a/b", dir); got != old {
+		t.Fatalf("live_a/b latest = %q, want its own %q", got, old)
+	}
+	if got := p.latest("live_a/b", t.TempDir()); got != "" {
+		t.Fatalf("latest in another directory = %q, want none", got)
+	}
+}
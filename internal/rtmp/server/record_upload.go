@@ -0,0 +1,135 @@
+package server
+
+// Finished recordings: every finished recording file (a whole recording, or
+// one segment) fires a record_complete hook event with its path, duration,
+// size, codecs and frame counts. With Config.RecordStorage set, the file is
+// also handed to a storage.Store in the background — copied to another
+// directory or uploaded to S3 — and a recording_uploaded hook event reports
+// where it went. Uploads never touch the media path; a failed upload is
+// logged and the local file is kept. Stop waits for uploads in flight for
+// up to Config.RecordUploadStopTimeout and then cancels them.
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/media"
+	"github.com/alxayo/go-rtmp/internal/rtmp/metrics"
+	"github.com/alxayo/go-rtmp/internal/rtmp/server/hooks"
+)
+
+// recordingClosedFunc returns the callback for streamKey's finished
+// recording files: it fires record_complete and, with storage configured,
+// uploads the file. vh is the stream's virtual host, nil for the default
+// host.
+func (s *Server) recordingClosedFunc(vh *vhost, streamKey string) func(info media.RecordingInfo) {
+	if s == nil {
+		return nil
+	}
+	return func(info media.RecordingInfo) {
+		s.triggerHookEvent(hooks.EventRecordComplete, "", streamKey, vh.hookData(map[string]interface{}{
+			"file":         info.Path,
+			"duration_sec": info.Duration.Seconds(),
+			"bytes":        info.Bytes,
+			"video_codec":  info.VideoCodec,
+			"audio_codec":  info.AudioCodec,
+			"video_frames": info.VideoFrames,
+			"audio_frames": info.AudioFrames,
+		}))
+		if s.recordStore != nil {
+			s.uploadRecording(vh, streamKey, info.Path)
+		}
+	}
+}
+
+// uploadRecording stores the file at path in the background, under the
+// name of vh, if any. Stop waits for uploads in flight (waitUploads).
+func (s *Server) uploadRecording(vh *vhost, streamKey, path string) {
+	s.uploads.Add(1)
+	go func() {
+		defer s.uploads.Done()
+		log := s.log.With("stream_key", streamKey, "file", path)
+
+		f, err := os.Open(path)
+		if err != nil {
+			metrics.RecordingErrorsTotal.Add(1)
+			log.Error("recording upload failed", "error", err)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			metrics.RecordingErrorsTotal.Add(1)
+			log.Error("recording upload failed", "error", err)
+			return
+		}
+
+		name := filepath.Base(path)
+		if vh != nil {
+			name = vh.name + "/" + name
+		}
+		url, err := s.recordStore.Put(s.uploadCtx, name, f, info.Size())
+		if err != nil {
+			metrics.RecordingErrorsTotal.Add(1)
+			log.Error("recording upload failed", "error", err)
+			return
+		}
+		log.Info("recording uploaded", "url", url, "bytes", info.Size())
+		s.triggerHookEvent(hooks.EventRecordingUploaded, "", streamKey, vh.hookData(map[string]interface{}{
+			"url":   url,
+			"file":  path,
+			"bytes": info.Size(),
+		}))
+	}()
+}
+
+// uploadCancelGrace is how long waitUploads waits for cancelled uploads to
+// return.
+const uploadCancelGrace = 5 * time.Second
+
+// waitUploads waits for the recording uploads in flight for up to
+// Config.RecordUploadStopTimeout, then cancels the rest and gives them
+// uploadCancelGrace to return.
+func (s *Server) waitUploads() {
+	done := make(chan struct{})
+	go func() {
+		s.uploads.Wait()
+		close(done)
+	}()
+	t := time.NewTimer(s.cfg.RecordUploadStopTimeout)
+	defer t.Stop()
+	select {
+	case <-done:
+		return
+	case <-t.C:
+	}
+	s.log.Warn("recording uploads still running, cancelling them", "timeout", s.cfg.RecordUploadStopTimeout)
+	s.cancelUploads()
+	select {
+	case <-done:
+	case <-time.After(uploadCancelGrace):
+		s.log.Warn("cancelled recording uploads did not return")
+	}
+}
+
+// closeNotifier calls onClosed with a description of the recording once
+// the wrapped single-file recorder has been closed successfully.
+type closeNotifier struct {
+	media.MediaWriter
+	path     string
+	onClosed func(info media.RecordingInfo)
+}
+
+func (n *closeNotifier) Close() error {
+	err := n.MediaWriter.Close()
+	if err == nil {
+		var info media.RecordingInfo
+		if r, ok := n.MediaWriter.(media.InfoReporter); ok {
+			info = r.Info()
+		}
+		info.Path = n.path
+		n.onClosed(info)
+	}
+	return err
+}
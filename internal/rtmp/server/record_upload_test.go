@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/media"
+	"github.com/alxayo/go-rtmp/internal/rtmp/server/hooks"
+)
+
+type nopRecorder struct{}
+
+func (nopRecorder) WriteMessage(*chunk.Message) {}
+func (nopRecorder) Close() error                { return nil }
+func (nopRecorder) Disabled() bool              { return false }
+
+// TestRecordingUpload verifies that closing a recording copies the file to
+// the configured storage and fires recording_uploaded with its URL.
+func TestRecordingUpload(t *testing.T) {
+	archive := t.TempDir()
+	s := New(Config{ListenAddr: "127.0.0.1:0", RecordStorage: "file://" + archive})
+	events, cancel := s.Subscribe(1, hooks.EventRecordingUploaded)
+	defer cancel()
+
+	path := filepath.Join(t.TempDir(), "live_test_20260101_000000.flv")
+	if err := os.WriteFile(path, []byte("FLV..."), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rec := &closeNotifier{MediaWriter: nopRecorder{}, path: path, onClosed: s.recordingClosedFunc(nil, "live/test")}
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	s.uploads.Wait()
+
+	got, err := os.ReadFile(filepath.Join(archive, filepath.Base(path)))
+	if err != nil || string(got) != "FLV..." {
+		t.Fatalf("archived file = %q, %v", got, err)
+	}
+	select {
+	case e := <-events:
+		url, _ := e.Data["url"].(string)
+		if e.StreamKey != "live/test" || !strings.HasSuffix(url, "/live_test_20260101_000000.flv") {
+			t.Fatalf("event = %+v", e)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no recording_uploaded event")
+	}
+}
+
+// blockingStore is a storage.Store whose Put blocks until its context is
+// cancelled.
+type blockingStore struct{ started chan struct{} }
+
+func (b blockingStore) Put(ctx context.Context, _ string, _ io.Reader, _ int64) (string, error) {
+	close(b.started)
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+// TestStopCancelsUploads verifies that Stop gives up on an upload that
+// outlasts RecordUploadStopTimeout instead of waiting for it forever.
+func TestStopCancelsUploads(t *testing.T) {
+	s := New(Config{ListenAddr: "127.0.0.1:0", RecordUploadStopTimeout: 50 * time.Millisecond})
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	store := blockingStore{started: make(chan struct{})}
+	s.recordStore = store
+
+	path := filepath.Join(t.TempDir(), "live_test_20260101_000000.flv")
+	if err := os.WriteFile(path, []byte("FLV..."), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s.uploadRecording(nil, "live/test", path)
+	<-store.started
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- s.Stop() }()
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Fatalf("Stop: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop waited for the blocked upload")
+	}
+}
+
+// TestRecordComplete verifies that closing a recording fires
+// record_complete with the recorder's description of the file, with or
+// without RecordStorage.
+func TestRecordComplete(t *testing.T) {
+	s := New(Config{ListenAddr: "127.0.0.1:0"})
+	events, cancel := s.Subscribe(1, hooks.EventRecordComplete)
+	defer cancel()
+
+	path := filepath.Join(t.TempDir(), "live_test_20260101_000000.flv")
+	flv, err := media.NewFLVRecorder(path, nil, media.FLVMetadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	flv.WriteMessage(&chunk.Message{TypeID: 9, Timestamp: 0, Payload: []byte{0x17, 0x01, 0x01}})
+	flv.WriteMessage(&chunk.Message{TypeID: 8, Timestamp: 500, Payload: []byte{0xAF, 0x01, 0x02}})
+	flv.WriteMessage(&chunk.Message{TypeID: 9, Timestamp: 1500, Payload: []byte{0x27, 0x01, 0x03}})
+	rec := &closeNotifier{MediaWriter: flv, path: path, onClosed: s.recordingClosedFunc(nil, "live/test")}
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case e := <-events:
+		want := map[string]interface{}{
+			"file": path, "duration_sec": 1.5, "bytes": info.Size(),
+			"video_codec": "H264", "audio_codec": "AAC", "video_frames": 2, "audio_frames": 1,
+		}
+		if e.StreamKey != "live/test" || !reflect.DeepEqual(e.Data, want) {
+			t.Fatalf("event = %+v, want data %v", e, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no record_complete event")
+	}
+}
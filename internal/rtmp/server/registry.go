@@ -10,13 +10,30 @@ package server
 // Concurrency model: sync.RWMutex guards the map. Per-stream mutable slices
 // are guarded by the stream's own mutex (so that subscriber operations do not
 // serialize across different streams).
+//
+// Lifecycle: a stream is idle until its first publisher starts, publishing
+// while one is active, and ended once the publisher leaves. Ending a stream
+// drops its cached codec state and tells subscribers with
+// NetStream.Play.UnpublishNotify; players joining an ended stream get
+// StreamNotFound. A new publisher moves it back to publishing.
+//
+// A stream's references are its publisher and subscribers (RefCount).
+// CollectEmpty removes streams that have had none for a while, whether
+// ended or never published, so keys nobody uses do not pile up. A stream
+// looked up just before it is collected refuses a new publisher or player
+// with ErrStreamCollected, and the handlers look the key up again.
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log/slog"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/alxayo/go-rtmp/internal/logger"
 	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
 	"github.com/alxayo/go-rtmp/internal/rtmp/media"
 	"github.com/alxayo/go-rtmp/internal/rtmp/metrics"
@@ -25,15 +42,101 @@ import (
 // ErrPublisherExists is returned when trying to set a second publisher.
 var ErrPublisherExists = errors.New("publisher already registered for stream")
 
+// ErrStreamCollected is returned when adding a publisher or player to a
+// stream CollectEmpty has removed from the registry; look the key up again.
+var ErrStreamCollected = errors.New("stream was removed from the registry")
+
+// StreamState is the publish lifecycle state of a Stream.
+type StreamState int
+
+const (
+	StreamIdle       StreamState = iota // created, no publisher yet
+	StreamPublishing                    // a publisher is active
+	StreamEnded                         // the publisher left; waiting for a new one or collection
+)
+
+// String returns the state name used in logs and metrics.
+func (st StreamState) String() string {
+	switch st {
+	case StreamIdle:
+		return "idle"
+	case StreamPublishing:
+		return "publishing"
+	case StreamEnded:
+		return "ended"
+	default:
+		return "unknown"
+	}
+}
+
 // Registry holds all active streams keyed by stream key.
 type Registry struct {
 	mu      sync.RWMutex
 	streams map[string]*Stream
+
+	// variantSep enables multi-bitrate grouping when non-empty (see variants.go).
+	variantSep string
+
+	// mediaDiagnostics turns on per-packet media diagnostics for streams
+	// created after SetMediaDiagnostics.
+	mediaDiagnostics bool
+
+	// dvrWindow is the DVR buffer length of streams created after
+	// SetDVRWindow (dvr.go); zero disables it.
+	dvrWindow time.Duration
+
+	// interceptors run on every published message (intercept.go).
+	interceptors interceptors
+
+	// vhost names the virtual host the registry belongs to (vhost.go);
+	// empty for the default host.
+	vhost string
+
+	// maxSubscribers and appMaxSubscribers limit the players per stream,
+	// server-wide and per app (subscriber_limit.go); zero is no limit.
+	maxSubscribers    int
+	appMaxSubscribers map[string]int
+
+	// txnMode is the transaction ID mode of the onStatus HandlePublish and
+	// HandlePlay answer with (SetStatusTxnMode).
+	txnMode string
+
+	// thumbnails makes streams created after SetThumbnails keep their
+	// latest keyframe (thumbnail.go).
+	thumbnails bool
+
+	// recordings remembers each stream's latest FLV recording for publish
+	// type "append" (record_control.go).
+	recordings recordingPaths
 }
 
 // NewRegistry creates an empty registry.
 func NewRegistry() *Registry { return &Registry{streams: make(map[string]*Stream)} }
 
+// SetMediaDiagnostics enables debug logs of each media packet's parsed tag
+// header (codec, frame and packet type) for streams created after the call.
+// They are sampled like other per-packet debug logs and need debug level.
+func (r *Registry) SetMediaDiagnostics(on bool) {
+	r.mu.Lock()
+	r.mediaDiagnostics = on
+	r.mu.Unlock()
+}
+
+// SetStatusTxnMode sets the transaction ID of the onStatus that
+// HandlePublish and HandlePlay answer with: rpc.TxnModeZero (or empty)
+// sends 0, rpc.TxnModeEcho the command's own ID.
+func (r *Registry) SetStatusTxnMode(mode string) {
+	r.mu.Lock()
+	r.txnMode = mode
+	r.mu.Unlock()
+}
+
+func (r *Registry) statusTxnMode() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.txnMode
+}
+
 // Stream represents a published live stream with its publisher, subscribers,
 // codec info, and optional FLV recorder.
 //
@@ -43,6 +146,8 @@ func NewRegistry() *Registry { return &Registry{streams: make(map[string]*Stream
 // decoder can initialize without waiting for the next keyframe.
 type Stream struct {
 	Key         string             // unique identifier: "app/streamName" (e.g. "live/mystream")
+	Group       string             // logical stream this is a variant of (e.g. "live/show"); empty if ungrouped
+	Variant     string             // rendition label within Group (e.g. "720p"); empty if ungrouped
 	Publisher   interface{}        // the connection that is publishing media to this stream
 	Subscribers []media.Subscriber // connections that are playing/watching this stream
 	VideoCodec  string             // detected video codec (e.g. "H264", "HEVC")
@@ -59,12 +164,48 @@ type Stream struct {
 	// Only used when SegmentDuration > 0.
 	SegmentPattern string
 
+	// RecordFormat is the container of the recording, "flv" or "mp4";
+	// empty chooses from the video codec (Config.RecordFormat).
+	RecordFormat string
+
+	// RecordTimecode keeps onFI timecodes in FLV recordings
+	// (Config.RecordTimecode).
+	RecordTimecode bool
+
+	// RecordQueueSize is the recorder's write queue length in messages.
+	RecordQueueSize int
+
+	// RecordingClosed, if set, is called with each finished recording file
+	// (whole recording or segment), e.g. to report or upload it.
+	RecordingClosed func(info media.RecordingInfo)
+
+	// RecordAppend continues the stream's latest FLV recording in RecordDir
+	// instead of starting a new file (publish type "append").
+	RecordAppend bool
+
+	// recordSync is set whenever a recording is requested: the recording
+	// opens at a video keyframe, from recordGOP or the next one, and is
+	// shifted back by recordBase, its timestamp, to start at zero
+	// (record_control.go).
+	recordSync bool
+	recordBase uint32
+
+	// recordGOP is the media since the last video keyframe, starting with
+	// it, for recordings that start mid-stream; recordGOPBytes is its
+	// payload size.
+	recordGOP      []*chunk.Message
+	recordGOPBytes int
+
 	// Cached sequence headers for late-joining subscribers.
 	// Sequence headers contain codec configuration (H.264 SPS/PPS, AAC AudioSpecificConfig)
 	// that decoders need before they can process media frames.
 	AudioSequenceHeader *chunk.Message
 	VideoSequenceHeader *chunk.Message
 
+	// Metadata is the publisher's latest onMetaData properties (nil until
+	// received). Recordings merge it into their own onMetaData tag.
+	Metadata map[string]interface{}
+
 	// Per-track sequence headers for multitrack E-RTMP v2 streams.
 	// Key is the track ID (uint8). Track 0 is also stored in the
 	// single-track VideoSequenceHeader/AudioSequenceHeader fields
@@ -74,6 +215,95 @@ type Stream struct {
 	VideoTrackHeaders map[uint8][]byte // track ID → Enhanced RTMP video sequence start payload
 	AudioTrackHeaders map[uint8][]byte // track ID → Enhanced RTMP audio sequence start payload
 
+	// VideoFourCCHeaders holds the latest video sequence header of each
+	// codec, keyed by FourCC ("avc1" and "hvc1" for legacy AVC and HEVC).
+	// VideoSequenceHeader follows the codec of the frames being sent
+	// (see enhanced_video.go). Nil until the first header.
+	VideoFourCCHeaders map[string]*chunk.Message
+
+	// timecode is the latest onFI timecode of the publish (timecode.go);
+	// nil until the first.
+	timecode *TimecodeInfo
+
+	// keyframe is the latest H.264 IDR keyframe of the publish, and
+	// thumbnail the latest JPEG made of one (thumbnail.go). thumbnails
+	// (Registry.SetThumbnails) keeps keyframes; fixed at creation.
+	keyframe   *Keyframe
+	thumbnail  *thumbnail
+	thumbnails bool
+
+	// invalidVideoWarned is set once an invalid Enhanced RTMP video frame
+	// has been logged at warning level; later ones are sampled debug logs.
+	invalidVideoWarned atomic.Bool
+
+	// pausedSubs tracks subscribers that sent "pause". A value of true means
+	// paused (all media skipped); false means resumed but waiting for the next
+	// video keyframe so decoding restarts cleanly. Nil until first pause.
+	pausedSubs map[media.Subscriber]bool
+
+	// subStreamIDs maps subscribers to the message stream ID they issued
+	// play on, so broadcast media is delivered on that stream rather than
+	// the publisher's. Subscribers without an entry get the publisher's ID.
+	subStreamIDs map[media.Subscriber]uint32
+
+	// subMedia holds the track selection of subscribers that do not take
+	// both tracks (media_filter.go).
+	subMedia map[media.Subscriber]MediaFilter
+
+	// dropCounters counts deliveries and drops per subscriber (drops.go);
+	// audioDrops and videoDrops are the stream's totals.
+	dropCounters map[media.Subscriber]*dropCounter
+	audioDrops   atomic.Uint64
+	videoDrops   atomic.Uint64
+
+	state   StreamState // publish lifecycle state (see StreamState)
+	endedAt time.Time   // when the stream entered StreamEnded
+
+	// emptySince is when the stream last lost its publisher and
+	// subscribers (its creation until it gets any). Only meaningful
+	// while RefCount is zero.
+	emptySince time.Time
+
+	// collected is set when CollectEmpty removes the stream. A publisher
+	// or player added to it could not be found, so adds are refused.
+	collected bool
+
+	// timestamps re-bases publisher timestamps onto one monotonic timeline
+	// that survives publisher reconnects (see NormalizeTimestamp).
+	timestamps media.TimestampNormalizer
+
+	// avsync tracks the drift between the audio and video timestamps
+	// (avsync.go).
+	avsync avSync
+
+	// lastMedia is when the publisher last sent audio or video (UnixNano),
+	// zero until a new publisher's first media; see LastMediaAt.
+	lastMedia atomic.Int64
+
+	// packetLogs samples the per-packet debug logs in BroadcastMessage so
+	// debug level stays usable on busy streams (logger.SetDebugSampling).
+	packetLogs logger.Sampler
+
+	// diagnostics logs the parsed tag header of sampled media packets
+	// (Registry.SetMediaDiagnostics). Fixed at creation.
+	diagnostics bool
+
+	// dvr buffers recent media for time-shifted playback (dvr.go); nil
+	// unless Registry.SetDVRWindow was set at creation. dvrSubs are the
+	// subscribers fed from it.
+	dvr     *dvrBuffer
+	dvrSubs map[media.Subscriber]bool
+
+	// interceptors is the registry's interceptor chain (intercept.go).
+	interceptors *interceptors
+
+	// recordings is the registry's record of each stream's latest FLV
+	// recording (record_control.go).
+	recordings *recordingPaths
+
+	// vhost names the stream's virtual host; empty for the default host.
+	vhost string
+
 	mu sync.RWMutex // protects concurrent access to Subscribers and Publisher
 }
 
@@ -97,18 +327,48 @@ func (r *Registry) CreateStream(key string) (*Stream, bool) {
 	if s, ok := r.streams[key]; ok { // double‑check
 		return s, false
 	}
+	group, variant, _ := ParseVariantKey(key, r.variantSep)
+	now := time.Now()
 	s := &Stream{
 		Key:               key,
-		StartTime:         time.Now(),
+		Group:             group,
+		Variant:           variant,
+		StartTime:         now,
+		emptySince:        now,
 		Subscribers:       make([]media.Subscriber, 0),
 		VideoTrackHeaders: make(map[uint8][]byte),
 		AudioTrackHeaders: make(map[uint8][]byte),
+		diagnostics:       r.mediaDiagnostics,
+		thumbnails:        r.thumbnails,
+		interceptors:      &r.interceptors,
+		recordings:        &r.recordings,
+		vhost:             r.vhost,
+	}
+	if r.dvrWindow > 0 {
+		s.dvr = &dvrBuffer{window: r.dvrWindow}
 	}
 	r.streams[key] = s
 	metrics.StreamsActive.Add(1)
 	return s, true
 }
 
+// PublishStream looks up or creates the stream for key and makes pub its
+// publisher (Stream.SetPublisher). A stream CollectEmpty removes between
+// the lookup and SetPublisher is looked up afresh. It returns the stream
+// (nil only for an empty key) and SetPublisher's error, e.g.
+// ErrPublisherExists.
+func (r *Registry) PublishStream(key string, pub interface{}) (*Stream, error) {
+	for {
+		s, _ := r.CreateStream(key)
+		if s == nil {
+			return nil, errors.New("empty stream key")
+		}
+		if err := s.SetPublisher(pub); !errors.Is(err, ErrStreamCollected) {
+			return s, err
+		}
+	}
+}
+
 // GetStream returns the stream for key or nil if absent.
 func (r *Registry) GetStream(key string) *Stream {
 	r.mu.RLock()
@@ -131,14 +391,158 @@ func (r *Registry) DeleteStream(key string) bool {
 	return false
 }
 
+// LivePublishers returns how many streams of app ("app/..." keys) have a
+// live publisher.
+func (r *Registry) LivePublishers(app string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	n := 0
+	for key, s := range r.streams {
+		if strings.HasPrefix(key, app+"/") && s.State() == StreamPublishing {
+			n++
+		}
+	}
+	return n
+}
+
+// liveStreams returns the streams that have a live publisher.
+func (r *Registry) liveStreams() []*Stream {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var live []*Stream
+	for _, s := range r.streams {
+		if s.State() == StreamPublishing {
+			live = append(live, s)
+		}
+	}
+	return live
+}
+
+// CollectedStream describes a stream removed by CollectEmpty.
+type CollectedStream struct {
+	Key   string
+	State StreamState   // StreamIdle (never published) or StreamEnded
+	Empty time.Duration // how long it had no publisher and no subscribers
+}
+
+// CollectEmpty removes streams that have had no references (RefCount) for
+// at least ttl and returns them. An ended stream still watched is kept so
+// its players resume if the publisher comes back.
+func (r *Registry) CollectEmpty(ttl time.Duration) []CollectedStream {
+	now := time.Now()
+	cutoff := now.Add(-ttl)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var removed []CollectedStream
+	for key, s := range r.streams {
+		s.mu.Lock()
+		expired := s.Publisher == nil && len(s.Subscribers) == 0 && !s.emptySince.After(cutoff)
+		c := CollectedStream{Key: key, State: s.state, Empty: now.Sub(s.emptySince)}
+		s.collected = s.collected || expired
+		s.mu.Unlock()
+		if expired {
+			delete(r.streams, key)
+			metrics.StreamsActive.Add(-1)
+			metrics.StreamsCollectedTotal.Add(1)
+			removed = append(removed, c)
+		}
+	}
+	return removed
+}
+
+// RegistryStats counts a registry's streams by state. Empty counts the
+// streams with no publisher and no subscribers, due for collection.
+type RegistryStats struct {
+	Streams    int `json:"streams"`
+	Idle       int `json:"idle"`
+	Publishing int `json:"publishing"`
+	Ended      int `json:"ended"`
+	Empty      int `json:"empty"`
+}
+
+// add adds o's counts to st.
+func (st *RegistryStats) add(o RegistryStats) {
+	st.Streams += o.Streams
+	st.Idle += o.Idle
+	st.Publishing += o.Publishing
+	st.Ended += o.Ended
+	st.Empty += o.Empty
+}
+
+// Stats returns the registry's stream counts. Safe for concurrent use.
+func (r *Registry) Stats() RegistryStats {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	st := RegistryStats{Streams: len(r.streams)}
+	for _, s := range r.streams {
+		s.mu.RLock()
+		switch s.state {
+		case StreamIdle:
+			st.Idle++
+		case StreamPublishing:
+			st.Publishing++
+		case StreamEnded:
+			st.Ended++
+		}
+		if s.Publisher == nil && len(s.Subscribers) == 0 {
+			st.Empty++
+		}
+		s.mu.RUnlock()
+	}
+	return st
+}
+
 // StreamInfo represents a point-in-time snapshot of a stream for the metrics endpoint.
 type StreamInfo struct {
 	Key           string `json:"key"`
+	VHost         string `json:"vhost,omitempty"` // virtual host; empty for the default host
+	Group         string `json:"group,omitempty"`
+	Variant       string `json:"variant,omitempty"`
 	Subscribers   int    `json:"subscribers"`
 	VideoCodec    string `json:"video_codec,omitempty"`
 	AudioCodec    string `json:"audio_codec,omitempty"`
 	UptimeSeconds int64  `json:"uptime_seconds"`
 	Recording     bool   `json:"recording"`
+	State         string `json:"state"`
+
+	// Latency is the ingest-to-subscriber delivery latency over recent
+	// media messages of all subscribers; nil without samples (latency
+	// tracking disabled or no subscribers).
+	Latency *metrics.LatencyStats `json:"latency,omitempty"`
+
+	// AudioDrops and VideoDrops count media messages dropped for slow
+	// subscribers since the stream was created; SubscriberDrops lists the
+	// current subscribers that dropped any.
+	AudioDrops      uint64               `json:"audio_drops"`
+	VideoDrops      uint64               `json:"video_drops"`
+	SubscriberDrops []SubscriberDropInfo `json:"subscriber_drops,omitempty"`
+
+	// AVDriftMs is how far the video timestamps run ahead of the audio
+	// ones (negative: behind); nil unless both tracks are flowing.
+	// AVDriftWarning is set while the drift is beyond
+	// Config.AVDriftThreshold (avsync.go).
+	AVDriftMs      *int64 `json:"av_drift_ms,omitempty"`
+	AVDriftWarning bool   `json:"av_drift_warning,omitempty"`
+
+	// DVRSeconds and DVRBytes describe the DVR buffer (Config.DVRWindow).
+	DVRSeconds float64 `json:"dvr_seconds,omitempty"`
+	DVRBytes   int     `json:"dvr_bytes,omitempty"`
+
+	// Timecode is the latest onFI timecode of the publisher; nil when it
+	// sends none.
+	Timecode *TimecodeInfo `json:"timecode,omitempty"`
+}
+
+// streamEOFSender is implemented by subscribers that can signal the end of
+// playback on a message stream (conn.Connection).
+type streamEOFSender interface {
+	SendStreamEOF(streamID uint32) error
+}
+
+// latencyReporter is implemented by subscribers that measure delivery
+// latency (conn.Connection).
+type latencyReporter interface {
+	WriteLatency() *metrics.LatencyWindow
 }
 
 // Snapshot returns a point-in-time view of all active streams for the
@@ -153,29 +557,61 @@ func (r *Registry) Snapshot() []StreamInfo {
 		s.mu.RLock()
 		info := StreamInfo{
 			Key:           s.Key,
+			VHost:         r.vhost,
+			Group:         s.Group,
+			Variant:       s.Variant,
 			Subscribers:   len(s.Subscribers),
 			VideoCodec:    s.VideoCodec,
 			AudioCodec:    s.AudioCodec,
 			UptimeSeconds: int64(now.Sub(s.StartTime).Seconds()),
 			Recording:     s.Recorder != nil,
+			State:         s.state.String(),
+			AudioDrops:    s.audioDrops.Load(),
+			VideoDrops:    s.videoDrops.Load(),
+			Timecode:      s.timecode,
+		}
+		info.SubscriberDrops = s.subscriberDropsLocked()
+		if drift, ok := s.avsync.drift(now); ok {
+			info.AVDriftMs = &drift
+			info.AVDriftWarning = s.avsync.drifting
+		}
+		if s.dvr != nil {
+			info.DVRSeconds, info.DVRBytes = s.dvr.duration().Seconds(), s.dvr.bytes
+		}
+		var windows []*metrics.LatencyWindow
+		for _, sub := range s.Subscribers {
+			if lr, ok := sub.(latencyReporter); ok {
+				windows = append(windows, lr.WriteLatency())
+			}
 		}
 		s.mu.RUnlock()
+		if stats := metrics.MergeLatency(windows...); stats.Samples > 0 {
+			info.Latency = &stats
+		}
 		infos = append(infos, info)
 	}
 	return infos
 }
 
-// SetPublisher sets the publisher if empty else returns ErrPublisherExists.
+// SetPublisher sets the publisher if empty else returns ErrPublisherExists,
+// or ErrStreamCollected if the stream is no longer in the registry
+// (Registry.PublishStream looks it up again).
 func (s *Stream) SetPublisher(pub interface{}) error {
 	if s == nil || pub == nil {
 		return nil
 	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if s.collected {
+		return ErrStreamCollected
+	}
 	if s.Publisher != nil {
 		return ErrPublisherExists
 	}
 	s.Publisher = pub
+	s.state = StreamPublishing
+	s.lastMedia.Store(0)
+	s.avsync.reset()
 	metrics.PublishersActive.Add(1)
 	metrics.PublishersTotal.Add(1)
 	return nil
@@ -199,6 +635,9 @@ func (s *Stream) EvictPublisher(newPub interface{}) (oldPub interface{}) {
 	defer s.mu.Unlock()
 	oldPub = s.Publisher
 	s.Publisher = newPub
+	s.state = StreamPublishing
+	s.lastMedia.Store(0)
+	s.avsync.reset()
 	if oldPub == nil {
 		// No previous publisher — this is equivalent to a fresh SetPublisher.
 		metrics.PublishersActive.Add(1)
@@ -209,16 +648,160 @@ func (s *Stream) EvictPublisher(newPub interface{}) (oldPub interface{}) {
 	return oldPub
 }
 
+// State returns the stream's lifecycle state.
+func (s *Stream) State() StreamState {
+	if s == nil {
+		return StreamIdle
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state
+}
+
+// LastMediaAt returns when the publisher last sent audio or video. Zero if
+// the current publisher has sent none yet.
+func (s *Stream) LastMediaAt() time.Time {
+	if s == nil {
+		return time.Time{}
+	}
+	if ns := s.lastMedia.Load(); ns != 0 {
+		return time.Unix(0, ns)
+	}
+	return time.Time{}
+}
+
+// SetMetadata records the publisher's onMetaData properties.
+func (s *Stream) SetMetadata(props map[string]interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.Metadata = props
+	s.mu.Unlock()
+}
+
+// NormalizeTimestamp rewrites m.Timestamp onto the stream's monotonic
+// timeline, smoothing over encoder resets, publisher reconnects and 32-bit
+// rollover. It reports whether a discontinuity was re-based. Call it once
+// per published media message, before it is broadcast, recorded or relayed.
+// The original timestamp also feeds the A/V drift monitor (avsync.go).
+func (s *Stream) NormalizeTimestamp(m *chunk.Message) bool {
+	if s == nil || m == nil {
+		return false
+	}
+	s.mu.Lock()
+	s.avsync.record(m, time.Now())
+	ts, rebased := s.timestamps.Normalize(m.Timestamp)
+	s.mu.Unlock()
+	m.Timestamp = ts
+	return rebased
+}
+
+// EndPublish ends the stream if pub is still its publisher: the publisher
+// slot is cleared, cached sequence headers and codecs are dropped so a
+// later publisher starts clean, and every subscriber is sent
+// NetStream.Play.UnpublishNotify and a Stream EOF. Subscribers stay
+// attached and resume receiving media if a new publisher takes over.
+// Returns false (doing nothing) when pub was already replaced, e.g. by
+// EvictPublisher.
+func (s *Stream) EndPublish(pub interface{}) bool {
+	if s == nil || pub == nil {
+		return false
+	}
+	s.mu.Lock()
+	if s.Publisher != pub {
+		s.mu.Unlock()
+		return false
+	}
+	s.Publisher = nil
+	metrics.PublishersActive.Add(-1)
+	s.state = StreamEnded
+	s.endedAt = time.Now()
+	if len(s.Subscribers) == 0 {
+		s.emptySince = s.endedAt
+	}
+	s.AudioSequenceHeader = nil
+	s.VideoSequenceHeader = nil
+	s.Metadata = nil
+	s.AudioCodec = ""
+	s.VideoCodec = ""
+	s.VideoTrackHeaders = make(map[uint8][]byte)
+	s.AudioTrackHeaders = make(map[uint8][]byte)
+	s.VideoFourCCHeaders = nil
+	s.timecode = nil
+	s.keyframe = nil
+	s.thumbnail = nil
+	s.invalidVideoWarned.Store(false)
+	s.clearRecordGOP()
+	subs := make([]media.Subscriber, 0, len(s.Subscribers))
+	for _, sub := range s.Subscribers {
+		if !s.dvrSubs[sub] { // told by their DVR session once caught up
+			subs = append(subs, sub)
+		}
+	}
+	streamIDs := make(map[media.Subscriber]uint32, len(s.subStreamIDs))
+	for sub, id := range s.subStreamIDs {
+		streamIDs[sub] = id
+	}
+	s.mu.Unlock()
+
+	for _, sub := range subs {
+		id, ok := streamIDs[sub]
+		if !ok {
+			id = 1 // conventional first stream ID
+		}
+		if m, err := buildOnStatus(id, s.Key, "NetStream.Play.UnpublishNotify", fmt.Sprintf("%s is now unpublished.", s.Key)); err == nil {
+			_ = sub.SendMessage(m)
+		}
+		if eof, ok := sub.(streamEOFSender); ok {
+			_ = eof.SendStreamEOF(id)
+		}
+	}
+	return true
+}
+
+// RefCount returns the number of references the stream holds: its
+// publisher, if any, and its subscribers. A stream whose count stays zero
+// is removed by Registry.CollectEmpty.
+func (s *Stream) RefCount() int {
+	if s == nil {
+		return 0
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	n := len(s.Subscribers)
+	if s.Publisher != nil {
+		n++
+	}
+	return n
+}
+
 // AddSubscriber adds a subscriber (ignoring nil) in a thread‑safe manner.
 func (s *Stream) AddSubscriber(sub media.Subscriber) {
 	if s == nil || sub == nil {
 		return
 	}
 	s.mu.Lock()
+	s.addSubscriberLocked(sub)
+	s.mu.Unlock()
+}
+
+// addSubscriberLocked adds sub; s.mu must be held.
+func (s *Stream) addSubscriberLocked(sub media.Subscriber) {
 	s.Subscribers = append(s.Subscribers, sub)
+	if s.dropCounters == nil {
+		s.dropCounters = make(map[media.Subscriber]*dropCounter)
+	}
+	s.dropCounters[sub] = &dropCounter{}
 	metrics.SubscribersActive.Add(1)
 	metrics.SubscribersTotal.Add(1)
-	s.mu.Unlock()
+}
+
+// AddStreamSubscriber adds sub like AddSubscriber and delivers media to it
+// on message stream streamID, the stream the subscriber issued play on. It
+// does nothing if the stream was collected.
+func (s *Stream) AddStreamSubscriber(sub media.Subscriber, streamID uint32) {
+	_ = s.addStreamSubscriberLimit(sub, streamID, 0, false)
 }
 
 // RemoveSubscriber removes the first matching subscriber reference (identity
@@ -238,12 +821,69 @@ func (s *Stream) RemoveSubscriber(sub media.Subscriber) {
 			s.Subscribers[last] = nil
 			s.Subscribers = s.Subscribers[:last]
 			metrics.SubscribersActive.Add(-1)
+			if last == 0 && s.Publisher == nil {
+				s.emptySince = time.Now()
+			}
 			break
 		}
 	}
+	delete(s.pausedSubs, sub)
+	delete(s.subStreamIDs, sub)
+	delete(s.subMedia, sub)
+	delete(s.dropCounters, sub)
+	delete(s.dvrSubs, sub)
+	s.mu.Unlock()
+}
+
+// PauseSubscriber stops delivering media to sub until ResumeSubscriber is
+// called. Media published in the meantime is skipped, not buffered, so a
+// live viewer resumes at the live edge.
+func (s *Stream) PauseSubscriber(sub media.Subscriber) {
+	if s == nil || sub == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.pausedSubs == nil {
+		s.pausedSubs = make(map[media.Subscriber]bool)
+	}
+	s.pausedSubs[sub] = true
+	s.mu.Unlock()
+}
+
+// ResumeSubscriber re-enables delivery to a paused subscriber. Audio flows
+// immediately; video resumes at the next keyframe.
+func (s *Stream) ResumeSubscriber(sub media.Subscriber) {
+	if s == nil || sub == nil {
+		return
+	}
+	s.mu.Lock()
+	if _, ok := s.pausedSubs[sub]; ok {
+		s.pausedSubs[sub] = false
+	}
 	s.mu.Unlock()
 }
 
+// skipForPause reports whether msg should be withheld from a subscriber in
+// the given pause state, clearing the state once a keyframe arrives.
+// Caller must not hold s.mu.
+func (s *Stream) skipForPause(sub media.Subscriber, paused bool, msg *chunk.Message) bool {
+	if paused {
+		return true
+	}
+	if msg.TypeID != 9 || media.IsVideoSequenceHeader(msg.Payload) {
+		return false
+	}
+	if !media.IsVideoKeyframe(msg.Payload) {
+		return true
+	}
+	s.mu.Lock()
+	if p, ok := s.pausedSubs[sub]; ok && !p {
+		delete(s.pausedSubs, sub)
+	}
+	s.mu.Unlock()
+	return false
+}
+
 // SubscriberCount returns a snapshot count of subscribers.
 func (s *Stream) SubscriberCount() int {
 	if s == nil {
@@ -315,10 +955,49 @@ func (s *Stream) StreamKey() string {
 	return s.Key
 }
 
+// samplePacketLog reports whether a per-packet debug log should be written:
+// debug is enabled for l and this packet is the sampled one. Checking the
+// level first keeps the sampler from advancing when nothing would be logged.
+func (s *Stream) samplePacketLog(l *slog.Logger) bool {
+	return l.Enabled(context.Background(), slog.LevelDebug) && s.packetLogs.Allow()
+}
+
+// logPacketDiagnostics logs the parsed tag header of an audio or video
+// message.
+func (s *Stream) logPacketDiagnostics(msg *chunk.Message, l *slog.Logger) {
+	if msg.TypeID == 9 {
+		if vm, err := media.ParseVideoMessage(msg.Payload); err == nil {
+			l.Debug("Video packet",
+				"stream_key", s.Key,
+				"enhanced", vm.Enhanced,
+				"codec", vm.Codec,
+				"frame_type", vm.FrameType,
+				"packet_type", vm.PacketType,
+				"fourcc", vm.FourCC,
+				"payload_len", len(msg.Payload),
+				sampledAttr())
+		}
+		return
+	}
+	if am, err := media.ParseAudioMessage(msg.Payload); err == nil {
+		l.Debug("Audio packet",
+			"stream_key", s.Key,
+			"codec", am.Codec,
+			"packet_type", am.PacketType,
+			"payload_len", len(msg.Payload),
+			sampledAttr())
+	}
+}
+
+// sampledAttr records on a sampled log how many events it stands for.
+func sampledAttr() slog.Attr { return slog.Int("sampled", logger.DebugSampling()) }
+
 // BroadcastMessage relays a publisher's media message to all current subscribers.
 // It also performs one-shot codec detection on the first audio/video frames.
 // This implementation mirrors media.Stream.BroadcastMessage but operates on
 // server.Stream which has additional fields for recording, metadata, etc.
+// Subscribers that fall behind shed whole GOPs rather than single frames
+// (see drops.go).
 func (s *Stream) BroadcastMessage(detector *media.CodecDetector, msg *chunk.Message, logger *slog.Logger) {
 	if s == nil || msg == nil || logger == nil {
 		return
@@ -326,6 +1005,7 @@ func (s *Stream) BroadcastMessage(detector *media.CodecDetector, msg *chunk.Mess
 
 	// Codec detection (first frame logic handled inside detector via empty codec check).
 	if msg.TypeID == 8 || msg.TypeID == 9 {
+		s.lastMedia.Store(time.Now().UnixNano())
 		if detector == nil {
 			detector = &media.CodecDetector{}
 		}
@@ -336,18 +1016,9 @@ func (s *Stream) BroadcastMessage(detector *media.CodecDetector, msg *chunk.Mess
 	// Uses media.IsVideoSequenceHeader / media.IsAudioSequenceHeader helpers
 	// which support both legacy (AVC/AAC) and Enhanced RTMP (FourCC) formats.
 	if msg.TypeID == 9 && media.IsVideoSequenceHeader(msg.Payload) {
-		s.mu.Lock()
-		s.VideoSequenceHeader = &chunk.Message{
-			CSID:            msg.CSID,
-			TypeID:          msg.TypeID,
-			Timestamp:       msg.Timestamp,
-			MessageStreamID: msg.MessageStreamID,
-			MessageLength:   msg.MessageLength,
-			Payload:         make([]byte, len(msg.Payload)),
-		}
-		copy(s.VideoSequenceHeader.Payload, msg.Payload)
-		s.mu.Unlock()
-		logger.Info("Cached video sequence header", "stream_key", s.Key, "size", len(msg.Payload))
+		// Also keyed by FourCC, after validating AV1/VP9 configuration
+		// records (see enhanced_video.go).
+		s.cacheVideoSequenceHeader(msg, logger)
 	} else if msg.TypeID == 9 && media.IsVideoMultitrack(msg.Payload) {
 		// Multitrack video: parse individual tracks and cache any sequence start
 		// headers per track. This enables late-joining subscribers to receive
@@ -369,66 +1040,121 @@ func (s *Stream) BroadcastMessage(detector *media.CodecDetector, msg *chunk.Mess
 	} else if msg.TypeID == 8 && media.IsAudioMultitrack(msg.Payload) {
 		// Multitrack audio: same per-track caching as video.
 		s.cacheMultitrackAudioHeaders(msg, logger)
+	} else if msg.TypeID == 9 {
+		s.followVideoCodec(msg, logger)
+		s.captureKeyframe(msg)
 	}
 
-	// DIAGNOSTIC: Log parsed video packet details for debugging.
-	if msg.TypeID == 9 && len(msg.Payload) > 0 {
-		if vm, err := media.ParseVideoMessage(msg.Payload); err == nil {
-			logger.Debug("Video packet",
-				"enhanced", vm.Enhanced,
-				"codec", vm.Codec,
-				"frame_type", vm.FrameType,
-				"packet_type", vm.PacketType,
-				"fourcc", vm.FourCC,
-				"payload_len", len(msg.Payload))
-		}
+	s.bufferDVR(msg)
+	s.bufferRecordGOP(msg)
+
+	// Media diagnostics: parsing the tag header costs more than the rest of
+	// the broadcast, so it only happens when enabled, at debug level and for
+	// the sampled packets.
+	if s.diagnostics && (msg.TypeID == 8 || msg.TypeID == 9) && len(msg.Payload) > 0 && s.samplePacketLog(logger) {
+		s.logPacketDiagnostics(msg, logger)
 	}
 
 	// Snapshot subscribers under read lock to avoid holding lock during I/O.
 	s.mu.RLock()
 	subs := make([]media.Subscriber, len(s.Subscribers))
 	copy(subs, s.Subscribers)
+	var paused map[media.Subscriber]bool
+	if len(s.pausedSubs) > 0 {
+		paused = make(map[media.Subscriber]bool, len(s.pausedSubs))
+		for sub, p := range s.pausedSubs {
+			paused[sub] = p
+		}
+	}
+	var streamIDs map[media.Subscriber]uint32
+	if len(s.subStreamIDs) > 0 {
+		streamIDs = make(map[media.Subscriber]uint32, len(s.subStreamIDs))
+		for sub, id := range s.subStreamIDs {
+			streamIDs[sub] = id
+		}
+	}
+	var filters map[media.Subscriber]MediaFilter
+	if len(s.subMedia) > 0 {
+		filters = make(map[media.Subscriber]MediaFilter, len(s.subMedia))
+		for sub, f := range s.subMedia {
+			filters[sub] = f
+		}
+	}
+	counters := make([]*dropCounter, len(subs))
+	for i, sub := range subs {
+		counters[i] = s.dropCounters[sub]
+		if s.dvrSubs[sub] {
+			subs[i] = nil // fed by its DVR session
+		}
+	}
+	videoHeader, audioHeader := s.VideoSequenceHeader, s.AudioSequenceHeader
 	s.mu.RUnlock()
 
-	// Send to each subscriber with backpressure handling.
-	// CRITICAL FIX: Clone message payload for each subscriber to prevent
-	// shared slice corruption between publisher and subscriber connections.
-	for _, sub := range subs {
+	// Chunk the message once for all subscribers sharing a chunk size (see
+	// prechunk.go).
+	framed := prechunkFor(msg, subs)
+
+	// Send to each subscriber, skipping the rest of the GOP for those whose
+	// queue overflowed.
+	for i, sub := range subs {
 		if sub == nil {
 			continue
 		}
-
-		// Create independent copy of message to prevent payload sharing issues
-		relayMsg := &chunk.Message{
-			CSID:            msg.CSID,
-			TypeID:          msg.TypeID,
-			Timestamp:       msg.Timestamp,
-			MessageStreamID: msg.MessageStreamID,
-			MessageLength:   msg.MessageLength,
-			Payload:         make([]byte, len(msg.Payload)),
+		if filters[sub].skips(msg.TypeID) {
+			continue
 		}
-		copy(relayMsg.Payload, msg.Payload)
-
-		// Non-blocking path if available (TrySendMessage interface).
-		if ts, ok := sub.(media.TrySendMessage); ok {
-			if ok := ts.TrySendMessage(relayMsg); !ok {
-				metrics.SubscriberDropsTotal.Add(1)
-				logger.Debug("Dropped media message (slow subscriber)", "stream_key", s.Key)
-				continue
-			}
-			metrics.BytesEgress.Add(int64(len(relayMsg.Payload)))
+		if p, ok := paused[sub]; ok && s.skipForPause(sub, p, msg) {
 			continue
 		}
-		// Fallback: best effort send (assumes timeout handling in SendMessage).
-		if err := sub.SendMessage(relayMsg); err != nil {
-			metrics.SubscriberDropsTotal.Add(1)
-			logger.Debug("Dropped media message (slow subscriber)", "stream_key", s.Key)
-		} else {
-			metrics.BytesEgress.Add(int64(len(relayMsg.Payload)))
+		c := counters[i]
+		if c.shed(msg) {
+			s.recordDelivery(c, msg.TypeID, false)
+			continue
+		}
+		streamID, hasID := streamIDs[sub]
+		if hdr := c.pendingHeader(msg, videoHeader, audioHeader); hdr != nil && !s.sendTo(sub, hdr, streamID, hasID) {
+			c.lost(hdr)
+		}
+		if s.sendTo(sub, framed, streamID, hasID) {
+			s.recordDelivery(c, msg.TypeID, true)
+			continue
+		}
+		metrics.SubscriberDropsTotal.Add(1)
+		s.recordDelivery(c, msg.TypeID, false)
+		c.lost(msg)
+		if s.samplePacketLog(logger) {
+			logger.Debug("Dropped media message (slow subscriber)", "stream_key", s.Key, "type_id", msg.TypeID, sampledAttr())
 		}
 	}
 }
 
+// sendTo queues msg for sub with backpressure handling, reporting whether
+// it was queued. With hasID set the copy sent carries the subscriber's own
+// message stream ID.
+func (s *Stream) sendTo(sub media.Subscriber, msg *chunk.Message, streamID uint32, hasID bool) bool {
+	// Each subscriber gets its own message header sharing the payload (see
+	// chunk.Message.Share); payloads are never written after being handed
+	// on, so no per-subscriber copy is needed.
+	relayMsg := msg.Share()
+	if hasID {
+		relayMsg.MessageStreamID = streamID
+	}
+
+	// Non-blocking path if available (TrySendMessage interface).
+	if ts, ok := sub.(media.TrySendMessage); ok {
+		if !ts.TrySendMessage(relayMsg) {
+			relayMsg.Release()
+			return false
+		}
+	} else if err := sub.SendMessage(relayMsg); err != nil {
+		// Fallback: best effort send (assumes timeout handling in SendMessage).
+		relayMsg.Release()
+		return false
+	}
+	metrics.BytesEgress.Add(int64(len(relayMsg.Payload)))
+	return true
+}
+
 // cacheMultitrackVideoHeaders parses a multitrack video message and caches
 // per-track sequence headers. If any track carries a sequence start (inner
 // packet type 0), its codec configuration is stored in VideoTrackHeaders.
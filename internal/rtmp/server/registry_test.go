@@ -10,12 +10,21 @@
 package server
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"log/slog"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/alxayo/go-rtmp/internal/logger"
+	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
 	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
 	"github.com/alxayo/go-rtmp/internal/rtmp/media"
+	"github.com/alxayo/go-rtmp/internal/rtmp/metrics"
 )
 
 // stubSubscriber is a no-op Subscriber used to test subscriber counting.
@@ -155,7 +164,8 @@ func (c *capturingSubscriber) SendMessage(m *chunk.Message) error {
 var _ media.Subscriber = (*capturingSubscriber)(nil)
 
 // TestBroadcastMessage_RelaysToSubscribers verifies that BroadcastMessage
-// delivers a copy of the message to each subscriber.
+// delivers its own message header to each subscriber; the read-only
+// payload is shared.
 func TestBroadcastMessage_RelaysToSubscribers(t *testing.T) {
 	logger.UseWriter(io.Discard)
 	r := NewRegistry()
@@ -180,10 +190,13 @@ func TestBroadcastMessage_RelaysToSubscribers(t *testing.T) {
 		t.Fatalf("sub2: expected 1 message, got %d", len(sub2.messages))
 	}
 
-	// Verify payload is cloned (not shared)
-	sub1.messages[0].Payload[0] = 0x00
-	if msg.Payload[0] == 0x00 {
-		t.Fatal("subscriber message payload shares memory with original")
+	// Headers are per subscriber; the payload is shared, not cloned.
+	sub1.messages[0].MessageStreamID = 5
+	if msg.MessageStreamID == 5 || sub2.messages[0].MessageStreamID == 5 {
+		t.Fatal("subscriber message header shared with the original")
+	}
+	if !bytes.Equal(sub1.messages[0].Payload, msg.Payload) {
+		t.Fatalf("payload = %x, want %x", sub1.messages[0].Payload, msg.Payload)
 	}
 }
 
@@ -753,3 +766,378 @@ func TestBroadcastMessage_OneTrackMultitrack(t *testing.T) {
 		t.Fatal("expected main VideoSequenceHeader to remain nil for non-zero track")
 	}
 }
+
+// TestBroadcastMessage_PausedSubscriber verifies that a paused subscriber
+// receives nothing, and after resume skips inter frames until a keyframe.
+func TestBroadcastMessage_PausedSubscriber(t *testing.T) {
+	logger.UseWriter(io.Discard)
+	r := NewRegistry()
+	s, _ := r.CreateStream("app/pause_test")
+
+	sub := &capturingSubscriber{}
+	s.AddSubscriber(sub)
+	s.PauseSubscriber(sub)
+
+	keyframe := &chunk.Message{TypeID: 9, Payload: []byte{0x17, 0x01, 0x00}}
+	inter := &chunk.Message{TypeID: 9, Payload: []byte{0x27, 0x01, 0x00}}
+	audio := &chunk.Message{TypeID: 8, Payload: []byte{0xAF, 0x01, 0x00}}
+
+	s.BroadcastMessage(nil, keyframe, logger.Logger())
+	s.BroadcastMessage(nil, audio, logger.Logger())
+	if len(sub.messages) != 0 {
+		t.Fatalf("paused subscriber received %d messages", len(sub.messages))
+	}
+
+	s.ResumeSubscriber(sub)
+	s.BroadcastMessage(nil, inter, logger.Logger())    // skipped: waiting for keyframe
+	s.BroadcastMessage(nil, audio, logger.Logger())    // delivered
+	s.BroadcastMessage(nil, keyframe, logger.Logger()) // delivered, clears pause state
+	s.BroadcastMessage(nil, inter, logger.Logger())    // delivered
+	if len(sub.messages) != 3 {
+		t.Fatalf("expected 3 messages after resume, got %d", len(sub.messages))
+	}
+	if sub.messages[0].TypeID != 8 || sub.messages[1].Payload[0] != 0x17 {
+		t.Fatalf("unexpected resume order: first=%d second=%#x", sub.messages[0].TypeID, sub.messages[1].Payload[0])
+	}
+}
+
+// TestBroadcastMessage_SubscriberStreamID verifies media is delivered on the
+// message stream ID each subscriber played on, not the publisher's.
+func TestBroadcastMessage_SubscriberStreamID(t *testing.T) {
+	logger.UseWriter(io.Discard)
+	r := NewRegistry()
+	s, _ := r.CreateStream("app/msid_test")
+
+	plain, onTwo := &capturingSubscriber{}, &capturingSubscriber{}
+	s.AddSubscriber(plain)
+	s.AddStreamSubscriber(onTwo, 2)
+
+	s.BroadcastMessage(nil, &chunk.Message{TypeID: 8, MessageStreamID: 1, Payload: []byte{0xAF, 0x01, 0x00}}, logger.Logger())
+	if len(plain.messages) != 1 || plain.messages[0].MessageStreamID != 1 {
+		t.Fatalf("plain subscriber: %+v", plain.messages)
+	}
+	if len(onTwo.messages) != 1 || onTwo.messages[0].MessageStreamID != 2 {
+		t.Fatalf("stream 2 subscriber: %+v", onTwo.messages)
+	}
+
+	s.RemoveSubscriber(onTwo)
+	if _, ok := s.subStreamIDs[onTwo]; ok {
+		t.Fatalf("stream ID mapping not removed with subscriber")
+	}
+}
+
+// TestStreamLifecycle verifies idle → publishing → ended → publishing and
+// that ending a stream drops cached headers and notifies subscribers.
+func TestStreamLifecycle(t *testing.T) {
+	r := NewRegistry()
+	s, _ := r.CreateStream("app/lifecycle")
+	if s.State() != StreamIdle {
+		t.Fatalf("new stream state = %v", s.State())
+	}
+	pub := &stubPublisher{}
+	_ = s.SetPublisher(pub)
+	if s.State() != StreamPublishing {
+		t.Fatalf("state after publish = %v", s.State())
+	}
+	s.VideoSequenceHeader = &chunk.Message{TypeID: 9, Payload: []byte{0x17, 0x00}}
+	s.VideoCodec = "H264"
+	sub := &capturingSubscriber{}
+	s.AddStreamSubscriber(sub, 3)
+
+	if s.EndPublish(&stubPublisher{}) {
+		t.Fatalf("EndPublish by a non-publisher must be ignored")
+	}
+	if !s.EndPublish(pub) || s.State() != StreamEnded {
+		t.Fatalf("expected stream ended, state = %v", s.State())
+	}
+	if s.Publisher != nil || s.VideoSequenceHeader != nil || s.VideoCodec != "" {
+		t.Fatalf("stale publish state kept: %+v", s)
+	}
+	if len(sub.messages) != 1 || sub.messages[0].MessageStreamID != 3 {
+		t.Fatalf("expected UnpublishNotify on stream 3, got %+v", sub.messages)
+	}
+	vals, _ := amf.DecodeAll(sub.messages[0].Payload)
+	if info, _ := vals[3].(map[string]interface{}); info["code"] != "NetStream.Play.UnpublishNotify" {
+		t.Fatalf("unexpected status %v", vals[3])
+	}
+
+	// A late player gets StreamNotFound rather than the ended stream.
+	conn := &capturingConn{}
+	status, _ := HandlePlay(r, conn, "app", buildPlayMessage("lifecycle"))
+	vals, _ = amf.DecodeAll(status.Payload)
+	if info, _ := vals[3].(map[string]interface{}); info["code"] != "NetStream.Play.StreamNotFound" {
+		t.Fatalf("late player status %v", vals[3])
+	}
+
+	_ = s.SetPublisher(&stubPublisher{})
+	if s.State() != StreamPublishing {
+		t.Fatalf("state after republish = %v", s.State())
+	}
+}
+
+// eofSubscriber records Stream EOF signals like conn.Connection would send.
+type eofSubscriber struct {
+	capturingSubscriber
+	eofs []uint32
+}
+
+func (s *eofSubscriber) SendStreamEOF(streamID uint32) error {
+	s.eofs = append(s.eofs, streamID)
+	return nil
+}
+
+// TestEndPublishSendsStreamEOF verifies subscribers that support it get a
+// Stream EOF on their own message stream when the publisher leaves.
+func TestEndPublishSendsStreamEOF(t *testing.T) {
+	r := NewRegistry()
+	s, _ := r.CreateStream("app/eof")
+	pub := &stubPublisher{}
+	_ = s.SetPublisher(pub)
+	sub := &eofSubscriber{}
+	s.AddStreamSubscriber(sub, 5)
+
+	s.EndPublish(pub)
+	if len(sub.messages) != 1 || len(sub.eofs) != 1 || sub.eofs[0] != 5 {
+		t.Fatalf("expected UnpublishNotify and Stream EOF on stream 5, got %d messages, eofs %v", len(sub.messages), sub.eofs)
+	}
+}
+
+// TestCollectEmpty verifies only streams without publisher and
+// subscribers for the TTL are removed: ended and never-published ones
+// alike, timed from when the last reference left.
+func TestCollectEmpty(t *testing.T) {
+	r := NewRegistry()
+	mk := func(key string) (*Stream, *stubPublisher) {
+		s, _ := r.CreateStream(key)
+		pub := &stubPublisher{}
+		_ = s.SetPublisher(pub)
+		return s, pub
+	}
+	ended, pub := mk("app/ended")
+	ended.EndPublish(pub)
+	watched, pub2 := mk("app/watched")
+	watched.AddSubscriber(&capturingSubscriber{})
+	watched.EndPublish(pub2)
+	mk("app/live")
+	r.CreateStream("app/idle")
+	left, pub3 := mk("app/left")
+	sub := &capturingSubscriber{}
+	left.AddSubscriber(sub)
+	left.EndPublish(pub3)
+	left.emptySince = time.Now().Add(-time.Hour) // ended long ago...
+	left.RemoveSubscriber(sub)                   // ...but watched until now
+
+	if n := watched.RefCount(); n != 1 {
+		t.Fatalf("watched RefCount = %d, want 1", n)
+	}
+	if st := r.Stats(); st != (RegistryStats{Streams: 5, Idle: 1, Publishing: 1, Ended: 3, Empty: 3}) {
+		t.Fatalf("Stats = %+v", st)
+	}
+	if got := r.CollectEmpty(time.Minute); len(got) != 0 {
+		t.Fatalf("collected before TTL: %+v", got)
+	}
+	got := r.CollectEmpty(0)
+	states := map[string]StreamState{}
+	for _, c := range got {
+		states[c.Key] = c.State
+	}
+	if len(got) != 3 || states["app/ended"] != StreamEnded || states["app/idle"] != StreamIdle || states["app/left"] != StreamEnded {
+		t.Fatalf("collected %+v, want app/ended, app/idle and app/left", got)
+	}
+	if r.GetStream("app/watched") == nil || r.GetStream("app/live") == nil || r.GetStream("app/idle") != nil {
+		t.Fatalf("wrong streams removed")
+	}
+}
+
+// TestCollectEmpty_LookupRace collects a stream between its lookup and the
+// publish and play that follow: both refuse it, and PublishStream and
+// HandlePlay look the key up again, ending up on the registered stream.
+func TestCollectEmpty_LookupRace(t *testing.T) {
+	r := NewRegistry()
+	stale, _ := r.CreateStream("app/show")
+	r.CollectEmpty(0)
+	pub := &stubPublisher{}
+	if err := stale.SetPublisher(pub); !errors.Is(err, ErrStreamCollected) {
+		t.Fatalf("SetPublisher on a collected stream = %v, want ErrStreamCollected", err)
+	}
+	if err := stale.addStreamSubscriberLimit(&capturingSubscriber{}, 1, 0, false); !errors.Is(err, ErrStreamCollected) {
+		t.Fatalf("subscribe to a collected stream = %v, want ErrStreamCollected", err)
+	}
+	stream, err := r.PublishStream("app/show", pub)
+	if err != nil || stream == stale || r.GetStream("app/show") != stream {
+		t.Fatalf("PublishStream = %p, %v; want the registered stream, not %p", stream, err, stale)
+	}
+}
+
+// TestCollectEmpty_Concurrent publishes and plays while streams are being
+// collected (run with -race): every publisher and player must end up on a
+// stream that is still registered.
+func TestCollectEmpty_Concurrent(t *testing.T) {
+	r := NewRegistry()
+	done := make(chan struct{})
+	var collector sync.WaitGroup
+	collector.Add(1)
+	go func() {
+		defer collector.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				r.CollectEmpty(0)
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for n := 0; n < 200; n++ {
+				key := fmt.Sprintf("app/s%d_%d", i, n)
+				pub := &stubPublisher{}
+				stream, err := r.PublishStream(key, pub)
+				if err != nil {
+					t.Errorf("PublishStream(%s): %v", key, err)
+					return
+				}
+				if got := r.GetStream(key); got != stream {
+					t.Errorf("%s: publisher on an unregistered stream", key)
+					return
+				}
+				sub := &capturingSubscriber{}
+				if err := stream.addStreamSubscriberLimit(sub, 1, 0, false); err != nil {
+					t.Errorf("%s: subscribe: %v", key, err)
+					return
+				}
+				stream.EndPublish(pub)
+				stream.RemoveSubscriber(sub)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(done)
+	collector.Wait()
+}
+
+// latencySubscriber is a capturingSubscriber that reports delivery latency
+// the way conn.Connection does.
+type latencySubscriber struct {
+	capturingSubscriber
+	window metrics.LatencyWindow
+}
+
+func (l *latencySubscriber) WriteLatency() *metrics.LatencyWindow { return &l.window }
+
+// TestSnapshot_Latency verifies the ingest stamp survives the broadcast copy
+// and that subscriber latency appears in the snapshot only once measured.
+func TestSnapshot_Latency(t *testing.T) {
+	logger.UseWriter(io.Discard)
+	r := NewRegistry()
+	s, _ := r.CreateStream("app/latency_test")
+	sub := &latencySubscriber{}
+	s.AddSubscriber(sub)
+
+	if info := r.Snapshot()[0]; info.Latency != nil {
+		t.Fatalf("latency reported without samples: %+v", info.Latency)
+	}
+
+	ingest := time.Now()
+	s.BroadcastMessage(nil, &chunk.Message{TypeID: 8, MessageStreamID: 1, Payload: []byte{0xAF, 0x01, 0x00}, Ingest: ingest}, logger.Logger())
+	if len(sub.messages) != 1 || !sub.messages[0].Ingest.Equal(ingest) {
+		t.Fatalf("ingest time not copied to subscriber message")
+	}
+
+	sub.window.Observe(20 * time.Millisecond)
+	info := r.Snapshot()[0]
+	if info.Latency == nil || info.Latency.Samples != 1 || info.Latency.P99Ms != 20 {
+		t.Fatalf("latency = %+v, want one 20ms sample", info.Latency)
+	}
+}
+
+// BenchmarkBroadcastMessage measures the fan-out cost of one 4 KB video
+// frame to N subscribers (copy per subscriber plus queue hand-off).
+func BenchmarkBroadcastMessage(b *testing.B) {
+	logger.UseWriter(io.Discard)
+	for _, n := range []int{1, 10, 100} {
+		b.Run(fmt.Sprintf("subscribers=%d", n), func(b *testing.B) {
+			r := NewRegistry()
+			s, _ := r.CreateStream("app/bench")
+			for i := 0; i < n; i++ {
+				s.AddSubscriber(&stubSubscriber{})
+			}
+			payload := make([]byte, 4096)
+			payload[0], payload[1] = 0x27, 0x01 // inter frame, not a sequence header
+			msg := &chunk.Message{CSID: 6, TypeID: 9, MessageStreamID: 1, MessageLength: uint32(len(payload)), Payload: payload}
+			log := logger.Logger()
+			b.ReportAllocs()
+			b.SetBytes(int64(len(payload) * n))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				msg.Timestamp = uint32(i)
+				s.BroadcastMessage(nil, msg, log)
+			}
+		})
+	}
+}
+
+// TestNormalizeTimestamp_PublisherReconnect verifies a returning publisher
+// whose clock restarts at 0 continues the stream's timeline.
+func TestNormalizeTimestamp_PublisherReconnect(t *testing.T) {
+	r := NewRegistry()
+	s, _ := r.CreateStream("app/ts_test")
+	first, second := &stubSubscriber{}, &stubSubscriber{}
+
+	s.SetPublisher(first)
+	for _, ts := range []uint32{40000, 40033} {
+		s.NormalizeTimestamp(&chunk.Message{Timestamp: ts})
+	}
+	s.EndPublish(first)
+
+	s.SetPublisher(second)
+	m := &chunk.Message{Timestamp: 0}
+	if !s.NormalizeTimestamp(m) || m.Timestamp != 40033 {
+		t.Fatalf("reset not re-based: rebased ts %d, want 40033", m.Timestamp)
+	}
+	m = &chunk.Message{Timestamp: 33}
+	if s.NormalizeTimestamp(m) || m.Timestamp != 40066 {
+		t.Fatalf("timestamp after reset = %d, want 40066", m.Timestamp)
+	}
+}
+
+// TestMediaDiagnostics checks that per-packet tag diagnostics are only
+// logged for streams created with SetMediaDiagnostics on, and are sampled.
+func TestMediaDiagnostics(t *testing.T) {
+	logger.SetDebugSampling(2)
+	t.Cleanup(func() { logger.SetDebugSampling(logger.DefaultDebugSampling) })
+	var buf bytes.Buffer
+	log := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	video := &chunk.Message{TypeID: 9, MessageStreamID: 1, Payload: []byte{0x17, 0x01, 0, 0, 0}}
+	audio := &chunk.Message{TypeID: 8, MessageStreamID: 1, Payload: []byte{0xAF, 0x01, 0x00}}
+
+	r := NewRegistry()
+	plain, _ := r.CreateStream("live/plain")
+	plain.BroadcastMessage(nil, video, log)
+	if strings.Contains(buf.String(), "Video packet") {
+		t.Fatal("diagnostics logged with media diagnostics off")
+	}
+
+	r.SetMediaDiagnostics(true)
+	diag, _ := r.CreateStream("live/diag")
+	for i := 0; i < 2; i++ {
+		diag.BroadcastMessage(nil, video, log)
+		diag.BroadcastMessage(nil, audio, log)
+	}
+	out := buf.String()
+	// Sampling 1 in 2 over video, audio, video, audio keeps both videos.
+	if n := strings.Count(out, `"msg":"Video packet"`); n != 2 {
+		t.Fatalf("logged %d video diagnostics, want 2:\n%s", n, out)
+	}
+	if strings.Contains(out, `"msg":"Audio packet"`) {
+		t.Fatalf("unsampled audio packets logged:\n%s", out)
+	}
+	if !strings.Contains(out, `"codec":"H264"`) || !strings.Contains(out, `"sampled":2`) {
+		t.Fatalf("diagnostics missing codec or sample rate:\n%s", out)
+	}
+}
@@ -0,0 +1,98 @@
+package server
+
+// Self-Signed Certificates
+// ------------------------
+// Testing RTMPS locally should not need openssl. With TLSSelfSigned and no
+// certificate files, the RTMPS listener uses a certificate generated in
+// memory at startup for localhost, the loopback addresses, the machine's
+// host name and the -tls-listen host. Clients must be told to trust it
+// (or skip verification), so it is for development only; a new one is
+// generated on every start.
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"time"
+)
+
+// selfSignedValidity is how long a generated certificate is valid.
+const selfSignedValidity = 30 * 24 * time.Hour
+
+// tlsCertificate returns the RTMPS certificate: the configured files, or a
+// generated self-signed one when TLSSelfSigned is set and none are given.
+func (s *Server) tlsCertificate() (tls.Certificate, error) {
+	if !s.cfg.TLSSelfSigned || s.cfg.TLSCertFile != "" || s.cfg.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(s.cfg.TLSCertFile, s.cfg.TLSKeyFile)
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("load TLS certificate: %w", err)
+		}
+		return cert, nil
+	}
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if name, err := os.Hostname(); err == nil && name != "" {
+		hosts = append(hosts, name)
+	}
+	if host, _, err := net.SplitHostPort(s.cfg.TLSListenAddr); err == nil && host != "" {
+		if ip := net.ParseIP(host); ip == nil || !ip.IsUnspecified() {
+			hosts = append(hosts, host)
+		}
+	}
+	cert, err := selfSignedCertificate(hosts, time.Now())
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("generate self-signed TLS certificate: %w", err)
+	}
+	sum := sha256.Sum256(cert.Certificate[0])
+	s.log.Warn("RTMPS is using a generated self-signed certificate; clients must trust it or skip verification. For development only",
+		"hosts", hosts, "sha256", hex.EncodeToString(sum[:]))
+	return cert, nil
+}
+
+// selfSignedCertificate generates an ECDSA P-256 certificate for hosts
+// (DNS names or IP addresses), valid from an hour before now for
+// selfSignedValidity.
+func selfSignedCertificate(hosts []string, now time.Time) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: hosts[0], Organization: []string{"go-rtmp self-signed"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, nil
+}
@@ -7,36 +7,71 @@ package server
 
 import (
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/alxayo/go-rtmp/internal/cluster"
 	"github.com/alxayo/go-rtmp/internal/ingress"
 	"github.com/alxayo/go-rtmp/internal/logger"
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
 	"github.com/alxayo/go-rtmp/internal/rtmp/client"
 	iconn "github.com/alxayo/go-rtmp/internal/rtmp/conn"
+	"github.com/alxayo/go-rtmp/internal/rtmp/control"
+	"github.com/alxayo/go-rtmp/internal/rtmp/handshake"
+	"github.com/alxayo/go-rtmp/internal/rtmp/media"
 	"github.com/alxayo/go-rtmp/internal/rtmp/metrics"
 	"github.com/alxayo/go-rtmp/internal/rtmp/relay"
 	"github.com/alxayo/go-rtmp/internal/rtmp/rpc"
 	"github.com/alxayo/go-rtmp/internal/rtmp/server/auth"
 	"github.com/alxayo/go-rtmp/internal/rtmp/server/hooks"
+	"github.com/alxayo/go-rtmp/internal/rtmp/transcode"
 	"github.com/alxayo/go-rtmp/internal/srt"
+	"github.com/alxayo/go-rtmp/internal/storage"
+	"github.com/alxayo/go-rtmp/internal/telemetry"
 )
 
 // Config holds all settings for the RTMP server.
 type Config struct {
-	ListenAddr        string   // TCP address to listen on (default ":1935")
-	ChunkSize         uint32   // outbound chunk payload size in bytes (default 4096)
-	WindowAckSize     uint32   // flow control: bytes before client must acknowledge (default 2,500,000)
-	RecordAll         bool     // if true, automatically record all published streams to FLV files
-	RecordDir         string   // directory for FLV recordings (default "recordings")
+	ListenAddr    string // TCP address to listen on (default ":1935")
+	ChunkSize     uint32 // outbound chunk payload size in bytes (default 4096)
+	WindowAckSize uint32 // flow control: bytes before client must acknowledge (default 2,500,000)
+	RecordAll     bool   // if true, automatically record all published streams to FLV files
+	RecordDir     string // directory for FLV recordings (default "recordings")
+
+	// PeerBandwidth and PeerBandwidthLimit are the Set Peer Bandwidth sent
+	// in the control burst: the output limit suggested to clients in bytes
+	// (default 2,500,000) and its type, "hard", "soft" or "dynamic"
+	// (default).
+	PeerBandwidth      uint32
+	PeerBandwidthLimit string
+
+	// Apps holds per-application settings keyed by app name: recording,
+	// authentication, relays, publisher and codec limits and control burst
+	// values (see app_config.go).
+	Apps map[string]AppConfig
+
+	// VHosts holds independent virtual hosts keyed by the lower-case host
+	// name clients use in their tcUrl, each with its own streams,
+	// authentication, recording and relays (see vhost.go). Other hosts get
+	// the server-wide settings.
+	VHosts map[string]VHostConfig
+
+	// RecordStreams records only the streams whose key matches one of these
+	// patterns: globs such as "vod/*", or regular expressions written
+	// "~expr" (see hooks.StreamMatcher). Used instead of RecordAll.
+	RecordStreams []string
 
 	// SegmentDuration splits recordings into multiple files of this duration.
 	// Segment boundaries are aligned to video keyframes for independent playback.
@@ -47,8 +82,243 @@ type Config struct {
 	// placeholders. See the -segment-pattern flag documentation for details.
 	// Default: "%s_%T_seg%03d"
 	SegmentPattern string
-	LogLevel          string   // log verbosity: "debug", "info", "warn", "error" (default "info")
-	RelayDestinations []string // RTMP URLs to forward published streams to (e.g. rtmp://cdn/live/key)
+
+	// RecordQueueSize is how many media messages each recorder buffers
+	// between the publisher and the disk. When the queue fills, messages are
+	// dropped up to the next keyframe rather than stalling the stream.
+	// Default: media.DefaultRecordQueueSize
+	RecordQueueSize int
+
+	// RecordStorage is where finished recording files (and segments) are
+	// copied: file:///dir or s3://bucket/prefix. Each upload fires a
+	// recording_uploaded hook event. Empty keeps recordings local only.
+	RecordStorage string
+
+	// RecordUploadStopTimeout is how long Stop waits for recording uploads
+	// in flight before cancelling them. Default: 30s
+	RecordUploadStopTimeout time.Duration
+
+	// RecordFormat forces the container of recordings and segments: "flv"
+	// records every codec as (Enhanced) FLV, "mp4" records every codec as
+	// MP4. Empty (or "auto") picks from the video codec, FLV for H.264 and MP4 for
+	// H.265, AV1, VP9 and VVC (media.SelectContainerFormat). Only FLV
+	// recordings can be played back as VOD or appended to.
+	RecordFormat string
+
+	// RecordTimecode keeps onFI timecode messages (injected by hardware
+	// encoders) in FLV recordings as script tags, so recordings of
+	// separately produced feeds can be lined up. MP4 recordings ignore it.
+	RecordTimecode bool
+	LogLevel       string // log verbosity: "debug", "info", "warn", "error" (default "info")
+
+	// HandshakeRejectReply answers clients that open with an unsupported
+	// handshake scheme before closing the connection: S0 = 0x03 to RTMPE,
+	// HTTP 501 to RTMPT, so encoders can report "unsupported" rather than a
+	// dropped connection. Such clients are logged and fire a
+	// handshake_rejected hook event either way.
+	HandshakeRejectReply bool
+
+	// Inbound resource limits. A client exceeding any of them is disconnected
+	// with a protocol error. They are checked on the chunk header, before the
+	// payload is buffered.
+	MaxMessageSize    uint32 // largest accepted message in bytes (default 8 MiB)
+	MaxChunkStreams   int    // most chunk stream IDs per connection (default 64)
+	MaxAMFMessageSize uint32 // largest AMF command/data message in bytes (default 256 KiB)
+	MaxChunkSize      uint32 // largest chunk size a client may set (default chunk.MaxChunkSize, any the spec allows)
+
+	RelayDestinations []string    // RTMP URLs to forward published streams to (e.g. rtmp://cdn/live/key)
+	RelayProxyURL     string      // optional egress proxy for relay connections (socks5:// or http://)
+	RelayTLSConfig    *tls.Config // verification settings for rtmps:// relay destinations (nil = system roots)
+
+	// RelayQueueSize is how many media messages each relay destination
+	// buffers in front of its send goroutine. A destination whose queue
+	// fills drops messages up to the next keyframe; the publisher, local
+	// subscribers and other destinations are not held up.
+	// Default: relay.DefaultQueueSize
+	RelayQueueSize int
+
+	// RelayProfiles tailor what individual relay destinations receive:
+	// onMetaData rewrites and the codecs sent. Each destination uses the
+	// first profile whose Match prefixes its URL. See relay.Profile.
+	RelayProfiles []relay.Profile
+
+	// VODEnabled serves FLV recordings from RecordDir to play requests that
+	// target a stream key with no live publisher. The newest recording for the
+	// key is streamed at real-time pace, honoring the play start offset.
+	VODEnabled bool
+
+	// DVRWindow keeps the last DVRWindow of every stream's media in memory
+	// so players can start behind live: a play start of -30000 begins 30s
+	// back (see dvr.go). Zero disables it.
+	DVRWindow time.Duration
+
+	// VariantSeparator enables multi-bitrate grouping. When set (e.g. "_"),
+	// a stream key like "live/show_720p" is registered as variant "720p" of
+	// the logical stream "live/show". Labels must start with a digit.
+	// Empty (default) disables grouping.
+	VariantSeparator string
+
+	// StreamAliases are stream keys that play whichever of their source
+	// keys is live, in priority order (primary/backup failover). Players on
+	// an alias switch sources without reconnecting. Aliases cannot be
+	// published to.
+	StreamAliases []StreamAlias
+
+	// RedundantIngest lets a stream take two publishers: "live/show_primary"
+	// and "live/show_backup" are played as "live/show", from the primary
+	// while it is live and from the backup otherwise.
+	RedundantIngest bool
+
+	// OriginURL makes the server an edge: a play request for a stream key
+	// with no local publisher pulls the stream from this origin server
+	// (rtmp://host[:port] or rtmps://host[:port]), as OriginURL + "/" + key,
+	// or over the origin's link transport with link://host[:port] (link.go).
+	// Players on the edge share one pull per key, which stops when the last
+	// of them leaves. Empty disables.
+	OriginURL string
+
+	// ClusterRedisURL shares a stream directory between servers through
+	// Redis (redis://[user:password@]host[:port][/db] or rediss://). Plays
+	// of streams with no local publisher are pulled from the node that
+	// announces them, as in edge mode. Empty disables.
+	ClusterRedisURL string
+
+	// ClusterNodeURL is the rtmp://host:port (or link://host:port) other
+	// servers reach this one at, announced in the directory for the streams published here. Empty
+	// means this server only looks streams up and announces none.
+	ClusterNodeURL string
+
+	// LinkListenAddr, when set, serves the origin link on this TCP address:
+	// edges and cluster nodes that reach this server at link://host:port
+	// pull streams over it without the RTMP handshake, commands and
+	// chunking (see link.go). Empty disables.
+	LinkListenAddr string
+
+	// LinkSecret is the shared secret of the link transport: an origin
+	// refuses link requests without it, and an edge sends it with pulls
+	// from link:// origins. Empty accepts any request, so bind
+	// LinkListenAddr to a private network.
+	LinkSecret string
+
+	// FailoverTimeout is how long a live source may send no media before a
+	// stream alias or redundant-ingest stream fails over from it. Default 5s.
+	FailoverTimeout time.Duration
+
+	// MaxSubscribersPerStream limits how many players one stream may have
+	// at once (0 = no limit); AppConfig.MaxSubscribers overrides it per
+	// app. Further plays are refused with NetStream.Play.Failed and fire
+	// EventSubscriberLimit (see subscriber_limit.go).
+	MaxSubscribersPerStream int
+
+	// SlowSubscriberDropRate, when above zero, disconnects a subscriber
+	// whose share of dropped media messages (0-1) stays above it for
+	// SlowSubscriberWindow (default DefaultSlowSubscriberWindow). Drops are
+	// counted per subscriber either way and reported in the stream stats.
+	SlowSubscriberDropRate float64
+	SlowSubscriberWindow   time.Duration
+
+	// PingInterval, when above zero, sends every player a User Control
+	// Ping Request this often, so NATs and firewalls that drop idle
+	// connections see traffic while the publisher is paused, and
+	// disconnects a player that leaves PingMisses (default
+	// DefaultPingMisses) requests in a row unanswered (see heartbeat.go).
+	PingInterval time.Duration
+	PingMisses   int
+
+	// AVDriftThreshold, when above zero, flags a stream whose video and
+	// audio timestamps drift further apart than this (usually an encoder
+	// clock problem) in the stream stats and with EventAVDrift. The drift
+	// itself is reported either way.
+	AVDriftThreshold time.Duration
+
+	// SendTimeout is how long a message to a connection waits for room in
+	// its full outbound queue before it is dropped. Default 200ms.
+	SendTimeout time.Duration
+
+	// IdleTimeout disconnects a client that sends nothing for this long
+	// (players that only watch still acknowledge what they receive).
+	// Default 90s.
+	IdleTimeout time.Duration
+
+	// StreamKeyMaxLength and StreamKeyCharset limit the app names and
+	// stream keys clients may use (see streamkey.go). The charset is a
+	// regexp character class without brackets. Defaults:
+	// DefaultStreamKeyMaxLength and DefaultStreamKeyCharset.
+	StreamKeyMaxLength int
+	StreamKeyCharset   string
+
+	// EndedStreamTTL is how long a stream with no publisher and no
+	// subscribers is kept, e.g. for a returning publisher, before it is
+	// removed from the registry and EventStreamDelete fires. Default 30s.
+	EndedStreamTTL time.Duration
+
+	// LatencyStats stamps each ingested audio/video message with its
+	// arrival time and reports ingest-to-delivery latency percentiles per
+	// stream and relay destination in the stats snapshot. Off by default.
+	LatencyStats bool
+
+	// MediaDiagnostics logs the parsed tag header (codec, frame and packet
+	// type) of media packets at debug level, sampled like other per-packet
+	// debug logs. Off by default: parsing every packet costs CPU.
+	MediaDiagnostics bool
+
+	// TraceDir, when set, writes a trace of every RTMP message each
+	// connection reads or writes (headers and payload) to a JSON Lines
+	// file per connection in this directory, and the bytes each client sent
+	// after the handshake to a raw capture beside it (see package trace).
+	// Read them with cmd/rtmp-trace; cmd/rtmp-replay replays them. For
+	// debugging: traces grow with the full media stream.
+	TraceDir string
+
+	// ChunkDiagnostics keeps the last N inbound chunk headers and raw bytes
+	// of each connection and logs them with a read error, to show which
+	// chunks led up to a protocol violation. 0 disables it.
+	ChunkDiagnostics int
+
+	// Tracer, when set, records OpenTelemetry spans for each connection's
+	// lifecycle: handshake, connect/createStream/publish/play handling, the
+	// time from publish to the first keyframe, keyframe fan-out to players
+	// and relay sends. nil disables tracing. See telemetry.FromEnv.
+	Tracer *telemetry.Tracer
+
+	// Inspect turns the server into a protocol analyzer for debugging
+	// encoders: every publish is accepted without authentication or stream
+	// registration, media is parsed and discarded, and each connection's
+	// InspectReport (commands, header formats, codec parameters, timing,
+	// warnings) is logged when it disconnects. InspectDir, when set,
+	// receives the reports as JSON files instead.
+	Inspect    bool
+	InspectDir string
+
+	// StatusTxnMode is the transaction ID of the onStatus answering a
+	// stream command (publish, play, pause): rpc.TxnModeZero ("zero", the
+	// default) sends 0 as Adobe Media Server does; rpc.TxnModeEcho ("echo")
+	// echoes the command's own ID, for clients that match onStatus to
+	// their command by ID. _result and _error always echo the ID.
+	StatusTxnMode string
+
+	// DuplicatePublisherPolicy selects what happens when a second publisher
+	// targets a live stream key: "replace" (default) evicts the current
+	// publisher, "reject" refuses the new one with NetStream.Publish.BadName,
+	// and "rename" publishes it as "<key>_dup<N>".
+	DuplicatePublisherPolicy string
+
+	// TranscodeCommand, when non-empty, is run once per published stream to
+	// produce server-side renditions (see package transcode for placeholders).
+	// The process is restarted if it crashes and killed on unpublish. Streams
+	// published with a "transcoded" query parameter are never transcoded, so
+	// processes that push back to this server must tag their output URL.
+	TranscodeCommand string
+
+	// ThumbnailInterval, when above zero, makes every stream keep its
+	// latest H.264 IDR keyframe for live previews (Server.ThumbnailHandler)
+	// and, with ThumbnailCommand set, turns it into a JPEG this often: the
+	// keyframe, in Annex B, is piped to the command, which writes the
+	// {output} file, and the result replaces ThumbnailDir/<app>_<name>.jpg
+	// (see thumbnail.go). ThumbnailDir defaults to "thumbnails".
+	ThumbnailInterval time.Duration
+	ThumbnailCommand  string
+	ThumbnailDir      string
 
 	// TLS configuration (all optional). When TLSListenAddr is non-empty, the server
 	// starts a second listener for RTMPS (RTMP over TLS) alongside the plain RTMP listener.
@@ -56,17 +326,50 @@ type Config struct {
 	TLSCertFile   string // Path to PEM-encoded TLS certificate file
 	TLSKeyFile    string // Path to PEM-encoded TLS private key file
 
+	// TLSSelfSigned makes RTMPS use a self-signed certificate generated in
+	// memory at startup when TLSCertFile and TLSKeyFile are empty, for
+	// local development. Clients must trust it or skip verification.
+	TLSSelfSigned bool
+
+	// TLSListener is an inherited TCP socket for RTMPS (see ListenerFiles),
+	// used instead of listening on TLSListenAddr. The server wraps it in TLS.
+	TLSListener net.Listener
+
+	// TLSClientCAFile, when set, makes RTMPS require mutual TLS: clients
+	// must present a certificate signed by one of the PEM CA certificates
+	// in the file. TLSClientACL, when set, limits each certificate name to
+	// the stream keys it may publish and play (see client_cert.go).
+	TLSClientCAFile string
+	TLSClientACL    *ClientCertACL
+
 	// Event hook configuration (all optional)
-	HookScripts     []string // Shell hooks: "event_type=/path/to/script" pairs
-	HookWebhooks    []string // Webhook hooks: "event_type=https://url" pairs
+	HookScripts     []string // Shell hooks: "event_type=/path/to/script" pairs, or "event_type@pattern=..." for matching streams only
+	HookWebhooks    []string // Webhook hooks: "event_type=https://url" pairs, or "event_type@pattern=..." for matching streams only
 	HookStdioFormat string   // Stdio output format: "json", "env", or "" (disabled)
 	HookTimeout     string   // Hook execution timeout (default "30s")
 	HookConcurrency int      // Max concurrent hook executions (default 10)
 
+	// Webhook delivery hardening, applied to every HookWebhooks entry.
+	HookWebhookSecret  string   // HMAC-SHA256 key for the X-RTMP-Signature-256 header. Empty = unsigned
+	HookWebhookHeaders []string // Extra request headers: "Name: value" pairs
+	HookWebhookRetries int      // Retries after a failed delivery (exponential backoff from 1s)
+
+	// Webhook delivery queue. When HookQueueSize > 0 each webhook gets a
+	// queue that holds events during an outage (at-least-once delivery).
+	HookQueueSize   int           // Max queued events per webhook (0 = no queue)
+	HookQueueMaxAge time.Duration // Queued events older than this are dropped (0 = no limit)
+	HookQueueDir    string        // Directory persisting queues across restarts ("" = memory only)
+
 	// Authentication (optional). When nil, all publish/play requests are allowed.
 	// Set to an auth.Validator implementation to enforce token-based access control.
 	AuthValidator auth.Validator
 
+	// PlayAuthValidator, when set, checks play requests in place of
+	// AuthValidator, so players use their own secrets, callback or viewer
+	// tokens. A validator implementing auth.SessionValidator (such as
+	// auth.ViewerTokenValidator) holds a session for each play until it ends.
+	PlayAuthValidator auth.Validator
+
 	// SRT configuration (all optional). When SRTListenAddr is non-empty,
 	// the server starts a UDP listener for SRT ingest alongside RTMP.
 	SRTListenAddr string // SRT UDP listen address (e.g. ":10080"). Empty = disabled
@@ -106,15 +409,63 @@ func (c *Config) applyDefaults() {
 	if c.WindowAckSize == 0 {
 		c.WindowAckSize = 2_500_000
 	} // matches control burst
+	if c.PeerBandwidth == 0 {
+		c.PeerBandwidth = 2_500_000
+	}
+	if _, err := control.ParseLimitType(c.PeerBandwidthLimit); err != nil || c.PeerBandwidthLimit == "" {
+		c.PeerBandwidthLimit = "dynamic"
+	}
 	if c.RecordDir == "" {
 		c.RecordDir = "recordings"
 	}
 	if c.SegmentPattern == "" {
 		c.SegmentPattern = "%s_%T_seg%03d"
 	}
+	if c.RecordQueueSize <= 0 {
+		c.RecordQueueSize = media.DefaultRecordQueueSize
+	}
+	if c.RelayQueueSize <= 0 {
+		c.RelayQueueSize = relay.DefaultQueueSize
+	}
 	if c.LogLevel == "" {
 		c.LogLevel = "info"
 	}
+	if c.MaxMessageSize == 0 {
+		c.MaxMessageSize = 8 << 20
+	}
+	if c.MaxChunkStreams == 0 {
+		c.MaxChunkStreams = 64
+	}
+	if c.MaxAMFMessageSize == 0 {
+		c.MaxAMFMessageSize = 256 << 10
+	}
+	if c.MaxChunkSize == 0 {
+		c.MaxChunkSize = chunk.MaxChunkSize
+	}
+	if c.EndedStreamTTL <= 0 {
+		c.EndedStreamTTL = 30 * time.Second
+	}
+	if c.RecordUploadStopTimeout <= 0 {
+		c.RecordUploadStopTimeout = 30 * time.Second
+	}
+	if c.FailoverTimeout <= 0 {
+		c.FailoverTimeout = 5 * time.Second
+	}
+	if c.SlowSubscriberWindow <= 0 {
+		c.SlowSubscriberWindow = DefaultSlowSubscriberWindow
+	}
+	if c.PingMisses <= 0 {
+		c.PingMisses = DefaultPingMisses
+	}
+	if c.ThumbnailDir == "" {
+		c.ThumbnailDir = "thumbnails"
+	}
+	if !validPublisherPolicy(c.DuplicatePublisherPolicy) {
+		c.DuplicatePublisherPolicy = PublisherPolicyReplace
+	}
+	if !rpc.ValidTxnMode(c.StatusTxnMode) {
+		c.StatusTxnMode = rpc.TxnModeZero
+	}
 	if c.SRTLatency == 0 {
 		c.SRTLatency = 120
 	}
@@ -123,65 +474,194 @@ func (c *Config) applyDefaults() {
 	}
 }
 
+// readLimits returns the inbound limits for a connection. Until its connect
+// succeeds a client may send only commands and control messages, so no
+// message may exceed MaxAMFMessageSize and at most that much may be buffered
+// in incomplete messages: an unauthenticated peer cannot make the server hold
+// a large message on each of its chunk streams.
+func (c *Config) readLimits(connected bool) chunk.Limits {
+	l := chunk.Limits{
+		MaxMessageSize:    c.MaxMessageSize,
+		MaxChunkStreams:   c.MaxChunkStreams,
+		MaxAMFMessageSize: c.MaxAMFMessageSize,
+		MaxChunkSize:      c.MaxChunkSize,
+	}
+	if !connected {
+		l.MaxMessageSize = min(l.MaxMessageSize, l.MaxAMFMessageSize)
+		l.MaxPendingBytes = l.MaxAMFMessageSize
+	}
+	return l
+}
+
 // Server encapsulates listener + active connection tracking.
 type Server struct {
 	cfg                Config
 	l                  net.Listener
 	tlsListener        net.Listener  // optional RTMPS listener (nil when TLS disabled)
+	tlsRaw             net.Listener  // TCP socket under tlsListener
 	srtListener        *srt.Listener // optional SRT listener (nil when SRT disabled)
+	linkListener       net.Listener  // optional origin link listener (nil when disabled)
 	log                *slog.Logger
 	reg                *Registry
 	destinationManager *relay.DestinationManager
 	hookManager        *hooks.HookManager
-	ingressManager     *ingress.Manager // protocol-agnostic publish manager
+	hookSeq            atomic.Uint64      // numbers OnEvent/Subscribe hook IDs
+	ingressManager     *ingress.Manager   // protocol-agnostic publish manager
+	transcodeManager   *transcode.Manager // per-stream transcoder processes (nil when disabled)
+	recordStore        storage.Store      // destination for finished recordings (nil when disabled)
+	uploads            sync.WaitGroup     // recording uploads in flight
+	uploadCtx          context.Context    // context of uploads, cancelled by Stop
+	cancelUploads      context.CancelFunc
+	recordStreams      []*hooks.StreamMatcher // compiled Config.RecordStreams
 
 	mu          sync.RWMutex
 	conns       map[string]*iconn.Connection
 	acceptingWg sync.WaitGroup
 	closing     bool
+	draining    bool          // listeners closed by StopAccepting
+	gcDone      chan struct{} // closed by Stop to end collectEmptyStreams
+	// aliases holds the running redundant-ingest aliases by alias key.
+	aliases map[string]*aliasForwarder
+	// pulls holds the running origin pulls by stream key (edge mode).
+	pulls map[string]*originPull
+	// links holds the link sessions this server feeds as an origin.
+	links map[*linkSession]struct{}
+
+	directory *cluster.Directory // shared stream directory (nil when clustering is off)
+	announcer sync.WaitGroup     // the announceStreams goroutine
+
+	keyPolicy *StreamKeyPolicy // limits on app names and stream keys
+
+	vhosts map[string]*vhost // virtual hosts by lower-case name (vhost.go)
+}
+
+// newDestinationManager creates the relay destination manager for cfg, or
+// returns nil when it relays nothing.
+func newDestinationManager(cfg Config) *relay.DestinationManager {
+	if len(cfg.RelayDestinations) == 0 && !cfg.hasAppRelays() {
+		return nil
+	}
+	// Create a client factory that wraps the client.New function
+	clientFactory := func(url string) (relay.RTMPClient, error) {
+		c, err := client.New(url)
+		if err != nil {
+			return nil, err
+		}
+		c.SetLogger(logger.Logger().With("destination", url))
+		c.ProxyURL = cfg.RelayProxyURL
+		c.TLSConfig = cfg.RelayTLSConfig
+		return c, nil
+	}
+	destMgr, err := relay.NewDestinationManager(cfg.RelayDestinations, logger.Logger(), clientFactory)
+	if err != nil {
+		logger.Logger().Error("Failed to initialize destination manager", "error", err)
+		return nil // Continue without relay functionality
+	}
+	destMgr.SetQueueSize(cfg.RelayQueueSize)
+	destMgr.SetProfiles(cfg.RelayProfiles)
+	return destMgr
+}
+
+// newRegistry creates a stream registry with cfg's stream settings.
+func newRegistry(cfg Config) *Registry {
+	reg := NewRegistry()
+	reg.SetVariantSeparator(cfg.VariantSeparator)
+	reg.SetMediaDiagnostics(cfg.MediaDiagnostics)
+	reg.SetDVRWindow(cfg.DVRWindow)
+	reg.SetSubscriberLimit(cfg.subscriberLimits())
+	reg.SetStatusTxnMode(cfg.StatusTxnMode)
+	reg.SetThumbnails(cfg.ThumbnailInterval > 0)
+	return reg
 }
 
 // New creates a new, unstarted Server instance.
 func New(cfg Config) *Server {
 	cfg.applyDefaults()
 
-	// Initialize destination manager if destinations are provided
-	var destMgr *relay.DestinationManager
-	if len(cfg.RelayDestinations) > 0 {
-		var err error
-		// Create a client factory that wraps the client.New function
-		clientFactory := func(url string) (relay.RTMPClient, error) {
-			return client.New(url)
-		}
-		destMgr, err = relay.NewDestinationManager(cfg.RelayDestinations, logger.Logger(), clientFactory)
-		if err != nil {
-			logger.Logger().Error("Failed to initialize destination manager", "error", err)
-			// Continue without relay functionality
-		}
-	}
+	destMgr := newDestinationManager(cfg)
 
-	// Register per-destination relay metrics endpoint
-	if destMgr != nil {
-		metrics.RegisterRelaySnapshot(func() interface{} {
-			return destMgr.Snapshot()
-		})
-	} else {
-		metrics.RegisterRelaySnapshot(func() interface{} {
-			return []interface{}{}
-		})
+	vhosts := make(map[string]*vhost, len(cfg.VHosts))
+	for name, vc := range cfg.VHosts {
+		vhosts[strings.ToLower(name)] = newVHost(strings.ToLower(name), vc, cfg)
 	}
 
+	// Register per-destination relay metrics endpoint, covering the
+	// default host's and every vhost's destinations.
+	metrics.RegisterRelaySnapshot(func() interface{} {
+		out := []relay.DestinationInfo{}
+		if destMgr != nil {
+			out = append(out, destMgr.Snapshot()...)
+		}
+		for _, vh := range vhosts {
+			if vh.destMgr != nil {
+				out = append(out, vh.destMgr.Snapshot()...)
+			}
+		}
+		return out
+	})
+
 	// Initialize hook manager
 	hookMgr := initializeHookManager(cfg, logger.Logger())
 
-	reg := NewRegistry()
+	var recordStore storage.Store
+	if cfg.RecordStorage != "" {
+		var err error
+		recordStore, err = storage.Open(cfg.RecordStorage)
+		if err != nil {
+			logger.Logger().Error("Failed to open record storage", "error", err)
+			// Continue with local recordings only
+		}
+	}
+
+	reg := newRegistry(cfg)
 
-	// Register per-stream metrics snapshot (computed on each /debug/vars request).
+	// Register per-stream metrics snapshot (computed on each /debug/vars
+	// request), vhost streams after the default host's.
 	metrics.RegisterStreamSnapshot(func() interface{} {
-		return reg.Snapshot()
+		infos := reg.Snapshot()
+		for _, vh := range vhosts {
+			infos = append(infos, vh.reg.Snapshot()...)
+		}
+		return infos
+	})
+	metrics.RegisterRegistrySnapshot(func() interface{} {
+		st := reg.Stats()
+		for _, vh := range vhosts {
+			st.add(vh.reg.Stats())
+		}
+		return st
+	})
+	metrics.RegisterStreamGroupSnapshot(func() interface{} {
+		return reg.GroupSnapshot()
 	})
 
-	return &Server{
+	var directory *cluster.Directory
+	if cfg.ClusterRedisURL != "" {
+		var err error
+		directory, err = cluster.Open(cfg.ClusterRedisURL, "", 0)
+		if err != nil {
+			logger.Logger().Error("Failed to open cluster directory", "error", err)
+			// Continue without clustering
+		}
+	}
+
+	keyPolicy, err := NewStreamKeyPolicy(cfg.StreamKeyMaxLength, cfg.StreamKeyCharset)
+	if err != nil {
+		logger.Logger().Error("Invalid stream key policy, using the defaults", "error", err)
+		keyPolicy = defaultKeyPolicy
+	}
+
+	var recordStreams []*hooks.StreamMatcher
+	for _, pattern := range cfg.RecordStreams {
+		m, err := hooks.NewStreamMatcher(pattern)
+		if err != nil {
+			logger.Logger().Error("Invalid record stream pattern", "error", err)
+			continue
+		}
+		recordStreams = append(recordStreams, m)
+	}
+
+	s := &Server{
 		cfg:                cfg,
 		reg:                reg,
 		conns:              make(map[string]*iconn.Connection),
@@ -189,18 +669,61 @@ func New(cfg Config) *Server {
 		destinationManager: destMgr,
 		hookManager:        hookMgr,
 		ingressManager:     ingress.NewManager(logger.Logger()),
+		recordStore:        recordStore,
+		recordStreams:      recordStreams,
+		directory:          directory,
+		keyPolicy:          keyPolicy,
+		vhosts:             vhosts,
 	}
+	s.uploadCtx, s.cancelUploads = context.WithCancel(context.Background())
+
+	// Transcoder processes are created in Start (they need the bound port).
+	metrics.RegisterTranscodeSnapshot(func() interface{} {
+		s.mu.RLock()
+		tm := s.transcodeManager
+		s.mu.RUnlock()
+		if tm == nil {
+			return []interface{}{}
+		}
+		return tm.Snapshot()
+	})
+	return s
 }
 
-// Start begins listening and launches the accept loop. It's safe to call
-// only once; repeated calls return an error.
+// Start begins listening on Config.ListenAddr and launches the accept loop.
+// It's safe to call only once; repeated calls return an error.
 func (s *Server) Start() error {
 	if s == nil {
 		return errors.New("nil server")
 	}
+	s.mu.Lock()
+	started := s.l != nil
+	s.mu.Unlock()
+	if started {
+		return errors.New("server already started")
+	}
+	ln, err := net.Listen("tcp", s.cfg.ListenAddr)
+	if err != nil {
+		return fmt.Errorf("listen %s: %w", s.cfg.ListenAddr, err)
+	}
+	if err := s.Serve(ln); err != nil {
+		_ = ln.Close()
+		return err
+	}
+	return nil
+}
+
+// Serve is Start with an existing listener, e.g. a socket inherited from
+// systemd: it launches the accept loop on ln instead of listening on
+// Config.ListenAddr. Unlike net/http's Serve it returns once the server is
+// running; Stop closes ln. Either Start or Serve may be called, once.
+func (s *Server) Serve(ln net.Listener) error {
+	if s == nil {
+		return errors.New("nil server")
+	}
 
 	s.log.Debug("starting server",
-		"listen_addr", s.cfg.ListenAddr,
+		"listen_addr", ln.Addr().String(),
 		"chunk_size", s.cfg.ChunkSize,
 		"window_ack_size", s.cfg.WindowAckSize,
 		"record_all", s.cfg.RecordAll,
@@ -216,27 +739,60 @@ func (s *Server) Start() error {
 		s.mu.Unlock()
 		return errors.New("server already started")
 	}
-	ln, err := net.Listen("tcp", s.cfg.ListenAddr)
-	if err != nil {
-		s.mu.Unlock()
-		return fmt.Errorf("listen %s: %w", s.cfg.ListenAddr, err)
-	}
 	s.l = ln
+	gcDone := make(chan struct{})
+	s.gcDone = gcDone
+	if s.cfg.TranscodeCommand != "" {
+		// Transcoders pull from and push to this server over loopback.
+		tcpAddr, ok := ln.Addr().(*net.TCPAddr)
+		if !ok {
+			s.log.Error("transcoding disabled", "error", "listener is not a TCP socket", "addr", ln.Addr().String())
+		} else {
+			baseURL := fmt.Sprintf("rtmp://127.0.0.1:%d", tcpAddr.Port)
+			tm, err := transcode.NewManager(s.cfg.TranscodeCommand, baseURL, logger.Logger())
+			if err != nil {
+				s.log.Error("transcoding disabled", "error", err)
+			} else {
+				s.transcodeManager = tm
+			}
+		}
+	}
 	s.mu.Unlock()
 
 	// Log the listening address and resolved IPs
 	s.logListenerInfo("RTMP", ln)
 	s.acceptingWg.Add(1)
 	go s.acceptLoop(ln)
+	go s.collectEmptyStreams(gcDone)
+	if s.cfg.SlowSubscriberDropRate > 0 {
+		go s.evictSlowSubscribers(gcDone)
+	}
+	if s.cfg.PingInterval > 0 {
+		go s.pingPlayers(gcDone)
+	}
+	if s.cfg.AVDriftThreshold > 0 {
+		go s.monitorAVDrift(gcDone)
+	}
+	if s.cfg.ThumbnailInterval > 0 && s.cfg.ThumbnailCommand != "" {
+		go s.generateThumbnails(gcDone)
+	}
+	for _, a := range s.cfg.StreamAliases {
+		go s.newAliasForwarder(a).run(gcDone)
+	}
+	if s.directory != nil && s.cfg.ClusterNodeURL != "" {
+		s.announcer.Add(1)
+		go s.announceStreams(gcDone)
+	}
 
 	// Start optional RTMPS (TLS) listener
-	if s.cfg.TLSListenAddr != "" {
+	if s.cfg.tlsEnabled() {
 		tlsLn, err := s.startTLSListener()
 		if err != nil {
 			// TLS listener failure is fatal — stop the plain listener and return error
 			_ = ln.Close()
 			s.mu.Lock()
 			s.l = nil
+			close(gcDone)
 			s.mu.Unlock()
 			return fmt.Errorf("tls listen: %w", err)
 		}
@@ -256,6 +812,14 @@ func (s *Server) Start() error {
 		}
 	}
 
+	// Start optional origin link listener for edges
+	if s.cfg.LinkListenAddr != "" {
+		if err := s.startLinkListener(); err != nil {
+			// Edges can still pull over RTMP
+			s.log.Error("link listener failed to start", "error", err)
+		}
+	}
+
 	return nil
 }
 
@@ -264,9 +828,9 @@ func (s *Server) Start() error {
 // performs the TLS handshake lazily on first Read/Write (or when
 // Handshake() is called explicitly — see acceptLoop).
 func (s *Server) startTLSListener() (net.Listener, error) {
-	cert, err := tls.LoadX509KeyPair(s.cfg.TLSCertFile, s.cfg.TLSKeyFile)
+	cert, err := s.tlsCertificate()
 	if err != nil {
-		return nil, fmt.Errorf("load TLS certificate: %w", err)
+		return nil, err
 	}
 
 	// Log the certificate's subject and SANs so operators can verify
@@ -309,13 +873,47 @@ func (s *Server) startTLSListener() (net.Listener, error) {
 			return nil, nil
 		},
 	}
-	tcpLn, err := net.Listen("tcp", s.cfg.TLSListenAddr)
+	if s.cfg.TLSClientCAFile != "" {
+		pool, err := loadClientCAs(s.cfg.TLSClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.ClientCAs = pool
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+		s.log.Info("RTMPS requires client certificates", "client_ca_file", s.cfg.TLSClientCAFile)
+	}
+	tcpLn, err := s.listenTLS()
 	if err != nil {
-		return nil, fmt.Errorf("listen %s: %w", s.cfg.TLSListenAddr, err)
+		return nil, err
 	}
+	s.mu.Lock()
+	s.tlsRaw = tcpLn
+	s.mu.Unlock()
 	return tls.NewListener(tcpLn, tlsCfg), nil
 }
 
+// rejectedHandshake reports a client that opened with a handshake scheme
+// the server does not speak, such as RTMPE or RTMPT.
+func (s *Server) rejectedHandshake(remoteAddr, localAddr string, isTLS bool, e *handshake.UnsupportedSchemeError) {
+	version := fmt.Sprintf("0x%02x", e.Version)
+	s.log.Warn("RTMP handshake rejected",
+		"remote", remoteAddr,
+		"local", localAddr,
+		"tls", isTLS,
+		"scheme", e.Scheme,
+		"version", version,
+		"reason", e.Reason(),
+		"stage", "handshake",
+	)
+	s.triggerHookEvent(hooks.EventHandshakeRejected, "", "", map[string]interface{}{
+		"remote_addr": remoteAddr,
+		"tls":         isTLS,
+		"scheme":      e.Scheme,
+		"version":     version,
+		"reason":      e.Reason(),
+	})
+}
+
 // classifyTLSError inspects a TLS handshake error and returns a short
 // human-readable diagnosis to help operators fix the problem quickly.
 func classifyTLSError(err error) string {
@@ -338,6 +936,14 @@ func classifyTLSError(err error) string {
 		return "client sent non-TLS data to the RTMPS port — ensure the client is configured for RTMPS (not plain RTMP)"
 	}
 
+	// Mutual TLS: no client certificate, or one that does not verify
+	if strings.Contains(errStr, "client didn't provide a certificate") {
+		return "client presented no certificate — the RTMPS listener requires client certificates (-tls-client-ca)"
+	}
+	if strings.Contains(errStr, "failed to verify certificate") {
+		return "client certificate rejected — not signed by a CA in -tls-client-ca, expired, or not valid for client authentication"
+	}
+
 	// TLS version mismatch
 	if strings.Contains(errStr, "protocol version") {
 		return "TLS protocol version mismatch — server requires TLS 1.2+; check client TLS capabilities"
@@ -500,17 +1106,32 @@ func (s *Server) acceptLoop(l net.Listener) {
 			"stage", "pre-handshake",
 		)
 
+		// The connection span runs from accept to disconnect; everything
+		// traced for this connection is its child.
+		connCtx, connSpan := s.cfg.Tracer.Start(context.Background(), "rtmp.connection",
+			telemetry.String("net.peer.addr", remoteAddr),
+			telemetry.String("net.host.addr", localAddr),
+		)
+		connSpan.SetKind(telemetry.KindServer)
+
 		// Detect whether this connection arrived over TLS.
 		// If TLS, perform an explicit TLS handshake so that any certificate or
 		// protocol errors are captured with full detail instead of surfacing
 		// later as an opaque EOF during the RTMP handshake.
 		tlsConn, isTLS := raw.(*tls.Conn)
+		connSpan.SetAttributes(telemetry.Bool("tls", isTLS))
 		if isTLS {
 			// Give the TLS handshake its own deadline so a stalled client
 			// doesn't block the accept loop indefinitely.
 			tlsConn.SetDeadline(time.Now().Add(10 * time.Second))
-			if err := tlsConn.Handshake(); err != nil {
+			_, tlsSpan := telemetry.Start(connCtx, "tls.handshake")
+			err := tlsConn.Handshake()
+			tlsSpan.RecordError(err)
+			tlsSpan.End()
+			if err != nil {
 				metrics.HandshakeFailuresTotal.Add(1)
+				connSpan.RecordError(err)
+				connSpan.End()
 
 				// Classify the TLS error to give operators actionable guidance.
 				// - EOF / connection reset: the client closed before completing
@@ -549,10 +1170,26 @@ func (s *Server) acceptLoop(l net.Listener) {
 		// We temporarily wrap the raw listener to reuse existing function.
 		// Trick: create a one-off fake listener returning this raw conn.
 		single := &singleConnListener{conn: raw}
-		c, err := iconn.Accept(single)
+		opts := s.cfg.controlOptions()
+		opts.TraceDir = s.cfg.TraceDir
+		opts.ChunkDiagnostics = s.cfg.ChunkDiagnostics
+		opts.SendTimeout = s.cfg.SendTimeout
+		opts.ReadTimeout = s.cfg.IdleTimeout
+		opts.ReplyUnsupported = s.cfg.HandshakeRejectReply
+		_, hsSpan := telemetry.Start(connCtx, "rtmp.handshake")
+		c, err := iconn.AcceptWithOptions(single, opts)
+		hsSpan.RecordError(err)
+		hsSpan.End()
 		if err != nil {
 			// Handshake failed — log at WARN so operators can diagnose
 			metrics.HandshakeFailuresTotal.Add(1)
+			connSpan.RecordError(err)
+			connSpan.End()
+			var unsupported *handshake.UnsupportedSchemeError
+			if errors.As(err, &unsupported) {
+				s.rejectedHandshake(remoteAddr, localAddr, isTLS, unsupported)
+				continue
+			}
 			s.log.Warn("RTMP handshake failed",
 				"remote", remoteAddr,
 				"local", localAddr,
@@ -563,6 +1200,9 @@ func (s *Server) acceptLoop(l net.Listener) {
 			continue
 		}
 
+		c.SetReadLimits(s.cfg.readLimits(false)) // relaxed once connect succeeds
+		connSpan.SetAttributes(telemetry.String("rtmp.conn_id", c.ID()))
+
 		s.mu.Lock()
 		s.conns[c.ID()] = c
 		s.mu.Unlock()
@@ -586,14 +1226,14 @@ func (s *Server) acceptLoop(l net.Listener) {
 		)
 
 		// Trigger connection accept hook event
-		s.triggerHookEvent(hooks.EventConnectionAccept, c.ID(), "", map[string]interface{}{
+		s.triggerHookEvent(hooks.EventConnectionAccept, c.ID(), "", clientCertOf(raw).hookData(map[string]interface{}{
 			"remote_addr": raw.RemoteAddr().String(),
 			"tls":         isTLS,
-		})
+		}))
 
 		// Wire command handling so real clients (OBS/ffmpeg) can complete
 		// connect/createStream/publish. (Incremental integration step.)
-		attachCommandHandling(c, s.reg, &s.cfg, s.log, s.destinationManager, s)
+		attachCommandHandling(connCtx, c, s.reg, &s.cfg, s.log, s.destinationManager, s)
 		// Start readLoop AFTER message handler is attached to avoid race condition
 		c.Start()
 	}
@@ -615,8 +1255,10 @@ func (s *Server) Stop() error {
 	s.l = nil
 	tlsLn := s.tlsListener
 	s.tlsListener = nil
+	s.tlsRaw = nil
 	srtLn := s.srtListener
 	s.srtListener = nil
+	close(s.gcDone)
 	s.mu.Unlock()
 	_ = l.Close()
 	if tlsLn != nil {
@@ -641,15 +1283,39 @@ func (s *Server) Stop() error {
 		_ = c.Close()
 	}
 
-	// Clean up all active recorders
+	s.closeLinks()
+	s.stopOriginPulls()
+	s.announcer.Wait()
+	if s.directory != nil {
+		_ = s.directory.Close()
+	}
+
+	// Clean up all active recorders, then let their uploads finish so the
+	// recording_uploaded events still reach the hook manager.
 	s.cleanupAllRecorders()
+	s.waitUploads()
 
-	// Close destination manager
+	// Close destination managers
 	if s.destinationManager != nil {
 		if err := s.destinationManager.Close(); err != nil {
 			s.log.Error("Error closing destination manager", "error", err)
 		}
 	}
+	for _, vh := range s.sortedVHosts() {
+		if vh.destMgr != nil {
+			if err := vh.destMgr.Close(); err != nil {
+				s.log.Error("Error closing destination manager", "vhost", vh.name, "error", err)
+			}
+		}
+	}
+
+	// Kill transcoder processes
+	s.mu.RLock()
+	tm := s.transcodeManager
+	s.mu.RUnlock()
+	if tm != nil {
+		_ = tm.Close()
+	}
 
 	// Close hook manager
 	if s.hookManager != nil {
@@ -700,6 +1366,86 @@ func (s *Server) ConnectionCount() int {
 	return len(s.conns)
 }
 
+// ConnectionInfo is a snapshot of one active RTMP connection.
+type ConnectionInfo struct {
+	ID          string        // connection ID, as in logs and hook events
+	RemoteAddr  string        // peer address
+	App         string        // connect command's app ("" before connect)
+	Role        string        // iconn.RolePublisher, iconn.RoleSubscriber or "" when idle
+	StreamKey   string        // stream being published or played ("" when idle)
+	ConnectedAt time.Time     // when the connection was accepted
+	Uptime      time.Duration // time since ConnectedAt
+	BytesIn     uint64        // bytes received after the handshake
+	BytesOut    uint64        // bytes of RTMP messages sent
+
+	// What the peer sent about itself and negotiated, to identify the
+	// encoder and version behind a problematic session.
+	FlashVer          string // connect command's flashVer, e.g. "FMLE/3.0 (compatible; FMSc/1.0)"
+	Encoder           string // publisher's onMetaData "encoder" ("" when not sent)
+	PeerChunkSize     uint32 // chunk size the peer set with Set Chunk Size (128 when it never did)
+	PeerWindowAckSize uint32 // Window Acknowledgement Size the peer announced (0 = none)
+	PeerBandwidth     uint32 // Set Peer Bandwidth the peer sent (0 = none)
+
+	PingRTT time.Duration // round trip of the last heartbeat ping answered (0 = none yet)
+}
+
+// connectionInfo snapshots c. A connection publishing or playing on
+// several message streams reports the first one.
+func connectionInfo(c *iconn.Connection, now time.Time) ConnectionInfo {
+	info := ConnectionInfo{
+		ID:          c.ID(),
+		ConnectedAt: c.AcceptedAt(),
+		Uptime:      now.Sub(c.AcceptedAt()),
+		BytesIn:     c.BytesRead(),
+		BytesOut:    c.BytesWritten(),
+	}
+	if addr := c.RemoteAddr(); addr != nil {
+		info.RemoteAddr = addr.String()
+	}
+	info.PingRTT = c.PingRTT()
+	ctrl := c.ControlState()
+	info.PeerChunkSize, info.PeerWindowAckSize, info.PeerBandwidth = ctrl.ReadChunkSize, ctrl.RemoteWindowAckSize, ctrl.RemoteBandwidth
+	if sess := c.Session(); sess != nil {
+		ci := sess.Info()
+		info.App, info.FlashVer, info.Encoder = ci.App, ci.FlashVer, sess.Encoder()
+		for _, st := range sess.Streams() {
+			if st.Role != "" {
+				info.Role, info.StreamKey = st.Role, st.Key
+				break
+			}
+		}
+	}
+	return info
+}
+
+// Connections returns a snapshot of every active RTMP connection, ordered
+// by ID.
+func (s *Server) Connections() []ConnectionInfo {
+	s.mu.RLock()
+	conns := make([]*iconn.Connection, 0, len(s.conns))
+	for _, c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.RUnlock()
+
+	now := time.Now()
+	out := make([]ConnectionInfo, len(conns))
+	for i, c := range conns {
+		out[i] = connectionInfo(c, now)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// GetConnection returns the active connection with the given ID, e.g. one
+// named by a hook event, or false if it has disconnected.
+func (s *Server) GetConnection(id string) (*iconn.Connection, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, ok := s.conns[id]
+	return c, ok
+}
+
 // RemoveConnection removes a single connection from the tracking map.
 // Called by the disconnect handler when a connection's readLoop exits.
 func (s *Server) RemoveConnection(id string) {
@@ -811,6 +1557,29 @@ func (s *singleConnListener) Addr() net.Addr {
 	return &net.TCPAddr{}
 }
 
+// collectEmptyStreams periodically removes streams that have had no
+// publisher and no subscribers for EndedStreamTTL, until done is closed.
+func (s *Server) collectEmptyStreams(done <-chan struct{}) {
+	t := time.NewTicker(s.cfg.EndedStreamTTL)
+	defer t.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+			for _, reg := range s.registries() {
+				for _, c := range reg.CollectEmpty(s.cfg.EndedStreamTTL) {
+					s.log.Debug("empty stream removed", "stream_key", c.Key, "state", c.State.String(), "vhost", reg.vhost)
+					s.triggerHookEvent(hooks.EventStreamDelete, "", c.Key, vhostHookData(reg.vhost, map[string]interface{}{
+						"state":     c.State.String(),
+						"empty_sec": c.Empty.Seconds(),
+					}))
+				}
+			}
+		}
+	}
+}
+
 // cleanupAllRecorders closes all active recorders in the registry.
 // This is called during server shutdown to ensure all FLV files are properly closed.
 func (s *Server) cleanupAllRecorders() {
@@ -818,12 +1587,10 @@ func (s *Server) cleanupAllRecorders() {
 		return
 	}
 
-	s.reg.mu.RLock()
-	streams := make([]*Stream, 0, len(s.reg.streams))
-	for _, stream := range s.reg.streams {
-		streams = append(streams, stream)
+	var streams []*Stream
+	for _, reg := range s.registries() {
+		streams = append(streams, reg.streamList()...)
 	}
-	s.reg.mu.RUnlock()
 
 	for _, stream := range streams {
 		if stream == nil {
@@ -858,6 +1625,114 @@ func (s *Server) triggerHookEvent(eventType hooks.EventType, connID, streamKey s
 	s.hookManager.TriggerEvent(context.Background(), *event)
 }
 
+// OnEvent registers fn to be called for every event of the given type,
+// letting embedding applications react to server events in-process.
+// Callbacks run asynchronously in the hook execution pool; an error is
+// logged. The returned function unregisters the callback.
+//
+//	srv.OnEvent(hooks.EventPublishStart, func(e hooks.Event) error {
+//	    log.Printf("publishing %s", e.StreamKey)
+//	    return nil
+//	})
+func (s *Server) OnEvent(eventType hooks.EventType, fn func(hooks.Event) error) (unregister func()) {
+	id := fmt.Sprintf("func_%d", s.hookSeq.Add(1))
+	_ = s.hookManager.RegisterHook(eventType, hooks.NewFuncHook(id, fn))
+	return func() { s.hookManager.UnregisterHook(eventType, id) }
+}
+
+// Subscribe returns a channel receiving events of the given types (all
+// types when none are given). Up to buffer events are queued; further
+// events are dropped until the consumer catches up. cancel unregisters the
+// subscription and closes the channel.
+func (s *Server) Subscribe(buffer int, eventTypes ...hooks.EventType) (events <-chan hooks.Event, cancel func()) {
+	if len(eventTypes) == 0 {
+		eventTypes = hooks.AllEventTypes
+	}
+	id := fmt.Sprintf("chan_%d", s.hookSeq.Add(1))
+	h := hooks.NewChanHook(id, buffer)
+	for _, t := range eventTypes {
+		_ = s.hookManager.RegisterHook(t, h)
+	}
+	return h.Events(), func() {
+		for _, t := range eventTypes {
+			s.hookManager.UnregisterHook(t, id)
+		}
+		h.Close()
+	}
+}
+
+// startTranscode spawns the configured transcoder for a newly published
+// stream. Streams tagged with a "transcoded" query parameter (the output of
+// a transcoder) are skipped to avoid transcoding loops.
+func (s *Server) startTranscode(streamKey string, queryParams map[string]string) {
+	if s == nil {
+		return
+	}
+	if _, tagged := queryParams["transcoded"]; tagged {
+		return
+	}
+	s.mu.RLock()
+	tm := s.transcodeManager
+	s.mu.RUnlock()
+	if tm != nil {
+		tm.Start(streamKey)
+	}
+}
+
+// stopTranscode kills the transcoder for streamKey once the stream no longer
+// has a publisher. The check keeps an evicted publisher's late disconnect
+// from killing the transcoder of the publisher that replaced it.
+func (s *Server) stopTranscode(streamKey string) {
+	if s == nil {
+		return
+	}
+	s.mu.RLock()
+	tm := s.transcodeManager
+	s.mu.RUnlock()
+	if tm == nil || hasLivePublisher(s.reg, streamKey) {
+		return
+	}
+	tm.Stop(streamKey)
+}
+
+// parseHookSpec splits a HookScripts/HookWebhooks entry,
+// "event_type=target" or "event_type@pattern=target", at the first "=".
+// match is nil when no pattern is given.
+func parseHookSpec(spec string) (eventType hooks.EventType, match *hooks.StreamMatcher, target string, err error) {
+	head, target, ok := strings.Cut(spec, "=")
+	if !ok || head == "" || target == "" {
+		return "", nil, "", fmt.Errorf("missing event type or target")
+	}
+	name, pattern, scoped := strings.Cut(head, "@")
+	if scoped {
+		if match, err = hooks.NewStreamMatcher(pattern); err != nil {
+			return "", nil, "", err
+		}
+	}
+	return hooks.EventType(name), match, target, nil
+}
+
+// webhookQueueName names the persisted queue of the webhook spec
+// ("event_type[@pattern]=url") after a hash of the spec, so a queue is
+// reloaded by the same webhook however the webhook list is reordered or
+// edited. used counts the names given out; a repeated spec gets a numbered
+// name of its own.
+func webhookQueueName(spec string, used map[string]int) string {
+	sum := sha256.Sum256([]byte(spec))
+	name := "webhook_" + hex.EncodeToString(sum[:8])
+	used[name]++
+	if n := used[name]; n > 1 {
+		name = fmt.Sprintf("%s_%d", name, n)
+	}
+	return name
+}
+
+// recordsStream reports whether streamKey is recorded by configuration
+// (Config.RecordAll or Config.RecordStreams), whatever the publisher asks.
+func (s *Server) recordsStream(streamKey string) bool {
+	return s.cfg.RecordAll || hooks.MatchAny(s.recordStreams, streamKey)
+}
+
 // initializeHookManager creates and configures the hook manager from server config.
 func initializeHookManager(cfg Config, logger *slog.Logger) *hooks.HookManager {
 	hookConfig := hooks.HookConfig{
@@ -874,30 +1749,53 @@ func initializeHookManager(cfg Config, logger *slog.Logger) *hooks.HookManager {
 
 	hookManager := hooks.NewHookManager(hookConfig, logger)
 
-	// Register shell hooks from configuration (format: "event_type=/path/to/script")
+	// Register shell hooks from configuration (format: "event_type[@pattern]=/path/to/script")
 	for i, script := range cfg.HookScripts {
-		parts := strings.SplitN(script, "=", 2)
-		if len(parts) != 2 {
-			logger.Error("Invalid shell hook format (expected event_type=script_path)", "hook", script)
+		eventType, match, target, err := parseHookSpec(script)
+		if err != nil {
+			logger.Error("Invalid shell hook format (expected event_type[@pattern]=script_path)", "hook", script, "error", err)
 			continue
 		}
-		eventType := hooks.EventType(parts[0])
-		shellHook := hooks.NewShellHook(fmt.Sprintf("shell_%d", i), parts[1], 30*time.Second)
-		if err := hookManager.RegisterHook(eventType, shellHook); err != nil {
+		shellHook := hooks.NewShellHook(fmt.Sprintf("shell_%d", i), target, 30*time.Second)
+		if err := hookManager.RegisterHookFor(eventType, shellHook, match); err != nil {
 			logger.Error("Failed to register shell hook", "hook", script, "error", err)
 		}
 	}
 
-	// Register webhook hooks from configuration (format: "event_type=https://url")
+	// Register webhook hooks from configuration (format: "event_type[@pattern]=https://url")
+	queueNames := make(map[string]int)
 	for i, webhook := range cfg.HookWebhooks {
-		parts := strings.SplitN(webhook, "=", 2)
-		if len(parts) != 2 {
-			logger.Error("Invalid webhook hook format (expected event_type=url)", "hook", webhook)
+		eventType, match, target, err := parseHookSpec(webhook)
+		if err != nil {
+			logger.Error("Invalid webhook hook format (expected event_type[@pattern]=url)", "hook", webhook, "error", err)
 			continue
 		}
-		eventType := hooks.EventType(parts[0])
-		webhookHook := hooks.NewWebhookHook(fmt.Sprintf("webhook_%d", i), parts[1], 30*time.Second)
-		if err := hookManager.RegisterHook(eventType, webhookHook); err != nil {
+		webhookHook := hooks.NewWebhookHook(fmt.Sprintf("webhook_%d", i), target, 30*time.Second).
+			SetSecret(cfg.HookWebhookSecret).
+			SetRetry(cfg.HookWebhookRetries, time.Second)
+		for _, header := range cfg.HookWebhookHeaders {
+			name, value, ok := strings.Cut(header, ":")
+			if !ok {
+				logger.Error("Invalid webhook header (expected Name: value)", "header", header)
+				continue
+			}
+			webhookHook.AddHeader(strings.TrimSpace(name), strings.TrimSpace(value))
+		}
+		var hook hooks.Hook = webhookHook
+		if cfg.HookQueueSize > 0 {
+			queued, err := hooks.NewQueuedHook(webhookHook, hooks.QueueConfig{
+				MaxSize: cfg.HookQueueSize,
+				MaxAge:  cfg.HookQueueMaxAge,
+				Dir:     cfg.HookQueueDir,
+				Name:    webhookQueueName(webhook, queueNames),
+			}, logger)
+			if err != nil {
+				logger.Error("Failed to create webhook queue, delivering directly", "hook", webhook, "error", err)
+			} else {
+				hook = queued
+			}
+		}
+		if err := hookManager.RegisterHookFor(eventType, hook, match); err != nil {
 			logger.Error("Failed to register webhook hook", "hook", webhook, "error", err)
 		}
 	}
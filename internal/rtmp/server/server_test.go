@@ -3,8 +3,15 @@
 // The Server manages: listener, accept loop, connection tracking, and
 // graceful shutdown. These tests verify:
 //   - Start/Stop idempotency (Stop can be called twice safely).
+//   - Serve runs on an existing listener, e.g. one inherited from systemd.
 //   - Accept loop: TCP dial + handshake → connection tracked.
 //   - Graceful shutdown: Stop closes all active connections.
+//   - Connections/GetConnection report each connection's role and stream.
+//   - play_start/play_stop events carry the stream's player count.
+//   - Players are told when the publisher unpublishes or disconnects.
+//   - Streams left empty are removed and reported with stream_delete.
+//   - Publishing types "record" and "append" record without RecordAll.
+//   - Before connect succeeds only command-sized messages are accepted.
 //
 // Key Go concepts:
 //   - ListenAddr ":0" lets the OS pick a free port (avoids conflicts).
@@ -13,11 +20,23 @@
 package server
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"net"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/alxayo/go-rtmp/internal/logger"
+	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/client"
+	iconn "github.com/alxayo/go-rtmp/internal/rtmp/conn"
 	"github.com/alxayo/go-rtmp/internal/rtmp/handshake"
+	"github.com/alxayo/go-rtmp/internal/rtmp/rpc"
+	"github.com/alxayo/go-rtmp/internal/rtmp/server/hooks"
 )
 
 // TestServerStartStop verifies the basic lifecycle: Start on :0 picks a
@@ -40,6 +59,42 @@ func TestServerStartStop(t *testing.T) {
 	}
 }
 
+// TestServerServe verifies that Serve accepts RTMP connections on a
+// listener opened by the caller, refuses a second start, and that Stop
+// closes the listener.
+func TestServerServe(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(Config{ListenAddr: "127.0.0.1:1"}) // ignored by Serve
+	if err := s.Serve(ln); err != nil {
+		t.Fatalf("serve failed: %v", err)
+	}
+	if s.Addr().String() != ln.Addr().String() {
+		t.Fatalf("Addr = %v, want %v", s.Addr(), ln.Addr())
+	}
+	if err := s.Start(); err == nil {
+		t.Fatal("Start after Serve succeeded")
+	}
+
+	c, err := net.DialTimeout("tcp", ln.Addr().String(), 2*time.Second)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer c.Close()
+	if err := handshake.ClientHandshake(c); err != nil {
+		t.Fatalf("client handshake failed: %v", err)
+	}
+
+	if err := s.Stop(); err != nil {
+		t.Fatalf("stop failed: %v", err)
+	}
+	if _, err := ln.Accept(); err == nil {
+		t.Fatal("listener still open after Stop")
+	}
+}
+
 // TestServerAcceptConnection dials the server, completes the RTMP
 // handshake, and polls ConnectionCount until it reaches 1 (or times out).
 func TestServerAcceptConnection(t *testing.T) {
@@ -116,3 +171,522 @@ func TestServerGracefulShutdown(t *testing.T) {
 		}
 	}
 }
+
+// TestServerOnEventAndSubscribe verifies Go callbacks and channel
+// subscriptions receive the connection_accept event for a new client.
+func TestServerOnEventAndSubscribe(t *testing.T) {
+	s := New(Config{ListenAddr: ":0"})
+	got := make(chan hooks.Event, 1)
+	unregister := s.OnEvent(hooks.EventConnectionAccept, func(e hooks.Event) error {
+		got <- e
+		return nil
+	})
+	defer unregister()
+	events, cancel := s.Subscribe(4)
+	if err := s.Start(); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	defer s.Stop()
+
+	c, err := net.DialTimeout("tcp", s.Addr().String(), 2*time.Second)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer c.Close()
+	if err := handshake.ClientHandshake(c); err != nil {
+		t.Fatalf("client handshake failed: %v", err)
+	}
+
+	for name, ch := range map[string]<-chan hooks.Event{"OnEvent": got, "Subscribe": events} {
+		select {
+		case e := <-ch:
+			if e.Type != hooks.EventConnectionAccept || e.ConnID == "" {
+				t.Errorf("%s: unexpected event %+v", name, e)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s: no event received", name)
+		}
+	}
+
+	cancel()
+	for range events {
+		// drain until cancel closes the channel
+	}
+}
+
+// TestServerConnections publishes one stream and checks the snapshot
+// Connections returns, including the peer's flashVer and encoder, the
+// GetConnection lookup, and that a closed connection disappears from both.
+func TestServerConnections(t *testing.T) {
+	s := New(Config{ListenAddr: "127.0.0.1:0"})
+	if err := s.Start(); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	defer s.Stop()
+	c, err := client.New(fmt.Sprintf("rtmp://%s/live/registry", s.Addr().String()))
+	if err != nil {
+		t.Fatalf("client.New: %v", err)
+	}
+	if err := c.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if err := c.Publish(); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	meta, _ := amf.EncodeAll("@setDataFrame", "onMetaData", map[string]interface{}{"encoder": "obs-output module (libobs version 30.0.2)"})
+	if err := c.SendData(0, meta); err != nil {
+		t.Fatalf("send metadata: %v", err)
+	}
+	if err := c.SendVideo(0, []byte{0x17, 0x00, 0, 0, 0, 0x01, 0x64, 0x00, 0x1f}); err != nil {
+		t.Fatalf("send video: %v", err)
+	}
+
+	var info ConnectionInfo
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if conns := s.Connections(); len(conns) == 1 && conns[0].StreamKey != "" && conns[0].BytesIn > 0 && conns[0].Encoder != "" {
+			info = conns[0]
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if info.Role != iconn.RolePublisher || info.StreamKey != "live/registry" || info.App != "live" {
+		t.Fatalf("connection info = %+v, want a publisher of live/registry", info)
+	}
+	if info.RemoteAddr == "" || info.ConnectedAt.IsZero() || info.Uptime <= 0 || info.BytesOut == 0 {
+		t.Fatalf("connection info = %+v, want address, uptime and bytes sent", info)
+	}
+	if info.FlashVer != "LNX 9,0,124,2" || info.Encoder != "obs-output module (libobs version 30.0.2)" || info.PeerChunkSize != 128 {
+		t.Fatalf("connection info = %+v, want the client's flashVer, encoder and chunk size", info)
+	}
+	conn, ok := s.GetConnection(info.ID)
+	if !ok || conn.ID() != info.ID {
+		t.Fatalf("GetConnection(%q) = %v, %v", info.ID, conn, ok)
+	}
+
+	c.Close()
+	deadline = time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && len(s.Connections()) != 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := len(s.Connections()); n != 0 {
+		t.Fatalf("%d connections after the client closed, want 0", n)
+	}
+	if _, ok := s.GetConnection(info.ID); ok {
+		t.Fatal("GetConnection found a closed connection")
+	}
+}
+
+// TestPlayEventsSubscriberCount plays one stream from two clients and
+// checks that play_start and play_stop carry the number of players.
+func TestPlayEventsSubscriberCount(t *testing.T) {
+	s := New(Config{ListenAddr: "127.0.0.1:0"})
+	if err := s.Start(); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	defer s.Stop()
+	events, cancel := s.Subscribe(4, hooks.EventPlayStart, hooks.EventPlayStop)
+	defer cancel()
+
+	expect := func(typ hooks.EventType, subscribers int) {
+		t.Helper()
+		select {
+		case e := <-events:
+			if e.Type != typ || e.StreamKey != "live/count" || e.ConnID == "" || e.Data["subscribers"] != subscribers {
+				t.Fatalf("event %s %s conn %q data %v, want %s with %d subscribers", e.Type, e.StreamKey, e.ConnID, e.Data, typ, subscribers)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no %s event", typ)
+		}
+	}
+	dial := func() *client.Client {
+		c, err := client.New(fmt.Sprintf("rtmp://%s/live/count", s.Addr().String()))
+		if err != nil {
+			t.Fatalf("client.New: %v", err)
+		}
+		if err := c.Connect(); err != nil {
+			t.Fatalf("connect: %v", err)
+		}
+		return c
+	}
+	play := func() *client.Client {
+		c := dial()
+		if err := c.Play(); err != nil {
+			t.Fatalf("play: %v", err)
+		}
+		return c
+	}
+
+	pub := dial()
+	defer pub.Close()
+	if err := pub.Publish(); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for !hasLivePublisher(s.reg, "live/count") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	first := play()
+	defer first.Close()
+	expect(hooks.EventPlayStart, 1)
+	second := play()
+	expect(hooks.EventPlayStart, 2)
+	second.Close()
+	expect(hooks.EventPlayStop, 1)
+}
+
+// TestUnpublishNotifiesPlayers checks that a player is sent
+// NetStream.Play.UnpublishNotify and a Stream EOF both when the publisher
+// sends deleteStream and when it disconnects.
+func TestUnpublishNotifiesPlayers(t *testing.T) {
+	s := New(Config{ListenAddr: "127.0.0.1:0"})
+	if err := s.Start(); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	defer s.Stop()
+	dial := func() *client.Client {
+		c, err := client.New(fmt.Sprintf("rtmp://%s/live/ending", s.Addr().String()))
+		if err != nil {
+			t.Fatalf("client.New: %v", err)
+		}
+		if err := c.Connect(); err != nil {
+			t.Fatalf("connect: %v", err)
+		}
+		return c
+	}
+	publish := func() *client.Client {
+		c := dial()
+		if err := c.Publish(); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+		deadline := time.Now().Add(2 * time.Second)
+		for !hasLivePublisher(s.reg, "live/ending") && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		return c
+	}
+
+	pub := publish()
+	defer pub.Close()
+	player := dial()
+	defer player.Close()
+	if err := player.Play(); err != nil {
+		t.Fatalf("play: %v", err)
+	}
+	// Player messages, reduced to onStatus codes and "eof" for Stream EOF.
+	got := make(chan string, 16)
+	go func() {
+		for {
+			msg, err := player.ReadMessage()
+			if err != nil {
+				close(got)
+				return
+			}
+			if msg.TypeID == 4 && len(msg.Payload) >= 2 && msg.Payload[0] == 0 && msg.Payload[1] == 1 {
+				got <- "eof"
+			}
+			if vals, err := amf.DecodeAll(msg.Payload); err == nil && len(vals) > 3 && vals[0] == "onStatus" {
+				if info, ok := vals[3].(map[string]interface{}); ok {
+					got <- info["code"].(string)
+				}
+			}
+		}
+	}()
+	expect := func(how string, want ...string) {
+		t.Helper()
+		deadline := time.After(2 * time.Second)
+		for len(want) > 0 {
+			select {
+			case code := <-got:
+				if code == want[0] {
+					want = want[1:]
+				}
+			case <-deadline:
+				t.Fatalf("after %s: player did not get %v", how, want)
+			}
+		}
+	}
+	expectEnd := func(how string) {
+		t.Helper()
+		expect(how, rpc.CodePlayUnpublish, "eof")
+	}
+	expect("play", rpc.CodePlayStart)
+
+	if err := pub.DeleteStream(); err != nil {
+		t.Fatalf("deleteStream: %v", err)
+	}
+	expectEnd("deleteStream")
+
+	next := publish()
+	next.Close()
+	expectEnd("publisher disconnect")
+}
+
+// TestEmptyStreamCollected checks that a stream whose publisher left is
+// removed once EndedStreamTTL passes with nobody on it, and that the
+// removal fires stream_delete.
+func TestEmptyStreamCollected(t *testing.T) {
+	logger.UseWriter(io.Discard)
+	s := New(Config{ListenAddr: "127.0.0.1:0", EndedStreamTTL: 50 * time.Millisecond})
+	if err := s.Start(); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	defer s.Stop()
+	events, cancel := s.Subscribe(4, hooks.EventStreamDelete)
+	defer cancel()
+
+	pub := connectTo(t, s, "live/gone")
+	if err := pub.Publish(); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	waitFor(t, "publish", func() bool { return hasLivePublisher(s.reg, "live/gone") })
+	pub.Close()
+
+	select {
+	case ev := <-events:
+		if ev.StreamKey != "live/gone" || ev.Data["state"] != "ended" {
+			t.Fatalf("stream_delete event = %+v", ev)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no stream_delete event")
+	}
+	if s.reg.GetStream("live/gone") != nil {
+		t.Fatal("stream still registered after stream_delete")
+	}
+}
+
+// publishRecorded publishes a keyframe, an inter frame and, a second later,
+// another keyframe to key with publishing type pubType, and checks that the
+// publish is answered with NetStream.Publish.Start and Record.Start.
+func publishRecorded(t *testing.T, s *Server, key, pubType string) {
+	t.Helper()
+	c, err := client.New(fmt.Sprintf("rtmp://%s/%s", s.Addr().String(), key))
+	if err != nil {
+		t.Fatalf("client.New: %v", err)
+	}
+	c.PublishingType = pubType
+	if err := c.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer c.Close()
+	if err := c.Publish(); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	codes := make(chan string, 4)
+	go func() {
+		for {
+			msg, err := c.ReadMessage()
+			if err != nil {
+				close(codes)
+				return
+			}
+			if vals, err := amf.DecodeAll(msg.Payload); err == nil && len(vals) > 3 && vals[0] == "onStatus" {
+				if info, ok := vals[3].(map[string]interface{}); ok {
+					codes <- info["code"].(string)
+				}
+			}
+		}
+	}()
+	for _, want := range []string{rpc.CodePublishStart, rpc.CodeRecordStart} {
+		select {
+		case got := <-codes:
+			if got != want {
+				t.Fatalf("%s publish: onStatus %s, want %s", pubType, got, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s publish: no %s", pubType, want)
+		}
+	}
+	_ = c.SendVideo(0, []byte{0x17, 0x00, 0, 0, 0, 0x01, 0x64, 0x00, 0x1f})
+	_ = c.SendVideo(0, []byte{0x17, 0x01, 0, 0, 0, 0xAA})
+	_ = c.SendVideo(1000, []byte{0x27, 0x01, 0, 0, 0, 0xBB})
+	time.Sleep(100 * time.Millisecond)
+}
+
+// waitRecordingClosed waits for key's publisher to leave and its recording
+// to be finished.
+func waitRecordingClosed(s *Server, key string) {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		stream := s.reg.GetStream(key)
+		stream.mu.RLock()
+		done := stream.Publisher == nil && stream.Recorder == nil
+		stream.mu.RUnlock()
+		if done {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestPublishRecordAndAppend publishes with type "record" and then
+// "append" to a server without RecordAll: both are recorded, into one file,
+// and each publish is answered with NetStream.Record.Start.
+func TestPublishRecordAndAppend(t *testing.T) {
+	dir := t.TempDir()
+	s := New(Config{ListenAddr: "127.0.0.1:0", RecordDir: dir})
+	if err := s.Start(); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	defer s.Stop()
+
+	// waitClosed waits for the recording to be finished and returns its path.
+	waitClosed := func() string {
+		waitRecordingClosed(s, "live/rec")
+		entries, _ := os.ReadDir(dir)
+		if len(entries) != 1 {
+			t.Fatalf("%d recordings, want 1", len(entries))
+		}
+		return findRecording(dir, "live/rec")
+	}
+
+	publishRecorded(t, s, "live/rec", rpc.PublishRecord)
+	path := waitClosed()
+	first, _ := os.Stat(path)
+	publishRecorded(t, s, "live/rec", rpc.PublishAppend)
+	waitClosed()
+	if after, _ := os.Stat(path); after.Size() <= first.Size() {
+		t.Fatalf("recording size %d after append, want more than %d", after.Size(), first.Size())
+	}
+	if d := recordingDuration(path); d < 2 {
+		t.Fatalf("duration after append = %.3f, want both publishes (> 2s)", d)
+	}
+}
+
+// TestPublishAppend_PrefixKey appends to a stream whose key is a prefix of
+// a recorded one: it starts its own file rather than extending the other
+// stream's recording.
+func TestPublishAppend_PrefixKey(t *testing.T) {
+	dir := t.TempDir()
+	s := New(Config{ListenAddr: "127.0.0.1:0", RecordDir: dir})
+	if err := s.Start(); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	defer s.Stop()
+
+	publishRecorded(t, s, "live/show_720p", rpc.PublishRecord)
+	waitRecordingClosed(s, "live/show_720p")
+	other := findRecording(dir, "live/show_720p")
+	before, _ := os.Stat(other)
+
+	publishRecorded(t, s, "live/show", rpc.PublishAppend)
+	waitRecordingClosed(s, "live/show")
+	if after, _ := os.Stat(other); after.Size() != before.Size() {
+		t.Fatalf("live/show_720p recording grew from %d to %d bytes", before.Size(), after.Size())
+	}
+	if own := findRecording(dir, "live/show"); own == "" || own == other {
+		t.Fatalf("live/show recording = %q, want its own file", own)
+	}
+}
+
+// TestParseHookSpec checks "event_type[@pattern]=target" parsing, with the
+// target split off at the first "=" so URLs keep their query strings.
+func TestParseHookSpec(t *testing.T) {
+	ev, match, target, err := parseHookSpec("publish_start@events/*=https://hooks.example.com/p?a=1&user=x@y")
+	if err != nil || ev != hooks.EventPublishStart || target != "https://hooks.example.com/p?a=1&user=x@y" {
+		t.Fatalf("parseHookSpec = %q, %q, %v", ev, target, err)
+	}
+	if !match.Match("events/launch") || match.Match("live/launch") {
+		t.Fatalf("matcher %q scoped wrongly", match)
+	}
+	if _, match, _, _ := parseHookSpec("play_start=/bin/true"); match != nil {
+		t.Fatal("unscoped spec got a matcher")
+	}
+	for _, bad := range []string{"publish_start", "=x", "publish_start@~(=x"} {
+		if _, _, _, err := parseHookSpec(bad); err == nil {
+			t.Errorf("parseHookSpec(%q) succeeded, want error", bad)
+		}
+	}
+
+	s := New(Config{RecordStreams: []string{"vod/*", "~_rec$"}})
+	for key, want := range map[string]bool{"vod/movie": true, "live/show_rec": true, "live/show": false} {
+		if got := s.recordsStream(key); got != want {
+			t.Errorf("recordsStream(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
+
+// TestWebhookQueueName checks that persisted webhook queues are named
+// after their spec, not their position in the webhook list.
+func TestWebhookQueueName(t *testing.T) {
+	const a, b = "publish_start=https://hooks.example.com/a", "publish_start@live/*=https://hooks.example.com/a"
+	used := make(map[string]int)
+	na, nb, na2 := webhookQueueName(a, used), webhookQueueName(b, used), webhookQueueName(a, used)
+	if na == nb || na2 != na+"_2" {
+		t.Fatalf("names = %q, %q, %q", na, nb, na2)
+	}
+	if again := webhookQueueName(a, make(map[string]int)); again != na {
+		t.Fatalf("name of %q = %q, then %q", a, na, again)
+	}
+}
+
+// TestPreConnectReadLimits sends a large connect split into 128-byte chunks,
+// which must succeed, and a video message larger than MaxAMFMessageSize,
+// which is refused before connect and accepted after it.
+func TestPreConnectReadLimits(t *testing.T) {
+	s := New(Config{ListenAddr: "127.0.0.1:0"})
+	if err := s.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer s.Stop()
+
+	dial := func() (net.Conn, *chunk.Writer, *chunk.Reader) {
+		nc, err := net.DialTimeout("tcp", s.Addr().String(), 2*time.Second)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		t.Cleanup(func() { nc.Close() })
+		if err := handshake.ClientHandshake(nc); err != nil {
+			t.Fatalf("handshake: %v", err)
+		}
+		_ = nc.SetDeadline(time.Now().Add(5 * time.Second))
+		return nc, chunk.NewWriter(nc, 128), chunk.NewReader(nc, 128)
+	}
+	command := func(w *chunk.Writer, vals ...interface{}) {
+		payload, err := amf.EncodeAll(vals...)
+		if err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+		if err := w.WriteMessage(&chunk.Message{CSID: 3, TypeID: 20, MessageLength: uint32(len(payload)), Payload: payload}); err != nil {
+			t.Fatalf("write %v: %v", vals[0], err)
+		}
+	}
+	awaitResult := func(r *chunk.Reader, what string) {
+		for {
+			msg, err := r.ReadMessage()
+			if err != nil {
+				t.Fatalf("waiting for %s _result: %v", what, err)
+			}
+			if msg.TypeID != 20 {
+				continue
+			}
+			if vals, _ := amf.DecodeAll(msg.Payload); len(vals) > 0 && vals[0] == "_result" {
+				return
+			}
+		}
+	}
+	bigVideo := &chunk.Message{CSID: 6, TypeID: 9, MessageStreamID: 1, MessageLength: 300 << 10, Payload: make([]byte, 300<<10)}
+
+	_, w, r := dial()
+	command(w, "connect", 1.0, map[string]interface{}{
+		"app":     "live",
+		"tcUrl":   "rtmp://" + s.Addr().String() + "/live",
+		"swfUrl":  "http://example.com/" + strings.Repeat("s", 60000),
+		"pageUrl": "http://example.com/" + strings.Repeat("p", 60000),
+	})
+	awaitResult(r, "connect")
+	if err := w.WriteMessage(bigVideo); err != nil {
+		t.Fatalf("write video: %v", err)
+	}
+	command(w, "createStream", 2.0, nil)
+	awaitResult(r, "createStream")
+
+	nc, w, _ := dial()
+	_ = w.WriteMessage(bigVideo) // may fail once the server hangs up
+	_, err := io.Copy(io.Discard, nc)
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		t.Fatal("an oversized message before connect did not disconnect the client")
+	}
+}
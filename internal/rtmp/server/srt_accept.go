@@ -157,7 +157,7 @@ func (s *Server) startSRTListener() error {
 	// Start the accept loop in a background goroutine.
 	// acceptingWg ensures the server waits for this goroutine during shutdown.
 	s.acceptingWg.Add(1)
-	go s.srtAcceptLoop()
+	go s.srtAcceptLoop(ln)
 
 	return nil
 }
@@ -168,13 +168,13 @@ func (s *Server) startSRTListener() error {
 // This is the SRT equivalent of acceptLoop() for RTMP. It runs in its
 // own goroutine and processes connections sequentially (each connection
 // spawns its own goroutine for actual media processing).
-func (s *Server) srtAcceptLoop() {
+func (s *Server) srtAcceptLoop(ln *srt.Listener) {
 	defer s.acceptingWg.Done()
-	s.log.Debug("SRT accept loop started", "listener_addr", s.srtListener.Addr().String())
+	s.log.Debug("SRT accept loop started", "listener_addr", ln.Addr().String())
 
 	for {
 		// Block until a new SRT connection completes its handshake
-		req, err := s.srtListener.Accept()
+		req, err := ln.Accept()
 		if err != nil {
 			// Check if we're shutting down
 			s.mu.RLock()
@@ -242,6 +242,25 @@ func (s *Server) handleSRTConnection(req *srt.ConnRequest) {
 		req.Reject(srt.RejectBadRequest)
 		return
 	}
+	if err := s.keyPolicy.Check(info.StreamKey()); err != nil {
+		s.log.Warn("SRT connection rejected: invalid stream key",
+			"stream_id", req.StreamID(),
+			"error", err,
+			"remote", req.PeerAddr().String(),
+			"stage", "rejected",
+		)
+		req.Reject(srt.RejectBadRequest)
+		return
+	}
+	if s.isStreamAlias(info.StreamKey()) {
+		s.log.Warn("SRT connection rejected: stream key is an alias",
+			"stream_key", info.StreamKey(),
+			"remote", req.PeerAddr().String(),
+			"stage", "rejected",
+		)
+		req.Reject(srt.RejectBadRequest)
+		return
+	}
 
 	// Accept the SRT connection — this completes the handshake.
 	s.log.Debug("SRT accepting connection",
@@ -324,6 +343,18 @@ func (s *Server) handleSRTConnection(req *srt.ConnRequest) {
 		"stage", "registering",
 	)
 	session, err := s.ingressManager.BeginPublish(pub)
+	if err != nil && s.cfg.DuplicatePublisherPolicy != PublisherPolicyReplace {
+		// Only the replace policy may take over a live key; SRT has no way to
+		// report a renamed key, so rename behaves like reject here.
+		s.log.Warn("SRT rejecting duplicate publisher",
+			"stream_key", info.StreamKey(),
+			"conn_id", connID,
+			"policy", s.cfg.DuplicatePublisherPolicy,
+		)
+		conn.Close()
+		metrics.SRTConnectionsActive.Add(-1)
+		return
+	}
 	if err != nil {
 		// Stream key in use — evict the stale session and retry.
 		// This handles the common case where a streamer disconnects
@@ -351,8 +382,9 @@ func (s *Server) handleSRTConnection(req *srt.ConnRequest) {
 	// Create or get the stream in the registry. This is the same structure
 	// used by RTMP publishers — it holds subscribers, codec info, sequence
 	// headers, and the recorder. Creating it here makes SRT streams visible
-	// to RTMP play clients and the recording system.
-	stream, _ := s.reg.CreateStream(info.StreamKey())
+	// to RTMP play clients and the recording system. PublishStream also
+	// registers this SRT connection as the stream's publisher.
+	stream, err := s.reg.PublishStream(info.StreamKey(), pub)
 	if stream == nil {
 		s.log.Error("SRT failed to create stream in registry",
 			"stream_key", info.StreamKey(),
@@ -364,10 +396,20 @@ func (s *Server) handleSRTConnection(req *srt.ConnRequest) {
 		return
 	}
 
-	// Register this SRT connection as the stream's publisher.
-	// This enforces single-publisher-per-stream and allows RTMP play
-	// clients to detect that a publisher is active.
-	if err := stream.SetPublisher(pub); err != nil {
+	// A stream key that is already published is refused, enforcing
+	// single-publisher-per-stream, unless the replace policy evicts the
+	// stale publisher.
+	if err != nil && s.cfg.DuplicatePublisherPolicy != PublisherPolicyReplace {
+		s.log.Warn("SRT rejecting duplicate publisher",
+			"stream_key", info.StreamKey(),
+			"conn_id", connID,
+			"policy", s.cfg.DuplicatePublisherPolicy,
+		)
+		session.EndPublish()
+		conn.Close()
+		metrics.SRTConnectionsActive.Add(-1)
+		return
+	} else if err != nil {
 		// Publisher already exists — evict the stale one. This mirrors
 		// the RTMP eviction pattern in command_integration.go and handles
 		// reconnection after unclean disconnect (zombie connection).
@@ -385,15 +427,25 @@ func (s *Server) handleSRTConnection(req *srt.ConnRequest) {
 		}
 	}
 
+	// SRT stream IDs carry no query parameters, so SRT publishes are always
+	// eligible for transcoding.
+	s.startTranscode(info.StreamKey(), nil)
+	s.ensureRedundantAlias(info.StreamKey())
+
 	// Mark stream for recording — actual recorder creation is deferred to the
 	// first media frame (in the MediaHandler below) so that the video codec is
 	// known and the correct container format (FLV for H.264, MP4 for H.265+)
 	// is selected automatically.
-	if s.cfg.RecordAll {
+	if s.recordsStream(info.StreamKey()) {
 		stream.mu.Lock()
 		stream.RecordDir = s.cfg.RecordDir
 		stream.SegmentDuration = s.cfg.SegmentDuration // propagate segment config
 		stream.SegmentPattern = s.cfg.SegmentPattern   // propagate segment config
+		stream.RecordFormat = s.cfg.RecordFormat
+		stream.RecordTimecode = s.cfg.RecordTimecode
+		stream.RecordQueueSize = s.cfg.RecordQueueSize
+		stream.RecordingClosed = s.recordingClosedFunc(nil, info.StreamKey())
+		stream.recordSync, stream.recordBase = true, 0
 		stream.mu.Unlock()
 		s.log.Info("recording requested",
 			"stream_key", info.StreamKey(),
@@ -413,6 +465,11 @@ func (s *Server) handleSRTConnection(req *srt.ConnRequest) {
 	detector := &media.CodecDetector{}
 	connLog := s.log.With("conn_id", connID)
 	session.MediaHandler = func(msg *chunk.Message) {
+		// 0. Re-base the timestamp onto the stream's monotonic timeline
+		if from := msg.Timestamp; stream.NormalizeTimestamp(msg) {
+			connLog.Info("timestamp discontinuity re-based", "stream_key", info.StreamKey(), "from", from, "to", msg.Timestamp)
+		}
+
 		// 1. Codec detection + subscriber broadcast first
 		stream.BroadcastMessage(detector, msg, connLog)
 
@@ -420,9 +477,7 @@ func (s *Server) handleSRTConnection(req *srt.ConnRequest) {
 		ensureRecorder(stream, connLog)
 
 		// 3. Write to recorder (snapshot under lock to avoid race with teardown)
-		if rec := stream.GetRecorder(); rec != nil {
-			rec.WriteMessage(msg)
-		}
+		stream.writeRecording(msg)
 	}
 
 	// Start the bridge — this blocks until the SRT connection closes.
@@ -450,7 +505,7 @@ func (s *Server) handleSRTConnection(req *srt.ConnRequest) {
 		)
 	}
 
-	// Clean up: close recorder, clear publisher, end session, close connection.
+	// Clean up: close recorder, end the stream, end session, close connection.
 	// This mirrors the RTMP publisher disconnect cleanup in command_integration.go.
 	//
 	// Guard all cleanup with a publisher identity check: if we were evicted
@@ -478,12 +533,12 @@ func (s *Server) handleSRTConnection(req *srt.ConnRequest) {
 				stream.Recorder = nil
 				metrics.RecordingsActive.Add(-1)
 			}
-			stream.Publisher = nil
-			metrics.PublishersActive.Add(-1)
 		}
 		stream.mu.Unlock()
+		stream.EndPublish(pub)
 	}
 
+	s.stopTranscode(info.StreamKey())
 	session.EndPublish()
 	conn.Close()
 	metrics.SRTConnectionsActive.Add(-1)
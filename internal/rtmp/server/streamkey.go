@@ -0,0 +1,99 @@
+package server
+
+// Stream Key Policy
+// -----------------
+// Stream keys (app/name) become registry keys, recording file names, hook
+// arguments and log fields, so the server does not take them verbatim.
+// The rpc parsers normalize names (rpc.NormalizeStreamName), then before a
+// publish or play is handled the resulting key is checked:
+//
+//   - at most Config.StreamKeyMaxLength bytes
+//   - valid UTF-8 without control characters or backslashes
+//   - no empty, "." or ".." path segments
+//   - every segment made of Config.StreamKeyCharset characters
+//
+// The app name from connect is held to the same rules. Publishers with a
+// bad key get NetStream.Publish.BadName, players NetStream.Play.Failed and
+// SRT callers a bad-request rejection.
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultStreamKeyMaxLength is the longest stream key accepted by
+	// default, in bytes, including the app name.
+	DefaultStreamKeyMaxLength = 256
+
+	// DefaultStreamKeyCharset is the regexp character class, without the
+	// brackets, that stream key segments are made of by default.
+	DefaultStreamKeyCharset = `A-Za-z0-9._~=+@-`
+)
+
+// StreamKeyPolicy checks app names and stream keys (see the top of this
+// file). Build one with NewStreamKeyPolicy.
+type StreamKeyPolicy struct {
+	maxLength int
+	charset   string
+	segment   *regexp.Regexp
+}
+
+// NewStreamKeyPolicy returns a policy allowing keys of up to maxLength bytes
+// whose segments are made of the characters in charset, a regexp character
+// class without the brackets (e.g. "a-z0-9_"). Zero values select the
+// defaults.
+func NewStreamKeyPolicy(maxLength int, charset string) (*StreamKeyPolicy, error) {
+	if maxLength < 0 {
+		return nil, fmt.Errorf("stream key max length %d is negative", maxLength)
+	}
+	if maxLength == 0 {
+		maxLength = DefaultStreamKeyMaxLength
+	}
+	if charset == "" {
+		charset = DefaultStreamKeyCharset
+	}
+	segment, err := regexp.Compile(`^[` + charset + `]+$`)
+	if err != nil {
+		return nil, fmt.Errorf("stream key charset %q: %w", charset, err)
+	}
+	return &StreamKeyPolicy{maxLength: maxLength, charset: charset, segment: segment}, nil
+}
+
+// defaultKeyPolicy is used when Config holds an invalid policy.
+var defaultKeyPolicy, _ = NewStreamKeyPolicy(0, "")
+
+// Check returns an error describing why key is not allowed, or nil. A nil
+// policy applies the defaults.
+func (p *StreamKeyPolicy) Check(key string) error {
+	if p == nil {
+		p = defaultKeyPolicy
+	}
+	if key == "" {
+		return errors.New("empty")
+	}
+	if len(key) > p.maxLength {
+		return fmt.Errorf("longer than %d bytes", p.maxLength)
+	}
+	if !utf8.ValidString(key) {
+		return errors.New("not valid UTF-8")
+	}
+	for _, r := range key {
+		if unicode.IsControl(r) || r == '\\' {
+			return fmt.Errorf("contains %q", r)
+		}
+	}
+	for _, seg := range strings.Split(key, "/") {
+		switch {
+		case seg == "" || seg == "." || seg == "..":
+			return fmt.Errorf("has path segment %q", seg)
+		case !p.segment.MatchString(seg):
+			return fmt.Errorf("segment %q has characters outside [%s]", seg, p.charset)
+		}
+	}
+	return nil
+}
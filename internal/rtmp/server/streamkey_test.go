@@ -0,0 +1,57 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStreamKeyPolicy(t *testing.T) {
+	def, err := NewStreamKeyPolicy(0, "")
+	if err != nil {
+		t.Fatalf("NewStreamKeyPolicy: %v", err)
+	}
+	for _, key := range []string{"live/show", "live/show_720p", "app/sub/stream-1", "live/key=abc+1@cdn", "live"} {
+		if err := def.Check(key); err != nil {
+			t.Errorf("Check(%q) = %v, want nil", key, err)
+		}
+	}
+	for _, key := range []string{
+		"",
+		"live/../etc/passwd",
+		"live/./show",
+		"live//show",
+		"live/show\x00",
+		"live/show\nINFO forged log line",
+		`live\show`,
+		"live/show me",
+		"live/" + strings.Repeat("a", DefaultStreamKeyMaxLength),
+		"live/\xff",
+	} {
+		if err := def.Check(key); err == nil {
+			t.Errorf("Check(%q) = nil, want an error", key)
+		}
+	}
+
+	strict, err := NewStreamKeyPolicy(12, "a-z")
+	if err != nil {
+		t.Fatalf("NewStreamKeyPolicy: %v", err)
+	}
+	if err := strict.Check("live/show"); err != nil {
+		t.Errorf("strict Check(live/show) = %v", err)
+	}
+	for _, key := range []string{"live/show_1", "live/showtime1"} {
+		if err := strict.Check(key); err == nil {
+			t.Errorf("strict Check(%q) = nil, want an error", key)
+		}
+	}
+
+	if _, err := NewStreamKeyPolicy(0, "a-"); err != nil {
+		t.Errorf("trailing hyphen is a literal: %v", err)
+	}
+	if _, err := NewStreamKeyPolicy(0, `\`); err == nil {
+		t.Errorf("expected an error for an invalid charset")
+	}
+	if _, err := NewStreamKeyPolicy(-1, ""); err == nil {
+		t.Errorf("expected an error for a negative length")
+	}
+}
@@ -0,0 +1,86 @@
+package server
+
+// Subscriber Limits
+// -----------------
+// Config.MaxSubscribersPerStream caps the players of each stream, and
+// AppConfig.MaxSubscribers caps them in one app, so a single stream going
+// viral cannot take every connection and all the bandwidth of an origin.
+// The limits live on the registry (Registry.SetSubscriberLimit). HandlePlay
+// and DVR playback check the count and add the player in one step under
+// the stream lock, so concurrent plays cannot overshoot. A refused player
+// gets NetStream.Play.Failed and the server fires EventSubscriberLimit.
+
+import (
+	"errors"
+	"maps"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/media"
+)
+
+// ErrSubscriberLimit is returned by HandlePlay when the stream already has
+// as many players as its limit allows.
+var ErrSubscriberLimit = errors.New("stream subscriber limit reached")
+
+// SetSubscriberLimit limits every stream to max players (0 = no limit),
+// except in the apps listed in apps, which map app names to their own
+// limit. It applies to plays after the call.
+func (r *Registry) SetSubscriberLimit(max int, apps map[string]int) {
+	r.mu.Lock()
+	r.maxSubscribers = max
+	r.appMaxSubscribers = maps.Clone(apps)
+	r.mu.Unlock()
+}
+
+// subscriberLimit returns the player limit of app's streams (0 = none).
+func (r *Registry) subscriberLimit(app string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if n, ok := r.appMaxSubscribers[app]; ok {
+		return n
+	}
+	return r.maxSubscribers
+}
+
+// subscriberLimits collects the player limits of cfg for SetSubscriberLimit.
+func (cfg *Config) subscriberLimits() (int, map[string]int) {
+	var apps map[string]int
+	for app, ac := range cfg.Apps {
+		if ac.MaxSubscribers > 0 {
+			if apps == nil {
+				apps = make(map[string]int)
+			}
+			apps[app] = ac.MaxSubscribers
+		}
+	}
+	return cfg.MaxSubscribersPerStream, apps
+}
+
+// addStreamSubscriberLimit adds sub like AddStreamSubscriber, or like
+// AddDVRSubscriber when dvr is set. It returns ErrSubscriberLimit if the
+// stream already has max subscribers (0 = no limit) and ErrStreamCollected
+// if it is no longer in the registry.
+func (s *Stream) addStreamSubscriberLimit(sub media.Subscriber, streamID uint32, max int, dvr bool) error {
+	if s == nil || sub == nil {
+		return errors.New("nil stream or subscriber")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.collected {
+		return ErrStreamCollected
+	}
+	if max > 0 && len(s.Subscribers) >= max {
+		return ErrSubscriberLimit
+	}
+	if dvr {
+		if s.dvrSubs == nil {
+			s.dvrSubs = make(map[media.Subscriber]bool)
+		}
+		s.dvrSubs[sub] = true
+	}
+	if s.subStreamIDs == nil {
+		s.subStreamIDs = make(map[media.Subscriber]uint32)
+	}
+	s.subStreamIDs[sub] = streamID
+	s.addSubscriberLocked(sub)
+	return nil
+}
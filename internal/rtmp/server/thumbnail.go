@@ -0,0 +1,351 @@
+package server
+
+// Live Thumbnails
+// ---------------
+// With Config.ThumbnailInterval set, every stream keeps its publisher's
+// latest H.264 IDR keyframe, converted to Annex B: the SPS and PPS of the
+// sequence header, then the frame's NAL units, each behind a start code.
+// That is what a decoder needs to render the frame on its own, and what
+// ThumbnailHandler serves to dashboards.
+//
+// With Config.ThumbnailCommand also set, the server turns the keyframes
+// into JPEGs every interval: each live stream with a keyframe newer than
+// its last thumbnail has it piped to the command (typically ffmpeg), which
+// writes the image. The result replaces ThumbnailDir/<app>_<name>.jpg
+// (under a directory named after the virtual host for vhost streams) and
+// fires EventThumbnail. The command runs outside the media path; a failure is
+// logged and the stream tries again with the next keyframe.
+//
+// Command template (split on whitespace, no shell quoting):
+//
+//	{output}  path of the JPEG to write
+//	{key}     stream key (app/name)
+//	{app}     application name
+//	{name}    stream name
+//
+//	ffmpeg -loglevel error -f h264 -i - -frames:v 1 -y {output}
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/codec"
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/server/hooks"
+)
+
+// errNoIDR reports a keyframe without an IDR picture (an open-GOP
+// recovery point), which cannot be decoded on its own.
+var errNoIDR = errors.New("no IDR slice")
+
+// Keyframe is the latest H.264 IDR keyframe of a stream, in Annex B.
+type Keyframe struct {
+	Data       []byte    `json:"-"`
+	Timestamp  uint32    `json:"timestamp"` // stream timestamp, ms
+	CapturedAt time.Time `json:"captured_at"`
+}
+
+// ThumbnailInfo is one live stream in the thumbnail admin API.
+type ThumbnailInfo struct {
+	StreamKey  string    `json:"stream_key"`
+	Timestamp  uint32    `json:"timestamp"` // stream timestamp of the keyframe, ms
+	CapturedAt time.Time `json:"captured_at"`
+	Bytes      int       `json:"bytes"`             // size of the Annex B keyframe
+	Image      string    `json:"image,omitempty"`   // latest JPEG; empty until the command made one
+	ImageAt    time.Time `json:"image_at,omitzero"` // when it was written
+}
+
+// thumbnail is the latest JPEG made of a stream's keyframes.
+type thumbnail struct {
+	path string
+	from *Keyframe
+	at   time.Time
+}
+
+// SetThumbnails makes streams created after the call keep their latest
+// H.264 IDR keyframe (Stream.LatestKeyframe).
+func (r *Registry) SetThumbnails(on bool) {
+	r.mu.Lock()
+	r.thumbnails = on
+	r.mu.Unlock()
+}
+
+// LatestKeyframe returns the stream's latest H.264 IDR keyframe in Annex
+// B, or nil when it has none (no keyframe yet, another codec, or keyframes
+// not kept).
+func (s *Stream) LatestKeyframe() *Keyframe {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.keyframe
+}
+
+// captureKeyframe keeps a published H.264 keyframe, in Annex B with the
+// parameter sets of the current sequence header, when the stream keeps
+// keyframes. Other codecs, inter frames and keyframes without an IDR are
+// ignored.
+func (s *Stream) captureKeyframe(msg *chunk.Message) {
+	if !s.thumbnails {
+		return
+	}
+	frame, ok := avcKeyframeData(msg.Payload)
+	if !ok {
+		return
+	}
+	s.mu.RLock()
+	hdr := s.VideoSequenceHeader
+	s.mu.RUnlock()
+	if hdr == nil {
+		return
+	}
+	config, ok := avcConfigData(hdr.Payload)
+	if !ok {
+		return
+	}
+	data, err := annexBKeyframe(config, frame)
+	if err != nil {
+		return
+	}
+	kf := &Keyframe{Data: data, Timestamp: msg.Timestamp, CapturedAt: time.Now()}
+	s.mu.Lock()
+	s.keyframe = kf
+	s.mu.Unlock()
+}
+
+// avcKeyframeData returns the NAL units (AVCC) of an H.264 keyframe
+// payload, legacy or Enhanced RTMP "avc1".
+func avcKeyframeData(p []byte) ([]byte, bool) {
+	if len(p) < 5 || (p[0]>>4)&0x07 != 1 {
+		return nil, false
+	}
+	if p[0]&0x80 == 0 {
+		if p[0]&0x0F != 7 || p[1] != 1 { // AVC NALU
+			return nil, false
+		}
+		return p[5:], true
+	}
+	if string(p[1:5]) != "avc1" {
+		return nil, false
+	}
+	switch p[0] & 0x0F {
+	case 1: // CodedFrames: composition time first
+		if len(p) < 8 {
+			return nil, false
+		}
+		return p[8:], true
+	case 3: // CodedFramesX
+		return p[5:], true
+	}
+	return nil, false
+}
+
+// avcConfigData returns the AVCDecoderConfigurationRecord of an H.264
+// sequence header payload, legacy or Enhanced RTMP "avc1".
+func avcConfigData(p []byte) ([]byte, bool) {
+	if len(p) < 5 {
+		return nil, false
+	}
+	if p[0]&0x80 == 0 {
+		return p[5:], p[0]&0x0F == 7 && p[1] == 0
+	}
+	return p[5:], string(p[1:5]) == "avc1" && p[0]&0x0F == 0
+}
+
+// annexBKeyframe converts an H.264 keyframe's AVCC NAL units to Annex B,
+// preceded by the SPS and PPS of config unless the frame carries its own.
+// It fails unless the frame holds an IDR slice.
+func annexBKeyframe(config, frame []byte) ([]byte, error) {
+	cfg, err := codec.ParseAVCDecoderConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	nalus := codec.SplitLengthPrefixed(frame, cfg.NALULengthSize)
+	idr, params := false, false
+	for _, n := range nalus {
+		switch codec.NALUType(n) {
+		case codec.NALUTypeIDR:
+			idr = true
+		case codec.NALUTypeSPS, codec.NALUTypePPS:
+			params = true
+		}
+	}
+	if !idr {
+		return nil, errNoIDR
+	}
+	startCode := []byte{0x00, 0x00, 0x00, 0x01}
+	var buf bytes.Buffer
+	if !params {
+		nalus = append([][]byte{cfg.SPS, cfg.PPS}, nalus...)
+	}
+	for _, n := range nalus {
+		buf.Write(startCode)
+		buf.Write(n)
+	}
+	return buf.Bytes(), nil
+}
+
+// generateThumbnails makes thumbnails each Config.ThumbnailInterval until
+// done is closed.
+func (s *Server) generateThumbnails(done <-chan struct{}) {
+	t := time.NewTicker(s.cfg.ThumbnailInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+			s.thumbnailRound()
+		}
+	}
+}
+
+// thumbnailRound runs the thumbnail command for every live stream with a
+// keyframe newer than its last thumbnail, in parallel, and waits for them.
+// A command gets one interval to finish.
+func (s *Server) thumbnailRound() {
+	var wg sync.WaitGroup
+	for _, stream := range s.streamList() {
+		if stream.State() != StreamPublishing {
+			continue
+		}
+		stream.mu.RLock()
+		kf, last := stream.keyframe, stream.thumbnail
+		stream.mu.RUnlock()
+		if kf == nil || last != nil && last.from == kf {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.makeThumbnail(stream, kf)
+		}()
+	}
+	wg.Wait()
+}
+
+// makeThumbnail pipes kf, stream's latest keyframe, to the thumbnail
+// command, moves the JPEG into place and fires EventThumbnail.
+func (s *Server) makeThumbnail(stream *Stream, kf *Keyframe) {
+	path := filepath.Join(s.cfg.ThumbnailDir, stream.vhost, strings.ReplaceAll(stream.Key, "/", "_")+".jpg")
+	log := s.log.With("stream_key", stream.Key, "file", path)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		log.Warn("thumbnail failed", "error", err)
+		return
+	}
+	tmp := strings.TrimSuffix(path, ".jpg") + ".tmp.jpg"
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.ThumbnailInterval)
+	defer cancel()
+	args := expandThumbnailCommand(s.cfg.ThumbnailCommand, stream.Key, tmp)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(kf.Data)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(tmp)
+		log.Warn("thumbnail command failed", "error", err, "stderr", strings.TrimSpace(stderr.String()))
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		log.Warn("thumbnail failed", "error", err)
+		return
+	}
+	info, _ := os.Stat(path)
+	var size int64
+	if info != nil {
+		size = info.Size()
+	}
+	stream.mu.Lock()
+	stream.thumbnail = &thumbnail{path: path, from: kf, at: time.Now()}
+	stream.mu.Unlock()
+	log.Debug("thumbnail written", "timestamp", kf.Timestamp, "bytes", size)
+	s.triggerHookEvent(hooks.EventThumbnail, "", stream.Key, vhostHookData(stream.vhost, map[string]interface{}{
+		"file":      path,
+		"bytes":     size,
+		"timestamp": kf.Timestamp,
+	}))
+}
+
+// expandThumbnailCommand splits the thumbnail command template and fills
+// in the placeholders for streamKey and the output path.
+func expandThumbnailCommand(template, streamKey, output string) []string {
+	app, name, _ := strings.Cut(streamKey, "/")
+	r := strings.NewReplacer("{output}", output, "{key}", streamKey, "{app}", app, "{name}", name)
+	args := strings.Fields(template)
+	for i, a := range args {
+		args[i] = r.Replace(a)
+	}
+	return args
+}
+
+// ThumbnailHandler returns the admin HTTP API for live stream previews
+// (Config.ThumbnailInterval):
+//
+//	GET /api/thumbnails                    list live streams with a keyframe
+//	GET /api/thumbnails/{key}              latest keyframe, Annex B H.264
+//	GET /api/thumbnails/{key}?format=jpeg  latest JPEG (Config.ThumbnailCommand)
+//
+// The keyframe is served as video/h264 with its stream timestamp in
+// X-Keyframe-Timestamp; any H.264 decoder renders it on its own. A stream
+// that is not live or has no keyframe (or JPEG) yet is 404. The handler
+// does no authentication: wrap it, e.g. with auth.RequireBearer.
+func (s *Server) ThumbnailHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/thumbnails", func(w http.ResponseWriter, r *http.Request) {
+		list := []ThumbnailInfo{}
+		for _, stream := range s.reg.liveStreams() {
+			stream.mu.RLock()
+			kf, th := stream.keyframe, stream.thumbnail
+			stream.mu.RUnlock()
+			if kf == nil {
+				continue
+			}
+			info := ThumbnailInfo{StreamKey: stream.Key, Timestamp: kf.Timestamp, CapturedAt: kf.CapturedAt, Bytes: len(kf.Data)}
+			if th != nil {
+				info.Image, info.ImageAt = th.path, th.at
+			}
+			list = append(list, info)
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].StreamKey < list[j].StreamKey })
+		writeAdminJSON(w, http.StatusOK, list)
+	})
+	mux.HandleFunc("GET /api/thumbnails/{key...}", func(w http.ResponseWriter, r *http.Request) {
+		key := r.PathValue("key")
+		stream := s.reg.GetStream(key)
+		if stream.State() != StreamPublishing {
+			writeAdminError(w, http.StatusNotFound, fmt.Errorf("thumbnail %s: %w", key, ErrStreamNotLive))
+			return
+		}
+		stream.mu.RLock()
+		kf, th := stream.keyframe, stream.thumbnail
+		stream.mu.RUnlock()
+		if r.URL.Query().Get("format") == "jpeg" {
+			if th == nil {
+				writeAdminError(w, http.StatusNotFound, fmt.Errorf("thumbnail %s: no image yet", key))
+				return
+			}
+			w.Header().Set("Content-Type", "image/jpeg")
+			http.ServeFile(w, r, th.path)
+			return
+		}
+		if kf == nil {
+			writeAdminError(w, http.StatusNotFound, fmt.Errorf("thumbnail %s: no keyframe yet", key))
+			return
+		}
+		w.Header().Set("Content-Type", "video/h264")
+		w.Header().Set("X-Keyframe-Timestamp", strconv.FormatUint(uint64(kf.Timestamp), 10))
+		w.Header().Set("Last-Modified", kf.CapturedAt.UTC().Format(http.TimeFormat))
+		_, _ = w.Write(kf.Data)
+	})
+	return mux
+}
@@ -0,0 +1,149 @@
+// thumbnail_test.go – tests for keyframe capture and live thumbnails.
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/logger"
+	"github.com/alxayo/go-rtmp/internal/rtmp/server/hooks"
+)
+
+// H.264 test stream: an AVCDecoderConfigurationRecord with 4-byte NAL
+// lengths and a keyframe of SEI + IDR slice, as x264 sends them.
+var (
+	thumbSPS    = []byte{0x67, 0x64, 0x00, 0x1F, 0xAC, 0xD9}
+	thumbPPS    = []byte{0x68, 0xEB, 0xE3, 0xCB}
+	thumbConfig = []byte{0x01, 0x64, 0x00, 0x1F, 0xFF, 0xE1,
+		0x00, 0x06, 0x67, 0x64, 0x00, 0x1F, 0xAC, 0xD9,
+		0x01, 0x00, 0x04, 0x68, 0xEB, 0xE3, 0xCB}
+	thumbFrame = []byte{
+		0x00, 0x00, 0x00, 0x03, 0x06, 0x05, 0x01, // SEI
+		0x00, 0x00, 0x00, 0x04, 0x65, 0x88, 0x84, 0x00, // IDR slice
+	}
+	thumbAnnexB = []byte{
+		0x00, 0x00, 0x00, 0x01, 0x67, 0x64, 0x00, 0x1F, 0xAC, 0xD9,
+		0x00, 0x00, 0x00, 0x01, 0x68, 0xEB, 0xE3, 0xCB,
+		0x00, 0x00, 0x00, 0x01, 0x06, 0x05, 0x01,
+		0x00, 0x00, 0x00, 0x01, 0x65, 0x88, 0x84, 0x00,
+	}
+)
+
+func TestAnnexBKeyframe(t *testing.T) {
+	got, err := annexBKeyframe(thumbConfig, thumbFrame)
+	if err != nil || !bytes.Equal(got, thumbAnnexB) {
+		t.Fatalf("annexBKeyframe = % x, %v; want % x", got, err, thumbAnnexB)
+	}
+
+	// A frame carrying its own parameter sets is not given a second copy.
+	inBand := append([]byte{0x00, 0x00, 0x00, 0x06}, thumbSPS...)
+	inBand = append(inBand, 0x00, 0x00, 0x00, 0x04)
+	inBand = append(append(inBand, thumbPPS...), thumbFrame[7:]...)
+	got, err = annexBKeyframe(thumbConfig, inBand)
+	if err != nil || len(got) != len(thumbAnnexB)-7 {
+		t.Fatalf("in-band parameter sets: % x, %v", got, err)
+	}
+
+	recovery := []byte{0x00, 0x00, 0x00, 0x04, 0x41, 0x9A, 0x00, 0x00} // non-IDR slice
+	if _, err := annexBKeyframe(thumbConfig, recovery); !errors.Is(err, errNoIDR) {
+		t.Fatalf("keyframe without IDR: %v, want errNoIDR", err)
+	}
+
+	legacy := append([]byte{0x17, 0x01, 0x00, 0x00, 0x00}, thumbFrame...)
+	enhanced := append([]byte{0x93, 'a', 'v', 'c', '1'}, thumbFrame...)
+	for name, p := range map[string][]byte{"legacy": legacy, "enhanced CodedFramesX": enhanced} {
+		if data, ok := avcKeyframeData(p); !ok || !bytes.Equal(data, thumbFrame) {
+			t.Errorf("%s: avcKeyframeData = % x, %v", name, data, ok)
+		}
+	}
+	for name, p := range map[string][]byte{
+		"inter frame":     {0x27, 0x01, 0x00, 0x00, 0x00, 0x41},
+		"sequence header": append([]byte{0x17, 0x00, 0x00, 0x00, 0x00}, thumbConfig...),
+		"hevc keyframe":   {0x1C, 0x01, 0x00, 0x00, 0x00, 0x26},
+		"av1 keyframe":    {0x91, 'a', 'v', '0', '1', 0x32},
+	} {
+		if _, ok := avcKeyframeData(p); ok {
+			t.Errorf("%s taken for an H.264 keyframe", name)
+		}
+	}
+}
+
+// TestThumbnails publishes H.264 with thumbnails on and checks that the
+// latest keyframe is kept, that the command (tee, writing its input) is
+// run with it and fires the thumbnail event, and the admin API.
+func TestThumbnails(t *testing.T) {
+	if _, err := exec.LookPath("tee"); err != nil {
+		t.Skipf("tee not available: %v", err)
+	}
+	logger.UseWriter(io.Discard)
+	dir := t.TempDir()
+	s := New(Config{
+		ListenAddr:        "127.0.0.1:0",
+		ThumbnailInterval: 50 * time.Millisecond,
+		ThumbnailCommand:  "tee {output}",
+		ThumbnailDir:      dir,
+	})
+	if err := s.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer s.Stop()
+	events, cancel := s.Subscribe(4, hooks.EventThumbnail)
+	defer cancel()
+
+	pub := connectTo(t, s, "live/thumb")
+	if err := pub.Publish(); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	waitFor(t, "publish", func() bool { return hasLivePublisher(s.reg, "live/thumb") })
+	_ = pub.SendVideo(0, append([]byte{0x17, 0x00, 0x00, 0x00, 0x00}, thumbConfig...))
+	_ = pub.SendVideo(0, append([]byte{0x17, 0x01, 0x00, 0x00, 0x00}, thumbFrame...))
+	_ = pub.SendVideo(40, []byte{0x27, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0x41, 0x9A})
+
+	var ev hooks.Event
+	select {
+	case ev = <-events:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no thumbnail event")
+	}
+	path := filepath.Join(dir, "live_thumb.jpg")
+	if ev.StreamKey != "live/thumb" || ev.Data["file"] != path || ev.Data["timestamp"] != uint32(0) {
+		t.Fatalf("thumbnail event = %+v", ev)
+	}
+	if b, err := os.ReadFile(path); err != nil || !bytes.Equal(b, thumbAnnexB) {
+		t.Fatalf("thumbnail file = % x, %v", b, err)
+	}
+	if kf := s.reg.GetStream("live/thumb").LatestKeyframe(); kf == nil || !bytes.Equal(kf.Data, thumbAnnexB) {
+		t.Fatalf("LatestKeyframe = %+v", kf)
+	}
+
+	h := s.ThumbnailHandler()
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+	var list []ThumbnailInfo
+	if w := get("/api/thumbnails"); w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &list) != nil ||
+		len(list) != 1 || list[0].StreamKey != "live/thumb" || list[0].Bytes != len(thumbAnnexB) || list[0].Image != path {
+		t.Fatalf("list = %d %s", w.Code, w.Body)
+	}
+	if w := get("/api/thumbnails/live/thumb"); w.Code != http.StatusOK || w.Header().Get("Content-Type") != "video/h264" ||
+		w.Header().Get("X-Keyframe-Timestamp") != "0" || !bytes.Equal(w.Body.Bytes(), thumbAnnexB) {
+		t.Fatalf("keyframe = %d %v % x", w.Code, w.Header(), w.Body.Bytes())
+	}
+	if w := get("/api/thumbnails/live/thumb?format=jpeg"); w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/jpeg" {
+		t.Fatalf("jpeg = %d %v", w.Code, w.Header())
+	}
+	if w := get("/api/thumbnails/live/missing"); w.Code != http.StatusNotFound {
+		t.Fatalf("missing stream = %d", w.Code)
+	}
+}
@@ -0,0 +1,130 @@
+package server
+
+// Timecode Injection (onFI)
+// -------------------------
+// Hardware encoders, FMLE and Wirecast can inject the source timecode into
+// the stream as onFI data messages ({tc: "hh:mm:ss:ff", sd: date, st: time
+// of day}). Broadcasters use it to line up feeds produced separately. The
+// server passes onFI through like any other data message and keeps the
+// latest one per stream (StreamInfo.Timecode). A timecode hook event fires
+// on the first onFI of a publish and whenever the timecode jumps, i.e. no
+// longer advances with the stream timestamps (a reset at the encoder, a
+// source switch). FLV recordings keep onFI as script tags when
+// Config.RecordTimecode is set.
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/media"
+	"github.com/alxayo/go-rtmp/internal/rtmp/server/hooks"
+)
+
+// timecodeTolerance is how far, in seconds, a timecode may drift from the
+// stream timestamps before it counts as a jump.
+const timecodeTolerance = 2
+
+// TimecodeInfo is the latest onFI timecode a stream's publisher sent.
+type TimecodeInfo struct {
+	Timecode        string    `json:"tc,omitempty"` // SMPTE timecode, hh:mm:ss:ff
+	SystemDate      string    `json:"sd,omitempty"` // encoder date, dd-mm-yyyy
+	SystemTime      string    `json:"st,omitempty"` // encoder time of day, hh:mm:ss.mmm
+	StreamTimestamp uint32    `json:"stream_timestamp"`
+	ReceivedAt      time.Time `json:"received_at"`
+}
+
+// setTimecode stores fi, received at stream time ts, as the stream's
+// latest timecode and returns the previous one (nil for the first of the
+// publish).
+func (s *Stream) setTimecode(fi media.FrameInfo, ts uint32) *TimecodeInfo {
+	tc := &TimecodeInfo{
+		Timecode:        fi.Timecode,
+		SystemDate:      fi.SystemDate,
+		SystemTime:      fi.SystemTime,
+		StreamTimestamp: ts,
+		ReceivedAt:      time.Now(),
+	}
+	s.mu.Lock()
+	prev := s.timecode
+	s.timecode = tc
+	s.mu.Unlock()
+	return prev
+}
+
+// reportTimecode stores m, a data message published by connID on
+// streamKey of virtual host vh (nil for the default host), as stream's
+// latest timecode if it is an onFI, and fires the timecode event on the
+// first one of the publish and when the timecode jumps.
+func (s *Server) reportTimecode(vh *vhost, connID, streamKey string, stream *Stream, m *chunk.Message) {
+	if stream == nil {
+		return
+	}
+	fi, ok := media.ParseFrameInfo(m.Payload)
+	if !ok {
+		return
+	}
+	prev := stream.setTimecode(fi, m.Timestamp)
+	reason := "first"
+	if prev != nil {
+		if !timecodeJumped(prev, fi.Timecode, m.Timestamp) {
+			return
+		}
+		reason = "discontinuity"
+	}
+	s.log.Info("timecode", "stream_key", streamKey, "conn_id", connID, "tc", fi.Timecode, "reason", reason, "timestamp", m.Timestamp)
+	data := map[string]interface{}{
+		"tc":        fi.Timecode,
+		"sd":        fi.SystemDate,
+		"st":        fi.SystemTime,
+		"timestamp": m.Timestamp,
+		"reason":    reason,
+	}
+	if prev != nil {
+		data["previous_tc"] = prev.Timecode
+	}
+	s.triggerHookEvent(hooks.EventTimecode, connID, streamKey, vh.hookData(data))
+}
+
+// timecodeJumped reports whether tc, received at stream time ts, is more
+// than timecodeTolerance away from where prev's timecode would be by then.
+// Timecodes that do not parse never count as a jump.
+func timecodeJumped(prev *TimecodeInfo, tc string, ts uint32) bool {
+	from, ok1 := timecodeSeconds(prev.Timecode)
+	to, ok2 := timecodeSeconds(tc)
+	if !ok1 || !ok2 {
+		return false
+	}
+	const day = 24 * 60 * 60
+	elapsed := int(int32(ts-prev.StreamTimestamp)) / 1000
+	// Difference from the expected timecode, in (-12h, 12h] so that the
+	// wrap at midnight is not a jump.
+	diff := ((to-from-elapsed)%day + day) % day
+	if diff > day/2 {
+		diff -= day
+	}
+	return diff > timecodeTolerance || diff < -timecodeTolerance
+}
+
+// timecodeSeconds returns the seconds since midnight of an SMPTE timecode
+// "hh:mm:ss:ff" (";" or "." before the frames for drop-frame), ignoring
+// the frames.
+func timecodeSeconds(tc string) (int, bool) {
+	if len(tc) < 8 {
+		return 0, false
+	}
+	parts := strings.Split(tc[:8], ":")
+	if len(parts) != 3 {
+		return 0, false
+	}
+	secs := 0
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 || n > 59 || i == 0 && n > 23 {
+			return 0, false
+		}
+		secs = secs*60 + n
+	}
+	return secs, true
+}
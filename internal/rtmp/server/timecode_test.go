@@ -0,0 +1,84 @@
+// timecode_test.go – tests for onFI timecode tracking and the timecode event.
+package server
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/logger"
+	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
+	"github.com/alxayo/go-rtmp/internal/rtmp/server/hooks"
+)
+
+// TestTimecodeEvents publishes onFI messages and verifies the timecode
+// event fires for the first one and for a jump but not while the timecode
+// follows the stream, and that stats report the latest one.
+func TestTimecodeEvents(t *testing.T) {
+	logger.UseWriter(io.Discard)
+	s := New(Config{ListenAddr: "127.0.0.1:0"})
+	if err := s.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer s.Stop()
+	events, cancel := s.Subscribe(4, hooks.EventTimecode)
+	defer cancel()
+
+	pub := connectTo(t, s, "live/tc")
+	if err := pub.Publish(); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	waitFor(t, "publish", func() bool { return hasLivePublisher(s.reg, "live/tc") })
+
+	onFI := func(ts uint32, tc string) {
+		p, _ := amf.EncodeAll("@setDataFrame", "onFI", amf.ECMAArray(map[string]interface{}{
+			"tc": tc, "sd": "17-10-2026", "st": "14:03:07.480",
+		}))
+		_ = pub.SendData(ts, p)
+	}
+	next := func() hooks.Event {
+		select {
+		case ev := <-events:
+			return ev
+		case <-time.After(2 * time.Second):
+			t.Fatal("no timecode event")
+			return hooks.Event{}
+		}
+	}
+
+	onFI(1000, "10:00:00:00")
+	if ev := next(); ev.Data["reason"] != "first" || ev.Data["tc"] != "10:00:00:00" || ev.Data["sd"] != "17-10-2026" || ev.Data["timestamp"] != uint32(1000) {
+		t.Fatalf("first event = %+v", ev)
+	}
+	onFI(2000, "10:00:01:00")
+	onFI(3000, "10:00:02;15")
+	onFI(4000, "01:00:00:00") // encoder reset
+	if ev := next(); ev.Data["reason"] != "discontinuity" || ev.Data["tc"] != "01:00:00:00" || ev.Data["previous_tc"] != "10:00:02;15" {
+		t.Fatalf("jump event = %+v", ev)
+	}
+
+	infos := s.reg.Snapshot()
+	if len(infos) != 1 || infos[0].Timecode == nil || infos[0].Timecode.Timecode != "01:00:00:00" || infos[0].Timecode.StreamTimestamp != 4000 {
+		t.Fatalf("stats = %+v", infos)
+	}
+}
+
+func TestTimecodeJumped(t *testing.T) {
+	for _, c := range []struct {
+		from, to  string
+		elapsedMs uint32
+		want      bool
+	}{
+		{"10:00:00:00", "10:00:01:00", 1000, false},
+		{"10:00:00:00", "10:00:03:00", 1000, false}, // within tolerance
+		{"10:00:00:00", "10:00:10:00", 1000, true},
+		{"10:00:00:00", "09:59:50:00", 1000, true},
+		{"23:59:59:20", "00:00:00:05", 1000, false}, // midnight
+		{"10:00:00:00", "not a timecode", 1000, false},
+	} {
+		prev := &TimecodeInfo{Timecode: c.from, StreamTimestamp: 5000}
+		if got := timecodeJumped(prev, c.to, 5000+c.elapsedMs); got != c.want {
+			t.Errorf("%s -> %s after %dms: jumped=%v, want %v", c.from, c.to, c.elapsedMs, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package server
+
+// Connection Tracing
+// ==================
+// With Config.Tracer set, each connection is one trace:
+//
+//	rtmp.connection              accept → disconnect
+//	├── tls.handshake            (rtmps only)
+//	├── rtmp.handshake           C0/C1/C2 ↔ S0/S1/S2
+//	├── rtmp.connect             command handling, incl. auth and replies
+//	├── rtmp.createStream
+//	├── rtmp.publish / rtmp.play
+//	└── rtmp.publish.golive      publish accepted → first keyframe fanned out
+//
+// rtmp.publish.golive answers "why did this stream take 3 seconds to go
+// live": its events mark when the sequence headers arrived, so a gap before
+// them points at the encoder and a gap after them at the keyframe interval.
+//
+// Keyframes (and video sequence headers) are traced separately, one trace
+// each, since a span per frame would grow the connection's trace without
+// bound:
+//
+//	rtmp.keyframe                dispatch of one keyframe
+//	├── rtmp.broadcast           fan-out to local players
+//	├── rtmp.record              recorder write (when recording)
+//	└── rtmp.relay.send          one per relay destination: queue → written
+
+import (
+	"errors"
+
+	rtmperrors "github.com/alxayo/go-rtmp/internal/errors"
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/media"
+	"github.com/alxayo/go-rtmp/internal/rtmp/rpc"
+	"github.com/alxayo/go-rtmp/internal/telemetry"
+)
+
+// traceCommand wraps the handler h of a command in a span named "rtmp."+name
+// under the connection's span. The span records the command's stream key or
+// app and, for a refusal, the status code sent back. h is returned as is
+// when the connection is not traced.
+func traceCommand[C any](st *commandState, name string, h func(C, *chunk.Message) error) func(C, *chunk.Message) error {
+	if h == nil || telemetry.SpanFromContext(st.trace) == nil {
+		return h
+	}
+	return func(cmd C, msg *chunk.Message) error {
+		_, span := telemetry.Start(st.trace, "rtmp."+name, telemetry.Int("rtmp.stream_id", int64(msg.MessageStreamID)))
+		err := h(cmd, msg)
+		// Read after h: publish may rename the stream key.
+		switch c := any(cmd).(type) {
+		case *rpc.ConnectCommand:
+			span.SetAttributes(telemetry.String("rtmp.app", c.App))
+		case *rpc.PublishCommand:
+			span.SetAttributes(telemetry.String("rtmp.stream_key", c.StreamKey), telemetry.String("rtmp.publish_type", c.PublishingType))
+		case *rpc.PlayCommand:
+			span.SetAttributes(telemetry.String("rtmp.stream_key", c.StreamKey))
+		}
+		var ce *rtmperrors.CommandError
+		if errors.As(err, &ce) {
+			span.SetAttributes(telemetry.String("rtmp.status_code", ce.Code))
+		}
+		span.RecordError(err)
+		span.End()
+		return err
+	}
+}
+
+// frameKind classifies a video message for tracing.
+type frameKind struct {
+	keyframe  bool // a keyframe, or a sequence header (also flagged as one)
+	seqHeader bool // a video sequence header
+}
+
+func classifyFrame(m *chunk.Message) frameKind {
+	if m.TypeID != 9 || !media.IsVideoKeyframe(m.Payload) {
+		return frameKind{}
+	}
+	return frameKind{keyframe: true, seqHeader: media.IsVideoSequenceHeader(m.Payload)}
+}
+
+// startGoLive opens the rtmp.publish.golive span of a publish just accepted
+// on ss.
+func (st *commandState) startGoLive(ss *streamState) {
+	_, ss.golive = telemetry.Start(st.trace, "rtmp.publish.golive",
+		telemetry.String("rtmp.stream_key", ss.streamKey),
+		telemetry.Int("rtmp.stream_id", int64(ss.id)),
+	)
+}
+
+// observeGoLive notes the sequence headers of a publish that has not gone
+// live yet, and ends its golive span once the first keyframe has been
+// fanned out to players. f describes m.
+func (ss *streamState) observeGoLive(m *chunk.Message, f frameKind, subscribers int) {
+	if ss.golive == nil {
+		return
+	}
+	switch {
+	case m.TypeID == 8 && media.IsAudioSequenceHeader(m.Payload):
+		ss.golive.AddEvent("audio sequence header")
+	case f.seqHeader:
+		ss.golive.AddEvent("video sequence header")
+	case f.keyframe:
+		ss.golive.SetAttributes(telemetry.Int("rtmp.subscribers", int64(subscribers)))
+		ss.golive.End()
+		ss.golive = nil
+	}
+}
+
+// endGoLive ends the golive span of a publish that stopped before its
+// first keyframe.
+func (ss *streamState) endGoLive() {
+	if ss.golive == nil {
+		return
+	}
+	ss.golive.RecordError(errors.New("publish ended before the first keyframe"))
+	ss.golive.End()
+	ss.golive = nil
+}
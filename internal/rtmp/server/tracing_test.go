@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/alxayo/go-rtmp/internal/logger"
+	"github.com/alxayo/go-rtmp/internal/telemetry"
+)
+
+// spanRecorder is a telemetry.Exporter keeping the spans it is sent.
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []telemetry.SpanData
+}
+
+func (r *spanRecorder) Export(_ context.Context, spans []telemetry.SpanData) error {
+	r.mu.Lock()
+	r.spans = append(r.spans, spans...)
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *spanRecorder) byName() map[string][]telemetry.SpanData {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := map[string][]telemetry.SpanData{}
+	for _, s := range r.spans {
+		out[s.Name] = append(out[s.Name], s)
+	}
+	return out
+}
+
+func spanAttr(s telemetry.SpanData, key string) interface{} {
+	for _, a := range s.Attrs {
+		if a.Key == key {
+			return a.Value
+		}
+	}
+	return nil
+}
+
+// TestTracing_PublishLifecycle publishes a stream and checks the
+// connection's trace and the keyframe's fan-out trace.
+func TestTracing_PublishLifecycle(t *testing.T) {
+	logger.UseWriter(io.Discard)
+	rec := &spanRecorder{}
+	tracer := telemetry.NewTracer(rec, telemetry.Options{BatchSize: 1}) // export each span as it ends
+	s := New(Config{ListenAddr: "127.0.0.1:0", Tracer: tracer})
+	if err := s.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer s.Stop()
+
+	pub := connectTo(t, s, "live/traced")
+	if err := pub.Publish(); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	waitFor(t, "publish", func() bool { return hasLivePublisher(s.reg, "live/traced") })
+	_ = pub.SendAudio(0, []byte{0xAF, 0x00, 0x12, 0x10})
+	_ = pub.SendVideo(0, []byte{0x17, 0x00, 0, 0, 0, 0x01, 0x64, 0x00, 0x1f})
+	_ = pub.SendVideo(40, []byte{0x27, 0x01, 0, 0, 0, 0xBB}) // inter frame: not live yet
+	_ = pub.SendVideo(80, []byte{0x17, 0x01, 0, 0, 0, 0xAA})
+	pub.Close()
+	waitFor(t, "connection span", func() bool { return len(rec.byName()["rtmp.connection"]) == 1 })
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	spans := rec.byName()
+	for _, name := range []string{"rtmp.connection", "rtmp.handshake", "rtmp.connect", "rtmp.createStream", "rtmp.publish", "rtmp.publish.golive"} {
+		if len(spans[name]) != 1 {
+			t.Fatalf("%d %s spans, want 1 (got %v)", len(spans[name]), name, spans)
+		}
+	}
+	conn := spans["rtmp.connection"][0]
+	for _, name := range []string{"rtmp.handshake", "rtmp.connect", "rtmp.publish", "rtmp.publish.golive"} {
+		if s := spans[name][0]; s.TraceID != conn.TraceID || s.ParentID != conn.SpanID {
+			t.Fatalf("%s is not a child of the connection span", name)
+		}
+	}
+	if got := spanAttr(spans["rtmp.publish"][0], "rtmp.stream_key"); got != "live/traced" {
+		t.Fatalf("publish span stream key = %v", got)
+	}
+	golive := spans["rtmp.publish.golive"][0]
+	if golive.Err != "" || len(golive.Events) != 2 || golive.Events[0].Name != "audio sequence header" {
+		t.Fatalf("golive span = %+v, want two sequence header events and no error", golive)
+	}
+
+	// The sequence header and the keyframe each get a trace of their own.
+	keyframes := spans["rtmp.keyframe"]
+	if len(keyframes) != 2 || len(spans["rtmp.broadcast"]) != 2 {
+		t.Fatalf("%d keyframe and %d broadcast spans, want 2 each", len(keyframes), len(spans["rtmp.broadcast"]))
+	}
+	if keyframes[0].TraceID == conn.TraceID || keyframes[0].ParentID != ([8]byte{}) {
+		t.Fatal("keyframe span is not the root of its own trace")
+	}
+	if spanAttr(keyframes[0], "rtmp.sequence_header") != true || spanAttr(keyframes[1], "rtmp.sequence_header") != false {
+		t.Fatalf("keyframe spans = %+v", keyframes)
+	}
+}
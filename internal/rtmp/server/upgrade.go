@@ -0,0 +1,185 @@
+package server
+
+// Listener Handoff
+// ----------------
+// A binary upgrade replaces the running process without closing its ports.
+// The old process duplicates its RTMP and RTMPS sockets (ListenerFiles),
+// starts the new binary with them, and then drains: it stops accepting,
+// keeps serving the connections it has until they end, and stops. Clients
+// connecting meanwhile wait in the socket backlog for the new process.
+//
+// The SRT socket is not handed over. UDP datagrams cannot be split between
+// two processes by session, so ReleasePorts closes it (ending the SRT
+// sessions) before the new process starts, and the new process binds the
+// port again. The origin link listener is not handed over either:
+// ReleasePorts closes it, running link sessions go on until the drain ends,
+// and edges reconnect to the new process. RTMP and RTMPS keep accepting
+// until the new process is running; if it cannot be started, ReclaimPorts
+// opens the SRT and link listeners again and the old process serves on.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// drainPollInterval is how often Drain checks whether connections are left.
+const drainPollInterval = 250 * time.Millisecond
+
+// ListenerFiles returns duplicates of the RTMP listening socket and, when
+// RTMPS is enabled, the RTMPS one, in that order. The files stay valid
+// after the server stops; the caller closes them.
+func (s *Server) ListenerFiles() ([]*os.File, error) {
+	s.mu.RLock()
+	lns := []net.Listener{s.l}
+	if s.tlsRaw != nil {
+		lns = append(lns, s.tlsRaw)
+	}
+	s.mu.RUnlock()
+	if lns[0] == nil {
+		return nil, errors.New("server not started")
+	}
+
+	var files []*os.File
+	for _, ln := range lns {
+		fl, ok := ln.(interface{ File() (*os.File, error) })
+		if !ok {
+			closeFiles(files)
+			return nil, fmt.Errorf("listener %s cannot be passed on", ln.Addr())
+		}
+		f, err := fl.File()
+		if err != nil {
+			closeFiles(files)
+			return nil, fmt.Errorf("listener %s: %w", ln.Addr(), err)
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		_ = f.Close()
+	}
+}
+
+// StopAccepting closes the RTMP, RTMPS, SRT and link listeners and leaves
+// the established RTMP connections running. Duplicates taken with
+// ListenerFiles keep the TCP ports open. Calling it again does nothing.
+func (s *Server) StopAccepting() {
+	s.mu.Lock()
+	l, tlsLn, srtLn, linkLn := s.l, s.tlsListener, s.srtListener, s.linkListener
+	if l == nil || s.draining {
+		s.mu.Unlock()
+		return
+	}
+	s.draining = true
+	s.srtListener = nil
+	s.linkListener = nil
+	s.mu.Unlock()
+	_ = l.Close()
+	if linkLn != nil {
+		_ = linkLn.Close()
+	}
+	if tlsLn != nil {
+		_ = tlsLn.Close()
+	}
+	if srtLn != nil {
+		_ = srtLn.Close()
+	}
+	s.log.Info("stopped accepting connections", "active_connections", s.ConnectionCount())
+}
+
+// ReleasePorts closes the SRT and origin link listeners, whose ports a new
+// process binds again, and leaves the RTMP and RTMPS listeners accepting.
+// ReclaimPorts undoes it; StopAccepting closes the rest.
+func (s *Server) ReleasePorts() {
+	s.mu.Lock()
+	srtLn, linkLn := s.srtListener, s.linkListener
+	s.srtListener = nil
+	s.linkListener = nil
+	s.mu.Unlock()
+	if linkLn != nil {
+		_ = linkLn.Close()
+	}
+	if srtLn != nil {
+		_ = srtLn.Close()
+	}
+}
+
+// ReclaimPorts opens the SRT and origin link listeners closed by
+// ReleasePorts again, e.g. after the new process failed to start. As at
+// startup, RTMP keeps running if one of them fails; the error says which.
+func (s *Server) ReclaimPorts() error {
+	s.mu.RLock()
+	stopped := s.l == nil || s.draining || s.closing
+	needSRT := s.cfg.SRTListenAddr != "" && s.srtListener == nil
+	needLink := s.cfg.LinkListenAddr != "" && s.linkListener == nil
+	s.mu.RUnlock()
+	if stopped {
+		return errors.New("server not accepting")
+	}
+	var errs []error
+	if needSRT {
+		if err := s.startSRTListener(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if needLink {
+		if err := s.startLinkListener(); err != nil {
+			errs = append(errs, fmt.Errorf("link listen %s: %w", s.cfg.LinkListenAddr, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Accepting reports whether the server is started and accepting new
+// connections.
+func (s *Server) Accepting() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.l != nil && !s.draining
+}
+
+// Drain stops accepting connections, waits until the established ones have
+// ended and then stops the server. If ctx ends first, the remaining
+// connections are closed by Stop and ctx's error is returned.
+func (s *Server) Drain(ctx context.Context) error {
+	s.StopAccepting()
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	var err error
+	for err == nil && s.ConnectionCount() > 0 {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			s.log.Warn("drain timed out, closing remaining connections", "active_connections", s.ConnectionCount())
+		case <-ticker.C:
+		}
+	}
+	if stopErr := s.Stop(); stopErr != nil {
+		return stopErr
+	}
+	return err
+}
+
+// listenTLS returns the TCP socket for the RTMPS listener: Config.TLSListener
+// when one was passed in, otherwise a new one on Config.TLSListenAddr.
+func (s *Server) listenTLS() (net.Listener, error) {
+	if s.cfg.TLSListener != nil {
+		return s.cfg.TLSListener, nil
+	}
+	ln, err := net.Listen("tcp", s.cfg.TLSListenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("listen %s: %w", s.cfg.TLSListenAddr, err)
+	}
+	return ln, nil
+}
+
+// tlsEnabled reports whether the server runs an RTMPS listener.
+func (c *Config) tlsEnabled() bool {
+	return c.TLSListenAddr != "" || c.TLSListener != nil
+}
@@ -0,0 +1,169 @@
+// upgrade_test.go – tests for the listener handoff used by binary upgrades.
+//
+// The old server passes duplicates of its sockets on (ListenerFiles),
+// stops accepting, and drains: connections it already has keep running
+// while new ones reach whoever serves the duplicate.
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/handshake"
+)
+
+// dialHandshake connects to addr and completes the RTMP handshake.
+func dialHandshake(t *testing.T, addr string) net.Conn {
+	t.Helper()
+	c, err := net.DialTimeout("tcp", addr, 2*time.Second)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	if err := handshake.ClientHandshake(c); err != nil {
+		c.Close()
+		t.Fatalf("client handshake failed: %v", err)
+	}
+	return c
+}
+
+// waitConnections polls until s tracks want connections.
+func waitConnections(t *testing.T, s *Server, want int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for s.ConnectionCount() != want && time.Now().Before(deadline) {
+		time.Sleep(25 * time.Millisecond)
+	}
+	if got := s.ConnectionCount(); got != want {
+		t.Fatalf("expected %d connections, got %d", want, got)
+	}
+}
+
+// TestServerListenerHandoff hands the listening socket to a second server:
+// the first keeps its connection after StopAccepting, the second accepts
+// new clients on the same address, and Drain returns once the first
+// server's last client leaves.
+func TestServerListenerHandoff(t *testing.T) {
+	old := New(Config{ListenAddr: "127.0.0.1:0"})
+	if err := old.Start(); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	defer old.Stop()
+	addr := old.Addr().String()
+	oldClient := dialHandshake(t, addr)
+	defer oldClient.Close()
+	waitConnections(t, old, 1)
+
+	files, err := old.ListenerFiles()
+	if err != nil {
+		t.Fatalf("ListenerFiles: %v", err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("got %d files, want 1 (no RTMPS)", len(files))
+	}
+	ln, err := net.FileListener(files[0])
+	files[0].Close()
+	if err != nil {
+		t.Fatalf("FileListener: %v", err)
+	}
+
+	old.StopAccepting()
+	if old.Accepting() {
+		t.Fatal("Accepting after StopAccepting")
+	}
+	waitConnections(t, old, 1)
+
+	next := New(Config{})
+	if err := next.Serve(ln); err != nil {
+		t.Fatalf("serve failed: %v", err)
+	}
+	defer next.Stop()
+	newClient := dialHandshake(t, addr)
+	defer newClient.Close()
+	waitConnections(t, next, 1)
+	waitConnections(t, old, 1)
+
+	done := make(chan error, 1)
+	go func() { done <- old.Drain(context.Background()) }()
+	select {
+	case err := <-done:
+		t.Fatalf("Drain returned with a connection left: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	oldClient.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Drain: %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Drain did not return after the last client left")
+	}
+}
+
+// TestServerDrainTimeout verifies that Drain closes the connections that
+// are left when its context ends.
+func TestServerDrainTimeout(t *testing.T) {
+	s := New(Config{ListenAddr: "127.0.0.1:0"})
+	if err := s.Start(); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	c := dialHandshake(t, s.Addr().String())
+	defer c.Close()
+	waitConnections(t, s, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := s.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Drain = %v, want deadline exceeded", err)
+	}
+	if n := s.ConnectionCount(); n != 0 {
+		t.Fatalf("expected 0 connections after Drain, got %d", n)
+	}
+}
+
+// TestServerReleaseReclaimPorts releases the SRT and link ports for a new
+// process and takes them back when it does not start; RTMP accepts
+// throughout.
+func TestServerReleaseReclaimPorts(t *testing.T) {
+	s := New(Config{ListenAddr: "127.0.0.1:0", SRTListenAddr: "127.0.0.1:0", LinkListenAddr: "127.0.0.1:0"})
+	if err := s.Start(); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	defer s.Stop()
+	linkAddr := func() net.Addr {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		if s.linkListener == nil {
+			return nil
+		}
+		return s.linkListener.Addr()
+	}
+	if s.SRTAddr() == nil || linkAddr() == nil {
+		t.Fatal("SRT or link listener not started")
+	}
+
+	s.ReleasePorts()
+	if s.SRTAddr() != nil || linkAddr() != nil {
+		t.Fatal("SRT or link listener open after ReleasePorts")
+	}
+	if !s.Accepting() {
+		t.Fatal("not accepting after ReleasePorts")
+	}
+	c := dialHandshake(t, s.Addr().String())
+	c.Close()
+
+	if err := s.ReclaimPorts(); err != nil {
+		t.Fatalf("ReclaimPorts: %v", err)
+	}
+	if s.SRTAddr() == nil || linkAddr() == nil {
+		t.Fatal("SRT or link listener not reopened")
+	}
+
+	s.StopAccepting()
+	if err := s.ReclaimPorts(); err == nil {
+		t.Fatal("ReclaimPorts after StopAccepting succeeded")
+	}
+}
@@ -0,0 +1,98 @@
+package server
+
+// Multi-bitrate Variant Grouping
+// ------------------------------
+// Encoders that produce an adaptive-bitrate ladder usually publish each
+// rendition under its own stream key, e.g. "live/show_1080p", "live/show_720p"
+// and "live/show_480p". When a variant separator is configured, the registry
+// recognizes the trailing "<sep><label>" and records each stream as a variant
+// of the logical stream "live/show".
+//
+// A suffix is only treated as a variant label when it starts with a digit
+// (1080p, 720, 2500k, 480p30). This keeps ordinary names that happen to
+// contain the separator ("live/my_show") ungrouped.
+//
+// Grouping is informational: each variant remains an independent stream for
+// publish/play, recording and relay. The grouping is exposed through
+// StreamInfo and the rtmp_stream_groups metrics endpoint so packagers can
+// build a master playlist from it.
+
+import (
+	"sort"
+	"strings"
+)
+
+// StreamGroupInfo describes one logical stream and its published variants.
+type StreamGroupInfo struct {
+	Group    string   `json:"group"`
+	Variants []string `json:"variants"` // labels, sorted
+	Keys     []string `json:"keys"`     // full stream keys, same order as Variants
+}
+
+// ParseVariantKey splits key into its logical group and variant label using
+// sep. ok is false (and group/variant are empty) when sep is empty or the key
+// does not follow the naming convention.
+func ParseVariantKey(key, sep string) (group, variant string, ok bool) {
+	if sep == "" {
+		return "", "", false
+	}
+	slash := strings.LastIndex(key, "/")
+	i := strings.LastIndex(key, sep)
+	if i <= slash+1 { // separator missing or stream name would be empty
+		return "", "", false
+	}
+	label := key[i+len(sep):]
+	if label == "" || label[0] < '0' || label[0] > '9' || strings.Contains(label, "/") {
+		return "", "", false
+	}
+	return key[:i], label, true
+}
+
+// SetVariantSeparator enables variant grouping for streams created after the
+// call. An empty separator disables grouping.
+func (r *Registry) SetVariantSeparator(sep string) {
+	r.mu.Lock()
+	r.variantSep = sep
+	r.mu.Unlock()
+}
+
+// Variants returns the streams registered as variants of group, sorted by
+// stream key.
+func (r *Registry) Variants(group string) []*Stream {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var out []*Stream
+	for _, s := range r.streams {
+		if s.Group != "" && s.Group == group {
+			out = append(out, s)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+// GroupSnapshot returns every logical stream that has at least one variant.
+// Safe for concurrent use.
+func (r *Registry) GroupSnapshot() []StreamGroupInfo {
+	r.mu.RLock()
+	byGroup := make(map[string][]*Stream)
+	for _, s := range r.streams {
+		if s.Group != "" {
+			byGroup[s.Group] = append(byGroup[s.Group], s)
+		}
+	}
+	r.mu.RUnlock()
+
+	groups := make([]StreamGroupInfo, 0, len(byGroup))
+	for g, streams := range byGroup {
+		sort.Slice(streams, func(i, j int) bool { return streams[i].Variant < streams[j].Variant })
+		info := StreamGroupInfo{Group: g}
+		for _, s := range streams {
+			info.Variants = append(info.Variants, s.Variant)
+			info.Keys = append(info.Keys, s.Key)
+		}
+		groups = append(groups, info)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Group < groups[j].Group })
+	return groups
+}
@@ -0,0 +1,56 @@
+// variants_test.go – tests for multi-bitrate variant grouping.
+//
+// With a separator configured, keys such as "live/show_720p" are registered
+// as variant "720p" of group "live/show". Suffixes that do not start with a
+// digit are left ungrouped.
+package server
+
+import "testing"
+
+// TestParseVariantKey covers grouped, ungrouped and disabled cases.
+func TestParseVariantKey(t *testing.T) {
+	cases := []struct {
+		key, sep, group, variant string
+		ok                       bool
+	}{
+		{"live/show_720p", "_", "live/show", "720p", true},
+		{"live/my_show_1080", "_", "live/my_show", "1080", true},
+		{"live/my_show", "_", "", "", false},
+		{"live/_720p", "_", "", "", false},
+		{"live/show_720p", "", "", "", false},
+		{"live/show-480p", "-", "live/show", "480p", true},
+	}
+	for _, c := range cases {
+		g, v, ok := ParseVariantKey(c.key, c.sep)
+		if g != c.group || v != c.variant || ok != c.ok {
+			t.Errorf("ParseVariantKey(%q, %q) = (%q, %q, %v), want (%q, %q, %v)",
+				c.key, c.sep, g, v, ok, c.group, c.variant, c.ok)
+		}
+	}
+}
+
+// TestRegistryGroupSnapshot verifies variants are grouped and sorted, and
+// that the grouping appears in the per-stream snapshot.
+func TestRegistryGroupSnapshot(t *testing.T) {
+	r := NewRegistry()
+	r.SetVariantSeparator("_")
+	r.CreateStream("live/show_720p")
+	r.CreateStream("live/show_480p")
+	r.CreateStream("live/other")
+
+	groups := r.GroupSnapshot()
+	if len(groups) != 1 || groups[0].Group != "live/show" {
+		t.Fatalf("unexpected groups: %+v", groups)
+	}
+	if got := groups[0].Variants; len(got) != 2 || got[0] != "480p" || got[1] != "720p" {
+		t.Fatalf("unexpected variants: %v", got)
+	}
+	if vs := r.Variants("live/show"); len(vs) != 2 || vs[0].Key != "live/show_480p" {
+		t.Fatalf("unexpected Variants(): %d", len(vs))
+	}
+	for _, info := range r.Snapshot() {
+		if info.Key == "live/show_720p" && (info.Group != "live/show" || info.Variant != "720p") {
+			t.Fatalf("snapshot missing grouping: %+v", info)
+		}
+	}
+}
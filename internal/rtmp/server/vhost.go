@@ -0,0 +1,250 @@
+package server
+
+// Virtual Hosts
+// -------------
+// Config.VHosts runs independent tenants on one server, told apart by the
+// host clients name in the connect command's tcUrl:
+//
+//	rtmp://customer1.example.com/live/show   vhost customer1.example.com
+//	rtmp://customer2.example.com/live/show   vhost customer2.example.com
+//
+// Each vhost has its own stream registry, so the two live/show streams
+// above are unrelated, and its own authentication, recording settings and
+// directory, relay destinations and app settings. The connect handler
+// resolves the vhost and the connection's publish, play and media handlers
+// use it from then on. Clients naming any other host (or an IP address)
+// get the server-wide configuration, the default host.
+//
+// Everything else is shared: listeners, limits, timeouts, hooks (events of
+// a vhost carry its name as "vhost") and the stream stats (entries carry
+// "vhost"). Features tied to the server's own streams serve the default
+// host only: SRT ingest, stream aliases and redundant ingest, edge and
+// cluster pulls, transcoding, interceptors and the recording admin API.
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/logger"
+	"github.com/alxayo/go-rtmp/internal/rtmp/relay"
+	"github.com/alxayo/go-rtmp/internal/rtmp/server/auth"
+	"github.com/alxayo/go-rtmp/internal/rtmp/server/hooks"
+)
+
+// VHostConfig is the configuration of one virtual host. Unlike an app
+// block it does not fall back to the server-wide settings it covers: a
+// vhost with no AuthValidator authenticates nothing, and the server's
+// relays and app settings do not apply to it.
+type VHostConfig struct {
+	// AuthValidator checks the vhost's publish and play requests. Nil
+	// allows all.
+	AuthValidator auth.Validator
+
+	// PlayAuthValidator, when set, checks the vhost's play requests in
+	// place of AuthValidator.
+	PlayAuthValidator auth.Validator
+
+	// RecordAll and RecordStreams select the vhost's recorded streams, as
+	// Config.RecordAll and Config.RecordStreams do.
+	RecordAll     bool
+	RecordStreams []string
+
+	// RecordDir holds the vhost's recordings and the files it plays as
+	// VOD. Default: the host name under Config.RecordDir.
+	RecordDir string
+
+	// RelayDestinations are forwarded every stream published to the vhost.
+	RelayDestinations []string
+
+	// Apps holds the vhost's per-application settings (app_config.go).
+	Apps map[string]AppConfig
+}
+
+// ParseVHostConfig parses a virtual host block of the form
+// "host=setting=value,setting=value,...". Settings are record=on|off,
+// record-dir=PATH, relay=URL (repeatable), one of auth-file=PATH (a
+// JSON token file, read here), auth-secret=SECRET (signed URLs) or
+// auth-callback=URL, and for players one of play-auth-file,
+// play-auth-secret, play-auth-callback or play-auth-viewers=PATH (a viewer
+// token file).
+func ParseVHostConfig(s string) (host string, vc VHostConfig, err error) {
+	host, list, ok := strings.Cut(s, "=")
+	host = strings.ToLower(strings.TrimSpace(host))
+	if !ok || host == "" || strings.ContainsAny(host, "/:") {
+		return "", vc, fmt.Errorf("vhost %q: expected host=setting=value[,setting=value...]", s)
+	}
+	for _, kv := range strings.Split(list, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(kv), "=")
+		if err := vc.set(name, value); err != nil {
+			return "", VHostConfig{}, fmt.Errorf("vhost %q: %w", s, err)
+		}
+	}
+	return host, vc, nil
+}
+
+// set applies one setting of a virtual host block.
+func (vc *VHostConfig) set(name, value string) error {
+	if strings.HasPrefix(name, "auth-") && vc.AuthValidator != nil {
+		return fmt.Errorf("only one of auth-file, auth-secret and auth-callback may be set")
+	}
+	if strings.HasPrefix(name, "play-auth-") && vc.PlayAuthValidator != nil {
+		return fmt.Errorf("only one of play-auth-file, play-auth-secret, play-auth-callback and play-auth-viewers may be set")
+	}
+	switch name {
+	case "record":
+		if value != "on" && value != "off" {
+			return fmt.Errorf("record must be on or off, got %q", value)
+		}
+		vc.RecordAll = value == "on"
+	case "record-dir":
+		if value == "" {
+			return fmt.Errorf("record-dir needs a path")
+		}
+		vc.RecordDir = value
+	case "relay":
+		if !strings.HasPrefix(value, "rtmp://") && !strings.HasPrefix(value, "rtmps://") {
+			return fmt.Errorf("relay must be an rtmp:// or rtmps:// URL, got %q", value)
+		}
+		vc.RelayDestinations = append(vc.RelayDestinations, value)
+	case "auth-file", "auth-secret", "auth-callback":
+		v, err := vhostValidator(name, value)
+		if err != nil {
+			return err
+		}
+		vc.AuthValidator = v
+	case "play-auth-file", "play-auth-secret", "play-auth-callback", "play-auth-viewers":
+		v, err := vhostValidator(name, value)
+		if err != nil {
+			return err
+		}
+		vc.PlayAuthValidator = v
+	default:
+		return fmt.Errorf("unknown setting %q", name)
+	}
+	return nil
+}
+
+// vhostValidator builds the validator of an auth setting: name is
+// [play-]auth-file, auth-secret, auth-callback or play-auth-viewers.
+func vhostValidator(name, value string) (auth.Validator, error) {
+	switch strings.TrimPrefix(name, "play-") {
+	case "auth-file":
+		return auth.NewFileValidator(value)
+	case "auth-secret":
+		if value == "" {
+			return nil, fmt.Errorf("%s needs a secret", name)
+		}
+		return &auth.SignedURLValidator{Secret: value}, nil
+	case "auth-callback":
+		if !strings.HasPrefix(value, "http://") && !strings.HasPrefix(value, "https://") {
+			return nil, fmt.Errorf("%s must be an http:// or https:// URL, got %q", name, value)
+		}
+		return auth.NewCallbackValidator(value, 5*time.Second), nil
+	default: // auth-viewers
+		return auth.LoadViewerTokens(value)
+	}
+}
+
+// vhost is a running virtual host.
+type vhost struct {
+	name          string
+	cfg           Config // the server's configuration with the vhost's settings applied
+	reg           *Registry
+	destMgr       *relay.DestinationManager // nil without relay destinations
+	recordStreams []*hooks.StreamMatcher    // compiled cfg.RecordStreams
+}
+
+// newVHost builds the vhost name from the server configuration cfg.
+func newVHost(name string, vc VHostConfig, cfg Config) *vhost {
+	cfg.AuthValidator = vc.AuthValidator
+	cfg.PlayAuthValidator = vc.PlayAuthValidator
+	cfg.RecordAll = vc.RecordAll
+	cfg.RecordStreams = vc.RecordStreams
+	if vc.RecordDir != "" {
+		cfg.RecordDir = vc.RecordDir
+	} else {
+		cfg.RecordDir = filepath.Join(cfg.RecordDir, name)
+	}
+	cfg.RelayDestinations = vc.RelayDestinations
+	cfg.Apps = vc.Apps
+	// Default-host features (see the overview).
+	cfg.StreamAliases = nil
+	cfg.RedundantIngest = false
+	cfg.OriginURL = ""
+	cfg.ClusterRedisURL = ""
+	cfg.TranscodeCommand = ""
+	cfg.VHosts = nil
+
+	vh := &vhost{name: name, cfg: cfg, reg: newRegistry(cfg)}
+	vh.reg.vhost = name
+	vh.destMgr = newDestinationManager(cfg)
+	for _, pattern := range cfg.RecordStreams {
+		m, err := hooks.NewStreamMatcher(pattern)
+		if err != nil {
+			logger.Logger().Error("Invalid record stream pattern", "vhost", name, "error", err)
+			continue
+		}
+		vh.recordStreams = append(vh.recordStreams, m)
+	}
+	return vh
+}
+
+// recordsStream reports whether the vhost's configuration records
+// streamKey.
+func (vh *vhost) recordsStream(streamKey string) bool {
+	return vh.cfg.RecordAll || hooks.MatchAny(vh.recordStreams, streamKey)
+}
+
+// hookData adds the vhost's name to the data of a hook event. A nil vhost
+// (the default host) leaves data as is.
+func (vh *vhost) hookData(data map[string]interface{}) map[string]interface{} {
+	if vh == nil {
+		return data
+	}
+	return vhostHookData(vh.name, data)
+}
+
+// vhostHookData adds the virtual host name to the data of a hook event,
+// unless name is empty (the default host).
+func vhostHookData(name string, data map[string]interface{}) map[string]interface{} {
+	if name != "" {
+		data["vhost"] = name
+	}
+	return data
+}
+
+// vhostFor returns the vhost a connect command's tcUrl names, or nil for
+// the default host.
+func (s *Server) vhostFor(tcURL string) *vhost {
+	if len(s.vhosts) == 0 {
+		return nil
+	}
+	u, err := url.Parse(tcURL)
+	if err != nil {
+		return nil
+	}
+	return s.vhosts[strings.ToLower(u.Hostname())]
+}
+
+// registries returns the registries of the default host and every vhost.
+func (s *Server) registries() []*Registry {
+	regs := []*Registry{s.reg}
+	for _, vh := range s.sortedVHosts() {
+		regs = append(regs, vh.reg)
+	}
+	return regs
+}
+
+// sortedVHosts returns the vhosts ordered by name.
+func (s *Server) sortedVHosts() []*vhost {
+	out := make([]*vhost, 0, len(s.vhosts))
+	for _, vh := range s.vhosts {
+		out = append(out, vh)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].name < out[j].name })
+	return out
+}
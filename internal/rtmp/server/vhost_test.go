@@ -0,0 +1,137 @@
+// vhost_test.go – tests for virtual hosts: parsing of vhost blocks and the
+// separation of streams, authentication and hook events between hosts.
+package server
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/logger"
+	"github.com/alxayo/go-rtmp/internal/rtmp/client"
+	"github.com/alxayo/go-rtmp/internal/rtmp/server/auth"
+	"github.com/alxayo/go-rtmp/internal/rtmp/server/hooks"
+)
+
+func TestParseVHostConfig(t *testing.T) {
+	host, vc, err := ParseVHostConfig("Customer1.Example.com=record=on,record-dir=/srv/c1,relay=rtmp://cdn/live/{stream},relay=rtmps://backup/live/x,auth-secret=s3cret,play-auth-secret=v13w")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if host != "customer1.example.com" || !vc.RecordAll || vc.RecordDir != "/srv/c1" || len(vc.RelayDestinations) != 2 {
+		t.Fatalf("got %q %+v", host, vc)
+	}
+	if v, ok := vc.AuthValidator.(*auth.SignedURLValidator); !ok || v.Secret != "s3cret" {
+		t.Fatalf("auth = %#v", vc.AuthValidator)
+	}
+	if v, ok := vc.PlayAuthValidator.(*auth.SignedURLValidator); !ok || v.Secret != "v13w" {
+		t.Fatalf("play auth = %#v", vc.PlayAuthValidator)
+	}
+	for _, bad := range []string{
+		"customer1.example.com",
+		"=record=on",
+		"example.com:1935=record=on",
+		"example.com=record=yes",
+		"example.com=record-dir=",
+		"example.com=relay=http://cdn/live",
+		"example.com=auth-secret=a,auth-callback=http://auth/check",
+		"example.com=auth-file=" + filepath.Join(t.TempDir(), "missing.json"),
+		"example.com=auth-callback=auth/check",
+		"example.com=play-auth-secret=a,play-auth-viewers=viewers.json",
+		"example.com=play-auth-viewers=" + filepath.Join(t.TempDir(), "missing.json"),
+		"example.com=max-publishers=3",
+	} {
+		if _, _, err := ParseVHostConfig(bad); err == nil {
+			t.Errorf("ParseVHostConfig(%q) succeeded", bad)
+		}
+	}
+}
+
+// TestVirtualHosts publishes the same stream key to the default host
+// (tcUrl 127.0.0.1) and to the "localhost" vhost: each lands in its own
+// registry, the vhost applies its own authentication and its hook events
+// carry its name.
+func TestVirtualHosts(t *testing.T) {
+	logger.UseWriter(io.Discard)
+	s := New(Config{
+		ListenAddr: "127.0.0.1:0",
+		VHosts: map[string]VHostConfig{
+			"localhost": {AuthValidator: &auth.TokenValidator{Tokens: map[string]string{"live/show": "t1"}}},
+		},
+	})
+	events := make(chan hooks.Event, 8)
+	defer s.OnEvent(hooks.EventPublishStart, func(e hooks.Event) error {
+		events <- e
+		return nil
+	})()
+	if err := s.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer s.Stop()
+	_, port, _ := net.SplitHostPort(s.Addr().String())
+	vhostURL := func(key string) string { return fmt.Sprintf("rtmp://localhost:%s/%s", port, key) }
+
+	publish := func(url, want string) {
+		t.Helper()
+		c, err := client.New(url)
+		if err != nil {
+			t.Fatalf("client.New: %v", err)
+		}
+		if err := c.Connect(); err != nil {
+			t.Fatalf("connect %s: %v", url, err)
+		}
+		t.Cleanup(func() { c.Close() })
+		if err := c.Publish(); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+		watchMessages(c).waitStatus(t, want)
+	}
+
+	publish(vhostURL("live/show"), "NetStream.Publish.Unauthorized")
+	publish(vhostURL("live/show?token=t1"), "NetStream.Publish.Start")
+	publish(fmt.Sprintf("rtmp://%s/live/show", s.Addr()), "NetStream.Publish.Start")
+
+	vh := s.vhosts["localhost"]
+	waitFor(t, "both publishers live", func() bool {
+		return hasLivePublisher(vh.reg, "live/show") && hasLivePublisher(s.reg, "live/show")
+	})
+	if vh.reg.GetStream("live/show") == s.reg.GetStream("live/show") {
+		t.Fatal("vhost and default host share a stream")
+	}
+
+	hosts := map[string]bool{}
+	for range 2 {
+		select {
+		case e := <-events:
+			vhost, _ := e.Data["vhost"].(string)
+			hosts[vhost] = true
+		case <-time.After(2 * time.Second):
+			t.Fatal("publish_start not fired")
+		}
+	}
+	if !hosts["localhost"] || !hosts[""] {
+		t.Fatalf("publish_start vhosts = %v, want localhost and the default host", hosts)
+	}
+
+	infos := s.vhosts["localhost"].reg.Snapshot()
+	if len(infos) != 1 || infos[0].VHost != "localhost" {
+		t.Fatalf("vhost snapshot = %+v", infos)
+	}
+}
+
+func TestNewVHostRecordDir(t *testing.T) {
+	cfg := Config{RecordDir: "recordings", StreamAliases: []StreamAlias{{Key: "live/a", Sources: []string{"live/b"}}}}
+	vh := newVHost("example.com", VHostConfig{RecordStreams: []string{"live/*"}}, cfg)
+	if vh.cfg.RecordDir != filepath.Join("recordings", "example.com") || vh.cfg.StreamAliases != nil {
+		t.Fatalf("vhost config = %+v", vh.cfg)
+	}
+	if !vh.recordsStream("live/show") || vh.recordsStream("studio/show") {
+		t.Fatal("recordsStream does not follow the vhost's RecordStreams")
+	}
+	if vh = newVHost("example.com", VHostConfig{RecordDir: "/srv/example"}, cfg); vh.cfg.RecordDir != "/srv/example" {
+		t.Fatalf("RecordDir = %q", vh.cfg.RecordDir)
+	}
+}
@@ -0,0 +1,416 @@
+package server
+
+// VOD Playback
+// ------------
+// When VOD is enabled and a play request targets a stream key with no live
+// publisher, the server looks for a matching FLV recording in RecordDir and
+// streams it to the subscriber at real-time pace. This turns the recordings
+// directory into a basic video-on-demand library.
+//
+// Only FLV recordings are served (H.264 streams); MP4 recordings are skipped
+// because they are finalized with the moov atom at the end of the file and
+// would require a full container demuxer.
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/conn"
+	"github.com/alxayo/go-rtmp/internal/rtmp/control"
+	"github.com/alxayo/go-rtmp/internal/rtmp/media"
+)
+
+// findRecording returns the path of the most recently modified FLV recording
+// for streamKey in recordDir, or "" if none exists. A recording of the stream
+// is named by ensureRecorder or the default segment pattern: the stream key
+// with "/" replaced by "_", then "_<YYYYMMDD_HHMMSS>", an optional
+// "_seg<N>" and ".flv" (see isRecordingOf).
+//
+// Matching compares directory entry names rather than using filepath.Glob so
+// that glob metacharacters in client-supplied stream keys cannot match other
+// streams' recordings.
+func findRecording(recordDir, streamKey string) string {
+	if recordDir == "" || streamKey == "" {
+		return ""
+	}
+	entries, err := os.ReadDir(recordDir)
+	if err != nil {
+		return ""
+	}
+	safeKey := strings.ReplaceAll(streamKey, "/", "_")
+	var (
+		best    string
+		bestMod time.Time
+	)
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !isRecordingOf(name, safeKey) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		if best == "" || info.ModTime().After(bestMod) {
+			best = filepath.Join(recordDir, name)
+			bestMod = info.ModTime()
+		}
+	}
+	return best
+}
+
+// isRecordingOf reports whether name is "<safeKey>_<YYYYMMDD_HHMMSS>.flv"
+// or "<safeKey>_<YYYYMMDD_HHMMSS>_seg<N>.flv". Anchoring on the timestamp
+// keeps the recordings of "live/show_720p" from matching "live/show".
+func isRecordingOf(name, safeKey string) bool {
+	rest, ok := strings.CutPrefix(name, safeKey+"_")
+	if !ok {
+		return false
+	}
+	rest, ok = strings.CutSuffix(rest, ".flv")
+	if !ok || len(rest) < 15 || !isDigits(rest[:8]) || rest[8] != '_' || !isDigits(rest[9:15]) {
+		return false
+	}
+	if rest = rest[15:]; rest == "" {
+		return true
+	}
+	seg, ok := strings.CutPrefix(rest, "_seg")
+	return ok && seg != "" && isDigits(seg)
+}
+
+// isDigits reports whether s consists of ASCII digits only.
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// recordingDuration returns the duration in seconds stored in the
+// onMetaData tag of the FLV recording at path, or 0 if there is none.
+func recordingDuration(path string) float64 {
+	if path == "" {
+		return 0
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	fr, err := media.NewFLVReader(f)
+	if err != nil {
+		return 0
+	}
+	tag, err := fr.ReadTag()
+	if err != nil || tag.Type != media.FLVTagScript {
+		return 0
+	}
+	props, _ := media.ParseOnMetaData(tag.Data)
+	duration, _ := props["duration"].(float64)
+	return duration
+}
+
+// vodStartOffset interprets the play command's start argument. Clients send
+// it in milliseconds on the wire (ffmpeg sends -2000 for "live or recorded",
+// -1000 for "live only"). Returns ok=false when the client asked for a live
+// stream only, in which case no recording should be served.
+func vodStartOffset(start int64) (offsetMs uint32, ok bool) {
+	switch {
+	case start == -1 || start == -1000: // live only
+		return 0, false
+	case start < 0: // -2 / -2000: live, falling back to recorded
+		return 0, true
+	default:
+		return uint32(start), true
+	}
+}
+
+// vodSession streams one FLV file to one subscriber connection.
+type vodSession struct {
+	path     string
+	conn     sender
+	streamID uint32  // message stream ID the subscriber issued play on
+	startMs  uint32  // seek offset requested by the client
+	playTxn  float64 // transaction ID of the Play.Start reply (Config.StatusTxnMode)
+	log      *slog.Logger
+
+	// Playback control set by the pause/seek command handlers and consumed
+	// by the pacing goroutine. wake is signalled after every change so a
+	// goroutine sleeping between tags reacts immediately.
+	mu     sync.Mutex
+	paused bool
+	seekMs int64 // pending seek target in ms, -1 when none
+	wake   chan struct{}
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// newVODSession creates an unstarted session for the recording at path.
+func newVODSession(path string, conn sender, streamID, startMs uint32, log *slog.Logger) *vodSession {
+	return &vodSession{
+		path:     path,
+		conn:     conn,
+		streamID: streamID,
+		startMs:  startMs,
+		log:      log.With("vod_file", filepath.Base(path)),
+		seekMs:   -1,
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start sends the play preamble (StreamIsRecorded + StreamBegin +
+// NetStream.Play.Start) and launches the pacing goroutine. Some players
+// only treat the stream as seekable once told it is recorded.
+func (v *vodSession) Start(streamKey string) error {
+	f, err := os.Open(v.path)
+	if err != nil {
+		return fmt.Errorf("vod.open: %w", err)
+	}
+	fr, err := media.NewFLVReader(f)
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("vod.open: %w", err)
+	}
+
+	_ = v.conn.SendMessage(control.EncodeUserControlStreamIsRecorded(v.streamID))
+	_ = v.conn.SendMessage(control.EncodeUserControlStreamBegin(v.streamID))
+	started, err := buildOnStatusTxn(v.streamID, v.playTxn, streamKey, "NetStream.Play.Start", fmt.Sprintf("Started playing %s.", streamKey))
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	_ = v.conn.SendMessage(started)
+
+	go func() {
+		defer close(v.done)
+		defer f.Close()
+		v.run(f, fr, streamKey)
+	}()
+	return nil
+}
+
+// Stop ends playback and waits for the pacing goroutine to exit. Safe to
+// call multiple times and from any goroutine.
+func (v *vodSession) Stop() {
+	if v == nil {
+		return
+	}
+	v.stopOnce.Do(func() { close(v.stop) })
+	<-v.done
+}
+
+// Pause suspends (true) or resumes (false) delivery. The goroutine sends
+// NetStream.Pause.Notify / NetStream.Unpause.Notify once it has acted on
+// the change, so no media follows a pause notification.
+func (v *vodSession) Pause(paused bool) {
+	v.mu.Lock()
+	v.paused = paused
+	v.mu.Unlock()
+	v.signal()
+}
+
+// Seek repositions playback to ms. Delivery resumes at the first keyframe
+// at or after the target, preceded by NetStream.Seek.Notify and
+// NetStream.Play.Start.
+func (v *vodSession) Seek(ms uint32) {
+	v.mu.Lock()
+	v.seekMs = int64(ms)
+	v.mu.Unlock()
+	v.signal()
+}
+
+// Finished reports whether the pacing goroutine has exited (end of file,
+// read error, or Stop).
+func (v *vodSession) Finished() bool {
+	select {
+	case <-v.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// signal wakes the pacing goroutine without blocking.
+func (v *vodSession) signal() {
+	select {
+	case v.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run reads tags and delivers them at real-time pace. Tags before the seek
+// offset are skipped, except sequence headers and script data which players
+// need to initialize decoders. When video is present, delivery resumes at
+// the first keyframe at or after the offset so decoding starts cleanly.
+//
+// Pause and seek requests are checked before each tag. While paused nothing
+// is read from the file; on resume the pacing clock is re-based so the
+// player does not receive a burst of "late" tags.
+func (v *vodSession) run(f io.ReadSeeker, fr *media.FLVReader, streamKey string) {
+	var (
+		targetMs  = v.startMs
+		seeking   = v.startMs > 0
+		baseTs    uint32
+		baseWall  time.Time
+		haveBase  bool
+		sentCount int
+		pending   *media.FLVTag // tag read but not yet sent (interrupted wait)
+		wasPaused bool
+	)
+	stopped := func() {
+		v.log.Info("VOD playback stopped", "stream_key", streamKey, "tags_sent", sentCount)
+	}
+	for {
+		select {
+		case <-v.stop:
+			stopped()
+			return
+		default:
+		}
+
+		v.mu.Lock()
+		paused, seekTo := v.paused, v.seekMs
+		v.seekMs = -1
+		v.mu.Unlock()
+
+		if seekTo >= 0 {
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				v.log.Warn("VOD seek failed", "stream_key", streamKey, "error", err)
+				break
+			}
+			nfr, err := media.NewFLVReader(f)
+			if err != nil {
+				v.log.Warn("VOD seek failed", "stream_key", streamKey, "error", err)
+				break
+			}
+			fr, pending, haveBase = nfr, nil, false
+			targetMs, seeking = uint32(seekTo), seekTo > 0
+			v.notify(streamKey, "NetStream.Seek.Notify", fmt.Sprintf("Seeking %d (stream ID: %d).", seekTo, v.streamID))
+			_ = v.conn.SendMessage(control.EncodeUserControlStreamBegin(v.streamID))
+			v.notify(streamKey, "NetStream.Play.Start", fmt.Sprintf("Started playing %s.", streamKey))
+			v.log.Info("VOD seek", "stream_key", streamKey, "target_ms", seekTo)
+		}
+
+		if paused != wasPaused {
+			wasPaused = paused
+			if paused {
+				v.notify(streamKey, "NetStream.Pause.Notify", fmt.Sprintf("Pausing %s.", streamKey))
+			} else {
+				haveBase = false // re-base pacing on the next tag
+				_ = v.conn.SendMessage(control.EncodeUserControlStreamBegin(v.streamID))
+				v.notify(streamKey, "NetStream.Unpause.Notify", fmt.Sprintf("Unpausing %s.", streamKey))
+			}
+		}
+		if paused {
+			select {
+			case <-v.stop:
+				stopped()
+				return
+			case <-v.wake:
+			}
+			continue
+		}
+
+		tag := pending
+		pending = nil
+		if tag == nil {
+			var err error
+			tag, err = fr.ReadTag()
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					v.log.Warn("VOD read error", "stream_key", streamKey, "error", err)
+				}
+				break
+			}
+		}
+
+		if seeking {
+			if tag.Type == media.FLVTagScript && (media.IsCuePoint(tag.Data) || media.IsFrameInfo(tag.Data)) {
+				continue // cues and timecodes before the seek point are past
+			}
+			if tag.Type == media.FLVTagScript || tag.IsSequenceHeader() {
+				v.send(tag, 0)
+				continue
+			}
+			if tag.Timestamp < targetMs {
+				continue
+			}
+			if fr.HasVideo && tag.Type == media.FLVTagVideo && !tag.IsKeyframe() {
+				continue
+			}
+			if fr.HasVideo && tag.Type == media.FLVTagAudio {
+				continue // wait for the keyframe so audio and video start together
+			}
+			seeking = false
+		}
+
+		if !haveBase {
+			baseTs, baseWall, haveBase = tag.Timestamp, time.Now(), true
+		}
+		if tag.Timestamp > baseTs {
+			due := baseWall.Add(time.Duration(tag.Timestamp-baseTs) * time.Millisecond)
+			if wait := time.Until(due); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-v.stop:
+					timer.Stop()
+					stopped()
+					return
+				case <-v.wake:
+					// Pause or seek arrived mid-wait: hold the tag and re-check.
+					timer.Stop()
+					pending = tag
+					continue
+				case <-timer.C:
+				}
+			}
+		}
+		v.send(tag, tag.Timestamp)
+		sentCount++
+	}
+
+	// End of file: tell the player the stream is complete.
+	v.notify(streamKey, "NetStream.Play.Stop", fmt.Sprintf("Stopped playing %s.", streamKey))
+	_ = v.conn.SendMessage(control.EncodeUserControlStreamEOF(v.streamID))
+	v.log.Info("VOD playback complete", "stream_key", streamKey, "tags_sent", sentCount)
+}
+
+// notify sends an onStatus message on the subscriber's stream.
+func (v *vodSession) notify(streamKey, code, desc string) {
+	if m, err := buildOnStatus(v.streamID, streamKey, code, desc); err == nil {
+		_ = v.conn.SendMessage(m)
+	}
+}
+
+// send converts an FLV tag to an RTMP message on the subscriber's stream.
+func (v *vodSession) send(tag *media.FLVTag, ts uint32) {
+	csid := uint32(conn.CSIDData)
+	switch tag.Type {
+	case media.FLVTagAudio:
+		csid = conn.CSIDAudio
+	case media.FLVTagVideo:
+		csid = conn.CSIDVideo
+	}
+	_ = v.conn.SendMessage(&chunk.Message{
+		CSID:            csid,
+		TypeID:          tag.Type,
+		Timestamp:       ts,
+		MessageStreamID: v.streamID,
+		MessageLength:   uint32(len(tag.Data)),
+		Payload:         tag.Data,
+	})
+}
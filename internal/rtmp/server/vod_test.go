@@ -0,0 +1,207 @@
+// vod_test.go – tests for recorded-file (VOD) playback.
+//
+// Covers recording lookup by stream key, interpretation of the play start
+// argument, and a short end-to-end session that streams a tiny FLV file to
+// a capturing connection.
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/media"
+)
+
+// writeTestRecording records a few tags to dir/name and returns the path.
+func writeTestRecording(t *testing.T, dir, name string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	rec, err := media.NewFLVRecorder(path, media.NullLogger(), media.FLVMetadata{})
+	if err != nil {
+		t.Fatalf("recorder: %v", err)
+	}
+	rec.WriteMessage(&chunk.Message{TypeID: 9, Timestamp: 0, Payload: []byte{0x17, 0x00, 0x00, 0x00, 0x00}})
+	rec.WriteMessage(&chunk.Message{TypeID: 9, Timestamp: 0, Payload: []byte{0x17, 0x01, 0x00, 0x00, 0x00}})
+	rec.WriteMessage(&chunk.Message{TypeID: 9, Timestamp: 20, Payload: []byte{0x27, 0x01, 0x00, 0x00, 0x00}})
+	rec.WriteMessage(&chunk.Message{TypeID: 9, Timestamp: 40, Payload: []byte{0x17, 0x01, 0x00, 0x00, 0x00}})
+	if err := rec.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	return path
+}
+
+// TestFindRecording picks the newest matching file and ignores other keys.
+func TestFindRecording(t *testing.T) {
+	dir := t.TempDir()
+	older := writeTestRecording(t, dir, "live_show_20250101_000000.flv")
+	newer := writeTestRecording(t, dir, "live_show_20250102_000000.flv")
+	writeTestRecording(t, dir, "live_showcase_20250103_000000.flv")
+	past := time.Now().Add(-time.Hour)
+	_ = os.Chtimes(older, past, past)
+
+	if got := findRecording(dir, "live/show"); got != newer {
+		t.Fatalf("findRecording = %q, want %q", got, newer)
+	}
+	if got := findRecording(dir, "live/missing"); got != "" {
+		t.Fatalf("expected no recording, got %q", got)
+	}
+	if got := findRecording(dir, "live/*"); got != "" {
+		t.Fatalf("glob characters must not match, got %q", got)
+	}
+}
+
+// TestFindRecording_PrefixKey keeps a stream from matching the recordings
+// of a key it is a prefix of.
+func TestFindRecording_PrefixKey(t *testing.T) {
+	dir := t.TempDir()
+	show := writeTestRecording(t, dir, "live_show_20250101_000000.flv")
+	writeTestRecording(t, dir, "live_show_720p_20250102_000000.flv")
+	writeTestRecording(t, dir, "live_show_backup_20250103_000000_seg001.flv")
+	writeTestRecording(t, dir, "live_show_20250104_000000.mp4")
+
+	if got := findRecording(dir, "live/show"); got != show {
+		t.Fatalf("findRecording(live/show) = %q, want %q", got, show)
+	}
+	if got := findRecording(dir, "live/show_backup"); filepath.Base(got) != "live_show_backup_20250103_000000_seg001.flv" {
+		t.Fatalf("findRecording(live/show_backup) = %q, want its segment", got)
+	}
+	if got := findRecording(dir, "live"); got != "" {
+		t.Fatalf("findRecording(live) = %q, want none", got)
+	}
+}
+
+// TestIsRecordingOf checks the recording filename forms.
+func TestIsRecordingOf(t *testing.T) {
+	for name, want := range map[string]bool{
+		"live_show_20250101_000000.flv":        true,
+		"live_show_20250101_000000_seg007.flv": true,
+		"live_show_720p_20250101_000000.flv":   false,
+		"live_show_20250101_000000.mp4":        false,
+		"live_show_20250101_000000_seg.flv":    false,
+		"live_show_2025010_000000.flv":         false,
+		"live_show_20250101_000000_x.flv":      false,
+	} {
+		if got := isRecordingOf(name, "live_show"); got != want {
+			t.Errorf("isRecordingOf(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+// TestRecordingDuration reads the duration patched into onMetaData.
+func TestRecordingDuration(t *testing.T) {
+	path := writeTestRecording(t, t.TempDir(), "live_show_20250101_000000.flv")
+	if got := recordingDuration(path); got != 0.04 {
+		t.Fatalf("recordingDuration = %v, want 0.04", got)
+	}
+	if got := recordingDuration(""); got != 0 {
+		t.Fatalf("recordingDuration(\"\") = %v, want 0", got)
+	}
+}
+
+// TestVODStartOffset checks live-only vs recorded start semantics.
+func TestVODStartOffset(t *testing.T) {
+	if _, ok := vodStartOffset(-1000); ok {
+		t.Fatal("-1000 (live only) must not serve recordings")
+	}
+	if off, ok := vodStartOffset(-2000); !ok || off != 0 {
+		t.Fatalf("-2000: got off=%d ok=%v", off, ok)
+	}
+	if off, ok := vodStartOffset(1500); !ok || off != 1500 {
+		t.Fatalf("1500: got off=%d ok=%v", off, ok)
+	}
+}
+
+// TestVODSessionStreamsFileWithSeek seeks to 30ms and expects playback to
+// resume at the keyframe at 40ms, after replaying metadata and sequence header.
+func TestVODSessionStreamsFileWithSeek(t *testing.T) {
+	path := writeTestRecording(t, t.TempDir(), "live_vod_20250101_000000.flv")
+	conn := &capturingConn{}
+	v := newVODSession(path, conn, 1, 30, media.NullLogger())
+	if err := v.Start("live/vod"); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	select {
+	case <-v.done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("VOD session did not finish")
+	}
+
+	var mediaMsgs []*chunk.Message
+	var codes []string
+	for _, m := range conn.sent {
+		switch m.TypeID {
+		case 8, 9, 18:
+			mediaMsgs = append(mediaMsgs, m)
+		case 20:
+			vals, _ := amf.DecodeAll(m.Payload)
+			if info, ok := vals[3].(map[string]interface{}); ok {
+				codes = append(codes, info["code"].(string))
+			}
+		}
+	}
+	// onMetaData + sequence header + keyframe@40
+	if len(mediaMsgs) != 3 {
+		t.Fatalf("expected 3 media messages, got %d", len(mediaMsgs))
+	}
+	if mediaMsgs[2].Timestamp != 40 || mediaMsgs[2].MessageStreamID != 1 {
+		t.Fatalf("unexpected resume message ts=%d msid=%d", mediaMsgs[2].Timestamp, mediaMsgs[2].MessageStreamID)
+	}
+	if len(codes) != 2 || codes[0] != "NetStream.Play.Start" || codes[1] != "NetStream.Play.Stop" {
+		t.Fatalf("unexpected status codes: %v", codes)
+	}
+}
+
+// TestVODSessionPauseAndSeek queues a seek and a pause before the goroutine
+// starts, then resumes. Playback must report each transition and still
+// resume at the keyframe after the seek target.
+func TestVODSessionPauseAndSeek(t *testing.T) {
+	path := writeTestRecording(t, t.TempDir(), "live_vod_20250101_000000.flv")
+	conn := &capturingConn{}
+	v := newVODSession(path, conn, 1, 0, media.NullLogger())
+	v.Seek(30)
+	v.Pause(true)
+	if err := v.Start("live/vod"); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if v.Finished() {
+		t.Fatal("paused session must not finish")
+	}
+	v.Pause(false)
+	select {
+	case <-v.done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("VOD session did not finish after unpause")
+	}
+
+	var mediaCount int
+	var codes []string
+	for _, m := range conn.sent {
+		switch m.TypeID {
+		case 8, 9, 18:
+			mediaCount++
+		case 20:
+			vals, _ := amf.DecodeAll(m.Payload)
+			if info, ok := vals[3].(map[string]interface{}); ok {
+				codes = append(codes, info["code"].(string))
+			}
+		}
+	}
+	want := []string{"NetStream.Play.Start", "NetStream.Seek.Notify", "NetStream.Play.Start",
+		"NetStream.Pause.Notify", "NetStream.Unpause.Notify", "NetStream.Play.Stop"}
+	if len(codes) != len(want) {
+		t.Fatalf("status codes = %v, want %v", codes, want)
+	}
+	for i := range want {
+		if codes[i] != want[i] {
+			t.Fatalf("status codes = %v, want %v", codes, want)
+		}
+	}
+	if mediaCount != 3 {
+		t.Fatalf("expected 3 media messages after seek, got %d", mediaCount)
+	}
+}
@@ -0,0 +1,319 @@
+// File: replay.go
+// Purpose: Replay a connection trace against a server. The inbound half of
+// the trace (what the client sent) is re-sent on a fresh connection; the
+// outbound half (what the server answered) becomes the expected responses.
+// Turning a trace from a bug report into a regression test is then a
+// matter of replaying it.
+//
+// Given the trace's raw capture (ReadRaw), the client's bytes are sent
+// verbatim after a fresh handshake: chunk sizes, header compression,
+// interleaving and any trailing partial message exactly as captured, which
+// is what reproducing a chunk-level bug takes. Without it, each traced
+// message is re-chunked by chunk.Writer, which checks what the server does
+// with the messages but not with how they were framed.
+//
+// Only commands are checked: each traced _result, _error, onStatus or
+// other command must arrive again with the same name and, where it has
+// one, the same info code (e.g. "onStatus NetStream.Play.Start"). Control
+// messages, data and media depend on timing and on other connections, so
+// they are received but not compared.
+package trace
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+	"github.com/alxayo/go-rtmp/internal/rtmp/control"
+	"github.com/alxayo/go-rtmp/internal/rtmp/handshake"
+)
+
+// DefaultResponseTimeout is how long Replay waits for each expected
+// response unless ReplayOptions says otherwise.
+const DefaultResponseTimeout = 5 * time.Second
+
+// ErrMissingResponse is returned (wrapped) by Replay when an expected
+// response does not arrive.
+var ErrMissingResponse = errors.New("expected response not received")
+
+// ReplayOptions tune Replay.
+type ReplayOptions struct {
+	// Speed scales the trace's pacing: 1 replays at the original pace, 2
+	// twice as fast. Zero sends each message as soon as the responses
+	// traced before it have arrived.
+	Speed float64
+
+	// Origin is the traced time that corresponds to the start of the
+	// replay when pacing. Zero uses the first record's time. Replaying
+	// several traces with a common Origin keeps their relative timing.
+	Origin time.Time
+
+	// ResponseTimeout bounds the wait for each expected response.
+	// Default DefaultResponseTimeout.
+	ResponseTimeout time.Duration
+
+	// Raw is the trace's raw inbound capture (ReadRaw). When set, the
+	// captured bytes are sent instead of re-chunked messages: each inbound
+	// record sends the bytes up to its Raw offset, and any left after the
+	// last record are sent at the end. Nil re-chunks the messages.
+	Raw []byte
+
+	// OnMessage, when set, is called for each message sent to and received
+	// from the server.
+	OnMessage func(dir Direction, msg *chunk.Message)
+}
+
+// ReplayResult counts what a replay did.
+type ReplayResult struct {
+	Sent     int // messages sent to the server
+	Checked  int // expected responses that arrived
+	Received int // messages received from the server
+}
+
+// Message returns the traced message as a chunk.Message.
+func (r Record) Message() *chunk.Message {
+	return &chunk.Message{
+		CSID:            r.CSID,
+		TypeID:          r.TypeID,
+		MessageStreamID: r.MessageStreamID,
+		Timestamp:       r.Timestamp,
+		MessageLength:   uint32(len(r.Payload)),
+		Payload:         r.Payload,
+	}
+}
+
+// ResponseKey names the command in msg for comparing responses: the
+// command name, followed by the info object's code if there is one, e.g.
+// "onStatus NetStream.Publish.Start". It is empty for anything else.
+func ResponseKey(typeID uint8, payload []byte) string {
+	switch typeID {
+	case 17: // AMF3 command: a format byte, then AMF0 values
+		if len(payload) == 0 {
+			return ""
+		}
+		payload = payload[1:]
+	case 20:
+	default:
+		return ""
+	}
+	vals, err := amf.DecodeAll(payload)
+	if err != nil || len(vals) == 0 {
+		return ""
+	}
+	name, _ := vals[0].(string)
+	if name == "" {
+		return ""
+	}
+	for _, v := range vals[1:] {
+		if obj, ok := v.(map[string]interface{}); ok {
+			if code, ok := obj["code"].(string); ok {
+				return name + " " + code
+			}
+		}
+	}
+	return name
+}
+
+// Replay performs the client handshake on conn, then replays recs: inbound
+// records are sent, outbound command records are awaited. It returns at
+// the end of the trace, on the first response that does not arrive in
+// time (an error wrapping ErrMissingResponse), or when ctx is done. conn
+// is closed on return.
+func Replay(ctx context.Context, conn net.Conn, recs []Record, opts ReplayOptions) (ReplayResult, error) {
+	var res ReplayResult
+	if opts.ResponseTimeout <= 0 {
+		opts.ResponseTimeout = DefaultResponseTimeout
+	}
+	origin := opts.Origin
+	if origin.IsZero() && len(recs) > 0 {
+		origin = recs[0].Time
+	}
+
+	defer conn.Close()
+	// Reads and writes block on the socket; closing it is what interrupts
+	// them when ctx is done.
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+	if err := handshake.ClientHandshake(conn); err != nil {
+		return res, fmt.Errorf("handshake: %w", err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	in := newInbox()
+	readDone := make(chan struct{})
+	defer func() {
+		_ = conn.Close() // ends the reader
+		<-readDone
+	}()
+	go func() {
+		defer close(readDone)
+		r := chunk.NewReader(conn, 128)
+		for {
+			msg, err := r.ReadMessage()
+			if err != nil {
+				in.close(err)
+				return
+			}
+			in.put(msg)
+		}
+	}()
+
+	w := chunk.NewWriter(conn, 128)
+	var rawSent int64 // raw capture bytes sent so far
+	start := time.Now()
+	for i, rec := range recs {
+		switch rec.Dir {
+		case In:
+			if opts.Speed > 0 {
+				due := start.Add(time.Duration(float64(rec.Time.Sub(origin)) / opts.Speed))
+				if err := sleepCtx(ctx, time.Until(due)); err != nil {
+					return res, err
+				}
+			}
+			msg := rec.Message()
+			if opts.Raw != nil {
+				if rec.Raw < rawSent || rec.Raw > int64(len(opts.Raw)) {
+					return res, fmt.Errorf("record %d: raw capture offset %d outside %d-%d", i+1, rec.Raw, rawSent, len(opts.Raw))
+				}
+				if _, err := conn.Write(opts.Raw[rawSent:rec.Raw]); err != nil {
+					return res, fmt.Errorf("record %d: send %s: %w", i+1, describe(msg), err)
+				}
+				rawSent = rec.Raw
+			} else {
+				if err := w.WriteMessage(msg); err != nil {
+					return res, fmt.Errorf("record %d: send %s: %w", i+1, describe(msg), err)
+				}
+				if msg.TypeID == control.TypeSetChunkSize && len(msg.Payload) >= 4 {
+					w.SetChunkSize(binary.BigEndian.Uint32(msg.Payload) & 0x7FFFFFFF)
+				}
+			}
+			res.Sent++
+			if opts.OnMessage != nil {
+				opts.OnMessage(In, msg)
+			}
+		case Out:
+			want := ResponseKey(rec.TypeID, rec.Payload)
+			if want == "" {
+				continue
+			}
+			err := in.await(ctx, want, opts.ResponseTimeout, func(msg *chunk.Message) {
+				res.Received++
+				if opts.OnMessage != nil {
+					opts.OnMessage(Out, msg)
+				}
+			})
+			if err != nil {
+				return res, fmt.Errorf("record %d: %q (traced at +%.3fs): %w", i+1, want, rec.Time.Sub(origin).Seconds(), err)
+			}
+			res.Checked++
+		}
+	}
+	if rest := opts.Raw[rawSent:]; len(rest) > 0 {
+		// Bytes of a message the client never finished.
+		if _, err := conn.Write(rest); err != nil {
+			return res, fmt.Errorf("send trailing %d raw bytes: %w", len(rest), err)
+		}
+	}
+	return res, nil
+}
+
+// describe names a message for errors.
+func describe(msg *chunk.Message) string {
+	if key := ResponseKey(msg.TypeID, msg.Payload); key != "" {
+		return key
+	}
+	return fmt.Sprintf("type %d", msg.TypeID)
+}
+
+// sleepCtx waits for d or until ctx is done.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// inbox buffers the messages read from the server without bound, so a
+// server streaming media to the replayed connection never blocks on it.
+type inbox struct {
+	mu     sync.Mutex
+	msgs   []*chunk.Message
+	err    error         // set once the reader stopped
+	signal chan struct{} // poked on every put and on close
+}
+
+func newInbox() *inbox { return &inbox{signal: make(chan struct{}, 1)} }
+
+func (b *inbox) put(msg *chunk.Message) {
+	b.mu.Lock()
+	b.msgs = append(b.msgs, msg)
+	b.mu.Unlock()
+	b.poke()
+}
+
+func (b *inbox) close(err error) {
+	b.mu.Lock()
+	b.err = err
+	b.mu.Unlock()
+	b.poke()
+}
+
+func (b *inbox) poke() {
+	select {
+	case b.signal <- struct{}{}:
+	default:
+	}
+}
+
+// await consumes received messages, passing each to seen, until one has
+// response key want. Messages before it are skipped.
+func (b *inbox) await(ctx context.Context, want string, timeout time.Duration, seen func(*chunk.Message)) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	var last string // last command seen, for the error
+	for {
+		b.mu.Lock()
+		msgs, err := b.msgs, b.err
+		b.msgs = nil
+		b.mu.Unlock()
+		for i, msg := range msgs {
+			seen(msg)
+			key := ResponseKey(msg.TypeID, msg.Payload)
+			if key == want {
+				b.mu.Lock()
+				b.msgs = append(msgs[i+1:len(msgs):len(msgs)], b.msgs...)
+				b.mu.Unlock()
+				return nil
+			}
+			if key != "" {
+				last = key
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%w: connection ended: %v", ErrMissingResponse, err)
+		}
+		select {
+		case <-b.signal:
+		case <-deadline.C:
+			if last != "" {
+				return fmt.Errorf("%w after %v (last command received: %q)", ErrMissingResponse, timeout, last)
+			}
+			return fmt.Errorf("%w after %v", ErrMissingResponse, timeout)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,42 @@
+// replay_test.go – tests for trace replay's response matching. Full
+// replays against a server are in tests/integration/replay_test.go.
+package trace
+
+import (
+	"testing"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
+)
+
+func TestResponseKey(t *testing.T) {
+	encode := func(vals ...interface{}) []byte {
+		t.Helper()
+		b, err := amf.EncodeAll(vals...)
+		if err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+		return b
+	}
+	status := encode("onStatus", 0.0, nil, map[string]interface{}{"level": "status", "code": "NetStream.Play.Start"})
+	tests := []struct {
+		name    string
+		typeID  uint8
+		payload []byte
+		want    string
+	}{
+		{"result without code", 20, encode("_result", 2.0, nil, 1.0), "_result"},
+		{"onStatus with code", 20, status, "onStatus NetStream.Play.Start"},
+		{"AMF3 command", 17, append([]byte{0}, status...), "onStatus NetStream.Play.Start"},
+		{"data message", 18, encode("onMetaData", map[string]interface{}{}), ""},
+		{"video", 9, []byte{0x17, 0x01}, ""},
+		{"garbage", 20, []byte{0xff}, ""},
+		{"empty AMF3", 17, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ResponseKey(tt.typeID, tt.payload); got != tt.want {
+				t.Fatalf("ResponseKey = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+// File: trace.go
+// Purpose: Per-connection RTMP message traces for debugging interop issues.
+// With tracing on, every message a connection reads or writes is recorded
+// after chunk reassembly (inbound) or once fully written (outbound): its
+// direction, time, header fields and payload. cmd/rtmp-trace prints them.
+// The bytes the peer sent after the handshake are also captured verbatim,
+// chunking and all, so a replay can send exactly what the client did.
+//
+// Key Types:
+//   - Writer: Appends records to one connection's trace file
+//   - Reader: Reads a trace file back
+//   - Header: First line of a trace: connection ID, peer, start time and
+//     raw capture file
+//   - Record: One traced message
+//   - Replay: Re-send a trace to a server and check its responses (replay.go)
+//
+// Format: JSON Lines. The first line is the Header, every following line
+// a Record. Payloads are base64 encoded, as encoding/json does for []byte.
+// The raw inbound bytes go to a sidecar file named in the header
+// ("<trace>.in.bin"); each inbound record's "raw" is the offset in it just
+// past the bytes that carried the message.
+//
+//	{"conn":"c000001","remote":"10.0.0.5:53211","start":"2026-05-01T10:00:00Z","raw_in":"c000001-20260501T100000.in.bin"}
+//	{"t":"2026-05-01T10:00:00.0012Z","dir":"out","csid":2,"type":5,"stream":0,"ts":0,"len":4,"payload":"ACYloA=="}
+//	{"t":"2026-05-01T10:00:00.0250Z","dir":"in","csid":3,"type":20,"stream":0,"ts":0,"len":183,"payload":"AgAHY29u...","raw":196}
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+)
+
+// Direction says whether a message was read from or written to the peer.
+type Direction string
+
+const (
+	In  Direction = "in"  // received from the peer
+	Out Direction = "out" // sent to the peer
+)
+
+// Header identifies the connection a trace belongs to.
+type Header struct {
+	ConnID string    `json:"conn"`
+	Remote string    `json:"remote"`
+	Start  time.Time `json:"start"`
+	RawIn  string    `json:"raw_in,omitempty"` // raw inbound capture, in the trace's directory ("" = none)
+}
+
+// Record is one traced message.
+type Record struct {
+	Time            time.Time `json:"t"`
+	Dir             Direction `json:"dir"`
+	CSID            uint32    `json:"csid"`
+	TypeID          uint8     `json:"type"`
+	MessageStreamID uint32    `json:"stream"`
+	Timestamp       uint32    `json:"ts"`
+	Length          uint32    `json:"len"`
+	Payload         []byte    `json:"payload,omitempty"`
+	Raw             int64     `json:"raw,omitempty"` // inbound: end offset of the message's bytes in the raw capture
+}
+
+// Writer appends records to a trace file. It is safe for concurrent use by
+// a connection's read and write loops; records after Close are dropped.
+type Writer struct {
+	mu     sync.Mutex
+	f      *os.File
+	buf    *bufio.Writer
+	enc    *json.Encoder
+	raw    *os.File // raw inbound capture
+	rawBuf *bufio.Writer
+	rawN   int64 // bytes captured
+	err    error // first write error; tracing stops after it
+}
+
+// Create starts the trace for connection connID in dir, creating dir if
+// needed. The file is named after the connection and its start time, e.g.
+// "c000001-20260501T100000.jsonl", and the raw inbound capture after the
+// trace ("c000001-20260501T100000.in.bin").
+func Create(dir, connID, remote string) (*Writer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("trace dir: %w", err)
+	}
+	start := time.Now()
+	base := fmt.Sprintf("%s-%s", connID, start.UTC().Format("20060102T150405"))
+	f, err := os.Create(filepath.Join(dir, base+".jsonl"))
+	if err != nil {
+		return nil, fmt.Errorf("create trace: %w", err)
+	}
+	raw, err := os.Create(filepath.Join(dir, base+".in.bin"))
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("create trace: %w", err)
+	}
+	w := &Writer{f: f, buf: bufio.NewWriter(f), raw: raw, rawBuf: bufio.NewWriter(raw)}
+	w.enc = json.NewEncoder(w.buf)
+	if err := w.write(Header{ConnID: connID, Remote: remote, Start: start, RawIn: filepath.Base(raw.Name())}); err != nil {
+		_ = f.Close()
+		_ = raw.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Path returns the trace file's path.
+func (w *Writer) Path() string { return w.f.Name() }
+
+// Record traces msg as sent or received now. An inbound message is
+// recorded with the raw capture's length, so it must be recorded once the
+// bytes that carried it have been captured (RecordRaw) and before any
+// that follow. Nil-safe, so callers can trace unconditionally.
+func (w *Writer) Record(dir Direction, msg *chunk.Message) {
+	if w == nil || msg == nil {
+		return
+	}
+	rec := Record{
+		Time:            time.Now(),
+		Dir:             dir,
+		CSID:            msg.CSID,
+		TypeID:          msg.TypeID,
+		MessageStreamID: msg.MessageStreamID,
+		Timestamp:       msg.Timestamp,
+		Length:          uint32(len(msg.Payload)),
+		Payload:         msg.Payload,
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if dir == In && w.err == nil {
+		// The capture is flushed first, so the trace never points past it.
+		if err := w.rawBuf.Flush(); err != nil {
+			w.err = err
+			return
+		}
+		rec.Raw = w.rawN
+	}
+	_ = w.writeLocked(rec)
+}
+
+// RecordRaw appends p, bytes just read from the peer, to the raw inbound
+// capture. Nil-safe.
+func (w *Writer) RecordRaw(p []byte) {
+	if w == nil || len(p) == 0 {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return
+	}
+	n, err := w.rawBuf.Write(p)
+	w.rawN += int64(n)
+	if err != nil {
+		w.err = err
+	}
+}
+
+// write encodes v as one line and flushes it, so a trace is complete up to
+// the last message even if the process dies.
+func (w *Writer) write(v any) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.writeLocked(v)
+}
+
+// writeLocked is write with w.mu held.
+func (w *Writer) writeLocked(v any) error {
+	if w.err != nil {
+		return w.err
+	}
+	if err := w.enc.Encode(v); err != nil {
+		w.err = err
+		return err
+	}
+	if err := w.buf.Flush(); err != nil {
+		w.err = err
+		return err
+	}
+	return nil
+}
+
+// Close flushes and closes the trace and raw capture files. Nil-safe and
+// idempotent.
+func (w *Writer) Close() error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if errors.Is(w.err, os.ErrClosed) {
+		return nil
+	}
+	var err error
+	if w.err == nil {
+		err = w.rawBuf.Flush()
+	}
+	w.err = os.ErrClosed
+	return errors.Join(err, w.raw.Close(), w.f.Close())
+}
+
+// Reader reads a trace written by Writer.
+type Reader struct {
+	dec    *json.Decoder
+	header Header
+}
+
+// NewReader reads the trace header from r and returns a Reader positioned
+// at the first record.
+func NewReader(r io.Reader) (*Reader, error) {
+	dec := json.NewDecoder(r)
+	var h Header
+	if err := dec.Decode(&h); err != nil {
+		return nil, fmt.Errorf("read trace header: %w", err)
+	}
+	if h.ConnID == "" {
+		return nil, errors.New("read trace header: not an RTMP trace")
+	}
+	return &Reader{dec: dec, header: h}, nil
+}
+
+// Header returns the trace's header.
+func (r *Reader) Header() Header { return r.header }
+
+// Next returns the next record, or io.EOF after the last one.
+func (r *Reader) Next() (Record, error) {
+	var rec Record
+	if err := r.dec.Decode(&rec); err != nil {
+		if errors.Is(err, io.EOF) {
+			return Record{}, io.EOF
+		}
+		return Record{}, fmt.Errorf("read trace record: %w", err)
+	}
+	return rec, nil
+}
+
+// ReadRaw reads the raw inbound capture of the trace at path with header
+// h. It returns nil if the trace has none.
+func ReadRaw(path string, h Header) ([]byte, error) {
+	if h.RawIn == "" {
+		return nil, nil
+	}
+	return os.ReadFile(filepath.Join(filepath.Dir(path), filepath.Base(h.RawIn)))
+}
+
+// ReadFile reads a whole trace file.
+func ReadFile(path string) (Header, []Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Header{}, nil, err
+	}
+	defer f.Close()
+	r, err := NewReader(f)
+	if err != nil {
+		return Header{}, nil, err
+	}
+	var recs []Record
+	for {
+		rec, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return r.Header(), recs, nil
+		}
+		if err != nil {
+			return r.Header(), recs, err
+		}
+		recs = append(recs, rec)
+	}
+}
@@ -0,0 +1,127 @@
+// trace_test.go – tests for writing and reading connection traces.
+package trace
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+)
+
+func TestWriterReaderRoundTrip(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "traces")
+	w, err := Create(dir, "c000042", "10.0.0.5:53211")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if !strings.HasPrefix(filepath.Base(w.Path()), "c000042-") {
+		t.Fatalf("trace file %q not named after the connection", w.Path())
+	}
+	in := &chunk.Message{CSID: 3, TypeID: 20, MessageStreamID: 0, Timestamp: 7, Payload: []byte{0x02, 0x00, 0x07}}
+	out := &chunk.Message{CSID: 6, TypeID: 9, MessageStreamID: 1, Timestamp: 40, Payload: []byte{0x17, 0x01}}
+	raw := []byte{0x03, 0, 0, 7, 0, 0, 3, 20, 0, 0, 0, 0, 0x02, 0x00, 0x07}
+	w.RecordRaw(raw[:5])
+	w.RecordRaw(raw[5:])
+	w.Record(In, in)
+	w.Record(Out, out)
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	w.Record(In, in) // dropped after Close
+	if err := w.Close(); err != nil {
+		t.Fatalf("second close: %v", err)
+	}
+
+	f, err := os.Open(w.Path())
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer f.Close()
+	r, err := NewReader(f)
+	if err != nil {
+		t.Fatalf("reader: %v", err)
+	}
+	h := r.Header()
+	if h.ConnID != "c000042" || h.Remote != "10.0.0.5:53211" || h.Start.IsZero() {
+		t.Fatalf("header = %+v", h)
+	}
+	if got, err := ReadRaw(w.Path(), h); err != nil || !bytes.Equal(got, raw) {
+		t.Fatalf("raw capture = %x, %v, want %x", got, err, raw)
+	}
+	for _, want := range []struct {
+		dir Direction
+		msg *chunk.Message
+		raw int64
+	}{{In, in, int64(len(raw))}, {Out, out, 0}} {
+		rec, err := r.Next()
+		if err != nil {
+			t.Fatalf("next: %v", err)
+		}
+		m := want.msg
+		if rec.Dir != want.dir || rec.CSID != m.CSID || rec.TypeID != m.TypeID || rec.MessageStreamID != m.MessageStreamID ||
+			rec.Timestamp != m.Timestamp || rec.Length != uint32(len(m.Payload)) || !bytes.Equal(rec.Payload, m.Payload) || rec.Raw != want.raw {
+			t.Fatalf("record = %+v, want %s %+v", rec, want.dir, m)
+		}
+	}
+	if _, err := r.Next(); !errors.Is(err, io.EOF) {
+		t.Fatalf("after last record: %v, want io.EOF", err)
+	}
+}
+
+func TestWriterConcurrentRecords(t *testing.T) {
+	w, err := Create(t.TempDir(), "c000001", "127.0.0.1:1")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	var wg sync.WaitGroup
+	for _, dir := range []Direction{In, Out} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				w.Record(dir, &chunk.Message{TypeID: 8, Payload: []byte{0xAF, 0x01, byte(i)}})
+			}
+		}()
+	}
+	wg.Wait()
+	_ = w.Close()
+
+	f, _ := os.Open(w.Path())
+	defer f.Close()
+	r, err := NewReader(f)
+	if err != nil {
+		t.Fatalf("reader: %v", err)
+	}
+	n := 0
+	for {
+		if _, err := r.Next(); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			t.Fatalf("record %d: %v", n, err)
+		}
+		n++
+	}
+	if n != 200 {
+		t.Fatalf("read %d records, want 200", n)
+	}
+}
+
+func TestNewReaderRejectsOtherFiles(t *testing.T) {
+	if _, err := NewReader(strings.NewReader(`{"level":"INFO","msg":"hello"}`)); err == nil {
+		t.Fatal("log line accepted as a trace header")
+	}
+}
+
+func TestNilWriter(t *testing.T) {
+	var w *Writer
+	w.Record(In, &chunk.Message{TypeID: 8})
+	if err := w.Close(); err != nil {
+		t.Fatalf("nil close: %v", err)
+	}
+}
@@ -0,0 +1,321 @@
+// File: manager.go
+// Purpose: Runs one external transcoder process (typically ffmpeg) per published
+// stream. The process pulls the stream from this server over RTMP, transcodes
+// it, and usually pushes the result back as a new stream key. This gives
+// server-side renditions without linking a codec into the server.
+//
+// Key Types:
+//   - Manager: Spawns, restarts and kills per-stream processes
+//   - ProcessInfo: Point-in-time status of one process (for the metrics endpoint)
+//
+// Key Functions:
+//   - NewManager(template, baseURL, logger): Create a manager for a command template
+//   - (m *Manager) Start(streamKey): Spawn the process for a newly published stream
+//   - (m *Manager) Stop(streamKey): Kill the process when the stream is unpublished
+//   - (m *Manager) Close(): Kill all processes (server shutdown)
+//   - (m *Manager) Snapshot(): Status of every process
+//
+// Command template:
+//
+//	The template is split on whitespace into program + arguments (no shell
+//	quoting). Each argument may contain these placeholders:
+//	  {input}  rtmp URL of the published stream on this server (baseURL/key)
+//	  {rtmp}   baseURL, e.g. rtmp://127.0.0.1:1935
+//	  {key}    stream key (app/name)
+//	  {app}    application name
+//	  {name}   stream name
+//	Example:
+//	  ffmpeg -i {input} -c:v libx264 -s 1280x720 -c:a copy -f flv {rtmp}/{key}_720p?transcoded=1
+//
+// Design: A process that exits while its stream is still published is restarted
+// with exponential backoff (RestartDelay doubling up to MaxRestartDelay; reset
+// after a run longer than MaxRestartDelay). Stop cancels the process context,
+// which kills the process, and waits for the supervisor goroutine to exit.
+package transcode
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Process status values reported in ProcessInfo.Status.
+const (
+	StatusRunning    = "running"
+	StatusRestarting = "restarting"
+	StatusStopped    = "stopped"
+)
+
+// Manager supervises one transcoder process per stream key.
+type Manager struct {
+	args    []string // command template split into program + arguments
+	baseURL string   // rtmp://host:port of this server
+	logger  *slog.Logger
+
+	// RestartDelay is the initial delay before restarting a crashed process.
+	RestartDelay time.Duration
+	// MaxRestartDelay caps the exponential backoff between restarts.
+	MaxRestartDelay time.Duration
+
+	mu    sync.Mutex
+	procs map[string]*process
+}
+
+// process is the supervisor state for one stream.
+type process struct {
+	key     string
+	args    []string
+	cancel  context.CancelFunc
+	done    chan struct{}
+	started time.Time
+
+	mu       sync.Mutex
+	pid      int
+	status   string
+	restarts int
+	lastErr  string
+}
+
+// ProcessInfo is a point-in-time view of one transcoder process.
+type ProcessInfo struct {
+	StreamKey     string `json:"stream_key"`
+	Command       string `json:"command"`
+	PID           int    `json:"pid,omitempty"`
+	Status        string `json:"status"`
+	Restarts      int    `json:"restarts"`
+	UptimeSeconds int64  `json:"uptime_seconds"`
+	LastError     string `json:"last_error,omitempty"`
+}
+
+// NewManager creates a manager for the given command template. baseURL is the
+// RTMP URL of this server (without trailing slash) used for {input} and {rtmp}.
+func NewManager(template, baseURL string, logger *slog.Logger) (*Manager, error) {
+	args := strings.Fields(template)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("transcode: empty command template")
+	}
+	return &Manager{
+		args:            args,
+		baseURL:         strings.TrimSuffix(baseURL, "/"),
+		logger:          logger.With("component", "transcode_manager"),
+		RestartDelay:    time.Second,
+		MaxRestartDelay: 30 * time.Second,
+		procs:           make(map[string]*process),
+	}, nil
+}
+
+// Start spawns the transcoder for streamKey. It is a no-op if a process for
+// the key is already supervised.
+func (m *Manager) Start(streamKey string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.procs[streamKey]; exists {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &process{
+		key:     streamKey,
+		args:    m.expand(streamKey),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		started: time.Now(),
+		status:  StatusRunning,
+	}
+	m.procs[streamKey] = p
+	go m.supervise(ctx, p)
+	m.logger.Info("Transcoder started", "stream_key", streamKey, "command", strings.Join(p.args, " "))
+}
+
+// Stop kills the transcoder for streamKey and waits for it to exit.
+func (m *Manager) Stop(streamKey string) {
+	m.mu.Lock()
+	p, exists := m.procs[streamKey]
+	delete(m.procs, streamKey)
+	m.mu.Unlock()
+	if !exists {
+		return
+	}
+	p.cancel()
+	<-p.done
+	m.logger.Info("Transcoder stopped", "stream_key", streamKey)
+}
+
+// Close kills all transcoder processes.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	keys := make([]string, 0, len(m.procs))
+	for k := range m.procs {
+		keys = append(keys, k)
+	}
+	m.mu.Unlock()
+	for _, k := range keys {
+		m.Stop(k)
+	}
+	return nil
+}
+
+// Snapshot returns the status of every supervised process, sorted by key.
+func (m *Manager) Snapshot() []ProcessInfo {
+	m.mu.Lock()
+	procs := make([]*process, 0, len(m.procs))
+	for _, p := range m.procs {
+		procs = append(procs, p)
+	}
+	m.mu.Unlock()
+
+	now := time.Now()
+	infos := make([]ProcessInfo, 0, len(procs))
+	for _, p := range procs {
+		p.mu.Lock()
+		infos = append(infos, ProcessInfo{
+			StreamKey:     p.key,
+			Command:       strings.Join(p.args, " "),
+			PID:           p.pid,
+			Status:        p.status,
+			Restarts:      p.restarts,
+			UptimeSeconds: int64(now.Sub(p.started).Seconds()),
+			LastError:     p.lastErr,
+		})
+		p.mu.Unlock()
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].StreamKey < infos[j].StreamKey })
+	return infos
+}
+
+// expand substitutes placeholders in the command template for streamKey.
+func (m *Manager) expand(streamKey string) []string {
+	app, name := streamKey, ""
+	if i := strings.Index(streamKey, "/"); i >= 0 {
+		app, name = streamKey[:i], streamKey[i+1:]
+	}
+	r := strings.NewReplacer(
+		"{input}", m.baseURL+"/"+streamKey,
+		"{rtmp}", m.baseURL,
+		"{key}", streamKey,
+		"{app}", app,
+		"{name}", name,
+	)
+	out := make([]string, len(m.args))
+	for i, a := range m.args {
+		out[i] = r.Replace(a)
+	}
+	return out
+}
+
+// supervise runs the process until ctx is cancelled, restarting it with
+// backoff whenever it exits on its own.
+func (m *Manager) supervise(ctx context.Context, p *process) {
+	defer close(p.done)
+	delay := m.RestartDelay
+	for {
+		runStart := time.Now()
+		err := m.runOnce(ctx, p)
+		if ctx.Err() != nil {
+			p.setStatus(StatusStopped, 0)
+			return
+		}
+
+		p.mu.Lock()
+		p.status = StatusRestarting
+		p.pid = 0
+		p.restarts++
+		if err != nil {
+			p.lastErr = err.Error()
+		}
+		p.mu.Unlock()
+
+		if time.Since(runStart) > m.MaxRestartDelay {
+			delay = m.RestartDelay // ran long enough: treat as a fresh crash
+		}
+		m.logger.Warn("Transcoder exited, restarting", "stream_key", p.key, "error", err, "delay", delay)
+
+		select {
+		case <-ctx.Done():
+			p.setStatus(StatusStopped, 0)
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > m.MaxRestartDelay {
+			delay = m.MaxRestartDelay
+		}
+	}
+}
+
+// runOnce starts the process and waits for it to exit. The returned error
+// includes the last line the process wrote to stderr, if any.
+func (m *Manager) runOnce(ctx context.Context, p *process) error {
+	cmd := exec.CommandContext(ctx, p.args[0], p.args[1:]...)
+	stderr := &lastLineWriter{}
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start: %w", err)
+	}
+	p.setStatus(StatusRunning, cmd.Process.Pid)
+	err := cmd.Wait()
+	if line := stderr.String(); line != "" {
+		if err == nil {
+			err = fmt.Errorf("exited: %s", line)
+		} else {
+			err = fmt.Errorf("%w: %s", err, line)
+		}
+	} else if err == nil {
+		err = fmt.Errorf("exited")
+	}
+	return err
+}
+
+func (p *process) setStatus(status string, pid int) {
+	p.mu.Lock()
+	p.status = status
+	p.pid = pid
+	p.mu.Unlock()
+}
+
+// lastLineWriter keeps the last non-empty line written to it, truncated to
+// maxLastLine bytes. Used to surface a crashed process's final error message.
+type lastLineWriter struct {
+	mu   sync.Mutex
+	buf  []byte // partial line being accumulated
+	last string
+}
+
+const maxLastLine = 256
+
+func (w *lastLineWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, b...)
+	for {
+		i := bytes.IndexAny(w.buf, "\r\n")
+		if i < 0 {
+			break
+		}
+		if line := strings.TrimSpace(string(w.buf[:i])); line != "" {
+			w.last = line
+		}
+		w.buf = w.buf[i+1:]
+	}
+	if len(w.buf) > maxLastLine {
+		w.buf = w.buf[len(w.buf)-maxLastLine:]
+	}
+	if len(w.last) > maxLastLine {
+		w.last = w.last[:maxLastLine]
+	}
+	return len(b), nil
+}
+
+func (w *lastLineWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if line := strings.TrimSpace(string(w.buf)); line != "" {
+		return line
+	}
+	return w.last
+}
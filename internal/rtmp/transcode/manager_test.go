@@ -0,0 +1,103 @@
+package transcode
+
+import (
+	"log/slog"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// requireCommand skips the test when a POSIX utility is not on PATH.
+func requireCommand(t *testing.T, name string) {
+	t.Helper()
+	if _, err := exec.LookPath(name); err != nil {
+		t.Skipf("%s not available: %v", name, err)
+	}
+}
+
+func TestManager_ExpandPlaceholders(t *testing.T) {
+	m, err := NewManager("ffmpeg -i {input} -f flv {rtmp}/{app}/{name}_720p?transcoded=1 {key}", "rtmp://127.0.0.1:1935/", slog.Default())
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	got := m.expand("live/show")
+	want := []string{"ffmpeg", "-i", "rtmp://127.0.0.1:1935/live/show", "-f", "flv",
+		"rtmp://127.0.0.1:1935/live/show_720p?transcoded=1", "live/show"}
+	if len(got) != len(want) {
+		t.Fatalf("expand = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expand[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestNewManager_EmptyTemplate(t *testing.T) {
+	if _, err := NewManager("   ", "rtmp://127.0.0.1:1935", slog.Default()); err == nil {
+		t.Fatal("expected error for empty template")
+	}
+}
+
+func TestManager_StartStop(t *testing.T) {
+	requireCommand(t, "sleep")
+	m, _ := NewManager("sleep 30", "rtmp://127.0.0.1:1935", slog.Default())
+	m.Start("live/a")
+	m.Start("live/a") // duplicate start is a no-op
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		snap := m.Snapshot()
+		if len(snap) == 1 && snap[0].PID != 0 && snap[0].Status == StatusRunning {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("process did not start: %+v", snap)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	done := make(chan struct{})
+	go func() { m.Stop("live/a"); close(done) }()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Stop did not kill the process")
+	}
+	if n := len(m.Snapshot()); n != 0 {
+		t.Fatalf("expected empty snapshot after Stop, got %d", n)
+	}
+}
+
+func TestManager_RestartsCrashedProcess(t *testing.T) {
+	requireCommand(t, "false")
+	m, _ := NewManager("false", "rtmp://127.0.0.1:1935", slog.Default())
+	m.RestartDelay = 5 * time.Millisecond
+	m.MaxRestartDelay = 20 * time.Millisecond
+	m.Start("live/crash")
+	defer m.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		snap := m.Snapshot()
+		if len(snap) == 1 && snap[0].Restarts >= 2 {
+			if snap[0].LastError == "" {
+				t.Fatal("expected LastError to be recorded")
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("process was not restarted: %+v", snap)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLastLineWriter(t *testing.T) {
+	w := &lastLineWriter{}
+	w.Write([]byte("first line\nsecond"))
+	w.Write([]byte(" line\n\n"))
+	if got := w.String(); got != "second line" {
+		t.Fatalf("String() = %q, want %q", got, "second line")
+	}
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// LocalStore copies files into Dir, creating subdirectories as needed.
+// Files are written to a temporary name and renamed into place, so a
+// partially copied file is never visible under its final name.
+type LocalStore struct {
+	Dir string
+}
+
+// Put copies r to Dir/key and returns its file:// URL.
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader, size int64) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	dst := filepath.Join(s.Dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return "", fmt.Errorf("storage: mkdir: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".upload-*")
+	if err != nil {
+		return "", fmt.Errorf("storage: create: %w", err)
+	}
+	n, err := io.Copy(tmp, ctxReader{ctx, r})
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && size >= 0 && n != size {
+		err = fmt.Errorf("short copy: %d of %d bytes", n, size)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), dst)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("storage: write %s: %w", dst, err)
+	}
+	abs, err := filepath.Abs(dst)
+	if err != nil {
+		abs = dst
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}).String(), nil
+}
+
+// ctxReader reads from r until ctx ends, so a copy can be cancelled.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
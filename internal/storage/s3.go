@@ -0,0 +1,353 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPartSize is the multipart upload part size. S3 requires every
+// part but the last to be at least 5 MiB.
+const DefaultPartSize = 8 << 20
+
+// DefaultRequestTimeout bounds each request of an S3Store without its own
+// Client, so a stalled endpoint cannot hold an upload forever. A request
+// carries at most one part.
+const DefaultRequestTimeout = 2 * time.Minute
+
+// defaultClient is the HTTP client of S3Stores without their own.
+var defaultClient = &http.Client{Timeout: DefaultRequestTimeout}
+
+// S3Store uploads objects to an S3-compatible bucket using multipart
+// upload, signed with AWS Signature Version 4. Each part is buffered in
+// memory, so a Put holds at most PartSize bytes.
+type S3Store struct {
+	Bucket   string
+	Prefix   string // prepended to every key
+	Region   string
+	Endpoint string // e.g. "https://s3.eu-west-1.amazonaws.com" or "http://minio:9000"
+
+	// PathStyle addresses objects as Endpoint/bucket/key instead of
+	// bucket.host/key. Most S3-compatible servers need it.
+	PathStyle bool
+
+	AccessKey    string
+	SecretKey    string
+	SessionToken string // optional, for temporary credentials
+
+	PartSize int          // bytes per part (default DefaultPartSize)
+	Client   *http.Client // default: a client with DefaultRequestTimeout
+
+	now func() time.Time // for tests
+}
+
+// newS3StoreFromURL builds an S3Store from s3://bucket/prefix?region=&endpoint=.
+func newS3StoreFromURL(u *url.URL) (*S3Store, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("storage: %q has no bucket", u.String())
+	}
+	q := u.Query()
+	s := &S3Store{
+		Bucket:       u.Host,
+		Prefix:       strings.Trim(u.Path, "/"),
+		Region:       q.Get("region"),
+		Endpoint:     q.Get("endpoint"),
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if s.Region == "" {
+		s.Region = os.Getenv("AWS_REGION")
+	}
+	if s.Region == "" {
+		s.Region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if s.Region == "" {
+		s.Region = "us-east-1"
+	}
+	if s.Endpoint == "" {
+		s.Endpoint = "https://s3." + s.Region + ".amazonaws.com"
+	} else {
+		s.PathStyle = true
+		if _, err := url.Parse(s.Endpoint); err != nil {
+			return nil, fmt.Errorf("storage: endpoint %q: %w", s.Endpoint, err)
+		}
+	}
+	if s.AccessKey == "" || s.SecretKey == "" {
+		return nil, errors.New("storage: s3 needs AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	return s, nil
+}
+
+// Put uploads r as Prefix/key and returns the object's URL.
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, size int64) (string, error) {
+	objURL, err := s.objectURL(joinKey(s.Prefix, key))
+	if err != nil {
+		return "", err
+	}
+
+	uploadID, err := s.createUpload(ctx, objURL)
+	if err != nil {
+		return "", err
+	}
+	if err := s.uploadParts(ctx, objURL, uploadID, r); err != nil {
+		s.abortUpload(objURL, uploadID)
+		return "", err
+	}
+	return objURL.String(), nil
+}
+
+// objectURL returns the URL of key in the bucket.
+func (s *S3Store) objectURL(key string) (*url.URL, error) {
+	u, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("storage: endpoint %q: %w", s.Endpoint, err)
+	}
+	base := strings.TrimRight(u.Path, "/")
+	if s.PathStyle {
+		base += "/" + s.Bucket
+	} else {
+		u.Host = s.Bucket + "." + u.Host
+	}
+	// Escape each segment the way SigV4 canonicalizes it, so the path
+	// sent is exactly the path signed.
+	segs := strings.Split(key, "/")
+	for i, seg := range segs {
+		segs[i] = uriEscape(seg)
+	}
+	u.Path = base + "/" + key
+	u.RawPath = base + "/" + strings.Join(segs, "/")
+	return u, nil
+}
+
+// uploadParts sends r in PartSize parts and completes the upload.
+func (s *S3Store) uploadParts(ctx context.Context, objURL *url.URL, uploadID string, r io.Reader) error {
+	partSize := s.PartSize
+	if partSize <= 0 {
+		partSize = DefaultPartSize
+	}
+	buf := make([]byte, partSize)
+	var parts []completedPart
+	for n := 1; ; n++ {
+		got, err := io.ReadFull(r, buf)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return fmt.Errorf("storage: read: %w", err)
+		}
+		if got == 0 && len(parts) > 0 {
+			break // S3 rejects an empty trailing part
+		}
+		q := url.Values{"partNumber": {strconv.Itoa(n)}, "uploadId": {uploadID}}
+		resp, err := s.do(ctx, http.MethodPut, objURL, q, buf[:got], "")
+		if err != nil {
+			return fmt.Errorf("storage: upload part %d: %w", n, err)
+		}
+		resp.Body.Close()
+		parts = append(parts, completedPart{PartNumber: n, ETag: resp.Header.Get("ETag")})
+		if got < partSize {
+			break
+		}
+	}
+	return s.completeUpload(ctx, objURL, uploadID, parts)
+}
+
+type completedPart struct {
+	PartNumber int
+	ETag       string
+}
+
+func (s *S3Store) createUpload(ctx context.Context, objURL *url.URL) (string, error) {
+	resp, err := s.do(ctx, http.MethodPost, objURL, url.Values{"uploads": {""}}, nil, "")
+	if err != nil {
+		return "", fmt.Errorf("storage: create multipart upload: %w", err)
+	}
+	defer resp.Body.Close()
+	var res struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&res); err != nil || res.UploadID == "" {
+		return "", fmt.Errorf("storage: create multipart upload: bad response (%v)", err)
+	}
+	return res.UploadID, nil
+}
+
+func (s *S3Store) completeUpload(ctx context.Context, objURL *url.URL, uploadID string, parts []completedPart) error {
+	body, _ := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	resp, err := s.do(ctx, http.MethodPost, objURL, url.Values{"uploadId": {uploadID}}, body, "application/xml")
+	if err != nil {
+		return fmt.Errorf("storage: complete multipart upload: %w", err)
+	}
+	defer resp.Body.Close()
+	// CompleteMultipartUpload can fail after answering 200, with an
+	// <Error> document as the body.
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if e := parseS3Error(data); e != nil {
+		return fmt.Errorf("storage: complete multipart upload: %w", e)
+	}
+	return nil
+}
+
+// abortUpload discards the parts of a failed upload. Errors are ignored:
+// a bucket lifecycle rule cleans up anything left behind.
+func (s *S3Store) abortUpload(objURL *url.URL, uploadID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if resp, err := s.do(ctx, http.MethodDelete, objURL, url.Values{"uploadId": {uploadID}}, nil, ""); err == nil {
+		resp.Body.Close()
+	}
+}
+
+// do sends a signed request and returns the response if its status is 2xx.
+func (s *S3Store) do(ctx context.Context, method string, objURL *url.URL, query url.Values, body []byte, contentType string) (*http.Response, error) {
+	u := *objURL
+	u.RawQuery = canonicalQuery(query)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+	s.sign(req, body, now().UTC())
+
+	client := s.Client
+	if client == nil {
+		client = defaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if e := parseS3Error(data); e != nil {
+			return nil, fmt.Errorf("%s: %w", resp.Status, e)
+		}
+		return nil, errors.New(resp.Status)
+	}
+	return resp, nil
+}
+
+// s3Error is the error document S3 returns.
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (e *s3Error) Error() string { return e.Code + ": " + e.Message }
+
+// parseS3Error returns the error in an S3 <Error> document, or nil if data
+// is not one.
+func parseS3Error(data []byte) error {
+	var doc struct {
+		XMLName xml.Name
+		s3Error
+	}
+	if xml.Unmarshal(data, &doc) != nil || doc.XMLName.Local != "Error" {
+		return nil
+	}
+	return &doc.s3Error
+}
+
+// ── AWS Signature Version 4 ─────────────────────────────────────────
+
+// sign adds the SigV4 Authorization header for req with the given payload.
+// Every header already on req is signed, plus Host.
+func (s *S3Store) sign(req *http.Request, payload []byte, t time.Time) {
+	amzDate := t.Format("20060102T150405Z")
+	date := amzDate[:8]
+	payloadHash := sha256Hex(payload)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonHeaders strings.Builder
+	for _, k := range names {
+		canonHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonical))
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	for _, part := range []string{s.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.AccessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// canonicalQuery encodes q sorted by key with RFC 3986 escaping, as SigV4
+// requires ("uploads" becomes "uploads=").
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range q[k] {
+			parts = append(parts, uriEscape(k)+"="+uriEscape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEscape percent-encodes everything except RFC 3986 unreserved characters.
+func uriEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,73 @@
+// File: storage.go
+// Purpose: Destinations for finished recordings. Once the recorder closes a
+// file (a whole recording or one segment), the server hands it to a Store,
+// which copies it to local disk or uploads it to S3-compatible object
+// storage.
+//
+// Key Types:
+//   - Store: Put a finished file under a key, returning the object URL
+//   - LocalStore: Copies files into a directory (file://)
+//   - S3Store: Uploads with S3 multipart upload (s3://)
+//
+// Key Functions:
+//   - Open(rawURL): Build the Store selected by the URL scheme
+//
+// URLs:
+//
+//	file:///var/media/archive
+//	s3://bucket/prefix?region=eu-west-1
+//	s3://bucket/prefix?endpoint=http://minio:9000   (path-style, e.g. MinIO)
+//
+// S3 credentials come from the standard AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and optional AWS_SESSION_TOKEN environment variables;
+// the region from the region query parameter, AWS_REGION or
+// AWS_DEFAULT_REGION (default us-east-1).
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// Store saves finished recording files.
+type Store interface {
+	// Put stores size bytes read from r under key (a slash-separated
+	// relative path) and returns the URL of the stored object.
+	Put(ctx context.Context, key string, r io.Reader, size int64) (string, error)
+}
+
+// Open returns the Store for rawURL: file://dir or s3://bucket[/prefix].
+func Open(rawURL string) (Store, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("storage: parse %q: %w", rawURL, err)
+	}
+	switch u.Scheme {
+	case "file":
+		dir := u.Path
+		if u.Host != "" { // file://relative/dir
+			dir = u.Host + u.Path
+		}
+		if dir == "" {
+			return nil, fmt.Errorf("storage: %q has no directory", rawURL)
+		}
+		return &LocalStore{Dir: dir}, nil
+	case "s3":
+		return newS3StoreFromURL(u)
+	default:
+		return nil, fmt.Errorf("storage: unsupported scheme %q (want file:// or s3://)", u.Scheme)
+	}
+}
+
+// joinKey joins a key prefix and a key with exactly one slash.
+func joinKey(prefix, key string) string {
+	prefix = strings.Trim(prefix, "/")
+	key = strings.TrimLeft(key, "/")
+	if prefix == "" {
+		return key
+	}
+	return prefix + "/" + key
+}
@@ -0,0 +1,19 @@
+// Package telemetry records OpenTelemetry-compatible trace spans for the
+// server's connection lifecycle and exports them over OTLP/HTTP (JSON
+// encoding) or to the console.
+//
+// It is a deliberately small tracer rather than the OpenTelemetry SDK, to
+// keep the module free of third-party dependencies: spans carry W3C trace
+// and span IDs, attributes, events and an error status, and are sent to any
+// OTLP collector (OpenTelemetry Collector, Jaeger, Tempo, Honeycomb, ...).
+//
+// Tracing is off unless configured through the standard OTEL_* environment
+// variables, read by FromEnv. A nil *Tracer and a nil *Span are valid and
+// do nothing, so instrumented code needs no checks:
+//
+//	ctx, span := tracer.Start(ctx, "rtmp.connection", telemetry.String("net.peer.addr", addr))
+//	defer span.End()
+//	_, hs := telemetry.Start(ctx, "rtmp.handshake") // child of span
+//	hs.RecordError(err)
+//	hs.End()
+package telemetry
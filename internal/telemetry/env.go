@@ -0,0 +1,153 @@
+package telemetry
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DefaultServiceName is the service.name reported when OTEL_SERVICE_NAME
+// is not set.
+const DefaultServiceName = "go-rtmp"
+
+// defaultOTLPEndpoint is the OTLP/HTTP collector address used when only
+// OTEL_TRACES_EXPORTER=otlp is set.
+const defaultOTLPEndpoint = "http://localhost:4318"
+
+// FromEnv builds a Tracer from the standard OpenTelemetry environment
+// variables. Tracing is enabled by OTEL_TRACES_EXPORTER=otlp or console, or
+// by setting an OTLP endpoint; otherwise (or with OTEL_SDK_DISABLED=true or
+// OTEL_TRACES_EXPORTER=none) FromEnv returns a nil Tracer, which records
+// nothing. Supported variables:
+//
+//	OTEL_TRACES_EXPORTER                otlp | console | none
+//	OTEL_EXPORTER_OTLP_TRACES_ENDPOINT  full traces URL
+//	OTEL_EXPORTER_OTLP_ENDPOINT         base URL; /v1/traces is appended
+//	OTEL_EXPORTER_OTLP_HEADERS          key=value,... sent with each export
+//	OTEL_EXPORTER_OTLP_PROTOCOL         http/json only
+//	OTEL_SERVICE_NAME                   service.name (default "go-rtmp")
+//	OTEL_RESOURCE_ATTRIBUTES            key=value,... resource attributes
+//	OTEL_TRACES_SAMPLER                 always_on | always_off | traceidratio
+//	                                    (parentbased_* accepted as the same)
+//	OTEL_TRACES_SAMPLER_ARG             ratio for traceidratio (0..1)
+//
+// The TRACES_ variants of the endpoint, headers and protocol variables take
+// precedence over the generic ones.
+func FromEnv(log *slog.Logger) (*Tracer, error) {
+	return fromEnv(os.Getenv, log)
+}
+
+func fromEnv(getenv func(string) string, log *slog.Logger) (*Tracer, error) {
+	env := func(names ...string) string {
+		for _, n := range names {
+			if v := strings.TrimSpace(getenv(n)); v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+	if disabled, _ := strconv.ParseBool(env("OTEL_SDK_DISABLED")); disabled {
+		return nil, nil
+	}
+
+	exporter := strings.ToLower(env("OTEL_TRACES_EXPORTER"))
+	tracesEndpoint := env("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	baseEndpoint := env("OTEL_EXPORTER_OTLP_ENDPOINT")
+	if exporter == "" && (tracesEndpoint != "" || baseEndpoint != "") {
+		exporter = "otlp"
+	}
+
+	opts := Options{Logger: log}
+	switch sampler := strings.ToLower(env("OTEL_TRACES_SAMPLER")); sampler {
+	case "", "always_on", "parentbased_always_on":
+	case "always_off", "parentbased_always_off":
+		return nil, nil
+	case "traceidratio", "parentbased_traceidratio":
+		arg := env("OTEL_TRACES_SAMPLER_ARG")
+		ratio, err := strconv.ParseFloat(arg, 64)
+		if arg == "" {
+			ratio, err = 1, nil
+		}
+		if err != nil || ratio < 0 || ratio > 1 {
+			return nil, fmt.Errorf("OTEL_TRACES_SAMPLER_ARG %q: want a ratio between 0 and 1", arg)
+		}
+		if ratio == 0 {
+			return nil, nil
+		}
+		opts.SampleRatio = ratio
+	default:
+		return nil, fmt.Errorf("OTEL_TRACES_SAMPLER %q is not supported", sampler)
+	}
+
+	resource, err := parseKeyValues(env("OTEL_RESOURCE_ATTRIBUTES"))
+	if err != nil {
+		return nil, fmt.Errorf("OTEL_RESOURCE_ATTRIBUTES: %w", err)
+	}
+	service := env("OTEL_SERVICE_NAME")
+	if service == "" {
+		service = resource["service.name"]
+	}
+	if service == "" {
+		service = DefaultServiceName
+	}
+	attrs := []Attribute{String("service.name", service)}
+	for k, v := range resource {
+		if k != "service.name" {
+			attrs = append(attrs, String(k, v))
+		}
+	}
+
+	switch exporter {
+	case "", "none":
+		return nil, nil
+	case "console":
+		return NewTracer(&ConsoleExporter{W: os.Stdout}, opts), nil
+	case "otlp":
+	default:
+		return nil, fmt.Errorf("OTEL_TRACES_EXPORTER %q is not supported (use otlp, console or none)", exporter)
+	}
+
+	if p := env("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", "OTEL_EXPORTER_OTLP_PROTOCOL"); p != "" && p != "http/json" {
+		return nil, fmt.Errorf("OTLP protocol %q is not supported (use http/json)", p)
+	}
+	endpoint := tracesEndpoint
+	if endpoint == "" {
+		base := baseEndpoint
+		if base == "" {
+			base = defaultOTLPEndpoint
+		}
+		endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+	}
+	if u, err := url.Parse(endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("OTLP endpoint %q: want an http:// or https:// URL", endpoint)
+	}
+	headers, err := parseKeyValues(env("OTEL_EXPORTER_OTLP_TRACES_HEADERS", "OTEL_EXPORTER_OTLP_HEADERS"))
+	if err != nil {
+		return nil, fmt.Errorf("OTLP headers: %w", err)
+	}
+	return NewTracer(&OTLPExporter{Endpoint: endpoint, Headers: headers, Resource: attrs}, opts), nil
+}
+
+// parseKeyValues parses the "key1=value1,key2=value2" lists used by the
+// OTEL_* variables. Values may be percent-encoded.
+func parseKeyValues(s string) (map[string]string, error) {
+	out := map[string]string{}
+	if s == "" {
+		return out, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("%q is not key=value", pair)
+		}
+		if dec, err := url.PathUnescape(strings.TrimSpace(v)); err == nil {
+			v = dec
+		}
+		out[k] = strings.TrimSpace(v)
+	}
+	return out, nil
+}
@@ -0,0 +1,216 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ScopeName identifies this instrumentation in exported spans.
+const ScopeName = "github.com/alxayo/go-rtmp"
+
+// OTLPExporter posts spans to an OTLP/HTTP traces endpoint using the JSON
+// encoding (Content-Type application/json).
+type OTLPExporter struct {
+	Endpoint string            // e.g. "http://localhost:4318/v1/traces"
+	Headers  map[string]string // extra request headers, e.g. an API key
+	Resource []Attribute       // describes this process (service.name, ...)
+	Client   *http.Client      // default http.DefaultClient
+}
+
+// Export sends spans in one request. A non-2xx response is an error.
+func (e *OTLPExporter) Export(ctx context.Context, spans []SpanData) error {
+	body, err := json.Marshal(otlpRequest(e.Resource, spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+	client := e.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("otlp export: %s returned %s", e.Endpoint, resp.Status)
+	}
+	return nil
+}
+
+// ConsoleExporter writes each span as one line of JSON, for trying tracing
+// out without a collector.
+type ConsoleExporter struct {
+	W io.Writer
+
+	mu sync.Mutex
+}
+
+// Export writes spans to W.
+func (e *ConsoleExporter) Export(_ context.Context, spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	enc := json.NewEncoder(e.W)
+	for _, s := range spans {
+		attrs := make(map[string]interface{}, len(s.Attrs))
+		for _, a := range s.Attrs {
+			attrs[a.Key] = a.Value
+		}
+		line := map[string]interface{}{
+			"trace_id":    hex.EncodeToString(s.TraceID[:]),
+			"span_id":     hex.EncodeToString(s.SpanID[:]),
+			"name":        s.Name,
+			"start":       s.Start.UTC().Format(time.RFC3339Nano),
+			"duration_ms": float64(s.End.Sub(s.Start).Microseconds()) / 1000,
+		}
+		if s.ParentID != ([8]byte{}) {
+			line["parent_id"] = hex.EncodeToString(s.ParentID[:])
+		}
+		if len(attrs) > 0 {
+			line["attributes"] = attrs
+		}
+		if len(s.Events) > 0 {
+			events := make([]string, len(s.Events))
+			for i, ev := range s.Events {
+				events[i] = ev.Name
+			}
+			line["events"] = events
+		}
+		if s.Err != "" {
+			line["error"] = s.Err
+		}
+		if err := enc.Encode(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OTLP JSON encoding (opentelemetry-proto, ExportTraceServiceRequest). IDs
+// are hex strings and 64-bit integers are decimal strings.
+type (
+	otlpTraces struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes,omitempty"`
+	}
+	otlpScopeSpans struct {
+		Scope struct {
+			Name string `json:"name"`
+		} `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		Name              string         `json:"name"`
+		Kind              int            `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Events            []otlpEvent    `json:"events,omitempty"`
+		Status            *otlpStatus    `json:"status,omitempty"`
+	}
+	otlpEvent struct {
+		TimeUnixNano string         `json:"timeUnixNano"`
+		Name         string         `json:"name"`
+		Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code"` // 2 = error
+		Message string `json:"message,omitempty"`
+	}
+	otlpKeyValue struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+	}
+)
+
+func otlpRequest(resource []Attribute, spans []SpanData) otlpTraces {
+	scope := otlpScopeSpans{Spans: make([]otlpSpan, len(spans))}
+	scope.Scope.Name = ScopeName
+	for i, s := range spans {
+		out := otlpSpan{
+			TraceID:           hex.EncodeToString(s.TraceID[:]),
+			SpanID:            hex.EncodeToString(s.SpanID[:]),
+			Name:              s.Name,
+			Kind:              int(s.Kind),
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.Attrs),
+		}
+		if s.ParentID != ([8]byte{}) {
+			out.ParentSpanID = hex.EncodeToString(s.ParentID[:])
+		}
+		for _, ev := range s.Events {
+			out.Events = append(out.Events, otlpEvent{
+				TimeUnixNano: strconv.FormatInt(ev.Time.UnixNano(), 10),
+				Name:         ev.Name,
+				Attributes:   otlpAttributes(ev.Attrs),
+			})
+		}
+		if s.Err != "" {
+			out.Status = &otlpStatus{Code: 2, Message: s.Err}
+		}
+		scope.Spans[i] = out
+	}
+	return otlpTraces{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: otlpAttributes(resource)},
+		ScopeSpans: []otlpScopeSpans{scope},
+	}}}
+}
+
+func otlpAttributes(attrs []Attribute) []otlpKeyValue {
+	if len(attrs) == 0 {
+		return nil
+	}
+	out := make([]otlpKeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		var v otlpValue
+		switch x := a.Value.(type) {
+		case string:
+			v.StringValue = &x
+		case int64:
+			s := strconv.FormatInt(x, 10)
+			v.IntValue = &s
+		case float64:
+			v.DoubleValue = &x
+		case bool:
+			v.BoolValue = &x
+		default:
+			s := fmt.Sprint(x)
+			v.StringValue = &s
+		}
+		out = append(out, otlpKeyValue{Key: a.Key, Value: v})
+	}
+	return out
+}
@@ -0,0 +1,195 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+// SpanKind says which side of a request a span represents, as in OTLP.
+type SpanKind int
+
+const (
+	KindInternal SpanKind = 1 // work inside the server (default)
+	KindServer   SpanKind = 2 // handling a request from a remote peer
+	KindClient   SpanKind = 3 // a request to a remote peer
+)
+
+// Attribute is a key/value pair on a span or event. Value is a string,
+// int64, float64 or bool.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// String returns a string attribute.
+func String(key, v string) Attribute { return Attribute{Key: key, Value: v} }
+
+// Int returns an integer attribute.
+func Int(key string, v int64) Attribute { return Attribute{Key: key, Value: v} }
+
+// Float returns a floating-point attribute.
+func Float(key string, v float64) Attribute { return Attribute{Key: key, Value: v} }
+
+// Bool returns a boolean attribute.
+func Bool(key string, v bool) Attribute { return Attribute{Key: key, Value: v} }
+
+// Event is a timestamped annotation on a span.
+type Event struct {
+	Name  string
+	Time  time.Time
+	Attrs []Attribute
+}
+
+// SpanData is a finished span as handed to an Exporter.
+type SpanData struct {
+	TraceID  [16]byte
+	SpanID   [8]byte
+	ParentID [8]byte // zero for a root span
+	Name     string
+	Kind     SpanKind
+	Start    time.Time
+	End      time.Time
+	Attrs    []Attribute
+	Events   []Event
+	Err      string // status message; non-empty marks the span as failed
+}
+
+// Span is an operation being timed. All methods are safe for concurrent use
+// and do nothing on a nil Span, which is what Start returns when tracing is
+// off or the trace was not sampled.
+type Span struct {
+	tracer *Tracer
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+// SetAttributes adds attributes to the span, replacing any with the same key.
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+	for _, a := range attrs {
+		replaced := false
+		for i := range s.data.Attrs {
+			if s.data.Attrs[i].Key == a.Key {
+				s.data.Attrs[i] = a
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			s.data.Attrs = append(s.data.Attrs, a)
+		}
+	}
+}
+
+// SetKind sets the span kind (KindInternal by default).
+func (s *Span) SetKind(k SpanKind) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.data.Kind = k
+	s.mu.Unlock()
+}
+
+// AddEvent records a named point in time within the span.
+func (s *Span) AddEvent(name string, attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ended {
+		s.data.Events = append(s.data.Events, Event{Name: name, Time: time.Now(), Attrs: attrs})
+	}
+}
+
+// RecordError marks the span as failed with err. A nil err is ignored.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ended {
+		s.data.Err = err.Error()
+	}
+}
+
+// End finishes the span and queues it for export. Later calls do nothing.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+	s.tracer.enqueue(data)
+}
+
+// spanKey is the context key for the current span.
+type spanKey struct{}
+
+// unsampledKey marks a context whose trace was not sampled, so children of
+// a dropped root are dropped too instead of starting traces of their own.
+type unsampledKey struct{}
+
+// SpanFromContext returns the span in ctx, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// ContextWithSpan returns ctx with span as its current span.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// Start starts a child of the span in ctx, using that span's tracer. It
+// returns ctx and a nil span when ctx holds no span, so code below the
+// point where a trace begins is traced only when that trace is.
+func Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	return parent.tracer.start(ctx, parent, name, attrs)
+}
+
+// newID fills b with random bytes, never all zero (an invalid ID in OTLP).
+func newID(b []byte) {
+	for {
+		_, _ = rand.Read(b)
+		for _, c := range b {
+			if c != 0 {
+				return
+			}
+		}
+	}
+}
+
+// traceIDBound maps the low 8 bytes of a trace ID to [0, 1) for ratio
+// sampling, so every server sampling the same trace decides alike.
+func traceIDBound(id [16]byte) float64 {
+	return float64(binary.BigEndian.Uint64(id[8:])>>11) / (1 << 53)
+}
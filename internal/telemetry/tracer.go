@@ -0,0 +1,194 @@
+package telemetry
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Batching defaults: finished spans wait in a bounded queue and are exported
+// in batches, so the media path never blocks on the collector.
+const (
+	DefaultQueueSize     = 2048
+	DefaultBatchSize     = 512
+	DefaultBatchInterval = 5 * time.Second
+	DefaultExportTimeout = 10 * time.Second
+)
+
+// Exporter sends finished spans somewhere. Export is called from a single
+// goroutine.
+type Exporter interface {
+	Export(ctx context.Context, spans []SpanData) error
+}
+
+// Options configures a Tracer. Zero values select the defaults.
+type Options struct {
+	// SampleRatio is the fraction of new traces recorded (0 < r ≤ 1; 0 means
+	// 1). Children always follow their root's decision.
+	SampleRatio   float64
+	QueueSize     int           // finished spans held for export (default DefaultQueueSize)
+	BatchSize     int           // spans per export call (default DefaultBatchSize)
+	BatchInterval time.Duration // longest a span waits for its batch (default DefaultBatchInterval)
+	Logger        *slog.Logger  // export failures (default slog.Default())
+}
+
+// Tracer starts spans and exports them in the background. A nil Tracer is
+// valid and records nothing.
+type Tracer struct {
+	exp   Exporter
+	opts  Options
+	log   *slog.Logger
+	queue chan SpanData
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+	dropped  atomic.Uint64
+}
+
+// NewTracer returns a Tracer exporting to exp and starts its export loop.
+// Call Shutdown to flush and stop it.
+func NewTracer(exp Exporter, opts Options) *Tracer {
+	if opts.SampleRatio <= 0 || opts.SampleRatio > 1 {
+		opts.SampleRatio = 1
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultQueueSize
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.BatchInterval <= 0 {
+		opts.BatchInterval = DefaultBatchInterval
+	}
+	log := opts.Logger
+	if log == nil {
+		log = slog.Default()
+	}
+	t := &Tracer{
+		exp:   exp,
+		opts:  opts,
+		log:   log.With("component", "telemetry"),
+		queue: make(chan SpanData, opts.QueueSize),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go t.loop()
+	return t
+}
+
+// Start starts a span named name. It is a child of the span in ctx if there
+// is one, and otherwise the root of a new trace, subject to sampling. The
+// returned context carries the new span. Start on a nil Tracer returns ctx
+// and a nil span.
+func (t *Tracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if ctx.Value(unsampledKey{}) != nil {
+		return ctx, nil
+	}
+	return t.start(ctx, SpanFromContext(ctx), name, attrs)
+}
+
+func (t *Tracer) start(ctx context.Context, parent *Span, name string, attrs []Attribute) (context.Context, *Span) {
+	s := &Span{tracer: t}
+	s.data.Name = name
+	s.data.Kind = KindInternal
+	s.data.Start = time.Now()
+	s.data.Attrs = append([]Attribute(nil), attrs...)
+	if parent != nil {
+		s.data.TraceID = parent.data.TraceID // immutable after start
+		s.data.ParentID = parent.data.SpanID
+	} else {
+		newID(s.data.TraceID[:])
+		if t.opts.SampleRatio < 1 && traceIDBound(s.data.TraceID) >= t.opts.SampleRatio {
+			return context.WithValue(ctx, unsampledKey{}, true), nil
+		}
+	}
+	newID(s.data.SpanID[:])
+	return ContextWithSpan(ctx, s), s
+}
+
+// Dropped returns how many finished spans were discarded because the
+// export queue was full.
+func (t *Tracer) Dropped() uint64 {
+	if t == nil {
+		return 0
+	}
+	return t.dropped.Load()
+}
+
+// enqueue queues a finished span without blocking.
+func (t *Tracer) enqueue(d SpanData) {
+	select {
+	case t.queue <- d:
+	default:
+		t.dropped.Add(1)
+	}
+}
+
+// loop exports queued spans when a batch fills up or the interval passes,
+// and drains the queue on Shutdown.
+func (t *Tracer) loop() {
+	defer close(t.done)
+	ticker := time.NewTicker(t.opts.BatchInterval)
+	defer ticker.Stop()
+	batch := make([]SpanData, 0, t.opts.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultExportTimeout)
+		if err := t.exp.Export(ctx, batch); err != nil {
+			t.log.Warn("span export failed", "spans", len(batch), "error", err)
+		}
+		cancel()
+		batch = make([]SpanData, 0, t.opts.BatchSize)
+	}
+	for {
+		select {
+		case d := <-t.queue:
+			batch = append(batch, d)
+			if len(batch) >= t.opts.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-t.stop:
+			for {
+				select {
+				case d := <-t.queue:
+					batch = append(batch, d)
+					if len(batch) >= t.opts.BatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// Shutdown exports the spans already finished and stops the export loop.
+// Spans ending afterwards are discarded. It returns ctx.Err() if ctx ends
+// before the final export completes.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	t.stopOnce.Do(func() { close(t.stop) })
+	select {
+	case <-t.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
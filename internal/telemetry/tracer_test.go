@@ -0,0 +1,209 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memExporter collects exported spans.
+type memExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (e *memExporter) Export(_ context.Context, spans []SpanData) error {
+	e.mu.Lock()
+	e.spans = append(e.spans, spans...)
+	e.mu.Unlock()
+	return nil
+}
+
+func TestTracer_ParentChild(t *testing.T) {
+	exp := &memExporter{}
+	tr := NewTracer(exp, Options{})
+	ctx, root := tr.Start(context.Background(), "rtmp.connection", String("net.peer.addr", "10.0.0.1:5000"))
+	root.SetKind(KindServer)
+	_, child := Start(ctx, "rtmp.handshake")
+	child.RecordError(errors.New("bad version"))
+	child.AddEvent("c0 read")
+	child.End()
+	root.SetAttributes(String("rtmp.app", "live"))
+	root.End()
+	root.End() // second End is ignored
+	if err := tr.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	if len(exp.spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(exp.spans))
+	}
+	hs, conn := exp.spans[0], exp.spans[1]
+	if hs.Name != "rtmp.handshake" || conn.Name != "rtmp.connection" {
+		t.Fatalf("spans = %q, %q", hs.Name, conn.Name)
+	}
+	if hs.TraceID != conn.TraceID || hs.ParentID != conn.SpanID || conn.ParentID != ([8]byte{}) {
+		t.Fatal("handshake span is not a child of the connection span")
+	}
+	if hs.Err != "bad version" || len(hs.Events) != 1 || conn.Kind != KindServer || len(conn.Attrs) != 2 {
+		t.Fatalf("handshake = %+v, connection = %+v", hs, conn)
+	}
+}
+
+func TestTracer_NilAndUnsampled(t *testing.T) {
+	var tr *Tracer
+	ctx, span := tr.Start(context.Background(), "x")
+	span.SetAttributes(Int("n", 1))
+	span.RecordError(errors.New("e"))
+	span.End()
+	if _, child := Start(ctx, "y"); child != nil {
+		t.Fatal("child of a nil tracer's context was recorded")
+	}
+	if err := tr.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := &memExporter{}
+	tr = NewTracer(exp, Options{SampleRatio: 1e-9})
+	for i := 0; i < 20; i++ {
+		ctx, root := tr.Start(context.Background(), "root")
+		_, child := tr.Start(ctx, "child")
+		if root != nil || child != nil {
+			t.Fatal("trace sampled at a ratio of 1e-9")
+		}
+	}
+	_ = tr.Shutdown(context.Background())
+	if len(exp.spans) != 0 {
+		t.Fatalf("exported %d unsampled spans", len(exp.spans))
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var body []byte
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	tr, err := fromEnv(mapEnv(map[string]string{
+		"OTEL_EXPORTER_OTLP_ENDPOINT": srv.URL,
+		"OTEL_EXPORTER_OTLP_HEADERS":  "x-api-key=secret%3D1",
+		"OTEL_SERVICE_NAME":           "edge-1",
+	}), nil)
+	if err != nil || tr == nil {
+		t.Fatalf("fromEnv: %v, %v", tr, err)
+	}
+	_, span := tr.Start(context.Background(), "rtmp.publish", String("rtmp.stream_key", "live/cam1"), Int("rtmp.stream_id", 1), Bool("ok", false))
+	span.RecordError(errors.New("denied"))
+	span.End()
+	if err := tr.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	if header.Get("Content-Type") != "application/json" || header.Get("X-Api-Key") != "secret=1" {
+		t.Fatalf("headers = %v", header)
+	}
+	var req struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []struct {
+					Key   string
+					Value map[string]interface{}
+				}
+			}
+			ScopeSpans []struct {
+				Spans []struct {
+					TraceID           string
+					SpanID            string
+					Name              string
+					StartTimeUnixNano string
+					Attributes        []struct {
+						Key   string
+						Value map[string]interface{}
+					}
+					Status struct {
+						Code    int
+						Message string
+					}
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		t.Fatalf("body %s: %v", body, err)
+	}
+	rs := req.ResourceSpans[0]
+	if rs.Resource.Attributes[0].Key != "service.name" || rs.Resource.Attributes[0].Value["stringValue"] != "edge-1" {
+		t.Fatalf("resource = %+v", rs.Resource)
+	}
+	s := rs.ScopeSpans[0].Spans[0]
+	if s.Name != "rtmp.publish" || len(s.TraceID) != 32 || len(s.SpanID) != 16 || s.StartTimeUnixNano == "" {
+		t.Fatalf("span = %+v", s)
+	}
+	if s.Attributes[1].Value["intValue"] != "1" || s.Attributes[2].Value["boolValue"] != false {
+		t.Fatalf("attributes = %+v", s.Attributes)
+	}
+	if s.Status.Code != 2 || s.Status.Message != "denied" {
+		t.Fatalf("status = %+v", s.Status)
+	}
+}
+
+func TestConsoleExporter(t *testing.T) {
+	var buf bytes.Buffer
+	start := time.Now()
+	err := (&ConsoleExporter{W: &buf}).Export(context.Background(), []SpanData{{
+		Name: "rtmp.golive", Start: start, End: start.Add(1500 * time.Millisecond),
+		Attrs: []Attribute{String("rtmp.stream_key", "live/cam1")},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); !strings.Contains(out, `"duration_ms":1500`) || !strings.Contains(out, `"rtmp.stream_key":"live/cam1"`) {
+		t.Fatalf("output = %s", out)
+	}
+}
+
+func mapEnv(m map[string]string) func(string) string {
+	return func(k string) string { return m[k] }
+}
+
+func TestFromEnv(t *testing.T) {
+	cases := []struct {
+		name    string
+		env     map[string]string
+		enabled bool
+		wantErr bool
+	}{
+		{"unset", nil, false, false},
+		{"console", map[string]string{"OTEL_TRACES_EXPORTER": "console"}, true, false},
+		{"otlp default endpoint", map[string]string{"OTEL_TRACES_EXPORTER": "otlp"}, true, false},
+		{"endpoint only", map[string]string{"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "https://otel.example.com/v1/traces"}, true, false},
+		{"none", map[string]string{"OTEL_TRACES_EXPORTER": "none", "OTEL_EXPORTER_OTLP_ENDPOINT": "http://c:4318"}, false, false},
+		{"sdk disabled", map[string]string{"OTEL_SDK_DISABLED": "true", "OTEL_TRACES_EXPORTER": "otlp"}, false, false},
+		{"always_off", map[string]string{"OTEL_TRACES_EXPORTER": "otlp", "OTEL_TRACES_SAMPLER": "always_off"}, false, false},
+		{"ratio", map[string]string{"OTEL_TRACES_EXPORTER": "otlp", "OTEL_TRACES_SAMPLER": "traceidratio", "OTEL_TRACES_SAMPLER_ARG": "0.1"}, true, false},
+		{"bad ratio", map[string]string{"OTEL_TRACES_EXPORTER": "otlp", "OTEL_TRACES_SAMPLER": "traceidratio", "OTEL_TRACES_SAMPLER_ARG": "2"}, false, true},
+		{"grpc", map[string]string{"OTEL_TRACES_EXPORTER": "otlp", "OTEL_EXPORTER_OTLP_PROTOCOL": "grpc"}, false, true},
+		{"zipkin", map[string]string{"OTEL_TRACES_EXPORTER": "zipkin"}, false, true},
+		{"bad endpoint", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "localhost:4318"}, false, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tr, err := fromEnv(mapEnv(tc.env), nil)
+			defer tr.Shutdown(context.Background())
+			if (err != nil) != tc.wantErr || (tr != nil) != tc.enabled {
+				t.Fatalf("fromEnv = %v, %v; want enabled=%v err=%v", tr, err, tc.enabled, tc.wantErr)
+			}
+		})
+	}
+}
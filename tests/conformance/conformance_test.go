@@ -0,0 +1,107 @@
+// Package conformance – protocol conformance tests replaying golden
+// encoder sessions against the server.
+//
+// Every directory under testdata is one session: client.bin holds what an
+// encoder or player sends (C0+C1, C2 and its chunk stream, byte for byte)
+// and responses.golden the transcript of the exchange, one line per
+// message, the client's prefixed "> " and the server's "< ". The harness
+// sends the capture one message at a time, with the chunking, chunk
+// stream IDs and chunk size changes of the original, collects what the
+// server answers each command and compares the transcript with the golden.
+//
+//	TestConformance – every session replays to its golden transcript.
+//
+// Run with -update to rewrite the goldens after an intended change, and
+// review the diff: a changed line is a change every such client sees.
+package conformance
+
+import (
+	"flag"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alxayo/go-rtmp/internal/logger"
+	"github.com/alxayo/go-rtmp/internal/rtmp/server"
+)
+
+var update = flag.Bool("update", false, "rewrite the responses.golden files")
+
+const goldenHeader = "# Transcript of client.bin replayed against the server; regenerate with go test ./tests/conformance -update"
+
+func TestConformance(t *testing.T) {
+	logger.UseWriter(io.Discard)
+	dirs, err := filepath.Glob(filepath.Join("testdata", "*", "client.bin"))
+	if err != nil || len(dirs) == 0 {
+		t.Fatalf("no sessions under testdata (%v)", err)
+	}
+	for _, path := range dirs {
+		dir := filepath.Dir(path)
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			t.Parallel()
+			replaySession(t, dir)
+		})
+	}
+}
+
+// replaySession replays dir/client.bin against a fresh server and checks
+// (or, with -update, rewrites) dir/responses.golden.
+func replaySession(t *testing.T, dir string) {
+	data, err := os.ReadFile(filepath.Join(dir, "client.bin"))
+	if err != nil {
+		t.Fatalf("read capture: %v", err)
+	}
+	c, err := parseCapture(data)
+	if err != nil {
+		t.Fatalf("parse capture: %v", err)
+	}
+	goldenPath := filepath.Join(dir, "responses.golden")
+	var golden []string
+	var want []int
+	if !*update {
+		b, err := os.ReadFile(goldenPath)
+		if err != nil {
+			t.Fatalf("read golden (run with -update to create it): %v", err)
+		}
+		golden = strings.Split(strings.TrimRight(string(b), "\n"), "\n")
+		want = expectedCounts(golden)
+	}
+
+	srv := server.New(server.Config{ListenAddr: "127.0.0.1:0"})
+	if err := srv.Start(); err != nil {
+		t.Fatalf("start server: %v", err)
+	}
+	defer srv.Stop()
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	out, err := run(conn, c, want)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	got := append([]string{goldenHeader}, out...)
+
+	if *update {
+		if err := os.WriteFile(goldenPath, []byte(strings.Join(got, "\n")+"\n"), 0o644); err != nil {
+			t.Fatalf("write golden: %v", err)
+		}
+		return
+	}
+	for i := 0; i < len(got) || i < len(golden); i++ {
+		var g, w string
+		if i < len(got) {
+			g = got[i]
+		}
+		if i < len(golden) {
+			w = golden[i]
+		}
+		if g != w {
+			t.Fatalf("transcript differs at line %d:\n got: %s\nwant: %s\n\nfull transcript:\n%s",
+				i+1, g, w, strings.Join(got, "\n"))
+		}
+	}
+}
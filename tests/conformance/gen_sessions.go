@@ -0,0 +1,322 @@
+//go:build ignore
+
+// Generates the client byte captures of the conformance sessions.
+// Run: go run ./tests/conformance/gen_sessions.go
+//
+// Each session is written to testdata/<name>/client.bin: C0+C1, C2, then
+// the client's chunk stream exactly as the encoder puts it on the wire
+// (chunk stream IDs, transaction IDs, chunk size changes, AMF key order,
+// the @setDataFrame layout and the FLV tag payloads). The bytes are
+// deterministic so a regenerated file diffs clean.
+//
+// The sessions reconstruct the wire layout of each encoder; a capture
+// taken from a real session (see README.md) drops in the same way.
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+)
+
+// kv is one property of an AMF0 object or ECMA array, which the encoders
+// write in their own order rather than sorted.
+type kv struct {
+	k string
+	v interface{}
+}
+
+// object and ecma are AMF0 objects and ECMA arrays with ordered keys.
+type (
+	object []kv
+	ecma   []kv
+)
+
+func must(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
+// encode writes the AMF0 encoding of values.
+func encode(values ...interface{}) []byte {
+	var buf bytes.Buffer
+	for _, v := range values {
+		switch vv := v.(type) {
+		case object:
+			buf.WriteByte(0x03)
+			writeProps(&buf, vv)
+		case ecma:
+			buf.WriteByte(0x08)
+			binary.Write(&buf, binary.BigEndian, uint32(len(vv)))
+			writeProps(&buf, vv)
+		default:
+			must(amf.EncodeValue(&buf, v))
+		}
+	}
+	return buf.Bytes()
+}
+
+func writeProps(buf *bytes.Buffer, props []kv) {
+	for _, p := range props {
+		binary.Write(buf, binary.BigEndian, uint16(len(p.k)))
+		buf.WriteString(p.k)
+		buf.Write(encode(p.v))
+	}
+	buf.Write([]byte{0x00, 0x00, 0x09})
+}
+
+// session builds one client capture.
+type session struct {
+	buf bytes.Buffer
+	w   *chunk.Writer
+}
+
+// newSession starts a capture with the handshake: C0, C1 with the given
+// version field (zero for the plain handshake) and C2 echoing an S1 the
+// server never sees (the server only warns about it).
+func newSession(version [4]byte, seed int) *session {
+	s := &session{}
+	s.buf.WriteByte(0x03)
+	c1 := make([]byte, 1536)
+	copy(c1[4:8], version[:])
+	for i := 8; i < len(c1); i++ {
+		c1[i] = byte((i*seed + 7) & 0xFF)
+	}
+	s.buf.Write(c1)
+	c2 := make([]byte, 1536)
+	for i := 8; i < len(c2); i++ {
+		c2[i] = byte((i*13 + 11) & 0xFF)
+	}
+	s.buf.Write(c2)
+	s.w = chunk.NewWriter(&s.buf, 128)
+	return s
+}
+
+func (s *session) send(csid uint32, typeID uint8, ts, msid uint32, payload []byte) {
+	must(s.w.WriteMessage(&chunk.Message{
+		CSID:            csid,
+		TypeID:          typeID,
+		Timestamp:       ts,
+		MessageStreamID: msid,
+		MessageLength:   uint32(len(payload)),
+		Payload:         payload,
+	}))
+}
+
+func (s *session) command(csid, msid uint32, values ...interface{}) {
+	s.send(csid, 20, 0, msid, encode(values...))
+}
+
+func (s *session) setChunkSize(size uint32) {
+	p := make([]byte, 4)
+	binary.BigEndian.PutUint32(p, size)
+	s.send(2, 1, 0, 0, p)
+	s.w.SetChunkSize(size)
+}
+
+func (s *session) windowAckSize(size uint32) {
+	p := make([]byte, 4)
+	binary.BigEndian.PutUint32(p, size)
+	s.send(2, 5, 0, 0, p)
+}
+
+func (s *session) setBufferLength(msid, ms uint32) {
+	p := make([]byte, 10)
+	binary.BigEndian.PutUint16(p, 3)
+	binary.BigEndian.PutUint32(p[2:], msid)
+	binary.BigEndian.PutUint32(p[6:], ms)
+	s.send(2, 4, 0, 0, p)
+}
+
+func (s *session) save(name string) {
+	dir := filepath.Join("tests", "conformance", "testdata", name)
+	must(os.MkdirAll(dir, 0o755))
+	path := filepath.Join(dir, "client.bin")
+	must(os.WriteFile(path, s.buf.Bytes(), 0o644))
+	fmt.Printf("wrote %s (%d bytes)\n", path, s.buf.Len())
+}
+
+// Media of the publish sessions: H.264 high profile and AAC-LC
+// configurations, then a keyframe, inter frames and raw AAC frames
+// interleaved by timestamp as an FLV muxer emits them.
+var (
+	avcSequenceHeader = []byte{0x17, 0x00, 0x00, 0x00, 0x00,
+		0x01, 0x64, 0x00, 0x1F, 0xFF, 0xE1, 0x00, 0x0C,
+		0x67, 0x64, 0x00, 0x1F, 0xAC, 0xD9, 0x40, 0x50, 0x05, 0xBB, 0x01, 0x10,
+		0x01, 0x00, 0x04, 0x68, 0xEB, 0xE3, 0xCB}
+	aacSequenceHeader = []byte{0xAF, 0x00, 0x12, 0x10}
+)
+
+func avcFrame(key bool, n int) []byte {
+	tag := byte(0x27)
+	nal := byte(0x41)
+	if key {
+		tag, nal = 0x17, 0x65
+	}
+	p := []byte{tag, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, nal}
+	for i := 0; i < n; i++ {
+		p = append(p, byte(i*31+int(nal)))
+	}
+	binary.BigEndian.PutUint32(p[5:9], uint32(n+1))
+	return p
+}
+
+func aacFrame(i int) []byte {
+	p := []byte{0xAF, 0x01}
+	for j := 0; j < 24; j++ {
+		p = append(p, byte(i+j*17))
+	}
+	return p
+}
+
+// media sends the sequence headers and 200 ms of audio and video: video
+// at 25 fps with a 300-byte keyframe (several chunks at the default chunk
+// size) and AAC at 23 ms per frame.
+func (s *session) media(audioCSID, videoCSID, msid uint32) {
+	s.send(videoCSID, 9, 0, msid, avcSequenceHeader)
+	s.send(audioCSID, 8, 0, msid, aacSequenceHeader)
+	v, a := 0, 0
+	for v < 5 || a < 8 {
+		vts, ats := uint32(v*40), uint32(a*23)
+		if v < 5 && (a >= 8 || vts <= ats) {
+			size := 60
+			if v == 0 {
+				size = 300
+			}
+			s.send(videoCSID, 9, vts, msid, avcFrame(v == 0, size))
+			v++
+			continue
+		}
+		s.send(audioCSID, 8, ats, msid, aacFrame(a))
+		a++
+	}
+}
+
+func metadata(encoder string) []byte {
+	return encode("@setDataFrame", "onMetaData", ecma{
+		{"duration", 0.0},
+		{"width", 1280.0},
+		{"height", 720.0},
+		{"videodatarate", 2500.0},
+		{"framerate", 25.0},
+		{"videocodecid", 7.0},
+		{"audiodatarate", 128.0},
+		{"audiosamplerate", 44100.0},
+		{"audiosamplesize", 16.0},
+		{"stereo", true},
+		{"audiocodecid", 10.0},
+		{"encoder", encoder},
+		{"filesize", 0.0},
+	})
+}
+
+// obsPublish is OBS Studio (its librtmp fork): everything after connect
+// on chunk stream 3 or 4, chunk size 4096 right after connect, media and
+// metadata on the publish chunk stream.
+func obsPublish() {
+	s := newSession([4]byte{}, 5)
+	s.command(3, 0, "connect", 1.0, object{
+		{"app", "live"},
+		{"type", "nonprivate"},
+		{"flashVer", "FMLE/3.0 (compatible; FMSc/1.0)"},
+		{"swfUrl", "rtmp://127.0.0.1:1935/live"},
+		{"tcUrl", "rtmp://127.0.0.1:1935/live"},
+	})
+	s.setChunkSize(4096)
+	s.command(3, 0, "releaseStream", 2.0, nil, "obs")
+	s.command(3, 0, "FCPublish", 3.0, nil, "obs")
+	s.command(3, 0, "createStream", 4.0, nil)
+	s.command(4, 1, "publish", 5.0, nil, "obs", "live")
+	s.send(4, 18, 0, 1, metadata("obs-output module (libobs version 30.2.0)"))
+	s.media(4, 4, 1)
+	s.command(3, 0, "FCUnpublish", 6.0, nil, "obs")
+	s.command(3, 0, "deleteStream", 7.0, nil, 1.0)
+	s.save("obs_publish")
+}
+
+// ffmpegPublish is FFmpeg's rtmp protocol: connect and the stream
+// commands on chunk stream 3, publish on 8, audio on 4, video on 6 and
+// data on 3, chunk size 4096 set on chunk stream 2 after connect.
+func ffmpegPublish() {
+	s := newSession([4]byte{9, 0, 124, 2}, 3)
+	s.command(3, 0, "connect", 1.0, object{
+		{"app", "live"},
+		{"type", "nonprivate"},
+		{"flashVer", "FMLE/3.0 (compatible; Lavf61.7.100)"},
+		{"tcUrl", "rtmp://127.0.0.1:1935/live"},
+	})
+	s.windowAckSize(2500000)
+	s.setChunkSize(4096)
+	s.command(3, 0, "releaseStream", 2.0, nil, "ffmpeg")
+	s.command(3, 0, "FCPublish", 3.0, nil, "ffmpeg")
+	s.command(3, 0, "createStream", 4.0, nil)
+	s.command(8, 1, "publish", 5.0, nil, "ffmpeg", "live")
+	s.send(3, 18, 0, 1, metadata("Lavf61.7.100"))
+	s.media(4, 6, 1)
+	s.command(3, 0, "FCUnpublish", 6.0, nil, "ffmpeg")
+	s.command(3, 0, "deleteStream", 7.0, nil, 1.0)
+	s.save("ffmpeg_publish")
+}
+
+// wirecastPublish is an FMLE-style encoder (Wirecast) that keeps the
+// default chunk size, numbers publish 0 and injects onFI timecodes.
+func wirecastPublish() {
+	s := newSession([4]byte{}, 11)
+	s.command(3, 0, "connect", 1.0, object{
+		{"app", "live"},
+		{"flashVer", "FMLE/3.0 (compatible; Wirecast/15.3)"},
+		{"swfUrl", "rtmp://127.0.0.1:1935/live"},
+		{"tcUrl", "rtmp://127.0.0.1:1935/live"},
+		{"type", "nonprivate"},
+	})
+	s.command(3, 0, "releaseStream", 2.0, nil, "wirecast")
+	s.command(3, 0, "FCPublish", 3.0, nil, "wirecast")
+	s.command(3, 0, "createStream", 4.0, nil)
+	s.command(4, 1, "publish", 0.0, nil, "wirecast", "live")
+	s.send(4, 18, 0, 1, metadata("Wirecast/15.3"))
+	s.send(4, 18, 0, 1, encode("onFI", ecma{
+		{"sd", "17-10-2026"},
+		{"st", "10:00:00.000"},
+		{"tc", "10:00:00:00"},
+	}))
+	s.media(4, 4, 1)
+	s.command(3, 0, "FCUnpublish", 5.0, nil, "wirecast")
+	s.command(3, 0, "deleteStream", 6.0, nil, 1.0)
+	s.save("wirecast_publish")
+}
+
+// ffplayPlayMissing is ffplay (FFmpeg as a player) playing a stream
+// nobody publishes: the player connect object, createStream, play on
+// chunk stream 8 and the buffer length, expecting StreamNotFound.
+func ffplayPlayMissing() {
+	s := newSession([4]byte{9, 0, 124, 2}, 7)
+	s.command(3, 0, "connect", 1.0, object{
+		{"app", "live"},
+		{"flashVer", "LNX 9,0,124,2"},
+		{"tcUrl", "rtmp://127.0.0.1:1935/live"},
+		{"fpad", false},
+		{"capabilities", 15.0},
+		{"audioCodecs", 4071.0},
+		{"videoCodecs", 252.0},
+		{"videoFunction", 1.0},
+	})
+	s.windowAckSize(2500000)
+	s.command(3, 0, "createStream", 2.0, nil)
+	s.command(8, 1, "play", 3.0, nil, "missing", -2000.0)
+	s.setBufferLength(1, 3000)
+	s.command(3, 0, "deleteStream", 4.0, nil, 1.0)
+	s.save("ffplay_play_missing")
+}
+
+func main() {
+	obsPublish()
+	ffmpegPublish()
+	wirecastPublish()
+	ffplayPlayMissing()
+}
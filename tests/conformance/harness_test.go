@@ -0,0 +1,255 @@
+package conformance
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
+	"github.com/alxayo/go-rtmp/internal/rtmp/chunk"
+)
+
+const (
+	handshakeSize = 1536
+	// responseTimeout bounds the wait for the responses a golden expects.
+	responseTimeout = 5 * time.Second
+	// quietCheck is how long the server must stay silent after sending the
+	// expected responses; anything it sends in that window is extra.
+	quietCheck = 50 * time.Millisecond
+	// quietUpdate ends the collection of a command's responses when
+	// rewriting a golden, which has no count to wait for.
+	quietUpdate = 300 * time.Millisecond
+)
+
+// step is one message of a client capture: the exact bytes that carry it
+// (its chunks, as the encoder split them) and its decoded form.
+type step struct {
+	raw []byte
+	msg *chunk.Message
+}
+
+// command reports whether the server answers the step, so its responses
+// are collected before the next step is sent.
+func (s step) command() bool {
+	return s.msg.TypeID == 20 || s.msg.TypeID == 17
+}
+
+// capture is a parsed client.bin.
+type capture struct {
+	c0c1  []byte
+	c2    []byte
+	steps []step
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+// parseCapture splits a client capture into the handshake and messages.
+// The chunk reader applies the client's Set Chunk Size messages as it
+// goes, and, being unbuffered, stops exactly at the end of each message.
+func parseCapture(data []byte) (*capture, error) {
+	if len(data) < 1+2*handshakeSize {
+		return nil, fmt.Errorf("capture of %d bytes is shorter than the handshake", len(data))
+	}
+	c := &capture{c0c1: data[:1+handshakeSize], c2: data[1+handshakeSize : 1+2*handshakeSize]}
+	body := data[1+2*handshakeSize:]
+	cr := &countingReader{r: bytes.NewReader(body)}
+	r := chunk.NewReader(cr, 128)
+	start := 0
+	for start < len(body) {
+		msg, err := r.ReadMessage()
+		if err != nil {
+			return nil, fmt.Errorf("message %d at offset %d: %w", len(c.steps)+1, 1+2*handshakeSize+start, err)
+		}
+		c.steps = append(c.steps, step{raw: body[start:cr.n], msg: msg})
+		start = cr.n
+	}
+	return c, nil
+}
+
+// session replays a capture against a server and renders the exchange.
+type session struct {
+	conn net.Conn
+	msgs chan *chunk.Message
+	// want is the number of responses to each step in the golden (nil
+	// when rewriting it), indexed by transcript step.
+	want []int
+	out  []string
+}
+
+// run replays c over conn and returns the transcript.
+func run(conn net.Conn, c *capture, want []int) ([]string, error) {
+	s := &session{conn: conn, want: want}
+	defer conn.Close()
+
+	s.client(fmt.Sprintf("C0+C1 version %d, C1 %d bytes", c.c0c1[0], len(c.c0c1)-1))
+	if _, err := conn.Write(c.c0c1); err != nil {
+		return s.out, fmt.Errorf("write C0+C1: %w", err)
+	}
+	resp := make([]byte, 1+2*handshakeSize)
+	conn.SetReadDeadline(time.Now().Add(responseTimeout))
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return s.out, fmt.Errorf("read S0+S1+S2: %w", err)
+	}
+	conn.SetReadDeadline(time.Time{})
+	echo := "echoes C1"
+	if !bytes.Equal(resp[1+handshakeSize:], c.c0c1[1:]) {
+		echo = "does not echo C1"
+	}
+	s.server(fmt.Sprintf("S0+S1+S2 version %d, S2 %s", resp[0], echo))
+	s.client(fmt.Sprintf("C2 %d bytes", len(c.c2)))
+	if _, err := conn.Write(c.c2); err != nil {
+		return s.out, fmt.Errorf("write C2: %w", err)
+	}
+
+	s.msgs = make(chan *chunk.Message, 256)
+	go func() {
+		defer close(s.msgs)
+		r := chunk.NewReader(conn, 128)
+		for {
+			msg, err := r.ReadMessage()
+			if err != nil {
+				return
+			}
+			s.msgs <- msg
+		}
+	}()
+
+	for i, st := range c.steps {
+		s.client(describe(st.msg))
+		if _, err := conn.Write(st.raw); err != nil {
+			return s.out, fmt.Errorf("write message %d: %w", i+1, err)
+		}
+		if st.command() || i == len(c.steps)-1 {
+			s.collect()
+		}
+	}
+	return s.out, nil
+}
+
+// client adds a client line to the transcript.
+func (s *session) client(line string) {
+	s.out = append(s.out, "> "+line)
+}
+
+// server adds a server line to the transcript.
+func (s *session) server(line string) {
+	s.out = append(s.out, "< "+line)
+}
+
+// collect records the server's responses to the last client step: as many
+// as the golden expects followed by a quiet period, or, when rewriting
+// the golden, everything until the server goes quiet.
+func (s *session) collect() {
+	want, quiet := -1, quietUpdate
+	if s.want != nil {
+		want, quiet = 0, quietCheck
+		if n := s.steps() - 1; n < len(s.want) {
+			want = s.want[n]
+		}
+	}
+	deadline := time.After(responseTimeout)
+	got := 0
+	for {
+		var idle <-chan time.Time
+		if got >= want {
+			idle = time.After(quiet)
+		}
+		select {
+		case msg, ok := <-s.msgs:
+			if !ok {
+				s.msgs = nil
+				s.server("connection closed")
+				return
+			}
+			s.server(describe(msg))
+			got++
+		case <-idle:
+			return
+		case <-deadline:
+			return
+		}
+	}
+}
+
+// steps returns the number of client lines so far.
+func (s *session) steps() int {
+	n := 0
+	for _, l := range s.out {
+		if strings.HasPrefix(l, "> ") {
+			n++
+		}
+	}
+	return n
+}
+
+// expectedCounts returns, for each client line of a golden transcript, the
+// number of server lines that follow it.
+func expectedCounts(golden []string) []int {
+	var counts []int
+	for _, l := range golden {
+		switch {
+		case strings.HasPrefix(l, "> "):
+			counts = append(counts, 0)
+		case strings.HasPrefix(l, "< ") && len(counts) > 0:
+			counts[len(counts)-1]++
+		}
+	}
+	return counts
+}
+
+// messageTypes names the RTMP message types.
+var messageTypes = map[uint8]string{
+	1:  "SetChunkSize",
+	2:  "Abort",
+	3:  "Acknowledgement",
+	4:  "UserControl",
+	5:  "WindowAckSize",
+	6:  "SetPeerBandwidth",
+	8:  "Audio",
+	9:  "Video",
+	15: "DataAMF3",
+	17: "CommandAMF3",
+	18: "Data",
+	20: "Command",
+}
+
+// describe renders a message as one transcript line: type, chunk stream,
+// message stream and timestamp, then the decoded AMF values of commands
+// and data, the length of audio and video, or the payload in hex.
+func describe(m *chunk.Message) string {
+	name := messageTypes[m.TypeID]
+	if name == "" {
+		name = fmt.Sprintf("Type%d", m.TypeID)
+	}
+	head := fmt.Sprintf("%s csid=%d msid=%d ts=%d", name, m.CSID, m.MessageStreamID, m.Timestamp)
+	switch m.TypeID {
+	case 8, 9:
+		return fmt.Sprintf("%s len=%d", head, len(m.Payload))
+	case 15, 17, 18, 20:
+		p := m.Payload
+		if (m.TypeID == 15 || m.TypeID == 17) && len(p) > 0 && p[0] == 0 {
+			p = p[1:]
+		}
+		if vals, err := amf.DecodeAll(p); err == nil {
+			if js, err := json.Marshal(vals); err == nil {
+				return head + " " + string(js)
+			}
+		}
+	}
+	return head + " " + hex.EncodeToString(m.Payload)
+}
@@ -11,7 +11,8 @@
 //	    and forwards audio+video messages.
 //
 //	TestMultipleDestinations         – relay to 3 destination servers.
-//	    Publisher sends 10 audio + 10 video frames; test confirms
+//	    Publisher sends one second of synthetic media in real
+//	    time; test confirms
 //	    the relay fans out to all destinations.
 //
 //	TestDestinationFailureIsolation  – 2 working destinations +
@@ -24,6 +25,7 @@
 package integration
 
 import (
+	"context"
 	"fmt"
 	"testing"
 	"time"
@@ -190,18 +192,10 @@ func TestMultipleDestinations(t *testing.T) {
 		t.Fatalf("Publisher publish: %v", err)
 	}
 
-	// Send test media
-	testAudio := []byte{0xAF, 0x00, 0x01, 0x02, 0x03}
-	testVideo := []byte{0x17, 0x00, 0x01, 0x02, 0x03}
-
-	for i := 0; i < 10; i++ {
-		if err := pubClient.SendAudio(uint32(i*100), testAudio); err != nil {
-			t.Errorf("Send audio frame %d: %v", i, err)
-		}
-		if err := pubClient.SendVideo(uint32(i*100), testVideo); err != nil {
-			t.Errorf("Send video frame %d: %v", i, err)
-		}
-		time.Sleep(10 * time.Millisecond) // Small delay between frames
+	// Send a second of media at a live encoder's pace
+	src := &client.SyntheticStream{FPS: 10, VideoBitrate: 500_000, AudioBitrate: 64_000}
+	if _, err := pubClient.PublishSynthetic(context.Background(), src, time.Second); err != nil {
+		t.Errorf("Send synthetic media: %v", err)
 	}
 
 	// Give time for messages to propagate
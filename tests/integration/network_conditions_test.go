@@ -0,0 +1,97 @@
+// Package integration – end-to-end integration tests for the RTMP server.
+//
+// network_conditions_test.go runs clients over simulated links
+// (client.NetworkConditions) to check behaviour that loopback cannot show:
+//
+//	TestSlowSubscriberDoesNotStallStream – a subscriber capped to a few
+//	  KB/s must not hold up the publisher or a subscriber on a fast link.
+package integration
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/client"
+	"github.com/alxayo/go-rtmp/internal/rtmp/server"
+)
+
+func TestSlowSubscriberDoesNotStallStream(t *testing.T) {
+	srv := server.New(server.Config{ListenAddr: "127.0.0.1:0"})
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer srv.Stop()
+	url := fmt.Sprintf("rtmp://%s/live/netsim", srv.Addr().String())
+
+	dial := func(nc *client.NetworkConditions) *client.Client {
+		t.Helper()
+		c, err := client.New(url)
+		if err != nil {
+			t.Fatalf("client.New: %v", err)
+		}
+		c.Network = nc
+		if err := c.Connect(); err != nil {
+			t.Fatalf("connect: %v", err)
+		}
+		t.Cleanup(func() { c.Close() })
+		return c
+	}
+
+	pub := dial(nil)
+	if err := pub.Publish(); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	fast := dial(nil)
+	slow := dial(&client.NetworkConditions{Bandwidth: 8_000, Latency: 20 * time.Millisecond})
+	for _, c := range []*client.Client{fast, slow} {
+		if err := c.Play(); err != nil {
+			t.Fatalf("play: %v", err)
+		}
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	// The fast subscriber watches for the final frame.
+	marker := append([]byte{0x17, 0x01, 0, 0, 0}, []byte("last frame")...)
+	gotMarker := make(chan struct{})
+	go func() {
+		for {
+			msg, err := fast.ReadMessage()
+			if err != nil {
+				return
+			}
+			if msg.TypeID == 9 && bytes.Equal(msg.Payload, marker) {
+				close(gotMarker)
+				return
+			}
+		}
+	}()
+
+	// About 1 MB of keyframes: far more than the slow link carries in the
+	// time the test allows.
+	start := time.Now()
+	if err := pub.SendVideo(0, []byte{0x17, 0x00, 0, 0, 0, 0x01, 0x64, 0x00, 0x1f}); err != nil {
+		t.Fatalf("send sequence header: %v", err)
+	}
+	frame := append([]byte{0x17, 0x01, 0, 0, 0}, make([]byte, 4096)...)
+	for i := 1; i <= 250; i++ {
+		if err := pub.SendVideo(uint32(i*33), frame); err != nil {
+			t.Fatalf("send frame %d: %v", i, err)
+		}
+	}
+	if err := pub.SendVideo(251*33, marker); err != nil {
+		t.Fatalf("send final frame: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("publisher took %v to send, stalled by the slow subscriber", elapsed)
+	}
+
+	select {
+	case <-gotMarker:
+	case <-time.After(5 * time.Second):
+		t.Fatal("fast subscriber did not receive the final frame")
+	}
+}
@@ -0,0 +1,189 @@
+// Package integration – end-to-end integration tests for the RTMP server.
+//
+// push_test.go publishes an FLV with client.PushFLV (the engine of
+// cmd/rtmp-push):
+//
+//	TestPushFLVLoopAndReconnect – a looped file reaches a player with
+//	  timestamps that keep increasing, and after the publisher's connection
+//	  is cut the push reconnects, resends the sequence header and resumes
+//	  on a keyframe.
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
+	"github.com/alxayo/go-rtmp/internal/rtmp/client"
+	"github.com/alxayo/go-rtmp/internal/rtmp/server"
+)
+
+// buildFLV writes an FLV file holding onMetaData, an AVC sequence header
+// and 200ms of 25 fps video with a keyframe every 5 frames.
+func buildFLV(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	buf.Write([]byte{'F', 'L', 'V', 1, 0x01, 0, 0, 0, 9, 0, 0, 0, 0})
+	tag := func(typ uint8, ts uint32, data []byte) {
+		var hdr [11]byte
+		hdr[0] = typ
+		hdr[1], hdr[2], hdr[3] = byte(len(data)>>16), byte(len(data)>>8), byte(len(data))
+		hdr[4], hdr[5], hdr[6], hdr[7] = byte(ts>>16), byte(ts>>8), byte(ts), byte(ts>>24)
+		buf.Write(hdr[:])
+		buf.Write(data)
+		_ = binary.Write(&buf, binary.BigEndian, uint32(len(data)+11))
+	}
+	meta, err := amf.EncodeAll("onMetaData", map[string]interface{}{"width": 640.0, "height": 360.0})
+	if err != nil {
+		t.Fatalf("encode metadata: %v", err)
+	}
+	tag(18, 0, meta)
+	tag(9, 0, []byte{0x17, 0x00, 0, 0, 0, 0x01, 0x64, 0x00, 0x1f})
+	for i := 0; i < 5; i++ {
+		frame := []byte{0x27, 0x01, 0, 0, 0, byte(i)}
+		if i == 0 {
+			frame[0] = 0x17
+		}
+		tag(9, uint32(i*40), frame)
+	}
+	return buf.Bytes()
+}
+
+// videoPlayer plays url and sends the video it receives on the returned
+// channel.
+func videoPlayer(t *testing.T, url string) <-chan []byte {
+	t.Helper()
+	c, err := client.New(url)
+	if err != nil {
+		t.Fatalf("client.New: %v", err)
+	}
+	if err := c.Connect(); err != nil {
+		t.Fatalf("connect player: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	if err := c.Play(); err != nil {
+		t.Fatalf("play: %v", err)
+	}
+	out := make(chan []byte, 1024)
+	go func() {
+		defer close(out)
+		for {
+			m, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			if m.TypeID == 9 {
+				ts := make([]byte, 4)
+				binary.BigEndian.PutUint32(ts, m.Timestamp)
+				out <- append(ts, m.Payload...)
+			}
+		}
+	}()
+	return out
+}
+
+// nextVideo returns the timestamp and payload of the next video message.
+func nextVideo(t *testing.T, ch <-chan []byte) (uint32, []byte) {
+	t.Helper()
+	select {
+	case v, ok := <-ch:
+		if !ok {
+			t.Fatal("player disconnected")
+		}
+		return binary.BigEndian.Uint32(v), v[4:]
+	case <-time.After(5 * time.Second):
+		t.Fatal("no video within 5s")
+	}
+	return 0, nil
+}
+
+func TestPushFLVLoopAndReconnect(t *testing.T) {
+	srv := server.New(server.Config{ListenAddr: "127.0.0.1:0"})
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer srv.Stop()
+	url := fmt.Sprintf("rtmp://%s/live/push", srv.Addr().String())
+	file := buildFLV(t)
+
+	conns := make(chan net.Conn, 4)
+	var mu sync.Mutex
+	var reconnects []error
+	opts := client.PushOptions{
+		Loop:           true,
+		Reconnects:     3,
+		ReconnectDelay: 100 * time.Millisecond,
+		Configure: func(c *client.Client) {
+			c.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+				conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+				if err == nil {
+					conns <- conn
+				}
+				return conn, err
+			}
+		},
+		OnReconnect: func(_ int, err error) {
+			mu.Lock()
+			reconnects = append(reconnects, err)
+			mu.Unlock()
+		},
+	}
+	open := func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(file)), nil }
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	var stats client.PushStats
+	go func() {
+		var err error
+		stats, err = client.PushFLV(ctx, url, open, opts)
+		done <- err
+	}()
+	first := <-conns
+	time.Sleep(100 * time.Millisecond)
+
+	// The file lasts 200ms; a player sees it loop with increasing timestamps.
+	player := videoPlayer(t, url)
+	var last uint32
+	for last < 500 {
+		ts, _ := nextVideo(t, player)
+		if ts < last {
+			t.Fatalf("timestamp went back from %d to %d", last, ts)
+		}
+		last = ts
+	}
+
+	// Cut the connection: the push reconnects, sends the sequence header
+	// again and resumes on a keyframe, without going back in time.
+	first.Close()
+	select {
+	case <-conns:
+	case <-time.After(5 * time.Second):
+		t.Fatal("push did not reconnect")
+	}
+	for {
+		ts, p := nextVideo(t, player)
+		if p[1] == 0x00 {
+			break
+		}
+		last = ts
+	}
+	if ts, p := nextVideo(t, player); p[0] != 0x17 || ts < last {
+		t.Fatalf("video % x at %d after the sequence header, want a keyframe after %d", p, ts, last)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("PushFLV = %v, want context.Canceled", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reconnects) != 1 || stats.Reconnects != 1 || stats.Loops < 2 {
+		t.Fatalf("reconnect errors %v, stats %+v", reconnects, stats)
+	}
+}
@@ -0,0 +1,111 @@
+// Package integration – end-to-end integration tests for the RTMP server.
+//
+// replay_test.go records a session with the server's TraceDir and replays
+// the trace with trace.Replay:
+//
+//	TestReplayTrace – a traced publish session replays cleanly against a
+//	  fresh server, from the raw capture and re-chunked, and a trace whose
+//	  expected onStatus code was altered fails with ErrMissingResponse.
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/amf"
+	"github.com/alxayo/go-rtmp/internal/rtmp/client"
+	"github.com/alxayo/go-rtmp/internal/rtmp/server"
+	"github.com/alxayo/go-rtmp/internal/rtmp/trace"
+)
+
+func TestReplayTrace(t *testing.T) {
+	dir := t.TempDir()
+	recordSrv := server.New(server.Config{ListenAddr: "127.0.0.1:0", TraceDir: dir})
+	if err := recordSrv.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	c, err := client.New(fmt.Sprintf("rtmp://%s/live/replay", recordSrv.Addr().String()))
+	if err != nil {
+		t.Fatalf("client.New: %v", err)
+	}
+	if err := c.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if err := c.Publish(); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if err := c.SendVideo(0, []byte{0x17, 0x00, 0, 0, 0, 0x01, 0x64, 0x00, 0x1f}); err != nil {
+		t.Fatalf("send sequence header: %v", err)
+	}
+	for i := 1; i <= 5; i++ {
+		if err := c.SendVideo(uint32(i*33), []byte{0x17, 0x01, 0, 0, 0, byte(i)}); err != nil {
+			t.Fatalf("send frame %d: %v", i, err)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	c.Close()
+	recordSrv.Stop()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if len(files) != 1 {
+		t.Fatalf("got %d trace files, want 1", len(files))
+	}
+	h, recs, err := trace.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("read trace: %v", err)
+	}
+	raw, err := trace.ReadRaw(files[0], h)
+	if err != nil || len(raw) == 0 {
+		t.Fatalf("read raw capture: %d bytes, %v", len(raw), err)
+	}
+
+	replaySrv := server.New(server.Config{ListenAddr: "127.0.0.1:0"})
+	if err := replaySrv.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer replaySrv.Stop()
+	replay := func(recs []trace.Record, raw []byte) (trace.ReplayResult, error) {
+		t.Helper()
+		conn, err := net.Dial("tcp", replaySrv.Addr().String())
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		return trace.Replay(context.Background(), conn, recs, trace.ReplayOptions{ResponseTimeout: 500 * time.Millisecond, Raw: raw})
+	}
+
+	for name, raw := range map[string][]byte{"raw capture": raw, "re-chunked": nil} {
+		res, err := replay(recs, raw)
+		if err != nil {
+			t.Fatalf("replay (%s): %v", name, err)
+		}
+		// connect and createStream results, onStatus NetStream.Publish.Start.
+		if res.Checked < 3 || res.Sent < 6 {
+			t.Fatalf("replay (%s) checked %d responses and sent %d messages, want at least 3 and 6", name, res.Checked, res.Sent)
+		}
+	}
+
+	// Expect a status code the server never sends.
+	altered := append([]trace.Record(nil), recs...)
+	found := false
+	for i, rec := range altered {
+		if rec.Dir == trace.Out && trace.ResponseKey(rec.TypeID, rec.Payload) == "onStatus NetStream.Publish.Start" {
+			payload, err := amf.EncodeAll("onStatus", 0.0, nil, map[string]interface{}{"level": "status", "code": "NetStream.Publish.Bogus"})
+			if err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+			altered[i].Payload = payload
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("trace has no onStatus NetStream.Publish.Start")
+	}
+	if _, err := replay(altered, raw); !errors.Is(err, trace.ErrMissingResponse) {
+		t.Fatalf("replay of altered trace: err = %v, want ErrMissingResponse", err)
+	}
+}
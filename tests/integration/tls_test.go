@@ -189,6 +189,50 @@ func TestRTMPS_DualListener(t *testing.T) {
 	t.Log("✓ Dual listener test passed: both plain RTMP and RTMPS work simultaneously")
 }
 
+// TestRTMPS_SelfSigned verifies that with TLSSelfSigned and no certificate
+// files the server generates a certificate valid for localhost and the
+// loopback address, and RTMPS clients that skip verification can publish.
+func TestRTMPS_SelfSigned(t *testing.T) {
+	s := srv.New(srv.Config{
+		ListenAddr:    "127.0.0.1:0",
+		TLSListenAddr: "127.0.0.1:0",
+		TLSSelfSigned: true,
+		ChunkSize:     4096,
+	})
+	if err := s.Start(); err != nil {
+		t.Fatalf("server start: %v", err)
+	}
+	defer s.Stop()
+
+	conn, err := tls.Dial("tcp", s.TLSAddr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("tls dial: %v", err)
+	}
+	cert := conn.ConnectionState().PeerCertificates[0]
+	conn.Close()
+	for _, host := range []string{"localhost", "127.0.0.1"} {
+		if err := cert.VerifyHostname(host); err != nil {
+			t.Errorf("generated certificate not valid for %s: %v", host, err)
+		}
+	}
+	if time.Until(cert.NotAfter) < 24*time.Hour {
+		t.Errorf("generated certificate expires at %v", cert.NotAfter)
+	}
+
+	c, err := client.New(fmt.Sprintf("rtmps://%s/live/self_signed", s.TLSAddr().String()))
+	if err != nil {
+		t.Fatalf("client new: %v", err)
+	}
+	c.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+	defer c.Close()
+	if err := c.Connect(); err != nil {
+		t.Fatalf("connect over TLS: %v", err)
+	}
+	if err := c.Publish(); err != nil {
+		t.Fatalf("publish over TLS: %v", err)
+	}
+}
+
 // TestRTMPS_InvalidCertPaths verifies the server fails to start when given
 // invalid TLS certificate file paths.
 func TestRTMPS_InvalidCertPaths(t *testing.T) {
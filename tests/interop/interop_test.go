@@ -0,0 +1,199 @@
+//go:build interop
+
+// Package interop – end-to-end tests against real-world RTMP clients.
+//
+// interop_test.go drives the server with FFmpeg instead of the in-repo
+// client, so protocol regressions that only show up with a real encoder or
+// player are caught by `go test`:
+//
+//	TestFFmpegPublishFFprobePlay – ffmpeg publishes a synthetic test
+//	  pattern; ffprobe plays the live stream back and must see H.264 at the
+//	  published resolution plus AAC audio. The server records the stream
+//	  and ffprobe must report the recording's duration.
+//
+// The suite is behind the "interop" build tag and skips when ffmpeg or
+// ffprobe is not on PATH:
+//
+//	go test -tags interop ./tests/interop/
+package interop
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alxayo/go-rtmp/internal/rtmp/server"
+)
+
+const (
+	// Test pattern published by ffmpeg.
+	patternWidth   = 320
+	patternHeight  = 240
+	patternSeconds = 4
+	durationSlack  = 0.5 // allowed drift in the recorded duration, seconds
+)
+
+// ffprobeResult is the subset of `ffprobe -of json` output the tests check.
+type ffprobeResult struct {
+	Streams []struct {
+		CodecType string `json:"codec_type"`
+		CodecName string `json:"codec_name"`
+		Width     int    `json:"width"`
+		Height    int    `json:"height"`
+	} `json:"streams"`
+	Format struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
+}
+
+// requireTools skips the test unless every named executable is on PATH.
+func requireTools(t *testing.T, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if _, err := exec.LookPath(name); err != nil {
+			t.Skipf("%s not found on PATH; skipping interop test", name)
+		}
+	}
+}
+
+// runFFprobe runs ffprobe on input and decodes its stream and format info.
+func runFFprobe(ctx context.Context, input string) (*ffprobeResult, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe",
+		"-hide_banner", "-v", "error",
+		"-show_streams", "-show_format",
+		"-of", "json", input)
+	out, err := cmd.Output()
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("ffprobe %s: %w: %s", input, err, ee.Stderr)
+		}
+		return nil, fmt.Errorf("ffprobe %s: %w", input, err)
+	}
+	var res ffprobeResult
+	if err := json.Unmarshal(out, &res); err != nil {
+		return nil, fmt.Errorf("decode ffprobe output: %w", err)
+	}
+	return &res, nil
+}
+
+// TestFFmpegPublishFFprobePlay publishes a test pattern with ffmpeg and
+// checks live playback and the resulting recording with ffprobe.
+func TestFFmpegPublishFFprobePlay(t *testing.T) {
+	requireTools(t, "ffmpeg", "ffprobe")
+
+	recordDir := t.TempDir()
+	srv := server.New(server.Config{
+		ListenAddr: "127.0.0.1:0",
+		RecordAll:  true,
+		RecordDir:  recordDir,
+	})
+	if err := srv.Start(); err != nil {
+		t.Fatalf("server start: %v", err)
+	}
+	defer srv.Stop()
+	url := fmt.Sprintf("rtmp://%s/live/interop", srv.Addr().String())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	// Publish in real time (-re) so the stream is still live while ffprobe
+	// connects to it.
+	pub := exec.CommandContext(ctx, "ffmpeg",
+		"-hide_banner", "-loglevel", "error", "-re",
+		"-f", "lavfi", "-i", fmt.Sprintf("testsrc=size=%dx%d:rate=25", patternWidth, patternHeight),
+		"-f", "lavfi", "-i", "sine=frequency=1000:sample_rate=44100",
+		"-t", strconv.Itoa(patternSeconds),
+		"-c:v", "libx264", "-pix_fmt", "yuv420p", "-g", "25",
+		"-c:a", "aac",
+		"-f", "flv", url)
+	pubOut := &limitedBuffer{}
+	pub.Stderr = pubOut
+	if err := pub.Start(); err != nil {
+		t.Fatalf("start ffmpeg: %v", err)
+	}
+	pubDone := make(chan error, 1)
+	go func() { pubDone <- pub.Wait() }()
+
+	// Give ffmpeg time to connect and send the sequence headers.
+	time.Sleep(1500 * time.Millisecond)
+
+	live, err := runFFprobe(ctx, url)
+	if err != nil {
+		t.Fatalf("live playback: %v", err)
+	}
+	var sawVideo, sawAudio bool
+	for _, s := range live.Streams {
+		switch s.CodecType {
+		case "video":
+			sawVideo = true
+			if s.CodecName != "h264" {
+				t.Errorf("live video codec = %q, want h264", s.CodecName)
+			}
+			if s.Width != patternWidth || s.Height != patternHeight {
+				t.Errorf("live resolution = %dx%d, want %dx%d", s.Width, s.Height, patternWidth, patternHeight)
+			}
+		case "audio":
+			sawAudio = true
+			if s.CodecName != "aac" {
+				t.Errorf("live audio codec = %q, want aac", s.CodecName)
+			}
+		}
+	}
+	if !sawVideo || !sawAudio {
+		t.Errorf("live playback streams: video=%v audio=%v, want both", sawVideo, sawAudio)
+	}
+
+	if err := <-pubDone; err != nil {
+		t.Fatalf("ffmpeg publish: %v: %s", err, pubOut.String())
+	}
+
+	// The recorder is closed when the publisher disconnects.
+	var recordings []string
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		recordings, _ = filepath.Glob(filepath.Join(recordDir, "*.flv"))
+		if len(recordings) > 0 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(recordings) != 1 {
+		t.Fatalf("expected 1 recording in %s, got %v", recordDir, recordings)
+	}
+	time.Sleep(200 * time.Millisecond) // let the recorder flush and close
+
+	rec, err := runFFprobe(ctx, recordings[0])
+	if err != nil {
+		t.Fatalf("probe recording: %v", err)
+	}
+	dur, err := strconv.ParseFloat(rec.Format.Duration, 64)
+	if err != nil {
+		t.Fatalf("recording duration %q: %v", rec.Format.Duration, err)
+	}
+	if math.Abs(dur-patternSeconds) > durationSlack {
+		t.Errorf("recording duration = %.2fs, want %ds ± %.1fs", dur, patternSeconds, durationSlack)
+	}
+}
+
+// limitedBuffer keeps the first few KB of a child process's stderr for
+// failure messages.
+type limitedBuffer struct{ b []byte }
+
+func (l *limitedBuffer) Write(p []byte) (int, error) {
+	const max = 4096
+	if room := max - len(l.b); room > 0 {
+		if len(p) < room {
+			room = len(p)
+		}
+		l.b = append(l.b, p[:room]...)
+	}
+	return len(p), nil
+}
+
+func (l *limitedBuffer) String() string { return string(l.b) }